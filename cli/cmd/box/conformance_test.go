@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestConformance_InitProjectBuilds scaffolds the project box init creates, compiles it
+// against this checkout of box, and runs box build over its handlers. It catches drift
+// between the project templates and the router/build APIs.
+//
+// Generated functions and containers pull in functions-framework and pgx, so compiling
+// them needs module downloads; set BOX_CONFORMANCE_GENERATED=1 to include that step
+func TestConformance_InitProjectBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles a scaffolded project")
+	}
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	boxRoot, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scaffold with the version release builds embed, as box init would
+	boxVersion, err := os.ReadFile(filepath.Join(boxRoot, "VERSION"))
+	if err != nil {
+		t.Fatalf("Failed to read VERSION: %v", err)
+	}
+	defer func(saved string) { version = saved }(version)
+	version = strings.TrimSpace(string(boxVersion))
+
+	project := filepath.Join(t.TempDir(), "example")
+	if err := createProject("example", LanguageGo, project, "box-conformance", nil, nil); err != nil {
+		t.Fatalf("createProject() error = %v", err)
+	}
+
+	// Build against this checkout rather than the released module
+	goMod, err := os.OpenFile(filepath.Join(project, "go.mod"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = goMod.WriteString("\nreplace github.com/gravelight-studio/box => " + boxRoot + "\n")
+	goMod.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goCmd := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command(goTool, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s in %s failed: %v\n%s", strings.Join(args, " "), dir, err, out)
+		}
+	}
+
+	goCmd(project, "build", "./...")
+	goCmd(project, "vet", "./...")
+
+	handlersDir := filepath.Join(project, "handlers")
+	parsed, err := parseHandlers(LanguageGo, handlersDir)
+	if err != nil {
+		t.Fatalf("parseHandlers() error = %v", err)
+	}
+	if err := validateHandlers(parsed.Handlers, zap.NewNop()); err != nil {
+		t.Fatalf("scaffolded handlers fail validation: %v", err)
+	}
+
+	opts := buildOptions{
+		handlersDir:     handlersDir,
+		outputDir:       filepath.Join(project, "build"),
+		projectID:       "test-project",
+		region:          "us-central1",
+		environment:     "dev",
+		moduleName:      "github.com/box-conformance/example",
+		requireHandlers: true,
+	}
+	if err := buildGo(opts, zap.NewNop()); err != nil {
+		t.Fatalf("buildGo() error = %v", err)
+	}
+
+	functions, _ := filepath.Glob(filepath.Join(opts.outputDir, "functions", "*", "main.go"))
+	containers, _ := filepath.Glob(filepath.Join(opts.outputDir, "containers", "*", "main.go"))
+	if want := countFunctions(parsed.Handlers); len(functions) != want {
+		t.Errorf("generated %d functions, want %d", len(functions), want)
+	}
+
+	if os.Getenv("BOX_CONFORMANCE_GENERATED") == "" {
+		t.Log("skipping generated code compilation; set BOX_CONFORMANCE_GENERATED=1 to run it")
+		return
+	}
+
+	// Each function is its own module replacing the project with ../../..
+	for _, entrypoint := range functions {
+		goCmd(filepath.Dir(entrypoint), "build", "./...")
+	}
+
+	// Containers build inside the project module, as their Dockerfiles do
+	for _, entrypoint := range containers {
+		rel, err := filepath.Rel(project, filepath.Dir(entrypoint))
+		if err != nil {
+			t.Fatal(err)
+		}
+		goCmd(project, "build", "./"+filepath.ToSlash(rel))
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+// deployKind is the kind of artifact a generated deploy.sh deploys
+// Kinds are declared in deployment order: the gateway routes to the functions and services
+type deployKind int
+
+const (
+	deployFunction deployKind = iota
+	deployLambda
+	deployService
+	deployGateway
+)
+
+// deployTarget is one generated deploy.sh
+type deployTarget struct {
+	Name string // Artifact path within the output directory (e.g., "functions/create-account")
+	Kind deployKind
+	Dir  string // Directory the script runs in
+}
+
+// deployResult records which targets a deploy ran
+type deployResult struct {
+	Succeeded []string
+	Failed    []string
+	Skipped   []string // Not started because an earlier target failed
+}
+
+func deployCommand() {
+	cfg, err := config.LoadConfig(config.FileName)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	deployFlags := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	outputDir := deployFlags.String("output", orDefault(cfg.OutputDir, "./build"), "Path to the output directory of box build")
+	functionName := deployFlags.String("function", "", "Deploy only this function (its directory name, e.g. create-account)")
+	serviceName := deployFlags.String("service", "", "Deploy only this container service")
+	parallel := deployFlags.Bool("parallel", false, "Deploy functions concurrently; services and the gateway still deploy one at a time")
+
+	deployFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: box deploy [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Run the deploy.sh scripts generated by box build: functions first, then container\n")
+		fmt.Fprintf(os.Stderr, "services, then the API Gateway. Apply build/terraform before the first deploy, so the\n")
+		fmt.Fprintf(os.Stderr, "networking they use exists.\n\n")
+		fmt.Fprintf(os.Stderr, "Options (defaults come from %s when present):\n", config.FileName)
+		deployFlags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  box deploy\n")
+		fmt.Fprintf(os.Stderr, "  box deploy --parallel\n")
+		fmt.Fprintf(os.Stderr, "  box deploy --function create-account\n\n")
+	}
+
+	parseFlags(deployFlags, os.Args[2:])
+
+	targets, err := findDeployTargets(*outputDir)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	if *functionName != "" || *serviceName != "" {
+		targets = selectDeployTargets(targets, *functionName, *serviceName)
+		if len(targets) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no generated deploy.sh matches --function %q / --service %q in %s\n\n", *functionName, *serviceName, *outputDir)
+			deployFlags.Usage()
+			os.Exit(exitUsage)
+		}
+	}
+	if len(targets) == 0 {
+		fail(exitUsage, "no deploy scripts found in %s; run box build first", *outputDir)
+	}
+
+	// Every script but the lambdas' deploys with gcloud
+	for _, target := range targets {
+		if target.Kind == deployLambda {
+			continue
+		}
+		if _, err := exec.LookPath("gcloud"); err != nil {
+			fail(exitUsage, "gcloud not found in PATH. Install the Google Cloud CLI (https://cloud.google.com/sdk/docs/install), then run gcloud auth login")
+		}
+		break
+	}
+
+	fmt.Printf("🚀 Deploying %d artifact(s) from %s\n", len(targets), *outputDir)
+
+	deployer := &deployer{
+		parallel: *parallel,
+		command:  deployScriptCommand,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+	}
+	result := deployer.run(targets)
+
+	printDeploySummary(os.Stdout, result)
+	if len(result.Failed) > 0 {
+		os.Exit(exitDeploy)
+	}
+}
+
+// findDeployTargets lists the deploy scripts of a build, in deployment order
+// The build manifest names the artifacts; without one (e.g., a TypeScript build), the
+// output directory is scanned instead
+func findDeployTargets(outputDir string) ([]deployTarget, error) {
+	manifest, err := build.LoadManifest(filepath.Join(outputDir, build.ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var artifacts []string
+	if manifest != nil {
+		for artifact := range manifest.Artifacts {
+			artifacts = append(artifacts, artifact)
+		}
+	} else {
+		for _, pattern := range []string{"functions/*", "containers/*", "gateway"} {
+			matches, err := filepath.Glob(filepath.Join(outputDir, filepath.FromSlash(pattern)))
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range matches {
+				rel, err := filepath.Rel(outputDir, match)
+				if err != nil {
+					return nil, err
+				}
+				artifacts = append(artifacts, filepath.ToSlash(rel))
+			}
+		}
+	}
+
+	var targets []deployTarget
+	add := func(name string, kind deployKind) {
+		dir := filepath.Join(outputDir, filepath.FromSlash(name))
+		if _, err := os.Stat(filepath.Join(dir, "deploy.sh")); err == nil {
+			targets = append(targets, deployTarget{Name: name, Kind: kind, Dir: dir})
+		}
+	}
+
+	for _, artifact := range artifacts {
+		switch {
+		case strings.HasPrefix(artifact, "functions/"):
+			add(artifact, deployFunction)
+		case strings.HasPrefix(artifact, "containers/"):
+			add(artifact, deployService)
+		case artifact == "gateway":
+			add(artifact, deployGateway)
+		case artifact == "lambdas":
+			// One manifest entry covers every lambda
+			entries, err := os.ReadDir(filepath.Join(outputDir, "lambdas"))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					add(path.Join("lambdas", entry.Name()), deployLambda)
+				}
+			}
+		}
+	}
+
+	sortDeployTargets(targets)
+	return targets, nil
+}
+
+// sortDeployTargets orders targets by kind, then by name
+func sortDeployTargets(targets []deployTarget) {
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Kind != targets[j].Kind {
+			return targets[i].Kind < targets[j].Kind
+		}
+		return targets[i].Name < targets[j].Name
+	})
+}
+
+// selectDeployTargets keeps the named function and service
+func selectDeployTargets(targets []deployTarget, function, service string) []deployTarget {
+	var selected []deployTarget
+	for _, target := range targets {
+		name := path.Base(target.Name)
+		if (target.Kind == deployFunction && function != "" && name == function) ||
+			(target.Kind == deployService && service != "" && name == service) {
+			selected = append(selected, target)
+		}
+	}
+	return selected
+}
+
+// deployScriptCommand runs a target's deploy.sh in its directory
+func deployScriptCommand(target deployTarget) *exec.Cmd {
+	cmd := exec.Command("bash", "deploy.sh")
+	cmd.Dir = target.Dir
+	return cmd
+}
+
+// deployer runs deploy scripts in order, stopping at the first failure
+type deployer struct {
+	parallel bool                                // Run consecutive functions concurrently
+	command  func(target deployTarget) *exec.Cmd // Builds the command of each target
+	stdout   io.Writer
+	stderr   io.Writer
+	mu       sync.Mutex // Serializes output lines and the result
+}
+
+// run deploys targets, which must be in deployment order
+func (d *deployer) run(targets []deployTarget) deployResult {
+	var result deployResult
+	for i := 0; i < len(targets); {
+		// A batch is one target, or with --parallel every consecutive function
+		end := i + 1
+		if d.parallel && targets[i].Kind == deployFunction {
+			for end < len(targets) && targets[end].Kind == deployFunction {
+				end++
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, target := range targets[i:end] {
+			wg.Add(1)
+			go func(target deployTarget) {
+				defer wg.Done()
+				err := d.deploy(target)
+
+				d.mu.Lock()
+				defer d.mu.Unlock()
+				if err != nil {
+					fmt.Fprintf(d.stderr, "[%s] ✗ %v\n", target.Name, err)
+					result.Failed = append(result.Failed, target.Name)
+				} else {
+					result.Succeeded = append(result.Succeeded, target.Name)
+				}
+			}(target)
+		}
+		wg.Wait()
+		i = end
+
+		if len(result.Failed) > 0 {
+			for _, target := range targets[i:] {
+				result.Skipped = append(result.Skipped, target.Name)
+			}
+			break
+		}
+	}
+
+	sort.Strings(result.Succeeded)
+	sort.Strings(result.Failed)
+	return result
+}
+
+// deploy runs one target's script, prefixing each line it prints with the target name
+func (d *deployer) deploy(target deployTarget) error {
+	stdout := &prefixWriter{prefix: "[" + target.Name + "] ", w: d.stdout, mu: &d.mu}
+	stderr := &prefixWriter{prefix: "[" + target.Name + "] ", w: d.stderr, mu: &d.mu}
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	cmd := d.command(target)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// prefixWriter writes each complete line with a prefix, holding back a partial line
+// until it ends, so concurrent deploys don't interleave within a line
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes a trailing line without a newline
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
+
+// printDeploySummary lists what a deploy succeeded, failed and skipped
+func printDeploySummary(w io.Writer, result deployResult) {
+	fmt.Fprintln(w, "\nDeploy summary:")
+	for _, name := range result.Succeeded {
+		fmt.Fprintf(w, "  ✓ %s\n", name)
+	}
+	for _, name := range result.Failed {
+		fmt.Fprintf(w, "  ✗ %s\n", name)
+	}
+	for _, name := range result.Skipped {
+		fmt.Fprintf(w, "  - %s (skipped)\n", name)
+	}
+
+	if len(result.Failed) > 0 {
+		fmt.Fprintf(w, "\n❌ %d deployed, %d failed, %d skipped\n", len(result.Succeeded), len(result.Failed), len(result.Skipped))
+		return
+	}
+	fmt.Fprintf(w, "\n✅ Deployed %d artifact(s)\n", len(result.Succeeded))
+}
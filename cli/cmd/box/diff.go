@@ -0,0 +1,383 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+// Diff output formats
+const (
+	diffFormatSummary = "summary" // One line per artifact, with line diffs of the gateway spec and Terraform
+	diffFormatPatch   = "patch"   // A unified diff of every changed file
+)
+
+// Artifact statuses reported by box diff
+const (
+	artifactAdded     = "added"
+	artifactModified  = "modified"
+	artifactRemoved   = "removed"
+	artifactUnchanged = "unchanged"
+)
+
+// ANSI colors of the diff summary
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorGray   = "\033[90m"
+)
+
+// artifactDiff is the status of one generated artifact (a function, a service, the gateway, ...)
+type artifactDiff struct {
+	Name   string
+	Status string
+	Files  []build.OutputDrift
+}
+
+func diffCommand() {
+	cfg, err := config.LoadConfig(config.FileName)
+	if err != nil {
+		fail(exitDiffError, "%v", err)
+	}
+	timeoutDefault := build.DefaultTimeout
+	if cfg.Defaults.Timeout > 0 {
+		timeoutDefault = cfg.Defaults.Timeout
+	}
+
+	diffFlags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	handlersDir := diffFlags.String("handlers", orDefault(cfg.HandlersDir, "./handlers"), "Path to handlers directory")
+	outputDir := diffFlags.String("output", orDefault(cfg.OutputDir, "./build"), "Path to the output directory to compare against")
+	projectID := diffFlags.String("project", cfg.ProjectID, "GCP project ID (required)")
+	region := diffFlags.String("region", orDefault(cfg.Region, "us-central1"), "GCP region")
+	environment := diffFlags.String("env", orDefault(cfg.Environment, "dev"), "Environment (dev, staging, production)")
+	moduleName := diffFlags.String("module", cfg.ModuleName, "Module name (auto-detected if not provided)")
+	format := diffFlags.String("format", diffFormatSummary, "Output format: summary, or patch for a unified diff")
+	verbose := diffFlags.Bool("verbose", cfg.Verbose, "Log every build step instead of only warnings and errors")
+
+	diffFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: box diff [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Show what box build would change in the output directory, without writing to it.\n")
+		fmt.Fprintf(os.Stderr, "Exits 0 when nothing would change, 1 when something would and 2 on errors.\n\n")
+		fmt.Fprintf(os.Stderr, "Options (defaults come from %s when present):\n", config.FileName)
+		diffFlags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  box diff --project my-gcp-project\n")
+		fmt.Fprintf(os.Stderr, "  box diff --project my-gcp-project --format patch > build.patch\n\n")
+	}
+
+	if err := diffFlags.Parse(os.Args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitSuccess)
+		}
+		os.Exit(exitDiffError)
+	}
+
+	if *projectID == "" {
+		fmt.Fprintf(os.Stderr, "Error: --project flag (or projectID in %s) is required\n\n", config.FileName)
+		diffFlags.Usage()
+		os.Exit(exitDiffError)
+	}
+	if *format != diffFormatSummary && *format != diffFormatPatch {
+		fmt.Fprintf(os.Stderr, "Error: --format must be %s or %s, got %q\n\n", diffFormatSummary, diffFormatPatch, *format)
+		diffFlags.Usage()
+		os.Exit(exitDiffError)
+	}
+
+	lang, err := detectLanguage()
+	if err != nil {
+		fail(exitDiffError, "%v", err)
+	}
+
+	// The build runs into a temporary directory, so only warnings and errors are logged by default
+	var logger *zap.Logger
+	if *verbose {
+		logger, err = zap.NewDevelopment()
+	} else {
+		zapConfig := zap.NewProductionConfig()
+		zapConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+		logger, err = zapConfig.Build()
+	}
+	if err != nil {
+		fail(exitDiffError, "Failed to create logger: %v", err)
+	}
+	defer logger.Sync()
+
+	opts := buildOptions{
+		handlersDir:     *handlersDir,
+		outputDir:       *outputDir,
+		projectID:       *projectID,
+		region:          *region,
+		environment:     *environment,
+		moduleName:      *moduleName,
+		gateway:         build.GatewayGCP,
+		defaultTimeout:  timeoutDefault,
+		healthPath:      build.DefaultHealthPath,
+		defaultRoles:    build.DefaultServiceAccountRoles,
+		requireHandlers: true,
+		boxConfig:       cfg,
+	}
+
+	buildFn := buildGo
+	if lang == LanguageTypeScript {
+		buildFn = buildTypeScript
+	}
+
+	changed, err := runDiff(os.Stdout, opts, buildFn, *format, isTerminal(os.Stdout), logger)
+	if err != nil {
+		logger.Sync()
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(diffExitCode(changed, err))
+}
+
+// diffExitCode follows diff(1): 0 without changes, 1 with changes, 2 on errors
+func diffExitCode(changed bool, err error) int {
+	switch {
+	case err != nil:
+		return exitDiffError
+	case changed:
+		return exitDiffChanges
+	default:
+		return exitSuccess
+	}
+}
+
+// runDiff builds into a temporary directory and writes how opts.outputDir differs from it
+// It reports whether anything would change; opts.outputDir itself is never written
+func runDiff(w io.Writer, opts buildOptions, buildFn func(buildOptions, *zap.Logger) error, format string, color bool, logger *zap.Logger) (bool, error) {
+	tmpDir, err := os.MkdirTemp("", "box-diff-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary output directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	committedDir := opts.outputDir
+	opts.outputDir = tmpDir
+	opts.clean = false
+	opts.check = true
+	if err := buildFn(opts, logger); err != nil {
+		return false, err
+	}
+
+	drift, err := build.CompareOutput(tmpDir, committedDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare output: %w", err)
+	}
+	generated, err := build.ListOutputFiles(tmpDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to list generated output: %w", err)
+	}
+
+	if format == diffFormatPatch {
+		for _, file := range drift {
+			if err := writeFilePatch(w, tmpDir, committedDir, file); err != nil {
+				return false, err
+			}
+		}
+		return len(drift) > 0, nil
+	}
+
+	artifacts := groupArtifacts(generated, drift)
+	if err := writeDiffSummary(w, tmpDir, committedDir, artifacts, color); err != nil {
+		return false, err
+	}
+	return len(drift) > 0, nil
+}
+
+// artifactName returns the artifact a generated file belongs to: the directory of a
+// function, service or lambda, or the top-level entry (gateway, terraform, firebase.json)
+func artifactName(path string) string {
+	parts := strings.SplitN(path, "/", 3)
+	switch parts[0] {
+	case "functions", "containers", "lambdas", "k8s":
+		if len(parts) == 3 {
+			return parts[0] + "/" + parts[1]
+		}
+	}
+	return parts[0]
+}
+
+// groupArtifacts sorts drifted files into their artifacts; generated artifacts without
+// drift are unchanged
+func groupArtifacts(generated map[string]bool, drift []build.OutputDrift) []artifactDiff {
+	added := make(map[string]bool, len(drift))
+	byName := make(map[string]*artifactDiff)
+	for _, file := range drift {
+		name := artifactName(file.Path)
+		if byName[name] == nil {
+			byName[name] = &artifactDiff{Name: name}
+		}
+		byName[name].Files = append(byName[name].Files, file)
+		added[file.Path] = file.Status == build.DriftAdded
+	}
+
+	// An artifact is new when none of its generated files existed before
+	isGenerated := make(map[string]bool)
+	existed := make(map[string]bool)
+	for path := range generated {
+		name := artifactName(path)
+		isGenerated[name] = true
+		if !added[path] {
+			existed[name] = true
+		}
+		if byName[name] == nil {
+			byName[name] = &artifactDiff{Name: name}
+		}
+	}
+
+	artifacts := make([]artifactDiff, 0, len(byName))
+	for name, a := range byName {
+		switch {
+		case len(a.Files) == 0:
+			a.Status = artifactUnchanged
+		case !isGenerated[name]:
+			a.Status = artifactRemoved
+		case !existed[name]:
+			a.Status = artifactAdded
+		default:
+			a.Status = artifactModified
+		}
+		artifacts = append(artifacts, *a)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts
+}
+
+// writeDiffSummary writes one colored line per artifact, followed by the line diffs of
+// modified gateway specs and Terraform files
+func writeDiffSummary(w io.Writer, generatedDir, committedDir string, artifacts []artifactDiff, color bool) error {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	counts := make(map[string]int)
+	for _, a := range artifacts {
+		counts[a.Status]++
+
+		var line string
+		switch a.Status {
+		case artifactAdded:
+			line = paint(colorGreen, "+ "+a.Name+" (added)")
+		case artifactModified:
+			line = paint(colorYellow, "~ "+a.Name+" (modified)")
+		case artifactRemoved:
+			line = paint(colorRed, "- "+a.Name+" (removed)")
+		default:
+			line = paint(colorGray, "  "+a.Name+" (unchanged)")
+		}
+		fmt.Fprintf(w, "%s\n", line)
+
+		for _, file := range a.Files {
+			if file.Status != build.DriftModified || !showsLineDiff(file.Path) {
+				continue
+			}
+			patch, err := filePatch(generatedDir, committedDir, file)
+			if err != nil {
+				return err
+			}
+			for _, diffLine := range strings.SplitAfter(patch, "\n") {
+				switch {
+				case diffLine == "":
+					continue
+				case strings.HasPrefix(diffLine, "+") && !strings.HasPrefix(diffLine, "+++"):
+					diffLine = paint(colorGreen, strings.TrimSuffix(diffLine, "\n")) + "\n"
+				case strings.HasPrefix(diffLine, "-") && !strings.HasPrefix(diffLine, "---"):
+					diffLine = paint(colorRed, strings.TrimSuffix(diffLine, "\n")) + "\n"
+				}
+				fmt.Fprintf(w, "    %s", diffLine)
+			}
+		}
+	}
+
+	changed := counts[artifactAdded] + counts[artifactModified] + counts[artifactRemoved]
+	if changed == 0 {
+		fmt.Fprintf(w, "\n✅ No changes: %s is up to date\n", committedDir)
+		return nil
+	}
+	fmt.Fprintf(w, "\n%d added, %d modified, %d removed, %d unchanged\n",
+		counts[artifactAdded], counts[artifactModified], counts[artifactRemoved], counts[artifactUnchanged])
+	return nil
+}
+
+// showsLineDiff reports whether the summary diffs a file line by line: the gateway spec
+// and Terraform, the files reviewers most need to read before applying
+func showsLineDiff(path string) bool {
+	return path == "gateway/openapi.yaml" || strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".tfvars")
+}
+
+// writeFilePatch writes the unified diff of one drifted file
+func writeFilePatch(w io.Writer, generatedDir, committedDir string, file build.OutputDrift) error {
+	patch, err := filePatch(generatedDir, committedDir, file)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, patch)
+	return err
+}
+
+// filePatch renders the unified diff (committed -> generated) of a drifted file, with paths
+// relative to the working directory so patch tools can apply it
+func filePatch(generatedDir, committedDir string, file build.OutputDrift) (string, error) {
+	path := filepath.ToSlash(filepath.Join(committedDir, filepath.FromSlash(file.Path)))
+	diff := difflib.UnifiedDiff{
+		FromFile: "a/" + path,
+		ToFile:   "b/" + path,
+		Context:  3,
+	}
+
+	if file.Status != build.DriftAdded {
+		content, err := os.ReadFile(filepath.Join(committedDir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return "", fmt.Errorf("failed to read committed %s: %w", file.Path, err)
+		}
+		diff.A = splitLines(string(content))
+	} else {
+		diff.FromFile = "/dev/null"
+	}
+	if file.Status != build.DriftRemoved {
+		content, err := os.ReadFile(filepath.Join(generatedDir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return "", fmt.Errorf("failed to read generated %s: %w", file.Path, err)
+		}
+		diff.B = splitLines(string(content))
+	} else {
+		diff.ToFile = "/dev/null"
+	}
+
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// splitLines splits a file into lines for difflib, with no phantom line for an empty file
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(content, "\n") + "\n")
+}
+
+// isTerminal reports whether f is a terminal, where the summary is colored
+func isTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes returned by the CLI
+// These are a stable contract for scripts and CI; keep the help output in sync
+const (
+	exitSuccess    = 0 // Command completed successfully
+	exitUsage      = 1 // Unknown command, invalid or missing flags
+	exitValidation = 2 // Handlers or input specs failed to parse or validate
+	exitGeneration = 3 // Artifacts could not be generated or written
+	exitNoHandlers = 4 // No annotated handlers were found
+	exitOutOfDate  = 5 // build --check found committed output that differs from a fresh build
+	exitDeploy     = 6 // A deploy script failed
+)
+
+// Exit codes of box diff, which follows diff(1) instead so it slots into review scripts
+// Its usage errors exit with exitDiffError, leaving 1 to mean only that something changed
+const (
+	exitDiffChanges = 1 // The output directory differs from a fresh build
+	exitDiffError   = 2 // The comparison could not be made, including invalid or missing flags
+)
+
+// exitCodesHelp is the exit code table shown in the help output
+const exitCodesHelp = `Exit codes:
+  0  Success
+  1  Usage error (unknown command, invalid or missing flags)
+  2  Parse or validation failure
+  3  Generation failure
+  4  No handlers found
+  5  Committed output is out of date (build --check)
+  6  Deployment failed (deploy)
+
+box diff follows diff(1): 0 no changes, 1 changes, 2 error (usage errors included).
+`
+
+// exitError is an error that carries the exit code the CLI should terminate with
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode attaches an exit code to an error
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// exitCodeFor returns the exit code for an error
+// Errors without an explicit code are treated as generation failures
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitGeneration
+}
+
+// fail prints an error to stderr and exits with the given code
+func fail(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(code)
+}
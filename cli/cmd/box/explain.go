@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/build"
+)
+
+// explainDeployment prints one line per handler for box build --explain: its trigger, where
+// it deploys, and the annotation or build decision that put it there
+// promoted lists the handlers --auto-promote moved from functions to containers
+func explainDeployment(w io.Writer, handlers, promoted []annotations.Handler) error {
+	// Group containers exactly as the generators will
+	plan := build.NewDeploymentPlan(handlers, build.NetworkingPlan{})
+	services := make(map[string]build.ServiceGroup)
+	for _, service := range plan.Services {
+		for _, h := range service.Handlers {
+			services[handlerKey(h)] = service
+		}
+	}
+
+	wasPromoted := make(map[string]bool)
+	for _, h := range promoted {
+		wasPromoted[handlerKey(h)] = true
+	}
+
+	wd, _ := os.Getwd()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HANDLER\tTRIGGER\tDEPLOYMENT\tREASON")
+
+	for _, h := range handlers {
+		deployment := string(h.DeploymentType)
+		var reason string
+
+		switch h.DeploymentType {
+		case annotations.DeploymentFunction:
+			reason = annotations.AnnotationName(annotations.KeyFunction)
+		case annotations.DeploymentLambda:
+			reason = annotations.AnnotationName(annotations.KeyLambda) + " (built with --aws-project or AWS_DEFAULT_REGION)"
+		case annotations.DeploymentProxy:
+			reason = annotations.AnnotationName(annotations.KeyProxy) + " to " + h.Proxy.Upstream + "; the gateway forwards requests, nothing is deployed"
+		case annotations.DeploymentContainer:
+			service := services[handlerKey(h)]
+			deployment += " (" + service.Name + ")"
+
+			reason = annotations.AnnotationName(annotations.KeyContainer)
+			if wasPromoted[handlerKey(h)] {
+				reason = fmt.Sprintf("%s promoted by --auto-promote: %s %s exceeds the %s Cloud Functions limit",
+					annotations.AnnotationName(annotations.KeyFunction), annotations.AnnotationName(annotations.KeyTimeout), h.Timeout, annotations.MaxFunctionTimeout)
+			}
+			switch others := len(service.Handlers) - 1; {
+			case others == 1:
+				reason += fmt.Sprintf("; shares package service %s with 1 other handler", service.Name)
+			case others > 1:
+				reason += fmt.Sprintf("; shares package service %s with %d other handlers", service.Name, others)
+			default:
+				reason += fmt.Sprintf("; only handler in package service %s", service.Name)
+			}
+			if h.ServiceName != "" && h.ServiceName != service.Name {
+				reason += fmt.Sprintf(" (service=%s does not change grouping)", h.ServiceName)
+			}
+		default:
+			reason = fmt.Sprintf("no %s, %s, %s or %s", annotations.AnnotationName(annotations.KeyFunction), annotations.AnnotationName(annotations.KeyContainer),
+				annotations.AnnotationName(annotations.KeyLambda), annotations.AnnotationName(annotations.KeyProxy))
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s (%s:%d)\n", h.FunctionName, handlerTrigger(h), deployment,
+			reason, relativeSource(wd, h.FilePath), h.LineNumber)
+	}
+
+	return tw.Flush()
+}
+
+// handlerTrigger describes what invokes a handler: its route, queue, schedule or topic
+func handlerTrigger(h annotations.Handler) string {
+	switch {
+	case h.TaskQueue != "":
+		return "task-queue " + h.TaskQueue
+	case h.Schedule != nil:
+		return "schedule " + h.Schedule.Cron
+	case h.PubSub != nil:
+		return "pubsub " + h.PubSub.TopicID
+	default:
+		return h.Route.Method + " " + h.Route.Path
+	}
+}
+
+// handlerKey identifies a handler across copies of the parsed handler list
+func handlerKey(h annotations.Handler) string {
+	return fmt.Sprintf("%s:%d:%s", h.FilePath, h.LineNumber, h.FunctionName)
+}
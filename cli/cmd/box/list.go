@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gravelight-studio/box-cli/typescript"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// routeEntry is one row of the route inventory printed by box list
+type routeEntry struct {
+	Method         string `json:"method"`
+	Path           string `json:"path"`
+	DeploymentType string `json:"deploymentType"`
+	Service        string `json:"service,omitempty"`
+	Auth           string `json:"auth"`
+	RateLimit      string `json:"rateLimit,omitempty"`
+	Handler        string `json:"handler"`
+	Source         string `json:"source"`
+}
+
+func listCommand() {
+	listFlags := flag.NewFlagSet("list", flag.ContinueOnError)
+	handlersDir := listFlags.String("handlers", "./handlers", "Path to handlers directory")
+	jsonOutput := listFlags.Bool("json", false, "Print routes as JSON instead of a table")
+
+	listFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: box list [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Print every route declared by @box: annotations without generating anything.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		listFlags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  box list\n")
+		fmt.Fprintf(os.Stderr, "  box list --handlers ./api --json\n\n")
+	}
+
+	parseFlags(listFlags, os.Args[2:])
+
+	lang, err := detectLanguage()
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	parsed, err := parseHandlers(lang, *handlersDir)
+	if err != nil {
+		fail(exitValidation, "Failed to parse handlers: %v", err)
+	}
+
+	// Parse errors go to stderr so --json output stays machine-readable
+	for _, parseErr := range parsed.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%d: %s\n", parseErr.FilePath, parseErr.LineNumber, parseErr.Message)
+	}
+
+	if len(parsed.Handlers) == 0 {
+		fail(exitNoHandlers, "no handlers found with @box: annotations in %s", *handlersDir)
+	}
+
+	routes := routeInventory(parsed.Handlers)
+
+	if *jsonOutput {
+		err = writeRoutesJSON(os.Stdout, routes)
+	} else {
+		err = writeRoutesTable(os.Stdout, routes)
+	}
+	if err != nil {
+		fail(exitGeneration, "Failed to write routes: %v", err)
+	}
+}
+
+// parseHandlers parses the handlers directory with the parser for the project language
+func parseHandlers(lang Language, handlersDir string) (*annotations.ParsedAnnotations, error) {
+	if lang == LanguageTypeScript {
+		return typescript.NewParser().ParseDirectory(handlersDir)
+	}
+	return annotations.NewParser().ParseDirectory(handlersDir)
+}
+
+// routeInventory converts handlers into route entries sorted by path, then method
+func routeInventory(handlers []annotations.Handler) []routeEntry {
+	wd, _ := os.Getwd()
+
+	routes := make([]routeEntry, 0, len(handlers))
+	for _, h := range handlers {
+		entry := routeEntry{
+			Method:         h.Route.Method,
+			Path:           h.Route.Path,
+			DeploymentType: string(h.DeploymentType),
+			Service:        h.ServiceName,
+			Auth:           string(h.Auth.Type),
+			Handler:        h.FunctionName,
+			Source:         fmt.Sprintf("%s:%d", relativeSource(wd, h.FilePath), h.LineNumber),
+		}
+		if h.RateLimit != nil {
+			entry.RateLimit = h.RateLimit.Raw
+		}
+		routes = append(routes, entry)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// relativeSource shortens a handler file path relative to the working directory when possible
+func relativeSource(wd, filePath string) string {
+	if wd == "" {
+		return filePath
+	}
+	rel, err := filepath.Rel(wd, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filePath
+	}
+	return rel
+}
+
+// writeRoutesTable prints routes as an aligned table
+func writeRoutesTable(w io.Writer, routes []routeEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tTYPE\tAUTH\tRATE LIMIT\tSOURCE")
+
+	for _, route := range routes {
+		deploymentType := route.DeploymentType
+		if route.Service != "" {
+			deploymentType += " (" + route.Service + ")"
+		}
+		rateLimit := route.RateLimit
+		if rateLimit == "" {
+			rateLimit = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			route.Method, route.Path, deploymentType, route.Auth, rateLimit, route.Source)
+	}
+
+	return tw.Flush()
+}
+
+// writeRoutesJSON prints routes as an indented JSON array
+func writeRoutesJSON(w io.Writer, routes []routeEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(routes)
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"embed"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/format"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/gravelight-studio/box-cli/typescript"
 	"github.com/manifoldco/promptui"
@@ -16,6 +21,7 @@ import (
 
 	"github.com/gravelight-studio/box/go/annotations"
 	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
 )
 
 //go:embed templates/*
@@ -34,7 +40,7 @@ const (
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	command := os.Args[1]
@@ -44,6 +50,16 @@ func main() {
 		initCommand()
 	case "build":
 		buildCommand()
+	case "list":
+		listCommand()
+	case "validate":
+		validateCommand()
+	case "watch":
+		watchCommand()
+	case "deploy":
+		deployCommand()
+	case "diff":
+		diffCommand()
 	case "version", "--version", "-v":
 		fmt.Printf("Box version %s\n", version)
 	case "help", "--help", "-h":
@@ -51,7 +67,7 @@ func main() {
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
@@ -64,6 +80,11 @@ Usage:
 Commands:
   init     Initialize a new Box project
   build    Build deployment artifacts from an existing project
+  list     List the routes declared by handler annotations
+  validate Check handler annotations without building
+  watch    Rebuild deployment artifacts whenever handlers change
+  deploy   Run the generated deploy scripts
+  diff     Show what a build would change in the output directory
   version  Show version information
   help     Show this help message
 
@@ -71,9 +92,14 @@ Examples:
   box init my-app --lang go
   box init my-api --lang typescript
   box build --project my-gcp-project
+  box list --json
+  box validate --strict
+  box deploy --parallel
+  box diff --format patch
 
 Run 'box <command> --help' for more information on a command.
-`)
+
+%s`, exitCodesHelp)
 }
 
 func initCommand() {
@@ -81,19 +107,22 @@ func initCommand() {
 	var langFlag string
 	var pathFlag string
 	var githubUserFlag string
+	var openAPIFlag string
 
 	// Parse init-specific flags
-	initFlags := flag.NewFlagSet("init", flag.ExitOnError)
+	initFlags := flag.NewFlagSet("init", flag.ContinueOnError)
 	initFlags.StringVar(&langFlag, "lang", "", "Project language (go|typescript)")
 	initFlags.StringVar(&pathFlag, "path", "", "Project path (default: ./project-name)")
 	initFlags.StringVar(&githubUserFlag, "github-user", "", "GitHub username or organization (for Go projects)")
+	initFlags.StringVar(&openAPIFlag, "from-openapi", "", "Scaffold annotated handler stubs from an OpenAPI spec (Go projects)")
 	initFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: box init [project-name] [options]\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		initFlags.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  box init my-app --lang go --github-user myusername\n")
-		fmt.Fprintf(os.Stderr, "  box init my-api --lang typescript --path ./projects/my-api\n\n")
+		fmt.Fprintf(os.Stderr, "  box init my-api --lang typescript --path ./projects/my-api\n")
+		fmt.Fprintf(os.Stderr, "  box init my-app --lang go --from-openapi ./openapi.yaml\n\n")
 	}
 
 	// Parse arguments
@@ -102,7 +131,7 @@ func initCommand() {
 		projectName = args[0]
 		args = args[1:]
 	}
-	initFlags.Parse(args)
+	parseFlags(initFlags, args)
 
 	// Get project name interactively if not provided
 	if projectName == "" {
@@ -112,8 +141,7 @@ func initCommand() {
 		}
 		result, err := prompt.Run()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Prompt failed: %v\n", err)
-			os.Exit(1)
+			fail(exitUsage, "Prompt failed: %v", err)
 		}
 		projectName = result
 	}
@@ -123,8 +151,7 @@ func initCommand() {
 	if langFlag != "" {
 		lang = Language(strings.ToLower(langFlag))
 		if lang != LanguageGo && lang != LanguageTypeScript {
-			fmt.Fprintf(os.Stderr, "Error: Invalid language. Choose 'go' or 'typescript'\n")
-			os.Exit(1)
+			fail(exitUsage, "Invalid language. Choose 'go' or 'typescript'")
 		}
 	} else {
 		prompt := promptui.Select{
@@ -133,8 +160,7 @@ func initCommand() {
 		}
 		_, result, err := prompt.Run()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Prompt failed: %v\n", err)
-			os.Exit(1)
+			fail(exitUsage, "Prompt failed: %v", err)
 		}
 		if result == "Go" {
 			lang = LanguageGo
@@ -155,13 +181,39 @@ func initCommand() {
 			}
 			result, err := prompt.Run()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Prompt failed: %v\n", err)
-				os.Exit(1)
+				fail(exitUsage, "Prompt failed: %v", err)
 			}
 			githubUsername = result
 		}
 	}
 
+	// Import handler definitions from an existing OpenAPI spec
+	var imported []annotations.Handler
+	var importedTags []config.TagConfig
+	if openAPIFlag != "" {
+		if lang != LanguageGo {
+			fail(exitUsage, "--from-openapi is currently only supported for Go projects")
+		}
+
+		specData, err := os.ReadFile(openAPIFlag)
+		if err != nil {
+			fail(exitUsage, "Failed to read OpenAPI spec: %v", err)
+		}
+
+		imported, importedTags, err = build.ImportOpenAPI(specData)
+		if err != nil {
+			fail(exitValidation, "%v", err)
+		}
+
+		// Stubs share the handlers package with the starter template
+		for _, h := range imported {
+			if h.FunctionName == "GetHealth" || h.FunctionName == "GetHello" {
+				fail(exitValidation, "OpenAPI operation %s conflicts with a starter handler; rename its operationId", h.FunctionName)
+			}
+		}
+		fmt.Printf("📥 Imported %d operations from %s\n", len(imported), openAPIFlag)
+	}
+
 	// Determine project path
 	projectPath := pathFlag
 	if projectPath == "" {
@@ -171,9 +223,8 @@ func initCommand() {
 	// Create project
 	fmt.Printf("🎯 Creating %s project '%s' at %s\n\n", lang, projectName, projectPath)
 
-	if err := createProject(projectName, lang, projectPath, githubUsername); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to create project: %v\n", err)
-		os.Exit(1)
+	if err := createProject(projectName, lang, projectPath, githubUsername, imported, importedTags); err != nil {
+		fail(exitGeneration, "Failed to create project: %v", err)
 	}
 
 	// Print success message
@@ -191,7 +242,9 @@ func initCommand() {
 	fmt.Printf("  box build --project <your-gcp-project-id>\n\n")
 }
 
-func createProject(name string, lang Language, path string, githubUsername string) error {
+// createProject renders the starter templates into path, with stubs for handlers imported from
+// OpenAPI and box.yaml display names for the imported tags that had to be renamed
+func createProject(name string, lang Language, path string, githubUsername string, imported []annotations.Handler, importedTags []config.TagConfig) error {
 	// Create project directory
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
@@ -205,15 +258,57 @@ func createProject(name string, lang Language, path string, githubUsername strin
 		moduleName = name
 	}
 
+	importedNames := make([]string, 0, len(imported))
+	for _, h := range imported {
+		importedNames = append(importedNames, h.FunctionName)
+	}
+
 	data := map[string]interface{}{
-		"ProjectName": name,
-		"ModuleName":  moduleName,
-		"Version":     version,
+		"ProjectName":      name,
+		"ModuleName":       moduleName,
+		"Version":          version,
+		"ImportedHandlers": importedNames,
+		"ImportedTags":     importedTags,
 	}
 
 	// Copy templates based on language
 	templateDir := fmt.Sprintf("templates/%s", lang)
 
+	if err := copyTemplates(templateDir, path, data); err != nil {
+		return err
+	}
+
+	// Scaffold handler stubs imported from OpenAPI
+	if len(imported) > 0 {
+		return scaffoldImportedHandlers(path, imported)
+	}
+
+	return nil
+}
+
+// scaffoldImportedHandlers writes handlers/api.go with stubs for imported operations
+func scaffoldImportedHandlers(path string, imported []annotations.Handler) error {
+	var buf bytes.Buffer
+	if err := build.ScaffoldHandlers(&buf, "handlers", imported); err != nil {
+		return fmt.Errorf("failed to scaffold handlers: %w", err)
+	}
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format scaffolded handlers: %w", err)
+	}
+
+	targetPath := filepath.Join(path, "handlers", "api.go")
+	if err := os.WriteFile(targetPath, source, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+	}
+
+	fmt.Printf("  ✓ Created %s\n", filepath.Join("handlers", "api.go"))
+	return nil
+}
+
+// copyTemplates renders the embedded project templates into the project directory
+func copyTemplates(templateDir, path string, data map[string]interface{}) error {
 	return fs.WalkDir(templatesFS, templateDir, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -257,14 +352,21 @@ func createProject(name string, lang Language, path string, githubUsername strin
 				return fmt.Errorf("failed to parse template %s: %w", filePath, err)
 			}
 
-			file, err := os.Create(targetPath)
-			if err != nil {
-				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return fmt.Errorf("failed to execute template %s: %w", filePath, err)
 			}
-			defer file.Close()
 
-			if err := tmpl.Execute(file, data); err != nil {
-				return fmt.Errorf("failed to execute template %s: %w", filePath, err)
+			// Keep generated Go sources gofmt-clean
+			output := buf.Bytes()
+			if strings.HasSuffix(targetPath, ".go") {
+				if formatted, err := format.Source(output); err == nil {
+					output = formatted
+				}
+			}
+
+			if err := os.WriteFile(targetPath, output, 0644); err != nil {
+				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
 			}
 
 			fmt.Printf("  ✓ Created %s\n", strings.TrimSuffix(relPath, ".tmpl"))
@@ -281,40 +383,113 @@ func createProject(name string, lang Language, path string, githubUsername strin
 }
 
 func buildCommand() {
+	// box.yaml supplies the flag defaults; flags still override it
+	cfg, err := config.LoadConfig(config.FileName)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+	timeoutDefault := build.DefaultTimeout
+	if cfg.Defaults.Timeout > 0 {
+		timeoutDefault = cfg.Defaults.Timeout
+	}
+
 	// Parse build-specific flags
-	buildFlags := flag.NewFlagSet("build", flag.ExitOnError)
-	handlersDir := buildFlags.String("handlers", "./handlers", "Path to handlers directory")
-	outputDir := buildFlags.String("output", "./build", "Path to output directory")
-	projectID := buildFlags.String("project", "", "GCP project ID (required)")
-	region := buildFlags.String("region", "us-central1", "GCP region")
-	environment := buildFlags.String("env", "dev", "Environment (dev, staging, production)")
-	moduleName := buildFlags.String("module", "", "Module name (auto-detected if not provided)")
-	clean := buildFlags.Bool("clean", false, "Clean build directory before generating")
-	verbose := buildFlags.Bool("verbose", false, "Enable verbose logging")
+	buildFlags := flag.NewFlagSet("build", flag.ContinueOnError)
+	handlersDir := buildFlags.String("handlers", orDefault(cfg.HandlersDir, "./handlers"), "Path to handlers directory")
+	outputDir := buildFlags.String("output", orDefault(cfg.OutputDir, "./build"), "Path to output directory")
+	projectID := buildFlags.String("project", cfg.ProjectID, "GCP project ID (required)")
+	region := buildFlags.String("region", orDefault(cfg.Region, "us-central1"), "GCP region")
+	regionList := buildFlags.String("regions", "", "Comma-separated regions for multi-region Cloud Run behind a global load balancer (Go only)")
+	environment := buildFlags.String("env", orDefault(cfg.Environment, "dev"), "Environment (dev, staging, production)")
+	moduleName := buildFlags.String("module", cfg.ModuleName, "Module name (auto-detected if not provided)")
+	clean := buildFlags.Bool("clean", cfg.CleanBuildDir, "Clean build directory before generating")
+	force := buildFlags.Bool("force", false, "Regenerate every artifact, ignoring the build manifest of unchanged handlers (Go only)")
+	gateway := buildFlags.String("gateway", build.GatewayGCP, "Gateway backend: gcp (API Gateway) or envoy (Go only)")
+	validateOpenAPI := buildFlags.Bool("validate-openapi", false, "Fail the build if the generated openapi.yaml is not valid OpenAPI 3.0 (Go only)")
+	skipSchemas := buildFlags.Bool("skip-schemas", false, "Leave @box:request/@box:response body schemas out of openapi.yaml instead of loading handler packages for them (Go only)")
+	emitJSONSchema := buildFlags.Bool("emit-json-schema", false, "Also write a standalone JSON Schema file per @box:request/@box:response type to schemas/<Type>.json (Go only)")
+	defaultTimeout := buildFlags.Duration("default-timeout", timeoutDefault, "Timeout for handlers without @box:timeout, applied to function.yaml, the gateway deadline and Terraform (Go only)")
+	healthPath := buildFlags.String("health-path", build.DefaultHealthPath, "Container health endpoint used by HEALTHCHECK and Cloud Run probes (Go only)")
+	probePeriod := buildFlags.Duration("probe-period", build.DefaultProbePeriod, "Interval between Cloud Run startup/liveness probes (Go only)")
+	probeTimeout := buildFlags.Duration("probe-timeout", 0, "Per-probe timeout (default: derived from each service's handler timeouts, capped at --probe-period)")
+	probeFailures := buildFlags.Int("probe-failure-threshold", build.DefaultProbeFailureThreshold, "Consecutive liveness probe failures before an instance is restarted")
+	startupGrace := buildFlags.Duration("startup-grace", build.DefaultProbeStartupGrace, "How long a new instance may take to pass its startup probe")
+	defaultRoles := buildFlags.String("default-roles", strings.Join(build.DefaultServiceAccountRoles, ","), "Comma-separated project roles granted to every generated service account; handlers add more with @box:iam-role (Go only)")
+	noDefaultRoles := buildFlags.Bool("no-default-roles", false, "Grant service accounts only their handlers' @box:iam-role roles (Go only)")
+	awsProject := buildFlags.String("aws-project", "", "AWS project tag; setting it (or AWS_DEFAULT_REGION) generates AWS Lambda output for @box:lambda handlers (Go only)")
+	awsRegion := buildFlags.String("aws-region", orDefault(os.Getenv("AWS_DEFAULT_REGION"), build.DefaultAWSRegion), "AWS region for @box:lambda handlers (Go only)")
+	cloudRunV2 := buildFlags.Bool("cloud-run-v2", false, "Generate Cloud Run services with google_cloud_run_v2_service instead of the legacy google_cloud_run_service (Go only)")
+	canary := buildFlags.Int("canary", 0, "Send this percentage of each Cloud Run service's traffic to its latest revision and the rest to its stable_revisions revision (Go only)")
+	maxConcurrency := buildFlags.Int("max-concurrency", runtime.NumCPU(), "Function and container packages generated at once (Go only)")
+	vendorFunctions := buildFlags.Bool("vendor-functions", false, "Copy each function's handler sources into its directory instead of using a replace directive, so it deploys standalone (Go only)")
+	secretsMode := buildFlags.String("secrets", build.SecretsEnv, "How functions and services get Secret Manager secrets: env (Terraform sets environment variables) or runtime (read at startup) (Go only)")
+	stateBucket := buildFlags.String("terraform-state-bucket", "", "Store Terraform state in this GCS bucket and write terraform/setup-state.sh to create it (Go only)")
+	k8s := buildFlags.Bool("k8s", false, "Also write Kubernetes manifests (Deployment, Service, HPA, Ingress, kustomization.yaml) for each container service under k8s/ (Go only)")
+	excludeDeprecated := buildFlags.Bool("exclude-deprecated", false, "Leave @box:deprecated handlers out of the gateway, envoy.yaml, firebase.json and Ingress routes while still deploying them (Go only)")
+	firebase := buildFlags.Bool("firebase", false, "Also write firebase.json with Firebase Hosting rewrites from each route to its function or service (Go only)")
+	autoPromote := buildFlags.Bool("auto-promote", false, "Deploy functions whose @box:timeout exceeds the 540s Cloud Functions limit as Cloud Run containers instead of failing")
+	explain := buildFlags.Bool("explain", false, "Print one line per handler explaining why it deploys as a function or container")
+	strict := buildFlags.Bool("strict", false, "Fail on conditions that otherwise only warn; currently, finding no handlers")
+	requireHandlers := buildFlags.Bool("require-handlers", false, "Fail with exit code 4 when no annotated handlers are found (default: the --strict setting)")
+	bundlePath := buildFlags.String("bundle", "", "Zip the entire output tree into this archive (e.g. build.zip)")
+	check := buildFlags.Bool("check", false, "Build into a temporary directory and fail with exit code 5 if --output differs from it; writes nothing")
+	verbose := buildFlags.Bool("verbose", cfg.Verbose, "Enable verbose logging")
 
 	buildFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: box build [options]\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "Options (defaults come from %s when present):\n", config.FileName)
 		buildFlags.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  box build --project my-gcp-project\n")
-		fmt.Fprintf(os.Stderr, "  box build --handlers ./handlers --output ./build --project my-gcp-project\n\n")
+		fmt.Fprintf(os.Stderr, "  box build --handlers ./handlers --output ./build --project my-gcp-project\n")
+		fmt.Fprintf(os.Stderr, "  box build --project my-gcp-project --gateway envoy\n")
+		fmt.Fprintf(os.Stderr, "  box build --project my-gcp-project --bundle build.zip\n")
+		fmt.Fprintf(os.Stderr, "  box build --project my-gcp-project --explain\n")
+		fmt.Fprintf(os.Stderr, "  box build --project my-gcp-project --check\n\n")
 	}
 
-	buildFlags.Parse(os.Args[2:])
+	parseFlags(buildFlags, os.Args[2:])
+
+	// --require-handlers follows --strict unless it is given explicitly
+	if !flagPassed(buildFlags, "require-handlers") {
+		*requireHandlers = *strict
+	}
 
 	// Validate required flags
 	if *projectID == "" {
-		fmt.Fprintf(os.Stderr, "Error: --project flag is required\n\n")
+		fmt.Fprintf(os.Stderr, "Error: --project flag (or projectID in %s) is required\n\n", config.FileName)
+		buildFlags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *check && *bundlePath != "" {
+		fmt.Fprintf(os.Stderr, "Error: --check writes nothing and cannot be combined with --bundle\n\n")
 		buildFlags.Usage()
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+
+	if *defaultTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --default-timeout must be positive\n\n")
+		buildFlags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *maxConcurrency < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --max-concurrency must be at least 1\n\n")
+		buildFlags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *canary < 0 || *canary > 99 {
+		fmt.Fprintf(os.Stderr, "Error: --canary must be between 1 and 99\n\n")
+		buildFlags.Usage()
+		os.Exit(exitUsage)
 	}
 
 	// Detect project language
 	lang, err := detectLanguage()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail(exitUsage, "%v", err)
 	}
 
 	fmt.Printf("🔍 Detected %s project\n", lang)
@@ -324,25 +499,316 @@ func buildCommand() {
 	if *verbose {
 		logger, err = zap.NewDevelopment()
 	} else {
-		config := zap.NewProductionConfig()
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-		logger, err = config.Build()
+		zapConfig := zap.NewProductionConfig()
+		zapConfig.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+		logger, err = zapConfig.Build()
 	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create logger: %v\n", err)
-		os.Exit(1)
+		fail(exitGeneration, "Failed to create logger: %v", err)
 	}
 	defer logger.Sync()
 
+	// Parse multi-region list
+	regions := splitList(*regionList)
+
+	// Lambda output needs an AWS target: an explicit project or a configured AWS region
+	var aws *build.AWSConfig
+	if *awsProject != "" || os.Getenv("AWS_DEFAULT_REGION") != "" {
+		aws = &build.AWSConfig{Project: *awsProject, Region: *awsRegion}
+	}
+
+	opts := buildOptions{
+		handlersDir:     *handlersDir,
+		outputDir:       *outputDir,
+		projectID:       *projectID,
+		region:          *region,
+		regions:         regions,
+		environment:     *environment,
+		moduleName:      *moduleName,
+		clean:           *clean,
+		force:           *force,
+		gateway:         *gateway,
+		validateOpenAPI: *validateOpenAPI,
+		skipSchemas:     *skipSchemas,
+		emitJSONSchema:  *emitJSONSchema,
+		defaultTimeout:  *defaultTimeout,
+		healthPath:      *healthPath,
+		defaultRoles:    splitList(*defaultRoles),
+		noDefaultRoles:  *noDefaultRoles,
+		probes: build.ProbeConfig{
+			Period:           *probePeriod,
+			Timeout:          *probeTimeout,
+			FailureThreshold: *probeFailures,
+			StartupGrace:     *startupGrace,
+		},
+		requireHandlers: *requireHandlers,
+		autoPromote:     *autoPromote,
+		firebase:        *firebase,
+		cloudRunV2:      *cloudRunV2,
+		canary:          *canary,
+		vendorFunctions: *vendorFunctions,
+		maxConcurrency:  *maxConcurrency,
+		stateBucket:     *stateBucket,
+		secretsMode:     *secretsMode,
+		k8s:             *k8s,
+		skipDeprecated:  *excludeDeprecated,
+		aws:             aws,
+		explain:         *explain,
+		boxConfig:       cfg,
+	}
+
 	// Delegate to language-specific build
+	var buildFn func(buildOptions, *zap.Logger) error
 	switch lang {
 	case LanguageGo:
-		buildGo(*handlersDir, *outputDir, *projectID, *region, *environment, *moduleName, *clean, logger)
+		buildFn = buildGo
 	case LanguageTypeScript:
-		buildTypeScript(*handlersDir, *outputDir, *projectID, *region, *environment, *moduleName, *clean, logger)
+		if len(regions) > 0 {
+			logger.Warn("--regions is not supported for TypeScript projects yet; ignoring")
+		}
+		if *validateOpenAPI {
+			logger.Warn("--validate-openapi is not supported for TypeScript projects yet; ignoring")
+		}
+		if *skipSchemas {
+			logger.Warn("--skip-schemas is not supported for TypeScript projects yet; ignoring")
+		}
+		if *emitJSONSchema {
+			logger.Warn("--emit-json-schema is not supported for TypeScript projects yet; ignoring")
+		}
+		if *force {
+			logger.Warn("--force is not supported for TypeScript projects yet; ignoring")
+		}
+		if *gateway != build.GatewayGCP {
+			logger.Warn("--gateway is not supported for TypeScript projects yet; ignoring")
+		}
+		if *defaultTimeout != build.DefaultTimeout {
+			logger.Warn("--default-timeout is not supported for TypeScript projects yet; ignoring")
+		}
+		if *healthPath != build.DefaultHealthPath {
+			logger.Warn("--health-path is not supported for TypeScript projects yet; ignoring")
+		}
+		if *noDefaultRoles {
+			logger.Warn("--no-default-roles is not supported for TypeScript projects yet; ignoring")
+		}
+		if *firebase {
+			logger.Warn("--firebase is not supported for TypeScript projects yet; ignoring")
+		}
+		if *cloudRunV2 {
+			logger.Warn("--cloud-run-v2 is not supported for TypeScript projects yet; ignoring")
+		}
+		if *canary != 0 {
+			logger.Warn("--canary is not supported for TypeScript projects yet; ignoring")
+		}
+		if *vendorFunctions {
+			logger.Warn("--vendor-functions is not supported for TypeScript projects yet; ignoring")
+		}
+		if *maxConcurrency != runtime.NumCPU() {
+			logger.Warn("--max-concurrency is not supported for TypeScript projects yet; ignoring")
+		}
+		if *secretsMode != build.SecretsEnv {
+			logger.Warn("--secrets is not supported for TypeScript projects yet; ignoring")
+		}
+		if *stateBucket != "" {
+			logger.Warn("--terraform-state-bucket is not supported for TypeScript projects yet; ignoring")
+		}
+		if *k8s {
+			logger.Warn("--k8s is not supported for TypeScript projects yet; ignoring")
+		}
+		if *excludeDeprecated {
+			logger.Warn("--exclude-deprecated is not supported for TypeScript projects yet; ignoring")
+		}
+		if *awsProject != "" {
+			logger.Warn("--aws-project is not supported for TypeScript projects yet; ignoring")
+		}
+		buildFn = buildTypeScript
+	}
+
+	generated := true
+	opts.generated = &generated
+	if *check {
+		err = checkOutput(opts, buildFn, logger)
+	} else {
+		err = buildFn(opts, logger)
+	}
+
+	// Package the output tree for CI handoff if requested
+	if err == nil && *bundlePath != "" {
+		err = bundleOutput(*outputDir, *bundlePath, generated, logger)
+	}
+
+	if err != nil {
+		logger.Error("Build failed", zap.Error(err))
+		logger.Sync()
+		os.Exit(exitCodeFor(err))
 	}
 }
 
+// bundleOutput zips outputDir into bundlePath. A build that found no handlers under
+// --require-handlers=false generates nothing, so it logs and skips the bundle instead
+// of archiving whatever an earlier build left in outputDir
+func bundleOutput(outputDir, bundlePath string, generated bool, logger *zap.Logger) error {
+	if !generated {
+		logger.Warn("Nothing was generated; skipping bundle", zap.String("bundle", bundlePath))
+		return nil
+	}
+
+	if err := build.WriteBundle(outputDir, bundlePath); err != nil {
+		return err
+	}
+	fmt.Printf("  • Bundle: %s\n", bundlePath)
+	return nil
+}
+
+// checkOutput builds into a temporary directory and compares the result with the committed
+// output in opts.outputDir, printing every drifted file with its diff
+func checkOutput(opts buildOptions, buildFn func(buildOptions, *zap.Logger) error, logger *zap.Logger) error {
+	tmpDir, err := os.MkdirTemp("", "box-check-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary output directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	committedDir := opts.outputDir
+	opts.outputDir = tmpDir
+	opts.clean = false
+	opts.check = true
+	if err := buildFn(opts, logger); err != nil {
+		return err
+	}
+
+	drift, err := build.CompareOutput(tmpDir, committedDir)
+	if err != nil {
+		return fmt.Errorf("failed to compare output: %w", err)
+	}
+
+	if len(drift) == 0 {
+		fmt.Printf("✅ %s is up to date\n", committedDir)
+		return nil
+	}
+
+	for _, file := range drift {
+		fmt.Printf("%s: %s\n", file.Status, filepath.Join(committedDir, filepath.FromSlash(file.Path)))
+		for _, line := range strings.SplitAfter(file.Diff, "\n") {
+			if line != "" {
+				fmt.Printf("    %s", line)
+			}
+		}
+	}
+
+	return withExitCode(exitOutOfDate, fmt.Errorf("%d generated files in %s are out of date; run box build to regenerate them", len(drift), committedDir))
+}
+
+// orDefault returns value, or fallback when value is empty
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseFlags parses command flags, exiting with the usage code on invalid input
+// flagPassed reports whether the flag was set on the command line rather than left at its default
+func flagPassed(flags *flag.FlagSet, name string) bool {
+	passed := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitSuccess)
+		}
+		os.Exit(exitUsage)
+	}
+}
+
+// buildOptions holds the build command flags shared by the language-specific builds
+type buildOptions struct {
+	handlersDir     string
+	outputDir       string
+	projectID       string
+	region          string
+	regions         []string // multi-region Cloud Run (Go only)
+	environment     string
+	moduleName      string
+	clean           bool
+	force           bool          // regenerate artifacts of unchanged handlers too (Go only)
+	gateway         string        // gateway backend (Go only)
+	validateOpenAPI bool          // validate the generated OpenAPI spec (Go only)
+	skipSchemas     bool          // leave body schemas out of the OpenAPI spec (Go only)
+	emitJSONSchema  bool          // write a JSON Schema file per body type (Go only)
+	defaultTimeout  time.Duration // timeout for handlers without @box:timeout (Go only)
+	healthPath      string        // container health endpoint (Go only)
+	defaultRoles    []string      // project roles granted to every service account (Go only)
+	noDefaultRoles  bool          // grant only @box:iam-role roles (Go only)
+	probes          build.ProbeConfig
+	requireHandlers bool              // treat zero handlers as an error rather than a warning
+	generated       *bool             // set to false when the build found no handlers; nil when unused
+	check           bool              // building into a temporary directory for build --check
+	autoPromote     bool              // deploy functions over the Cloud Functions timeout limit as containers
+	firebase        bool              // write firebase.json Hosting rewrites (Go only)
+	cloudRunV2      bool              // render services as google_cloud_run_v2_service (Go only)
+	canary          int               // latest revision's share of Cloud Run traffic; 0 disables the split (Go only)
+	vendorFunctions bool              // copy handler sources into each function instead of a replace directive (Go only)
+	maxConcurrency  int               // function and container packages generated at once; 0 uses every CPU (Go only)
+	stateBucket     string            // GCS bucket for remote Terraform state; empty keeps local state (Go only)
+	secretsMode     string            // build.SecretsEnv or build.SecretsRuntime (Go only)
+	k8s             bool              // write Kubernetes manifests for container services (Go only)
+	skipDeprecated  bool              // leave @box:deprecated handlers out of the routing (Go only)
+	aws             *build.AWSConfig  // AWS target for @box:lambda handlers; nil skips them (Go only)
+	explain         bool              // print each handler's deployment decision before generating
+	boxConfig       *config.BoxConfig // box.yaml, for its handler defaults; nil when building without one
+	watching        bool              // rebuilding under box watch, which prints its own status lines
+	skipGateway     bool              // box watch --no-gateway (Go only)
+	skipTerraform   bool              // box watch --no-terraform (Go only)
+}
+
+// promoteLongRunning applies --auto-promote, logging and returning each function moved to a container
+func promoteLongRunning(opts buildOptions, handlers []annotations.Handler, logger *zap.Logger) []annotations.Handler {
+	if !opts.autoPromote {
+		return nil
+	}
+
+	promoted := annotations.AutoPromote(handlers)
+	for _, handler := range promoted {
+		logger.Info("Promoted function to container: timeout exceeds the Cloud Functions limit",
+			zap.String("handler", handler.FunctionName),
+			zap.Duration("timeout", handler.Timeout),
+			zap.Duration("function_limit", annotations.MaxFunctionTimeout))
+	}
+	return promoted
+}
+
+// noHandlersFound ends a build that found no annotated handlers
+// It fails with exitNoHandlers when handlers are required, otherwise it only warns
+func noHandlersFound(opts buildOptions, logger *zap.Logger) error {
+	if opts.requireHandlers {
+		return withExitCode(exitNoHandlers, fmt.Errorf("no handlers found with @box: annotations in %s", opts.handlersDir))
+	}
+
+	if opts.generated != nil {
+		*opts.generated = false
+	}
+	logger.Warn("No handlers found with @box: annotations", zap.String("directory", opts.handlersDir))
+	return nil
+}
+
 func detectLanguage() (Language, error) {
 	// Check for go.mod
 	if _, err := os.Stat("go.mod"); err == nil {
@@ -357,32 +823,26 @@ func detectLanguage() (Language, error) {
 	return "", fmt.Errorf("could not detect project language. Make sure you're in a Go (go.mod) or TypeScript (package.json) project directory")
 }
 
-func buildGo(handlersDir, outputDir, projectID, region, environment, moduleName string, clean bool, logger *zap.Logger) {
+func buildGo(opts buildOptions, logger *zap.Logger) error {
 	logger.Info("Building Go project",
 		zap.String("version", version),
-		zap.String("handlers", handlersDir),
-		zap.String("output", outputDir),
-		zap.String("project", projectID),
-		zap.String("region", region),
-		zap.String("environment", environment))
+		zap.String("handlers", opts.handlersDir),
+		zap.String("output", opts.outputDir),
+		zap.String("project", opts.projectID),
+		zap.String("region", opts.region),
+		zap.Strings("regions", opts.regions),
+		zap.String("environment", opts.environment))
 
 	// Parse annotations
-	logger.Info("Parsing handlers", zap.String("directory", handlersDir))
+	logger.Info("Parsing handlers", zap.String("directory", opts.handlersDir))
 	parser := annotations.NewParser()
-	parsed, err := parser.ParseDirectory(handlersDir)
+	parsed, err := parser.ParseDirectory(opts.handlersDir)
 	if err != nil {
-		logger.Fatal("Failed to parse handlers", zap.Error(err))
+		return withExitCode(exitValidation, fmt.Errorf("failed to parse handlers: %w", err))
 	}
 
-	// Check for parse errors
-	if len(parsed.Errors) > 0 {
-		logger.Warn("Encountered parse errors", zap.Int("count", len(parsed.Errors)))
-		for _, parseErr := range parsed.Errors {
-			logger.Warn("Parse error",
-				zap.String("file", parseErr.FilePath),
-				zap.Int("line", parseErr.LineNumber),
-				zap.String("message", parseErr.Message))
-		}
+	if err := checkParseErrors(parsed.Errors, logger); err != nil {
+		return err
 	}
 
 	logger.Info("Found handlers",
@@ -391,15 +851,36 @@ func buildGo(handlersDir, outputDir, projectID, region, environment, moduleName
 		zap.Int("containers", countContainers(parsed.Handlers)))
 
 	if len(parsed.Handlers) == 0 {
-		logger.Warn("No handlers found with @box: annotations")
-		os.Exit(0)
+		return noHandlersFound(opts, logger)
+	}
+
+	promoted := promoteLongRunning(opts, parsed.Handlers, logger)
+	annotations.NewValidatorWithConfig(opts.boxConfig).ApplyDefaults(parsed.Handlers)
+	if opts.explain {
+		if err := explainDeployment(os.Stdout, parsed.Handlers, promoted); err != nil {
+			return withExitCode(exitGeneration, fmt.Errorf("failed to explain deployment: %w", err))
+		}
+	}
+
+	// Validate after promotion, so only timeouts --auto-promote couldn't fix fail the build
+	if err := validateHandlers(parsed.Handlers, logger); err != nil {
+		return err
+	}
+
+	// Surface service groups that mix public and protected routes
+	validator := annotations.NewValidator()
+	for _, notice := range validator.ValidateServiceGrouping(parsed.Handlers) {
+		logger.Info("Service grouping notice",
+			zap.String("service", notice.Handler),
+			zap.String("reason", notice.Reason))
 	}
 
 	// Auto-detect module name if not provided
+	moduleName := opts.moduleName
 	if moduleName == "" {
-		detectedModule, err := detectGoModuleName()
+		detectedModule, err := detectGoModuleName(opts.handlersDir)
 		if err != nil {
-			logger.Fatal("Failed to detect module name. Please specify --module flag", zap.Error(err))
+			return withExitCode(exitUsage, fmt.Errorf("failed to detect module name, please specify --module flag: %w", err))
 		}
 		moduleName = detectedModule
 		logger.Info("Detected module name", zap.String("module", moduleName))
@@ -407,54 +888,83 @@ func buildGo(handlersDir, outputDir, projectID, region, environment, moduleName
 
 	// Create generator
 	logger.Info("Creating deployment artifacts")
+	var docs config.DocsConfig
+	if opts.boxConfig != nil {
+		docs = opts.boxConfig.Docs
+	}
+
 	generator := build.NewGenerator(build.Config{
-		Handlers:      parsed.Handlers,
-		OutputDir:     outputDir,
-		ModuleName:    moduleName,
-		ProjectID:     projectID,
-		Region:        region,
-		Environment:   environment,
-		Logger:        logger,
-		CleanBuildDir: clean,
+		Handlers:          parsed.Handlers,
+		OutputDir:         opts.outputDir,
+		ModuleName:        moduleName,
+		ProjectID:         opts.projectID,
+		Region:            opts.region,
+		Regions:           opts.regions,
+		Environment:       opts.environment,
+		Logger:            logger,
+		CleanBuildDir:     opts.clean,
+		ForceRebuild:      opts.force,
+		Gateway:           opts.gateway,
+		ValidateOpenAPI:   opts.validateOpenAPI,
+		SkipSchemas:       opts.skipSchemas,
+		EmitJSONSchema:    opts.emitJSONSchema,
+		Docs:              docs,
+		DefaultTimeout:    opts.defaultTimeout,
+		HealthPath:        opts.healthPath,
+		Probes:            opts.probes,
+		DefaultRoles:      opts.defaultRoles,
+		NoDefaultRoles:    opts.noDefaultRoles,
+		Firebase:          opts.firebase,
+		CloudRunV2:        opts.cloudRunV2,
+		CanaryPercent:     opts.canary,
+		VendorFunctions:   opts.vendorFunctions,
+		MaxConcurrency:    opts.maxConcurrency,
+		StateBucket:       opts.stateBucket,
+		SecretsMode:       opts.secretsMode,
+		KubernetesOutput:  opts.k8s,
+		ExcludeDeprecated: opts.skipDeprecated,
+		AWS:               opts.aws,
+		SkipGateway:       opts.skipGateway,
+		SkipTerraform:     opts.skipTerraform,
 	})
 
 	// Generate all artifacts
-	if err := generator.Generate(); err != nil {
-		logger.Fatal("Failed to generate artifacts", zap.Error(err))
+	stats, err := generator.Generate()
+	if err != nil {
+		return withExitCode(exitGeneration, fmt.Errorf("failed to generate artifacts: %w", err))
 	}
 
 	logger.Info("✓ Deployment artifacts generated successfully",
-		zap.String("output", outputDir))
+		zap.String("output", opts.outputDir),
+		zap.Int("generated", stats.Generated),
+		zap.Int("skipped", stats.Skipped),
+		zap.Int("removed", stats.Removed))
 
-	printBuildSummary(outputDir)
+	if !opts.check && !opts.watching {
+		printBuildSummary(opts.outputDir)
+	}
+	return nil
 }
 
-func buildTypeScript(handlersDir, outputDir, projectID, region, environment, moduleName string, clean bool, logger *zap.Logger) {
+func buildTypeScript(opts buildOptions, logger *zap.Logger) error {
 	logger.Info("Building TypeScript project",
 		zap.String("version", version),
-		zap.String("handlers", handlersDir),
-		zap.String("output", outputDir),
-		zap.String("project", projectID),
-		zap.String("region", region),
-		zap.String("environment", environment))
+		zap.String("handlers", opts.handlersDir),
+		zap.String("output", opts.outputDir),
+		zap.String("project", opts.projectID),
+		zap.String("region", opts.region),
+		zap.String("environment", opts.environment))
 
 	// Parse annotations using TypeScript parser
-	logger.Info("Parsing TypeScript/JavaScript handlers", zap.String("directory", handlersDir))
+	logger.Info("Parsing TypeScript/JavaScript handlers", zap.String("directory", opts.handlersDir))
 	parser := typescript.NewParser()
-	parsed, err := parser.ParseDirectory(handlersDir)
+	parsed, err := parser.ParseDirectory(opts.handlersDir)
 	if err != nil {
-		logger.Fatal("Failed to parse handlers", zap.Error(err))
+		return withExitCode(exitValidation, fmt.Errorf("failed to parse handlers: %w", err))
 	}
 
-	// Check for parse errors
-	if len(parsed.Errors) > 0 {
-		logger.Warn("Encountered parse errors", zap.Int("count", len(parsed.Errors)))
-		for _, parseErr := range parsed.Errors {
-			logger.Warn("Parse error",
-				zap.String("file", parseErr.FilePath),
-				zap.Int("line", parseErr.LineNumber),
-				zap.String("message", parseErr.Message))
-		}
+	if err := checkParseErrors(parsed.Errors, logger); err != nil {
+		return err
 	}
 
 	logger.Info("Found handlers",
@@ -463,15 +973,33 @@ func buildTypeScript(handlersDir, outputDir, projectID, region, environment, mod
 		zap.Int("containers", countContainers(parsed.Handlers)))
 
 	if len(parsed.Handlers) == 0 {
-		logger.Warn("No handlers found with @box: annotations")
-		os.Exit(0)
+		return noHandlersFound(opts, logger)
+	}
+
+	if lambdas := countLambdas(parsed.Handlers); lambdas > 0 {
+		logger.Warn("@box:lambda is not supported for TypeScript projects yet; skipping those handlers",
+			zap.Int("count", lambdas))
+	}
+
+	promoted := promoteLongRunning(opts, parsed.Handlers, logger)
+	annotations.NewValidatorWithConfig(opts.boxConfig).ApplyDefaults(parsed.Handlers)
+	if opts.explain {
+		if err := explainDeployment(os.Stdout, parsed.Handlers, promoted); err != nil {
+			return withExitCode(exitGeneration, fmt.Errorf("failed to explain deployment: %w", err))
+		}
+	}
+
+	// Validate memory, timeout, concurrency and the rest before generating
+	if err := validateHandlers(parsed.Handlers, logger); err != nil {
+		return err
 	}
 
 	// Auto-detect module name if not provided
+	moduleName := opts.moduleName
 	if moduleName == "" {
-		detectedModule, err := detectTypeScriptModuleName()
+		detectedModule, err := detectTypeScriptModuleName(".")
 		if err != nil {
-			logger.Fatal("Failed to detect module name. Please specify --module flag", zap.Error(err))
+			return withExitCode(exitUsage, fmt.Errorf("failed to detect module name, please specify --module flag: %w", err))
 		}
 		moduleName = detectedModule
 		logger.Info("Detected module name", zap.String("module", moduleName))
@@ -481,67 +1009,116 @@ func buildTypeScript(handlersDir, outputDir, projectID, region, environment, mod
 	logger.Info("Creating deployment artifacts")
 	generator := typescript.NewGenerator(
 		parsed.Handlers,
-		outputDir,
+		opts.outputDir,
 		moduleName,
-		projectID,
-		region,
-		environment,
-		clean,
+		opts.projectID,
+		opts.region,
+		opts.environment,
+		opts.clean,
 		logger,
 	)
 
 	// Generate all artifacts
 	if err := generator.Generate(); err != nil {
-		logger.Fatal("Failed to generate artifacts", zap.Error(err))
+		return withExitCode(exitGeneration, fmt.Errorf("failed to generate artifacts: %w", err))
 	}
 
 	logger.Info("✓ Deployment artifacts generated successfully",
-		zap.String("output", outputDir))
+		zap.String("output", opts.outputDir))
 
-	printBuildSummary(outputDir)
+	if !opts.check && !opts.watching {
+		printBuildSummary(opts.outputDir)
+	}
+	return nil
 }
 
-func detectGoModuleName() (string, error) {
-	data, err := os.ReadFile("go.mod")
-	if err != nil {
-		return "", fmt.Errorf("go.mod not found: %w", err)
+// checkParseErrors logs every annotation the parser rejected and fails the build with
+// exitValidation if there were any, as box validate does
+func checkParseErrors(parseErrors []annotations.ParseError, logger *zap.Logger) error {
+	if len(parseErrors) == 0 {
+		return nil
+	}
+
+	logger.Error("Encountered parse errors", zap.Int("count", len(parseErrors)))
+	for _, parseErr := range parseErrors {
+		logger.Error("Parse error",
+			zap.String("file", parseErr.FilePath),
+			zap.Int("line", parseErr.LineNumber),
+			zap.String("message", parseErr.Message))
 	}
+	return withExitCode(exitValidation, fmt.Errorf("failed to parse handlers: %d parse errors", len(parseErrors)))
+}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "module ") {
-			return strings.TrimSpace(strings.TrimPrefix(line, "module")), nil
+// validateHandlers validates parsed handlers the same way the router does at startup
+// Only error-severity findings fail the build; warnings and notices are logged
+func validateHandlers(handlers []annotations.Handler, logger *zap.Logger) error {
+	validator := annotations.NewValidator()
+	findings := validator.Validate(handlers)
+	findings = append(findings, validator.ValidateUniquePaths(handlers)...)
+	findings = append(findings, validator.ValidateEnvVarConsistency(handlers)...)
+
+	var fatalErrors []annotations.AnnotationError
+	for _, finding := range findings {
+		if finding.IsError() {
+			fatalErrors = append(fatalErrors, finding)
+			continue
 		}
+		logger.Info("Validation notice",
+			zap.String("severity", string(finding.Severity)),
+			zap.String("handler", finding.Handler),
+			zap.String("annotation", finding.Annotation),
+			zap.String("reason", finding.Reason))
 	}
 
-	return "", fmt.Errorf("module declaration not found in go.mod")
+	if len(fatalErrors) > 0 {
+		logger.Error("Handler validation failed",
+			zap.Int("count", len(fatalErrors)))
+		for _, finding := range fatalErrors {
+			logger.Error("Validation error",
+				zap.String("handler", finding.Handler),
+				zap.String("annotation", finding.Annotation),
+				zap.String("reason", finding.Reason))
+		}
+		return withExitCode(exitValidation, fmt.Errorf("handler validation failed with %d errors", len(fatalErrors)))
+	}
+
+	return nil
+}
+
+// detectGoModuleName returns the module enclosing the handlers directory
+// Walking up from the handlers (rather than reading ./go.mod) finds nested modules in monorepos
+func detectGoModuleName(handlersDir string) (string, error) {
+	module, err := annotations.FindModule(handlersDir)
+	if err != nil {
+		return "", err
+	}
+	return module.Path, nil
 }
 
-func detectTypeScriptModuleName() (string, error) {
-	data, err := os.ReadFile("package.json")
+// detectTypeScriptModuleName reads the top-level name from dir/package.json,
+// falling back to the directory name when the field is missing or empty
+func detectTypeScriptModuleName(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
 	if err != nil {
 		return "", fmt.Errorf("package.json not found: %w", err)
 	}
 
-	// Simple JSON parsing for name field
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.Contains(line, `"name"`) {
-			// Extract value between quotes after "name":
-			parts := strings.Split(line, `"name"`)
-			if len(parts) > 1 {
-				valuePart := strings.TrimSpace(parts[1])
-				valuePart = strings.TrimPrefix(valuePart, ":")
-				valuePart = strings.TrimSpace(valuePart)
-				valuePart = strings.Trim(valuePart, `",`)
-				return valuePart, nil
-			}
-		}
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return "", fmt.Errorf("failed to parse package.json: %w", err)
 	}
 
-	return "box-app", nil // Default name
+	if name := strings.TrimSpace(pkg.Name); name != "" {
+		return name, nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	return filepath.Base(absDir), nil
 }
 
 func countFunctions(handlers []annotations.Handler) int {
@@ -564,10 +1141,26 @@ func countContainers(handlers []annotations.Handler) int {
 	return count
 }
 
+func countLambdas(handlers []annotations.Handler) int {
+	count := 0
+	for _, h := range handlers {
+		if h.DeploymentType == annotations.DeploymentLambda {
+			count++
+		}
+	}
+	return count
+}
+
 func printBuildSummary(outputDir string) {
 	fmt.Printf("\n✅ Success! Generated deployment artifacts:\n")
 	fmt.Printf("  • Cloud Functions: %s/functions/\n", outputDir)
 	fmt.Printf("  • Cloud Run Containers: %s/containers/\n", outputDir)
+	if _, err := os.Stat(filepath.Join(outputDir, "lambdas")); err == nil {
+		fmt.Printf("  • AWS Lambdas: %s/lambdas/ (Terraform: %s/terraform/modules/aws-lambda/)\n", outputDir, outputDir)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "k8s")); err == nil {
+		fmt.Printf("  • Kubernetes Manifests: %s/k8s/\n", outputDir)
+	}
 	fmt.Printf("  • API Gateway: %s/gateway/\n", outputDir)
 	fmt.Printf("  • Terraform IaC: %s/terraform/\n", outputDir)
 	fmt.Printf("\nNext steps:\n")
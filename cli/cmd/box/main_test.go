@@ -0,0 +1,1187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+func TestBuild_RequireHandlers(t *testing.T) {
+	builds := map[string]func(buildOptions, *zap.Logger) error{
+		"go":         buildGo,
+		"typescript": buildTypeScript,
+	}
+
+	tests := []struct {
+		name            string
+		requireHandlers bool
+		wantCode        int
+	}{
+		{name: "required", requireHandlers: true, wantCode: exitNoHandlers},
+		{name: "warning only", requireHandlers: false, wantCode: exitSuccess},
+	}
+
+	for lang, buildFn := range builds {
+		for _, tt := range tests {
+			t.Run(lang+"/"+tt.name, func(t *testing.T) {
+				opts := buildOptions{
+					handlersDir:     t.TempDir(), // no handler files
+					outputDir:       t.TempDir(),
+					projectID:       "test-project",
+					region:          "us-central1",
+					environment:     "dev",
+					moduleName:      "example.com/app",
+					requireHandlers: tt.requireHandlers,
+				}
+
+				err := buildFn(opts, zap.NewNop())
+				if got := exitCodeFor(err); got != tt.wantCode {
+					t.Errorf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+				}
+			})
+		}
+	}
+}
+
+func TestBundleOutput_NoHandlers(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "build")
+	bundlePath := filepath.Join(t.TempDir(), "bundle.zip")
+	opts := buildOptions{
+		handlersDir:     t.TempDir(), // no handler files
+		outputDir:       outputDir,
+		projectID:       "test-project",
+		region:          "us-central1",
+		environment:     "dev",
+		moduleName:      "example.com/app",
+		requireHandlers: false,
+	}
+
+	// Output left over from an earlier build must not be bundled
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "stale.yaml"), []byte("stale: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generated := true
+	opts.generated = &generated
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+	if err := buildGo(opts, logger); err != nil {
+		t.Fatalf("buildGo() error = %v", err)
+	}
+	if generated {
+		t.Error("build with no handlers reported generated output")
+	}
+	if err := bundleOutput(outputDir, bundlePath, generated, logger); err != nil {
+		t.Fatalf("bundleOutput() error = %v (exit code %d)", err, exitCodeFor(err))
+	}
+
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("bundle %s was written for an empty build", bundlePath)
+	}
+	if logs.FilterMessage("Nothing was generated; skipping bundle").Len() != 1 {
+		t.Errorf("expected a log line for the skipped bundle, got %v", logs.All())
+	}
+}
+
+func TestFlagPassed(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{name: "default", args: nil, want: false},
+		{name: "strict", args: []string{"--strict"}, want: true},
+		{name: "strict opted out", args: []string{"--strict", "--require-handlers=false"}, want: false},
+		{name: "explicit", args: []string{"--require-handlers"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("build", flag.ContinueOnError)
+			strict := flags.Bool("strict", false, "")
+			requireHandlers := flags.Bool("require-handlers", false, "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if !flagPassed(flags, "require-handlers") {
+				*requireHandlers = *strict
+			}
+			if *requireHandlers != tt.want {
+				t.Errorf("require-handlers = %v, want %v", *requireHandlers, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: exitSuccess},
+		{name: "tagged", err: withExitCode(exitValidation, errors.New("bad annotation")), want: exitValidation},
+		{name: "wrapped tagged", err: errors.Join(withExitCode(exitUsage, errors.New("missing flag"))), want: exitUsage},
+		{name: "untagged", err: errors.New("disk full"), want: exitGeneration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.want {
+				t.Errorf("exitCodeFor() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectGoModuleName_NestedModule(t *testing.T) {
+	root := t.TempDir()
+	serviceDir := filepath.Join(root, "services", "api")
+	handlersDir := filepath.Join(serviceDir, "handlers")
+
+	if err := os.MkdirAll(handlersDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/monorepo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(serviceDir, "go.mod"), []byte("module example.com/api\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := detectGoModuleName(handlersDir)
+	if err != nil {
+		t.Fatalf("detectGoModuleName() error = %v", err)
+	}
+	if got != "example.com/api" {
+		t.Errorf("detectGoModuleName() = %q, want %q", got, "example.com/api")
+	}
+}
+
+func TestDetectTypeScriptModuleName(t *testing.T) {
+	tests := []struct {
+		name        string
+		packageJSON string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name: "formatted",
+			packageJSON: `{
+  "name": "orders-api",
+  "version": "1.0.0"
+}`,
+			want: "orders-api",
+		},
+		{
+			name:        "compact with nested name fields first",
+			packageJSON: `{"description":"uses \"name\": \"wrong\"","author":{"name":"Jo"},"dependencies":{"name-parser":"^1.0.0"},"name":"@acme/orders"}`,
+			want:        "@acme/orders",
+		},
+		{
+			name:        "missing name falls back to directory",
+			packageJSON: `{"version":"1.0.0"}`,
+			want:        "my-service",
+		},
+		{
+			name:        "invalid json",
+			packageJSON: `{"name": "orders-api",`,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "my-service")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(tt.packageJSON), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := detectTypeScriptModuleName(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectTypeScriptModuleName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("detectTypeScriptModuleName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTypeScript_ValidatesHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations string
+		wantCode    int
+	}{
+		{
+			name:        "valid memory",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:memory 512MB",
+			wantCode:    exitSuccess,
+		},
+		{
+			name:        "invalid memory tier",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:memory 99MB",
+			wantCode:    exitValidation,
+		},
+		{
+			name:        "malformed path parameter",
+			annotations: "// @box:function\n// @box:path GET /users/{id",
+			wantCode:    exitValidation,
+		},
+		{
+			name:        "parse error",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:timeout soon",
+			wantCode:    exitValidation,
+		},
+		{
+			name:        "container memory is only a notice",
+			annotations: "// @box:container\n// @box:path GET /users\n// @box:memory 512MB",
+			wantCode:    exitSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlersDir := t.TempDir()
+			source := tt.annotations + "\nexport async function getUsers(req: Request, res: Response) {}\n"
+			if err := os.WriteFile(filepath.Join(handlersDir, "users.ts"), []byte(source), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := buildOptions{
+				handlersDir: handlersDir,
+				outputDir:   t.TempDir(),
+				projectID:   "test-project",
+				region:      "us-central1",
+				environment: "dev",
+				moduleName:  "orders-api",
+			}
+
+			err := buildTypeScript(opts, zap.NewNop())
+			if got := exitCodeFor(err); got != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestBuildGo_ValidatesHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations string
+		wantCode    int
+		wantLog     string
+	}{
+		{
+			name:        "valid",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:memory 512MB",
+			wantCode:    exitSuccess,
+		},
+		{
+			name:        "parse error",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:timeout soon",
+			wantCode:    exitValidation,
+			wantLog:     "Parse error",
+		},
+		{
+			name:        "cpu-always on a function",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:cpu-always",
+			wantCode:    exitValidation,
+			wantLog:     "Validation error",
+		},
+		{
+			name:        "min-instances over max-instances",
+			annotations: "// @box:container\n// @box:path GET /users\n// @box:min-instances 5\n// @box:max-instances 2",
+			wantCode:    exitValidation,
+			wantLog:     "Validation error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlersDir := t.TempDir()
+			source := "package users\n\n" + tt.annotations + "\nfunc ListUsers(w http.ResponseWriter, r *http.Request) {}\n"
+			if err := os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(source), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := buildOptions{
+				handlersDir: handlersDir,
+				outputDir:   t.TempDir(),
+				projectID:   "test-project",
+				region:      "us-central1",
+				environment: "dev",
+				moduleName:  "example.com/app",
+			}
+
+			core, logs := observer.New(zap.InfoLevel)
+			err := buildGo(opts, zap.New(core))
+			if got := exitCodeFor(err); got != tt.wantCode {
+				t.Fatalf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+			}
+			if tt.wantLog != "" && logs.FilterMessage(tt.wantLog).Len() == 0 {
+				t.Errorf("expected a %q log entry", tt.wantLog)
+			}
+			if tt.wantCode != exitSuccess {
+				if _, err := os.Stat(filepath.Join(opts.outputDir, "functions")); !os.IsNotExist(err) {
+					t.Error("expected nothing generated for invalid handlers")
+				}
+			}
+		})
+	}
+}
+
+func TestCheckOutput_DetectsDrift(t *testing.T) {
+	handlersDir := t.TempDir()
+	source := "package users\n\n// @box:function\n// @box:path GET /users\nfunc ListUsers(w http.ResponseWriter, r *http.Request) {}\n"
+	if err := os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := buildOptions{
+		handlersDir:     handlersDir,
+		outputDir:       filepath.Join(t.TempDir(), "build"),
+		projectID:       "test-project",
+		region:          "us-central1",
+		environment:     "dev",
+		moduleName:      "example.com/app",
+		requireHandlers: true,
+	}
+
+	// Nothing committed yet
+	if got := exitCodeFor(checkOutput(opts, buildGo, zap.NewNop())); got != exitOutOfDate {
+		t.Fatalf("exit code before build = %d, want %d", got, exitOutOfDate)
+	}
+	if _, err := os.Stat(opts.outputDir); !os.IsNotExist(err) {
+		t.Fatalf("--check wrote %s", opts.outputDir)
+	}
+
+	if err := buildGo(opts, zap.NewNop()); err != nil {
+		t.Fatalf("buildGo() error = %v", err)
+	}
+	if err := checkOutput(opts, buildGo, zap.NewNop()); err != nil {
+		t.Fatalf("checkOutput() after build = %v, want up to date", err)
+	}
+
+	// An annotation change that was not regenerated
+	source = strings.Replace(source, "GET /users", "GET /people", 1)
+	if err := os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	openAPIPath := filepath.Join(opts.outputDir, "gateway", "openapi.yaml")
+	before, err := os.ReadFile(openAPIPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkOutput(opts, buildGo, zap.NewNop())
+	if got := exitCodeFor(err); got != exitOutOfDate {
+		t.Fatalf("exit code after annotation change = %d, want %d (err: %v)", got, exitOutOfDate, err)
+	}
+	after, err := os.ReadFile(openAPIPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("--check modified the committed output")
+	}
+}
+
+func TestRunDiff_ExitCodes(t *testing.T) {
+	handlersDir := t.TempDir()
+	source := "package users\n\n// @box:function\n// @box:path GET /users\nfunc ListUsers(w http.ResponseWriter, r *http.Request) {}\n"
+	if err := os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := buildOptions{
+		handlersDir:     handlersDir,
+		outputDir:       filepath.Join(t.TempDir(), "build"),
+		projectID:       "test-project",
+		region:          "us-central1",
+		environment:     "dev",
+		moduleName:      "example.com/app",
+		requireHandlers: true,
+	}
+	if err := buildGo(opts, zap.NewNop()); err != nil {
+		t.Fatalf("buildGo() error = %v", err)
+	}
+
+	t.Run("no changes", func(t *testing.T) {
+		var out bytes.Buffer
+		changed, err := runDiff(&out, opts, buildGo, diffFormatSummary, false, zap.NewNop())
+		if got := diffExitCode(changed, err); got != exitSuccess {
+			t.Fatalf("exit code = %d, want %d (err: %v)", got, exitSuccess, err)
+		}
+		if !strings.Contains(out.String(), "  functions/list-users (unchanged)") || !strings.Contains(out.String(), "No changes") {
+			t.Errorf("summary should list every artifact as unchanged:\n%s", out.String())
+		}
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		changedSource := source + "\n// @box:function\n// @box:path POST /users\nfunc CreateUser(w http.ResponseWriter, r *http.Request) {}\n"
+		if err := os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(changedSource), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.WriteFile(filepath.Join(handlersDir, "users.go"), []byte(source), 0644)
+
+		// A function whose handler was deleted
+		stale := filepath.Join(opts.outputDir, "functions", "old-handler")
+		if err := os.MkdirAll(stale, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(stale, "main.go"), []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(stale)
+
+		openAPIPath := filepath.Join(opts.outputDir, "gateway", "openapi.yaml")
+		before, err := os.ReadFile(openAPIPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		changed, err := runDiff(&out, opts, buildGo, diffFormatSummary, false, zap.NewNop())
+		if got := diffExitCode(changed, err); got != exitDiffChanges {
+			t.Fatalf("exit code = %d, want %d (err: %v)", got, exitDiffChanges, err)
+		}
+		for _, want := range []string{
+			"+ functions/create-user (added)",
+			"- functions/old-handler (removed)",
+			"  functions/list-users (unchanged)",
+			"~ gateway (modified)",
+			"    +++ b/" + filepath.ToSlash(openAPIPath),
+			"    +    post:",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("summary missing %q:\n%s", want, out.String())
+			}
+		}
+
+		out.Reset()
+		if _, err := runDiff(&out, opts, buildGo, diffFormatPatch, false, zap.NewNop()); err != nil {
+			t.Fatalf("runDiff(patch) error = %v", err)
+		}
+		for _, want := range []string{
+			"--- /dev/null\n+++ b/" + filepath.ToSlash(filepath.Join(opts.outputDir, "functions", "create-user", "main.go")),
+			"--- a/" + filepath.ToSlash(filepath.Join(stale, "main.go")) + "\n+++ /dev/null",
+			"--- a/" + filepath.ToSlash(openAPIPath),
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("patch missing %q:\n%s", want, out.String())
+			}
+		}
+
+		after, err := os.ReadFile(openAPIPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Error("box diff modified the output directory")
+		}
+		if _, err := os.Stat(filepath.Join(opts.outputDir, "functions", "create-user")); !os.IsNotExist(err) {
+			t.Error("box diff generated a function into the output directory")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		noHandlers := opts
+		noHandlers.handlersDir = t.TempDir()
+
+		var out bytes.Buffer
+		changed, err := runDiff(&out, noHandlers, buildGo, diffFormatSummary, false, zap.NewNop())
+		if got := diffExitCode(changed, err); got != exitDiffError {
+			t.Fatalf("exit code = %d, want %d (err: %v)", got, exitDiffError, err)
+		}
+	})
+
+	t.Run("build usage error", func(t *testing.T) {
+		err := withExitCode(exitUsage, errors.New("failed to detect module name"))
+		if got := diffExitCode(false, err); got != exitDiffError {
+			t.Fatalf("exit code = %d, want %d", got, exitDiffError)
+		}
+	})
+}
+
+// box diff exits 1 only for changes, so its usage errors must exit 2 like any other error
+func TestDiffCommand_UsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown flag", args: []string{"--no-such-flag"}},
+		{name: "missing project", args: nil},
+		{name: "invalid format", args: []string{"--project", "test-project", "--format", "json"}},
+		{name: "not a project directory", args: []string{"--project", "test-project"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestDiffHelperProcess$")
+			cmd.Dir = t.TempDir() // no box.yaml, go.mod or package.json
+			cmd.Env = append(os.Environ(), "BOX_DIFF_HELPER=1", "BOX_DIFF_ARGS="+strings.Join(tt.args, " "))
+			err := cmd.Run()
+
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("box diff %s: expected an exit error, got %v", strings.Join(tt.args, " "), err)
+			}
+			if got := exitErr.ExitCode(); got != exitDiffError {
+				t.Errorf("box diff %s: exit code = %d, want %d", strings.Join(tt.args, " "), got, exitDiffError)
+			}
+		})
+	}
+}
+
+// TestDiffHelperProcess runs box diff with the arguments in BOX_DIFF_ARGS when run by
+// TestDiffCommand_UsageErrors
+func TestDiffHelperProcess(t *testing.T) {
+	if os.Getenv("BOX_DIFF_HELPER") != "1" {
+		return
+	}
+
+	os.Args = append([]string{"box", "diff"}, strings.Fields(os.Getenv("BOX_DIFF_ARGS"))...)
+	diffCommand()
+	os.Exit(exitSuccess)
+}
+
+func TestBuild_AutoPromote(t *testing.T) {
+	handlersDir := t.TempDir()
+	source := "package exports\n\n// @box:function\n// @box:path POST /exports\n// @box:timeout 10m\nfunc RunExport(w http.ResponseWriter, r *http.Request) {}\n"
+	if err := os.WriteFile(filepath.Join(handlersDir, "exports.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, autoPromote := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auto-promote=%v", autoPromote), func(t *testing.T) {
+			opts := buildOptions{
+				handlersDir:     handlersDir,
+				outputDir:       t.TempDir(),
+				projectID:       "test-project",
+				region:          "us-central1",
+				environment:     "dev",
+				moduleName:      "example.com/app",
+				requireHandlers: true,
+				autoPromote:     autoPromote,
+			}
+
+			core, logs := observer.New(zap.InfoLevel)
+			err := buildGo(opts, zap.New(core))
+
+			_, functionErr := os.Stat(filepath.Join(opts.outputDir, "functions", "run-export"))
+			_, containerErr := os.Stat(filepath.Join(opts.outputDir, "containers", "exports"))
+			promotions := logs.FilterMessageSnippet("Promoted function to container").Len()
+
+			if autoPromote {
+				if err != nil {
+					t.Fatalf("buildGo() error = %v", err)
+				}
+				if functionErr == nil || containerErr != nil || promotions != 1 {
+					t.Errorf("expected RunExport promoted to the exports container (function: %v, container: %v, logs: %d)", functionErr, containerErr, promotions)
+				}
+				return
+			}
+
+			// Without --auto-promote the timeout over the function limit fails the build
+			if got := exitCodeFor(err); got != exitValidation {
+				t.Fatalf("exit code = %d, want %d (err: %v)", got, exitValidation, err)
+			}
+			if functionErr == nil || promotions != 0 {
+				t.Errorf("expected nothing generated or promoted (function: %v, logs: %d)", functionErr, promotions)
+			}
+		})
+	}
+}
+
+func TestBuildTypeScript_RejectsDuplicatePaths(t *testing.T) {
+	handlersDir := t.TempDir()
+	source := `// @box:function
+// @box:path GET /users
+export async function listUsers(req: Request, res: Response) {}
+
+// @box:function
+// @box:path GET /users
+export async function getUsers(req: Request, res: Response) {}
+`
+	if err := os.WriteFile(filepath.Join(handlersDir, "users.ts"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	core, logs := observer.New(zap.InfoLevel)
+	opts := buildOptions{
+		handlersDir: handlersDir,
+		outputDir:   t.TempDir(),
+		projectID:   "test-project",
+		region:      "us-central1",
+		environment: "dev",
+		moduleName:  "orders-api",
+	}
+
+	err := buildTypeScript(opts, zap.New(core))
+	if got := exitCodeFor(err); got != exitValidation {
+		t.Fatalf("exit code = %d, want %d (err: %v)", got, exitValidation, err)
+	}
+
+	reported := logs.FilterMessage("Validation error").All()
+	if len(reported) == 0 {
+		t.Fatal("expected the duplicate path to be logged as a validation error")
+	}
+	if reason := reported[0].ContextMap()["reason"]; !strings.Contains(fmt.Sprint(reason), "/users") {
+		t.Errorf("validation error reason = %v, want it to name the duplicate path", reason)
+	}
+}
+
+func TestRouteInventory(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateUser",
+			FilePath:       "/src/handlers/users.go",
+			LineNumber:     30,
+			DeploymentType: annotations.DeploymentContainer,
+			ServiceName:    "accounts",
+			Route:          annotations.Route{Method: "POST", Path: "/users"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			RateLimit:      &annotations.RateLimitConfig{Count: 10, Period: time.Minute, Raw: "10/minute"},
+		},
+		{
+			FunctionName:   "GetHealth",
+			FilePath:       "/src/handlers/health.go",
+			LineNumber:     8,
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/health"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthNone},
+		},
+		{
+			FunctionName:   "ListUsers",
+			FilePath:       "/src/handlers/users.go",
+			LineNumber:     12,
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthOptional},
+		},
+	}
+
+	routes := routeInventory(handlers)
+
+	var order []string
+	for _, route := range routes {
+		order = append(order, route.Method+" "+route.Path)
+	}
+	if want := []string{"GET /health", "GET /users", "POST /users"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("routes = %v, want %v", order, want)
+	}
+
+	var table bytes.Buffer
+	if err := writeRoutesTable(&table, routes); err != nil {
+		t.Fatalf("writeRoutesTable() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got:\n%s", table.String())
+	}
+	if !strings.HasPrefix(lines[0], "METHOD") || !strings.Contains(lines[3], "container (accounts)") || !strings.Contains(lines[3], "10/minute") {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := writeRoutesJSON(&out, routes); err != nil {
+		t.Fatalf("writeRoutesJSON() error = %v", err)
+	}
+	var decoded []routeEntry
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, routes) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, routes)
+	}
+}
+
+func TestExplainDeployment(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "GetHealth",
+			PackageName:    "health",
+			FilePath:       "/src/handlers/health.go",
+			LineNumber:     8,
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/health"},
+		},
+		{
+			FunctionName:   "RunExport",
+			PackageName:    "reports",
+			FilePath:       "/src/handlers/reports.go",
+			LineNumber:     14,
+			DeploymentType: annotations.DeploymentFunction,
+			Timeout:        15 * time.Minute,
+			Route:          annotations.Route{Method: "POST", Path: "/exports"},
+		},
+		{
+			FunctionName:   "Rebuild",
+			PackageName:    "reports",
+			FilePath:       "/src/handlers/reports.go",
+			LineNumber:     30,
+			DeploymentType: annotations.DeploymentContainer,
+			ServiceName:    "indexer",
+			Schedule:       &annotations.ScheduleConfig{Cron: "0 3 * * *"},
+		},
+		{
+			FunctionName:   "GetReport",
+			PackageName:    "reports",
+			FilePath:       "/src/handlers/reports.go",
+			LineNumber:     42,
+			DeploymentType: annotations.DeploymentLambda,
+			Route:          annotations.Route{Method: "GET", Path: "/reports/{id}"},
+		},
+	}
+	promoted := annotations.AutoPromote(handlers)
+
+	var out bytes.Buffer
+	if err := explainDeployment(&out, handlers, promoted); err != nil {
+		t.Fatalf("explainDeployment() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "HANDLER") {
+		t.Fatalf("expected header and one line per handler, got:\n%s", out.String())
+	}
+
+	checks := []struct {
+		line int
+		want []string
+	}{
+		{1, []string{"GetHealth", "GET /health", "function", "@box:function (/src/handlers/health.go:8)"}},
+		{2, []string{"RunExport", "container (reports)", "promoted by --auto-promote", "15m0s", "shares package service reports with 1 other handler"}},
+		{3, []string{"Rebuild", "schedule 0 3 * * *", "@box:container", "service=indexer does not change grouping"}},
+		{4, []string{"GetReport", "lambda", "@box:lambda (built with --aws-project or AWS_DEFAULT_REGION)"}},
+	}
+	for _, check := range checks {
+		for _, want := range check.want {
+			if !strings.Contains(lines[check.line], want) {
+				t.Errorf("line %q does not contain %q", lines[check.line], want)
+			}
+		}
+	}
+}
+
+func TestCreateProject_BoxConfig(t *testing.T) {
+	project := filepath.Join(t.TempDir(), "orders")
+	if err := createProject("orders", LanguageGo, project, "acme", nil, nil); err != nil {
+		t.Fatalf("createProject() error = %v", err)
+	}
+
+	cfg, err := config.LoadConfig(filepath.Join(project, config.FileName))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.ModuleName != "github.com/acme/orders" || cfg.HandlersDir != "./handlers" {
+		t.Errorf("box.yaml = %+v, want the project module and handlers directory", cfg)
+	}
+	if cfg.Defaults.Timeout != build.DefaultTimeout || cfg.Defaults.Auth != "none" {
+		t.Errorf("box.yaml defaults = %+v, want the built-in timeout and no auth", cfg.Defaults)
+	}
+}
+
+func TestCreateProject_ImportedTags(t *testing.T) {
+	spec := `openapi: 3.0.0
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      tags: ["User Management", users]
+`
+	imported, importedTags, err := build.ImportOpenAPI([]byte(spec))
+	if err != nil {
+		t.Fatalf("ImportOpenAPI() error = %v", err)
+	}
+
+	project := filepath.Join(t.TempDir(), "orders")
+	if err := createProject("orders", LanguageGo, project, "acme", imported, importedTags); err != nil {
+		t.Fatalf("createProject() error = %v", err)
+	}
+
+	cfg, err := config.LoadConfig(filepath.Join(project, config.FileName))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := []config.TagConfig{{Name: "user-management", DisplayName: "User Management"}}
+	if !reflect.DeepEqual(cfg.Docs.Tags, want) {
+		t.Errorf("box.yaml docs tags = %+v, want %+v", cfg.Docs.Tags, want)
+	}
+
+	stubs, err := annotations.NewParser().ParseFile(filepath.Join(project, "handlers", "api.go"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(stubs.Handlers) != 1 || !reflect.DeepEqual(stubs.Handlers[0].Tags, []string{"user-management", "users"}) {
+		t.Errorf("scaffolded handlers = %+v, want ListUsers tagged user-management and users", stubs.Handlers)
+	}
+	if errs := annotations.NewValidatorWithConfig(cfg).Validate(stubs.Handlers); len(errs) > 0 {
+		t.Errorf("scaffolded handlers fail validation: %v", errs)
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		strict   bool
+		wantCode int
+		wantText string
+	}{
+		{
+			name:     "valid handlers",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /status\nfunc Status(w http.ResponseWriter, r *http.Request) {}\n",
+			wantCode: exitSuccess,
+			wantText: "✓ 1 handlers validated, 0 errors",
+		},
+		{
+			name:     "invalid memory",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /status\n// @box:memory 3GB\nfunc Status(w http.ResponseWriter, r *http.Request) {}\n",
+			wantCode: exitValidation,
+			wantText: "✗ 1 handlers validated, 1 errors",
+		},
+		{
+			name:     "duplicate paths",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /users\nfunc ListUsers(w http.ResponseWriter, r *http.Request) {}\n\n// @box:function\n// @box:path GET /users\nfunc GetUsers(w http.ResponseWriter, r *http.Request) {}\n",
+			wantCode: exitValidation,
+			wantText: "2 handlers validated, 1 errors",
+		},
+		{
+			name:     "unparseable annotation",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /status\n// @box:ratelimit lots\nfunc Status(w http.ResponseWriter, r *http.Request) {}\n",
+			wantCode: exitValidation,
+			wantText: "api.go:",
+		},
+		{
+			name:     "warning passes",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /me\n// @box:auth required\nfunc Me(w http.ResponseWriter, r *http.Request) {}\n",
+			wantCode: exitSuccess,
+			wantText: "warning",
+		},
+		{
+			name:     "strict promotes warnings",
+			source:   "package api\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /me\n// @box:auth required\nfunc Me(w http.ResponseWriter, r *http.Request) {}\n",
+			strict:   true,
+			wantCode: exitValidation,
+			wantText: "✗ 1 handlers validated, 1 errors",
+		},
+		{
+			name:     "no handlers",
+			source:   "package api\n",
+			wantCode: exitNoHandlers,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := t.TempDir()
+			handlersDir := filepath.Join(project, "api")
+			if err := os.MkdirAll(handlersDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(project, "go.mod"), []byte("module example.com/app\n\ngo 1.23\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(handlersDir, "api.go"), []byte(tt.source), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err := runValidate(&out, validateOptions{
+				lang:        LanguageGo,
+				handlersDir: handlersDir,
+				outputDir:   filepath.Join(project, "build"),
+				format:      "text",
+				strict:      tt.strict,
+			})
+			if got := exitCodeFor(err); got != tt.wantCode {
+				t.Fatalf("exit code = %d, want %d (err: %v)\n%s", got, tt.wantCode, err, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantText) {
+				t.Errorf("output does not contain %q:\n%s", tt.wantText, out.String())
+			}
+		})
+	}
+}
+
+func TestRunValidate_JSON(t *testing.T) {
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "go.mod"), []byte("module example.com/app\n\ngo 1.23\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := "package app\n\nimport \"net/http\"\n\n// @box:function\n// @box:path GET /status\n// @box:env DATABASE_URL\nfunc Status(w http.ResponseWriter, r *http.Request) {}\n"
+	if err := os.WriteFile(filepath.Join(project, "app.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Terraform generated before DATABASE_URL was declared
+	moduleDir := filepath.Join(project, "build", "terraform", "modules", "cloud-functions")
+	if err := os.MkdirAll(moduleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte("# no secrets\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := runValidate(&out, validateOptions{
+		lang:        LanguageGo,
+		handlersDir: project,
+		outputDir:   filepath.Join(project, "build"),
+		format:      "json",
+	})
+	if err != nil {
+		t.Fatalf("runValidate() error = %v", err)
+	}
+
+	var report validationReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if report.Handlers != 1 || report.Errors != 0 || report.Warnings != 1 {
+		t.Fatalf("report = %+v, want 1 handler and the missing secret as a warning", report)
+	}
+	if finding := report.Findings[0]; finding.Annotation != "@box:env DATABASE_URL" {
+		t.Errorf("finding = %+v, want the missing DATABASE_URL secret", finding)
+	}
+}
+
+// writeDeployOutput creates a build output directory with a deploy.sh in each of dirs
+func writeDeployOutput(t *testing.T, dirs ...string) string {
+	t.Helper()
+	outputDir := t.TempDir()
+	for _, dir := range dirs {
+		full := filepath.Join(outputDir, filepath.FromSlash(dir))
+		if err := os.MkdirAll(full, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(full, "deploy.sh"), []byte("#!/bin/bash\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return outputDir
+}
+
+func deployTargetNames(targets []deployTarget) []string {
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+	return names
+}
+
+func TestFindDeployTargets(t *testing.T) {
+	want := []string{"functions/create-account", "functions/delete-account", "lambdas/export", "containers/billing", "containers/users", "gateway"}
+
+	t.Run("from the manifest", func(t *testing.T) {
+		outputDir := writeDeployOutput(t, "gateway", "containers/users", "functions/delete-account", "containers/billing", "functions/create-account", "lambdas/export")
+
+		// Manifest entries without a deploy.sh (Terraform, an envoy gateway) are left out
+		if err := os.MkdirAll(filepath.Join(outputDir, "terraform"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		manifest := &build.Manifest{Artifacts: map[string]build.ManifestArtifact{}}
+		for _, artifact := range []string{"gateway", "terraform", "containers/users", "containers/billing", "functions/create-account", "functions/delete-account", "lambdas"} {
+			manifest.Artifacts[artifact] = build.ManifestArtifact{}
+		}
+		if err := manifest.Save(filepath.Join(outputDir, build.ManifestFile)); err != nil {
+			t.Fatal(err)
+		}
+
+		targets, err := findDeployTargets(outputDir)
+		if err != nil {
+			t.Fatalf("findDeployTargets() error = %v", err)
+		}
+		if got := deployTargetNames(targets); !reflect.DeepEqual(got, want) {
+			t.Errorf("targets = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("without a manifest", func(t *testing.T) {
+		outputDir := writeDeployOutput(t, "gateway", "containers/users", "functions/create-account")
+
+		targets, err := findDeployTargets(outputDir)
+		if err != nil {
+			t.Fatalf("findDeployTargets() error = %v", err)
+		}
+		if got := deployTargetNames(targets); !reflect.DeepEqual(got, []string{"functions/create-account", "containers/users", "gateway"}) {
+			t.Errorf("targets = %v", got)
+		}
+	})
+}
+
+func TestSelectDeployTargets(t *testing.T) {
+	targets := []deployTarget{
+		{Name: "functions/create-account", Kind: deployFunction},
+		{Name: "functions/users", Kind: deployFunction},
+		{Name: "containers/users", Kind: deployService},
+		{Name: "gateway", Kind: deployGateway},
+	}
+
+	if got := deployTargetNames(selectDeployTargets(targets, "users", "")); !reflect.DeepEqual(got, []string{"functions/users"}) {
+		t.Errorf("--function users = %v", got)
+	}
+	if got := deployTargetNames(selectDeployTargets(targets, "create-account", "users")); !reflect.DeepEqual(got, []string{"functions/create-account", "containers/users"}) {
+		t.Errorf("--function create-account --service users = %v", got)
+	}
+	if got := selectDeployTargets(targets, "missing", ""); len(got) != 0 {
+		t.Errorf("unknown function selected %v", got)
+	}
+}
+
+// TestDeployHelperProcess stands in for a deploy.sh when run by mockDeployCommand
+func TestDeployHelperProcess(t *testing.T) {
+	if os.Getenv("BOX_DEPLOY_HELPER") != "1" {
+		return
+	}
+
+	name := os.Getenv("BOX_DEPLOY_TARGET")
+	fmt.Printf("deploying %s\nlast line without newline", name)
+	fmt.Fprintln(os.Stderr, "progress")
+
+	// Functions wait until every function has started, so they only finish when run concurrently
+	if barrier := os.Getenv("BOX_DEPLOY_BARRIER"); barrier != "" && strings.HasPrefix(name, "functions/") {
+		if err := os.WriteFile(filepath.Join(barrier, filepath.Base(name)), nil, 0644); err != nil {
+			os.Exit(2)
+		}
+		wait, err := time.ParseDuration(os.Getenv("BOX_DEPLOY_WAIT"))
+		if err != nil {
+			wait = 5 * time.Second
+		}
+		deadline := time.Now().Add(wait)
+		for {
+			entries, _ := os.ReadDir(barrier)
+			if len(entries) == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				fmt.Fprintln(os.Stderr, "timed out waiting for the other functions")
+				os.Exit(3)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if name == os.Getenv("BOX_DEPLOY_FAIL") {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// mockDeployCommand runs TestDeployHelperProcess in place of each deploy script
+func mockDeployCommand(env ...string) func(deployTarget) *exec.Cmd {
+	return func(target deployTarget) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDeployHelperProcess$")
+		cmd.Env = append(os.Environ(), append([]string{"BOX_DEPLOY_HELPER=1", "BOX_DEPLOY_TARGET=" + target.Name}, env...)...)
+		return cmd
+	}
+}
+
+func TestDeployer(t *testing.T) {
+	targets := []deployTarget{
+		{Name: "functions/create-account", Kind: deployFunction},
+		{Name: "functions/delete-account", Kind: deployFunction},
+		{Name: "containers/billing", Kind: deployService},
+		{Name: "containers/users", Kind: deployService},
+		{Name: "gateway", Kind: deployGateway},
+	}
+
+	t.Run("parallel functions", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		d := &deployer{
+			parallel: true,
+			command:  mockDeployCommand("BOX_DEPLOY_BARRIER=" + t.TempDir()),
+			stdout:   &stdout,
+			stderr:   &stderr,
+		}
+
+		result := d.run(targets)
+		if len(result.Failed) > 0 || len(result.Succeeded) != len(targets) {
+			t.Fatalf("result = %+v\n%s", result, stderr.String())
+		}
+		for _, want := range []string{
+			"[functions/create-account] deploying functions/create-account\n",
+			"[functions/create-account] last line without newline\n",
+			"[gateway] deploying gateway\n",
+		} {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("stdout missing %q:\n%s", want, stdout.String())
+			}
+		}
+		if !strings.Contains(stderr.String(), "[containers/users] progress\n") {
+			t.Errorf("stderr missing prefixed output:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("sequential functions", func(t *testing.T) {
+		// Without --parallel the first function waits for the second until it times out
+		var stdout, stderr bytes.Buffer
+		d := &deployer{
+			command: mockDeployCommand("BOX_DEPLOY_BARRIER="+t.TempDir(), "BOX_DEPLOY_WAIT=300ms"),
+			stdout:  &stdout,
+			stderr:  &stderr,
+		}
+
+		result := d.run(targets)
+		if !reflect.DeepEqual(result.Failed, []string{"functions/create-account"}) {
+			t.Fatalf("failed = %v, want the first function", result.Failed)
+		}
+		if len(result.Succeeded) != 0 || len(result.Skipped) != len(targets)-1 {
+			t.Errorf("result = %+v, want every later target skipped", result)
+		}
+	})
+
+	t.Run("failure stops the pipeline", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		d := &deployer{
+			parallel: true,
+			command:  mockDeployCommand("BOX_DEPLOY_FAIL=containers/billing"),
+			stdout:   &stdout,
+			stderr:   &stderr,
+		}
+
+		result := d.run(targets)
+		want := deployResult{
+			Succeeded: []string{"functions/create-account", "functions/delete-account"},
+			Failed:    []string{"containers/billing"},
+			Skipped:   []string{"containers/users", "gateway"},
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Fatalf("result = %+v, want %+v", result, want)
+		}
+		if strings.Contains(stdout.String(), "[gateway]") {
+			t.Error("the gateway deployed after a service failed")
+		}
+
+		var summary bytes.Buffer
+		printDeploySummary(&summary, result)
+		for _, line := range []string{"  ✗ containers/billing\n", "  - gateway (skipped)\n", "2 deployed, 1 failed, 2 skipped"} {
+			if !strings.Contains(summary.String(), line) {
+				t.Errorf("summary missing %q:\n%s", line, summary.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+// validateOptions holds the box validate flags
+type validateOptions struct {
+	lang        Language
+	handlersDir string
+	outputDir   string // checked for Terraform that predates an @box:env declaration
+	format      string // text or json
+	strict      bool   // treat warnings as errors
+	boxConfig   *config.BoxConfig
+}
+
+// validationFinding is one problem reported by box validate
+type validationFinding struct {
+	Severity   annotations.Severity `json:"severity"`
+	Handler    string               `json:"handler,omitempty"`
+	Annotation string               `json:"annotation,omitempty"`
+	Reason     string               `json:"reason"`
+	Source     string               `json:"source,omitempty"`
+}
+
+// validationReport is the result of box validate, printed as text or JSON
+type validationReport struct {
+	Handlers int                 `json:"handlers"`
+	Errors   int                 `json:"errors"`
+	Warnings int                 `json:"warnings"`
+	Findings []validationFinding `json:"findings"`
+}
+
+func validateCommand() {
+	cfg, err := config.LoadConfig(config.FileName)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	validateFlags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	handlersDir := validateFlags.String("handlers", orDefault(cfg.HandlersDir, "./handlers"), "Path to handlers directory")
+	outputDir := validateFlags.String("output", orDefault(cfg.OutputDir, "./build"), "Build output to check for Terraform missing @box:env secrets")
+	format := validateFlags.String("format", "text", "Output format: text or json")
+	strict := validateFlags.Bool("strict", false, "Treat warnings as errors")
+
+	validateFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: box validate [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Check handler annotations without generating anything.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		validateFlags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  box validate\n")
+		fmt.Fprintf(os.Stderr, "  box validate --strict --format json\n\n")
+	}
+
+	parseFlags(validateFlags, os.Args[2:])
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: --format must be text or json\n\n")
+		validateFlags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	lang, err := detectLanguage()
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	err = runValidate(os.Stdout, validateOptions{
+		lang:        lang,
+		handlersDir: *handlersDir,
+		outputDir:   *outputDir,
+		format:      *format,
+		strict:      *strict,
+		boxConfig:   cfg,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+// runValidate parses and validates the handlers, writes the report to w, and returns an
+// error carrying exitValidation when any error-severity finding remains
+func runValidate(w io.Writer, opts validateOptions) error {
+	parsed, err := parseHandlers(opts.lang, opts.handlersDir)
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("failed to parse handlers: %w", err))
+	}
+	if len(parsed.Handlers) == 0 && len(parsed.Errors) == 0 {
+		return withExitCode(exitNoHandlers, fmt.Errorf("no handlers found with @box: annotations in %s", opts.handlersDir))
+	}
+
+	wd, _ := os.Getwd()
+	sources := make(map[string]string)
+	for _, h := range parsed.Handlers {
+		if _, seen := sources[h.FunctionName]; !seen {
+			sources[h.FunctionName] = fmt.Sprintf("%s:%d", relativeSource(wd, h.FilePath), h.LineNumber)
+		}
+	}
+
+	var findings []validationFinding
+	for _, parseErr := range parsed.Errors {
+		findings = append(findings, validationFinding{
+			Severity:   annotations.SeverityError,
+			Annotation: parseErr.Annotation,
+			Reason:     parseErr.Message,
+			Source:     fmt.Sprintf("%s:%d", relativeSource(wd, parseErr.FilePath), parseErr.LineNumber),
+		})
+	}
+
+	// The same checks box build and the router run, with box.yaml defaults applied
+	validator := annotations.NewValidatorWithConfig(opts.boxConfig)
+	results := validator.Validate(parsed.Handlers)
+	results = append(results, validator.ValidateUniquePaths(parsed.Handlers)...)
+	results = append(results, validator.ValidateEnvVarConsistency(parsed.Handlers)...)
+	results = append(results, validator.ValidateServiceGrouping(parsed.Handlers)...)
+	for _, result := range results {
+		severity := result.Severity
+		if severity == "" {
+			severity = annotations.SeverityError
+		}
+		findings = append(findings, validationFinding{
+			Severity:   severity,
+			Handler:    result.Handler,
+			Annotation: result.Annotation,
+			Reason:     result.Reason,
+			Source:     sources[result.Handler],
+		})
+	}
+
+	if opts.lang == LanguageGo {
+		findings = append(findings, checkPackagePaths(parsed.Handlers, opts.handlersDir)...)
+	}
+	findings = append(findings, checkEnvSecrets(parsed.Handlers, opts.outputDir)...)
+
+	report := validationReport{Handlers: len(parsed.Handlers), Findings: findings}
+	for i := range report.Findings {
+		finding := &report.Findings[i]
+		if opts.strict && finding.Severity == annotations.SeverityWarning {
+			finding.Severity = annotations.SeverityError
+		}
+		switch finding.Severity {
+		case annotations.SeverityError:
+			report.Errors++
+		case annotations.SeverityWarning:
+			report.Warnings++
+		}
+	}
+	if report.Findings == nil {
+		report.Findings = []validationFinding{}
+	}
+
+	if opts.format == "json" {
+		err = writeValidationJSON(w, report)
+	} else {
+		err = writeValidationText(w, report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write validation report: %w", err)
+	}
+
+	if report.Errors > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%d handlers validated, %d errors", report.Handlers, report.Errors))
+	}
+	return nil
+}
+
+// checkPackagePaths reports Go handlers whose package directory can't be found under the
+// module root, which generated functions and containers import them from
+func checkPackagePaths(handlers []annotations.Handler, handlersDir string) []validationFinding {
+	module, err := annotations.FindModule(handlersDir)
+	if err != nil {
+		return []validationFinding{{
+			Severity: annotations.SeverityError,
+			Reason:   fmt.Sprintf("handlers are not inside a Go module: %v", err),
+		}}
+	}
+
+	checked := make(map[string]bool)
+	var findings []validationFinding
+	for _, h := range handlers {
+		if checked[h.PackagePath] {
+			continue
+		}
+		checked[h.PackagePath] = true
+
+		dir := filepath.Join(module.Dir, filepath.FromSlash(h.PackagePath))
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			findings = append(findings, validationFinding{
+				Severity: annotations.SeverityError,
+				Handler:  h.FunctionName,
+				Reason:   fmt.Sprintf("package path %q does not exist in module %s", h.PackagePath, module.Path),
+			})
+		}
+	}
+	return findings
+}
+
+// checkEnvSecrets warns about @box:env variables that previously generated Terraform
+// doesn't read yet; without generated Terraform there is nothing to compare
+func checkEnvSecrets(handlers []annotations.Handler, outputDir string) []validationFinding {
+	terraformDir := filepath.Join(outputDir, "terraform")
+	if _, err := os.Stat(terraformDir); err != nil {
+		return nil
+	}
+
+	missing, err := build.MissingEnvSecrets(handlers, terraformDir)
+	if err != nil {
+		return []validationFinding{{Severity: annotations.SeverityWarning, Reason: err.Error()}}
+	}
+
+	var findings []validationFinding
+	for _, name := range missing {
+		findings = append(findings, validationFinding{
+			Severity:   annotations.SeverityWarning,
+			Annotation: "@box:env " + name,
+			Reason:     fmt.Sprintf("%s has no secret in %s; run box build to regenerate it", name, terraformDir),
+		})
+	}
+	return findings
+}
+
+// writeValidationText prints findings, most severe first, followed by the summary line
+func writeValidationText(w io.Writer, report validationReport) error {
+	rank := map[annotations.Severity]int{annotations.SeverityError: 0, annotations.SeverityWarning: 1, annotations.SeverityInfo: 2}
+	findings := append([]validationFinding(nil), report.Findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return rank[findings[i].Severity] < rank[findings[j].Severity]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, finding := range findings {
+		location := finding.Source
+		if location == "" {
+			location = finding.Handler
+		}
+		if location == "" {
+			location = "-"
+		}
+		annotation := finding.Annotation
+		if annotation == "" {
+			annotation = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", finding.Severity, location, annotation, finding.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	mark := "✓"
+	if report.Errors > 0 {
+		mark = "✗"
+	}
+	_, err := fmt.Fprintf(w, "%s %d handlers validated, %d errors\n", mark, report.Handlers, report.Errors)
+	return err
+}
+
+// writeValidationJSON prints the report as indented JSON
+func writeValidationJSON(w io.Writer, report validationReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
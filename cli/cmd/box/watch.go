@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/build"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+func watchCommand() {
+	cfg, err := config.LoadConfig(config.FileName)
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+	timeoutDefault := build.DefaultTimeout
+	if cfg.Defaults.Timeout > 0 {
+		timeoutDefault = cfg.Defaults.Timeout
+	}
+
+	watchFlags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	handlersDir := watchFlags.String("handlers", orDefault(cfg.HandlersDir, "./handlers"), "Path to handlers directory")
+	outputDir := watchFlags.String("output", orDefault(cfg.OutputDir, "./build"), "Path to output directory")
+	projectID := watchFlags.String("project", cfg.ProjectID, "GCP project ID (required)")
+	region := watchFlags.String("region", orDefault(cfg.Region, "us-central1"), "GCP region")
+	environment := watchFlags.String("env", orDefault(cfg.Environment, "dev"), "Environment (dev, staging, production)")
+	moduleName := watchFlags.String("module", cfg.ModuleName, "Module name (auto-detected if not provided)")
+	noGateway := watchFlags.Bool("no-gateway", false, "Skip the API Gateway configuration on each rebuild (Go only)")
+	noTerraform := watchFlags.Bool("no-terraform", false, "Skip Terraform on each rebuild (Go only)")
+	debounce := watchFlags.Duration("debounce", build.DefaultWatchDebounce, "Quiet period after the last change before rebuilding")
+	verbose := watchFlags.Bool("verbose", cfg.Verbose, "Log every build step instead of only warnings and errors")
+
+	watchFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: box watch [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Build once, then rebuild whenever a file under the handlers directory changes.\n\n")
+		fmt.Fprintf(os.Stderr, "Options (defaults come from %s when present):\n", config.FileName)
+		watchFlags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  box watch --project my-gcp-project\n")
+		fmt.Fprintf(os.Stderr, "  box watch --project my-gcp-project --no-gateway --no-terraform\n\n")
+	}
+
+	parseFlags(watchFlags, os.Args[2:])
+
+	if *projectID == "" {
+		fmt.Fprintf(os.Stderr, "Error: --project flag (or projectID in %s) is required\n\n", config.FileName)
+		watchFlags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	lang, err := detectLanguage()
+	if err != nil {
+		fail(exitUsage, "%v", err)
+	}
+
+	// Rebuilds are frequent, so only warnings and errors are logged by default
+	var logger *zap.Logger
+	if *verbose {
+		logger, err = zap.NewDevelopment()
+	} else {
+		zapConfig := zap.NewProductionConfig()
+		zapConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+		logger, err = zapConfig.Build()
+	}
+	if err != nil {
+		fail(exitGeneration, "Failed to create logger: %v", err)
+	}
+	defer logger.Sync()
+
+	opts := buildOptions{
+		handlersDir:     *handlersDir,
+		outputDir:       *outputDir,
+		projectID:       *projectID,
+		region:          *region,
+		environment:     *environment,
+		moduleName:      *moduleName,
+		gateway:         build.GatewayGCP,
+		defaultTimeout:  timeoutDefault,
+		healthPath:      build.DefaultHealthPath,
+		defaultRoles:    build.DefaultServiceAccountRoles,
+		requireHandlers: false, // Handlers may not exist yet when a watch starts
+		boxConfig:       cfg,
+		watching:        true,
+		skipGateway:     *noGateway,
+		skipTerraform:   *noTerraform,
+	}
+
+	buildFn := buildGo
+	if lang == LanguageTypeScript {
+		buildFn = buildTypeScript
+	}
+
+	// Stop cleanly on Ctrl-C or when the process is terminated
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var started time.Time
+	onStart := func() {
+		started = time.Now()
+		fmt.Printf("[%s] Rebuilding...\n", started.Format("15:04:05"))
+	}
+	onRebuild := func(err error) {
+		finished := time.Now()
+		if err != nil {
+			fmt.Printf("[%s] ✗ Build failed: %v\n", finished.Format("15:04:05"), err)
+			return
+		}
+		fmt.Printf("[%s] ✓ Built %s in %s\n", finished.Format("15:04:05"), opts.outputDir, finished.Sub(started).Round(time.Millisecond))
+	}
+
+	onStart()
+	onRebuild(buildFn(opts, logger))
+
+	watcher := build.NewWatchBuilder(build.WatchConfig{
+		Dir:      opts.handlersDir,
+		Build:    func() error { return buildFn(opts, logger) },
+		Debounce: *debounce,
+		OnStart:  onStart,
+	})
+
+	fmt.Printf("👀 Watching %s for changes (Ctrl-C to stop)\n", opts.handlersDir)
+	if err := watcher.Start(ctx, onRebuild); err != nil {
+		fail(exitUsage, "Failed to watch %s: %v", opts.handlersDir, err)
+	}
+	fmt.Println("Stopped watching")
+}
@@ -0,0 +1,497 @@
+package typescript
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/build"
+	"go.uber.org/zap"
+)
+
+// ContainerGenerator generates Cloud Run container services for TypeScript handlers
+type ContainerGenerator struct {
+	handlers  []annotations.Handler
+	outputDir string
+	projectID string
+	region    string
+	logger    *zap.Logger
+}
+
+// NewContainerGenerator creates a new container generator
+func NewContainerGenerator(handlers []annotations.Handler, outputDir, projectID, region string, logger *zap.Logger) *ContainerGenerator {
+	return &ContainerGenerator{
+		handlers:  handlers,
+		outputDir: outputDir,
+		projectID: projectID,
+		region:    region,
+		logger:    logger,
+	}
+}
+
+// Generate generates a package for each container service
+func (g *ContainerGenerator) Generate() error {
+	// Group container handlers into services the same way the Go build does (by package)
+	plan := build.NewDeploymentPlan(g.handlers, build.NetworkingPlan{
+		Region:     g.region,
+		HealthPath: build.DefaultHealthPath,
+	})
+
+	if len(plan.Services) == 0 {
+		g.logger.Info("No container handlers to generate")
+		return nil
+	}
+
+	// Create output directory
+	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create containers directory: %w", err)
+	}
+
+	for _, group := range plan.Services {
+		if err := g.generateService(group); err != nil {
+			return fmt.Errorf("failed to generate service %s: %w", group.Name, err)
+		}
+	}
+
+	g.logger.Info("Generated container services",
+		zap.Int("count", len(plan.Services)),
+		zap.String("outputDir", g.outputDir))
+
+	return nil
+}
+
+// generateService generates a single service package
+func (g *ContainerGenerator) generateService(group build.ServiceGroup) error {
+	serviceName := toKebabCase(group.Name)
+	serviceDir := filepath.Join(g.outputDir, serviceName)
+
+	g.logger.Info("Generating container service",
+		zap.String("service", serviceName),
+		zap.Int("handlers", len(group.Handlers)))
+
+	// Create service directory
+	if err := os.MkdirAll(serviceDir, 0755); err != nil {
+		return err
+	}
+
+	// Generate files
+	if err := g.generateIndexTs(serviceDir, serviceName, group); err != nil {
+		return fmt.Errorf("failed to generate index.ts: %w", err)
+	}
+	if err := g.generatePackageJson(serviceDir, serviceName); err != nil {
+		return fmt.Errorf("failed to generate package.json: %w", err)
+	}
+	if err := g.generateFromTemplate(serviceDir, "Dockerfile", dockerfileTemplate, serviceName); err != nil {
+		return fmt.Errorf("failed to generate Dockerfile: %w", err)
+	}
+	if err := g.generateFromTemplate(serviceDir, "cloudbuild.yaml", cloudBuildTemplate, serviceName); err != nil {
+		return fmt.Errorf("failed to generate cloudbuild.yaml: %w", err)
+	}
+	if err := g.generateFromTemplate(serviceDir, "deploy.sh", deployScriptTemplate, serviceName); err != nil {
+		return fmt.Errorf("failed to generate deploy.sh: %w", err)
+	}
+
+	// Make script executable
+	return os.Chmod(filepath.Join(serviceDir, "deploy.sh"), 0755)
+}
+
+// serviceImport is one handler module imported by a service's index.ts
+type serviceImport struct {
+	Path      string   // Relative module path, without extension
+	Functions []string // Exported handlers, sorted
+}
+
+// serviceRoute is one Express route registered by a service's index.ts
+type serviceRoute struct {
+	Method       string // Lowercase Express method (e.g., "get")
+	Path         string // Express path (e.g., "/users/:id")
+	FunctionName string
+}
+
+// generateIndexTs generates the Express server entry point
+func (g *ContainerGenerator) generateIndexTs(dir, serviceName string, group build.ServiceGroup) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// Import each handler from its source file, relative to the service directory
+	functionsByPath := make(map[string][]string)
+	var routes []serviceRoute
+	builtinHealth := true
+	for _, handler := range group.Handlers {
+		source, err := filepath.Abs(handler.FilePath)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(absDir, strings.TrimSuffix(source, filepath.Ext(source)))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !strings.HasPrefix(rel, ".") {
+			rel = "./" + rel
+		}
+		functionsByPath[rel] = append(functionsByPath[rel], handler.FunctionName)
+
+		routes = append(routes, serviceRoute{
+			Method:       strings.ToLower(handler.Route.Method),
+			Path:         expressPath(handler.Route.Path),
+			FunctionName: handler.FunctionName,
+		})
+
+		// As in the Go router, a user handler takes precedence over the built-in health endpoint
+		if handler.Route.Method == "GET" && handler.Route.Path == build.DefaultHealthPath {
+			g.logger.Warn("Handler overrides built-in health endpoint",
+				zap.String("service", serviceName),
+				zap.String("function", handler.FunctionName),
+				zap.String("path", build.DefaultHealthPath))
+			builtinHealth = false
+		}
+	}
+
+	var imports []serviceImport
+	for path, functions := range functionsByPath {
+		sort.Strings(functions)
+		imports = append(imports, serviceImport{Path: path, Functions: functions})
+	}
+	sort.Slice(imports, func(i, j int) bool { return imports[i].Path < imports[j].Path })
+
+	data := struct {
+		ServiceName   string
+		ProjectID     string
+		HealthPath    string
+		BuiltinHealth bool
+		Imports       []serviceImport
+		Routes        []serviceRoute
+	}{
+		ServiceName:   serviceName,
+		ProjectID:     g.projectID,
+		HealthPath:    build.DefaultHealthPath,
+		BuiltinHealth: builtinHealth,
+		Imports:       imports,
+		Routes:        routes,
+	}
+
+	return executeTemplate(filepath.Join(dir, "index.ts"), indexTsTemplate, data)
+}
+
+// generatePackageJson generates package.json
+func (g *ContainerGenerator) generatePackageJson(dir, serviceName string) error {
+	pkg := map[string]interface{}{
+		"name":        serviceName,
+		"version":     "1.0.0",
+		"private":     true,
+		"description": fmt.Sprintf("Cloud Run service %s", serviceName),
+		"main":        fmt.Sprintf("dist/build/containers/%s/index.js", serviceName),
+		"scripts": map[string]string{
+			// Handlers live outside the service directory, so compile from the project root
+			"build": "tsc --rootDir ../../.. --outDir dist --module commonjs --target es2020 --esModuleInterop --skipLibCheck index.ts",
+			"start": fmt.Sprintf("node dist/build/containers/%s/index.js", serviceName),
+		},
+		"dependencies": map[string]string{
+			"@google-cloud/secret-manager": "^5.0.0",
+			"express":                      "^4.18.2",
+			"typescript":                   "^5.3.0",
+		},
+		"devDependencies": map[string]string{
+			"@types/express": "^4.17.21",
+			"@types/node":    "^20.10.0",
+		},
+		"engines": map[string]string{
+			"node": ">=20.0.0",
+		},
+	}
+
+	data, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "package.json"), data, 0644)
+}
+
+// generateFromTemplate renders one of the service's build and deploy files
+func (g *ContainerGenerator) generateFromTemplate(dir, name, text, serviceName string) error {
+	region := g.region
+	if region == "" {
+		region = "us-central1"
+	}
+
+	data := struct {
+		ServiceName string
+		Region      string
+		HealthPath  string
+	}{
+		ServiceName: serviceName,
+		Region:      region,
+		HealthPath:  build.DefaultHealthPath,
+	}
+
+	return executeTemplate(filepath.Join(dir, name), text, data)
+}
+
+// executeTemplate renders a template to path
+func executeTemplate(path, text string, data interface{}) error {
+	tmpl := template.Must(template.New(filepath.Base(path)).Parse(text))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return tmpl.Execute(file, data)
+}
+
+// pathParamPattern matches a {param} path segment
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// expressPath converts {param} path parameters to Express's :param syntax
+func expressPath(path string) string {
+	return pathParamPattern.ReplaceAllString(path, ":$1")
+}
+
+// toKebabCase converts a CamelCase name to kebab-case
+func toKebabCase(name string) string {
+	var result strings.Builder
+
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			result.WriteRune('-')
+		}
+		result.WriteRune(r)
+	}
+
+	return strings.ToLower(result.String())
+}
+
+// Templates
+
+const indexTsTemplate = `// Code generated by Box build system. DO NOT EDIT.
+import express, { NextFunction, Request, RequestHandler, Response } from 'express';
+import { SecretManagerServiceClient } from '@google-cloud/secret-manager';
+{{range .Imports}}
+import { {{range $i, $fn := .Functions}}{{if $i}}, {{end}}{{$fn}}{{end}} } from '{{.Path}}';
+{{- end}}
+
+const SERVICE_NAME = '{{.ServiceName}}';
+
+type Handler = (req: Request, res: Response) => unknown;
+
+// loadSecret fills an unset environment variable from the latest version of a Secret Manager secret
+async function loadSecret(envVar: string, secretId: string): Promise<void> {
+  const project = process.env.GOOGLE_CLOUD_PROJECT || '{{.ProjectID}}';
+  if (process.env[envVar] || !project) {
+    return;
+  }
+
+  const client = new SecretManagerServiceClient();
+  const [version] = await client.accessSecretVersion({
+    name: ` + "`projects/${project}/secrets/${secretId}/versions/latest`" + `,
+  });
+  process.env[envVar] = version.payload?.data?.toString() ?? '';
+}
+
+// deployed forwards errors thrown by async handlers to the error handler
+function deployed(functionName: string, handler: Handler): RequestHandler {
+  return async (req: Request, res: Response, next: NextFunction) => {
+    res.locals.functionName = functionName;
+    try {
+      await handler(req, res);
+    } catch (err) {
+      next(err);
+    }
+  };
+}
+
+async function main(): Promise<void> {
+  await loadSecret('DATABASE_URL', 'database-url');
+
+  // Expose deployment metadata to handlers
+  process.env.BOX_SERVICE = process.env.BOX_SERVICE || SERVICE_NAME;
+  process.env.BOX_ENVIRONMENT = process.env.BOX_ENVIRONMENT || process.env.ENVIRONMENT || '';
+
+  const app = express();
+  app.use(express.json());
+
+  // Register handlers
+{{- range .Routes}}
+  app.{{.Method}}('{{.Path}}', deployed('{{.FunctionName}}', {{.FunctionName}}));
+{{- end}}
+{{- if .BuiltinHealth}}
+
+  // Health check
+  app.get('{{.HealthPath}}', (_req: Request, res: Response) => {
+    res.status(200).json({ status: 'ok' });
+  });
+{{- end}}
+
+  app.use((err: unknown, _req: Request, res: Response, _next: NextFunction) => {
+    console.error(JSON.stringify({ severity: 'ERROR', message: 'Handler failed', function: res.locals.functionName, error: String(err) }));
+    if (!res.headersSent) {
+      res.status(500).json({ error: 'Internal server error' });
+    }
+  });
+
+  const port = Number(process.env.PORT || 8080);
+  const server = app.listen(port, () => {
+    console.log(JSON.stringify({ severity: 'INFO', message: 'Starting server', service: SERVICE_NAME, port }));
+  });
+
+  // Graceful shutdown
+  const shutdown = () => {
+    console.log(JSON.stringify({ severity: 'INFO', message: 'Shutting down server...' }));
+    server.close(() => process.exit(0));
+    setTimeout(() => process.exit(1), 30000).unref();
+  };
+  process.on('SIGTERM', shutdown);
+  process.on('SIGINT', shutdown);
+}
+
+main().catch((err) => {
+  console.error(JSON.stringify({ severity: 'CRITICAL', message: 'Failed to start service', error: String(err) }));
+  process.exit(1);
+});
+`
+
+const dockerfileTemplate = `# Multi-stage Dockerfile for {{.ServiceName}} service
+# Generated by Box build system
+
+# Stage 1: Build
+FROM node:20-alpine AS builder
+
+WORKDIR /workspace
+
+# Copy the project; the handler sources are compiled into the service
+COPY . .
+
+# Install the project's dependencies, which the handlers import
+RUN if [ -f package-lock.json ]; then npm ci; elif [ -f package.json ]; then npm install; fi && mkdir -p node_modules
+
+# Install the service's dependencies and compile
+WORKDIR /workspace/build/containers/{{.ServiceName}}
+RUN npm install && npm run build && npm prune --omit=dev
+
+# Keep only the project's runtime dependencies
+WORKDIR /workspace
+RUN if [ -f package.json ]; then npm prune --omit=dev; fi
+
+# Stage 2: Runtime
+FROM node:20-alpine AS runner
+
+ENV NODE_ENV=production
+
+WORKDIR /app
+
+# Compiled handlers resolve the project's dependencies from dist/node_modules,
+# the server falls back to the service's own in node_modules
+COPY --from=builder /workspace/build/containers/{{.ServiceName}}/package.json ./
+COPY --from=builder /workspace/build/containers/{{.ServiceName}}/node_modules ./node_modules
+COPY --from=builder /workspace/build/containers/{{.ServiceName}}/dist ./dist
+COPY --from=builder /workspace/node_modules ./dist/node_modules
+
+# Use non-root user
+USER node
+
+# Expose port
+EXPOSE 8080
+
+# Health check
+HEALTHCHECK --interval=30s --timeout=3s --start-period=5s --retries=3 \
+    CMD wget --no-verbose --tries=1 --spider http://localhost:8080{{.HealthPath}} || exit 1
+
+# Run the service
+CMD ["node", "dist/build/containers/{{.ServiceName}}/index.js"]
+`
+
+const cloudBuildTemplate = `# Cloud Build configuration for {{.ServiceName}}
+# Generated by Box build system
+
+steps:
+  # Build the container image
+  - name: 'gcr.io/cloud-builders/docker'
+    args:
+      - 'build'
+      - '-t'
+      - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:$SHORT_SHA'
+      - '-t'
+      - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:latest'
+      - '-f'
+      - './build/containers/{{.ServiceName}}/Dockerfile'
+      - '.'
+
+  # Push the container image
+  - name: 'gcr.io/cloud-builders/docker'
+    args:
+      - 'push'
+      - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:$SHORT_SHA'
+
+  - name: 'gcr.io/cloud-builders/docker'
+    args:
+      - 'push'
+      - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:latest'
+
+  # Deploy to Cloud Run
+  - name: 'gcr.io/google.com/cloudsdktool/cloud-sdk'
+    entrypoint: gcloud
+    args:
+      - 'run'
+      - 'deploy'
+      - '{{.ServiceName}}'
+      - '--image=gcr.io/$PROJECT_ID/{{.ServiceName}}:$SHORT_SHA'
+      - '--region={{.Region}}'
+      - '--platform=managed'
+      - '--allow-unauthenticated'
+      - '--set-env-vars=DATABASE_URL=$$DATABASE_URL'
+    secretEnv: ['DATABASE_URL']
+
+availableSecrets:
+  secretManager:
+    - versionName: projects/$PROJECT_ID/secrets/database-url/versions/latest
+      env: 'DATABASE_URL'
+
+images:
+  - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:$SHORT_SHA'
+  - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:latest'
+
+options:
+  machineType: 'N1_HIGHCPU_8'
+  logging: CLOUD_LOGGING_ONLY
+`
+
+const deployScriptTemplate = `#!/bin/bash
+# Deploy script for {{.ServiceName}} container
+# Generated by Box build system
+
+set -e
+
+# Configuration
+SERVICE_NAME="{{.ServiceName}}"
+REGION="{{.Region}}"
+
+# Get project ID
+PROJECT_ID=$(gcloud config get-value project)
+
+if [ -z "$PROJECT_ID" ]; then
+    echo "Error: GCP project not set. Run: gcloud config set project PROJECT_ID"
+    exit 1
+fi
+
+echo "Deploying container service: $SERVICE_NAME to project: $PROJECT_ID"
+
+# Submit build to Cloud Build
+gcloud builds submit \
+    --config=cloudbuild.yaml \
+    --substitutions=SHORT_SHA=$(git rev-parse --short HEAD) \
+    ../../..
+
+echo "Service deployed successfully!"
+echo "URL: $(gcloud run services describe $SERVICE_NAME --region=$REGION --format='value(status.url)')"
+`
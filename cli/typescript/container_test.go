@@ -0,0 +1,214 @@
+package typescript
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const usersSource = `import { Request, Response } from 'express';
+
+// @box:container
+// @box:path GET /users/{id}
+export async function getUser(req: Request, res: Response) {}
+
+// @box:container
+// @box:path POST /users
+export async function createUser(req: Request, res: Response) {}
+`
+
+const billingSource = `// @box:container
+// @box:path GET /invoices
+export const listInvoices = async (req, res) => {};
+
+// @box:function
+// @box:path GET /status
+export async function status(req, res) {}
+`
+
+func TestContainerGenerator_GroupsHandlersByPackage(t *testing.T) {
+	projectDir := t.TempDir()
+	for path, source := range map[string]string{
+		"handlers/users/users.ts":     usersSource,
+		"handlers/billing/billing.ts": billingSource,
+	} {
+		full := filepath.Join(projectDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parsed, err := NewParser().ParseDirectory(filepath.Join(projectDir, "handlers"))
+	if err != nil {
+		t.Fatalf("ParseDirectory() error = %v", err)
+	}
+	if len(parsed.Errors) > 0 {
+		t.Fatalf("unexpected parse errors: %v", parsed.Errors)
+	}
+
+	outputDir := filepath.Join(projectDir, "build")
+	generator := NewGenerator(parsed.Handlers, outputDir, "example", "test-project", "europe-west1", "dev", false, zap.NewNop())
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(outputDir, "containers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var services []string
+	for _, entry := range entries {
+		services = append(services, entry.Name())
+	}
+	if strings.Join(services, ",") != "billing,users" {
+		t.Fatalf("services = %v, want [billing users]", services)
+	}
+
+	serviceDir := filepath.Join(outputDir, "containers", "users")
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(serviceDir, name))
+		if err != nil {
+			t.Fatalf("%s not generated: %v", name, err)
+		}
+		return string(content)
+	}
+
+	t.Run("index.ts", func(t *testing.T) {
+		index := read("index.ts")
+		for _, want := range []string{
+			"import express, { NextFunction, Request, RequestHandler, Response } from 'express';",
+			"import { createUser, getUser } from '../../../handlers/users/users';",
+			"app.get('/users/:id', deployed('getUser', getUser));",
+			"app.post('/users', deployed('createUser', createUser));",
+			"app.get('/health', ",
+			"const project = process.env.GOOGLE_CLOUD_PROJECT || 'test-project';",
+		} {
+			if !strings.Contains(index, want) {
+				t.Errorf("index.ts missing %q:\n%s", want, index)
+			}
+		}
+		if strings.Contains(index, "listInvoices") {
+			t.Error("index.ts registers a handler from another package")
+		}
+	})
+
+	t.Run("package.json", func(t *testing.T) {
+		var pkg struct {
+			Name         string            `json:"name"`
+			Scripts      map[string]string `json:"scripts"`
+			Dependencies map[string]string `json:"dependencies"`
+		}
+		if err := json.Unmarshal([]byte(read("package.json")), &pkg); err != nil {
+			t.Fatalf("package.json is not valid JSON: %v", err)
+		}
+		if pkg.Name != "users" {
+			t.Errorf("name = %q, want users", pkg.Name)
+		}
+		for _, dep := range []string{"express", "@google-cloud/secret-manager", "typescript"} {
+			if pkg.Dependencies[dep] == "" {
+				t.Errorf("missing dependency %s", dep)
+			}
+		}
+		if pkg.Scripts["start"] != "node dist/build/containers/users/index.js" {
+			t.Errorf("start script = %q", pkg.Scripts["start"])
+		}
+	})
+
+	t.Run("Dockerfile", func(t *testing.T) {
+		dockerfile := read("Dockerfile")
+		for _, want := range []string{
+			"FROM node:20-alpine AS builder",
+			"FROM node:20-alpine AS runner",
+			"WORKDIR /workspace/build/containers/users",
+			"http://localhost:8080/health",
+			`CMD ["node", "dist/build/containers/users/index.js"]`,
+		} {
+			if !strings.Contains(dockerfile, want) {
+				t.Errorf("Dockerfile missing %q", want)
+			}
+		}
+	})
+
+	t.Run("cloudbuild.yaml", func(t *testing.T) {
+		cloudBuild := read("cloudbuild.yaml")
+		for _, want := range []string{
+			"'./build/containers/users/Dockerfile'",
+			"'--image=gcr.io/$PROJECT_ID/users:$SHORT_SHA'",
+			"'--region=europe-west1'",
+		} {
+			if !strings.Contains(cloudBuild, want) {
+				t.Errorf("cloudbuild.yaml missing %q", want)
+			}
+		}
+	})
+
+	t.Run("deploy.sh", func(t *testing.T) {
+		script := read("deploy.sh")
+		if !strings.Contains(script, `SERVICE_NAME="users"`) || !strings.Contains(script, "--config=cloudbuild.yaml") {
+			t.Errorf("unexpected deploy.sh:\n%s", script)
+		}
+		info, err := os.Stat(filepath.Join(serviceDir, "deploy.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Error("deploy.sh is not executable")
+		}
+	})
+
+	t.Run("functions unaffected", func(t *testing.T) {
+		if _, err := os.Stat(filepath.Join(outputDir, "functions", "status", "index.js")); err != nil {
+			t.Errorf("function not generated: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, "containers", "status")); !os.IsNotExist(err) {
+			t.Error("function handler generated as a container")
+		}
+	})
+}
+
+func TestContainerGenerator_HealthOverride(t *testing.T) {
+	dir := t.TempDir()
+	source := "// @box:container\n// @box:path GET /health\nexport async function health(req, res) {}\n"
+	if err := os.WriteFile(filepath.Join(dir, "ops.ts"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewParser().ParseFile(filepath.Join(dir, "ops.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if err := NewContainerGenerator(parsed.Handlers, outputDir, "", "", zap.NewNop()).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, filepath.Base(dir), "index.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := string(content)
+	if strings.Count(index, "app.get('/health'") != 1 || !strings.Contains(index, "deployed('health', health)") {
+		t.Errorf("the handler should replace the built-in health endpoint:\n%s", index)
+	}
+}
+
+func TestExpressPath(t *testing.T) {
+	tests := map[string]string{
+		"/users":                     "/users",
+		"/users/{id}":                "/users/:id",
+		"/orgs/{orgId}/members/{id}": "/orgs/:orgId/members/:id",
+	}
+	for path, want := range tests {
+		if got := expressPath(path); got != want {
+			t.Errorf("expressPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
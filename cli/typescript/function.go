@@ -138,15 +138,21 @@ func (g *FunctionGenerator) generateIndexJs(dir string, handler annotations.Hand
 		if len(handler.CORS.AllowedOrigins) > 0 && handler.CORS.AllowedOrigins[0] != "*" {
 			originsJSON, _ := json.Marshal(handler.CORS.AllowedOrigins)
 			origins = string(originsJSON)
+		} else if handler.CORS.AllowCredentials {
+			// Reflect the request origin; browsers reject credentialed responses that allow "*"
+			origins = "true"
 		}
+		exposedJSON, _ := json.Marshal(handler.CORS.EffectiveExposedHeaders())
 		sb.WriteString(fmt.Sprintf(`const corsMiddleware = cors({
   origin: %s,
   methods: ['GET', 'POST', 'PUT', 'DELETE', 'PATCH', 'OPTIONS'],
   allowedHeaders: ['Content-Type', 'Authorization'],
-  credentials: false
+  exposedHeaders: %s,
+  maxAge: %d,
+  credentials: %t
 });
 
-`, origins))
+`, origins, exposedJSON, handler.CORS.EffectiveMaxAge(), handler.CORS.AllowCredentials))
 	}
 
 	// Rate limit configuration
@@ -265,16 +271,5 @@ node_modules/
 
 // getFunctionName generates a function name from handler
 func (g *FunctionGenerator) getFunctionName(handler annotations.Handler) string {
-	// Convert CamelCase to kebab-case
-	name := handler.FunctionName
-	var result strings.Builder
-
-	for i, r := range name {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result.WriteRune('-')
-		}
-		result.WriteRune(r)
-	}
-
-	return strings.ToLower(result.String())
+	return toKebabCase(handler.FunctionName)
 }
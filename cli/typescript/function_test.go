@@ -0,0 +1,62 @@
+package typescript
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFunctionGenerator_CORSCredentials(t *testing.T) {
+	dir := t.TempDir()
+	source := `// @box:function
+// @box:path GET /session
+// @box:cors origins=https://app.example.com credentials=true
+export async function getSession(req, res) {}
+
+// @box:function
+// @box:path GET /public
+// @box:cors origins=* credentials=true
+export async function getPublic(req, res) {}
+
+// @box:function
+// @box:path GET /status
+// @box:cors origins=*
+export async function getStatus(req, res) {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "session.ts"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewParser().ParseFile(filepath.Join(dir, "session.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if err := NewFunctionGenerator(parsed.Handlers, outputDir, "", zap.NewNop()).Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"get-session", []string{`origin: ["https://app.example.com"]`, "credentials: true"}},
+		{"get-public", []string{"origin: true", "credentials: true"}},
+		{"get-status", []string{"origin: ['*']", "credentials: false"}},
+	}
+
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join(outputDir, tt.function, "index.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s/index.js missing %q:\n%s", tt.function, want, content)
+			}
+		}
+	}
+}
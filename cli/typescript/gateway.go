@@ -0,0 +1,22 @@
+package typescript
+
+import (
+	"github.com/gravelight-studio/box/go/build"
+)
+
+// GatewayGenerator generates the API Gateway configuration for TypeScript handlers
+// The OpenAPI spec comes from the Go build's gateway generator, so a handler documents the
+// same operation whichever language it is written in
+type GatewayGenerator struct {
+	generator *build.Generator
+}
+
+// NewGatewayGenerator creates a new gateway generator around a build generator
+func NewGatewayGenerator(generator *build.Generator) *GatewayGenerator {
+	return &GatewayGenerator{generator: generator}
+}
+
+// Generate writes gateway/openapi.yaml and the gateway deploy script
+func (g *GatewayGenerator) Generate() error {
+	return g.generator.GenerateGateway()
+}
@@ -4,34 +4,55 @@ import (
 	"fmt"
 
 	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/build"
 	"go.uber.org/zap"
 )
 
 // Generator orchestrates all TypeScript artifact generation
 type Generator struct {
-	handlers          []annotations.Handler
-	outputDir         string
-	moduleName        string
-	projectID         string
-	region            string
-	environment       string
-	cleanBuildDir     bool
-	logger            *zap.Logger
-	functionGenerator *FunctionGenerator
+	handlers           []annotations.Handler
+	outputDir          string
+	moduleName         string
+	projectID          string
+	region             string
+	environment        string
+	cleanBuildDir      bool
+	logger             *zap.Logger
+	functionGenerator  *FunctionGenerator
+	containerGenerator *ContainerGenerator
+	gatewayGenerator   *GatewayGenerator
+	terraformGenerator *TerraformGenerator
 }
 
 // NewGenerator creates a new TypeScript generator
 func NewGenerator(handlers []annotations.Handler, outputDir, moduleName, projectID, region, environment string, cleanBuildDir bool, logger *zap.Logger) *Generator {
+	// The gateway and Terraform don't depend on the handler language, so the Go build renders them
+	// TypeScript body types aren't Go structs; @box:request/@box:response schemas are left out
+	shared := build.NewGenerator(build.Config{
+		Handlers:        handlers,
+		OutputDir:       outputDir,
+		ModuleName:      moduleName,
+		ProjectID:       projectID,
+		Region:          region,
+		Environment:     environment,
+		Logger:          logger,
+		SkipSchemas:     true,
+		FunctionRuntime: FunctionRuntime,
+	})
+
 	return &Generator{
-		handlers:          handlers,
-		outputDir:         outputDir,
-		moduleName:        moduleName,
-		projectID:         projectID,
-		region:            region,
-		environment:       environment,
-		cleanBuildDir:     cleanBuildDir,
-		logger:            logger,
-		functionGenerator: NewFunctionGenerator(handlers, outputDir+"/functions", moduleName, logger),
+		handlers:           handlers,
+		outputDir:          outputDir,
+		moduleName:         moduleName,
+		projectID:          projectID,
+		region:             region,
+		environment:        environment,
+		cleanBuildDir:      cleanBuildDir,
+		logger:             logger,
+		functionGenerator:  NewFunctionGenerator(handlers, outputDir+"/functions", moduleName, logger),
+		containerGenerator: NewContainerGenerator(handlers, outputDir+"/containers", projectID, region, logger),
+		gatewayGenerator:   NewGatewayGenerator(shared),
+		terraformGenerator: NewTerraformGenerator(shared),
 	}
 }
 
@@ -58,8 +79,23 @@ func (g *Generator) Generate() error {
 		return fmt.Errorf("failed to generate functions: %w", err)
 	}
 
-	// TODO: Generate Cloud Run containers, API Gateway, and Terraform
-	// For now, we're focusing on functions to get the CLI working
+	// Generate Cloud Run containers
+	g.logger.Info("Generating container services", zap.Int("handlers", containerCount))
+	if err := g.containerGenerator.Generate(); err != nil {
+		return fmt.Errorf("failed to generate containers: %w", err)
+	}
+
+	// Generate API Gateway configuration
+	g.logger.Info("Generating API Gateway configuration")
+	if err := g.gatewayGenerator.Generate(); err != nil {
+		return fmt.Errorf("failed to generate gateway: %w", err)
+	}
+
+	// Generate Terraform configuration
+	g.logger.Info("Generating Terraform configuration")
+	if err := g.terraformGenerator.Generate(); err != nil {
+		return fmt.Errorf("failed to generate terraform: %w", err)
+	}
 
 	g.logger.Info("TypeScript build generation complete",
 		zap.Int("functionsGenerated", functionCount),
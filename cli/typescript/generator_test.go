@@ -0,0 +1,122 @@
+package typescript
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"go.uber.org/zap"
+)
+
+const ordersSource = `import { Request, Response } from 'express';
+
+/**
+ * @summary List orders
+ * @box:function
+ * @box:path GET /orders
+ * @box:auth required
+ * @box:ratelimit 100/hour
+ */
+export async function listOrders(req: Request, res: Response) {}
+
+// @box:container
+// @box:path GET /orders/{id}
+export async function getOrder(req: Request, res: Response) {}
+
+// @box:container
+// @box:path POST /orders
+// @box:request {CreateOrderRequest}
+export async function createOrder(req: Request, res: Response) {}
+`
+
+func TestGenerator_GatewayAndTerraform(t *testing.T) {
+	projectDir := t.TempDir()
+	handlersDir := filepath.Join(projectDir, "handlers", "orders")
+	if err := os.MkdirAll(handlersDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(handlersDir, "orders.ts"), []byte(ordersSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := NewParser().ParseDirectory(filepath.Join(projectDir, "handlers"))
+	if err != nil {
+		t.Fatalf("ParseDirectory() error = %v", err)
+	}
+	if len(parsed.Errors) > 0 {
+		t.Fatalf("unexpected parse errors: %v", parsed.Errors)
+	}
+
+	outputDir := filepath.Join(projectDir, "build")
+	generator := NewGenerator(parsed.Handlers, outputDir, "example", "test-project", "europe-west1", "staging", false, zap.NewNop())
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	t.Run("openapi", func(t *testing.T) {
+		spec, err := openapi3.NewLoader().LoadFromFile(filepath.Join(outputDir, "gateway", "openapi.yaml"))
+		if err != nil {
+			t.Fatalf("gateway/openapi.yaml not loadable: %v", err)
+		}
+
+		list := spec.Paths.Find("/orders").Get
+		if list == nil || list.Summary != "List orders" || list.Security == nil {
+			t.Errorf("GET /orders not documented as an authenticated operation: %+v", list)
+		}
+		if spec.Paths.Find("/orders/{id}").Get == nil || spec.Paths.Find("/orders").Post == nil {
+			t.Error("container operations missing from the spec")
+		}
+		if create := spec.Paths.Find("/orders").Post; create != nil && create.RequestBody != nil {
+			t.Error("TypeScript body types should not be resolved as Go structs")
+		}
+	})
+
+	t.Run("terraform", func(t *testing.T) {
+		terraformDir := filepath.Join(outputDir, "terraform")
+		for _, path := range []string{
+			"main.tf",
+			"variables.tf",
+			"outputs.tf",
+			"environments/staging.tfvars",
+			"modules/cloud-functions",
+			"modules/cloud-run",
+			"modules/api-gateway",
+			"modules/networking",
+		} {
+			if _, err := os.Stat(filepath.Join(terraformDir, path)); err != nil {
+				t.Errorf("terraform/%s not generated: %v", path, err)
+			}
+		}
+
+		mainTf, err := os.ReadFile(filepath.Join(terraformDir, "main.tf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, module := range []string{`module "cloud_functions"`, `module "cloud_run"`, `module "api_gateway"`} {
+			if !strings.Contains(string(mainTf), module) {
+				t.Errorf("main.tf missing %s", module)
+			}
+		}
+
+		functionsTf, err := os.ReadFile(filepath.Join(terraformDir, "modules", "cloud-functions", "main.tf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(functionsTf), `runtime              = "nodejs20"`) {
+			t.Error("TypeScript functions should deploy on the nodejs20 runtime")
+		}
+		if !strings.Contains(string(functionsTf), `entry_point          = "listOrders"`) {
+			t.Error("function entry point should be the exported handler")
+		}
+
+		runTf, err := os.ReadFile(filepath.Join(terraformDir, "modules", "cloud-run", "main.tf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(runTf), `resource "google_cloud_run_service" "orders"`) {
+			t.Error("cloud-run module missing the orders service")
+		}
+	})
+}
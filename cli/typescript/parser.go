@@ -5,9 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/gravelight-studio/box/go/annotations"
 )
@@ -98,228 +97,184 @@ func (p *Parser) ParseFile(filePath string) (*annotations.ParsedAnnotations, err
 			}
 
 			// Look backwards for annotations
-			annotationData := p.extractAnnotationsAbove(lines, i)
-
-			// Only create handler if it has a deployment type
-			if annotationData["deploymentType"] != "" {
-				handler := p.buildHandler(functionName, filePath, annotationData, i+1)
-				if handler != nil {
-					result.Handlers = append(result.Handlers, *handler)
-				}
+			pairs := p.extractAnnotationsAbove(lines, i)
+			if len(pairs) == 0 {
+				continue
 			}
+
+			handler, errs := p.buildHandler(functionName, filePath, pairs, i+1)
+			if handler != nil {
+				result.Handlers = append(result.Handlers, *handler)
+			}
+			result.Errors = append(result.Errors, errs...)
 		}
 	}
 
 	return result, nil
 }
 
-// extractAnnotationsAbove looks backwards from a function declaration for @box: annotations
-func (p *Parser) extractAnnotationsAbove(lines []string, functionLineIndex int) map[string]string {
-	annotations := make(map[string]string)
+// annotationPair is a single @box:<key> <value> annotation in source order
+type annotationPair struct {
+	Key   string
+	Value string
+	Text  string // Annotation as written, for error reporting
+}
 
-	// Look backwards from function line
-	for i := functionLineIndex - 1; i >= 0; i-- {
-		line := strings.TrimSpace(lines[i])
+// annotationPattern matches a @box: annotation within a comment line
+var annotationPattern = regexp.MustCompile(regexp.QuoteMeta(annotations.Prefix) + `([\w-]+)\s*(.*)`)
 
-		// Stop at empty lines or non-comment lines
-		if line == "" || (!strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "*") && !strings.HasPrefix(line, "/*")) {
-			break
-		}
+// jsdocTagPattern matches a JSDoc tag at the start of a comment line
+var jsdocTagPattern = regexp.MustCompile(`^@(\w+)\b\s*(.*)`)
 
-		// Extract annotation
-		annotationPattern := regexp.MustCompile(`@box:(\w+)\s*(.*)`)
-		matches := annotationPattern.FindStringSubmatch(line)
-		if matches != nil {
-			key := matches[1]
-			value := strings.TrimSpace(matches[2])
-			p.parseAnnotation(key, value, annotations)
-		}
-	}
-
-	return annotations
+// jsdocAnnotations maps the JSDoc tags that populate handler fields to their @box: keys
+var jsdocAnnotations = map[string]string{
+	"summary":     annotations.KeySummary,
+	"description": annotations.KeyDescription,
 }
 
-// parseAnnotation parses a single annotation key-value pair
-func (p *Parser) parseAnnotation(key, value string, annotations map[string]string) {
-	switch key {
-	case "function":
-		annotations["deploymentType"] = "function"
+// jsdocTypeReference matches a JSDoc type reference such as {CreateUserRequest}, naming a
+// @typedef, interface or type alias
+var jsdocTypeReference = regexp.MustCompile(`^\{\s*([\w$]+)\s*\}$`)
 
-	case "container":
-		annotations["deploymentType"] = "container"
+// bodyTypeValue unwraps a JSDoc type reference in a @box:request or @box:response value,
+// so @box:request {CreateUserRequest} records CreateUserRequest as in Go
+func bodyTypeValue(key, value string) string {
+	if key != annotations.KeyRequest && key != annotations.KeyResponse {
+		return value
+	}
+	if matches := jsdocTypeReference.FindStringSubmatch(value); matches != nil {
+		return matches[1]
+	}
+	return value
+}
 
-	case "service":
-		annotations["service"] = value
+// extractAnnotationsAbove collects @box: annotations from the comment block above a function declaration
+// The block may mix // lines, /** ... */ JSDoc and blank lines; description lines are ignored and
+// the scan stops at the first line of code. Annotations are returned in source order so repeated
+// annotations apply as in Go
+func (p *Parser) extractAnnotationsAbove(lines []string, functionLineIndex int) []annotationPair {
+	var comment []string
+	inBlock := false // inside a /* ... */ comment (scanning upwards)
 
-	case "path":
-		pathPattern := regexp.MustCompile(`(\w+)\s+(.+)`)
-		matches := pathPattern.FindStringSubmatch(value)
-		if matches != nil {
-			annotations["method"] = strings.ToUpper(matches[1])
-			annotations["path"] = matches[2]
-		}
-
-	case "auth":
-		annotations["auth"] = value
+scan:
+	for i := functionLineIndex - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
 
-	case "cors":
-		if strings.Contains(value, "origins=") {
-			originsPattern := regexp.MustCompile(`origins=(.+)`)
-			matches := originsPattern.FindStringSubmatch(value)
-			if matches != nil {
-				annotations["corsOrigins"] = matches[1]
+		switch {
+		case inBlock:
+			// Every line up to the opening /* belongs to the block comment
+			if strings.Contains(line, "/*") {
+				inBlock = false
 			}
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "//"):
+		case strings.HasSuffix(line, "*/"):
+			// Closing line of a block comment, unless it opens on the same line
+			inBlock = !strings.HasPrefix(line, "/*")
+		default:
+			break scan // reached code
 		}
 
-	case "ratelimit":
-		rateLimitPattern := regexp.MustCompile(`(\d+)\s*(?:requests?)?/?(second|minute|hour|day)`)
-		matches := rateLimitPattern.FindStringSubmatch(value)
-		if matches != nil {
-			annotations["rateLimitRequests"] = matches[1]
-			annotations["rateLimitPeriod"] = matches[2]
-		}
+		comment = append(comment, line)
+	}
 
-	case "timeout":
-		timeoutPattern := regexp.MustCompile(`(\d+)(s|m|h)`)
-		matches := timeoutPattern.FindStringSubmatch(value)
-		if matches != nil {
-			duration, _ := strconv.Atoi(matches[1])
-			unit := matches[2]
-			ms := p.durationToMs(duration, unit)
-			annotations["timeout"] = fmt.Sprintf("%d", ms)
+	slices.Reverse(comment)
+	return collectAnnotations(comment)
+}
+
+// collectAnnotations extracts annotation pairs from comment lines in source order
+// JSDoc @summary and @description tags count as the matching @box: annotations. A multi-line
+// value continues until the next annotation or JSDoc tag, as in the Go parser
+func collectAnnotations(comment []string) []annotationPair {
+	var pairs []annotationPair
+	var pending *annotationPair
+	var pendingLines []string
+
+	flush := func() {
+		if pending != nil {
+			pending.Value = annotations.JoinMultilineValue(pendingLines)
+			pairs = append(pairs, *pending)
+			pending, pendingLines = nil, nil
+		}
+	}
+	add := func(pair annotationPair) {
+		flush()
+		if annotations.MultilineAnnotation(pair.Key) {
+			pending, pendingLines = &pair, []string{pair.Value}
+			return
 		}
+		pairs = append(pairs, pair)
+	}
 
-	case "memory":
-		memoryPattern := regexp.MustCompile(`(\d+)MB`)
-		matches := memoryPattern.FindStringSubmatch(value)
-		if matches != nil {
-			annotations["memory"] = matches[1]
+	for _, line := range comment {
+		if matches := annotationPattern.FindStringSubmatch(line); matches != nil {
+			value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(matches[2]), "*/"))
+			add(annotationPair{
+				Key:   matches[1],
+				Value: bodyTypeValue(matches[1], value),
+				Text:  strings.TrimSpace(matches[0]),
+			})
+			continue
 		}
 
-	case "concurrency":
-		annotations["concurrency"] = value
-	}
-}
+		text := commentText(line)
+		if matches := jsdocTagPattern.FindStringSubmatch(text); matches != nil {
+			if key, ok := jsdocAnnotations[matches[1]]; ok {
+				add(annotationPair{Key: key, Value: matches[2], Text: text})
+			} else {
+				flush() // @param, @returns and other tags end a description
+			}
+			continue
+		}
 
-// buildHandler constructs a Handler from parsed annotations
-func (p *Parser) buildHandler(functionName, filePath string, annotationData map[string]string, lineNumber int) *annotations.Handler {
-	// Must have a path
-	if annotationData["path"] == "" {
-		return nil
+		if pending != nil {
+			pendingLines = append(pendingLines, text)
+		}
 	}
+	flush()
 
-	// Parse deployment type
-	var deploymentType annotations.DeploymentType
-	switch annotationData["deploymentType"] {
-	case "function":
-		deploymentType = annotations.DeploymentFunction
-	case "container":
-		deploymentType = annotations.DeploymentContainer
-	default:
-		return nil
-	}
+	return pairs
+}
 
-	// Parse auth type
-	authType := annotations.AuthNone
-	switch annotationData["auth"] {
-	case "optional":
-		authType = annotations.AuthOptional
-	case "required":
-		authType = annotations.AuthRequired
-	}
+// commentText strips comment markers, including the leading * of block comment lines
+func commentText(line string) string {
+	text := strings.TrimPrefix(line, "//")
+	text = strings.TrimPrefix(text, "/*")
+	text = strings.TrimSuffix(text, "*/")
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "*") // also the second * of a /** opening
+	return strings.TrimSpace(text)
+}
 
-	// Build handler
+// buildHandler applies the extracted annotations to a new Handler
+// Declarations without a deployment type or path are not handlers and are skipped
+func (p *Parser) buildHandler(functionName, filePath string, pairs []annotationPair, lineNumber int) (*annotations.Handler, []annotations.ParseError) {
 	handler := &annotations.Handler{
-		PackageName:    filepath.Base(filepath.Dir(filePath)),
-		FunctionName:   functionName,
-		FilePath:       filePath,
-		LineNumber:     lineNumber,
-		DeploymentType: deploymentType,
-		Route: annotations.Route{
-			Method: annotationData["method"],
-			Path:   annotationData["path"],
-		},
+		PackageName:  filepath.Base(filepath.Dir(filePath)),
+		FunctionName: functionName,
+		FilePath:     filePath,
+		LineNumber:   lineNumber,
 		Auth: annotations.AuthConfig{
-			Type: authType,
+			Type: annotations.AuthNone,
 		},
 	}
 
-	// Add service name for containers
-	if serviceName := annotationData["service"]; serviceName != "" {
-		handler.ServiceName = serviceName
-	}
-
-	// Add CORS if specified
-	if corsOrigins := annotationData["corsOrigins"]; corsOrigins != "" {
-		origins := strings.Split(corsOrigins, ",")
-		for i := range origins {
-			origins[i] = strings.TrimSpace(origins[i])
-		}
-		handler.CORS = &annotations.CORSConfig{
-			AllowedOrigins: origins,
-			Raw:            corsOrigins,
-		}
-	}
-
-	// Add rate limit if specified
-	if requests := annotationData["rateLimitRequests"]; requests != "" {
-		reqCount, _ := strconv.Atoi(requests)
-		period := annotationData["rateLimitPeriod"]
-		periodDuration := p.periodToDuration(period)
-
-		handler.RateLimit = &annotations.RateLimitConfig{
-			Count:  reqCount,
-			Period: periodDuration,
-			Raw:    fmt.Sprintf("%s/%s", requests, period),
+	var errs []annotations.ParseError
+	for _, pair := range pairs {
+		if err := annotations.ApplyAnnotation(handler, pair.Key, pair.Value); err != nil {
+			errs = append(errs, annotations.ParseError{
+				FilePath:   filePath,
+				LineNumber: lineNumber,
+				Message:    err.Error(),
+				Annotation: pair.Text,
+			})
 		}
 	}
 
-	// Add timeout if specified
-	if timeout := annotationData["timeout"]; timeout != "" {
-		timeoutMs, _ := strconv.Atoi(timeout)
-		handler.Timeout = time.Duration(timeoutMs) * time.Millisecond
-	}
-
-	// Add memory if specified
-	if memory := annotationData["memory"]; memory != "" {
-		handler.Memory = memory + "MB"
-	}
-
-	// Add concurrency if specified
-	if concurrency := annotationData["concurrency"]; concurrency != "" {
-		maxConcurrency, _ := strconv.Atoi(concurrency)
-		handler.Concurrency = maxConcurrency
+	if handler.DeploymentType == "" || handler.Route.Path == "" {
+		return nil, errs
 	}
 
-	return handler
-}
-
-// periodToDuration converts a period string to time.Duration
-func (p *Parser) periodToDuration(period string) time.Duration {
-	switch period {
-	case "second":
-		return time.Second
-	case "minute":
-		return time.Minute
-	case "hour":
-		return time.Hour
-	case "day":
-		return 24 * time.Hour
-	default:
-		return time.Second
-	}
-}
-
-// durationToMs converts a duration value and unit to milliseconds
-func (p *Parser) durationToMs(value int, unit string) int {
-	switch unit {
-	case "s":
-		return value * 1000
-	case "m":
-		return value * 60 * 1000
-	case "h":
-		return value * 60 * 60 * 1000
-	default:
-		return value * 1000
-	}
+	return handler, errs
 }
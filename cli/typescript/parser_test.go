@@ -0,0 +1,268 @@
+package typescript
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// parseBoth parses the same annotation lines as a Go and as a TypeScript handler
+func parseBoth(t *testing.T, annotationLines string) (goHandler, tsHandler annotations.Handler) {
+	t.Helper()
+	dir := t.TempDir()
+
+	goSource := fmt.Sprintf("package handlers\n\n%s\nfunc Handler(w http.ResponseWriter, r *http.Request) {}\n", annotationLines)
+	tsSource := fmt.Sprintf("%s\nexport async function Handler(req: Request, res: Response) {}\n", annotationLines)
+
+	goFile := filepath.Join(dir, "handler.go")
+	tsFile := filepath.Join(dir, "handler.ts")
+	if err := os.WriteFile(goFile, []byte(goSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tsFile, []byte(tsSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	goResult, err := annotations.NewParser().ParseFile(goFile)
+	if err != nil {
+		t.Fatalf("Go ParseFile() error = %v", err)
+	}
+	tsResult, err := NewParser().ParseFile(tsFile)
+	if err != nil {
+		t.Fatalf("TS ParseFile() error = %v", err)
+	}
+
+	if len(goResult.Handlers) != 1 || len(tsResult.Handlers) != 1 {
+		t.Fatalf("expected one handler from each parser, got Go=%d TS=%d", len(goResult.Handlers), len(tsResult.Handlers))
+	}
+	return goResult.Handlers[0], tsResult.Handlers[0]
+}
+
+func TestParseTimeout_MatchesGoParser(t *testing.T) {
+	for _, value := range []string{"30s", "2m", "1h", "1h30m", "90sec", "5min"} {
+		t.Run(value, func(t *testing.T) {
+			goHandler, tsHandler := parseBoth(t, "// @box:function\n// @box:path GET /test\n// @box:timeout "+value)
+
+			if goHandler.Timeout == 0 {
+				t.Fatalf("Go parser did not set a timeout for %q", value)
+			}
+			if tsHandler.Timeout != goHandler.Timeout {
+				t.Errorf("TS timeout = %v, Go timeout = %v", tsHandler.Timeout, goHandler.Timeout)
+			}
+		})
+	}
+}
+
+func TestParseQuotedValues_MatchesGoParser(t *testing.T) {
+	goHandler, tsHandler := parseBoth(t, "// @box:container\n// @box:path\tGET /test\n// @box:service \"billing\"\n// @box:response 404 \"Not found: no such user\"")
+
+	if goHandler.ServiceName != "billing" || goHandler.Route.Path != "/test" {
+		t.Fatalf("Go parser did not unquote values: service %q, path %q", goHandler.ServiceName, goHandler.Route.Path)
+	}
+	if tsHandler.ServiceName != goHandler.ServiceName || tsHandler.Route != goHandler.Route ||
+		!reflect.DeepEqual(tsHandler.Responses, goHandler.Responses) {
+		t.Errorf("TS handler = %+v, Go handler = %+v", tsHandler, goHandler)
+	}
+}
+
+func TestParseRateLimit_MatchesGoParser(t *testing.T) {
+	for _, value := range []string{"100/hour", "60/minute", "10/s", "100 requests/hour", "1 request/day", "5 req per second"} {
+		t.Run(value, func(t *testing.T) {
+			goHandler, tsHandler := parseBoth(t, "// @box:function\n// @box:path GET /test\n// @box:ratelimit "+value)
+
+			if goHandler.RateLimit == nil || tsHandler.RateLimit == nil {
+				t.Fatalf("rate limit not parsed: Go=%v TS=%v", goHandler.RateLimit, tsHandler.RateLimit)
+			}
+			if *tsHandler.RateLimit != *goHandler.RateLimit {
+				t.Errorf("TS rate limit = %+v, Go rate limit = %+v", *tsHandler.RateLimit, *goHandler.RateLimit)
+			}
+		})
+	}
+
+	// Both languages reject the same malformed values
+	goHandler, tsHandler := parseBoth(t, "// @box:function\n// @box:path GET /test\n// @box:ratelimit 100 requests")
+	if goHandler.RateLimit != nil || tsHandler.RateLimit != nil {
+		t.Errorf("expected no rate limit for malformed value: Go=%v TS=%v", goHandler.RateLimit, tsHandler.RateLimit)
+	}
+}
+
+func TestParseFile_MatchesGoParser(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations string
+	}{
+		{
+			name:        "function",
+			annotations: "// @box:function\n// @box:path POST /users/{id}\n// @box:auth required\n// @box:memory 512MB\n// @box:concurrency 40",
+		},
+		{
+			name:        "container with service",
+			annotations: "// @box:container service=realtime\n// @box:path get /events\n// @box:timeout 5min",
+		},
+		{
+			name:        "service annotation",
+			annotations: "// @box:container\n// @box:service realtime\n// @box:path GET /stream",
+		},
+		{
+			name:        "cors and documentation",
+			annotations: "// @box:function\n// @box:path GET /users\n// @box:cors origins=https://a.com, https://b.com max-age=600 expose=X-Total-Count,Link\n// @box:tags users,public\n// @box:paginated\n// @box:maintainable",
+		},
+		{
+			name:        "repeated preload",
+			annotations: "// @box:function\n// @box:path GET /\n// @box:preload /static/app.css\n// @box:preload /static/app.js",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goHandler, tsHandler := parseBoth(t, tt.annotations)
+
+			// Location fields differ by language; everything derived from annotations must match
+			for _, h := range []*annotations.Handler{&goHandler, &tsHandler} {
+				h.FilePath, h.LineNumber, h.PackageName, h.PackagePath = "", 0, "", ""
+			}
+
+			if !reflect.DeepEqual(goHandler, tsHandler) {
+				t.Errorf("handlers differ\nGo: %+v\nTS: %+v", goHandler, tsHandler)
+			}
+		})
+	}
+}
+
+func TestParseFile_ReportsSameErrorsAsGoParser(t *testing.T) {
+	dir := t.TempDir()
+	annotationLines := "// @box:function\n// @box:path GET /test\n// @box:auth sometimes\n// @box:concurrency lots\n// @box:unknown"
+
+	goFile := filepath.Join(dir, "handler.go")
+	tsFile := filepath.Join(dir, "handler.ts")
+	if err := os.WriteFile(goFile, []byte("package handlers\n\n"+annotationLines+"\nfunc Handler() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tsFile, []byte(annotationLines+"\nexport function handler() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	goResult, err := annotations.NewParser().ParseFile(goFile)
+	if err != nil {
+		t.Fatalf("Go ParseFile() error = %v", err)
+	}
+	tsResult, err := NewParser().ParseFile(tsFile)
+	if err != nil {
+		t.Fatalf("TS ParseFile() error = %v", err)
+	}
+
+	if len(goResult.Errors) != 3 || len(tsResult.Errors) != len(goResult.Errors) {
+		t.Fatalf("expected 3 errors from each parser, got Go=%v TS=%v", goResult.Errors, tsResult.Errors)
+	}
+	for i := range goResult.Errors {
+		if tsResult.Errors[i].Message != goResult.Errors[i].Message {
+			t.Errorf("error %d: TS = %q, Go = %q", i, tsResult.Errors[i].Message, goResult.Errors[i].Message)
+		}
+	}
+}
+
+func TestParseFile_JSDocBlocks(t *testing.T) {
+	result, err := NewParser().ParseFile(filepath.Join("testdata", "jsdoc", "users.ts"))
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected parse errors: %v", result.Errors)
+	}
+
+	handlers := make(map[string]annotations.Handler)
+	for _, handler := range result.Handlers {
+		handlers[handler.FunctionName] = handler
+	}
+	if len(handlers) != 3 {
+		t.Fatalf("expected 3 handlers, got %d: %v", len(handlers), result.Handlers)
+	}
+
+	tests := []struct {
+		function       string
+		deploymentType annotations.DeploymentType
+		route          annotations.Route
+		auth           annotations.AuthType
+		serviceName    string
+	}{
+		{
+			function:       "listUsers",
+			deploymentType: annotations.DeploymentFunction,
+			route:          annotations.Route{Method: "GET", Path: "/users"},
+			auth:           annotations.AuthRequired,
+		},
+		{
+			function:       "deleteUser",
+			deploymentType: annotations.DeploymentFunction,
+			route:          annotations.Route{Method: "DELETE", Path: "/users/{id}"},
+			auth:           annotations.AuthNone,
+		},
+		{
+			function:       "createUser",
+			deploymentType: annotations.DeploymentContainer,
+			route:          annotations.Route{Method: "POST", Path: "/users"},
+			auth:           annotations.AuthNone,
+			serviceName:    "accounts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			handler, ok := handlers[tt.function]
+			if !ok {
+				t.Fatalf("handler %s not detected", tt.function)
+			}
+			if handler.DeploymentType != tt.deploymentType {
+				t.Errorf("DeploymentType = %v, want %v", handler.DeploymentType, tt.deploymentType)
+			}
+			if handler.Route != tt.route {
+				t.Errorf("Route = %+v, want %+v", handler.Route, tt.route)
+			}
+			if handler.Auth.Type != tt.auth {
+				t.Errorf("Auth = %v, want %v", handler.Auth.Type, tt.auth)
+			}
+			if handler.ServiceName != tt.serviceName {
+				t.Errorf("ServiceName = %q, want %q", handler.ServiceName, tt.serviceName)
+			}
+		})
+	}
+
+	if timeout := handlers["createUser"].Timeout; timeout.String() != "30s" {
+		t.Errorf("createUser Timeout = %v, want 30s", timeout)
+	}
+
+	// JSDoc @summary and @description populate the OpenAPI docs; untagged prose does not
+	list := handlers["listUsers"]
+	if list.Summary != "List users" {
+		t.Errorf("listUsers Summary = %q, want %q", list.Summary, "List users")
+	}
+	if want := "Results are ordered by creation date,\nnewest first."; list.Description != want {
+		t.Errorf("listUsers Description = %q, want %q", list.Description, want)
+	}
+	if handlers["createUser"].Description != "" {
+		t.Errorf("createUser Description = %q, want none", handlers["createUser"].Description)
+	}
+
+	// JSDoc {Type} references name the @typedef documenting the body
+	if got := handlers["createUser"].RequestType; got != "CreateUserRequest" {
+		t.Errorf("createUser RequestType = %q, want %q", got, "CreateUserRequest")
+	}
+	if got := list.ResponseType; got != "User" {
+		t.Errorf("listUsers ResponseType = %q, want %q", got, "User")
+	}
+}
+
+func TestParseDescription_MatchesGoParser(t *testing.T) {
+	goHandler, tsHandler := parseBoth(t, "// @box:function\n// @box:path GET /test\n// @box:summary Fetch the test resource\n// @box:description Returns the resource.\n//\n// Cached for a minute.\n// @box:auth required")
+
+	if goHandler.Description != "Returns the resource.\n\nCached for a minute." || goHandler.Auth.Type != annotations.AuthRequired {
+		t.Fatalf("Go parser: Description %q, Auth %v", goHandler.Description, goHandler.Auth.Type)
+	}
+	if tsHandler.Summary != goHandler.Summary || tsHandler.Description != goHandler.Description || tsHandler.Auth != goHandler.Auth {
+		t.Errorf("TS handler = %+v, Go handler = %+v", tsHandler, goHandler)
+	}
+}
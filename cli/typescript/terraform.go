@@ -0,0 +1,25 @@
+package typescript
+
+import (
+	"github.com/gravelight-studio/box/go/build"
+)
+
+// FunctionRuntime is the Cloud Functions runtime of TypeScript functions
+const FunctionRuntime = "nodejs20"
+
+// TerraformGenerator generates the Terraform configuration for TypeScript handlers
+// The GCP infrastructure doesn't depend on the handler language, so the Go build's Terraform
+// generator renders it; only the Cloud Functions runtime differs
+type TerraformGenerator struct {
+	generator *build.Generator
+}
+
+// NewTerraformGenerator creates a new Terraform generator around a build generator
+func NewTerraformGenerator(generator *build.Generator) *TerraformGenerator {
+	return &TerraformGenerator{generator: generator}
+}
+
+// Generate writes the terraform/ root module, its modules and environment files
+func (g *TerraformGenerator) Generate() error {
+	return g.generator.GenerateTerraform()
+}
@@ -0,0 +1,48 @@
+import { Request, Response } from 'express';
+
+/**
+ * @typedef {Object} CreateUserRequest
+ * @property {string} email
+ * @property {string} [name]
+ */
+
+/**
+ * @typedef {Object} User
+ * @property {string} id
+ * @property {string} email
+ */
+
+/**
+ * Lists users visible to the caller.
+ *
+ * @summary List users
+ * @description Results are ordered by creation date,
+ * newest first.
+ * @box:function
+ * @box:path GET /users
+ * @param req - the incoming request
+ * @box:auth required
+ * @box:response {User}
+ * @returns a page of users
+ */
+export async function listUsers(req: Request, res: Response) {}
+
+/** @box:function */
+/** @box:path DELETE /users/{id} */
+export async function deleteUser(req: Request, res: Response) {}
+
+// Creates a user.
+// See the onboarding docs for the accepted fields.
+// @box:container service=accounts
+// @box:path POST /users
+// @box:request {CreateUserRequest}
+//
+// Validation happens in the service layer.
+// @box:timeout 30s
+
+export const createUser = async (req: Request, res: Response) => {};
+
+/**
+ * Not a handler: no @box annotations, just a mention of box in prose.
+ */
+export function formatUser(user: unknown) {}
@@ -0,0 +1,1176 @@
+package annotations
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyAnnotation interprets a single @box:<key> <value> annotation and records it on handler
+// Language parsers only extract (key, value) pairs; all per-key parsing and validation lives here
+// so the Go and TypeScript parsers produce identical handlers for the same annotations.
+// A value wrapped in double or single quotes is unquoted first
+func ApplyAnnotation(handler *Handler, key, value string) error {
+	value = unquoteValue(value)
+
+	switch key {
+	case KeyFunction:
+		handler.DeploymentType = DeploymentFunction
+
+	case KeyLambda:
+		handler.DeploymentType = DeploymentLambda
+
+	case KeyProxy:
+		if err := parseProxy(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.DeploymentType = DeploymentProxy
+
+	case KeyContainer:
+		handler.DeploymentType = DeploymentContainer
+		// Parse optional service=name parameter
+		if value != "" {
+			if err := parseContainerService(handler, value); err != nil {
+				return fmt.Errorf("Invalid %s annotation: %v", key, err)
+			}
+		}
+
+	case KeyService:
+		if value == "" {
+			return fmt.Errorf("Invalid %s annotation: service name cannot be empty", key)
+		}
+		handler.ServiceName = value
+
+	case KeyTaskQueue:
+		if err := parseTaskQueue(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeySchedule:
+		if err := parseSchedule(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyPubSub:
+		if err := parsePubSub(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyPath:
+		if err := parsePath(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyAuth:
+		if err := parseAuth(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.authAnnotated = true
+
+	case KeyRoles:
+		if err := parseRoles(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyRateLimit:
+		if err := parseRateLimit(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyCORS:
+		if err := parseCORS(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyCache:
+		config, err := ParseCache(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.Cache = config
+
+	case KeyCircuitBreaker:
+		if err := parseCircuitBreaker(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyRetry:
+		if err := parseRetry(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyIdempotent:
+		handler.Idempotent = true
+
+	case KeyTimeout:
+		if err := parseTimeout(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyMemory:
+		handler.Memory = value
+
+	case KeyCPUAlways:
+		handler.CPUAlways = true
+
+	case KeyCPUThrottled:
+		handler.CPUThrottled = true
+
+	case KeyConcurrency:
+		var concurrency int
+		if _, err := fmt.Sscanf(value, "%d", &concurrency); err != nil {
+			return fmt.Errorf("Invalid concurrency value: %s", value)
+		}
+		handler.Concurrency = concurrency
+
+	case KeyMinInstances:
+		instances, err := parseInstances(value, 0)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.MinInstances = instances
+
+	case KeyMaxInstances:
+		instances, err := parseInstances(value, 1)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.MaxInstances = instances
+
+	case KeySummary:
+		if value == "" {
+			return fmt.Errorf("Invalid %s annotation: summary cannot be empty", key)
+		}
+		handler.Summary = value
+
+	case KeyDescription:
+		if value == "" {
+			return fmt.Errorf("Invalid %s annotation: description cannot be empty", key)
+		}
+		handler.Description = value
+
+	case KeyTags:
+		if err := parseTags(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyMaintainable:
+		handler.Maintainable = true
+
+	case KeyGroup:
+		if err := parseGroup(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyTracing:
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: expected true or false, got: %q", key, value)
+		}
+		handler.TracingDisabled = !enabled
+
+	case KeyMetricsName:
+		name := strings.TrimSpace(value)
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("Invalid %s annotation: expected a single label value, got: %q", key, value)
+		}
+		handler.MetricsName = name
+
+	case KeyMiddleware:
+		if err := parseMiddleware(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyPaginated:
+		handler.Paginated = true
+
+	case KeyDeprecated:
+		handler.Deprecated = true
+		handler.DeprecationNote = value
+
+	case KeyRequest:
+		typeName, err := parseBodyType(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.RequestType = typeName
+
+	case KeyResponse:
+		// A leading status code documents a response; otherwise the value names the 200 body type
+		if value == "" || (value[0] >= '0' && value[0] <= '9') {
+			if err := parseResponse(handler, value); err != nil {
+				return fmt.Errorf("Invalid %s annotation: %v", key, err)
+			}
+			break
+		}
+		typeName, err := parseBodyType(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.ResponseType = typeName
+
+	case KeyRequestExample:
+		if value == "" {
+			return fmt.Errorf("Invalid %s annotation: example file cannot be empty", key)
+		}
+		handler.RequestExample = value
+
+	case KeyResponseExample:
+		if value == "" {
+			return fmt.Errorf("Invalid %s annotation: example file cannot be empty", key)
+		}
+		handler.ResponseExample = value
+
+	case KeyAllowIP:
+		networks, err := ParseIPNetworks(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.AllowIPs = append(handler.AllowIPs, networks...)
+
+	case KeyDenyIP:
+		networks, err := ParseIPNetworks(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+		handler.DenyIPs = append(handler.DenyIPs, networks...)
+
+	case KeyPreload:
+		if err := parsePreload(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyEnv:
+		if err := parseEnvVars(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeySecret:
+		if err := parseSecrets(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyIAMRole:
+		if err := parseIAMRoles(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	case KeyOpenAPIExt:
+		if err := parseOpenAPIExtension(handler, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation: %v", key, err)
+		}
+
+	default:
+		return fmt.Errorf("Unknown annotation type: %s", key)
+	}
+
+	return nil
+}
+
+// unquoteValue strips quotes around a whole annotation value: "Create a new account"
+// Double-quoted values may use Go escapes (\"); values that are not one quoted string are returned as is
+func unquoteValue(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	case value[0] == '\'' && value[len(value)-1] == '\'' && !strings.Contains(value[1:len(value)-1], "'"):
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+// parsePath parses @box:path METHOD /path/to/resource
+func parsePath(handler *Handler, value string) error {
+	parts := strings.SplitN(value, " ", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("path must be in format 'METHOD /path', got: %s", value)
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(parts[0]))
+	path := strings.TrimSpace(parts[1])
+
+	// Validate HTTP method
+	validMethods := map[string]bool{
+		"GET": true, "POST": true, "PUT": true, "DELETE": true,
+		"PATCH": true, "OPTIONS": true, "HEAD": true,
+	}
+	if !validMethods[method] {
+		return fmt.Errorf("invalid HTTP method: %s", method)
+	}
+
+	// Validate path starts with /
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path must start with /, got: %s", path)
+	}
+
+	handler.Route = Route{
+		Method: method,
+		Path:   path,
+	}
+
+	return nil
+}
+
+// parseAuth parses @box:auth required|optional|none
+// JWT options follow the type: issuer=URL audience=ID jwks=URL roles-claim=NAME strict
+func parseAuth(handler *Handler, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("auth must be 'required', 'optional', or 'none', got: %s", value)
+	}
+
+	config := AuthConfig{}
+	switch strings.ToLower(fields[0]) {
+	case "required":
+		config.Type = AuthRequired
+	case "optional":
+		config.Type = AuthOptional
+	case "none":
+		config.Type = AuthNone
+	default:
+		return fmt.Errorf("auth must be 'required', 'optional', or 'none', got: %s", fields[0])
+	}
+
+	for _, option := range fields[1:] {
+		if option == "strict" {
+			config.StrictJWKS = true
+			continue
+		}
+
+		key, val, _ := strings.Cut(option, "=")
+		if val == "" {
+			return fmt.Errorf("auth option %q needs a value (e.g., issuer=https://auth.example.com)", option)
+		}
+		switch key {
+		case "issuer":
+			config.Issuer = val
+		case "audience":
+			config.Audience = val
+		case "jwks":
+			if err := validateJWKSURL(val); err != nil {
+				return err
+			}
+			config.JWKSEndpoint = val
+		case "roles-claim":
+			config.RolesClaimKey = val
+		default:
+			return fmt.Errorf("unknown auth option %q (expected issuer, audience, jwks, roles-claim or strict)", key)
+		}
+	}
+
+	if len(fields) > 1 && config.Type == AuthNone {
+		return fmt.Errorf("auth none takes no options")
+	}
+
+	// Issuers publish their keys at the well-known JWKS path
+	if config.JWKSEndpoint == "" && config.Issuer != "" {
+		config.JWKSEndpoint = strings.TrimSuffix(config.Issuer, "/") + "/.well-known/jwks.json"
+		if err := validateJWKSURL(config.JWKSEndpoint); err != nil {
+			return err
+		}
+	}
+	if config.JWKSEndpoint == "" && (config.Audience != "" || config.StrictJWKS) {
+		return fmt.Errorf("audience and strict need issuer or jwks")
+	}
+
+	handler.Auth = config
+	return nil
+}
+
+// validateJWKSURL requires an absolute https URL (http only for localhost)
+func validateJWKSURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("jwks must be an absolute URL, got: %s", raw)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1")) {
+		return fmt.Errorf("jwks must use https, got: %s", raw)
+	}
+	return nil
+}
+
+// parseRateLimit parses @box:ratelimit 100/hour
+func parseRateLimit(handler *Handler, value string) error {
+	config, err := ParseRateLimit(value)
+	if err != nil {
+		return err
+	}
+
+	handler.RateLimit = config
+	return nil
+}
+
+// ParseRateLimit parses a @box:ratelimit value shared by the Go and TypeScript parsers
+// Accepts "100/hour", "100 requests/hour" and "100 requests per hour"
+func ParseRateLimit(value string) (*RateLimitConfig, error) {
+	countPart, periodPart, ok := strings.Cut(value, "/")
+	if !ok {
+		countPart, periodPart, ok = strings.Cut(value, " per ")
+	}
+	if !ok || strings.Contains(periodPart, "/") {
+		return nil, fmt.Errorf("ratelimit must be in format 'count/period', got: %s", value)
+	}
+
+	countPart = strings.TrimSpace(countPart)
+	for _, word := range []string{"requests", "request", "req"} {
+		if trimmed, found := strings.CutSuffix(countPart, word); found {
+			countPart = strings.TrimSpace(trimmed)
+			break
+		}
+	}
+
+	count, err := strconv.Atoi(countPart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid count in ratelimit: %s", countPart)
+	}
+
+	period := strings.ToLower(strings.TrimSpace(periodPart))
+	var duration time.Duration
+
+	switch period {
+	case "second", "sec", "s":
+		duration = time.Second
+	case "minute", "min", "m":
+		duration = time.Minute
+	case "hour", "hr", "h":
+		duration = time.Hour
+	case "day", "d":
+		duration = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("invalid period in ratelimit: %s (use second/minute/hour/day)", period)
+	}
+
+	return &RateLimitConfig{
+		Count:  count,
+		Period: duration,
+		Raw:    value,
+	}, nil
+}
+
+// parseCORS parses @box:cors origins=* max-age=600 expose=X-Total-Count,Link
+func parseCORS(handler *Handler, value string) error {
+	config, err := ParseCORS(value)
+	if err != nil {
+		return err
+	}
+
+	handler.CORS = config
+	return nil
+}
+
+// ParseCORS parses a @box:cors value into a CORSConfig
+// origins is required and must come first; max-age, expose and credentials are optional
+func ParseCORS(value string) (*CORSConfig, error) {
+	if !strings.HasPrefix(value, "origins=") {
+		return nil, fmt.Errorf("cors must be in format 'origins=*' or 'origins=url1,url2', got: %s", value)
+	}
+
+	config := &CORSConfig{Raw: value}
+
+	// Split into key=value options, rejoining list items separated by ", "
+	var options [][2]string
+	for _, field := range strings.Fields(value) {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok && len(options) > 0 {
+			options[len(options)-1][1] += field
+			continue
+		}
+		options = append(options, [2]string{key, val})
+	}
+
+	for _, option := range options {
+		key, val := option[0], option[1]
+		switch key {
+		case "origins":
+			if val == "*" {
+				config.AllowedOrigins = []string{"*"}
+			} else {
+				config.AllowedOrigins = splitList(val)
+			}
+		case "max-age":
+			maxAge, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("cors max-age must be a number of seconds, got: %s", val)
+			}
+			config.MaxAge = maxAge
+		case "expose":
+			config.ExposedHeaders = splitList(val)
+		case "credentials":
+			credentials, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("cors credentials must be true or false, got: %s", val)
+			}
+			config.AllowCredentials = credentials
+		default:
+			return nil, fmt.Errorf("unknown cors option %q (expected origins, max-age, expose or credentials)", key)
+		}
+	}
+
+	return config, nil
+}
+
+// MultilineAnnotation reports whether a key's value continues on the following comment
+// lines, up to the next annotation or the end of the comment block
+func MultilineAnnotation(key string) bool {
+	return key == KeyDescription
+}
+
+// JoinMultilineValue joins the lines of a multi-line annotation value, dropping leading
+// and trailing blank lines
+func JoinMultilineValue(lines []string) string {
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// splitList splits a comma-separated annotation value, trimming whitespace and dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseCache parses a @box:cache value such as "5m" or "5m vary=Accept-Language,Accept"
+// The TTL accepts the same syntax as @box:timeout
+func ParseCache(value string) (*CacheConfig, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("cache must be in format 'ttl [vary=Header1,Header2]', got: %q", value)
+	}
+
+	ttl, err := ParseTimeout(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache ttl: %v", err)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache ttl must be positive, got: %s", fields[0])
+	}
+
+	config := &CacheConfig{TTL: ttl, Raw: value}
+	for _, option := range fields[1:] {
+		key, val, _ := strings.Cut(option, "=")
+		if key != "vary" {
+			return nil, fmt.Errorf("unknown cache option %q (expected vary)", key)
+		}
+		for _, header := range splitList(val) {
+			config.VaryHeaders = append(config.VaryHeaders, http.CanonicalHeaderKey(header))
+		}
+		if len(config.VaryHeaders) == 0 {
+			return nil, fmt.Errorf("cache vary must list at least one header")
+		}
+	}
+
+	return config, nil
+}
+
+// parseCircuitBreaker parses @box:circuit-breaker threshold=5 timeout=30s window=20
+// Every option is optional; a bare @box:circuit-breaker uses the defaults
+func parseCircuitBreaker(handler *Handler, value string) error {
+	config := &CircuitBreakerConfig{
+		FailureThreshold: DefaultCircuitBreakerThreshold,
+		ResetTimeout:     DefaultCircuitBreakerResetTimeout,
+		Raw:              strings.TrimSpace(value),
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Fields(value) {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got: %s", part)
+		}
+		if seen[key] {
+			return fmt.Errorf("%s given more than once", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "threshold", "window":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%s must be a positive whole number, got: %q", key, val)
+			}
+			if key == "threshold" {
+				config.FailureThreshold = n
+			} else {
+				config.Window = n
+			}
+		case "timeout":
+			timeout, err := ParseTimeout(val)
+			if err != nil {
+				return fmt.Errorf("invalid circuit breaker timeout: %v", err)
+			}
+			config.ResetTimeout = timeout
+		default:
+			return fmt.Errorf("unknown parameter %q (expected threshold, timeout or window)", key)
+		}
+	}
+
+	if config.Window > 0 && config.Window < config.FailureThreshold {
+		return fmt.Errorf("window (%d) must be at least the threshold (%d)", config.Window, config.FailureThreshold)
+	}
+
+	handler.CircuitBreaker = config
+	return nil
+}
+
+// parseRetry parses @box:retry attempts=3 backoff=exponential delay=100ms max-delay=5s
+// Every option is optional; a bare @box:retry uses the defaults
+func parseRetry(handler *Handler, value string) error {
+	config := &RetryConfig{
+		Attempts:     DefaultRetryAttempts,
+		BackoffType:  DefaultRetryBackoff,
+		InitialDelay: DefaultRetryInitialDelay,
+		Raw:          strings.TrimSpace(value),
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Fields(value) {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got: %s", part)
+		}
+		if seen[key] {
+			return fmt.Errorf("%s given more than once", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "attempts":
+			attempts, err := strconv.Atoi(val)
+			if err != nil || attempts < 1 {
+				return fmt.Errorf("attempts must be a positive whole number, got: %q", val)
+			}
+			config.Attempts = attempts
+		case "backoff":
+			switch val {
+			case RetryBackoffLinear, RetryBackoffExponential, RetryBackoffJitter:
+				config.BackoffType = val
+			default:
+				return fmt.Errorf("unknown backoff %q (expected linear, exponential or jitter)", val)
+			}
+		case "delay", "max-delay":
+			delay, err := ParseTimeout(val)
+			if err != nil {
+				return fmt.Errorf("invalid retry %s: %v", key, err)
+			}
+			if key == "delay" {
+				config.InitialDelay = delay
+			} else {
+				config.MaxDelay = delay
+			}
+		default:
+			return fmt.Errorf("unknown parameter %q (expected attempts, backoff, delay or max-delay)", key)
+		}
+	}
+
+	if config.MaxDelay == 0 {
+		config.MaxDelay = max(DefaultRetryMaxDelay, config.InitialDelay)
+	}
+	if config.MaxDelay < config.InitialDelay {
+		return fmt.Errorf("max-delay (%s) must be at least the delay (%s)", config.MaxDelay, config.InitialDelay)
+	}
+
+	handler.Retry = config
+	return nil
+}
+
+// parseInstances parses a @box:min-instances or @box:max-instances count of at least minimum
+func parseInstances(value string, minimum int) (int, error) {
+	instances, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("instance count must be a whole number, got: %q", value)
+	}
+	if instances < minimum {
+		return 0, fmt.Errorf("instance count must be at least %d, got: %d", minimum, instances)
+	}
+	return instances, nil
+}
+
+// parseTimeout parses @box:timeout 30s
+func parseTimeout(handler *Handler, value string) error {
+	timeout, err := ParseTimeout(value)
+	if err != nil {
+		return err
+	}
+
+	handler.Timeout = timeout
+	return nil
+}
+
+// timeoutUnitAliases maps the long-form units accepted by @box:timeout to time.ParseDuration units
+var timeoutUnitAliases = map[string]string{
+	"sec": "s", "second": "s", "seconds": "s",
+	"min": "m", "minute": "m", "minutes": "m",
+	"hr": "h", "hour": "h", "hours": "h",
+}
+
+// timeoutAliasPattern matches a whole number followed by a long-form unit (e.g., "5min")
+var timeoutAliasPattern = regexp.MustCompile(`^(\d+)\s*([a-z]+)$`)
+
+// ParseTimeout parses a @box:timeout value shared by the Go and TypeScript parsers
+// Accepts time.ParseDuration syntax ("30s", "5m", "1h30m", "500ms") and long-form
+// units ("30sec", "5min", "1hour")
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	normalized := value
+	if matches := timeoutAliasPattern.FindStringSubmatch(value); matches != nil {
+		if unit, ok := timeoutUnitAliases[matches[2]]; ok {
+			normalized = matches[1] + unit
+		}
+	}
+
+	timeout, err := time.ParseDuration(normalized)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout format: %s (use format like '30s', '5m', '1h')", value)
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got: %s", value)
+	}
+
+	return timeout, nil
+}
+
+// parseContainerService parses @box:container service=name
+func parseContainerService(handler *Handler, value string) error {
+	if !strings.HasPrefix(value, "service=") {
+		return fmt.Errorf("container parameter must be in format 'service=name', got: %s", value)
+	}
+
+	serviceName := strings.TrimPrefix(value, "service=")
+	serviceName = strings.TrimSpace(serviceName)
+
+	if serviceName == "" {
+		return fmt.Errorf("service name cannot be empty")
+	}
+
+	handler.ServiceName = serviceName
+	return nil
+}
+
+// parseTags parses @box:tags users,public
+func parseTags(handler *Handler, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("tags must be a comma-separated list, e.g. 'users,public'")
+	}
+
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		handler.Tags = append(handler.Tags, tag)
+	}
+
+	return nil
+}
+
+// parsePreload parses @box:preload /static/app.css
+// The annotation may be repeated; each occurrence adds one or more comma-separated resources
+func parsePreload(handler *Handler, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("preload must name a resource, e.g. '/static/app.css'")
+	}
+
+	for _, resource := range strings.Split(value, ",") {
+		resource = strings.TrimSpace(resource)
+		if resource == "" {
+			continue
+		}
+		handler.Preloads = append(handler.Preloads, resource)
+	}
+
+	return nil
+}
+
+// ParseIPNetworks parses a comma-separated list of CIDR ranges for @box:allow-ip and
+// @box:deny-ip. A bare address is a single-host range (/32, or /128 for IPv6)
+func ParseIPNetworks(value string) ([]net.IPNet, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("expected CIDR ranges like '10.0.0.0/8,192.168.1.0/24'")
+	}
+
+	networks := make([]net.IPNet, 0, len(items))
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR range: %s", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR range: %s", item)
+		}
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
+
+// parseResponse parses @box:response 202 "Accepted for processing"
+// The description is optional (defaulting to the standard status text) and may be unquoted
+func parseResponse(handler *Handler, value string) error {
+	codePart, description, _ := strings.Cut(strings.TrimSpace(value), " ")
+
+	code, err := strconv.Atoi(codePart)
+	if err != nil {
+		return fmt.Errorf("response must be in format 'CODE \"description\"', got: %s", value)
+	}
+
+	description = strings.TrimSpace(description)
+	if unquoted, err := strconv.Unquote(description); err == nil {
+		description = unquoted
+	}
+	if description == "" {
+		description = http.StatusText(code)
+	}
+	if description == "" {
+		return fmt.Errorf("response %d needs a description", code)
+	}
+
+	if handler.Responses == nil {
+		handler.Responses = make(map[int]string)
+	}
+	handler.Responses[code] = description
+	return nil
+}
+
+// bodyTypePattern matches a type name declared in the handler's package
+var bodyTypePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseBodyType parses @box:request CreateUserRequest and @box:response User
+func parseBodyType(value string) (string, error) {
+	typeName := strings.TrimSpace(value)
+	if !bodyTypePattern.MatchString(typeName) {
+		return "", fmt.Errorf("expected a type name declared in the handler's package, got: %q", value)
+	}
+	return typeName, nil
+}
+
+// groupPattern matches a router group name: lowercase letters, digits and hyphens
+var groupPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,62}$`)
+
+// parseGroup parses @box:group admin
+func parseGroup(handler *Handler, value string) error {
+	name := strings.TrimSpace(value)
+	if !groupPattern.MatchString(name) {
+		return fmt.Errorf("group must be lowercase letters, digits or hyphens starting with a letter, got: %q", name)
+	}
+
+	handler.Group = name
+	return nil
+}
+
+// middlewarePattern matches a registered middleware name, typically the Go identifier it wraps
+var middlewarePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+
+// parseMiddleware parses @box:middleware RequireTenant,RequirePlan
+// The annotation may be repeated; names are kept in declaration order
+func parseMiddleware(handler *Handler, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("middleware must name at least one registered middleware, e.g. 'RequireTenant'")
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !middlewarePattern.MatchString(name) {
+			return fmt.Errorf("middleware name must start with a letter and contain only letters, digits, '_', '.' or '-', got: %q", name)
+		}
+		handler.CustomMiddleware = append(handler.CustomMiddleware, name)
+	}
+
+	return nil
+}
+
+// taskQueuePattern matches a Cloud Tasks queue ID: letters, digits and hyphens, up to 100 characters
+var taskQueuePattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,100}$`)
+
+// rolePattern matches a role name as carried in token claims (e.g., "admin", "billing:read")
+var rolePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]*$`)
+
+// parseRoles parses @box:roles admin,moderator; repeated names are recorded once
+func parseRoles(handler *Handler, value string) error {
+	roles := splitList(value)
+	if len(roles) == 0 {
+		return fmt.Errorf("roles must name at least one role, e.g. 'admin,moderator'")
+	}
+
+	for _, role := range roles {
+		if !rolePattern.MatchString(role) {
+			return fmt.Errorf("%q is not a valid role name (letters, digits and _ . : / -)", role)
+		}
+		if !slices.Contains(handler.RequiredRoles, role) {
+			handler.RequiredRoles = append(handler.RequiredRoles, role)
+		}
+	}
+
+	return nil
+}
+
+// parseTaskQueue parses @box:task-queue orders
+func parseTaskQueue(handler *Handler, value string) error {
+	name := strings.TrimSpace(value)
+	if !taskQueuePattern.MatchString(name) {
+		return fmt.Errorf("queue name must be 1-100 letters, digits or hyphens, got: %q", name)
+	}
+
+	handler.TaskQueue = name
+	return nil
+}
+
+// cronFieldPattern matches one cron field: numbers, names (MON, JAN), ranges, steps and lists
+var cronFieldPattern = regexp.MustCompile(`^[A-Za-z0-9*?/,#-]+$`)
+
+// parseSchedule parses @box:schedule 0 3 * * * tz=Europe/Berlin
+// Five fields are standard cron; a sixth leading seconds field is accepted here and
+// rejected by the validator, since Cloud Scheduler only runs unix-cron expressions
+func parseSchedule(handler *Handler, value string) error {
+	config := &ScheduleConfig{
+		Timezone: DefaultScheduleTimezone,
+		Raw:      strings.TrimSpace(value),
+	}
+
+	var fields []string
+	for _, field := range strings.Fields(value) {
+		if tz, ok := strings.CutPrefix(field, "tz="); ok {
+			if tz == "" {
+				return fmt.Errorf("tz must name a time zone, e.g. 'tz=Europe/Berlin'")
+			}
+			config.Timezone = tz
+			continue
+		}
+		if !cronFieldPattern.MatchString(field) {
+			return fmt.Errorf("invalid cron field %q", field)
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) != 5 && len(fields) != 6 {
+		return fmt.Errorf("cron expression must have 5 or 6 fields, got %d in: %s", len(fields), value)
+	}
+
+	config.Cron = strings.Join(fields, " ")
+	handler.Schedule = config
+	return nil
+}
+
+// pubsubNamePattern matches a Pub/Sub topic or subscription ID
+var pubsubNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._~+%-]{2,254}$`)
+
+// parsePubSub parses @box:pubsub topic=orders subscription=orders-billing
+// The topic is required; the subscription defaults to one named after the function
+func parsePubSub(handler *Handler, value string) error {
+	config := &PubSubConfig{Raw: strings.TrimSpace(value)}
+
+	for _, part := range strings.Fields(value) {
+		key, name, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got: %s", part)
+		}
+		if !pubsubNamePattern.MatchString(name) {
+			return fmt.Errorf("%s must be 3-255 characters starting with a letter, got: %q", key, name)
+		}
+
+		var field *string
+		switch key {
+		case "topic":
+			field = &config.TopicID
+		case "subscription":
+			field = &config.SubscriptionID
+		default:
+			return fmt.Errorf("unknown parameter %q (expected topic or subscription)", key)
+		}
+		if *field != "" {
+			return fmt.Errorf("%s given more than once", key)
+		}
+		*field = name
+	}
+
+	if config.TopicID == "" {
+		return fmt.Errorf("topic is required, e.g. 'topic=orders'")
+	}
+
+	handler.PubSub = config
+	return nil
+}
+
+// proxyEnvironmentPattern matches an environment name in a @box:proxy override
+var proxyEnvironmentPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// parseProxy parses @box:proxy https://api.example.com staging=https://sandbox.example.com
+// The first field is the default upstream; env=URL fields override it per environment
+func parseProxy(handler *Handler, value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return fmt.Errorf("proxy must name an upstream URL, e.g. 'https://api.example.com'")
+	}
+
+	config := &ProxyConfig{Raw: strings.TrimSpace(value)}
+	if err := checkUpstreamURL(fields[0]); err != nil {
+		return err
+	}
+	config.Upstream = fields[0]
+
+	for _, field := range fields[1:] {
+		environment, upstream, ok := strings.Cut(field, "=")
+		if !ok || !proxyEnvironmentPattern.MatchString(environment) {
+			return fmt.Errorf("expected environment=URL after the upstream, got: %s", field)
+		}
+		if _, exists := config.Environments[environment]; exists {
+			return fmt.Errorf("environment %s given more than once", environment)
+		}
+		if err := checkUpstreamURL(upstream); err != nil {
+			return fmt.Errorf("%s: %v", environment, err)
+		}
+		if config.Environments == nil {
+			config.Environments = make(map[string]string)
+		}
+		config.Environments[environment] = upstream
+	}
+
+	handler.Proxy = config
+	return nil
+}
+
+// checkUpstreamURL checks that upstream is an absolute http(s) URL without query or fragment
+func checkUpstreamURL(upstream string) error {
+	u, err := url.Parse(upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("upstream must be an absolute http(s) URL, got: %q", upstream)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("upstream must not contain credentials, a query or a fragment, got: %q", upstream)
+	}
+	return nil
+}
+
+// parseOpenAPIExtension parses @box:openapi-ext x-key=value; the annotation is repeatable
+// The key is checked by the validator so a typo is reported alongside the other annotation errors
+func parseOpenAPIExtension(handler *Handler, value string) error {
+	key, extValue, ok := strings.Cut(strings.TrimSpace(value), "=")
+	key = strings.TrimSpace(key)
+	extValue = strings.TrimSpace(extValue)
+	if !ok || key == "" || extValue == "" {
+		return fmt.Errorf("extension must be in format 'x-key=value', got: %s", value)
+	}
+
+	if handler.OpenAPIExtensions == nil {
+		handler.OpenAPIExtensions = make(map[string]string)
+	}
+	handler.OpenAPIExtensions[key] = extValue
+	return nil
+}
+
+// iamRolePattern matches a predefined role (roles/pubsub.publisher) or a custom
+// project or organization role (projects/my-project/roles/invoiceWriter)
+var iamRolePattern = regexp.MustCompile(`^((projects|organizations)/[A-Za-z0-9-]+/)?roles/[A-Za-z0-9_.]+$`)
+
+// parseIAMRoles parses @box:iam-role roles/pubsub.publisher,roles/storage.objectViewer
+func parseIAMRoles(handler *Handler, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("iam-role must name a role, e.g. 'roles/pubsub.publisher'")
+	}
+
+	for _, role := range strings.Split(value, ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			continue
+		}
+		if !iamRolePattern.MatchString(role) {
+			return fmt.Errorf("role must look like 'roles/service.role' or 'projects/ID/roles/name', got: %q", role)
+		}
+		handler.IAMRoles = append(handler.IAMRoles, role)
+	}
+
+	return nil
+}
+
+// envVarPattern matches a portable environment variable name
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SecretEnvironment is replaced by the environment name (e.g., "dev") in @box:secret IDs
+const SecretEnvironment = "${env}"
+
+// secretIDPattern matches a Secret Manager secret ID, which may contain SecretEnvironment
+var secretIDPattern = regexp.MustCompile(`^([A-Za-z0-9_-]|\$\{env\})+$`)
+
+// parseSecrets parses @box:secret DATABASE_URL=database-url-${env},JWT_SECRET=jwt-secret
+// Repeated annotations add to the mapping; a variable cannot be bound to two secrets
+func parseSecrets(handler *Handler, value string) error {
+	pairs := splitList(value)
+	if len(pairs) == 0 {
+		return fmt.Errorf("secret must map at least one variable, e.g. 'JWT_SECRET=jwt-secret-${env}'")
+	}
+
+	for _, pair := range pairs {
+		name, id, ok := strings.Cut(pair, "=")
+		name, id = strings.TrimSpace(name), strings.TrimSpace(id)
+		if !ok || id == "" {
+			return fmt.Errorf("expected NAME=secret-id, got: %q", pair)
+		}
+		if !envVarPattern.MatchString(name) {
+			return fmt.Errorf("%q is not a valid environment variable name (letters, digits and underscores)", name)
+		}
+		if !secretIDPattern.MatchString(id) || len(strings.ReplaceAll(id, SecretEnvironment, "")) == 0 {
+			return fmt.Errorf("%q is not a valid secret ID (letters, digits, - and _, with %s for the environment)", id, SecretEnvironment)
+		}
+		if existing, ok := handler.Secrets[name]; ok && existing != id {
+			return fmt.Errorf("%s is already read from secret %s", name, existing)
+		}
+
+		if handler.Secrets == nil {
+			handler.Secrets = make(map[string]string)
+		}
+		handler.Secrets[name] = id
+	}
+
+	return nil
+}
+
+// parseEnvVars parses @box:env DATABASE_URL,JWT_SECRET; repeated names are recorded once
+func parseEnvVars(handler *Handler, value string) error {
+	names := splitList(value)
+	if len(names) == 0 {
+		return fmt.Errorf("env must name at least one variable, e.g. 'JWT_SECRET'")
+	}
+
+	for _, name := range names {
+		if !envVarPattern.MatchString(name) {
+			return fmt.Errorf("%q is not a valid environment variable name (letters, digits and underscores)", name)
+		}
+		if !slices.Contains(handler.RequiredEnvVars, name) {
+			handler.RequiredEnvVars = append(handler.RequiredEnvVars, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package annotations
+
+// Prefix introduces an annotation in a doc comment: @box:<key> <value>
+const Prefix = "@box:"
+
+// Annotation keys as written after Prefix. ApplyAnnotation switches on these and the
+// validator names annotations with them, so messages always match what the parsers accept
+const (
+	KeyFunction        = "function"
+	KeyLambda          = "lambda"
+	KeyProxy           = "proxy"
+	KeyContainer       = "container"
+	KeyService         = "service"
+	KeyTaskQueue       = "task-queue"
+	KeySchedule        = "schedule"
+	KeyPubSub          = "pubsub"
+	KeyPath            = "path"
+	KeyAuth            = "auth"
+	KeyRoles           = "roles"
+	KeyRateLimit       = "ratelimit"
+	KeyCORS            = "cors"
+	KeyCache           = "cache"
+	KeyCircuitBreaker  = "circuit-breaker"
+	KeyRetry           = "retry"
+	KeyIdempotent      = "idempotent"
+	KeyTimeout         = "timeout"
+	KeyMemory          = "memory"
+	KeyCPUAlways       = "cpu-always"
+	KeyCPUThrottled    = "cpu-throttled"
+	KeyConcurrency     = "concurrency"
+	KeyMinInstances    = "min-instances"
+	KeyMaxInstances    = "max-instances"
+	KeySummary         = "summary"
+	KeyDescription     = "description"
+	KeyTags            = "tags"
+	KeyMaintainable    = "maintainable"
+	KeyGroup           = "group"
+	KeyTracing         = "tracing"
+	KeyMetricsName     = "metrics-name"
+	KeyMiddleware      = "middleware"
+	KeyPaginated       = "paginated"
+	KeyDeprecated      = "deprecated"
+	KeyRequest         = "request"
+	KeyResponse        = "response"
+	KeyRequestExample  = "request-example"
+	KeyResponseExample = "response-example"
+	KeyAllowIP         = "allow-ip"
+	KeyDenyIP          = "deny-ip"
+	KeyPreload         = "preload"
+	KeyEnv             = "env"
+	KeySecret          = "secret"
+	KeyIAMRole         = "iam-role"
+	KeyOpenAPIExt      = "openapi-ext"
+)
+
+// AnnotationName returns key as users write it, e.g. "@box:path" for KeyPath
+func AnnotationName(key string) string {
+	return Prefix + key
+}
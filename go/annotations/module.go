@@ -0,0 +1,80 @@
+package annotations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Module is the Go module enclosing a handlers directory
+type Module struct {
+	Path string // Module path from the module directive (e.g., "github.com/acme/api")
+	Dir  string // Absolute directory containing go.mod
+}
+
+// FindModule locates the nearest go.mod at or above dir
+// In a monorepo this is the handlers' own module, not the repository root
+func FindModule(dir string) (Module, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return Module{}, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	for current := absDir; ; current = filepath.Dir(current) {
+		goMod := filepath.Join(current, "go.mod")
+		if _, err := os.Stat(goMod); err == nil {
+			modulePath, err := readModulePath(goMod)
+			if err != nil {
+				return Module{}, err
+			}
+			return Module{Path: modulePath, Dir: current}, nil
+		}
+
+		if filepath.Dir(current) == current {
+			return Module{}, fmt.Errorf("go.mod not found in %s or any parent directory", absDir)
+		}
+	}
+}
+
+// PackagePath returns dir as a slash-separated path relative to the module root
+// (e.g., "internal/handlers/users"), or "" for the module root itself
+func (m Module) PackagePath(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	rel, err := filepath.Rel(m.Dir, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside module %s", dir, m.Path)
+	}
+
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// readModulePath reads the module directive from a go.mod file
+func readModulePath(goMod string) (string, error) {
+	data, err := os.ReadFile(goMod)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", goMod, err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "module ") && !strings.HasPrefix(line, "module\t") {
+			continue
+		}
+
+		modulePath := strings.TrimSpace(strings.TrimPrefix(line, "module"))
+		if i := strings.Index(modulePath, "//"); i >= 0 {
+			modulePath = strings.TrimSpace(modulePath[:i])
+		}
+		return strings.Trim(modulePath, `"`), nil
+	}
+
+	return "", fmt.Errorf("module declaration not found in %s", goMod)
+}
@@ -7,35 +7,48 @@ import (
 	"go/token"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 )
 
 // Parser handles parsing of Go source files for annotations
+// A Parser is safe for concurrent use
 type Parser struct {
-	fset *token.FileSet
+	mu           sync.Mutex
+	packagePaths map[string]string // directory -> module-relative package path
 }
 
 // NewParser creates a new annotation parser
 func NewParser() *Parser {
 	return &Parser{
-		fset: token.NewFileSet(),
+		packagePaths: make(map[string]string),
 	}
 }
 
 // ParseDirectory parses all Go files in a directory recursively
+// Files are parsed in parallel; results are merged in file path order, so the
+// handlers and errors come out the same as with a serial walk
 func (p *Parser) ParseDirectory(dir string) (*ParsedAnnotations, error) {
 	result := &ParsedAnnotations{
 		Handlers: make([]Handler, 0),
 		Errors:   make([]ParseError, 0),
 	}
 
-	// Walk the directory tree
+	// Walk the directory tree (in lexical order)
+	var paths, centralPaths []string
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// Central sidecars are applied to the Go files below them
+		if !info.IsDir() && info.Name() == CentralSidecarFile {
+			centralPaths = append(centralPaths, path)
+			return nil
+		}
+
 		// Skip directories and non-Go files
 		if info.IsDir() || !strings.HasSuffix(path, ".go") {
 			return nil
@@ -46,41 +59,127 @@ func (p *Parser) ParseDirectory(dir string) (*ParsedAnnotations, error) {
 			return nil
 		}
 
-		// Parse the file
-		fileResult, err := p.ParseFile(path)
+		paths = append(paths, path)
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	// Load central sidecars, outermost first so those nearer a file override them
+	var centrals []*sidecar
+	for _, path := range centralPaths {
+		central, err := loadSidecar(path)
 		if err != nil {
 			result.Errors = append(result.Errors, ParseError{
 				FilePath: path,
-				Message:  fmt.Sprintf("Failed to parse file: %v", err),
+				Message:  fmt.Sprintf("Failed to parse sidecar: %v", err),
 			})
-			return nil // Continue parsing other files
+			continue
 		}
+		centrals = append(centrals, central)
+	}
+	sort.SliceStable(centrals, func(i, j int) bool {
+		return strings.Count(centrals[i].path, string(filepath.Separator)) < strings.Count(centrals[j].path, string(filepath.Separator))
+	})
 
-		// Merge results
-		result.Handlers = append(result.Handlers, fileResult.Handlers...)
-		result.Errors = append(result.Errors, fileResult.Errors...)
+	// Parse files with a worker pool, each result stored at its file's index
+	results := make([]*ParsedAnnotations, len(paths))
+	matched := make([]map[sidecarMatch]bool, len(paths))
+	parseErrs := make([]error, len(paths))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], matched[i], parseErrs[i] = p.parseFile(paths[i], coveringSidecars(centrals, paths[i]))
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-		return nil
-	})
+	// Merge results
+	for i, path := range paths {
+		if parseErrs[i] != nil {
+			result.Errors = append(result.Errors, ParseError{
+				FilePath: path,
+				Message:  fmt.Sprintf("Failed to parse file: %v", parseErrs[i]),
+			})
+			continue // Continue with other files
+		}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
+		result.Handlers = append(result.Handlers, results[i].Handlers...)
+		result.Errors = append(result.Errors, results[i].Errors...)
+	}
+
+	// Every central entry must name a function below its directory
+	for _, central := range centrals {
+		for _, entry := range central.handlers {
+			if !anyMatched(matched, sidecarMatch{central.path, entry.key}) {
+				result.Errors = append(result.Errors, unmatchedSidecarError(central.path, entry, filepath.Dir(central.path)))
+			}
+		}
 	}
 
 	return result, nil
 }
 
-// ParseFile parses a single Go file for annotations
+// sidecarMatch identifies a sidecar entry that matched a function
+type sidecarMatch struct {
+	path string
+	key  string
+}
+
+// coveringSidecars returns the central sidecars whose directory contains goFile
+func coveringSidecars(centrals []*sidecar, goFile string) []*sidecar {
+	var covering []*sidecar
+	for _, central := range centrals {
+		dir := filepath.Dir(central.path)
+		if rel, err := filepath.Rel(dir, filepath.Dir(goFile)); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			covering = append(covering, central)
+		}
+	}
+	return covering
+}
+
+// anyMatched reports whether any file matched the sidecar entry
+func anyMatched(matched []map[sidecarMatch]bool, match sidecarMatch) bool {
+	for _, m := range matched {
+		if m[match] {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFile parses a single Go file for annotations, including its <file>.box.yaml sidecar
+// Central handlers.box.yaml files are only read by ParseDirectory
 func (p *Parser) ParseFile(filePath string) (*ParsedAnnotations, error) {
+	result, _, err := p.parseFile(filePath, nil)
+	return result, err
+}
+
+// parseFile parses a Go file with its sidecar and the central sidecars covering it,
+// returning the central entries that matched one of its functions
+func (p *Parser) parseFile(filePath string, centrals []*sidecar) (*ParsedAnnotations, map[sidecarMatch]bool, error) {
 	result := &ParsedAnnotations{
 		Handlers: make([]Handler, 0),
 		Errors:   make([]ParseError, 0),
 	}
 
-	// Parse the file
-	file, err := parser.ParseFile(p.fset, filePath, nil, parser.ParseComments)
+	// Parse the file; positions are only needed for line numbers, so each file gets its own FileSet
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse file: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse file: %w", err)
 	}
 
 	// Get absolute path
@@ -89,8 +188,25 @@ func (p *Parser) ParseFile(filePath string) (*ParsedAnnotations, error) {
 		absPath = filePath
 	}
 
-	// Extract package name
+	// Extract package name and its path within the enclosing module
 	packageName := file.Name.Name
+	packagePath := p.packagePath(filepath.Dir(absPath))
+	httpName := httpImportName(file)
+
+	// The file's own sidecar is applied last, overriding central ones
+	sidecars := centrals
+	var own *sidecar
+	if path := sidecarPath(absPath); path != "" {
+		if own, err = loadSidecar(path); err != nil {
+			result.Errors = append(result.Errors, ParseError{
+				FilePath: path,
+				Message:  fmt.Sprintf("Failed to parse sidecar: %v", err),
+			})
+		} else if own != nil {
+			sidecars = append(sidecars[:len(sidecars):len(sidecars)], own)
+		}
+	}
+	matched := make(map[sidecarMatch]bool)
 
 	// Find all function declarations with annotations
 	ast.Inspect(file, func(n ast.Node) bool {
@@ -109,17 +225,33 @@ func (p *Parser) ParseFile(filePath string) (*ParsedAnnotations, error) {
 		funcName := funcDecl.Name.Name
 
 		// Get function position
-		position := p.fset.Position(funcDecl.Pos())
+		position := fset.Position(funcDecl.Pos())
 
-		// Extract annotations from doc comments
-		if funcDecl.Doc == nil {
-			return true // No comments, skip
+		// Parse annotations from doc comments
+		var handler *Handler
+		var parseErrs []ParseError
+		if funcDecl.Doc != nil {
+			handler, parseErrs = p.parseAnnotations(funcDecl.Doc, funcName, packageName, absPath, position.Line)
 		}
 
-		// Parse annotations from comments
-		handler, parseErrs := p.parseAnnotations(funcDecl.Doc, funcName, packageName, absPath, position.Line)
+		// Apply sidecar annotations, which also declare handlers without comment annotations
+		key := packageName + "." + funcName
+		for _, sc := range sidecars {
+			for _, entry := range sc.handlers {
+				if entry.key != key {
+					continue
+				}
+				matched[sidecarMatch{sc.path, key}] = true
+				if handler == nil {
+					handler = newHandler(funcName, packageName, absPath, position.Line)
+				}
+				parseErrs = append(parseErrs, applySidecar(handler, sc.path, entry)...)
+			}
+		}
 
 		if handler != nil {
+			handler.PackagePath = packagePath
+			handler.ReturnsHandler = returnsHTTPHandler(funcDecl, httpName)
 			result.Handlers = append(result.Handlers, *handler)
 		}
 
@@ -128,156 +260,145 @@ func (p *Parser) ParseFile(filePath string) (*ParsedAnnotations, error) {
 		return true
 	})
 
-	return result, nil
+	// Every entry in the file's own sidecar must name one of its functions
+	if own != nil {
+		for _, entry := range own.handlers {
+			if !matched[sidecarMatch{own.path, entry.key}] {
+				result.Errors = append(result.Errors, unmatchedSidecarError(own.path, entry, filepath.Base(absPath)))
+			}
+		}
+	}
+
+	return result, matched, nil
 }
 
-// parseAnnotations extracts @wylla:* annotations from comment group
-func (p *Parser) parseAnnotations(doc *ast.CommentGroup, funcName, packageName, filePath string, lineNumber int) (*Handler, []ParseError) {
-	handler := &Handler{
-		FunctionName: funcName,
-		PackageName:  packageName,
-		FilePath:     filePath,
-		LineNumber:   lineNumber,
-		Auth: AuthConfig{
-			Type: AuthNone, // Default to no auth
-		},
+// httpImportName returns the name a file imports net/http under, or "" if it doesn't import it
+func httpImportName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		if strings.Trim(spec.Path.Value, `"`) != "net/http" {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name
+		}
+		return "http"
 	}
+	return ""
+}
 
-	var errors []ParseError
-	hasBoxAnnotation := false
+// returnsHTTPHandler reports whether a function takes no parameters and returns an
+// http.Handler (or http.HandlerFunc) to serve requests with
+func returnsHTTPHandler(funcDecl *ast.FuncDecl, httpName string) bool {
+	signature := funcDecl.Type
+	if httpName == "" || signature.Params.NumFields() != 0 || signature.Results.NumFields() != 1 {
+		return false
+	}
 
-	// Process each comment line
-	for _, comment := range doc.List {
-		text := strings.TrimSpace(comment.Text)
+	selector, ok := signature.Results.List[0].Type.(*ast.SelectorExpr)
+	if !ok || (selector.Sel.Name != "Handler" && selector.Sel.Name != "HandlerFunc") {
+		return false
+	}
+	pkg, ok := selector.X.(*ast.Ident)
+	return ok && pkg.Name == httpName
+}
 
-		// Remove comment markers
-		text = strings.TrimPrefix(text, "//")
-		text = strings.TrimPrefix(text, "/*")
-		text = strings.TrimSuffix(text, "*/")
-		text = strings.TrimSpace(text)
+// packagePath resolves a source directory to its path within the nearest enclosing module
+// Files outside any module get an empty path
+func (p *Parser) packagePath(dir string) string {
+	p.mu.Lock()
+	path, ok := p.packagePaths[dir]
+	p.mu.Unlock()
+	if ok {
+		return path
+	}
 
-		// Check if it's a Box annotation
-		if !strings.HasPrefix(text, "@box:") {
-			continue
-		}
+	// Resolved outside the lock; concurrent misses for one directory compute the same path
+	if module, err := FindModule(dir); err == nil {
+		path, _ = module.PackagePath(dir)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.packagePaths == nil {
+		p.packagePaths = make(map[string]string)
+	}
+	p.packagePaths[dir] = path
+	return path
+}
+
+// parseAnnotations extracts @box:* annotations from comment group
+func (p *Parser) parseAnnotations(doc *ast.CommentGroup, funcName, packageName, filePath string, lineNumber int) (*Handler, []ParseError) {
+	handler := newHandler(funcName, packageName, filePath, lineNumber)
 
-		hasBoxAnnotation = true
+	var errors []ParseError
+	hasBoxAnnotation := false
 
-		// Parse the annotation
-		parts := strings.SplitN(text, ":", 2)
-		if len(parts) != 2 {
+	apply := func(key, value, text string) {
+		if err := ApplyAnnotation(handler, key, value); err != nil {
 			errors = append(errors, ParseError{
 				FilePath:   filePath,
 				LineNumber: lineNumber,
-				Message:    fmt.Sprintf("Invalid annotation format: %s", text),
+				Message:    err.Error(),
 				Annotation: text,
 			})
-			continue
 		}
+	}
 
-		annotationType := strings.TrimSpace(parts[1])
-		var annotationValue string
-
-		// Split annotation type and value
-		if spaceIdx := strings.Index(annotationType, " "); spaceIdx > 0 {
-			annotationValue = strings.TrimSpace(annotationType[spaceIdx+1:])
-			annotationType = annotationType[:spaceIdx]
+	// A multi-line annotation collects lines until the next annotation or the end of the block
+	var pendingKey, pendingText string
+	var pendingLines []string
+	flush := func() {
+		if pendingKey != "" {
+			apply(pendingKey, JoinMultilineValue(pendingLines), pendingText)
+			pendingKey, pendingLines = "", nil
 		}
+	}
 
-		// Parse based on annotation type
-		switch annotationType {
-		case "function":
-			handler.DeploymentType = DeploymentFunction
-
-		case "container":
-			handler.DeploymentType = DeploymentContainer
-			// Parse optional service=name parameter
-			if annotationValue != "" {
-				if err := p.parseContainerService(handler, annotationValue); err != nil {
-					errors = append(errors, ParseError{
-						FilePath:   filePath,
-						LineNumber: lineNumber,
-						Message:    fmt.Sprintf("Invalid container annotation: %v", err),
-						Annotation: text,
-					})
+	// Process each comment line; a /* ... */ comment may hold several
+	for _, comment := range doc.List {
+		for _, line := range strings.Split(comment.Text, "\n") {
+			text := strings.TrimSpace(line)
+
+			// Remove comment markers, including the leading * of block comment lines
+			text = strings.TrimPrefix(text, "//")
+			text = strings.TrimPrefix(text, "/*")
+			text = strings.TrimSuffix(text, "*/")
+			text = strings.TrimSpace(text)
+			text = strings.TrimSpace(strings.TrimPrefix(text, "*"))
+
+			// Check if it's a Box annotation
+			if !strings.HasPrefix(text, Prefix) {
+				if pendingKey != "" {
+					pendingLines = append(pendingLines, text)
 				}
+				continue
 			}
 
-		case "path":
-			if err := p.parsePath(handler, annotationValue); err != nil {
-				errors = append(errors, ParseError{
-					FilePath:   filePath,
-					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid path annotation: %v", err),
-					Annotation: text,
-				})
-			}
-
-		case "auth":
-			if err := p.parseAuth(handler, annotationValue); err != nil {
-				errors = append(errors, ParseError{
-					FilePath:   filePath,
-					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid auth annotation: %v", err),
-					Annotation: text,
-				})
-			}
+			hasBoxAnnotation = true
+			flush()
 
-		case "ratelimit":
-			if err := p.parseRateLimit(handler, annotationValue); err != nil {
+			// The key ends at the first space or tab; the rest of the line is the value
+			annotationType, annotationValue := splitAnnotation(strings.TrimPrefix(text, Prefix))
+			if annotationType == "" {
 				errors = append(errors, ParseError{
 					FilePath:   filePath,
 					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid ratelimit annotation: %v", err),
+					Message:    fmt.Sprintf("Invalid annotation format: %s", text),
 					Annotation: text,
 				})
+				continue
 			}
 
-		case "cors":
-			if err := p.parseCORS(handler, annotationValue); err != nil {
-				errors = append(errors, ParseError{
-					FilePath:   filePath,
-					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid cors annotation: %v", err),
-					Annotation: text,
-				})
+			if MultilineAnnotation(annotationType) {
+				pendingKey, pendingText, pendingLines = annotationType, text, []string{annotationValue}
+				continue
 			}
 
-		case "timeout":
-			if err := p.parseTimeout(handler, annotationValue); err != nil {
-				errors = append(errors, ParseError{
-					FilePath:   filePath,
-					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid timeout annotation: %v", err),
-					Annotation: text,
-				})
-			}
-
-		case "memory":
-			handler.Memory = annotationValue
-
-		case "concurrency":
-			var concurrency int
-			if _, err := fmt.Sscanf(annotationValue, "%d", &concurrency); err != nil {
-				errors = append(errors, ParseError{
-					FilePath:   filePath,
-					LineNumber: lineNumber,
-					Message:    fmt.Sprintf("Invalid concurrency value: %s", annotationValue),
-					Annotation: text,
-				})
-			} else {
-				handler.Concurrency = concurrency
-			}
-
-		default:
-			errors = append(errors, ParseError{
-				FilePath:   filePath,
-				LineNumber: lineNumber,
-				Message:    fmt.Sprintf("Unknown annotation type: %s", annotationType),
-				Annotation: text,
-			})
+			// Interpret the annotation
+			apply(annotationType, annotationValue, text)
 		}
 	}
+	flush()
 
 	// If no Box annotations found, return nil
 	if !hasBoxAnnotation {
@@ -287,163 +408,24 @@ func (p *Parser) parseAnnotations(doc *ast.CommentGroup, funcName, packageName,
 	return handler, errors
 }
 
-// parsePath parses @box:path METHOD /path/to/resource
-func (p *Parser) parsePath(handler *Handler, value string) error {
-	parts := strings.SplitN(value, " ", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("path must be in format 'METHOD /path', got: %s", value)
-	}
-
-	method := strings.ToUpper(strings.TrimSpace(parts[0]))
-	path := strings.TrimSpace(parts[1])
-
-	// Validate HTTP method
-	validMethods := map[string]bool{
-		"GET": true, "POST": true, "PUT": true, "DELETE": true,
-		"PATCH": true, "OPTIONS": true, "HEAD": true,
-	}
-	if !validMethods[method] {
-		return fmt.Errorf("invalid HTTP method: %s", method)
-	}
-
-	// Validate path starts with /
-	if !strings.HasPrefix(path, "/") {
-		return fmt.Errorf("path must start with /, got: %s", path)
-	}
-
-	handler.Route = Route{
-		Method: method,
-		Path:   path,
-	}
-
-	return nil
-}
-
-// parseAuth parses @wylla:auth required|optional|none
-func (p *Parser) parseAuth(handler *Handler, value string) error {
-	value = strings.ToLower(strings.TrimSpace(value))
-
-	switch value {
-	case "required":
-		handler.Auth.Type = AuthRequired
-	case "optional":
-		handler.Auth.Type = AuthOptional
-	case "none":
-		handler.Auth.Type = AuthNone
-	default:
-		return fmt.Errorf("auth must be 'required', 'optional', or 'none', got: %s", value)
-	}
-
-	return nil
-}
-
-// parseRateLimit parses @wylla:ratelimit 100/hour
-func (p *Parser) parseRateLimit(handler *Handler, value string) error {
-	parts := strings.Split(value, "/")
-	if len(parts) != 2 {
-		return fmt.Errorf("ratelimit must be in format 'count/period', got: %s", value)
-	}
-
-	var count int
-	if _, err := fmt.Sscanf(parts[0], "%d", &count); err != nil {
-		return fmt.Errorf("invalid count in ratelimit: %s", parts[0])
-	}
-
-	period := strings.ToLower(strings.TrimSpace(parts[1]))
-	var duration int64
-
-	switch period {
-	case "second", "sec", "s":
-		duration = 1
-	case "minute", "min", "m":
-		duration = 60
-	case "hour", "hr", "h":
-		duration = 3600
-	case "day", "d":
-		duration = 86400
-	default:
-		return fmt.Errorf("invalid period in ratelimit: %s (use second/minute/hour/day)", period)
-	}
-
-	handler.RateLimit = &RateLimitConfig{
-		Count:  count,
-		Period: parseDuration(duration),
-		Raw:    value,
-	}
-
-	return nil
-}
-
-// parseCORS parses @wylla:cors origins=*
-func (p *Parser) parseCORS(handler *Handler, value string) error {
-	if !strings.HasPrefix(value, "origins=") {
-		return fmt.Errorf("cors must be in format 'origins=*' or 'origins=url1,url2', got: %s", value)
-	}
-
-	originsStr := strings.TrimPrefix(value, "origins=")
-	var origins []string
-
-	if originsStr == "*" {
-		origins = []string{"*"}
-	} else {
-		origins = strings.Split(originsStr, ",")
-		for i, origin := range origins {
-			origins[i] = strings.TrimSpace(origin)
-		}
-	}
-
-	handler.CORS = &CORSConfig{
-		AllowedOrigins: origins,
-		Raw:            value,
-	}
-
-	return nil
-}
-
-// parseTimeout parses @wylla:timeout 30s
-func (p *Parser) parseTimeout(handler *Handler, value string) error {
-	// Parse duration string (e.g., "30s", "5m", "1h")
-	var num int
-	var unit string
-
-	if _, err := fmt.Sscanf(value, "%d%s", &num, &unit); err != nil {
-		return fmt.Errorf("invalid timeout format: %s (use format like '30s', '5m', '1h')", value)
-	}
-
-	var multiplier int64
-	switch unit {
-	case "s", "sec", "second":
-		multiplier = 1
-	case "m", "min", "minute":
-		multiplier = 60
-	case "h", "hr", "hour":
-		multiplier = 3600
-	default:
-		return fmt.Errorf("invalid timeout unit: %s (use s/m/h)", unit)
+// newHandler returns a handler for a function before any annotation is applied
+func newHandler(funcName, packageName, filePath string, lineNumber int) *Handler {
+	return &Handler{
+		FunctionName: funcName,
+		PackageName:  packageName,
+		FilePath:     filePath,
+		LineNumber:   lineNumber,
+		Auth: AuthConfig{
+			Type: AuthNone, // Default to no auth
+		},
 	}
-
-	handler.Timeout = parseDuration(int64(num) * multiplier)
-	return nil
 }
 
-// parseContainerService parses @wylla:container service=name
-func (p *Parser) parseContainerService(handler *Handler, value string) error {
-	if !strings.HasPrefix(value, "service=") {
-		return fmt.Errorf("container parameter must be in format 'service=name', got: %s", value)
+// splitAnnotation splits "key value..." at the first space or tab
+func splitAnnotation(text string) (key, value string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i+1:])
 	}
-
-	serviceName := strings.TrimPrefix(value, "service=")
-	serviceName = strings.TrimSpace(serviceName)
-
-	if serviceName == "" {
-		return fmt.Errorf("service name cannot be empty")
-	}
-
-	handler.ServiceName = serviceName
-	return nil
-}
-
-// Helper function to create time.Duration from seconds
-func parseDuration(seconds int64) time.Duration {
-	return time.Duration(seconds * 1000000000) // Convert to nanoseconds
+	return text, ""
 }
@@ -0,0 +1,127 @@
+package annotations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Parser benchmarks over synthetic handler trees
+//
+//	go test ./go/annotations -run '^$' -bench Parse -benchmem
+//
+// Compare against a serial walk with -cpu 1
+
+// benchHandlersPerFile is the number of annotated handlers written to each synthetic file
+const benchHandlersPerFile = 3
+
+// benchFilesPerPackage groups synthetic files into package directories
+const benchFilesPerPackage = 10
+
+// writeHandlerTree writes a module with files handler files spread over packages
+// and returns the handlers directory, the file paths and their total size in bytes
+func writeHandlerTree(tb testing.TB, files int) (string, []string, int64) {
+	tb.Helper()
+
+	root := tb.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/bench\n\ngo 1.23\n"), 0644); err != nil {
+		tb.Fatalf("Failed to write go.mod: %v", err)
+	}
+
+	handlersDir := filepath.Join(root, "internal", "handlers")
+	paths := make([]string, 0, files)
+	var size int64
+
+	for i := 0; i < files; i++ {
+		pkg := fmt.Sprintf("pkg%d", i/benchFilesPerPackage)
+		dir := filepath.Join(handlersDir, pkg)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatalf("Failed to create %s: %v", dir, err)
+		}
+
+		var src strings.Builder
+		fmt.Fprintf(&src, "package %s\n\nimport \"net/http\"\n", pkg)
+		for h := 0; h < benchHandlersPerFile; h++ {
+			name := fmt.Sprintf("Handler%d_%d", i, h)
+			fmt.Fprintf(&src, `
+// %s handles requests for resource %d
+// @box:function
+// @box:path GET /api/v1/r%d/h%d/{id}
+// @box:auth required
+// @box:ratelimit 100/hour
+// @box:cors origins=https://app.example.com
+// @box:timeout 30s
+func %s(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+`, name, i, i, h, name)
+		}
+
+		// An unannotated helper, as real handler files usually have
+		fmt.Fprintf(&src, "\nfunc helper%d(id string) string {\n\treturn strings.TrimSpace(id)\n}\n", i)
+
+		path := filepath.Join(dir, fmt.Sprintf("handlers%d.go", i))
+		if err := os.WriteFile(path, []byte(src.String()), 0644); err != nil {
+			tb.Fatalf("Failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+		size += int64(src.Len())
+	}
+
+	return handlersDir, paths, size
+}
+
+func BenchmarkParseDirectory(b *testing.B) {
+	for _, files := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			dir, _, size := writeHandlerTree(b, files)
+
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				result, err := NewParser().ParseDirectory(dir)
+				if err != nil {
+					b.Fatalf("ParseDirectory() error = %v", err)
+				}
+				if len(result.Handlers) != files*benchHandlersPerFile {
+					b.Fatalf("Expected %d handlers, got %d", files*benchHandlersPerFile, len(result.Handlers))
+				}
+			}
+
+			b.ReportMetric(float64(files*b.N)/b.Elapsed().Seconds(), "files/s")
+		})
+	}
+}
+
+// BenchmarkParseFileParallel parses the same tree from several goroutines sharing one Parser
+func BenchmarkParseFileParallel(b *testing.B) {
+	_, paths, size := writeHandlerTree(b, 1000)
+
+	parser := NewParser()
+	var next atomic.Int64
+	b.SetBytes(size / int64(len(paths)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			path := paths[int(next.Add(1))%len(paths)]
+			result, err := parser.ParseFile(path)
+			if err != nil {
+				b.Errorf("ParseFile() error = %v", err)
+				return
+			}
+			if len(result.Handlers) != benchHandlersPerFile {
+				b.Errorf("Expected %d handlers in %s, got %d", benchHandlersPerFile, path, len(result.Handlers))
+				return
+			}
+		}
+	})
+
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "files/s")
+}
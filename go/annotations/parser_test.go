@@ -1,10 +1,21 @@
 package annotations
 
 import (
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/gravelight-studio/box/go/config"
 )
 
 func TestParseAnnotations(t *testing.T) {
@@ -160,6 +171,87 @@ func GetPublicData(w http.ResponseWriter, r *http.Request) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "maintainable endpoint",
+			source: `package test
+
+// RunReport runs a heavy report
+// @box:function
+// @box:path POST /api/v1/reports
+// @box:maintainable
+func RunReport(w http.ResponseWriter, r *http.Request) {
+	// implementation
+}
+`,
+			expected: &Handler{
+				FunctionName:   "RunReport",
+				PackageName:    "test",
+				DeploymentType: DeploymentFunction,
+				Route: Route{
+					Method: "POST",
+					Path:   "/api/v1/reports",
+				},
+				Auth: AuthConfig{
+					Type: AuthNone,
+				},
+				Maintainable: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "paginated endpoint",
+			source: `package test
+
+// ListUsers lists users a page at a time
+// @box:function
+// @box:path GET /api/v1/users
+// @box:paginated
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	// implementation
+}
+`,
+			expected: &Handler{
+				FunctionName:   "ListUsers",
+				PackageName:    "test",
+				DeploymentType: DeploymentFunction,
+				Route: Route{
+					Method: "GET",
+					Path:   "/api/v1/users",
+				},
+				Auth: AuthConfig{
+					Type: AuthNone,
+				},
+				Paginated: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "deprecated endpoint",
+			source: `package test
+
+// @box:function
+// @box:path GET /api/v1/users
+// @box:deprecated use GET /api/v2/users
+func ListUsersV1(w http.ResponseWriter, r *http.Request) {
+	// implementation
+}
+`,
+			expected: &Handler{
+				FunctionName:   "ListUsersV1",
+				PackageName:    "test",
+				DeploymentType: DeploymentFunction,
+				Route: Route{
+					Method: "GET",
+					Path:   "/api/v1/users",
+				},
+				Auth: AuthConfig{
+					Type: AuthNone,
+				},
+				Deprecated:      true,
+				DeprecationNote: "use GET /api/v2/users",
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -247,6 +339,18 @@ func GetPublicData(w http.ResponseWriter, r *http.Request) {
 			if handler.Concurrency != tt.expected.Concurrency {
 				t.Errorf("Concurrency = %v, want %v", handler.Concurrency, tt.expected.Concurrency)
 			}
+
+			if handler.Maintainable != tt.expected.Maintainable {
+				t.Errorf("Maintainable = %v, want %v", handler.Maintainable, tt.expected.Maintainable)
+			}
+
+			if handler.Paginated != tt.expected.Paginated {
+				t.Errorf("Paginated = %v, want %v", handler.Paginated, tt.expected.Paginated)
+			}
+
+			if handler.Deprecated != tt.expected.Deprecated || handler.DeprecationNote != tt.expected.DeprecationNote {
+				t.Errorf("Deprecated = %v (%q), want %v (%q)", handler.Deprecated, handler.DeprecationNote, tt.expected.Deprecated, tt.expected.DeprecationNote)
+			}
 		})
 	}
 }
@@ -293,9 +397,8 @@ func TestParsePathVariations(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := &Handler{}
-			parser := NewParser()
 
-			err := parser.parsePath(handler, tt.pathLine)
+			err := parsePath(handler, tt.pathLine)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parsePath() error = %v, wantErr %v", err, tt.wantErr)
@@ -314,6 +417,142 @@ func TestParsePathVariations(t *testing.T) {
 	}
 }
 
+func TestParseAnnotationValues(t *testing.T) {
+	source := `package test
+
+// CreateAccount creates a new account
+// @box:function
+// @box:path	POST /api/v1/accounts
+// @box:service "billing"
+// @box:cors origins=https://app.example.com, https://admin.example.com expose=X-Total-Count, Link
+// @box:response 409 "Conflict: \"email\" is taken"
+// @box:openapi-ext x-audience='web app'
+func CreateAccount(w http.ResponseWriter, r *http.Request) {}
+
+/*
+ * @box:container
+ * @box:path GET /api/v1/accounts
+ * @box:service 'accounts api'
+ */
+func ListAccounts(w http.ResponseWriter, r *http.Request) {}
+`
+
+	tmpFile := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(tmpFile, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+
+	result, err := NewParser().ParseFile(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected parse errors: %v", result.Errors)
+	}
+	if len(result.Handlers) != 2 {
+		t.Fatalf("Expected 2 handlers, got %d", len(result.Handlers))
+	}
+
+	create := result.Handlers[0]
+	if create.Route != (Route{Method: "POST", Path: "/api/v1/accounts"}) {
+		t.Errorf("Route = %+v, want POST /api/v1/accounts (tab-separated)", create.Route)
+	}
+	if create.ServiceName != "billing" {
+		t.Errorf("ServiceName = %q, want billing", create.ServiceName)
+	}
+	if create.CORS == nil || !reflect.DeepEqual(create.CORS.AllowedOrigins, []string{"https://app.example.com", "https://admin.example.com"}) {
+		t.Errorf("CORS = %+v, want both origins", create.CORS)
+	}
+	if got := create.Responses[409]; got != `Conflict: "email" is taken` {
+		t.Errorf("Responses[409] = %q", got)
+	}
+	// Only a fully quoted value is unquoted; key='value' keeps its quotes
+	if got := create.OpenAPIExtensions["x-audience"]; got != "'web app'" {
+		t.Errorf("OpenAPIExtensions[x-audience] = %q", got)
+	}
+
+	list := result.Handlers[1]
+	if list.DeploymentType != DeploymentContainer || list.Route.Path != "/api/v1/accounts" {
+		t.Errorf("block comment annotations not parsed: %+v", list)
+	}
+	if list.ServiceName != "accounts api" {
+		t.Errorf("ServiceName = %q, want %q", list.ServiceName, "accounts api")
+	}
+}
+
+func TestParseSummaryAndDescription(t *testing.T) {
+	source := `package test
+
+// CreateAccount creates a new account
+// @box:function
+// @box:path POST /api/v1/accounts
+// @box:summary Create an account
+// @box:description Registers an account for the caller.
+//
+// Fails with 409 when the email is taken.
+// @box:auth required
+func CreateAccount(w http.ResponseWriter, r *http.Request) {}
+
+/*
+ * @box:function
+ * @box:path GET /api/v1/accounts
+ * @box:description
+ *   Lists the caller's accounts,
+ *   newest first.
+ */
+func ListAccounts(w http.ResponseWriter, r *http.Request) {}
+`
+
+	tmpFile := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(tmpFile, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+
+	result, err := NewParser().ParseFile(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(result.Errors) > 0 || len(result.Handlers) != 2 {
+		t.Fatalf("ParseFile() = %d handlers, errors %v; want 2 handlers", len(result.Handlers), result.Errors)
+	}
+
+	create := result.Handlers[0]
+	if create.Summary != "Create an account" {
+		t.Errorf("Summary = %q", create.Summary)
+	}
+	// The description runs to the next annotation, keeping blank lines between paragraphs
+	if want := "Registers an account for the caller.\n\nFails with 409 when the email is taken."; create.Description != want {
+		t.Errorf("Description = %q, want %q", create.Description, want)
+	}
+	if create.Auth.Type != AuthRequired {
+		t.Errorf("annotation after the description not applied: Auth = %+v", create.Auth)
+	}
+
+	// ... or to the end of the comment block
+	if want := "Lists the caller's accounts,\nnewest first."; result.Handlers[1].Description != want {
+		t.Errorf("Description = %q, want %q", result.Handlers[1].Description, want)
+	}
+}
+
+func TestUnquoteValue(t *testing.T) {
+	tests := map[string]string{
+		`"Create a new account"`: "Create a new account",
+		`'Create a new account'`: "Create a new account",
+		`"say \"hi\""`:           `say "hi"`,
+		`"a" "b"`:                `"a" "b"`,
+		`'it's'`:                 `'it's'`,
+		`"`:                      `"`,
+		`plain value`:            "plain value",
+		``:                       "",
+	}
+
+	for value, want := range tests {
+		if got := unquoteValue(value); got != want {
+			t.Errorf("unquoteValue(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
 func TestParseRateLimit(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -351,6 +590,26 @@ func TestParseRateLimit(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:  "requests word",
+			value: "100 requests/hour",
+			expected: &RateLimitConfig{
+				Count:  100,
+				Period: time.Hour,
+				Raw:    "100 requests/hour",
+			},
+			wantErr: false,
+		},
+		{
+			name:  "per phrase",
+			value: "5 req per second",
+			expected: &RateLimitConfig{
+				Count:  5,
+				Period: time.Second,
+				Raw:    "5 req per second",
+			},
+			wantErr: false,
+		},
 		{
 			name:    "invalid format",
 			value:   "100",
@@ -361,14 +620,18 @@ func TestParseRateLimit(t *testing.T) {
 			value:   "abc/hour",
 			wantErr: true,
 		},
+		{
+			name:    "invalid period",
+			value:   "100/fortnight",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := &Handler{}
-			parser := NewParser()
 
-			err := parser.parseRateLimit(handler, tt.value)
+			err := parseRateLimit(handler, tt.value)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseRateLimit() error = %v, wantErr %v", err, tt.wantErr)
@@ -387,103 +650,2567 @@ func TestParseRateLimit(t *testing.T) {
 	}
 }
 
-func TestValidator(t *testing.T) {
-	validator := NewValidator()
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30s", want: 30 * time.Second},
+		{value: "2m", want: 2 * time.Minute},
+		{value: "1h", want: time.Hour},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "500ms", want: 500 * time.Millisecond},
+		{value: "90sec", want: 90 * time.Second},
+		{value: "5min", want: 5 * time.Minute},
+		{value: "2 hours", want: 2 * time.Hour},
+		{value: "30", wantErr: true},
+		{value: "5 fortnights", wantErr: true},
+		{value: "0s", wantErr: true},
+		{value: "-5s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTimeout(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeout(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTimeout(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
 
+func TestParseTags(t *testing.T) {
 	tests := []struct {
-		name        string
-		handler     Handler
-		wantErrors  int
-		errorContains string
+		name     string
+		value    string
+		expected []string
+		wantErr  bool
 	}{
 		{
-			name: "valid function handler",
-			handler: Handler{
-				FunctionName:   "Test",
-				DeploymentType: DeploymentFunction,
-				Route:          Route{Method: "GET", Path: "/test"},
-				Auth:           AuthConfig{Type: AuthRequired},
-			},
-			wantErrors: 0,
-		},
-		{
-			name: "missing deployment type",
-			handler: Handler{
-				FunctionName: "Test",
-				Route:        Route{Method: "GET", Path: "/test"},
-			},
-			wantErrors:    1,
-			errorContains: "deployment type",
+			name:     "single tag",
+			value:    "users",
+			expected: []string{"users"},
 		},
 		{
-			name: "missing route",
-			handler: Handler{
-				FunctionName:   "Test",
-				DeploymentType: DeploymentFunction,
-			},
-			wantErrors:    1,
-			errorContains: "path",
+			name:     "multiple tags",
+			value:    "users,public",
+			expected: []string{"users", "public"},
 		},
 		{
-			name: "invalid memory for function",
-			handler: Handler{
-				FunctionName:   "Test",
-				DeploymentType: DeploymentFunction,
-				Route:          Route{Method: "GET", Path: "/test"},
-				Memory:         "99MB",
-			},
-			wantErrors:    1,
-			errorContains: "memory",
+			name:     "whitespace and duplicates",
+			value:    " users , public,users ",
+			expected: []string{"users", "public"},
 		},
 		{
-			name: "concurrency on function (warning)",
-			handler: Handler{
-				FunctionName:   "Test",
-				DeploymentType: DeploymentFunction,
-				Route:          Route{Method: "GET", Path: "/test"},
-				Concurrency:    10,
-			},
-			wantErrors:    1,
-			errorContains: "Concurrency",
+			name:    "empty value",
+			value:   "",
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			errors := validator.validateHandler(tt.handler)
+			handler := &Handler{}
 
-			if len(errors) != tt.wantErrors {
-				t.Errorf("validateHandler() got %d errors, want %d", len(errors), tt.wantErrors)
-				for _, err := range errors {
-					t.Logf("  Error: %s", err.Reason)
-				}
+			err := parseTags(handler, tt.value)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTags() error = %v, wantErr %v", err, tt.wantErr)
+				return
 			}
 
-			if tt.errorContains != "" && len(errors) > 0 {
-				found := false
-				for _, err := range errors {
-					if containsString(err.Reason, tt.errorContains) {
-						found = true
-						break
-					}
-				}
-				if !found {
-					t.Errorf("Expected error containing %q, but not found in: %v", tt.errorContains, errors)
-				}
+			if !tt.wantErr && !reflect.DeepEqual(handler.Tags, tt.expected) {
+				t.Errorf("Tags = %v, want %v", handler.Tags, tt.expected)
 			}
 		})
 	}
 }
 
-func containsString(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsSubstring(s, substr)))
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		code     int
+		expected string
+		wantErr  bool
+	}{
+		{name: "quoted description", value: `202 "Accepted for processing"`, code: 202, expected: "Accepted for processing"},
+		{name: "unquoted description", value: "404 Not found", code: 404, expected: "Not found"},
+		{name: "default status text", value: "204", code: 204, expected: "No Content"},
+		{name: "unknown code needs description", value: "299", wantErr: true},
+		{name: "missing code", value: `"Accepted"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &Handler{}
+
+			err := parseResponse(handler, tt.value)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseResponse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && handler.Responses[tt.code] != tt.expected {
+				t.Errorf("Responses[%d] = %q, want %q", tt.code, handler.Responses[tt.code], tt.expected)
+			}
+		})
+	}
 }
 
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+func TestParsePreload(t *testing.T) {
+	handler := &Handler{}
+
+	if err := parsePreload(handler, "/static/app.css"); err != nil {
+		t.Fatalf("parsePreload() error = %v", err)
 	}
-	return false
+	if err := parsePreload(handler, "/static/app.js, https://cdn.example.com/font.woff2"); err != nil {
+		t.Fatalf("parsePreload() error = %v", err)
+	}
+
+	expected := []string{"/static/app.css", "/static/app.js", "https://cdn.example.com/font.woff2"}
+	if !reflect.DeepEqual(handler.Preloads, expected) {
+		t.Errorf("Preloads = %v, want %v", handler.Preloads, expected)
+	}
+
+	if err := parsePreload(handler, " "); err == nil {
+		t.Error("parsePreload() expected error for empty value")
+	}
+}
+
+func TestApplyAnnotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		value    string
+		check    func(*Handler) bool
+		errorMsg string
+	}{
+		{
+			name:  "lambda",
+			key:   "lambda",
+			check: func(h *Handler) bool { return h.DeploymentType == DeploymentLambda },
+		},
+		{
+			name:  "request type",
+			key:   "request",
+			value: "CreateUserRequest",
+			check: func(h *Handler) bool { return h.RequestType == "CreateUserRequest" },
+		},
+		{
+			name:  "response type",
+			key:   "response",
+			value: "User",
+			check: func(h *Handler) bool { return h.ResponseType == "User" && h.Responses == nil },
+		},
+		{
+			name:  "response status still documents a response",
+			key:   "response",
+			value: `404 "User not found"`,
+			check: func(h *Handler) bool { return h.Responses[404] == "User not found" && h.ResponseType == "" },
+		},
+		{
+			name:     "invalid request type",
+			key:      "request",
+			value:    "[]User",
+			errorMsg: "Invalid request annotation",
+		},
+		{
+			name:  "request example",
+			key:   "request-example",
+			value: "./examples/create-user.json",
+			check: func(h *Handler) bool { return h.RequestExample == "./examples/create-user.json" },
+		},
+		{
+			name:  "response example",
+			key:   "response-example",
+			value: "examples/user.json",
+			check: func(h *Handler) bool { return h.ResponseExample == "examples/user.json" },
+		},
+		{
+			name:     "empty response example",
+			key:      "response-example",
+			errorMsg: "Invalid response-example annotation",
+		},
+		{
+			name:  "service name",
+			key:   "service",
+			value: "realtime",
+			check: func(h *Handler) bool { return h.ServiceName == "realtime" },
+		},
+		{
+			name:  "concurrency",
+			key:   "concurrency",
+			value: "40",
+			check: func(h *Handler) bool { return h.Concurrency == 40 },
+		},
+		{
+			name:     "invalid concurrency",
+			key:      "concurrency",
+			value:    "lots",
+			errorMsg: "Invalid concurrency value: lots",
+		},
+		{
+			name:  "min instances",
+			key:   "min-instances",
+			value: "2",
+			check: func(h *Handler) bool { return h.MinInstances == 2 },
+		},
+		{
+			name:  "max instances",
+			key:   "max-instances",
+			value: "50",
+			check: func(h *Handler) bool { return h.MaxInstances == 50 },
+		},
+		{
+			name:     "negative min instances",
+			key:      "min-instances",
+			value:    "-1",
+			errorMsg: "Invalid min-instances annotation: instance count must be at least 0, got: -1",
+		},
+		{
+			name:     "zero max instances",
+			key:      "max-instances",
+			value:    "0",
+			errorMsg: "Invalid max-instances annotation: instance count must be at least 1, got: 0",
+		},
+		{
+			name:     "non-numeric max instances",
+			key:      "max-instances",
+			value:    "many",
+			errorMsg: `Invalid max-instances annotation: instance count must be a whole number, got: "many"`,
+		},
+		{
+			name:  "task queue",
+			key:   "task-queue",
+			value: "orders",
+			check: func(h *Handler) bool { return h.TaskQueue == "orders" },
+		},
+		{
+			name:     "invalid task queue",
+			key:      "task-queue",
+			value:    "orders_queue!",
+			errorMsg: "Invalid task-queue annotation",
+		},
+		{
+			name:  "schedule",
+			key:   "schedule",
+			value: "0 3 * * MON-FRI",
+			check: func(h *Handler) bool {
+				return h.Schedule != nil && h.Schedule.Cron == "0 3 * * MON-FRI" && h.Schedule.Timezone == DefaultScheduleTimezone
+			},
+		},
+		{
+			name:  "schedule with time zone",
+			key:   "schedule",
+			value: "*/15 9-17 * * 1-5 tz=Europe/Berlin",
+			check: func(h *Handler) bool {
+				return h.Schedule != nil && h.Schedule.Cron == "*/15 9-17 * * 1-5" && h.Schedule.Timezone == "Europe/Berlin"
+			},
+		},
+		{
+			name:     "schedule with too few fields",
+			key:      "schedule",
+			value:    "0 3 * *",
+			errorMsg: "Invalid schedule annotation: cron expression must have 5 or 6 fields",
+		},
+		{
+			name:  "group",
+			key:   "group",
+			value: "admin",
+			check: func(h *Handler) bool { return h.Group == "admin" },
+		},
+		{
+			name:     "invalid group",
+			key:      "group",
+			value:    "Admin Tools",
+			errorMsg: "Invalid group annotation: group must be lowercase letters",
+		},
+		{
+			name:  "proxy",
+			key:   "proxy",
+			value: "https://api.example.com/v2 staging=https://sandbox.example.com dev=http://localhost:9000",
+			check: func(h *Handler) bool {
+				return h.DeploymentType == DeploymentProxy &&
+					h.Proxy.Upstream == "https://api.example.com/v2" &&
+					h.Proxy.UpstreamFor("production") == "https://api.example.com/v2" &&
+					h.Proxy.UpstreamFor("staging") == "https://sandbox.example.com" &&
+					h.Proxy.UpstreamFor("dev") == "http://localhost:9000"
+			},
+		},
+		{
+			name:     "proxy without upstream",
+			key:      "proxy",
+			value:    "",
+			errorMsg: "Invalid proxy annotation: proxy must name an upstream URL",
+		},
+		{
+			name:     "proxy to relative URL",
+			key:      "proxy",
+			value:    "/internal/api",
+			errorMsg: "Invalid proxy annotation: upstream must be an absolute http(s) URL",
+		},
+		{
+			name:     "proxy upstream with query",
+			key:      "proxy",
+			value:    "https://api.example.com?key=secret",
+			errorMsg: "Invalid proxy annotation: upstream must not contain credentials, a query or a fragment",
+		},
+		{
+			name:     "proxy override without URL",
+			key:      "proxy",
+			value:    "https://api.example.com staging",
+			errorMsg: "Invalid proxy annotation: expected environment=URL after the upstream",
+		},
+		{
+			name:     "proxy override with invalid URL",
+			key:      "proxy",
+			value:    "https://api.example.com staging=ftp://sandbox.example.com",
+			errorMsg: "Invalid proxy annotation: staging: upstream must be an absolute http(s) URL",
+		},
+		{
+			name:  "tracing opt-out",
+			key:   "tracing",
+			value: "false",
+			check: func(h *Handler) bool { return h.TracingDisabled },
+		},
+		{
+			name:  "allow ip",
+			key:   "allow-ip",
+			value: "10.0.0.0/8, 192.168.1.7, 2001:db8::/32",
+			check: func(h *Handler) bool {
+				var ranges []string
+				for _, network := range h.AllowIPs {
+					ranges = append(ranges, network.String())
+				}
+				return reflect.DeepEqual(ranges, []string{"10.0.0.0/8", "192.168.1.7/32", "2001:db8::/32"})
+			},
+		},
+		{
+			name:  "deny ip",
+			key:   "deny-ip",
+			value: "203.0.113.0/24",
+			check: func(h *Handler) bool { return len(h.DenyIPs) == 1 && h.DenyIPs[0].String() == "203.0.113.0/24" },
+		},
+		{
+			name:     "invalid allow ip",
+			key:      "allow-ip",
+			value:    "10.0.0.0/33",
+			errorMsg: "Invalid allow-ip annotation: invalid IP address or CIDR range: 10.0.0.0/33",
+		},
+		{
+			name:     "empty deny ip",
+			key:      "deny-ip",
+			value:    "",
+			errorMsg: "Invalid deny-ip annotation: expected CIDR ranges",
+		},
+		{
+			name:  "cpu always",
+			key:   "cpu-always",
+			value: "",
+			check: func(h *Handler) bool { return h.CPUAlways && !h.CPUThrottled },
+		},
+		{
+			name:  "cpu throttled",
+			key:   "cpu-throttled",
+			value: "",
+			check: func(h *Handler) bool { return h.CPUThrottled && !h.CPUAlways },
+		},
+		{
+			name:  "cache",
+			key:   "cache",
+			value: "5m vary=accept-language,Accept",
+			check: func(h *Handler) bool {
+				return h.Cache.TTL == 5*time.Minute &&
+					reflect.DeepEqual(h.Cache.VaryHeaders, []string{"Accept-Language", "Accept"}) &&
+					h.Cache.Raw == "5m vary=accept-language,Accept"
+			},
+		},
+		{
+			name:  "cache with long-form ttl",
+			key:   "cache",
+			value: "1hour",
+			check: func(h *Handler) bool { return h.Cache.TTL == time.Hour && h.Cache.VaryHeaders == nil },
+		},
+		{
+			name:     "cache with unknown option",
+			key:      "cache",
+			value:    "5m private=true",
+			errorMsg: `Invalid cache annotation: unknown cache option "private"`,
+		},
+		{
+			name:     "cache without ttl",
+			key:      "cache",
+			value:    "vary=Accept",
+			errorMsg: "Invalid cache annotation: invalid cache ttl",
+		},
+		{
+			name:  "circuit breaker",
+			key:   "circuit-breaker",
+			value: "threshold=3 timeout=1min window=10",
+			check: func(h *Handler) bool {
+				return h.CircuitBreaker.FailureThreshold == 3 && h.CircuitBreaker.ResetTimeout == time.Minute &&
+					h.CircuitBreaker.Window == 10 && h.CircuitBreaker.Raw == "threshold=3 timeout=1min window=10"
+			},
+		},
+		{
+			name:  "circuit breaker defaults",
+			key:   "circuit-breaker",
+			value: "",
+			check: func(h *Handler) bool {
+				return h.CircuitBreaker.FailureThreshold == DefaultCircuitBreakerThreshold &&
+					h.CircuitBreaker.ResetTimeout == DefaultCircuitBreakerResetTimeout &&
+					h.CircuitBreaker.EffectiveWindow() == DefaultCircuitBreakerWindow
+			},
+		},
+		{
+			name:     "circuit breaker with zero threshold",
+			key:      "circuit-breaker",
+			value:    "threshold=0",
+			errorMsg: `Invalid circuit-breaker annotation: threshold must be a positive whole number, got: "0"`,
+		},
+		{
+			name:     "circuit breaker window below threshold",
+			key:      "circuit-breaker",
+			value:    "threshold=5 window=3",
+			errorMsg: "Invalid circuit-breaker annotation: window (3) must be at least the threshold (5)",
+		},
+		{
+			name:     "circuit breaker with unknown option",
+			key:      "circuit-breaker",
+			value:    "threshold=5 halfopen=2",
+			errorMsg: `Invalid circuit-breaker annotation: unknown parameter "halfopen"`,
+		},
+		{
+			name:  "retry",
+			key:   "retry",
+			value: "attempts=4 backoff=linear delay=50ms max-delay=1s",
+			check: func(h *Handler) bool {
+				return h.Retry.Attempts == 4 && h.Retry.BackoffType == RetryBackoffLinear &&
+					h.Retry.InitialDelay == 50*time.Millisecond && h.Retry.MaxDelay == time.Second &&
+					h.Retry.Raw == "attempts=4 backoff=linear delay=50ms max-delay=1s"
+			},
+		},
+		{
+			name:  "retry defaults",
+			key:   "retry",
+			value: "",
+			check: func(h *Handler) bool {
+				return h.Retry.Attempts == DefaultRetryAttempts && h.Retry.BackoffType == DefaultRetryBackoff &&
+					h.Retry.InitialDelay == DefaultRetryInitialDelay && h.Retry.MaxDelay == DefaultRetryMaxDelay
+			},
+		},
+		{
+			name:  "retry delay above the default cap",
+			key:   "retry",
+			value: "delay=10s",
+			check: func(h *Handler) bool { return h.Retry.MaxDelay == 10*time.Second },
+		},
+		{
+			name:     "retry with unknown backoff",
+			key:      "retry",
+			value:    "backoff=fibonacci",
+			errorMsg: `Invalid retry annotation: unknown backoff "fibonacci"`,
+		},
+		{
+			name:     "retry with zero attempts",
+			key:      "retry",
+			value:    "attempts=0",
+			errorMsg: `Invalid retry annotation: attempts must be a positive whole number, got: "0"`,
+		},
+		{
+			name:     "retry max delay below delay",
+			key:      "retry",
+			value:    "delay=2s max-delay=1s",
+			errorMsg: "Invalid retry annotation: max-delay (1s) must be at least the delay (2s)",
+		},
+		{
+			name:  "idempotent",
+			key:   "idempotent",
+			value: "",
+			check: func(h *Handler) bool { return h.Idempotent },
+		},
+		{
+			name:     "invalid tracing",
+			key:      "tracing",
+			value:    "off",
+			errorMsg: "Invalid tracing annotation: expected true or false",
+		},
+		{
+			name:  "metrics name",
+			key:   "metrics-name",
+			value: "get_user",
+			check: func(h *Handler) bool { return h.MetricsName == "get_user" },
+		},
+		{
+			name:     "metrics name with spaces",
+			key:      "metrics-name",
+			value:    "get user",
+			errorMsg: "Invalid metrics-name annotation: expected a single label value",
+		},
+		{
+			name:  "middleware",
+			key:   "middleware",
+			value: "ResolveTenant, RequirePlan",
+			check: func(h *Handler) bool {
+				return reflect.DeepEqual(h.CustomMiddleware, []string{"ResolveTenant", "RequirePlan"})
+			},
+		},
+		{
+			name:     "invalid middleware",
+			key:      "middleware",
+			value:    "Require Plan",
+			errorMsg: "Invalid middleware annotation: middleware name must start with a letter",
+		},
+		{
+			name:  "env vars",
+			key:   "env",
+			value: "DATABASE_URL, JWT_SECRET,DATABASE_URL",
+			check: func(h *Handler) bool {
+				return reflect.DeepEqual(h.RequiredEnvVars, []string{"DATABASE_URL", "JWT_SECRET"})
+			},
+		},
+		{
+			name:     "invalid env var",
+			key:      "env",
+			value:    "REDIS-URL",
+			errorMsg: "Invalid env annotation: \"REDIS-URL\" is not a valid environment variable name",
+		},
+		{
+			name:  "secrets",
+			key:   "secret",
+			value: "DATABASE_URL=orders-db-${env}, STRIPE_KEY=stripe-key",
+			check: func(h *Handler) bool {
+				return reflect.DeepEqual(h.Secrets, map[string]string{"DATABASE_URL": "orders-db-${env}", "STRIPE_KEY": "stripe-key"})
+			},
+		},
+		{
+			name:     "secret without id",
+			key:      "secret",
+			value:    "STRIPE_KEY",
+			errorMsg: "Invalid secret annotation: expected NAME=secret-id, got: \"STRIPE_KEY\"",
+		},
+		{
+			name:     "invalid secret id",
+			key:      "secret",
+			value:    "STRIPE_KEY=projects/p/secrets/stripe",
+			errorMsg: "Invalid secret annotation: \"projects/p/secrets/stripe\" is not a valid secret ID",
+		},
+		{
+			name:     "secret id of only the environment",
+			key:      "secret",
+			value:    "STRIPE_KEY=${env}",
+			errorMsg: "Invalid secret annotation: \"${env}\" is not a valid secret ID",
+		},
+		{
+			name:     "variable bound to two secrets",
+			key:      "secret",
+			value:    "STRIPE_KEY=stripe-key,STRIPE_KEY=stripe-live",
+			errorMsg: "Invalid secret annotation: STRIPE_KEY is already read from secret stripe-key",
+		},
+		{
+			name:  "pubsub topic",
+			key:   "pubsub",
+			value: "topic=orders",
+			check: func(h *Handler) bool {
+				return h.PubSub != nil && h.PubSub.TopicID == "orders" && h.PubSub.SubscriptionID == ""
+			},
+		},
+		{
+			name:  "pubsub topic and subscription",
+			key:   "pubsub",
+			value: "topic=orders subscription=orders-billing",
+			check: func(h *Handler) bool {
+				return h.PubSub != nil && h.PubSub.TopicID == "orders" && h.PubSub.SubscriptionID == "orders-billing"
+			},
+		},
+		{
+			name:     "pubsub without topic",
+			key:      "pubsub",
+			value:    "subscription=orders-billing",
+			errorMsg: "Invalid pubsub annotation: topic is required",
+		},
+		{
+			name:     "pubsub repeated topic",
+			key:      "pubsub",
+			value:    "topic=orders topic=invoices",
+			errorMsg: "Invalid pubsub annotation: topic given more than once",
+		},
+		{
+			name:     "pubsub invalid topic",
+			key:      "pubsub",
+			value:    "topic=9orders",
+			errorMsg: "Invalid pubsub annotation: topic must be 3-255 characters",
+		},
+		{
+			name:     "schedule with invalid field",
+			key:      "schedule",
+			value:    "0 3 * * $",
+			errorMsg: "Invalid schedule annotation: invalid cron field",
+		},
+		{
+			name:  "iam roles",
+			key:   "iam-role",
+			value: "roles/pubsub.publisher, projects/acme-prod/roles/invoiceWriter",
+			check: func(h *Handler) bool {
+				return len(h.IAMRoles) == 2 && h.IAMRoles[0] == "roles/pubsub.publisher" &&
+					h.IAMRoles[1] == "projects/acme-prod/roles/invoiceWriter"
+			},
+		},
+		{
+			name:     "invalid iam role",
+			key:      "iam-role",
+			value:    "pubsub.publisher",
+			errorMsg: "Invalid iam-role annotation",
+		},
+		{
+			name:  "openapi extension",
+			key:   "openapi-ext",
+			value: "x-google-audiences=123.apps.googleusercontent.com",
+			check: func(h *Handler) bool {
+				return h.OpenAPIExtensions["x-google-audiences"] == "123.apps.googleusercontent.com"
+			},
+		},
+		{
+			name:     "openapi extension without value",
+			key:      "openapi-ext",
+			value:    "x-google-audiences",
+			errorMsg: "Invalid openapi-ext annotation",
+		},
+		{
+			name:  "auth with issuer",
+			key:   "auth",
+			value: "required issuer=https://auth.example.com/ audience=orders-api strict",
+			check: func(h *Handler) bool {
+				return h.Auth == AuthConfig{
+					Type:         AuthRequired,
+					JWKSEndpoint: "https://auth.example.com/.well-known/jwks.json",
+					Issuer:       "https://auth.example.com/",
+					Audience:     "orders-api",
+					StrictJWKS:   true,
+				}
+			},
+		},
+		{
+			name:  "auth with roles claim",
+			key:   "auth",
+			value: "required roles-claim=groups",
+			check: func(h *Handler) bool {
+				return h.Auth.RolesClaimKey == "groups" && h.Auth.EffectiveRolesClaimKey() == "groups"
+			},
+		},
+		{
+			name:  "roles",
+			key:   "roles",
+			value: "admin, moderator,admin",
+			check: func(h *Handler) bool {
+				return len(h.RequiredRoles) == 2 && h.RequiredRoles[0] == "admin" && h.RequiredRoles[1] == "moderator"
+			},
+		},
+		{
+			name:     "empty roles",
+			key:      "roles",
+			value:    " , ",
+			errorMsg: "Invalid roles annotation",
+		},
+		{
+			name:     "invalid role name",
+			key:      "roles",
+			value:    "admin,-moderator",
+			errorMsg: "not a valid role name",
+		},
+		{
+			name:  "auth with explicit jwks",
+			key:   "auth",
+			value: "Optional jwks=http://localhost:8081/keys",
+			check: func(h *Handler) bool {
+				return h.Auth.Type == AuthOptional && h.Auth.JWKSEndpoint == "http://localhost:8081/keys" && h.Auth.Issuer == ""
+			},
+		},
+		{
+			name:     "auth jwks over plain http",
+			key:      "auth",
+			value:    "required jwks=http://auth.example.com/keys",
+			errorMsg: "jwks must use https",
+		},
+		{
+			name:     "auth audience without issuer",
+			key:      "auth",
+			value:    "required audience=orders-api",
+			errorMsg: "audience and strict need issuer or jwks",
+		},
+		{
+			name:     "auth none with options",
+			key:      "auth",
+			value:    "none issuer=https://auth.example.com",
+			errorMsg: "auth none takes no options",
+		},
+		{
+			name:     "auth unknown option",
+			key:      "auth",
+			value:    "required scopes=read",
+			errorMsg: "unknown auth option",
+		},
+		{
+			name:     "invalid auth",
+			key:      "auth",
+			value:    "sometimes",
+			errorMsg: "Invalid auth annotation",
+		},
+		{
+			name:     "unknown annotation",
+			key:      "deploy",
+			errorMsg: "Unknown annotation type: deploy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &Handler{}
+			err := ApplyAnnotation(handler, tt.key, tt.value)
+
+			if tt.errorMsg != "" {
+				if err == nil || !containsString(err.Error(), tt.errorMsg) {
+					t.Errorf("ApplyAnnotation() error = %v, want error containing %q", err, tt.errorMsg)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ApplyAnnotation() unexpected error: %v", err)
+			}
+			if !tt.check(handler) {
+				t.Errorf("ApplyAnnotation() did not apply %s %q: %+v", tt.key, tt.value, handler)
+			}
+		})
+	}
+}
+
+func TestParseCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *CORSConfig
+		wantErr string
+	}{
+		{
+			name:  "origins only",
+			value: "origins=*",
+			want:  &CORSConfig{AllowedOrigins: []string{"*"}},
+		},
+		{
+			name:  "all options",
+			value: "origins=https://a.example.com, https://b.example.com max-age=600 expose=X-Total-Count,Link",
+			want: &CORSConfig{
+				AllowedOrigins: []string{"https://a.example.com", "https://b.example.com"},
+				MaxAge:         600,
+				ExposedHeaders: []string{"X-Total-Count", "Link"},
+			},
+		},
+		{
+			name:  "credentials",
+			value: "origins=https://app.example.com credentials=true",
+			want: &CORSConfig{
+				AllowedOrigins:   []string{"https://app.example.com"},
+				AllowCredentials: true,
+			},
+		},
+		{
+			name:    "non-numeric max-age",
+			value:   "origins=* max-age=10m",
+			wantErr: "max-age must be a number of seconds",
+		},
+		{
+			name:    "invalid credentials",
+			value:   "origins=https://app.example.com credentials=yes",
+			wantErr: "credentials must be true or false",
+		},
+		{
+			name:    "unknown option",
+			value:   "origins=* methods=GET",
+			wantErr: `unknown cors option "methods"`,
+		},
+		{
+			name:    "missing origins",
+			value:   "max-age=600",
+			wantErr: "cors must be in format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCORS(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !containsString(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseCORS() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCORS() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got.AllowedOrigins, tt.want.AllowedOrigins) {
+				t.Errorf("AllowedOrigins = %v, want %v", got.AllowedOrigins, tt.want.AllowedOrigins)
+			}
+			if got.MaxAge != tt.want.MaxAge {
+				t.Errorf("MaxAge = %d, want %d", got.MaxAge, tt.want.MaxAge)
+			}
+			if !reflect.DeepEqual(got.ExposedHeaders, tt.want.ExposedHeaders) {
+				t.Errorf("ExposedHeaders = %v, want %v", got.ExposedHeaders, tt.want.ExposedHeaders)
+			}
+			if got.AllowCredentials != tt.want.AllowCredentials {
+				t.Errorf("AllowCredentials = %v, want %v", got.AllowCredentials, tt.want.AllowCredentials)
+			}
+			if got.Raw != tt.value {
+				t.Errorf("Raw = %q, want %q", got.Raw, tt.value)
+			}
+		})
+	}
+}
+
+func TestCORSConfigAllowsOrigin(t *testing.T) {
+	config := &CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org", "http://*.localhost:3000"}}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://other.example.com", false},
+		{"https://admin.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://ADMIN.Example.org", true},
+		{"https://example.org", false},
+		{"http://admin.example.org", false},
+		{"https://evilexample.org", false},
+		{"https://example.org.evil.com", false},
+		{"https://admin.example.org:8443", false},
+		{"http://web.localhost:3000", true},
+		{"http://web.localhost:4000", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := config.AllowsOrigin(tt.origin); got != tt.want {
+				t.Errorf("AllowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	if !config.HasWildcardSubdomains() {
+		t.Error("HasWildcardSubdomains() = false, want true")
+	}
+	if (&CORSConfig{AllowedOrigins: []string{"*"}}).HasWildcardSubdomains() {
+		t.Error("HasWildcardSubdomains() = true for origins=*, want false")
+	}
+}
+
+func TestParseReturnsHandler(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"files.go": `package files
+
+import "net/http"
+
+// @box:function
+// @box:path GET /files/*
+func Files() http.Handler { return http.FileServer(http.Dir(".")) }
+
+// @box:function
+// @box:path GET /status
+func Status(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /mux
+func Mux(prefix string) http.Handler { return nil }
+`,
+		"ping.go": `package files
+
+import web "net/http"
+
+// @box:function
+// @box:path GET /ping
+func Ping() web.HandlerFunc { return nil }
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := NewParser().ParseDirectory(dir)
+	if err != nil {
+		t.Fatalf("ParseDirectory() error = %v", err)
+	}
+
+	want := map[string]bool{"Files": true, "Ping": true, "Status": false, "Mux": false}
+	if len(result.Handlers) != len(want) {
+		t.Fatalf("Expected %d handlers, got %d", len(want), len(result.Handlers))
+	}
+	for _, handler := range result.Handlers {
+		if handler.ReturnsHandler != want[handler.FunctionName] {
+			t.Errorf("%s: ReturnsHandler = %v, want %v", handler.FunctionName, handler.ReturnsHandler, want[handler.FunctionName])
+		}
+	}
+}
+
+func TestParseDirectoryNestedModule(t *testing.T) {
+	// A monorepo whose handlers live in a service with its own go.mod
+	root := t.TempDir()
+	serviceDir := filepath.Join(root, "services", "api")
+	handlersDir := filepath.Join(serviceDir, "internal", "handlers", "users")
+
+	if err := os.MkdirAll(handlersDir, 0755); err != nil {
+		t.Fatalf("Failed to create handlers dir: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(root, "go.mod"):       "module example.com/monorepo\n\ngo 1.23\n",
+		filepath.Join(serviceDir, "go.mod"): "module example.com/monorepo/services/api // service module\n\ngo 1.23\n",
+		filepath.Join(handlersDir, "users.go"): `package users
+
+// @box:function
+// @box:path GET /api/v1/users
+func ListUsers(w http.ResponseWriter, r *http.Request) {}
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	module, err := FindModule(handlersDir)
+	if err != nil {
+		t.Fatalf("FindModule() error = %v", err)
+	}
+	if module.Path != "example.com/monorepo/services/api" {
+		t.Errorf("module path = %q, want %q", module.Path, "example.com/monorepo/services/api")
+	}
+
+	result, err := NewParser().ParseDirectory(filepath.Join(serviceDir, "internal"))
+	if err != nil {
+		t.Fatalf("ParseDirectory() error = %v", err)
+	}
+	if len(result.Handlers) != 1 {
+		t.Fatalf("Expected 1 handler, got %d", len(result.Handlers))
+	}
+	if got := result.Handlers[0].PackagePath; got != "internal/handlers/users" {
+		t.Errorf("PackagePath = %q, want %q", got, "internal/handlers/users")
+	}
+
+	if _, err := FindModule(t.TempDir()); err == nil {
+		t.Error("FindModule() expected error outside any module")
+	}
+}
+
+func TestParseDirectorySidecars(t *testing.T) {
+	root := t.TempDir()
+	usersDir := filepath.Join(root, "users")
+	if err := os.MkdirAll(usersDir, 0755); err != nil {
+		t.Fatalf("Failed to create users dir: %v", err)
+	}
+	files := map[string]string{
+		// Sidecar-only: no comment annotations at all
+		filepath.Join(usersDir, "users.go"): `package users
+
+func GetUser(w http.ResponseWriter, r *http.Request) {}
+
+func helper() {}
+`,
+		filepath.Join(usersDir, "users.box.yaml"): `handlers:
+  users.GetUser:
+    container: true
+    path: GET /api/v1/users/{id}
+    auth: required
+    env: [JWT_SECRET, USERS_BUCKET]
+    maintainable: false
+`,
+		// Mixed: the sidecar overrides the comment timeout and adds a rate limit
+		filepath.Join(usersDir, "admin.go"): `package users
+
+// @box:function
+// @box:path DELETE /api/v1/users/{id}
+// @box:timeout 10s
+func DeleteUser(w http.ResponseWriter, r *http.Request) {}
+`,
+		filepath.Join(usersDir, "admin.box.yaml"): `handlers:
+  users.DeleteUser:
+    timeout: 30s
+    ratelimit: 10/minute
+`,
+		// Central: the nearer file's sidecar wins over it
+		filepath.Join(root, CentralSidecarFile): `handlers:
+  users.DeleteUser:
+    timeout: 45s
+    auth: required
+`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	result, err := NewParser().ParseDirectory(root)
+	if err != nil {
+		t.Fatalf("ParseDirectory() error = %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+	if len(result.Handlers) != 2 {
+		t.Fatalf("Expected 2 handlers, got %d", len(result.Handlers))
+	}
+
+	handlers := make(map[string]Handler)
+	for _, h := range result.Handlers {
+		handlers[h.FunctionName] = h
+	}
+
+	get := handlers["GetUser"]
+	if get.DeploymentType != DeploymentContainer {
+		t.Errorf("GetUser DeploymentType = %v, want %v", get.DeploymentType, DeploymentContainer)
+	}
+	if get.Route.Method != "GET" || get.Route.Path != "/api/v1/users/{id}" {
+		t.Errorf("GetUser Route = %+v, want GET /api/v1/users/{id}", get.Route)
+	}
+	if get.Auth.Type != AuthRequired {
+		t.Errorf("GetUser Auth = %v, want %v", get.Auth.Type, AuthRequired)
+	}
+	if !reflect.DeepEqual(get.RequiredEnvVars, []string{"JWT_SECRET", "USERS_BUCKET"}) {
+		t.Errorf("GetUser RequiredEnvVars = %v, want [JWT_SECRET USERS_BUCKET]", get.RequiredEnvVars)
+	}
+	if get.Maintainable {
+		t.Error("GetUser Maintainable = true, want false")
+	}
+	if get.LineNumber != 3 {
+		t.Errorf("GetUser LineNumber = %d, want 3 (the function declaration)", get.LineNumber)
+	}
+
+	del := handlers["DeleteUser"]
+	if del.DeploymentType != DeploymentFunction || del.Route.Path != "/api/v1/users/{id}" {
+		t.Errorf("DeleteUser lost its comment annotations: %+v", del)
+	}
+	if del.Timeout != 30*time.Second {
+		t.Errorf("DeleteUser Timeout = %v, want 30s from admin.box.yaml", del.Timeout)
+	}
+	if del.RateLimit == nil || del.RateLimit.Count != 10 {
+		t.Errorf("DeleteUser RateLimit = %+v, want 10/minute", del.RateLimit)
+	}
+	if del.Auth.Type != AuthRequired {
+		t.Errorf("DeleteUser Auth = %v, want %v from %s", del.Auth.Type, AuthRequired, CentralSidecarFile)
+	}
+}
+
+func TestParseDirectorySidecarErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		sidecarName   string
+		sidecar       string
+		errorContains string
+	}{
+		{
+			name:        "unknown function in file sidecar",
+			sidecarName: "users.box.yaml",
+			sidecar: `handlers:
+  users.GetUsr:
+    function: true
+`,
+			errorContains: "users.box.yaml declares annotations for users.GetUsr, but users.go has no such function",
+		},
+		{
+			name:        "unknown function in central sidecar",
+			sidecarName: CentralSidecarFile,
+			sidecar: `handlers:
+  accounts.GetUser:
+    function: true
+`,
+			errorContains: "declares annotations for accounts.GetUser",
+		},
+		{
+			name:        "invalid annotation value",
+			sidecarName: "users.box.yaml",
+			sidecar: `handlers:
+  users.GetUser:
+    function: true
+    ratelimit: lots
+`,
+			errorContains: "Invalid ratelimit annotation",
+		},
+		{
+			name:        "invalid handler key",
+			sidecarName: "users.box.yaml",
+			sidecar: `handlers:
+  GetUser:
+    function: true
+`,
+			errorContains: "expected package.Function",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			files := map[string]string{
+				filepath.Join(root, "users.go"):     "package users\n\nfunc GetUser(w http.ResponseWriter, r *http.Request) {}\n",
+				filepath.Join(root, tt.sidecarName): tt.sidecar,
+			}
+			for path, content := range files {
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", path, err)
+				}
+			}
+
+			result, err := NewParser().ParseDirectory(root)
+			if err != nil {
+				t.Fatalf("ParseDirectory() error = %v", err)
+			}
+			if len(result.Errors) != 1 {
+				t.Fatalf("Expected 1 error, got %+v", result.Errors)
+			}
+			if !containsString(result.Errors[0].Message, tt.errorContains) {
+				t.Errorf("error = %q, want it to contain %q", result.Errors[0].Message, tt.errorContains)
+			}
+		})
+	}
+}
+
+func TestParseDirectoryConcurrent(t *testing.T) {
+	dir, paths, _ := writeHandlerTree(t, 40)
+
+	// A broken file in the middle of the tree
+	broken := filepath.Join(dir, "pkg1", "broken.go")
+	if err := os.WriteFile(broken, []byte("package pkg1\n\nfunc Broken( {\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", broken, err)
+	}
+
+	// Serial reference: files in walk (lexical) order
+	expected := &ParsedAnnotations{Handlers: make([]Handler, 0), Errors: make([]ParseError, 0)}
+	serial := NewParser()
+	walked := append([]string{broken}, paths...)
+	sort.Strings(walked)
+	for _, path := range walked {
+		fileResult, err := serial.ParseFile(path)
+		if err != nil {
+			expected.Errors = append(expected.Errors, ParseError{FilePath: path, Message: "Failed to parse file: " + err.Error()})
+			continue
+		}
+		expected.Handlers = append(expected.Handlers, fileResult.Handlers...)
+		expected.Errors = append(expected.Errors, fileResult.Errors...)
+	}
+
+	// Several directory parses share one parser and its package path cache
+	parser := NewParser()
+	results := make([]*ParsedAnnotations, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := parser.ParseDirectory(dir)
+			if err != nil {
+				t.Errorf("ParseDirectory() error = %v", err)
+				return
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if len(result.Handlers) != 40*benchHandlersPerFile {
+			t.Fatalf("parse %d: expected %d handlers, got %d", i, 40*benchHandlersPerFile, len(result.Handlers))
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("parse %d: result differs from a serial parse in file order", i)
+		}
+		if len(result.Errors) != 1 || result.Errors[0].FilePath != broken {
+			t.Errorf("parse %d: errors = %+v, want one for %s", i, result.Errors, broken)
+		}
+	}
+}
+
+func TestValidator(t *testing.T) {
+	validator := NewValidator()
+
+	tests := []struct {
+		name          string
+		handler       Handler
+		wantErrors    int
+		errorContains string
+	}{
+		{
+			name: "valid function handler",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthRequired},
+				Summary:        "Fetch the test resource",
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "undocumented auth-required handler",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthRequired},
+			},
+			wantErrors:    1,
+			errorContains: "has no @box:summary or @box:description",
+		},
+		{
+			name: "auth-required handler with description only",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthRequired},
+				Description:    "Returns the test resource.",
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "missing deployment type",
+			handler: Handler{
+				FunctionName: "Test",
+				Route:        Route{Method: "GET", Path: "/test"},
+			},
+			wantErrors:    1,
+			errorContains: "deployment type",
+		},
+		{
+			name: "missing route",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+			},
+			wantErrors:    1,
+			errorContains: "path",
+		},
+		{
+			name: "invalid memory for function",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Memory:         "99MB",
+			},
+			wantErrors:    1,
+			errorContains: "memory",
+		},
+		{
+			name: "concurrency on function (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Concurrency:    10,
+			},
+			wantErrors:    1,
+			errorContains: "Concurrency",
+		},
+		{
+			name: "invalid tag",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Tags:           []string{"users", "bad tag:"},
+			},
+			wantErrors:    1,
+			errorContains: "Invalid tag",
+		},
+		{
+			name: "reserved metrics path (warning)",
+			handler: Handler{
+				FunctionName:   "Metrics",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/metrics"},
+			},
+			wantErrors:    1,
+			errorContains: "reserved for the built-in metrics endpoint",
+		},
+		{
+			name: "non-GET on reserved path",
+			handler: Handler{
+				FunctionName:   "PushMetrics",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/metrics"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "valid preloads",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Preloads:       []string{"/static/app.css", "https://cdn.example.com/app.js"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "invalid preload",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Preloads:       []string{"static/app.css", "//cdn.example.com/app.js", "ftp://example.com/a.css"},
+			},
+			wantErrors:    3,
+			errorContains: "Invalid preload resource",
+		},
+		{
+			name: "preload on POST (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Preloads:       []string{"/static/app.css"},
+			},
+			wantErrors:    1,
+			errorContains: "only sent on GET",
+		},
+		{
+			name: "valid openapi extensions",
+			handler: Handler{
+				FunctionName:      "Test",
+				DeploymentType:    DeploymentFunction,
+				Route:             Route{Method: "GET", Path: "/test"},
+				OpenAPIExtensions: map[string]string{"x-google-audiences": "123.apps.googleusercontent.com", "x-team": "billing"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "openapi extension without x- prefix",
+			handler: Handler{
+				FunctionName:      "Test",
+				DeploymentType:    DeploymentFunction,
+				Route:             Route{Method: "GET", Path: "/test"},
+				OpenAPIExtensions: map[string]string{"audiences": "123.apps.googleusercontent.com"},
+			},
+			wantErrors:    1,
+			errorContains: "must start with 'x-'",
+		},
+		{
+			name: "openapi extension overriding generated backend",
+			handler: Handler{
+				FunctionName:      "Test",
+				DeploymentType:    DeploymentFunction,
+				Route:             Route{Method: "GET", Path: "/test"},
+				OpenAPIExtensions: map[string]string{"x-google-backend": "https://example.com"},
+			},
+			wantErrors:    1,
+			errorContains: "cannot be overridden",
+		},
+		{
+			name: "roles with required auth",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "DELETE", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthRequired},
+				Summary:        "Delete the test resource",
+				RequiredRoles:  []string{"admin"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "roles without required auth",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "DELETE", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthOptional},
+				RequiredRoles:  []string{"admin"},
+			},
+			wantErrors:    1,
+			errorContains: "@box:roles requires @box:auth required",
+		},
+		{
+			name: "cors max-age and expose",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: 600, ExposedHeaders: []string{"X-Total-Count", "Link"}},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "cors negative max-age",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: -1},
+			},
+			wantErrors:    1,
+			errorContains: "max-age must be a positive number",
+		},
+		{
+			name: "cors max-age above browser cap (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: 604800},
+			},
+			wantErrors:    1,
+			errorContains: "exceeds what browsers honour",
+		},
+		{
+			name: "cors invalid exposed header",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Total Count:"}},
+			},
+			wantErrors:    1,
+			errorContains: "expose must list header names",
+		},
+		{
+			name: "cors wildcard subdomain",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"https://*.example.com", "http://*.localhost:3000"}},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "cors wildcard not leading",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"https://app.*.example.com"}},
+			},
+			wantErrors:    1,
+			errorContains: "must be a leading subdomain",
+		},
+		{
+			name: "cors wildcard too broad",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"https://*.com"}},
+			},
+			wantErrors:    1,
+			errorContains: "too broad",
+		},
+		{
+			name: "cors wildcard with path",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"https://*.example.com/app"}},
+			},
+			wantErrors:    1,
+			errorContains: "must be followed by a host name",
+		},
+		{
+			name: "cors credentials with any origin (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			},
+			wantErrors:    1,
+			errorContains: "credentials=true with origins=*",
+		},
+		{
+			name: "very short timeout (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Timeout:        100 * time.Millisecond,
+			},
+			wantErrors:    1,
+			errorContains: "Timeout is very short",
+		},
+		{
+			name: "paginated with exposed headers",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Total-Count", "Link"}},
+				Paginated:      true,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "paginated without exposed count (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CORS:           &CORSConfig{AllowedOrigins: []string{"*"}},
+				Paginated:      true,
+			},
+			wantErrors:    1,
+			errorContains: "Add X-Total-Count to @box:cors expose",
+		},
+		{
+			name: "paginated POST (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Paginated:      true,
+			},
+			wantErrors:    1,
+			errorContains: "Pagination applies to GET list endpoints",
+		},
+		{
+			name: "disjoint allow and deny ranges",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				AllowIPs:       mustParseIPNetworks(t, "10.0.0.0/8"),
+				DenyIPs:        mustParseIPNetworks(t, "192.168.0.0/16"),
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "overlapping allow and deny ranges",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				AllowIPs:       mustParseIPNetworks(t, "10.0.0.0/8"),
+				DenyIPs:        mustParseIPNetworks(t, "192.168.0.0/16,10.1.0.0/16"),
+			},
+			wantErrors:    1,
+			errorContains: "Denied range 10.1.0.0/16 overlaps allowed range 10.0.0.0/8",
+		},
+		{
+			name: "container with cpu always",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/test"},
+				CPUAlways:      true,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "cpu always and throttled",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/test"},
+				CPUAlways:      true,
+				CPUThrottled:   true,
+			},
+			wantErrors:    1,
+			errorContains: "mutually exclusive",
+		},
+		{
+			name: "function with cpu always",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				CPUAlways:      true,
+			},
+			wantErrors:    1,
+			errorContains: "Only @box:container services can keep CPU allocated",
+		},
+		{
+			name: "function with cpu throttled (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				CPUThrottled:   true,
+			},
+			wantErrors:    1,
+			errorContains: "@box:cpu-throttled has no effect",
+		},
+		{
+			name: "secret bindings",
+			handler: Handler{
+				FunctionName:    "Test",
+				DeploymentType:  DeploymentFunction,
+				Route:           Route{Method: "GET", Path: "/test"},
+				RequiredEnvVars: []string{"JWT_SECRET"},
+				Secrets:         map[string]string{"DATABASE_URL": "orders-db-${env}"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "secret for a platform variable",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Secrets:        map[string]string{"PORT": "port"},
+			},
+			wantErrors:    1,
+			errorContains: "PORT is set by the platform",
+		},
+		{
+			name: "variable in both env and secret",
+			handler: Handler{
+				FunctionName:    "Test",
+				DeploymentType:  DeploymentFunction,
+				Route:           Route{Method: "GET", Path: "/test"},
+				RequiredEnvVars: []string{"JWT_SECRET"},
+				Secrets:         map[string]string{"JWT_SECRET": "jwt-signing-key"},
+			},
+			wantErrors:    1,
+			errorContains: "JWT_SECRET is declared by both @box:env and @box:secret",
+		},
+		{
+			name: "secret on a lambda (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Secrets:        map[string]string{"STRIPE_KEY": "stripe-key"},
+			},
+			wantErrors:    1,
+			errorContains: "only injected into Cloud Functions and Cloud Run",
+		},
+		{
+			name: "container with instance bounds",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				MinInstances:   2,
+				MaxInstances:   50,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "min instances above max instances",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				MinInstances:   5,
+				MaxInstances:   3,
+			},
+			wantErrors:    1,
+			errorContains: "min-instances 5 exceeds max-instances 3",
+		},
+		{
+			name: "warm instances without memory (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				MinInstances:   1,
+			},
+			wantErrors:    1,
+			errorContains: "1 warm instances are billed even when idle",
+		},
+		{
+			name: "warm function with memory",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Memory:         "512MB",
+				MinInstances:   1,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "max instances only needs no memory",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				MaxInstances:   5,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "lambda with instance bounds (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Route:          Route{Method: "GET", Path: "/test"},
+				MaxInstances:   5,
+			},
+			wantErrors:    1,
+			errorContains: "Instance bounds only apply to Cloud Functions and Cloud Run, not lambda handlers",
+		},
+		{
+			name: "cached GET",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Cache:          &CacheConfig{TTL: 5 * time.Minute},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "cached POST (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Cache:          &CacheConfig{TTL: 5 * time.Minute},
+			},
+			wantErrors:    1,
+			errorContains: "Only GET responses are cached",
+		},
+		{
+			name: "cached authenticated GET without vary (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthOptional},
+				Cache:          &CacheConfig{TTL: 5 * time.Minute},
+			},
+			wantErrors:    1,
+			errorContains: "add vary=Authorization",
+		},
+		{
+			name: "cached authenticated GET varying by caller",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Auth:           AuthConfig{Type: AuthOptional},
+				Cache:          &CacheConfig{TTL: 5 * time.Minute, VaryHeaders: []string{"Authorization"}},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "circuit breaker",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 5, ResetTimeout: 30 * time.Second},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "circuit breaker on scheduled function (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+				CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 5, ResetTimeout: 30 * time.Second},
+			},
+			wantErrors:    1,
+			errorContains: "@box:circuit-breaker has no effect",
+		},
+		{
+			name: "retried GET",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Retry:          &RetryConfig{Attempts: 3, BackoffType: RetryBackoffExponential, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "retried POST (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Retry:          &RetryConfig{Attempts: 3, BackoffType: RetryBackoffExponential, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+			},
+			wantErrors:    1,
+			errorContains: "POST requests are not retried unless the handler is marked @box:idempotent",
+		},
+		{
+			name: "retried idempotent POST",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Retry:          &RetryConfig{Attempts: 3, BackoffType: RetryBackoffExponential, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+				Idempotent:     true,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "retry with a single attempt (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Retry:          &RetryConfig{Attempts: 1, BackoffType: RetryBackoffExponential, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+			},
+			wantErrors:    1,
+			errorContains: "never retries",
+		},
+		{
+			name: "custom responses",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/test"},
+				Responses:      map[int]string{202: "Accepted", 404: "Not found"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "response status out of range",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Responses:      map[int]string{999: "Nope"},
+			},
+			wantErrors:    1,
+			errorContains: "Invalid HTTP status code: 999",
+		},
+		{
+			name: "unregistered response status (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Responses:      map[int]string{299: "Custom success"},
+			},
+			wantErrors:    1,
+			errorContains: "not a registered HTTP status code",
+		},
+		{
+			name: "task queue target",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/tasks/orders"},
+				TaskQueue:      "orders",
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "task queue target with GET (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/tasks/orders"},
+				TaskQueue:      "orders",
+			},
+			wantErrors:    1,
+			errorContains: "Cloud Tasks delivers tasks with POST",
+		},
+		{
+			name: "task queue container target (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Route:          Route{Method: "POST", Path: "/tasks/orders"},
+				TaskQueue:      "orders",
+			},
+			wantErrors:    1,
+			errorContains: "use @box:function",
+		},
+		{
+			name: "scheduled function without path",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "scheduled function with path",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/nightly"},
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors:    1,
+			errorContains: "cannot be combined with @box:path",
+		},
+		{
+			name: "scheduled container",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors:    1,
+			errorContains: "must be deployed with @box:function",
+		},
+		{
+			name: "scheduled with seconds field",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Schedule:       &ScheduleConfig{Cron: "30 0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors:    1,
+			errorContains: "does not support a seconds field",
+		},
+		{
+			name: "scheduled with unknown time zone",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "Mars/Olympus_Mons"},
+			},
+			wantErrors:    1,
+			errorContains: "Unknown time zone",
+		},
+		{
+			name: "env vars",
+			handler: Handler{
+				FunctionName:    "Test",
+				DeploymentType:  DeploymentFunction,
+				Route:           Route{Method: "GET", Path: "/test"},
+				RequiredEnvVars: []string{"DATABASE_URL", "JWT_SECRET"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "reserved env var",
+			handler: Handler{
+				FunctionName:    "Test",
+				DeploymentType:  DeploymentFunction,
+				Route:           Route{Method: "GET", Path: "/test"},
+				RequiredEnvVars: []string{"PORT"},
+			},
+			wantErrors:    1,
+			errorContains: "PORT is set by the platform",
+		},
+		{
+			name: "pubsub subscriber without path",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				PubSub:         &PubSubConfig{TopicID: "orders"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "pubsub subscriber with path",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "POST", Path: "/orders/events"},
+				PubSub:         &PubSubConfig{TopicID: "orders"},
+			},
+			wantErrors:    1,
+			errorContains: "cannot be combined with @box:path",
+		},
+		{
+			name: "pubsub subscriber with schedule",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				PubSub:         &PubSubConfig{TopicID: "orders"},
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors:    1,
+			errorContains: "a handler has one trigger",
+		},
+		{
+			name: "pubsub container",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentContainer,
+				PubSub:         &PubSubConfig{TopicID: "orders"},
+			},
+			wantErrors:    1,
+			errorContains: "must be deployed with @box:function",
+		},
+		{
+			name: "valid lambda handler",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Memory:         "1536MB",
+				Timeout:        15 * time.Minute,
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "lambda memory over the limit",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Memory:         "16GB",
+			},
+			wantErrors:    1,
+			errorContains: "between 128MB and 10240MB",
+		},
+		{
+			name: "lambda timeout over the limit",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Route:          Route{Method: "GET", Path: "/test"},
+				Timeout:        20 * time.Minute,
+			},
+			wantErrors:    1,
+			errorContains: "Lambda timeout cannot exceed 900s",
+		},
+		{
+			name: "scheduled lambda",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentLambda,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+			},
+			wantErrors:    1,
+			errorContains: "need @box:function",
+		},
+		{
+			name: "proxy route",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentProxy,
+				Route:          Route{Method: "GET", Path: "/payments/{id}"},
+				Proxy:          &ProxyConfig{Upstream: "https://payments.example.com", Environments: map[string]string{"dev": "http://localhost:9000"}},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "proxy over plain HTTP (warning)",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentProxy,
+				Route:          Route{Method: "GET", Path: "/payments"},
+				Proxy:          &ProxyConfig{Upstream: "http://payments.example.com"},
+			},
+			wantErrors:    1,
+			errorContains: "uses plain HTTP",
+		},
+		{
+			name: "proxy replaced by a deployment annotation",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentFunction,
+				Route:          Route{Method: "GET", Path: "/payments"},
+				Proxy:          &ProxyConfig{Upstream: "https://payments.example.com"},
+			},
+			wantErrors:    1,
+			errorContains: "remove @box:function",
+		},
+		{
+			name: "scheduled proxy",
+			handler: Handler{
+				FunctionName:   "Test",
+				DeploymentType: DeploymentProxy,
+				Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+				Proxy:          &ProxyConfig{Upstream: "https://payments.example.com"},
+			},
+			wantErrors:    1,
+			errorContains: "Proxy routes forward HTTP requests",
+		},
+		{
+			name: "custom middleware",
+			handler: Handler{
+				FunctionName:     "Test",
+				DeploymentType:   DeploymentFunction,
+				Route:            Route{Method: "GET", Path: "/test"},
+				CustomMiddleware: []string{"ResolveTenant", "RequirePlan"},
+			},
+			wantErrors: 0,
+		},
+		{
+			name: "repeated custom middleware (warning)",
+			handler: Handler{
+				FunctionName:     "Test",
+				DeploymentType:   DeploymentFunction,
+				Route:            Route{Method: "GET", Path: "/test"},
+				CustomMiddleware: []string{"ResolveTenant", "ResolveTenant"},
+			},
+			wantErrors:    1,
+			errorContains: "listed more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := validator.validateHandler(tt.handler)
+
+			if len(errors) != tt.wantErrors {
+				t.Errorf("validateHandler() got %d errors, want %d", len(errors), tt.wantErrors)
+				for _, err := range errors {
+					t.Logf("  Error: %s", err.Reason)
+				}
+			}
+
+			if tt.errorContains != "" && len(errors) > 0 {
+				found := false
+				for _, err := range errors {
+					if containsString(err.Reason, tt.errorContains) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("Expected error containing %q, but not found in: %v", tt.errorContains, errors)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatorRegisteredMiddleware(t *testing.T) {
+	handler := Handler{
+		FunctionName:     "Test",
+		DeploymentType:   DeploymentFunction,
+		Route:            Route{Method: "GET", Path: "/test"},
+		CustomMiddleware: []string{"ResolveTenant", "RequirePlan"},
+	}
+
+	validator := NewValidator()
+	validator.SetRegisteredMiddleware([]string{"ResolveTenant"})
+
+	errors := validator.Validate([]Handler{handler})
+	if len(errors) != 1 {
+		t.Fatalf("Validate() got %d errors, want 1: %v", len(errors), errors)
+	}
+	if errors[0].Severity != SeverityWarning || !containsString(errors[0].Reason, `Unknown middleware "RequirePlan"`) {
+		t.Errorf("Validate() = %+v, want an unknown middleware warning", errors[0])
+	}
+}
+
+func TestAutoPromote(t *testing.T) {
+	route := Route{Method: "POST", Path: "/jobs"}
+	handlers := []Handler{
+		{FunctionName: "Export", DeploymentType: DeploymentFunction, Route: route, Timeout: 10 * time.Minute},
+		{FunctionName: "Quick", DeploymentType: DeploymentFunction, Route: route, Timeout: 30 * time.Second},
+		{FunctionName: "AtLimit", DeploymentType: DeploymentFunction, Route: route, Timeout: MaxFunctionTimeout},
+		{FunctionName: "Forever", DeploymentType: DeploymentFunction, Route: route, Timeout: 2 * time.Hour},
+		{FunctionName: "Stream", DeploymentType: DeploymentContainer, Route: route, Timeout: 30 * time.Minute},
+	}
+
+	promoted := AutoPromote(handlers)
+
+	if len(promoted) != 1 || promoted[0].FunctionName != "Export" {
+		t.Fatalf("AutoPromote() promoted %+v, want only Export", promoted)
+	}
+	want := []DeploymentType{DeploymentContainer, DeploymentFunction, DeploymentFunction, DeploymentFunction, DeploymentContainer}
+	for i, handler := range handlers {
+		if handler.DeploymentType != want[i] {
+			t.Errorf("%s deployment = %s, want %s", handler.FunctionName, handler.DeploymentType, want[i])
+		}
+	}
+
+	// The promoted handler now validates; one over the Cloud Run limit still fails
+	validator := NewValidator()
+	if errs := validator.Validate(handlers[:1]); len(errs) != 0 {
+		t.Errorf("promoted handler validation = %+v, want none", errs)
+	}
+	if errs := validator.Validate(handlers[3:4]); len(errs) == 0 {
+		t.Error("expected a timeout error for a function over the Cloud Run limit")
+	}
+}
+
+func TestValidatorConfigDefaults(t *testing.T) {
+	source := `package test
+
+import "net/http"
+
+// @box:function
+// @box:path GET /reports
+func ListReports(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /status
+// @box:auth none
+// @box:memory 128MB
+// @box:timeout 5s
+func Status(w http.ResponseWriter, r *http.Request) {}
+
+// @box:container
+// @box:path POST /exports
+func Export(w http.ResponseWriter, r *http.Request) {}
+`
+	tmpFile := filepath.Join(t.TempDir(), "test.go")
+	if err := os.WriteFile(tmpFile, []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write temp file: %v", err)
+	}
+	result, err := NewParser().ParseFile(tmpFile)
+	if err != nil || len(result.Handlers) != 3 {
+		t.Fatalf("ParseFile() = %+v, %v; want 3 handlers", result, err)
+	}
+	handlers := result.Handlers
+
+	cfg := &config.BoxConfig{Defaults: config.Defaults{Memory: "512MB", Timeout: 30 * time.Second, Auth: "required"}}
+	validator := NewValidatorWithConfig(cfg)
+	for _, finding := range validator.Validate(handlers) {
+		if finding.IsError() {
+			t.Fatalf("Validate() error = %+v, want none", finding)
+		}
+	}
+
+	validator.ApplyDefaults(handlers)
+
+	list, status, export := handlers[0], handlers[1], handlers[2]
+	if list.Memory != "512MB" || list.Auth.Type != AuthRequired {
+		t.Errorf("ListReports memory %q, auth %s; want the configured defaults", list.Memory, list.Auth.Type)
+	}
+	if list.Timeout != 0 {
+		t.Errorf("ListReports timeout = %s, want it left to the generators' default", list.Timeout)
+	}
+	// Explicit annotations win, including an explicit "none"
+	if status.Memory != "128MB" || status.Auth.Type != AuthNone || status.Timeout != 5*time.Second {
+		t.Errorf("Status = memory %q, auth %s, timeout %s; want its own annotations", status.Memory, status.Auth.Type, status.Timeout)
+	}
+	if export.Memory != "" || export.Auth.Type != AuthRequired {
+		t.Errorf("Export memory %q, auth %s; want no memory default for containers", export.Memory, export.Auth.Type)
+	}
+
+	// Defaults are validated like annotations
+	invalid := NewValidatorWithConfig(&config.BoxConfig{Defaults: config.Defaults{Memory: "3GB", Timeout: 20 * time.Minute}})
+	var errs []AnnotationError
+	unannotated := Handler{FunctionName: "Bare", DeploymentType: DeploymentFunction, Route: Route{Method: "GET", Path: "/bare"}}
+	for _, finding := range invalid.Validate([]Handler{unannotated}) {
+		if finding.IsError() {
+			errs = append(errs, finding)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Validate() with invalid defaults = %+v, want memory and timeout errors", errs)
+	}
+}
+
+func TestValidateServiceGrouping(t *testing.T) {
+	validator := NewValidator()
+
+	handlers := []Handler{
+		{
+			FunctionName:   "ListRooms",
+			PackageName:    "chat",
+			DeploymentType: DeploymentContainer,
+			Route:          Route{Method: "GET", Path: "/api/v1/rooms"},
+			Auth:           AuthConfig{Type: AuthNone},
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			DeploymentType: DeploymentContainer,
+			Route:          Route{Method: "GET", Path: "/api/v1/chat/{id}/stream"},
+			Auth:           AuthConfig{Type: AuthRequired},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: DeploymentContainer,
+			Route:          Route{Method: "GET", Path: "/api/v1/users"},
+			Auth:           AuthConfig{Type: AuthRequired},
+		},
+		{
+			// Functions deploy individually, so package mixing is irrelevant
+			FunctionName:   "PublicUsers",
+			PackageName:    "users",
+			DeploymentType: DeploymentFunction,
+			Route:          Route{Method: "GET", Path: "/api/v1/public/users"},
+			Auth:           AuthConfig{Type: AuthNone},
+		},
+	}
+
+	errors := validator.ValidateServiceGrouping(handlers)
+
+	if len(errors) != 1 {
+		t.Fatalf("ValidateServiceGrouping() got %d findings, want 1: %v", len(errors), errors)
+	}
+
+	finding := errors[0]
+	if finding.Handler != "chat" {
+		t.Errorf("Handler = %v, want chat", finding.Handler)
+	}
+	if finding.Severity != SeverityInfo {
+		t.Errorf("Severity = %v, want %v", finding.Severity, SeverityInfo)
+	}
+	if finding.IsError() {
+		t.Error("Expected mixed-auth finding not to be an error")
+	}
+	if !containsString(finding.Reason, "GET /api/v1/rooms") || !containsString(finding.Reason, "GET /api/v1/chat/{id}/stream") {
+		t.Errorf("Expected reason to list both routes, got: %s", finding.Reason)
+	}
+}
+
+func TestValidateEnvVarConsistency(t *testing.T) {
+	validator := NewValidator()
+
+	handlers := []Handler{
+		{
+			FunctionName:    "ListRooms",
+			PackageName:     "chat",
+			DeploymentType:  DeploymentContainer,
+			RequiredEnvVars: []string{"REDIS_URL", "JWT_SECRET"},
+		},
+		{
+			FunctionName:    "StreamChat",
+			PackageName:     "chat",
+			DeploymentType:  DeploymentContainer,
+			RequiredEnvVars: []string{"Redis_Url", "JWT_SECRET"},
+		},
+		{
+			// Another service has its own environment
+			FunctionName:    "ListUsers",
+			PackageName:     "users",
+			DeploymentType:  DeploymentContainer,
+			RequiredEnvVars: []string{"redis_url"},
+		},
+		{
+			// Functions deploy individually
+			FunctionName:    "PublicRooms",
+			PackageName:     "chat",
+			DeploymentType:  DeploymentFunction,
+			RequiredEnvVars: []string{"redis_url"},
+		},
+	}
+
+	errors := validator.ValidateEnvVarConsistency(handlers)
+
+	if len(errors) != 1 {
+		t.Fatalf("ValidateEnvVarConsistency() got %d findings, want 1: %v", len(errors), errors)
+	}
+	if errors[0].Handler != "StreamChat" || !errors[0].IsError() {
+		t.Errorf("finding = %+v, want an error on StreamChat", errors[0])
+	}
+	if !containsString(errors[0].Reason, "Redis_Url conflicts with REDIS_URL declared by ListRooms in service chat") {
+		t.Errorf("unexpected reason: %s", errors[0].Reason)
+	}
+}
+
+func TestRetryConfigDelay(t *testing.T) {
+	tests := []struct {
+		backoff string
+		want    []time.Duration
+	}{
+		{RetryBackoffLinear, []time.Duration{100, 200, 300, 400, 450}},
+		{RetryBackoffExponential, []time.Duration{100, 200, 400, 450, 450}},
+		{RetryBackoffJitter, []time.Duration{100, 200, 400, 450, 450}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backoff, func(t *testing.T) {
+			config := &RetryConfig{BackoffType: tt.backoff, InitialDelay: 100 * time.Millisecond, MaxDelay: 450 * time.Millisecond}
+			for i, want := range tt.want {
+				if got := config.Delay(i + 1); got != want*time.Millisecond {
+					t.Errorf("Delay(%d) = %v, want %v", i+1, got, want*time.Millisecond)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateEnvVarConsistencySecrets(t *testing.T) {
+	validator := NewValidator()
+
+	handlers := []Handler{
+		{
+			FunctionName:   "ListOrders",
+			PackageName:    "orders",
+			DeploymentType: DeploymentContainer,
+			Secrets:        map[string]string{"DATABASE_URL": "orders-db-${env}"},
+		},
+		{
+			FunctionName:   "CreateOrder",
+			PackageName:    "orders",
+			DeploymentType: DeploymentContainer,
+			Secrets:        map[string]string{"DATABASE_URL": "orders-db-${env}", "STRIPE_KEY": "stripe-key"},
+		},
+		{
+			FunctionName:   "RefundOrder",
+			PackageName:    "orders",
+			DeploymentType: DeploymentContainer,
+			Secrets:        map[string]string{"DATABASE_URL": "billing-db-${env}"},
+		},
+		{
+			// Functions deploy individually
+			FunctionName:   "ExportOrders",
+			PackageName:    "orders",
+			DeploymentType: DeploymentFunction,
+			Secrets:        map[string]string{"DATABASE_URL": "warehouse-db-${env}"},
+		},
+	}
+
+	errors := validator.ValidateEnvVarConsistency(handlers)
+
+	if len(errors) != 1 {
+		t.Fatalf("ValidateEnvVarConsistency() got %d findings, want 1: %v", len(errors), errors)
+	}
+	if errors[0].Handler != "RefundOrder" || errors[0].Annotation != "@box:secret" {
+		t.Errorf("finding = %+v, want an @box:secret error on RefundOrder", errors[0])
+	}
+	if !containsString(errors[0].Reason, "DATABASE_URL reads secret billing-db-${env} but ListOrders reads it from orders-db-${env} in service orders") {
+		t.Errorf("unexpected reason: %s", errors[0].Reason)
+	}
+}
+
+// TestValidatorAnnotationNames checks that findings name annotations the parsers accept,
+// so a message never tells users to add an annotation that does not exist
+func TestValidatorAnnotationNames(t *testing.T) {
+	validator := NewValidator()
+
+	handlers := []Handler{
+		{FunctionName: "Bare"},
+		{
+			FunctionName:   "Overloaded",
+			DeploymentType: DeploymentFunction,
+			Route:          Route{Method: "POST", Path: "users"},
+			Auth:           AuthConfig{Type: AuthNone},
+			RequiredRoles:  []string{"admin"},
+			Memory:         "3GB",
+			Concurrency:    5000,
+			RateLimit:      &RateLimitConfig{Count: 0, Period: time.Hour, Raw: "0/hour"},
+			CORS:           &CORSConfig{},
+			Cache:          &CacheConfig{TTL: time.Minute, Raw: "1m"},
+			Timeout:        time.Hour,
+			CPUAlways:      true,
+			CPUThrottled:   true,
+		},
+		{
+			FunctionName:   "Nightly",
+			DeploymentType: DeploymentContainer,
+			Route:          Route{Method: "GET", Path: "/nightly"},
+			Schedule:       &ScheduleConfig{Cron: "0 3 * * *", Timezone: DefaultScheduleTimezone},
+			Timeout:        time.Second,
+		},
+	}
+
+	errors := validator.Validate(handlers)
+	errors = append(errors, validator.ValidateUniquePaths(append(handlers, handlers[2]))...)
+	if len(errors) == 0 {
+		t.Fatal("Validate() reported nothing; the handlers above should trip many rules")
+	}
+
+	mentioned := regexp.MustCompile(`@(\w+):([\w-]+)`)
+	for _, err := range errors {
+		for _, text := range []string{err.Annotation, err.Reason} {
+			for _, match := range mentioned.FindAllStringSubmatch(text, -1) {
+				if "@"+match[1]+":" != Prefix {
+					t.Errorf("%s: %q references %s, want the %s prefix", err.Handler, text, match[0], Prefix)
+					continue
+				}
+				applyErr := ApplyAnnotation(&Handler{}, match[2], "")
+				if applyErr != nil && strings.HasPrefix(applyErr.Error(), "Unknown annotation type") {
+					t.Errorf("%s: %q references unknown annotation %s", err.Handler, text, match[0])
+				}
+			}
+		}
+	}
+}
+
+// TestAnnotationKeysShared checks that ApplyAnnotation and the validator name annotations
+// only through the constants in keys.go, and that every constant is parsed
+func TestAnnotationKeysShared(t *testing.T) {
+	fset := token.NewFileSet()
+	parse := func(name string) *ast.File {
+		file, err := goparser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", name, err)
+		}
+		return file
+	}
+
+	keys := make(map[string]bool)
+	ast.Inspect(parse("keys.go"), func(n ast.Node) bool {
+		if spec, ok := n.(*ast.ValueSpec); ok {
+			for _, name := range spec.Names {
+				if strings.HasPrefix(name.Name, "Key") {
+					keys[name.Name] = true
+				}
+			}
+		}
+		return true
+	})
+
+	applied := make(map[string]bool)
+	for _, decl := range parse("apply.go").Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "ApplyAnnotation" {
+			continue
+		}
+		for _, stmt := range fn.Body.List {
+			sw, ok := stmt.(*ast.SwitchStmt)
+			if !ok {
+				continue
+			}
+			for _, clause := range sw.Body.List {
+				for _, expr := range clause.(*ast.CaseClause).List {
+					ident, ok := expr.(*ast.Ident)
+					if !ok || !keys[ident.Name] {
+						t.Errorf("ApplyAnnotation case at %s is not a key constant", fset.Position(expr.Pos()))
+						continue
+					}
+					applied[ident.Name] = true
+				}
+			}
+		}
+	}
+	for key := range keys {
+		if !applied[key] {
+			t.Errorf("%s is not handled by ApplyAnnotation", key)
+		}
+	}
+
+	literal := regexp.MustCompile(`@\w+:[\w-]`)
+	ast.Inspect(parse("validator.go"), func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BasicLit:
+			if n.Kind == token.STRING && literal.MatchString(n.Value) {
+				t.Errorf("validator.go:%d spells out an annotation name in %s; use AnnotationName", fset.Position(n.Pos()).Line, n.Value)
+			}
+		case *ast.CallExpr:
+			if fn, ok := n.Fun.(*ast.Ident); ok && fn.Name == "AnnotationName" {
+				if lit, ok := n.Args[0].(*ast.BasicLit); ok {
+					t.Errorf("validator.go:%d names %s; use a key constant", fset.Position(n.Pos()).Line, lit.Value)
+				}
+			}
+		}
+		return true
+	})
+}
+
+func containsString(s, substr string) bool {
+	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsSubstring(s, substr)))
+}
+
+func containsSubstring(s, substr string) bool {
+	for i := 0; i <= len(s)-len(substr); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseIPNetworks(t *testing.T, value string) []net.IPNet {
+	t.Helper()
+	networks, err := ParseIPNetworks(value)
+	if err != nil {
+		t.Fatalf("ParseIPNetworks(%q): %v", value, err)
+	}
+	return networks
 }
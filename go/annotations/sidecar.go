@@ -0,0 +1,149 @@
+package annotations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sidecar files declare annotations in YAML instead of doc comments:
+//
+//	handlers:
+//	  users.GetUser:
+//	    container: true
+//	    path: GET /api/v1/users/{id}
+//	    auth: required
+//	    env: [JWT_SECRET, USERS_BUCKET]
+//
+// Each key is an annotation without its @box: prefix and each value is what would follow it
+// in a comment; a list applies the annotation once per item, true marks a flag and false
+// leaves the annotation out. Sidecar annotations are applied after the function's comment
+// annotations, so they override them
+const (
+	// SidecarExtension names the sidecar of a single Go file (users.go -> users.box.yaml)
+	SidecarExtension = ".box.yaml"
+
+	// CentralSidecarFile declares annotations for functions anywhere below its directory
+	CentralSidecarFile = "handlers.box.yaml"
+)
+
+// sidecar is the parsed contents of a sidecar file
+type sidecar struct {
+	path     string
+	handlers []sidecarHandler // In file order
+}
+
+// sidecarHandler is one function's entry in a sidecar file
+type sidecarHandler struct {
+	key         string // "package.Function"
+	line        int
+	annotations []sidecarAnnotation
+}
+
+// sidecarAnnotation is one annotation declared in a sidecar file
+type sidecarAnnotation struct {
+	key   string
+	value string
+	line  int
+}
+
+// sidecarPath returns the sidecar of a Go file, or "" for handlers.go, whose sidecar name
+// is taken by the central file
+func sidecarPath(goFile string) string {
+	path := strings.TrimSuffix(goFile, ".go") + SidecarExtension
+	if filepath.Base(path) == CentralSidecarFile {
+		return ""
+	}
+	return path
+}
+
+// loadSidecar reads a sidecar file; a missing file returns nil without error
+func loadSidecar(path string) (*sidecar, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Handlers yaml.Node `yaml:"handlers"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	result := &sidecar{path: path}
+	if doc.Handlers.Kind == 0 {
+		return result, nil
+	}
+	if doc.Handlers.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: handlers must be a map keyed by package.Function", doc.Handlers.Line)
+	}
+
+	for i := 0; i+1 < len(doc.Handlers.Content); i += 2 {
+		name, body := doc.Handlers.Content[i], doc.Handlers.Content[i+1]
+		if pkg, fn, ok := strings.Cut(name.Value, "."); !ok || pkg == "" || fn == "" {
+			return nil, fmt.Errorf("line %d: invalid handler key %q (expected package.Function)", name.Line, name.Value)
+		}
+		if body.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: annotations for %s must be a map", body.Line, name.Value)
+		}
+
+		handler := sidecarHandler{key: name.Value, line: name.Line}
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			key, value := strings.TrimPrefix(body.Content[j].Value, Prefix), body.Content[j+1]
+
+			items := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				items = value.Content
+			}
+			for _, item := range items {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: %s for %s must be a string or a list of strings", item.Line, AnnotationName(key), name.Value)
+				}
+				if item.Tag == "!!bool" && item.Value == "false" {
+					continue
+				}
+				text := item.Value
+				if item.Tag == "!!bool" || item.Tag == "!!null" {
+					text = ""
+				}
+				handler.annotations = append(handler.annotations, sidecarAnnotation{key: key, value: text, line: item.Line})
+			}
+		}
+		result.handlers = append(result.handlers, handler)
+	}
+
+	return result, nil
+}
+
+// applySidecar applies a sidecar entry's annotations to handler
+func applySidecar(handler *Handler, path string, entry sidecarHandler) []ParseError {
+	var errors []ParseError
+	for _, annotation := range entry.annotations {
+		if err := ApplyAnnotation(handler, annotation.key, annotation.value); err != nil {
+			errors = append(errors, ParseError{
+				FilePath:   path,
+				LineNumber: annotation.line,
+				Message:    err.Error(),
+				Annotation: strings.TrimSpace(AnnotationName(annotation.key) + " " + annotation.value),
+			})
+		}
+	}
+	return errors
+}
+
+// unmatchedSidecarError reports a sidecar entry naming a function that doesn't exist
+func unmatchedSidecarError(path string, entry sidecarHandler, scope string) ParseError {
+	return ParseError{
+		FilePath:   path,
+		LineNumber: entry.line,
+		Message:    fmt.Sprintf("%s declares annotations for %s, but %s has no such function", filepath.Base(path), entry.key, scope),
+		Annotation: entry.key,
+	}
+}
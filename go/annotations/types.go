@@ -1,6 +1,8 @@
 package annotations
 
 import (
+	"net"
+	"strings"
 	"time"
 )
 
@@ -10,6 +12,8 @@ type DeploymentType string
 const (
 	DeploymentFunction  DeploymentType = "function"  // GCP Cloud Function
 	DeploymentContainer DeploymentType = "container" // GCP Cloud Run
+	DeploymentLambda    DeploymentType = "lambda"    // AWS Lambda behind API Gateway
+	DeploymentProxy     DeploymentType = "proxy"     // Forwarded to an external upstream; nothing is deployed
 )
 
 // AuthType indicates the authentication requirement for a handler
@@ -25,14 +29,22 @@ const (
 type Handler struct {
 	// Source code metadata
 	FunctionName string // Go function name (e.g., "CreateAccount")
-	PackagePath  string // Import path (e.g., "github.com/gravelight-studio/box/internal/handlers/accounts")
+	PackagePath  string // Package directory relative to the enclosing module (e.g., "internal/handlers/accounts")
 	PackageName  string // Package name (e.g., "accounts")
 	FilePath     string // Absolute file path
 	LineNumber   int    // Line number of function declaration
 
+	// ReturnsHandler marks a constructor (func() http.Handler) whose result serves the
+	// requests, rather than a func(http.ResponseWriter, *http.Request)
+	ReturnsHandler bool
+
 	// Deployment configuration
-	DeploymentType DeploymentType // function or container
+	DeploymentType DeploymentType  // function, container, lambda or proxy
 	ServiceName    string          // Service group name for containers (e.g., "chat-service")
+	TaskQueue      string          // Cloud Tasks queue this handler processes (e.g., "orders"); task targets are not exposed through the gateway
+	Schedule       *ScheduleConfig // nil unless @box:schedule; scheduled handlers are invoked by Cloud Scheduler and have no route
+	PubSub         *PubSubConfig   // nil unless @box:pubsub; subscribers receive push deliveries and have no route
+	Proxy          *ProxyConfig    // nil unless @box:proxy, which also sets DeploymentProxy
 
 	// HTTP routing
 	Route Route
@@ -41,13 +53,102 @@ type Handler struct {
 	Auth      AuthConfig
 	RateLimit *RateLimitConfig // nil if not specified
 	CORS      *CORSConfig      // nil if not specified
+	Cache     *CacheConfig     // nil if not specified
 	Timeout   time.Duration    // 0 if not specified
+	Preloads  []string         // Resources advertised via Link rel=preload headers on GET responses
+
+	// CircuitBreaker stops calling the handler after repeated 5xx responses (@box:circuit-breaker);
+	// nil if not specified
+	CircuitBreaker *CircuitBreakerConfig
+
+	// Retry re-invokes the handler after a 5xx response or a panic (@box:retry); nil if not
+	// specified. Only requests with an IdempotentMethod are retried, unless @box:idempotent
+	// sets Idempotent to declare the handler safe to repeat whatever the method
+	Retry      *RetryConfig
+	Idempotent bool
+
+	// IP access control from @box:allow-ip and @box:deny-ip. Denied ranges are rejected
+	// first; a non-empty allow list then admits only its ranges
+	AllowIPs []net.IPNet
+	DenyIPs  []net.IPNet
+
+	// RequiredRoles lists the roles from @box:roles; the caller's token must carry at least one
+	RequiredRoles []string
+
+	// authAnnotated records an explicit @box:auth, telling "none" apart from the parser default
+	authAnnotated bool
+
+	// Operations
+	Maintainable bool   // Can be switched to 503 at runtime via router maintenance toggles
+	Group        string // Router group from @box:group (e.g., "admin"); the group's middleware wraps the handler
+
+	// TracingDisabled is set by @box:tracing false to leave the handler out of router tracing
+	TracingDisabled bool
+
+	// MetricsName replaces the route pattern as the path label of router metrics (@box:metrics-name)
+	MetricsName string
+
+	// CustomMiddleware names project middleware from @box:middleware, in declaration order,
+	// resolved against the router's middleware registry (e.g., "RequireTenant")
+	CustomMiddleware []string
 
 	// Resource configuration (Cloud Functions)
 	Memory string // e.g., "128MB", "256MB", "512MB"
 
+	// Runtime environment
+	RequiredEnvVars []string // Environment variables the handler reads, from @box:env (e.g., "JWT_SECRET"); each is backed by a secret
+
+	// Secrets names the Secret Manager secret behind environment variables, from @box:secret
+	// (e.g., "JWT_SECRET" -> "jwt-signing-${env}"); SecretEnvironment in an ID stands for the environment
+	Secrets map[string]string
+
+	// IAM configuration
+	IAMRoles []string // Extra project roles for the handler's service account from @box:iam-role (e.g., "roles/pubsub.publisher")
+
 	// Resource configuration (Cloud Run)
 	Concurrency int // Max concurrent requests per instance (1-1000)
+
+	// Instance bounds from @box:min-instances and @box:max-instances; 0 leaves the platform
+	// default (scale to zero, and the generators' default cap)
+	MinInstances int
+	MaxInstances int
+
+	// CPU allocation from @box:cpu-always or @box:cpu-throttled; neither keeps the platform
+	// default (throttled outside requests). It applies to the whole Cloud Run service, so
+	// handlers sharing a service must not disagree
+	CPUAlways    bool
+	CPUThrottled bool
+
+	// API documentation
+	Summary     string         // One-line OpenAPI operation summary from @box:summary; empty means "METHOD /path"
+	Description string         // OpenAPI operation description from @box:description, may span several lines
+	Tags        []string       // Explicit OpenAPI tags (e.g., ["users", "public"]); nil means derive from PackageName
+	Paginated   bool           // List endpoint taking page/limit query params and responding via router.WritePage
+	Responses   map[int]string // Extra or overriding OpenAPI responses from @box:response (status code -> description)
+
+	// Deprecation: the handler stays deployed and routed so existing clients keep working,
+	// but its OpenAPI operation is marked deprecated
+	Deprecated      bool
+	DeprecationNote string // Optional guidance from @box:deprecated (e.g., "use POST /v2/users")
+
+	// Body schemas: struct (or TypeScript typedef) names in the handler's package, documented
+	// as JSON in the OpenAPI spec
+	RequestType  string // From @box:request CreateUserRequest
+	ResponseType string // 200 response body, from @box:response User
+
+	// Body examples: JSON files, relative to the handler's source file, whose contents
+	// become the OpenAPI examples
+	RequestExample  string // From @box:request-example ./examples/create-user.json
+	ResponseExample string // 200 response body, from @box:response-example ./examples/user.json
+
+	// API gateway passthrough
+	OpenAPIExtensions map[string]string // Raw x-* operation extensions from @box:openapi-ext (e.g., "x-google-audiences" -> client ID)
+}
+
+// EventTriggered reports whether the handler is invoked by Cloud Scheduler or Pub/Sub
+// rather than through an HTTP route
+func (h Handler) EventTriggered() bool {
+	return h.Schedule != nil || h.PubSub != nil
 }
 
 // Route represents an HTTP route
@@ -59,6 +160,27 @@ type Route struct {
 // AuthConfig represents authentication configuration
 type AuthConfig struct {
 	Type AuthType
+
+	// JWT validation (optional); without JWKSEndpoint the router accepts any Bearer token
+	JWKSEndpoint string // JWKS URL; defaults to Issuer + "/.well-known/jwks.json"
+	Issuer       string // Required "iss" claim
+	Audience     string // Required "aud" entry
+	StrictJWKS   bool   // Reject tokens when the JWKS can't be fetched instead of accepting them
+
+	// RolesClaimKey names the token claim holding the caller's roles for @box:roles
+	// (e.g., "groups"); empty means DefaultRolesClaimKey
+	RolesClaimKey string
+}
+
+// DefaultRolesClaimKey is the token claim @box:roles checks unless auth sets roles-claim
+const DefaultRolesClaimKey = "roles"
+
+// EffectiveRolesClaimKey returns the roles claim name, applying the default
+func (a AuthConfig) EffectiveRolesClaimKey() string {
+	if a.RolesClaimKey == "" {
+		return DefaultRolesClaimKey
+	}
+	return a.RolesClaimKey
 }
 
 // RateLimitConfig represents rate limiting configuration
@@ -68,10 +190,190 @@ type RateLimitConfig struct {
 	Raw    string        // Original string (e.g., "100/hour")
 }
 
+// CacheConfig represents response caching configuration from @box:cache
+type CacheConfig struct {
+	TTL         time.Duration // How long a response is served from the cache
+	VaryHeaders []string      // Request headers that select separate cached responses (e.g., "Accept-Language")
+	Raw         string        // Original string (e.g., "5m vary=Accept-Language")
+}
+
+// CircuitBreakerConfig represents a @box:circuit-breaker. The circuit opens once
+// FailureThreshold of the last Window requests failed, rejects requests for ResetTimeout,
+// then lets one trial request through to decide whether to close again
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // Failed requests (5xx or panics) in the window that open the circuit
+	ResetTimeout     time.Duration // How long the circuit stays open before a trial request
+	Window           int           // Requests the failures are counted over (0 uses DefaultCircuitBreakerWindow)
+	Raw              string        // Original string (e.g., "threshold=5 timeout=30s")
+}
+
+// Defaults for the @box:circuit-breaker options
+const (
+	DefaultCircuitBreakerThreshold    = 5
+	DefaultCircuitBreakerResetTimeout = 30 * time.Second
+	DefaultCircuitBreakerWindow       = 20
+)
+
+// EffectiveWindow returns the number of requests failures are counted over, applying the
+// default and never less than the threshold
+func (c *CircuitBreakerConfig) EffectiveWindow() int {
+	if c.Window > 0 {
+		return c.Window
+	}
+	return max(DefaultCircuitBreakerWindow, c.FailureThreshold)
+}
+
+// RetryConfig represents a @box:retry
+type RetryConfig struct {
+	Attempts     int           // Invocations per request, the first included
+	BackoffType  string        // RetryBackoffLinear, RetryBackoffExponential or RetryBackoffJitter
+	InitialDelay time.Duration // Wait before the first retry
+	MaxDelay     time.Duration // Upper bound on any wait
+	Raw          string        // Original string (e.g., "attempts=3 backoff=exponential delay=100ms")
+}
+
+// Backoff strategies for @box:retry backoff=
+const (
+	RetryBackoffLinear      = "linear"      // delay, 2*delay, 3*delay, ...
+	RetryBackoffExponential = "exponential" // delay, 2*delay, 4*delay, ...
+	RetryBackoffJitter      = "jitter"      // A random wait up to the exponential one
+)
+
+// Defaults for the @box:retry options
+const (
+	DefaultRetryAttempts     = 3
+	DefaultRetryBackoff      = RetryBackoffExponential
+	DefaultRetryInitialDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay     = 5 * time.Second
+)
+
+// Delay returns the wait before retry n (1 for the first retry), before any jitter
+func (c *RetryConfig) Delay(n int) time.Duration {
+	delay := c.InitialDelay
+	for i := 1; i < n && delay < c.MaxDelay; i++ {
+		if c.BackoffType == RetryBackoffLinear {
+			delay += c.InitialDelay
+		} else {
+			delay *= 2
+		}
+	}
+	return min(delay, c.MaxDelay)
+}
+
+// ScheduleConfig represents a Cloud Scheduler cron trigger
+type ScheduleConfig struct {
+	Cron     string // Cron expression (e.g., "0 3 * * *")
+	Timezone string // IANA time zone the expression is evaluated in (e.g., "Europe/Berlin")
+	Raw      string // Original string (e.g., "0 3 * * * tz=Europe/Berlin")
+}
+
+// PubSubConfig represents a Pub/Sub push subscription feeding a handler
+// Subscribers are declared as func(ctx context.Context, payload []byte) error
+type PubSubConfig struct {
+	TopicID        string // Topic the subscription reads from (e.g., "orders")
+	SubscriptionID string // Subscription name; empty derives it from the function name
+	Raw            string // Original string (e.g., "topic=orders subscription=orders-billing")
+}
+
+// ProxyConfig represents an external upstream that a @box:proxy route forwards to
+// The request path and query are appended to the upstream URL
+type ProxyConfig struct {
+	Upstream     string            // Default upstream URL (e.g., "https://api.example.com/v2")
+	Environments map[string]string // Per-environment upstreams overriding Upstream (e.g., "staging" -> sandbox URL)
+	Raw          string            // Original string (e.g., "https://api.example.com staging=https://sandbox.example.com")
+}
+
+// UpstreamFor returns the upstream URL used in environment
+func (p *ProxyConfig) UpstreamFor(environment string) string {
+	if upstream, ok := p.Environments[environment]; ok {
+		return upstream
+	}
+	return p.Upstream
+}
+
+// DefaultScheduleTimezone is used when @box:schedule does not name a time zone
+const DefaultScheduleTimezone = "UTC"
+
 // CORSConfig represents CORS configuration
 type CORSConfig struct {
 	AllowedOrigins []string // e.g., ["*"], ["https://example.com"]
-	Raw            string   // Original string (e.g., "origins=*")
+	MaxAge         int      // Preflight cache duration in seconds (0 uses DefaultCORSMaxAge)
+	ExposedHeaders []string // Response headers readable by browser clients (nil uses DefaultCORSExposedHeaders)
+
+	// AllowCredentials lets browsers send cookies and auth headers cross-origin
+	// Responses then echo the request Origin, since browsers reject "*" on credentialed requests
+	AllowCredentials bool
+
+	Raw string // Original string (e.g., "origins=* max-age=600 expose=X-Total-Count")
+}
+
+// DefaultCORSMaxAge is the preflight cache duration when @box:cors sets no max-age
+const DefaultCORSMaxAge = 300
+
+// DefaultCORSExposedHeaders are exposed when @box:cors sets no expose list
+// Link carries the @box:preload hints
+var DefaultCORSExposedHeaders = []string{"Link"}
+
+// EffectiveMaxAge returns the preflight cache duration, applying the default
+func (c *CORSConfig) EffectiveMaxAge() int {
+	if c.MaxAge > 0 {
+		return c.MaxAge
+	}
+	return DefaultCORSMaxAge
+}
+
+// EffectiveExposedHeaders returns the exposed headers, applying the default
+func (c *CORSConfig) EffectiveExposedHeaders() []string {
+	if c.ExposedHeaders != nil {
+		return c.ExposedHeaders
+	}
+	return DefaultCORSExposedHeaders
+}
+
+// HasWildcardSubdomains reports whether any allowed origin is a subdomain pattern like "https://*.example.com"
+func (c *CORSConfig) HasWildcardSubdomains() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if _, _, ok := SplitWildcardOrigin(allowed); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin reports whether a request Origin is on the allowlist
+// "https://*.example.com" matches https://app.example.com and https://a.b.example.com, but not https://example.com
+func (c *CORSConfig) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		scheme, suffix, ok := SplitWildcardOrigin(allowed)
+		if !ok {
+			continue
+		}
+		subdomain, found := strings.CutPrefix(origin, scheme+"://")
+		if !found || !strings.HasSuffix(subdomain, "."+suffix) {
+			continue
+		}
+		subdomain = strings.TrimSuffix(subdomain, "."+suffix)
+		if subdomain != "" && !strings.ContainsAny(subdomain, ":/@") {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitWildcardOrigin splits "https://*.example.com" into its scheme and the host suffix after "*."
+// ok is false for origins that aren't subdomain patterns
+func SplitWildcardOrigin(origin string) (scheme, suffix string, ok bool) {
+	scheme, rest, found := strings.Cut(origin, "://*.")
+	if !found {
+		return "", "", false
+	}
+	return scheme, rest, true
 }
 
 // ParsedAnnotations represents all annotations found in a directory/file
@@ -93,14 +395,29 @@ func (e ParseError) Error() string {
 	return e.Message
 }
 
+// Severity indicates how serious a validation finding is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // Must be fixed before building or serving
+	SeverityWarning Severity = "warning" // Likely a mistake, but not fatal
+	SeverityInfo    Severity = "info"    // Informational notice for the developer
+)
+
 // AnnotationError represents validation errors for annotations
 type AnnotationError struct {
 	Handler    string
 	Annotation string
 	Reason     string
+	Severity   Severity // Empty is treated as SeverityError
 }
 
 // Error implements the error interface
 func (e AnnotationError) Error() string {
 	return e.Reason
 }
+
+// IsError reports whether the finding should fail validation
+func (e AnnotationError) IsError() bool {
+	return e.Severity == "" || e.Severity == SeverityError
+}
@@ -2,12 +2,38 @@ package annotations
 
 import (
 	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gravelight-studio/box/go/config"
 )
 
+// ReservedPaths are routes served by the framework itself, mapped to what serves them
+// A GET handler declared on one of these paths overrides the built-in endpoint
+var ReservedPaths = map[string]string{
+	"/health":  "health check",
+	"/ready":   "readiness check",
+	"/metrics": "metrics",
+}
+
+// tagPattern restricts OpenAPI tags to simple identifiers safe to emit unquoted in YAML
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
 // Validator validates parsed annotations for correctness and completeness
 type Validator struct {
-	// Configuration for validation rules
+	defaults config.Defaults // box.yaml defaults for handlers without @box:memory, @box:timeout or @box:auth
+
+	// middleware holds the names @box:middleware may use; nil skips the check, since
+	// middleware is registered at runtime and is unknown at build time
+	middleware map[string]bool
 }
 
 // NewValidator creates a new annotation validator
@@ -15,17 +41,59 @@ func NewValidator() *Validator {
 	return &Validator{}
 }
 
+// NewValidatorWithConfig creates a validator that checks handlers as if the box.yaml
+// defaults were applied to them
+func NewValidatorWithConfig(cfg *config.BoxConfig) *Validator {
+	v := NewValidator()
+	if cfg != nil {
+		v.defaults = cfg.Defaults
+	}
+	return v
+}
+
+// SetRegisteredMiddleware makes Validate warn about @box:middleware names outside names
+func (v *Validator) SetRegisteredMiddleware(names []string) {
+	v.middleware = make(map[string]bool, len(names))
+	for _, name := range names {
+		v.middleware[name] = true
+	}
+}
+
 // Validate checks if all handlers have valid and complete annotations
 func (v *Validator) Validate(handlers []Handler) []AnnotationError {
 	var errors []AnnotationError
 
 	for _, handler := range handlers {
-		errors = append(errors, v.validateHandler(handler)...)
+		errors = append(errors, v.validateHandler(v.withDefaults(handler, true))...)
 	}
 
 	return errors
 }
 
+// ApplyDefaults fills in the default memory and auth for handlers that don't annotate them
+// The default timeout is left to the generators' default (build.Config.DefaultTimeout),
+// which already covers every handler without @box:timeout
+func (v *Validator) ApplyDefaults(handlers []Handler) {
+	for i := range handlers {
+		handlers[i] = v.withDefaults(handlers[i], false)
+	}
+}
+
+// withDefaults returns handler with the configured defaults in place of missing annotations
+// Memory only applies to functions and lambdas; containers size memory per service
+func (v *Validator) withDefaults(handler Handler, timeout bool) Handler {
+	if handler.Memory == "" && (handler.DeploymentType == DeploymentFunction || handler.DeploymentType == DeploymentLambda) {
+		handler.Memory = v.defaults.Memory
+	}
+	if timeout && handler.Timeout == 0 {
+		handler.Timeout = v.defaults.Timeout
+	}
+	if !handler.authAnnotated && v.defaults.Auth != "" {
+		handler.Auth = AuthConfig{Type: AuthType(v.defaults.Auth)}
+	}
+	return handler
+}
+
 // validateHandler validates a single handler
 func (v *Validator) validateHandler(handler Handler) []AnnotationError {
 	var errors []AnnotationError
@@ -34,23 +102,24 @@ func (v *Validator) validateHandler(handler Handler) []AnnotationError {
 	if handler.DeploymentType == "" {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:function or @wylla:container",
-			Reason:     "Missing deployment type annotation. Add @wylla:function or @wylla:container",
+			Annotation: AnnotationName(KeyFunction) + " or " + AnnotationName(KeyContainer),
+			Reason:     "Missing deployment type annotation. Add " + AnnotationName(KeyFunction) + " or " + AnnotationName(KeyContainer),
 		})
 	}
 
-	// Check route is set
-	if handler.Route.Method == "" || handler.Route.Path == "" {
+	// Check route is set; scheduled and Pub/Sub handlers are triggered by events instead
+	if !handler.EventTriggered() && (handler.Route.Method == "" || handler.Route.Path == "") {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:path",
-			Reason:     "Missing path annotation. Add @wylla:path METHOD /path",
+			Annotation: AnnotationName(KeyPath),
+			Reason:     "Missing path annotation. Add " + AnnotationName(KeyPath) + " METHOD /path",
 		})
 	}
 
 	// Validate route path format
 	if handler.Route.Path != "" {
 		errors = append(errors, v.validatePath(handler)...)
+		errors = append(errors, v.validateReservedPath(handler)...)
 	}
 
 	// Validate deployment-specific config
@@ -58,6 +127,43 @@ func (v *Validator) validateHandler(handler Handler) []AnnotationError {
 		errors = append(errors, v.validateFunctionConfig(handler)...)
 	} else if handler.DeploymentType == DeploymentContainer {
 		errors = append(errors, v.validateContainerConfig(handler)...)
+	} else if handler.DeploymentType == DeploymentLambda {
+		errors = append(errors, v.validateLambdaConfig(handler)...)
+	} else if handler.DeploymentType == DeploymentProxy {
+		errors = append(errors, v.validateProxyConfig(handler)...)
+	}
+
+	// A later @box:function, @box:container or @box:lambda replaces the proxy deployment
+	if handler.Proxy != nil && handler.DeploymentType != DeploymentProxy {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyProxy),
+			Reason:     fmt.Sprintf(AnnotationName(KeyProxy)+" routes are not deployed; remove %s", AnnotationName(string(handler.DeploymentType))),
+		})
+	}
+
+	// Roles are read from the caller's token, so there must always be one
+	if len(handler.RequiredRoles) > 0 && handler.Auth.Type != AuthRequired {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyRoles),
+			Reason:     AnnotationName(KeyRoles) + " requires " + AnnotationName(KeyAuth) + " required",
+		})
+	}
+
+	// Validate CPU allocation if set
+	if handler.CPUAlways || handler.CPUThrottled {
+		errors = append(errors, v.validateCPUAllocation(handler)...)
+	}
+
+	// Validate instance bounds if set
+	if handler.MinInstances > 0 || handler.MaxInstances > 0 {
+		errors = append(errors, v.validateScaling(handler)...)
+	}
+
+	// Validate IP access control if present
+	if len(handler.AllowIPs) > 0 && len(handler.DenyIPs) > 0 {
+		errors = append(errors, v.validateIPRanges(handler)...)
 	}
 
 	// Validate rate limit if present
@@ -70,11 +176,91 @@ func (v *Validator) validateHandler(handler Handler) []AnnotationError {
 		errors = append(errors, v.validateCORS(handler)...)
 	}
 
+	// Validate response caching if present
+	if handler.Cache != nil {
+		errors = append(errors, v.validateCache(handler)...)
+	}
+
+	// Validate circuit breaker if present
+	if handler.CircuitBreaker != nil {
+		errors = append(errors, v.validateCircuitBreaker(handler)...)
+	}
+
+	// Validate retries if present
+	if handler.Retry != nil {
+		errors = append(errors, v.validateRetry(handler)...)
+	}
+
 	// Validate timeout if present
 	if handler.Timeout > 0 {
 		errors = append(errors, v.validateTimeout(handler)...)
 	}
 
+	// Validate tags if present
+	if len(handler.Tags) > 0 {
+		errors = append(errors, v.validateTags(handler)...)
+	}
+
+	// Validate preload hints if present
+	if len(handler.Preloads) > 0 {
+		errors = append(errors, v.validatePreloads(handler)...)
+	}
+
+	// Validate custom middleware if present
+	if len(handler.CustomMiddleware) > 0 {
+		errors = append(errors, v.validateMiddleware(handler)...)
+	}
+
+	// Validate pagination if enabled
+	if handler.Paginated {
+		errors = append(errors, v.validatePagination(handler)...)
+	}
+
+	// Validate custom responses if present
+	if len(handler.Responses) > 0 {
+		errors = append(errors, v.validateResponses(handler)...)
+	}
+
+	// Validate Cloud Tasks targets
+	if handler.TaskQueue != "" {
+		errors = append(errors, v.validateTaskQueue(handler)...)
+	}
+
+	// Validate Cloud Scheduler triggers
+	if handler.Schedule != nil {
+		errors = append(errors, v.validateSchedule(handler)...)
+	}
+
+	// Validate Pub/Sub subscribers
+	if handler.PubSub != nil {
+		errors = append(errors, v.validatePubSub(handler)...)
+	}
+
+	// Validate required environment variables if present
+	if len(handler.RequiredEnvVars) > 0 {
+		errors = append(errors, v.validateEnvVars(handler)...)
+	}
+
+	// Validate Secret Manager bindings if present
+	if len(handler.Secrets) > 0 {
+		errors = append(errors, v.validateSecrets(handler)...)
+	}
+
+	// Validate OpenAPI extension passthrough if present
+	if len(handler.OpenAPIExtensions) > 0 {
+		errors = append(errors, v.validateOpenAPIExtensions(handler)...)
+	}
+
+	// Protected endpoints should say what they do in the API docs
+	if handler.Auth.Type == AuthRequired && handler.Summary == "" && handler.Description == "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySummary),
+			Reason:     "Auth-required endpoint has no " + AnnotationName(KeySummary) + " or " + AnnotationName(KeyDescription) + "; document it for API consumers",
+			Severity:   SeverityWarning,
+		})
+	}
+
 	return errors
 }
 
@@ -88,7 +274,7 @@ func (v *Validator) validatePath(handler Handler) []AnnotationError {
 	if !strings.HasPrefix(path, "/") {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:path",
+			Annotation: AnnotationName(KeyPath),
 			Reason:     fmt.Sprintf("Path must start with '/': %s", path),
 		})
 	}
@@ -97,7 +283,7 @@ func (v *Validator) validatePath(handler Handler) []AnnotationError {
 	if len(path) > 1 && strings.HasSuffix(path, "/") {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:path",
+			Annotation: AnnotationName(KeyPath),
 			Reason:     fmt.Sprintf("Path should not end with '/': %s", path),
 		})
 	}
@@ -107,7 +293,7 @@ func (v *Validator) validatePath(handler Handler) []AnnotationError {
 		if !v.hasValidPathParams(path) {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:path",
+				Annotation: AnnotationName(KeyPath),
 				Reason:     fmt.Sprintf("Invalid path parameter syntax: %s (use {paramName})", path),
 			})
 		}
@@ -116,6 +302,21 @@ func (v *Validator) validatePath(handler Handler) []AnnotationError {
 	return errors
 }
 
+// validateReservedPath warns when a handler takes over a framework-reserved route
+func (v *Validator) validateReservedPath(handler Handler) []AnnotationError {
+	purpose, reserved := ReservedPaths[handler.Route.Path]
+	if !reserved || (handler.Route.Method != "GET" && handler.Route.Method != "HEAD") {
+		return nil
+	}
+
+	return []AnnotationError{{
+		Handler:    handler.FunctionName,
+		Annotation: AnnotationName(KeyPath),
+		Reason:     fmt.Sprintf("Path %s is reserved for the built-in %s endpoint; this handler overrides it", handler.Route.Path, purpose),
+		Severity:   SeverityWarning,
+	}}
+}
+
 // hasValidPathParams checks if path parameters are properly formatted
 func (v *Validator) hasValidPathParams(path string) bool {
 	// Simple validation: count opening and closing braces
@@ -164,7 +365,7 @@ func (v *Validator) validateFunctionConfig(handler Handler) []AnnotationError {
 		if !validMemory[handler.Memory] {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:memory",
+				Annotation: AnnotationName(KeyMemory),
 				Reason:     fmt.Sprintf("Invalid memory value: %s (valid: 128MB, 256MB, 512MB, 1GB, 2GB, 4GB, 8GB, 16GB)", handler.Memory),
 			})
 		}
@@ -174,7 +375,7 @@ func (v *Validator) validateFunctionConfig(handler Handler) []AnnotationError {
 	if handler.Concurrency > 0 {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:concurrency",
+			Annotation: AnnotationName(KeyConcurrency),
 			Reason:     "Concurrency is not applicable to Cloud Functions, only Cloud Run containers",
 		})
 	}
@@ -182,6 +383,118 @@ func (v *Validator) validateFunctionConfig(handler Handler) []AnnotationError {
 	return errors
 }
 
+// Memory limits of an AWS Lambda function, configurable in 1MB steps
+const (
+	MinLambdaMemoryMB = 128
+	MaxLambdaMemoryMB = 10240
+)
+
+// LambdaMemoryMB converts a @box:memory value ("512MB", "2GB") to the megabytes Lambda expects
+func LambdaMemoryMB(memory string) (int, error) {
+	unit := 1
+	number := strings.TrimSuffix(memory, "MB")
+	if number == memory {
+		number = strings.TrimSuffix(memory, "GB")
+		unit = 1024
+	}
+
+	size, err := strconv.Atoi(number)
+	if number == memory || err != nil {
+		return 0, fmt.Errorf("invalid memory value: %s (use MB or GB, e.g. 512MB)", memory)
+	}
+
+	mb := size * unit
+	if mb < MinLambdaMemoryMB || mb > MaxLambdaMemoryMB {
+		return 0, fmt.Errorf("Lambda memory must be between %dMB and %dMB, got: %s", MinLambdaMemoryMB, MaxLambdaMemoryMB, memory)
+	}
+	return mb, nil
+}
+
+// validateLambdaConfig validates AWS Lambda specific configuration
+func (v *Validator) validateLambdaConfig(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.Memory != "" {
+		if _, err := LambdaMemoryMB(handler.Memory); err != nil {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyMemory),
+				Reason:     err.Error(),
+			})
+		}
+	}
+
+	if handler.Concurrency > 0 {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyConcurrency),
+			Reason:     "Concurrency is not applicable to Lambda functions, only Cloud Run containers",
+		})
+	}
+
+	// Cloud Tasks, Cloud Scheduler and Pub/Sub triggers are GCP resources
+	if handler.EventTriggered() || handler.TaskQueue != "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyLambda),
+			Reason:     "Lambda handlers are invoked through AWS API Gateway; " + AnnotationName(KeyTaskQueue) + ", " + AnnotationName(KeySchedule) + " and " + AnnotationName(KeyPubSub) + " need " + AnnotationName(KeyFunction),
+		})
+	}
+
+	return errors
+}
+
+// validateProxyConfig validates @box:proxy routes, which forward to an upstream rather than
+// running the handler
+func (v *Validator) validateProxyConfig(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	// Triggers invoke a deployed handler, and a proxy has none
+	if handler.EventTriggered() || handler.TaskQueue != "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyProxy),
+			Reason:     "Proxy routes forward HTTP requests; " + AnnotationName(KeyTaskQueue) + ", " + AnnotationName(KeySchedule) + " and " + AnnotationName(KeyPubSub) + " need " + AnnotationName(KeyFunction) + " or " + AnnotationName(KeyContainer),
+		})
+	}
+
+	// Credentials and payloads would cross the internet unencrypted
+	upstreams := []string{handler.Proxy.Upstream}
+	environments := make([]string, 0, len(handler.Proxy.Environments))
+	for environment := range handler.Proxy.Environments {
+		environments = append(environments, environment)
+	}
+	sort.Strings(environments)
+	for _, environment := range environments {
+		upstreams = append(upstreams, handler.Proxy.Environments[environment])
+	}
+	for _, upstream := range upstreams {
+		if strings.HasPrefix(upstream, "http://") && !isLocalUpstream(upstream) {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyProxy),
+				Reason:     fmt.Sprintf("Upstream %s uses plain HTTP; use https outside local development", upstream),
+				Severity:   SeverityWarning,
+			})
+		}
+	}
+
+	return errors
+}
+
+// isLocalUpstream reports whether upstream points at the local machine
+func isLocalUpstream(upstream string) bool {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
 // validateContainerConfig validates Cloud Run specific configuration
 func (v *Validator) validateContainerConfig(handler Handler) []AnnotationError {
 	var errors []AnnotationError
@@ -191,7 +504,7 @@ func (v *Validator) validateContainerConfig(handler Handler) []AnnotationError {
 		if handler.Concurrency < 1 || handler.Concurrency > 1000 {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:concurrency",
+				Annotation: AnnotationName(KeyConcurrency),
 				Reason:     fmt.Sprintf("Concurrency must be between 1 and 1000, got: %d", handler.Concurrency),
 			})
 		}
@@ -203,9 +516,108 @@ func (v *Validator) validateContainerConfig(handler Handler) []AnnotationError {
 		// This is more of a notice than an error
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:memory",
+			Annotation: AnnotationName(KeyMemory),
 			Reason:     "Note: Memory for Cloud Run containers is typically configured at the service level, not per handler",
+			Severity:   SeverityInfo,
+		})
+	}
+
+	return errors
+}
+
+// validateCPUAllocation checks @box:cpu-always and @box:cpu-throttled. Only Cloud Run lets
+// CPU stay allocated between requests; functions and lambdas are always throttled
+func (v *Validator) validateCPUAllocation(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.CPUAlways && handler.CPUThrottled {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCPUAlways),
+			Reason:     AnnotationName(KeyCPUAlways) + " and " + AnnotationName(KeyCPUThrottled) + " are mutually exclusive; keep one",
+		})
+		return errors
+	}
+
+	if handler.DeploymentType == DeploymentContainer {
+		return errors
+	}
+
+	if handler.CPUAlways {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCPUAlways),
+			Reason:     fmt.Sprintf("Only "+AnnotationName(KeyContainer)+" services can keep CPU allocated between requests, not %s handlers", handler.DeploymentType),
+		})
+	} else {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCPUThrottled),
+			Reason:     fmt.Sprintf("CPU is always throttled between requests for %s handlers, so "+AnnotationName(KeyCPUThrottled)+" has no effect", handler.DeploymentType),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateScaling checks @box:min-instances and @box:max-instances. Warm instances are billed
+// while idle, so warm functions without a memory size (annotated or a box.yaml default) are flagged
+func (v *Validator) validateScaling(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	switch handler.DeploymentType {
+	case DeploymentFunction, DeploymentContainer:
+	case DeploymentLambda, DeploymentProxy:
+		key := KeyMinInstances
+		if handler.MinInstances == 0 {
+			key = KeyMaxInstances
+		}
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(key),
+			Reason:     fmt.Sprintf("Instance bounds only apply to Cloud Functions and Cloud Run, not %s handlers", handler.DeploymentType),
+			Severity:   SeverityWarning,
 		})
+		return errors
+	}
+
+	if handler.MaxInstances > 0 && handler.MinInstances > handler.MaxInstances {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyMinInstances),
+			Reason:     fmt.Sprintf("min-instances %d exceeds max-instances %d", handler.MinInstances, handler.MaxInstances),
+		})
+	}
+
+	// Containers size memory per service, which @box:memory does not set
+	if handler.MinInstances > 0 && handler.Memory == "" && handler.DeploymentType == DeploymentFunction {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyMinInstances),
+			Reason:     fmt.Sprintf("%d warm instances are billed even when idle; add "+AnnotationName(KeyMemory)+" to size them deliberately", handler.MinInstances),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateIPRanges rejects allowed ranges that overlap denied ones, so whether an address
+// gets through is obvious from the annotations without knowing deny rules run first
+func (v *Validator) validateIPRanges(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	for _, allowed := range handler.AllowIPs {
+		for _, denied := range handler.DenyIPs {
+			if allowed.Contains(denied.IP) || denied.Contains(allowed.IP) {
+				errors = append(errors, AnnotationError{
+					Handler:    handler.FunctionName,
+					Annotation: AnnotationName(KeyDenyIP),
+					Reason:     fmt.Sprintf("Denied range %s overlaps allowed range %s", denied.String(), allowed.String()),
+				})
+			}
+		}
 	}
 
 	return errors
@@ -218,7 +630,7 @@ func (v *Validator) validateRateLimit(handler Handler) []AnnotationError {
 	if handler.RateLimit.Count <= 0 {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:ratelimit",
+			Annotation: AnnotationName(KeyRateLimit),
 			Reason:     fmt.Sprintf("Rate limit count must be positive, got: %d", handler.RateLimit.Count),
 		})
 	}
@@ -227,7 +639,7 @@ func (v *Validator) validateRateLimit(handler Handler) []AnnotationError {
 	if handler.RateLimit.Count > 10000 {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:ratelimit",
+			Annotation: AnnotationName(KeyRateLimit),
 			Reason:     fmt.Sprintf("Rate limit seems very high: %s (consider if this is intentional)", handler.RateLimit.Raw),
 		})
 	}
@@ -235,7 +647,7 @@ func (v *Validator) validateRateLimit(handler Handler) []AnnotationError {
 	if handler.RateLimit.Count < 10 && handler.RateLimit.Period.Hours() >= 1 {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:ratelimit",
+			Annotation: AnnotationName(KeyRateLimit),
 			Reason:     fmt.Sprintf("Rate limit seems very low: %s (consider if this is intentional)", handler.RateLimit.Raw),
 		})
 	}
@@ -250,7 +662,7 @@ func (v *Validator) validateCORS(handler Handler) []AnnotationError {
 	if len(handler.CORS.AllowedOrigins) == 0 {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:cors",
+			Annotation: AnnotationName(KeyCORS),
 			Reason:     "CORS must specify at least one origin",
 		})
 		return errors
@@ -259,6 +671,14 @@ func (v *Validator) validateCORS(handler Handler) []AnnotationError {
 	// Validate origin format (if not wildcard)
 	for _, origin := range handler.CORS.AllowedOrigins {
 		if origin == "*" {
+			if handler.CORS.AllowCredentials {
+				errors = append(errors, AnnotationError{
+					Handler:    handler.FunctionName,
+					Annotation: AnnotationName(KeyCORS),
+					Reason:     "CORS credentials=true with origins=* lets any site make requests with the user's cookies; list the trusted origins instead",
+					Severity:   SeverityWarning,
+				})
+			}
 			continue
 		}
 
@@ -266,65 +686,756 @@ func (v *Validator) validateCORS(handler Handler) []AnnotationError {
 		if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:cors",
+				Annotation: AnnotationName(KeyCORS),
 				Reason:     fmt.Sprintf("CORS origin must start with http:// or https://, got: %s", origin),
 			})
+			continue
+		}
+
+		if strings.Contains(origin, "*") {
+			if reason := checkWildcardOrigin(origin); reason != "" {
+				errors = append(errors, AnnotationError{
+					Handler:    handler.FunctionName,
+					Annotation: AnnotationName(KeyCORS),
+					Reason:     reason,
+				})
+			}
+		}
+	}
+
+	if handler.CORS.MaxAge < 0 {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCORS),
+			Reason:     fmt.Sprintf("CORS max-age must be a positive number of seconds, got: %d", handler.CORS.MaxAge),
+		})
+	} else if handler.CORS.MaxAge > maxCORSMaxAge {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCORS),
+			Reason:     fmt.Sprintf("CORS max-age=%d exceeds what browsers honour (%d seconds); preflights will be cached for less", handler.CORS.MaxAge, maxCORSMaxAge),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	for _, header := range handler.CORS.ExposedHeaders {
+		if header != "*" && !isHeaderName(header) {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyCORS),
+				Reason:     fmt.Sprintf("CORS expose must list header names, got: %s", header),
+			})
 		}
 	}
 
 	return errors
 }
 
-// validateTimeout validates timeout configuration
-func (v *Validator) validateTimeout(handler Handler) []AnnotationError {
+// checkWildcardOrigin explains what is wrong with a wildcard CORS origin, or returns "" if it is valid
+// Only a single leading subdomain label may be a wildcard, and it must sit above a registrable domain
+func checkWildcardOrigin(origin string) string {
+	_, suffix, ok := SplitWildcardOrigin(origin)
+	if !ok || strings.Contains(suffix, "*") {
+		return fmt.Sprintf("CORS wildcard must be a leading subdomain like https://*.example.com, got: %s", origin)
+	}
+
+	host, port, hasPort := strings.Cut(suffix, ":")
+	if hasPort {
+		if _, err := strconv.Atoi(port); err != nil {
+			return fmt.Sprintf("CORS origin has an invalid port, got: %s", origin)
+		}
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if !dnsLabelPattern.MatchString(label) {
+			return fmt.Sprintf("CORS wildcard must be followed by a host name, got: %s", origin)
+		}
+	}
+
+	// *.com would allow every site under a top-level domain
+	if !strings.Contains(host, ".") && host != "localhost" {
+		return fmt.Sprintf("CORS wildcard %s is too broad; match subdomains of a specific domain", origin)
+	}
+
+	return ""
+}
+
+// dnsLabelPattern matches one label of a host name
+var dnsLabelPattern = regexp.MustCompile(`(?i)^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// maxCORSMaxAge is the longest preflight cache browsers allow (Firefox caps at 24 hours)
+const maxCORSMaxAge = 86400
+
+// isHeaderName reports whether name is a valid HTTP header field name (an RFC 9110 token)
+func isHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > unicode.MaxASCII || (!unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// PaginationHeaders are the response headers set by router.WritePage
+var PaginationHeaders = []string{"X-Total-Count", "Link"}
+
+// validatePagination warns when pagination metadata would be unusable
+func (v *Validator) validatePagination(handler Handler) []AnnotationError {
 	var errors []AnnotationError
 
-	// Cloud Functions have max timeout of 540s (9 minutes)
-	// Cloud Run has max timeout of 3600s (1 hour)
-	if handler.DeploymentType == DeploymentFunction {
-		maxTimeout := int64(540) // 9 minutes in seconds
-		if handler.Timeout.Seconds() > float64(maxTimeout) {
-			errors = append(errors, AnnotationError{
-				Handler:    handler.FunctionName,
-				Annotation: "@wylla:timeout",
-				Reason:     fmt.Sprintf("Cloud Function timeout cannot exceed 540s (9 minutes), got: %v", handler.Timeout),
-			})
+	if handler.Route.Method != "GET" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyPaginated),
+			Reason:     fmt.Sprintf("Pagination applies to GET list endpoints, not %s", handler.Route.Method),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	// Browsers hide response headers from cross-origin scripts unless they are exposed
+	if handler.CORS != nil {
+		exposed := make(map[string]bool)
+		for _, header := range handler.CORS.EffectiveExposedHeaders() {
+			exposed[strings.ToLower(header)] = true
 		}
-	} else if handler.DeploymentType == DeploymentContainer {
-		maxTimeout := int64(3600) // 1 hour in seconds
-		if handler.Timeout.Seconds() > float64(maxTimeout) {
+
+		var missing []string
+		for _, header := range PaginationHeaders {
+			if !exposed["*"] && !exposed[strings.ToLower(header)] {
+				missing = append(missing, header)
+			}
+		}
+
+		if len(missing) > 0 {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:timeout",
-				Reason:     fmt.Sprintf("Cloud Run timeout cannot exceed 3600s (1 hour), got: %v", handler.Timeout),
+				Annotation: AnnotationName(KeyPaginated),
+				Reason:     fmt.Sprintf("Add %s to "+AnnotationName(KeyCORS)+" expose so browser clients can read the pagination headers", strings.Join(missing, ",")),
+				Severity:   SeverityWarning,
 			})
 		}
 	}
 
-	// Warn about very short timeouts
-	if handler.Timeout.Seconds() < 5 {
+	return errors
+}
+
+// validateCache warns about @box:cache settings the router's cache would ignore or that
+// could serve one caller's response to another
+func (v *Validator) validateCache(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.Route.Method != "GET" {
 		errors = append(errors, AnnotationError{
 			Handler:    handler.FunctionName,
-			Annotation: "@wylla:timeout",
-			Reason:     fmt.Sprintf("Timeout is very short: %v (consider if this is intentional)", handler.Timeout),
+			Annotation: AnnotationName(KeyCache),
+			Reason:     fmt.Sprintf("Only GET responses are cached, so "+AnnotationName(KeyCache)+" has no effect on %s", handler.Route.Method),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	// The cache key covers the URL and vary headers only, not the caller's identity
+	authenticated := handler.Auth.Type == AuthRequired || handler.Auth.Type == AuthOptional
+	if authenticated && !slices.Contains(handler.Cache.VaryHeaders, "Authorization") {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCache),
+			Reason:     "Cached responses are shared by all callers; add vary=Authorization to cache per caller",
+			Severity:   SeverityWarning,
 		})
 	}
 
 	return errors
 }
 
-// ValidateUniquePaths checks if there are duplicate paths across handlers
+// validateCircuitBreaker warns about circuit breakers the router never applies
+func (v *Validator) validateCircuitBreaker(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.EventTriggered() {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyCircuitBreaker),
+			Reason:     "Scheduled and Pub/Sub handlers are not routed, so " + AnnotationName(KeyCircuitBreaker) + " has no effect",
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateRetry warns about retries the router would never make
+func (v *Validator) validateRetry(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.EventTriggered() {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyRetry),
+			Reason:     "Scheduled and Pub/Sub handlers are not routed, so " + AnnotationName(KeyRetry) + " has no effect; their triggers retry failed deliveries themselves",
+			Severity:   SeverityWarning,
+		})
+	} else if !handler.Idempotent && !IdempotentMethod(handler.Route.Method) {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyRetry),
+			Reason:     fmt.Sprintf("%s requests are not retried unless the handler is marked "+AnnotationName(KeyIdempotent), handler.Route.Method),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	if handler.Retry.Attempts == 1 {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyRetry),
+			Reason:     "attempts=1 calls the handler once, so " + AnnotationName(KeyRetry) + " never retries",
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// IdempotentMethod reports whether repeating a request with method has the effect of
+// sending it once, as HTTP defines for GET, HEAD, OPTIONS, TRACE, PUT and DELETE
+func IdempotentMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	default:
+		return false
+	}
+}
+
+// validateResponses checks that @box:response status codes are real HTTP status codes
+func (v *Validator) validateResponses(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	codes := make([]int, 0, len(handler.Responses))
+	for code := range handler.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	for _, code := range codes {
+		switch {
+		case code < 100 || code > 599:
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyResponse),
+				Reason:     fmt.Sprintf("Invalid HTTP status code: %d (must be 100-599)", code),
+			})
+		case http.StatusText(code) == "":
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyResponse),
+				Reason:     fmt.Sprintf("Status code %d is not a registered HTTP status code", code),
+				Severity:   SeverityWarning,
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateTaskQueue checks that a Cloud Tasks target can be invoked the way the queue calls it
+func (v *Validator) validateTaskQueue(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	// Generated task targets are invoked with POST
+	if handler.Route.Method != "" && handler.Route.Method != "POST" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyTaskQueue),
+			Reason:     fmt.Sprintf("Cloud Tasks delivers tasks with POST, but the handler is declared as %s", handler.Route.Method),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	// Cloud Run IAM is per service, so a container target stays as reachable as its service
+	if handler.DeploymentType == DeploymentContainer {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyTaskQueue),
+			Reason:     "Container task targets share their service's public invoker; use " + AnnotationName(KeyFunction) + " to restrict invocation to Cloud Tasks",
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateSchedule checks that a scheduled handler can be deployed as a Cloud Scheduler job
+func (v *Validator) validateSchedule(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	// A scheduled function only accepts calls from its scheduler job, so it cannot also be routed
+	if handler.Route.Method != "" || handler.Route.Path != "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySchedule),
+			Reason:     AnnotationName(KeySchedule) + " cannot be combined with " + AnnotationName(KeyPath) + "; scheduled handlers are invoked by Cloud Scheduler, not through the gateway",
+		})
+	}
+
+	if handler.DeploymentType == DeploymentContainer {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySchedule),
+			Reason:     "Scheduled handlers must be deployed with " + AnnotationName(KeyFunction),
+		})
+	}
+
+	if strings.Count(handler.Schedule.Cron, " ") == 5 {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySchedule),
+			Reason:     fmt.Sprintf("Cloud Scheduler does not support a seconds field; use a five-field cron expression instead of %q", handler.Schedule.Cron),
+		})
+	}
+
+	if _, err := time.LoadLocation(handler.Schedule.Timezone); err != nil {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySchedule),
+			Reason:     fmt.Sprintf("Unknown time zone %q; use an IANA name such as Europe/Berlin", handler.Schedule.Timezone),
+		})
+	}
+
+	return errors
+}
+
+// validatePubSub checks that a Pub/Sub subscriber can be deployed behind a push subscription
+func (v *Validator) validatePubSub(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.Route.Method != "" || handler.Route.Path != "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyPubSub),
+			Reason:     AnnotationName(KeyPubSub) + " cannot be combined with " + AnnotationName(KeyPath) + "; subscribers receive push deliveries, not gateway requests",
+		})
+	}
+
+	if handler.Schedule != nil || handler.TaskQueue != "" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyPubSub),
+			Reason:     AnnotationName(KeyPubSub) + " cannot be combined with " + AnnotationName(KeySchedule) + " or " + AnnotationName(KeyTaskQueue) + "; a handler has one trigger",
+		})
+	}
+
+	if handler.DeploymentType == DeploymentContainer {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyPubSub),
+			Reason:     "Pub/Sub subscribers must be deployed with " + AnnotationName(KeyFunction),
+		})
+	}
+
+	return errors
+}
+
+// reservedEnvVars are set by the platform or the generated entry points and cannot be declared with @box:env
+var reservedEnvVars = map[string]bool{
+	"PORT":              true,
+	"ENVIRONMENT":       true,
+	"K_SERVICE":         true,
+	"K_REVISION":        true,
+	"K_CONFIGURATION":   true,
+	"FUNCTION_TARGET":   true,
+	"BOX_ENVIRONMENT":   true,
+	"BOX_PROJECT":       true,
+	"BOX_REGION":        true,
+	"BOX_SERVICE":       true,
+	"BOX_FUNCTION_NAME": true,
+}
+
+// validateEnvVars checks that declared variables can be supplied from secrets
+func (v *Validator) validateEnvVars(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	for _, name := range handler.RequiredEnvVars {
+		if reservedEnvVars[name] {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyEnv),
+				Reason:     fmt.Sprintf("%s is set by the platform and cannot be declared with "+AnnotationName(KeyEnv), name),
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateSecrets checks @box:secret bindings. A variable declared with @box:env already
+// reads the secret derived from its name, so binding it again would be ambiguous
+func (v *Validator) validateSecrets(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	if handler.DeploymentType == DeploymentLambda || handler.DeploymentType == DeploymentProxy {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeySecret),
+			Reason:     fmt.Sprintf("Secret Manager secrets are only injected into Cloud Functions and Cloud Run, not %s handlers", handler.DeploymentType),
+			Severity:   SeverityWarning,
+		})
+		return errors
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(handler.Secrets)) {
+		if reservedEnvVars[name] {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeySecret),
+				Reason:     fmt.Sprintf("%s is set by the platform and cannot be read from a secret", name),
+			})
+		}
+		if slices.Contains(handler.RequiredEnvVars, name) {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeySecret),
+				Reason:     fmt.Sprintf("%s is declared by both "+AnnotationName(KeyEnv)+" and "+AnnotationName(KeySecret)+"; keep the "+AnnotationName(KeySecret)+" binding", name),
+			})
+		}
+	}
+
+	return errors
+}
+
+// Request timeout limits of each deployment type
+const (
+	MaxFunctionTimeout  = 540 * time.Second  // Cloud Functions: 9 minutes
+	MaxContainerTimeout = 3600 * time.Second // Cloud Run: 1 hour
+	MaxLambdaTimeout    = 900 * time.Second  // AWS Lambda: 15 minutes
+)
+
+// AutoPromote switches function handlers whose timeout exceeds MaxFunctionTimeout to
+// container deployment and returns the promoted handlers
+// Handlers over MaxContainerTimeout are left alone so validation still reports them
+func AutoPromote(handlers []Handler) []Handler {
+	var promoted []Handler
+	for i := range handlers {
+		handler := &handlers[i]
+		if handler.DeploymentType == DeploymentFunction &&
+			handler.Timeout > MaxFunctionTimeout && handler.Timeout <= MaxContainerTimeout {
+			handler.DeploymentType = DeploymentContainer
+			promoted = append(promoted, *handler)
+		}
+	}
+	return promoted
+}
+
+// validateTimeout validates timeout configuration
+func (v *Validator) validateTimeout(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	// Cloud Functions have max timeout of 540s (9 minutes)
+	// Cloud Run has max timeout of 3600s (1 hour)
+	if handler.DeploymentType == DeploymentFunction {
+		if handler.Timeout > MaxFunctionTimeout {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyTimeout),
+				Reason:     fmt.Sprintf("Cloud Function timeout cannot exceed 540s (9 minutes), got: %v", handler.Timeout),
+			})
+		}
+	} else if handler.DeploymentType == DeploymentContainer {
+		if handler.Timeout > MaxContainerTimeout {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyTimeout),
+				Reason:     fmt.Sprintf("Cloud Run timeout cannot exceed 3600s (1 hour), got: %v", handler.Timeout),
+			})
+		}
+	} else if handler.DeploymentType == DeploymentLambda {
+		if handler.Timeout > MaxLambdaTimeout {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyTimeout),
+				Reason:     fmt.Sprintf("Lambda timeout cannot exceed 900s (15 minutes), got: %v", handler.Timeout),
+			})
+		}
+	}
+
+	// Warn about very short timeouts
+	if handler.Timeout.Seconds() < 5 {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyTimeout),
+			Reason:     fmt.Sprintf("Timeout is very short: %v (consider if this is intentional)", handler.Timeout),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateTags validates explicit OpenAPI tags
+func (v *Validator) validateTags(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	for _, tag := range handler.Tags {
+		if !tagPattern.MatchString(tag) {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyTags),
+				Reason:     fmt.Sprintf("Invalid tag: %q (use letters, digits, '-', '_' or '.', max 64 characters)", tag),
+			})
+		}
+	}
+
+	return errors
+}
+
+// validatePreloads checks that preload resources are site paths or absolute http(s) URLs
+func (v *Validator) validatePreloads(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	for _, resource := range handler.Preloads {
+		if !isPreloadTarget(resource) {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyPreload),
+				Reason:     fmt.Sprintf("Invalid preload resource: %q (use a path like /static/app.css or an http(s) URL)", resource),
+			})
+		}
+	}
+
+	// Link headers are only emitted on GET (and HEAD) responses
+	if method := handler.Route.Method; method != "" && method != "GET" && method != "HEAD" {
+		errors = append(errors, AnnotationError{
+			Handler:    handler.FunctionName,
+			Annotation: AnnotationName(KeyPreload),
+			Reason:     fmt.Sprintf("Preload hints are only sent on GET responses; they have no effect on %s", method),
+			Severity:   SeverityWarning,
+		})
+	}
+
+	return errors
+}
+
+// validateMiddleware warns about repeated @box:middleware names and, when the registered
+// names are known, names nothing registered (the router refuses to start with those)
+func (v *Validator) validateMiddleware(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	seen := make(map[string]bool, len(handler.CustomMiddleware))
+	for _, name := range handler.CustomMiddleware {
+		if seen[name] {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyMiddleware),
+				Reason:     fmt.Sprintf("Middleware %q is listed more than once and will run twice", name),
+				Severity:   SeverityWarning,
+			})
+		}
+		seen[name] = true
+
+		if v.middleware != nil && !v.middleware[name] {
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyMiddleware),
+				Reason:     fmt.Sprintf("Unknown middleware %q; register it with router.RegisterMiddleware", name),
+				Severity:   SeverityWarning,
+			})
+		}
+	}
+
+	return errors
+}
+
+// generatedOpenAPIExtensions are operation extensions the gateway generator writes itself
+var generatedOpenAPIExtensions = map[string]bool{
+	"x-google-backend": true,
+	"x-google-quota":   true,
+	"x-box-roles":      true,
+}
+
+// openAPIExtensionPattern matches an OpenAPI specification extension key
+var openAPIExtensionPattern = regexp.MustCompile(`^x-[A-Za-z0-9._-]+$`)
+
+// validateOpenAPIExtensions checks that passthrough keys are x- extensions Box doesn't already emit
+func (v *Validator) validateOpenAPIExtensions(handler Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	keys := make([]string, 0, len(handler.OpenAPIExtensions))
+	for key := range handler.OpenAPIExtensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch {
+		case !openAPIExtensionPattern.MatchString(key):
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyOpenAPIExt),
+				Reason:     fmt.Sprintf("Invalid extension key: %q (OpenAPI extensions must start with 'x-')", key),
+			})
+		case generatedOpenAPIExtensions[key]:
+			errors = append(errors, AnnotationError{
+				Handler:    handler.FunctionName,
+				Annotation: AnnotationName(KeyOpenAPIExt),
+				Reason:     fmt.Sprintf("%s is generated from the handler's other annotations and cannot be overridden", key),
+			})
+		}
+	}
+
+	return errors
+}
+
+// isPreloadTarget reports whether a preload resource can be placed in a Link header
+func isPreloadTarget(resource string) bool {
+	// Characters that would break the Link header syntax
+	if strings.ContainsAny(resource, "<>;, \t\"") {
+		return false
+	}
+
+	u, err := url.Parse(resource)
+	if err != nil {
+		return false
+	}
+
+	if u.IsAbs() {
+		return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	}
+
+	// Relative references must be rooted site paths, not protocol-relative URLs
+	return strings.HasPrefix(resource, "/") && !strings.HasPrefix(resource, "//")
+}
+
+// ValidateServiceGrouping reports container service groups that mix public and
+// protected routes, since one Cloud Run service then serves both kinds of traffic
+func (v *Validator) ValidateServiceGrouping(handlers []Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	// Group container handlers the same way the build system does (by package name)
+	groups := make(map[string][]Handler)
+	var order []string
+	for _, handler := range handlers {
+		if handler.DeploymentType != DeploymentContainer {
+			continue
+		}
+
+		serviceName := handler.PackageName
+		if serviceName == "" {
+			serviceName = "default"
+		}
+
+		if _, exists := groups[serviceName]; !exists {
+			order = append(order, serviceName)
+		}
+		groups[serviceName] = append(groups[serviceName], handler)
+	}
+
+	for _, serviceName := range order {
+		var public, protected []string
+		for _, handler := range groups[serviceName] {
+			route := fmt.Sprintf("%s %s", handler.Route.Method, handler.Route.Path)
+			switch handler.Auth.Type {
+			case AuthNone, "":
+				public = append(public, route)
+			case AuthRequired:
+				protected = append(protected, route)
+			}
+		}
+
+		if len(public) > 0 && len(protected) > 0 {
+			errors = append(errors, AnnotationError{
+				Handler:    serviceName,
+				Annotation: AnnotationName(KeyAuth),
+				Reason: fmt.Sprintf("Service %s mixes public routes (%s) and auth-required routes (%s); the same container serves both public and protected traffic",
+					serviceName, strings.Join(public, ", "), strings.Join(protected, ", ")),
+				Severity: SeverityInfo,
+			})
+		}
+	}
+
+	return errors
+}
+
+// ValidateEnvVarConsistency reports @box:env names within one container service that
+// differ only in case, and @box:secret variables bound to different secrets. Every handler
+// of a service shares its container environment, and such names would be backed by the same secret
+func (v *Validator) ValidateEnvVarConsistency(handlers []Handler) []AnnotationError {
+	var errors []AnnotationError
+
+	type declaration struct{ name, handler string }
+	services := make(map[string]map[string]declaration) // service -> lowercased name -> first declaration
+	secrets := make(map[string]map[string]declaration)  // service -> variable -> first secret ID and its handler
+
+	for _, handler := range handlers {
+		if handler.DeploymentType != DeploymentContainer {
+			continue
+		}
+
+		serviceName := handler.PackageName
+		if serviceName == "" {
+			serviceName = "default"
+		}
+		if services[serviceName] == nil {
+			services[serviceName] = make(map[string]declaration)
+			secrets[serviceName] = make(map[string]declaration)
+		}
+
+		for _, name := range handler.RequiredEnvVars {
+			key := strings.ToLower(name)
+			existing, seen := services[serviceName][key]
+			if !seen {
+				services[serviceName][key] = declaration{name: name, handler: handler.FunctionName}
+				continue
+			}
+			if existing.name != name {
+				errors = append(errors, AnnotationError{
+					Handler:    handler.FunctionName,
+					Annotation: AnnotationName(KeyEnv),
+					Reason: fmt.Sprintf("%s conflicts with %s declared by %s in service %s; use one spelling",
+						name, existing.name, existing.handler, serviceName),
+				})
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(handler.Secrets)) {
+			id := handler.Secrets[name]
+			existing, seen := secrets[serviceName][name]
+			if !seen {
+				secrets[serviceName][name] = declaration{name: id, handler: handler.FunctionName}
+				continue
+			}
+			if existing.name != id {
+				errors = append(errors, AnnotationError{
+					Handler:    handler.FunctionName,
+					Annotation: AnnotationName(KeySecret),
+					Reason: fmt.Sprintf("%s reads secret %s but %s reads it from %s in service %s; use one secret",
+						name, id, existing.handler, existing.name, serviceName),
+				})
+			}
+		}
+	}
+
+	return errors
+}
+
+// ValidateUniquePaths checks if there are duplicate paths across handlers
 func (v *Validator) ValidateUniquePaths(handlers []Handler) []AnnotationError {
 	var errors []AnnotationError
 	seen := make(map[string]string) // path+method -> handler name
 
 	for _, handler := range handlers {
+		// Scheduled and Pub/Sub handlers have no route to collide on
+		if handler.EventTriggered() && handler.Route.Path == "" {
+			continue
+		}
+
 		key := fmt.Sprintf("%s %s", handler.Route.Method, handler.Route.Path)
 
 		if existing, exists := seen[key]; exists {
 			errors = append(errors, AnnotationError{
 				Handler:    handler.FunctionName,
-				Annotation: "@wylla:path",
+				Annotation: AnnotationName(KeyPath),
 				Reason:     fmt.Sprintf("Duplicate route: %s already defined in handler %s", key, existing),
 			})
 		} else {
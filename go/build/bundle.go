@@ -0,0 +1,87 @@
+package build
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteBundle zips the complete build output tree into a single archive
+// File modes are preserved so deploy scripts stay executable after extraction
+func WriteBundle(outputDir, bundlePath string) error {
+	absBundle, err := filepath.Abs(bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve bundle path: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absBundle), 0755); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	f, err := os.Create(absBundle)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	// filepath.Walk visits files in lexical order, so entry order is stable
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// Skip the bundle itself when it is written inside the output directory
+		if absPath, err := filepath.Abs(path); err == nil && absPath == absBundle {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+
+		return addBundleEntry(zw, path, filepath.ToSlash(relPath), info)
+	})
+	if err != nil {
+		zw.Close()
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize bundle: %w", err)
+	}
+
+	return f.Close()
+}
+
+// addBundleEntry copies a single file into the zip archive
+func addBundleEntry(zw *zip.Writer, path, name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(w, src)
+	return err
+}
@@ -0,0 +1,172 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Drift statuses reported by CompareOutput
+const (
+	DriftAdded    = "added"    // Generated but missing from the committed output
+	DriftRemoved  = "removed"  // Committed but no longer generated
+	DriftModified = "modified" // Present in both with different content
+)
+
+// OutputDrift is a file whose committed content differs from freshly generated output
+type OutputDrift struct {
+	Path   string // Slash-separated path relative to the output directory
+	Status string // DriftAdded, DriftRemoved or DriftModified
+	Diff   string // Line diff (committed -> generated) for modified files
+}
+
+// maxDiffLines bounds the files CompareOutput diffs line by line; larger files are only reported
+const maxDiffLines = 2000
+
+// CompareOutput compares a freshly generated output tree against the committed one
+// Terraform working state (.terraform/, *.tfstate) and the build manifest are ignored,
+// since they are not generated artifacts
+func CompareOutput(generatedDir, committedDir string) ([]OutputDrift, error) {
+	generated, err := ListOutputFiles(generatedDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generated output: %w", err)
+	}
+
+	committed, err := ListOutputFiles(committedDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list committed output: %w", err)
+	}
+
+	paths := make(map[string]bool)
+	for path := range generated {
+		paths[path] = true
+	}
+	for path := range committed {
+		paths[path] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var drift []OutputDrift
+	for _, path := range sorted {
+		switch {
+		case !committed[path]:
+			drift = append(drift, OutputDrift{Path: path, Status: DriftAdded})
+		case !generated[path]:
+			drift = append(drift, OutputDrift{Path: path, Status: DriftRemoved})
+		default:
+			want, err := os.ReadFile(filepath.Join(generatedDir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read generated %s: %w", path, err)
+			}
+			got, err := os.ReadFile(filepath.Join(committedDir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read committed %s: %w", path, err)
+			}
+			if !bytes.Equal(want, got) {
+				drift = append(drift, OutputDrift{
+					Path:   path,
+					Status: DriftModified,
+					Diff:   lineDiff(string(got), string(want)),
+				})
+			}
+		}
+	}
+
+	return drift, nil
+}
+
+// ListOutputFiles returns the generated files under dir as slash-separated relative paths,
+// ignoring the same Terraform working state and manifest as CompareOutput. A missing
+// directory has no files
+func ListOutputFiles(dir string) (map[string]bool, error) {
+	files := make(map[string]bool)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if name == ".terraform" || name == "terraform.tfstate.d" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.Contains(name, ".tfstate") || name == ".terraform.lock.hcl" || name == ManifestFile {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// lineDiff renders the changed lines between two texts, "-" for removed and "+" for added
+func lineDiff(from, to string) string {
+	a := strings.SplitAfter(from, "\n")
+	b := strings.SplitAfter(to, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return fmt.Sprintf("(%d lines -> %d lines; too large to diff)\n", len(a), len(b))
+	}
+
+	// Longest common subsequence table, lcs[i][j] for a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	line := func(prefix, text string) {
+		out.WriteString(prefix)
+		out.WriteString(strings.TrimSuffix(text, "\n"))
+		out.WriteString("\n")
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", a[i])
+			i++
+		default:
+			line("+", b[j])
+			j++
+		}
+	}
+
+	return out.String()
+}
@@ -1,54 +1,74 @@
 package build
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"text/template"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/gravelight-studio/box/go/annotations"
 )
 
 // ContainerGenerator generates Cloud Run container deployment packages
 type ContainerGenerator struct {
-	handlers   []annotations.Handler
-	outputDir  string
-	moduleName string
-	logger     *zap.Logger
-}
-
-// ServiceGroup represents a group of handlers that will be deployed together
-type ServiceGroup struct {
-	Name     string
-	Handlers []annotations.Handler
+	plan           *DeploymentPlan
+	outputDir      string
+	moduleName     string
+	runtimeSecrets bool // Read secrets from Secret Manager in init() instead of the environment
+	concurrency    int  // Services generated at once
+	logger         *zap.Logger
+	incremental    *incrementalBuild // nil generates every service
 }
 
 // Generate creates deployment packages for all container services
 func (cg *ContainerGenerator) Generate() error {
-	if len(cg.handlers) == 0 {
+	if len(cg.plan.Services) == 0 {
 		cg.logger.Info("No container handlers to generate")
 		return nil
 	}
 
+	if err := cg.validateHealthPath(); err != nil {
+		return err
+	}
+
 	// Create containers output directory
 	if err := os.MkdirAll(cg.outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create containers directory: %w", err)
 	}
 
-	// Group handlers by service
-	serviceGroups := cg.groupHandlers()
+	serviceGroups := cg.plan.Services
 
 	cg.logger.Info("Grouped container handlers",
-		zap.Int("total_handlers", len(cg.handlers)),
+		zap.Int("total_handlers", len(cg.plan.ContainerHandlers())),
 		zap.Int("service_groups", len(serviceGroups)))
 
-	// Generate package for each service group
+	// Generate package for each service group, concurrently
+	// Once a package fails, those not yet started are skipped
+	workers, ctx := errgroup.WithContext(context.Background())
+	workers.SetLimit(cg.concurrency)
 	for _, group := range serviceGroups {
-		if err := cg.generateService(group); err != nil {
-			return fmt.Errorf("failed to generate service %s: %w", group.Name, err)
+		if cg.incremental.upToDate("containers/"+toKebabCase(group.Name), group.Handlers...) {
+			continue
 		}
+		workers.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := cg.generateService(group); err != nil {
+				return fmt.Errorf("failed to generate service %s: %w", group.Name, err)
+			}
+			return nil
+		})
+	}
+	if err := workers.Wait(); err != nil {
+		return err
 	}
 
 	cg.logger.Info("Generated all container services",
@@ -58,32 +78,24 @@ func (cg *ContainerGenerator) Generate() error {
 	return nil
 }
 
-// groupHandlers groups handlers by service name from annotations
-func (cg *ContainerGenerator) groupHandlers() []ServiceGroup {
-	serviceMap := make(map[string][]annotations.Handler)
-
-	for _, handler := range cg.handlers {
-		// Get service name from handler metadata
-		// If handler has service specified in some future field, use it
-		// For now, use package name as service grouping
-		serviceName := handler.PackageName
-		if serviceName == "" {
-			serviceName = "default"
-		}
-
-		serviceMap[serviceName] = append(serviceMap[serviceName], handler)
+// validateHealthPath checks the health path is a plain route
+func (cg *ContainerGenerator) validateHealthPath() error {
+	healthPath := cg.plan.Networking.HealthPath
+	if !strings.HasPrefix(healthPath, "/") || strings.ContainsAny(healthPath, " \t\"'{}") {
+		return fmt.Errorf("invalid health path %q: must start with '/' and contain no spaces, quotes or parameters", healthPath)
 	}
+	return nil
+}
 
-	// Convert map to slice
-	var groups []ServiceGroup
-	for name, handlers := range serviceMap {
-		groups = append(groups, ServiceGroup{
-			Name:     name,
-			Handlers: handlers,
-		})
+// healthOverride returns the handler in a service group that serves the health path, if any
+// As in the router, a user handler takes precedence over the built-in health endpoint
+func (cg *ContainerGenerator) healthOverride(group ServiceGroup) *annotations.Handler {
+	for i, handler := range group.Handlers {
+		if handler.Route.Method == "GET" && handler.Route.Path == cg.plan.Networking.HealthPath {
+			return &group.Handlers[i]
+		}
 	}
-
-	return groups
+	return nil
 }
 
 // generateService creates a complete deployment package for a service group
@@ -129,24 +141,60 @@ func (cg *ContainerGenerator) generateServerMain(dir string, group ServiceGroup)
 	}
 	defer file.Close()
 
-	// Get unique package imports
-	packageImports := make(map[string]string)
+	// Get unique package imports, sorted by path as gofmt would order them
+	var packageImports []string
 	for _, h := range group.Handlers {
-		if h.PackagePath != "" {
-			packageImports[h.PackageName] = h.PackagePath
+		if h.PackagePath != "" && !slices.Contains(packageImports, h.PackagePath) {
+			packageImports = append(packageImports, h.PackagePath)
 		}
 	}
+	sort.Strings(packageImports)
+
+	// Instance bounds are only noted when a handler declares them
+	var scaling *InstanceScaling
+	if slices.ContainsFunc(group.Handlers, func(h annotations.Handler) bool { return h.MinInstances > 0 || h.MaxInstances > 0 }) {
+		bounds, err := group.Scaling()
+		if err != nil {
+			return err
+		}
+		scaling = &bounds
+	}
+
+	var secrets []secretEntry
+	if cg.runtimeSecrets {
+		bindings, err := unitSecrets(group.Name, group.Handlers)
+		if err != nil {
+			return err
+		}
+		secrets = secretEntries(bindings)
+	}
+
+	override := cg.healthOverride(group)
+	if override != nil {
+		cg.logger.Warn("Handler overrides built-in health endpoint",
+			zap.String("service", group.Name),
+			zap.String("function", override.FunctionName),
+			zap.String("path", cg.plan.Networking.HealthPath))
+	}
 
 	data := struct {
 		ServiceName    string
 		ModuleName     string
+		HealthPath     string
+		BuiltinHealth  bool
 		Handlers       []annotations.Handler
-		PackageImports map[string]string
+		PackageImports []string
+		Scaling        *InstanceScaling
+		Secrets        []secretEntry
 	}{
 		ServiceName:    group.Name,
 		ModuleName:     cg.moduleName,
+		HealthPath:     cg.plan.Networking.HealthPath,
+		BuiltinHealth:  override == nil,
 		Handlers:       group.Handlers,
 		PackageImports: packageImports,
+		Scaling:        scaling,
+		Secrets:        secrets,
 	}
 
 	return tmpl.Execute(file, data)
@@ -165,9 +213,11 @@ func (cg *ContainerGenerator) generateDockerfile(dir string, group ServiceGroup)
 	data := struct {
 		ServiceName string
 		ModuleName  string
+		HealthPath  string
 	}{
 		ServiceName: group.Name,
 		ModuleName:  cg.moduleName,
+		HealthPath:  cg.plan.Networking.HealthPath,
 	}
 
 	return tmpl.Execute(file, data)
@@ -186,11 +236,13 @@ func (cg *ContainerGenerator) generateCloudBuild(dir string, group ServiceGroup)
 	serviceName := toKebabCase(group.Name)
 
 	data := struct {
-		ServiceName string
-		Region      string
+		ServiceName    string
+		Region         string
+		RuntimeSecrets bool
 	}{
-		ServiceName: serviceName,
-		Region:      "us-central1",
+		ServiceName:    serviceName,
+		Region:         "us-central1",
+		RuntimeSecrets: cg.runtimeSecrets,
 	}
 
 	return tmpl.Execute(file, data)
@@ -228,6 +280,9 @@ func (cg *ContainerGenerator) generateDeployScript(dir string, group ServiceGrou
 // Templates
 
 const serverMainTemplate = `// Code generated by Wylla build system. DO NOT EDIT.
+{{- with .Scaling}}
+// Scaling: {{.Min}} to {{.Max}} instances (@box:min-instances, @box:max-instances), set on the Cloud Run revision by Terraform
+{{- end}}
 package main
 
 import (
@@ -237,15 +292,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+{{- if .Secrets}}
+	"strings"
+{{- end}}
 	"syscall"
 	"time"
-
+{{if .Secrets}}
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+{{- end}}
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gravelight-studio/box/go/router"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
-{{range $pkg, $path := .PackageImports}}
-	"{{$.ModuleName}}/{{$path}}"
+{{range .PackageImports}}
+	"{{$.ModuleName}}/{{.}}"
 {{end}}
 )
 
@@ -262,6 +324,13 @@ func init() {
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
+{{- if .Secrets}}
+
+	// Read secrets before anything looks up the variables they set
+	if err := loadSecrets(context.Background()); err != nil {
+		logger.Fatal("Failed to load secrets", zap.Error(err))
+	}
+{{- end}}
 
 	// Initialize database connection pool
 	databaseURL := os.Getenv("DATABASE_URL")
@@ -274,8 +343,65 @@ func init() {
 		logger.Fatal("Failed to create database pool", zap.Error(err))
 	}
 
+	// Report database connectivity on the health endpoint
+	// Handler packages can add their own checks with router.RegisterReadinessCheck
+	router.RegisterReadinessCheck("database", db.Ping)
+
+	// Expose deployment metadata to handlers (router.DeploymentInfoFromContext reads it)
+	setDefaultEnv("BOX_SERVICE", "{{.ServiceName}}")
+	setDefaultEnv("BOX_ENVIRONMENT", os.Getenv("ENVIRONMENT"))
+
 	logger.Info("Container service initialized",
-		zap.String("service", "{{.ServiceName}}"))
+		zap.String("service", "{{.ServiceName}}"),
+		zap.String("environment", os.Getenv("BOX_ENVIRONMENT")),
+		zap.String("region", os.Getenv("BOX_REGION")))
+}
+
+// setDefaultEnv sets an environment variable unless the deployment already provides it
+func setDefaultEnv(key, value string) {
+	if os.Getenv(key) == "" && value != "" {
+		os.Setenv(key, value)
+	}
+}
+{{- if .Secrets}}
+
+// secrets maps environment variables to the Secret Manager secrets holding their values;
+// ${env} in a secret ID stands for the ENVIRONMENT the service is deployed to
+var secrets = map[string]string{
+{{- range .Secrets}}
+	{{.Key}} {{.Secret}},
+{{- end}}
+}
+
+// loadSecrets sets each variable in secrets to the latest version of its secret in the
+// BOX_PROJECT project
+func loadSecrets(ctx context.Context) error {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Secret Manager client: %w", err)
+	}
+	defer client.Close()
+
+	project := os.Getenv("BOX_PROJECT")
+	for name, secret := range secrets {
+		secret = strings.ReplaceAll(secret, "${env}", os.Getenv("ENVIRONMENT"))
+		version, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+			Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", project, secret),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s for %s: %w", secret, name, err)
+		}
+		os.Setenv(name, string(version.Payload.Data))
+	}
+	return nil
+}
+{{- end}}
+
+// deployed attaches deployment metadata for the named handler to each request
+func deployed(functionName string, handler http.Handler) http.Handler {
+	info := router.DeploymentInfoFromEnv()
+	info.FunctionName = functionName
+	return router.DeploymentInfoMiddleware(info)(handler)
 }
 
 func main() {
@@ -287,18 +413,19 @@ func main() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(router.DisconnectMiddleware()) // Cancel r.Context(), and queries made with it, when clients go away
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	// Register handlers
 {{range .Handlers}}
-	r.Method("{{.Route.Method}}", "{{.Route.Path}}", http.HandlerFunc({{.PackageName}}.{{.FunctionName}}))
+	r.Method("{{.Route.Method}}", "{{.Route.Path}}", deployed("{{.FunctionName}}", {{if .ReturnsHandler}}{{.PackageName}}.{{.FunctionName}}(){{else}}http.HandlerFunc({{.PackageName}}.{{.FunctionName}}){{end}}))
 {{end}}
 
-	// Health check
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+{{- if .BuiltinHealth}}
+
+	// Health check (runs registered readiness checks)
+	r.Get("{{.HealthPath}}", router.HealthHandler())
+{{- end}}
 
 	// Get port from environment
 	port := os.Getenv("PORT")
@@ -389,7 +516,7 @@ EXPOSE 8080
 
 # Health check
 HEALTHCHECK --interval=30s --timeout=3s --start-period=5s --retries=3 \
-    CMD wget --no-verbose --tries=1 --spider http://localhost:8080/health || exit 1
+    CMD wget --no-verbose --tries=1 --spider http://localhost:8080{{.HealthPath}} || exit 1
 
 # Run the service
 ENTRYPOINT ["/app/server"]
@@ -433,6 +560,13 @@ steps:
       - '--region={{.Region}}'
       - '--platform=managed'
       - '--allow-unauthenticated'
+{{- if .RuntimeSecrets}}
+      # The service reads its secrets from Secret Manager at startup
+      - '--set-env-vars=BOX_PROJECT=$PROJECT_ID,ENVIRONMENT=${_ENVIRONMENT}'
+
+substitutions:
+  _ENVIRONMENT: dev
+{{- else}}
       - '--set-env-vars=DATABASE_URL=$$DATABASE_URL'
     secretEnv: ['DATABASE_URL']
 
@@ -440,6 +574,7 @@ availableSecrets:
   secretManager:
     - versionName: projects/$PROJECT_ID/secrets/database-url/versions/latest
       env: 'DATABASE_URL'
+{{- end}}
 
 images:
   - 'gcr.io/$PROJECT_ID/{{.ServiceName}}:$SHORT_SHA'
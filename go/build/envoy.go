@@ -0,0 +1,338 @@
+package build
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// Gateway backends selectable via Config.Gateway
+const (
+	GatewayGCP   = "gcp"   // GCP API Gateway (gateway-config.yaml + deploy.sh)
+	GatewayEnvoy = "envoy" // Self-hosted Envoy proxy (envoy.yaml)
+)
+
+// envoyCluster is an upstream serving one or more routes
+type envoyCluster struct {
+	Name string
+	Host string
+}
+
+// envoyRoute maps a single method/path to an upstream cluster
+type envoyRoute struct {
+	Name        string
+	Path        string // Exact path match (routes without parameters)
+	Regex       string // Full-path regex match (routes with {param} segments)
+	Method      string
+	Cluster     string
+	Rewrite     string // Upstream path for function backends (Cloud Functions serve at /<name>)
+	PathPrefix  string // Prepended to the request path for proxy upstreams with a base path
+	Timeout     int    // Seconds
+	RateLimit   *annotations.RateLimitConfig
+	Requirement string // jwt_authn requirement name; empty disables auth for the route
+}
+
+// generateEnvoyConfig creates a static Envoy configuration routing to the function and container backends
+func (gg *GatewayGenerator) generateEnvoyConfig() error {
+	tmpl := template.Must(template.New("envoy").Parse(envoyConfigTemplate))
+
+	routes, clusters, err := gg.envoyRoutes()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(gg.outputDir, "envoy.yaml"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := struct {
+		Routes    []envoyRoute
+		Clusters  []envoyCluster
+		NeedsAuth bool
+	}{
+		Routes:    routes,
+		Clusters:  clusters,
+		NeedsAuth: gg.hasAuthentication(),
+	}
+
+	return tmpl.Execute(file, data)
+}
+
+// envoyRoutes builds the route table from groupHandlersByPath, along with the clusters it references
+func (gg *GatewayGenerator) envoyRoutes() ([]envoyRoute, []envoyCluster, error) {
+	routesByKey := make(map[string]RoutePlan, len(gg.plan.Routes))
+	for _, route := range gg.plan.Routes {
+		routesByKey[route.Handler.Route.Method+" "+route.Handler.Route.Path] = route
+	}
+
+	var routes []envoyRoute
+	clusterMap := make(map[string]envoyCluster)
+
+	for _, path := range gg.groupHandlersByPath() {
+		methods := make([]string, 0, len(path.Operations))
+		for method := range path.Operations {
+			methods = append(methods, strings.ToUpper(method))
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			planned := routesByKey[method+" "+path.Path]
+			handler := planned.Handler
+
+			cluster, err := gg.envoyClusterFor(planned)
+			if err != nil {
+				return nil, nil, err
+			}
+			clusterMap[cluster.Name] = cluster
+
+			route := envoyRoute{
+				Name:      path.Operations[strings.ToLower(method)].OperationID,
+				Method:    method,
+				Cluster:   cluster.Name,
+				Timeout:   gg.getTimeoutSeconds(handler),
+				RateLimit: handler.RateLimit,
+			}
+
+			if gg.hasPathParameters(path.Path) {
+				route.Regex = pathRegex(path.Path)
+			} else {
+				route.Path = path.Path
+			}
+
+			if planned.Backend.Type == annotations.DeploymentFunction {
+				route.Rewrite = "/" + planned.Backend.Name
+			}
+			if handler.Proxy != nil {
+				upstream, _ := url.Parse(handler.Proxy.UpstreamFor(gg.environment))
+				route.PathPrefix = strings.TrimSuffix(upstream.Path, "/")
+			}
+
+			switch handler.Auth.Type {
+			case annotations.AuthRequired:
+				route.Requirement = "required"
+			case annotations.AuthOptional:
+				route.Requirement = "optional"
+			}
+
+			routes = append(routes, route)
+		}
+	}
+
+	clusters := make([]envoyCluster, 0, len(clusterMap))
+	for _, cluster := range clusterMap {
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Name < clusters[j].Name
+	})
+
+	return routes, clusters, nil
+}
+
+// envoyClusterFor returns the upstream cluster for a route's backend
+// Functions share a single cluster; each container service and proxy upstream host gets its own
+func (gg *GatewayGenerator) envoyClusterFor(route RoutePlan) (envoyCluster, error) {
+	backend, err := url.Parse(gg.routeBackendURL(route))
+	if err != nil || backend.Host == "" {
+		return envoyCluster{}, fmt.Errorf("no backend for handler %s (deployment type %q)", route.Handler.FunctionName, route.Backend.Type)
+	}
+
+	name := "functions"
+	switch route.Backend.Type {
+	case annotations.DeploymentContainer:
+		name = toKebabCase(route.Backend.Name)
+	case annotations.DeploymentProxy:
+		// Clusters connect over TLS on port 443
+		if backend.Scheme != "https" || backend.Port() != "" {
+			return envoyCluster{}, fmt.Errorf("handler %s proxies to %s, but the Envoy gateway only reaches https upstreams on the default port", route.Handler.FunctionName, backend)
+		}
+		name = "proxy-" + strings.ReplaceAll(backend.Hostname(), ".", "-")
+	}
+
+	return envoyCluster{Name: name, Host: backend.Host}, nil
+}
+
+// pathParamPattern matches {param} segments in a route path
+var pathParamPattern = regexp.MustCompile(`\{[^/}]+\}`)
+
+// pathRegex converts a route path with {param} segments into an RE2 full-path match
+func pathRegex(path string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range pathParamPattern.FindAllStringIndex(path, -1) {
+		sb.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		sb.WriteString("[^/]+")
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(path[last:]))
+	return sb.String()
+}
+
+// envoyConfigTemplate is a static Envoy bootstrap with one route per handler
+const envoyConfigTemplate = `# Envoy Configuration
+# Generated by Box - DO NOT EDIT
+#
+# Run with: envoy -c envoy.yaml
+# Rate limits use Envoy's local rate limiter and apply per proxy instance.
+
+static_resources:
+  listeners:
+  - name: box_listener
+    address:
+      socket_address:
+        address: 0.0.0.0
+        port_value: 8080
+    filter_chains:
+    - filters:
+      - name: envoy.filters.network.http_connection_manager
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager
+          stat_prefix: box_ingress
+          route_config:
+            name: box_routes
+            virtual_hosts:
+            - name: box_api
+              domains: ["*"]
+              routes:
+{{- range .Routes}}
+              - name: {{.Name}}
+                match:
+{{- if .Regex}}
+                  safe_regex:
+                    regex: '{{.Regex}}'
+{{- else}}
+                  path: "{{.Path}}"
+{{- end}}
+                  headers:
+                  - name: ":method"
+                    string_match:
+                      exact: {{.Method}}
+                route:
+                  cluster: {{.Cluster}}
+                  timeout: {{.Timeout}}s
+                  auto_host_rewrite: true
+{{- if .Rewrite}}
+                  regex_rewrite:
+                    pattern:
+                      regex: '^.*$'
+                    substitution: "{{.Rewrite}}"
+{{- else if .PathPrefix}}
+                  regex_rewrite:
+                    pattern:
+                      regex: '^(.*)$'
+                    substitution: "{{.PathPrefix}}\\1"
+{{- end}}
+{{- if or .RateLimit $.NeedsAuth}}
+                typed_per_filter_config:
+{{- if .RateLimit}}
+                  envoy.filters.http.local_ratelimit:
+                    "@type": type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+                    stat_prefix: {{.Name}}_rate_limit
+                    token_bucket:
+                      max_tokens: {{.RateLimit.Count}}
+                      tokens_per_fill: {{.RateLimit.Count}}
+                      fill_interval: {{.RateLimit.Period.Seconds}}s
+                    filter_enabled:
+                      default_value:
+                        numerator: 100
+                        denominator: HUNDRED
+                    filter_enforced:
+                      default_value:
+                        numerator: 100
+                        denominator: HUNDRED
+{{- end}}
+{{- if $.NeedsAuth}}
+                  envoy.filters.http.jwt_authn:
+                    "@type": type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.PerRouteConfig
+{{- if .Requirement}}
+                    requirement_name: {{.Requirement}}
+{{- else}}
+                    disabled: true
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+          http_filters:
+{{- if .NeedsAuth}}
+          # TODO: Point the provider at your identity provider's issuer and JWKS endpoint
+          - name: envoy.filters.http.jwt_authn
+            typed_config:
+              "@type": type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication
+              providers:
+                box_auth:
+                  issuer: REPLACE_WITH_ISSUER
+                  forward: true
+                  remote_jwks:
+                    http_uri:
+                      uri: https://REPLACE_WITH_ISSUER/.well-known/jwks.json
+                      cluster: jwks
+                      timeout: 5s
+              requirement_map:
+                required:
+                  provider_name: box_auth
+                optional:
+                  requires_any:
+                    requirements:
+                    - provider_name: box_auth
+                    - allow_missing: {}
+{{- end}}
+          - name: envoy.filters.http.local_ratelimit
+            typed_config:
+              "@type": type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+              stat_prefix: box_rate_limit
+          - name: envoy.filters.http.router
+            typed_config:
+              "@type": type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+
+  clusters:
+{{- range .Clusters}}
+  - name: {{.Name}}
+    type: LOGICAL_DNS
+    dns_lookup_family: V4_ONLY
+    connect_timeout: 5s
+    load_assignment:
+      cluster_name: {{.Name}}
+      endpoints:
+      - lb_endpoints:
+        - endpoint:
+            address:
+              socket_address:
+                address: {{.Host}}
+                port_value: 443
+    transport_socket:
+      name: envoy.transport_sockets.tls
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+        sni: {{.Host}}
+{{- end}}
+{{- if .NeedsAuth}}
+  # TODO: Replace with your identity provider's host
+  - name: jwks
+    type: LOGICAL_DNS
+    dns_lookup_family: V4_ONLY
+    connect_timeout: 5s
+    load_assignment:
+      cluster_name: jwks
+      endpoints:
+      - lb_endpoints:
+        - endpoint:
+            address:
+              socket_address:
+                address: REPLACE_WITH_ISSUER
+                port_value: 443
+    transport_socket:
+      name: envoy.transport_sockets.tls
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+        sni: REPLACE_WITH_ISSUER
+{{- end}}
+`
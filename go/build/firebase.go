@@ -0,0 +1,140 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// FirebaseGenerator writes a Firebase Hosting config (firebase.json) whose rewrites send
+// each route to the Cloud Function or Cloud Run service serving it
+type FirebaseGenerator struct {
+	plan        *DeploymentPlan
+	outputDir   string
+	environment string
+	logger      *zap.Logger
+}
+
+// FirebaseRewrite is one entry of hosting.rewrites
+type FirebaseRewrite struct {
+	Source   string                  `json:"source"`
+	Function *FirebaseFunctionTarget `json:"function,omitempty"`
+	Run      *FirebaseRunTarget      `json:"run,omitempty"`
+}
+
+// FirebaseFunctionTarget rewrites to an HTTP Cloud Function
+type FirebaseFunctionTarget struct {
+	FunctionID string `json:"functionId"`
+	Region     string `json:"region"`
+}
+
+// FirebaseRunTarget rewrites to a Cloud Run service
+type FirebaseRunTarget struct {
+	ServiceID string `json:"serviceId"`
+	Region    string `json:"region"`
+}
+
+// Generate writes firebase.json to the output directory
+func (fg *FirebaseGenerator) Generate() error {
+	rewrites, err := fg.Rewrites()
+	if err != nil {
+		return err
+	}
+
+	config := map[string]any{
+		"hosting": map[string]any{
+			"public":   "public",
+			"ignore":   []string{"firebase.json", "**/.*"},
+			"rewrites": rewrites,
+		},
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode firebase.json: %w", err)
+	}
+
+	if err := os.MkdirAll(fg.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(fg.outputDir, "firebase.json")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write firebase.json: %w", err)
+	}
+
+	fg.logger.Info("Generated Firebase Hosting config",
+		zap.String("file", path),
+		zap.Int("rewrites", len(rewrites)))
+	return nil
+}
+
+// Rewrites maps each route path to its backend, most specific paths first since Firebase
+// applies the first matching rewrite. Rewrites match paths, not methods, so every method
+// on a path must be served by the same function or service
+func (fg *FirebaseGenerator) Rewrites() ([]FirebaseRewrite, error) {
+	bySource := make(map[string]RoutePlan)
+	var conflicts []string
+
+	for _, route := range fg.plan.Routes {
+		// Hosting rewrites only reach Cloud Functions and Cloud Run; proxies need the gateway
+		if route.Backend.Type == annotations.DeploymentProxy {
+			continue
+		}
+
+		source := firebaseSource(route.Handler.Route.Path)
+		existing, seen := bySource[source]
+		if !seen {
+			bySource[source] = route
+			continue
+		}
+		if existing.Backend != route.Backend {
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s %s, %s %s)", source,
+				existing.Handler.Route.Method, existing.Handler.FunctionName,
+				route.Handler.Route.Method, route.Handler.FunctionName))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("firebase rewrites match paths only, but these paths are served by several backends: %s; deploy their handlers in one %s service",
+			strings.Join(conflicts, "; "), annotations.AnnotationName(annotations.KeyContainer))
+	}
+
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		wi, wj := strings.Count(sources[i], "*"), strings.Count(sources[j], "*")
+		if wi != wj {
+			return wi < wj
+		}
+		return sources[i] < sources[j]
+	})
+
+	region := fg.plan.Networking.Region
+	rewrites := make([]FirebaseRewrite, 0, len(sources))
+	for _, source := range sources {
+		backend := bySource[source].Backend
+		rewrite := FirebaseRewrite{Source: source}
+		deployedName := fmt.Sprintf("wylla-%s-%s", fg.environment, backend.Name)
+		if backend.Type == annotations.DeploymentContainer {
+			rewrite.Run = &FirebaseRunTarget{ServiceID: deployedName, Region: region}
+		} else {
+			rewrite.Function = &FirebaseFunctionTarget{FunctionID: deployedName, Region: region}
+		}
+		rewrites = append(rewrites, rewrite)
+	}
+
+	return rewrites, nil
+}
+
+// firebaseSource converts a route path to a Hosting glob, matching {param} segments with *
+func firebaseSource(path string) string {
+	return pathParamPattern.ReplaceAllString(path, "*")
+}
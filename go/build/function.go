@@ -1,28 +1,38 @@
 package build
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
+	"time"
+	"unicode"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/gravelight-studio/box/go/annotations"
 )
 
 // FunctionGenerator generates Cloud Function deployment packages
 type FunctionGenerator struct {
-	handlers   []annotations.Handler
-	outputDir  string
-	moduleName string
-	logger     *zap.Logger
+	plan           *DeploymentPlan
+	outputDir      string
+	moduleName     string
+	defaultTimeout time.Duration // Timeout for handlers without @box:timeout
+	vendor         bool          // Copy handler sources into each function instead of a replace directive
+	runtimeSecrets bool          // Read secrets from Secret Manager in init() instead of the environment
+	concurrency    int           // Functions generated at once
+	logger         *zap.Logger
+	incremental    *incrementalBuild // nil generates every function
 }
 
 // Generate creates deployment packages for all cloud functions
 func (fg *FunctionGenerator) Generate() error {
-	if len(fg.handlers) == 0 {
+	if len(fg.plan.Functions) == 0 {
 		fg.logger.Info("No function handlers to generate")
 		return nil
 	}
@@ -32,15 +42,35 @@ func (fg *FunctionGenerator) Generate() error {
 		return fmt.Errorf("failed to create functions directory: %w", err)
 	}
 
-	// Generate package for each function
-	for _, handler := range fg.handlers {
-		if err := fg.generateFunction(handler); err != nil {
-			return fmt.Errorf("failed to generate function %s: %w", handler.FunctionName, err)
+	// Generate package for each function; the manifest is consulted here, the packages are
+	// written concurrently
+	// Once a package fails, those not yet started are skipped
+	workers, ctx := errgroup.WithContext(context.Background())
+	workers.SetLimit(fg.concurrency)
+	for _, handler := range fg.plan.Functions {
+		artifact := "functions/" + toKebabCase(handler.FunctionName)
+		// Vendored functions also depend on sources the manifest doesn't track
+		if fg.vendor {
+			fg.incremental.rebuild(artifact, handler)
+		} else if fg.incremental.upToDate(artifact, handler) {
+			continue
 		}
+		workers.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := fg.generateFunction(handler); err != nil {
+				return fmt.Errorf("failed to generate function %s: %w", handler.FunctionName, err)
+			}
+			return nil
+		})
+	}
+	if err := workers.Wait(); err != nil {
+		return err
 	}
 
 	fg.logger.Info("Generated all cloud functions",
-		zap.Int("count", len(fg.handlers)),
+		zap.Int("count", len(fg.plan.Functions)),
 		zap.String("output_dir", fg.outputDir))
 
 	return nil
@@ -50,6 +80,12 @@ func (fg *FunctionGenerator) Generate() error {
 func (fg *FunctionGenerator) generateFunction(handler annotations.Handler) error {
 	// Create function directory (kebab-case from function name)
 	functionDir := filepath.Join(fg.outputDir, toKebabCase(handler.FunctionName))
+	if fg.vendor {
+		// Start over so packages the handler no longer imports don't linger
+		if err := os.RemoveAll(functionDir); err != nil {
+			return fmt.Errorf("failed to clean function directory: %w", err)
+		}
+	}
 	if err := os.MkdirAll(functionDir, 0755); err != nil {
 		return fmt.Errorf("failed to create function directory: %w", err)
 	}
@@ -59,12 +95,28 @@ func (fg *FunctionGenerator) generateFunction(handler annotations.Handler) error
 		zap.String("path", handler.Route.Path),
 		zap.String("output_dir", functionDir))
 
+	functionModule := fmt.Sprintf("%s/build/functions/%s", fg.moduleName, toKebabCase(handler.FunctionName))
+	handlerImport := fg.moduleName + "/" + handler.PackagePath
+
+	var vendored *vendoredModule
+	if fg.vendor {
+		var err error
+		if vendored, err = vendorFunction(functionDir, functionModule, handler); err != nil {
+			return err
+		}
+		handlerImport = functionModule + "/" + handler.PackagePath
+	}
+
 	// Generate files
-	if err := fg.generateEntrypoint(functionDir, handler); err != nil {
+	if err := fg.generateEntrypoint(functionDir, handler, handlerImport); err != nil {
 		return fmt.Errorf("failed to generate entrypoint: %w", err)
 	}
 
-	if err := fg.generateGoMod(functionDir, handler); err != nil {
+	if fg.runtimeSecrets && vendored != nil {
+		vendored.require(secretManagerModule, secretManagerVersion)
+	}
+
+	if err := fg.generateGoMod(functionDir, functionModule, vendored); err != nil {
 		return fmt.Errorf("failed to generate go.mod: %w", err)
 	}
 
@@ -79,8 +131,9 @@ func (fg *FunctionGenerator) generateFunction(handler annotations.Handler) error
 	return nil
 }
 
-// generateEntrypoint creates the main.go entry point for the cloud function
-func (fg *FunctionGenerator) generateEntrypoint(dir string, handler annotations.Handler) error {
+// generateEntrypoint creates the main.go entry point for the cloud function, importing
+// the handler package from handlerImport
+func (fg *FunctionGenerator) generateEntrypoint(dir string, handler annotations.Handler, handlerImport string) error {
 	tmpl := template.Must(template.New("entrypoint").Parse(entrypointTemplate))
 
 	file, err := os.Create(filepath.Join(dir, "main.go"))
@@ -89,23 +142,39 @@ func (fg *FunctionGenerator) generateEntrypoint(dir string, handler annotations.
 	}
 	defer file.Close()
 
+	var secrets []secretEntry
+	if fg.runtimeSecrets {
+		bindings, err := unitSecrets(handler.FunctionName, []annotations.Handler{handler})
+		if err != nil {
+			return err
+		}
+		secrets = secretEntries(bindings)
+	}
+
 	data := struct {
-		FunctionName string
-		PackageName  string
-		PackagePath  string
-		ModuleName   string
+		FunctionName   string
+		PackageName    string
+		HandlerImport  string
+		Schedule       *annotations.ScheduleConfig
+		PubSub         *annotations.PubSubConfig
+		ReturnsHandler bool
+		Secrets        []secretEntry
 	}{
-		FunctionName: handler.FunctionName,
-		PackageName:  handler.PackageName,
-		PackagePath:  handler.PackagePath,
-		ModuleName:   fg.moduleName,
+		FunctionName:   handler.FunctionName,
+		PackageName:    handler.PackageName,
+		HandlerImport:  handlerImport,
+		Schedule:       handler.Schedule,
+		PubSub:         handler.PubSub,
+		ReturnsHandler: handler.ReturnsHandler,
+		Secrets:        secrets,
 	}
 
 	return tmpl.Execute(file, data)
 }
 
-// generateGoMod creates the go.mod file for the cloud function
-func (fg *FunctionGenerator) generateGoMod(dir string, handler annotations.Handler) error {
+// generateGoMod creates the go.mod file for the cloud function. Without vendored sources
+// it requires the handler module through a replace directive to the repository root
+func (fg *FunctionGenerator) generateGoMod(dir, functionModule string, vendored *vendoredModule) error {
 	tmpl := template.Must(template.New("gomod").Parse(goModTemplate))
 
 	file, err := os.Create(filepath.Join(dir, "go.mod"))
@@ -115,11 +184,17 @@ func (fg *FunctionGenerator) generateGoMod(dir string, handler annotations.Handl
 	defer file.Close()
 
 	data := struct {
-		FunctionName string
-		ModuleName   string
+		FunctionModule string
+		ModuleName     string
+		Vendored       *vendoredModule
+		SecretManager  string
 	}{
-		FunctionName: toKebabCase(handler.FunctionName),
-		ModuleName:   fg.moduleName,
+		FunctionModule: functionModule,
+		ModuleName:     fg.moduleName,
+		Vendored:       vendored,
+	}
+	if fg.runtimeSecrets {
+		data.SecretManager = secretManagerModule + " " + secretManagerVersion
 	}
 
 	return tmpl.Execute(file, data)
@@ -145,23 +220,26 @@ func (fg *FunctionGenerator) generateFunctionYAML(dir string, handler annotation
 	}
 
 	// Convert timeout to seconds
-	timeoutSeconds := int(handler.Timeout.Seconds())
-	if timeoutSeconds == 0 {
-		timeoutSeconds = 60 // Default 60 seconds
-	}
+	timeoutSeconds := int(handlerTimeout(handler, fg.defaultTimeout).Seconds())
 
 	data := struct {
 		FunctionName   string
 		EntryPoint     string
 		Memory         string
 		TimeoutSeconds int
+		MinInstances   int
+		MaxInstances   int
 		Runtime        string
+		EnvVars        []string
 	}{
 		FunctionName:   handler.FunctionName,
 		EntryPoint:     handler.FunctionName,
 		Memory:         memory,
 		TimeoutSeconds: timeoutSeconds,
+		MinInstances:   handler.MinInstances,
+		MaxInstances:   handler.MaxInstances,
 		Runtime:        "go122", // Go 1.22 runtime
+		EnvVars:        slices.Sorted(slices.Values(handler.RequiredEnvVars)),
 	}
 
 	return tmpl.Execute(file, data)
@@ -184,28 +262,55 @@ func (fg *FunctionGenerator) generateDeployScript(dir string, handler annotation
 	}
 
 	data := struct {
-		FunctionName string
-		Region       string
-		EntryPoint   string
+		FunctionName   string
+		Region         string
+		EntryPoint     string
+		Scheduled      bool
+		PubSub         bool
+		RuntimeSecrets bool
 	}{
-		FunctionName: toKebabCase(handler.FunctionName),
-		Region:       "us-central1", // Default region
-		EntryPoint:   handler.FunctionName,
+		FunctionName:   toKebabCase(handler.FunctionName),
+		Region:         "us-central1", // Default region
+		EntryPoint:     handler.FunctionName,
+		Scheduled:      handler.Schedule != nil,
+		PubSub:         handler.PubSub != nil,
+		RuntimeSecrets: fg.runtimeSecrets,
 	}
 
 	return tmpl.Execute(file, data)
 }
 
-// toKebabCase converts "CreateAccount" to "create-account"
+// toKebabCase converts "CreateAccount" to "create-account" and "GetByID" to "get-by-id"
 func toKebabCase(s string) string {
+	return joinWords(s, '-')
+}
+
+// joinWords lowercases a Go identifier, inserting sep between its words
+// A run of capitals is one word (an acronym), which ends before a capital followed by
+// lowercase letters: "HTTPHandler" -> "http-handler". A trailing "s" pluralizes the
+// acronym instead of starting a word: "ListIDs" -> "list-ids"
+func joinWords(s string, sep rune) string {
+	runes := []rune(s)
+	isUpper := func(i int) bool { return i < len(runes) && unicode.IsUpper(runes[i]) }
+	isLower := func(i int) bool { return i < len(runes) && unicode.IsLower(runes[i]) }
+
 	var result []rune
-	for i, r := range s {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result = append(result, '-')
+	for i, r := range runes {
+		if i > 0 && isUpper(i) {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsLower(prev) || unicode.IsDigit(prev):
+				result = append(result, sep)
+			case unicode.IsUpper(prev) && isLower(i+1):
+				plural := runes[i+1] == 's' && !isLower(i+2)
+				if !plural {
+					result = append(result, sep)
+				}
+			}
 		}
-		result = append(result, r)
+		result = append(result, unicode.ToLower(r))
 	}
-	return strings.ToLower(string(result))
+	return string(result)
 }
 
 // Templates
@@ -215,20 +320,38 @@ package main
 
 import (
 	"context"
+{{- if .PubSub}}
+	"encoding/base64"
+	"encoding/json"
+{{- end}}
+{{- if .Secrets}}
+	"fmt"
+{{- end}}
 	"log"
 	"net/http"
 	"os"
-
+{{- if .Secrets}}
+	"strings"
+{{- end}}
+{{if .Secrets}}
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+{{- end}}
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 
-	"{{.ModuleName}}/{{.PackagePath}}"
+	"{{.HandlerImport}}"
 )
 
 var (
 	db     *pgxpool.Pool
 	logger *zap.Logger
+{{- if .ReturnsHandler}}
+
+	// handler serves the function's requests; {{.PackageName}}.{{.FunctionName}} builds it once per instance
+	handler http.Handler
+{{- end}}
 )
 
 func init() {
@@ -239,6 +362,13 @@ func init() {
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
+{{- if .Secrets}}
+
+	// Read secrets before anything looks up the variables they set
+	if err := loadSecrets(context.Background()); err != nil {
+		logger.Fatal("Failed to load secrets", zap.Error(err))
+	}
+{{- end}}
 
 	// Initialize database connection pool
 	databaseURL := os.Getenv("DATABASE_URL")
@@ -251,15 +381,132 @@ func init() {
 		logger.Fatal("Failed to create database pool", zap.Error(err))
 	}
 
+	// Expose deployment metadata to the handler (router.DeploymentInfoFromContext reads it)
+	setDefaultEnv("BOX_FUNCTION_NAME", "{{.FunctionName}}")
+	setDefaultEnv("BOX_ENVIRONMENT", os.Getenv("ENVIRONMENT"))
+{{- if .ReturnsHandler}}
+
+	// Build the handler once the environment is set up
+	handler = {{.PackageName}}.{{.FunctionName}}()
+{{- end}}
+
 	logger.Info("Cloud function initialized",
-		zap.String("function", "{{.FunctionName}}"))
+		zap.String("function", "{{.FunctionName}}"),
+		zap.String("environment", os.Getenv("BOX_ENVIRONMENT")),
+		zap.String("region", os.Getenv("BOX_REGION")))
 }
 
+// setDefaultEnv sets an environment variable unless the deployment already provides it
+func setDefaultEnv(key, value string) {
+	if os.Getenv(key) == "" && value != "" {
+		os.Setenv(key, value)
+	}
+}
+{{- if .Secrets}}
+
+// secrets maps environment variables to the Secret Manager secrets holding their values;
+// ${env} in a secret ID stands for the ENVIRONMENT the function is deployed to
+var secrets = map[string]string{
+{{- range .Secrets}}
+	{{.Key}} {{.Secret}},
+{{- end}}
+}
+
+// loadSecrets sets each variable in secrets to the latest version of its secret in the
+// BOX_PROJECT project
+func loadSecrets(ctx context.Context) error {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Secret Manager client: %w", err)
+	}
+	defer client.Close()
+
+	project := os.Getenv("BOX_PROJECT")
+	for name, secret := range secrets {
+		secret = strings.ReplaceAll(secret, "${env}", os.Getenv("ENVIRONMENT"))
+		version, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+			Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", project, secret),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s for %s: %w", secret, name, err)
+		}
+		os.Setenv(name, string(version.Payload.Data))
+	}
+	return nil
+}
+{{- end}}
+
 // {{.FunctionName}} is the entry point for the cloud function
+{{- if .Schedule}}
+// It is triggered by Cloud Scheduler ({{.Schedule.Cron}}, {{.Schedule.Timezone}}); IAM restricts
+// invocation to the scheduler's service account, and the header check rejects stray calls
 func {{.FunctionName}}(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-CloudScheduler") != "true" {
+		logger.Warn("Rejected request not sent by Cloud Scheduler",
+			zap.String("function", "{{.FunctionName}}"),
+			zap.String("remote", r.RemoteAddr))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	logger.Info("Scheduled run",
+		zap.String("function", "{{.FunctionName}}"),
+		zap.String("job", r.Header.Get("X-CloudScheduler-JobName")),
+		zap.String("scheduleTime", r.Header.Get("X-CloudScheduler-ScheduleTime")))
+
 	// Call the actual handler from the package
-	{{.PackageName}}.{{.FunctionName}}(w, r)
+	{{if .ReturnsHandler}}handler.ServeHTTP(w, r){{else}}{{.PackageName}}.{{.FunctionName}}(w, r){{end}}
 }
+{{- else if .PubSub}}
+// It receives Pub/Sub push deliveries from topic {{.PubSub.TopicID}} and passes the decoded message
+// data to the handler; any non-2xx response makes Pub/Sub redeliver the message
+func {{.FunctionName}}(w http.ResponseWriter, r *http.Request) {
+	var envelope pushEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		logger.Error("Invalid Pub/Sub push envelope", zap.Error(err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		logger.Error("Invalid Pub/Sub message data",
+			zap.String("messageId", envelope.Message.MessageID),
+			zap.Error(err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Call the actual handler from the package
+	if err := {{.PackageName}}.{{.FunctionName}}(r.Context(), payload); err != nil {
+		logger.Error("Pub/Sub handler failed",
+			zap.String("function", "{{.FunctionName}}"),
+			zap.String("messageId", envelope.Message.MessageID),
+			zap.String("subscription", envelope.Subscription),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushEnvelope is the JSON body of a Pub/Sub push delivery (field names match case-insensitively)
+type pushEnvelope struct {
+	Message struct {
+		Data       string
+		Attributes map[string]string
+		MessageID  string
+	}
+	Subscription string
+}
+{{- else}}
+func {{.FunctionName}}(w http.ResponseWriter, r *http.Request) {
+	// Call the actual handler from the package. r.Context() is cancelled when the client
+	// disconnects, so queries the handler runs with it stop too
+	{{if .ReturnsHandler}}handler.ServeHTTP(w, r){{else}}{{.PackageName}}.{{.FunctionName}}(w, r){{end}}
+}
+{{- end}}
 
 func main() {
 	// Register the function
@@ -278,11 +525,22 @@ func main() {
 }
 `
 
-const goModTemplate = `module {{.ModuleName}}/build/functions/{{.FunctionName}}
+const goModTemplate = `module {{.FunctionModule}}
+{{if .Vendored}}
+go {{or .Vendored.GoVersion "1.22"}}
 
+require (
+{{- range .Vendored.Requires}}
+	{{.}}
+{{- end}}
+)
+{{- else}}
 go 1.22
 
 require (
+{{- with .SecretManager}}
+	{{.}}
+{{- end}}
 	github.com/GoogleCloudPlatform/functions-framework-go v1.8.0
 	github.com/jackc/pgx/v5 v5.5.0
 	go.uber.org/zap v1.26.0
@@ -290,6 +548,7 @@ require (
 )
 
 replace {{.ModuleName}} => ../../..
+{{- end}}
 `
 
 const functionYAMLTemplate = `# GCP Cloud Function Configuration
@@ -302,10 +561,22 @@ entryPoint: {{.EntryPoint}}
 # Resource limits
 availableMemoryMb: {{.Memory}}
 timeout: {{.TimeoutSeconds}}s
+{{- if .MinInstances}}
+minInstances: {{.MinInstances}}
+{{- end}}
+{{- if .MaxInstances}}
+maxInstances: {{.MaxInstances}}
+{{- end}}
 
 # Environment
 environmentVariables:
   GO111MODULE: "on"
+{{- if .EnvVars}}
+  # Required by @box:env; Terraform reads each from Secret Manager, set real values when deploying by hand
+{{- range .EnvVars}}
+  {{.}}: "REQUIRED"
+{{- end}}
+{{- end}}
 
 # Trigger
 httpsTrigger:
@@ -341,9 +612,18 @@ gcloud functions deploy "$FUNCTION_NAME" \
     --source=. \
     --entry-point="$ENTRY_POINT" \
     --trigger-http \
-    --allow-unauthenticated \
-    --set-env-vars="DATABASE_URL=$DATABASE_URL"
+    {{if or .Scheduled .PubSub}}--no-allow-unauthenticated{{else}}--allow-unauthenticated{{end}} \
+{{- if .RuntimeSecrets}}
+    --set-env-vars="BOX_PROJECT=$PROJECT_ID,ENVIRONMENT=${ENVIRONMENT:-dev},BOX_REGION=$REGION"
+{{- else}}
+    --set-env-vars="DATABASE_URL=$DATABASE_URL,BOX_REGION=$REGION"
+{{- end}}
 
 echo "Function deployed successfully!"
+{{- if .Scheduled}}
+echo "Invoked by Cloud Scheduler only; apply the Terraform configuration to create its job"
+{{- else if .PubSub}}
+echo "Invoked by Pub/Sub only; apply the Terraform configuration to create its push subscription"
+{{- end}}
 echo "URL: https://$REGION-$PROJECT_ID.cloudfunctions.net/$FUNCTION_NAME"
 `
@@ -1,26 +1,47 @@
 package build
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"go.uber.org/zap"
+	"golang.org/x/tools/go/packages"
+	"gopkg.in/yaml.v3"
 
 	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/config"
 )
 
 // GatewayGenerator generates OpenAPI specifications and GCP API Gateway configurations
 type GatewayGenerator struct {
-	handlers   []annotations.Handler
-	outputDir  string
-	moduleName string
-	projectID  string // GCP project ID
-	region     string // GCP region for backends
-	logger     *zap.Logger
+	plan             *DeploymentPlan
+	outputDir        string
+	moduleName       string
+	projectID        string        // GCP project ID
+	environment      string        // Selects each @box:proxy route's upstream
+	defaultResponses []string      // Error status codes documented on every operation
+	defaultTimeout   time.Duration // Backend deadline for handlers without @box:timeout
+	backend          string        // Gateway backend: GatewayGCP or GatewayEnvoy
+	validateOpenAPI  bool          // Validate the generated spec against the OpenAPI 3.0 schema
+	skipSchemas      bool          // Leave @box:request and @box:response body schemas out of the spec
+	docs             config.DocsConfig
+	logger           *zap.Logger
 }
 
 // OpenAPIPath represents a path in the OpenAPI spec with its operations
@@ -31,13 +52,18 @@ type OpenAPIPath struct {
 
 // OpenAPIOperation represents a single operation (method) on a path
 type OpenAPIOperation struct {
-	OperationID string
-	Summary     string
-	Tags        []string
-	Security    []map[string][]string
-	Parameters  []OpenAPIParameter
-	Responses   map[string]OpenAPIResponse
-	XGoogle     map[string]interface{} // GCP extensions
+	OperationID    string
+	Summary        string
+	Description    string // May span several lines
+	Deprecated     bool
+	Tags           []string
+	Security       []map[string][]string
+	Parameters     []OpenAPIParameter
+	Responses      map[string]OpenAPIResponse
+	RequestBody    string                 // Component schema of the JSON request body from @box:request
+	RequestExample string                 // Request body example from @box:request-example, rendered as indented YAML
+	XGoogle        map[string]interface{} // GCP extensions
+	Extensions     map[string]string      // Raw x-* extensions from @box:openapi-ext
 }
 
 // OpenAPIParameter represents a path/query parameter
@@ -52,22 +78,70 @@ type OpenAPIParameter struct {
 type OpenAPIResponse struct {
 	Description string
 	Content     map[string]interface{}
+	Ref         string // Reference to a shared response component (e.g., "#/components/responses/BadRequest")
+	Headers     []OpenAPIHeader
+	Schema      string // Component schema of the JSON body from @box:response (e.g., "#/components/schemas/users.User")
+	Example     string // JSON body example from @box:response-example, rendered as indented YAML
 }
 
+// OpenAPIHeader represents a documented response header
+type OpenAPIHeader struct {
+	Name        string
+	Description string
+	Type        string // JSON Schema type, "string" when empty
+}
+
+// OpenAPIErrorResponse is a shared error response component referencing the Error schema
+type OpenAPIErrorResponse struct {
+	Name        string
+	Description string
+}
+
+// errorResponseComponents names the shared components for well-known error status codes
+var errorResponseComponents = map[string]OpenAPIErrorResponse{
+	"400": {Name: "BadRequest", Description: "Bad request"},
+	"401": {Name: "Unauthorized", Description: "Unauthorized - missing or invalid authentication"},
+	"403": {Name: "Forbidden", Description: "Forbidden - insufficient permissions"},
+	"404": {Name: "NotFound", Description: "Resource not found"},
+	"409": {Name: "Conflict", Description: "Conflict with the current state of the resource"},
+	"422": {Name: "UnprocessableEntity", Description: "Unprocessable entity - validation failed"},
+	"429": {Name: "TooManyRequests", Description: "Too many requests - rate limit exceeded"},
+	"500": {Name: "InternalServerError", Description: "Internal server error"},
+	"503": {Name: "ServiceUnavailable", Description: "Service unavailable"},
+}
+
+// DefaultErrorResponses are the error status codes documented on every operation by default
+var DefaultErrorResponses = []string{"400", "500"}
+
 // Generate creates OpenAPI spec and API Gateway configuration
 func (gg *GatewayGenerator) Generate() error {
-	if len(gg.handlers) == 0 {
+	if len(gg.plan.Routes) == 0 {
 		gg.logger.Info("No handlers to generate gateway configuration")
 		return nil
 	}
 
+	// Default responses must be 4xx/5xx codes so they can share the Error schema
+	for _, code := range gg.defaultResponses {
+		if _, err := errorResponseComponent(code); err != nil {
+			return fmt.Errorf("invalid default response: %w", err)
+		}
+	}
+
+	if gg.backend != GatewayGCP && gg.backend != GatewayEnvoy {
+		return fmt.Errorf("unsupported gateway %q (expected %q or %q)", gg.backend, GatewayGCP, GatewayEnvoy)
+	}
+
+	if err := gg.checkMethods(); err != nil {
+		return err
+	}
+
 	// Create gateway output directory
 	if err := os.MkdirAll(gg.outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create gateway directory: %w", err)
 	}
 
 	gg.logger.Info("Generating API Gateway configuration",
-		zap.Int("handlers", len(gg.handlers)),
+		zap.Int("handlers", len(gg.plan.Routes)),
 		zap.String("output_dir", gg.outputDir))
 
 	// Generate OpenAPI specification
@@ -75,6 +149,25 @@ func (gg *GatewayGenerator) Generate() error {
 		return fmt.Errorf("failed to generate OpenAPI spec: %w", err)
 	}
 
+	if gg.validateOpenAPI {
+		if err := ValidateOpenAPISpec(filepath.Join(gg.outputDir, "openapi.yaml")); err != nil {
+			return err
+		}
+		gg.logger.Info("Validated OpenAPI spec")
+	}
+
+	// Envoy replaces the GCP API Gateway config and deploy script
+	if gg.backend == GatewayEnvoy {
+		if err := gg.generateEnvoyConfig(); err != nil {
+			return fmt.Errorf("failed to generate envoy config: %w", err)
+		}
+
+		gg.logger.Info("Generated Envoy gateway configuration",
+			zap.String("envoy_config", filepath.Join(gg.outputDir, "envoy.yaml")))
+
+		return nil
+	}
+
 	// Generate API Gateway config
 	if err := gg.generateGatewayConfig(); err != nil {
 		return fmt.Errorf("failed to generate gateway config: %w", err)
@@ -95,6 +188,8 @@ func (gg *GatewayGenerator) Generate() error {
 func (gg *GatewayGenerator) generateOpenAPISpec() error {
 	tmpl := template.Must(template.New("openapi").Funcs(template.FuncMap{
 		"join":           strings.Join,
+		"yamlScalar":     yamlScalar,
+		"yamlText":       yamlText,
 		"formatSecurity": gg.formatSecurity,
 		"hasParameters":  gg.hasPathParameters,
 		"extractParams":  gg.extractPathParameters,
@@ -112,41 +207,114 @@ func (gg *GatewayGenerator) generateOpenAPISpec() error {
 	// Group handlers by path
 	paths := gg.groupHandlersByPath()
 
-	// Get all unique tags (package names)
-	tags := gg.extractTags()
+	// Get all unique tags (package names), documented and grouped as configured
+	tags, tagGroups := gg.documentTags(gg.extractTags())
 
 	// Determine if we need security definitions
 	needsAuth := gg.hasAuthentication()
 
+	// Collect the shared error responses referenced by any operation
+	errorResponses := gg.collectErrorResponses(paths)
+
+	// Document the @box:request and @box:response body types
+	schemas, err := gg.attachBodySchemas(paths)
+	if err != nil {
+		return err
+	}
+
+	// Embed the @box:request-example and @box:response-example files
+	if err := gg.attachExamples(paths); err != nil {
+		return err
+	}
+
 	data := struct {
-		Title      string
-		Version    string
-		Paths      []OpenAPIPath
-		Tags       []string
-		NeedsAuth  bool
-		ProjectID  string
-		Region     string
-		ModuleName string
+		Title          string
+		Version        string
+		Paths          []OpenAPIPath
+		Tags           []OpenAPITag
+		TagGroups      []OpenAPITagGroup
+		NeedsAuth      bool
+		ErrorResponses []OpenAPIErrorResponse
+		Schemas        string // Extracted body schemas, rendered under components.schemas
+		ProjectID      string
+		Region         string
+		ModuleName     string
+		Deadline       string // Backend deadline for operations without @box:timeout
 	}{
-		Title:      "Wylla API",
-		Version:    "1.0.0",
-		Paths:      paths,
-		Tags:       tags,
-		NeedsAuth:  needsAuth,
-		ProjectID:  gg.projectID,
-		Region:     gg.region,
-		ModuleName: gg.moduleName,
+		Title:          "Wylla API",
+		Version:        "1.0.0",
+		Paths:          paths,
+		Tags:           tags,
+		TagGroups:      tagGroups,
+		NeedsAuth:      needsAuth,
+		ErrorResponses: errorResponses,
+		Schemas:        schemas,
+		ProjectID:      gg.projectID,
+		Region:         gg.plan.Networking.Region,
+		ModuleName:     gg.moduleName,
+		Deadline:       fmt.Sprintf("%.1f", handlerTimeout(annotations.Handler{}, gg.defaultTimeout).Seconds()),
 	}
 
 	return tmpl.Execute(file, data)
 }
 
+// ValidateOpenAPISpec loads an OpenAPI document and checks it against the OpenAPI 3.0 specification
+func ValidateOpenAPISpec(path string) error {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load OpenAPI spec %s: %w", path, err)
+	}
+
+	if err := doc.Validate(loader.Context); err != nil {
+		return fmt.Errorf("invalid OpenAPI spec %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// gatewayDerivedMethods are answered by GCP API Gateway itself: HEAD from the GET
+// operation and OPTIONS as CORS preflight, so the spec must not declare them
+var gatewayDerivedMethods = map[string]bool{"head": true, "options": true}
+
+// checkMethods rejects routes whose method OpenAPI can't express and warns about the
+// HEAD and OPTIONS handlers left out of the GCP spec
+func (gg *GatewayGenerator) checkMethods() error {
+	for _, route := range gg.plan.Routes {
+		handler := route.Handler
+		method := strings.ToLower(handler.Route.Method)
+		if method == "" {
+			continue // No @box:path; the validator reports it
+		}
+		if !slices.Contains(openAPIMethods, method) {
+			return fmt.Errorf("handler %s: method %s has no OpenAPI operation", handler.FunctionName, handler.Route.Method)
+		}
+		if gg.omitsMethod(method) {
+			gg.logger.Warn("API Gateway answers this method itself; leaving the handler out of openapi.yaml",
+				zap.String("handler", handler.FunctionName),
+				zap.String("method", handler.Route.Method),
+				zap.String("path", handler.Route.Path))
+		}
+	}
+	return nil
+}
+
+// omitsMethod reports whether operations for method (lowercase) are left out of the spec
+func (gg *GatewayGenerator) omitsMethod(method string) bool {
+	return method == "" || (gg.backend == GatewayGCP && gatewayDerivedMethods[method])
+}
+
 // groupHandlersByPath groups handlers by their route path
 func (gg *GatewayGenerator) groupHandlersByPath() []OpenAPIPath {
 	pathMap := make(map[string]*OpenAPIPath)
 
-	for _, handler := range gg.handlers {
+	for _, route := range gg.plan.Routes {
+		handler := route.Handler
 		path := handler.Route.Path
+		method := strings.ToLower(handler.Route.Method)
+		if gg.omitsMethod(method) {
+			continue
+		}
 		if _, exists := pathMap[path]; !exists {
 			pathMap[path] = &OpenAPIPath{
 				Path:       path,
@@ -155,15 +323,17 @@ func (gg *GatewayGenerator) groupHandlersByPath() []OpenAPIPath {
 		}
 
 		// Create operation for this method
-		method := strings.ToLower(handler.Route.Method)
 		pathMap[path].Operations[method] = &OpenAPIOperation{
 			OperationID: handler.FunctionName,
-			Summary:     fmt.Sprintf("%s %s", handler.Route.Method, handler.Route.Path),
-			Tags:        []string{handler.PackageName},
+			Summary:     operationSummary(handler),
+			Description: operationDescription(handler),
+			Deprecated:  handler.Deprecated,
+			Tags:        handlerTags(handler),
 			Security:    gg.buildSecurityRequirement(handler),
 			Parameters:  gg.buildParameters(handler),
 			Responses:   gg.buildResponses(handler),
-			XGoogle:     gg.buildGCPExtensions(handler),
+			XGoogle:     gg.buildGCPExtensions(route),
+			Extensions:  operationExtensions(handler),
 		}
 	}
 
@@ -211,37 +381,102 @@ func (gg *GatewayGenerator) buildParameters(handler annotations.Handler) []OpenA
 		})
 	}
 
+	// Paginated list endpoints accept page/limit (see router.PageFromRequest)
+	if handler.Paginated {
+		for _, name := range []string{"page", "limit"} {
+			params = append(params, OpenAPIParameter{
+				Name:     name,
+				In:       "query",
+				Required: false,
+				Schema: map[string]string{
+					"type": "integer",
+				},
+			})
+		}
+	}
+
 	return params
 }
 
-// buildResponses creates standard response definitions
+// buildResponses creates response definitions, referencing shared error components
 func (gg *GatewayGenerator) buildResponses(handler annotations.Handler) map[string]OpenAPIResponse {
 	responses := map[string]OpenAPIResponse{
 		"200": {
 			Description: "Successful response",
 		},
-		"400": {
-			Description: "Bad request",
-		},
-		"500": {
-			Description: "Internal server error",
-		},
 	}
 
+	// Configurable default error responses
+	errorCodes := append([]string{}, gg.defaultResponses...)
+
 	// Add auth-specific responses
 	if handler.Auth.Type != annotations.AuthNone {
-		responses["401"] = OpenAPIResponse{
-			Description: "Unauthorized - missing or invalid authentication",
+		errorCodes = append(errorCodes, "401", "403")
+	}
+
+	// Add rate limit response
+	if handler.RateLimit != nil {
+		errorCodes = append(errorCodes, "429")
+	}
+
+	// Maintainable endpoints can be switched to 503 at runtime
+	if handler.Maintainable {
+		errorCodes = append(errorCodes, "503")
+	}
+
+	for _, code := range errorCodes {
+		component, err := errorResponseComponent(code)
+		if err != nil {
+			continue // Rejected up front in Generate
 		}
-		responses["403"] = OpenAPIResponse{
-			Description: "Forbidden - insufficient permissions",
+		responses[code] = OpenAPIResponse{
+			Description: component.Description,
+			Ref:         "#/components/responses/" + component.Name,
 		}
 	}
 
-	// Add rate limit response
+	// Document the headers set by router.RateLimitMiddleware. A $ref response can't carry
+	// headers, so a rate-limited 429 is written inline with the shared Error body
 	if handler.RateLimit != nil {
+		rateLimitHeaders := []OpenAPIHeader{
+			{Name: "X-RateLimit-Limit", Description: "Requests allowed per window", Type: "integer"},
+			{Name: "X-RateLimit-Remaining", Description: "Requests left in the current window", Type: "integer"},
+			{Name: "X-RateLimit-Reset", Description: "Unix time at which the current window resets", Type: "integer"},
+		}
+
+		success := responses["200"]
+		success.Headers = append(success.Headers, rateLimitHeaders...)
+		responses["200"] = success
+
 		responses["429"] = OpenAPIResponse{
-			Description: "Too many requests - rate limit exceeded",
+			Description: responses["429"].Description,
+			Headers: append(rateLimitHeaders,
+				OpenAPIHeader{Name: "Retry-After", Description: "Seconds until the client may retry", Type: "integer"}),
+			Schema: "#/components/schemas/Error",
+		}
+	}
+
+	// Document the Link headers emitted for @box:preload
+	if len(handler.Preloads) > 0 && (handler.Route.Method == "GET" || handler.Route.Method == "HEAD") {
+		responses["200"] = withResponseHeader(responses["200"], "Link",
+			"Preload hints (rel=preload) for "+strings.Join(handler.Preloads, ", "))
+	}
+
+	// Document the headers set by router.WritePage
+	if handler.Paginated {
+		responses["200"] = withResponseHeader(responses["200"], "X-Total-Count", "Total number of items across all pages")
+		responses["200"] = withResponseHeader(responses["200"], "Link", "Pagination links (rel=first, prev, next, last)")
+	}
+
+	// Document which origins and response headers browsers may use cross-origin
+	if handler.CORS != nil {
+		responses["200"] = withResponseHeader(responses["200"], "Access-Control-Allow-Origin",
+			"Echoes the request Origin when allowed: "+describeCORSOrigins(handler.CORS))
+		responses["200"] = withResponseHeader(responses["200"], "Access-Control-Expose-Headers",
+			"Headers readable by cross-origin clients: "+strings.Join(handler.CORS.EffectiveExposedHeaders(), ", "))
+		if handler.CORS.AllowCredentials {
+			responses["200"] = withResponseHeader(responses["200"], "Access-Control-Allow-Credentials",
+				"true: browsers may send cookies and Authorization headers cross-origin")
 		}
 	}
 
@@ -252,17 +487,616 @@ func (gg *GatewayGenerator) buildResponses(handler annotations.Handler) map[stri
 		}
 	}
 
+	// @box:response adds or overrides responses, keeping any documented headers
+	for code, description := range handler.Responses {
+		key := strconv.Itoa(code)
+		responses[key] = OpenAPIResponse{
+			Description: description,
+			Headers:     responses[key].Headers,
+		}
+	}
+
 	return responses
 }
 
+// withResponseHeader documents a header on a response, merging descriptions when
+// several features set the same header (e.g., preload and pagination Link values)
+func withResponseHeader(response OpenAPIResponse, name, description string) OpenAPIResponse {
+	for i, header := range response.Headers {
+		if header.Name == name {
+			response.Headers[i].Description += "; " + description
+			return response
+		}
+	}
+
+	response.Headers = append(response.Headers, OpenAPIHeader{Name: name, Description: description})
+	return response
+}
+
+// errorResponseComponent returns the shared component for an error status code
+func errorResponseComponent(code string) (OpenAPIErrorResponse, error) {
+	if component, ok := errorResponseComponents[code]; ok {
+		return component, nil
+	}
+
+	status, err := strconv.Atoi(code)
+	if err != nil || status < 400 || status > 599 {
+		return OpenAPIErrorResponse{}, fmt.Errorf("%q is not a 4xx/5xx status code", code)
+	}
+
+	return OpenAPIErrorResponse{
+		Name:        "Error" + code,
+		Description: http.StatusText(status),
+	}, nil
+}
+
+// operationSummary returns the handler's @box:summary, defaulting to "METHOD /path"
+func operationSummary(handler annotations.Handler) string {
+	if handler.Summary != "" {
+		return handler.Summary
+	}
+	return fmt.Sprintf("%s %s", handler.Route.Method, handler.Route.Path)
+}
+
+// operationDescription returns the handler's @box:description, noting any @box:roles
+// (the gateway can't express them as a security requirement) and @box:deprecated guidance
+func operationDescription(handler annotations.Handler) string {
+	var paragraphs []string
+	if handler.Description != "" {
+		paragraphs = append(paragraphs, handler.Description)
+	}
+	if len(handler.RequiredRoles) > 0 {
+		paragraphs = append(paragraphs, "Requires one of the roles: "+strings.Join(handler.RequiredRoles, ", "))
+	}
+	if handler.Deprecated && handler.DeprecationNote != "" {
+		paragraphs = append(paragraphs, "Deprecated: "+handler.DeprecationNote)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// operationExtensions returns the handler's @box:openapi-ext passthrough plus x-box-roles,
+// listing the roles the router enforces behind the gateway's JWT check
+func operationExtensions(handler annotations.Handler) map[string]string {
+	if len(handler.RequiredRoles) == 0 {
+		return handler.OpenAPIExtensions
+	}
+
+	extensions := make(map[string]string, len(handler.OpenAPIExtensions)+1)
+	for key, value := range handler.OpenAPIExtensions {
+		extensions[key] = value
+	}
+	extensions["x-box-roles"] = strings.Join(handler.RequiredRoles, ",")
+	return extensions
+}
+
+// yamlText renders text that may span several lines: a scalar for one line, otherwise a
+// literal block indented by indent spaces
+func yamlText(value string, indent int) string {
+	if !strings.Contains(value, "\n") {
+		return yamlScalar(value)
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return "|-\n" + strings.Join(lines, "\n")
+}
+
+// yamlScalar renders free text as a YAML scalar, quoting it only when a plain scalar would
+// be misread (e.g., a @box:response description containing ": " or starting with a quote)
+func yamlScalar(value string) string {
+	if value == "" || strings.ContainsAny(value[:1], `-?:,[]{}#&*!|>'"%@`+"`") ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #") ||
+		strings.HasSuffix(value, ":") || strings.TrimSpace(value) != value {
+		return strconv.Quote(value)
+	}
+
+	// Plain scalars that YAML would resolve to a number, boolean or null
+	switch strings.ToLower(value) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(value)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.Quote(value)
+	}
+
+	return value
+}
+
+// attachBodySchemas points each operation at the component schemas of its @box:request and
+// @box:response types, returning the components as YAML indented under components.schemas
+func (gg *GatewayGenerator) attachBodySchemas(paths []OpenAPIPath) (string, error) {
+	if gg.skipSchemas {
+		return "", nil
+	}
+
+	extractor := NewSchemaExtractor()
+	for _, route := range gg.plan.Routes {
+		handler := route.Handler
+		if handler.RequestType == "" && handler.ResponseType == "" {
+			continue
+		}
+
+		op := findOperation(paths, handler)
+		if op == nil {
+			continue
+		}
+
+		if handler.RequestType != "" {
+			ref, err := extractor.Extract(handler, handler.RequestType)
+			if err != nil {
+				return "", fmt.Errorf("handler %s: %s: %w", handler.FunctionName, annotations.AnnotationName(annotations.KeyRequest), err)
+			}
+			op.RequestBody = ref
+		}
+		if handler.ResponseType != "" {
+			ref, err := extractor.Extract(handler, handler.ResponseType)
+			if err != nil {
+				return "", fmt.Errorf("handler %s: %s: %w", handler.FunctionName, annotations.AnnotationName(annotations.KeyResponse), err)
+			}
+			response := op.Responses["200"]
+			response.Schema = ref
+			op.Responses["200"] = response
+		}
+	}
+
+	if len(extractor.Schemas()) == 0 {
+		return "", nil
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(extractor.Schemas()); err != nil {
+		return "", fmt.Errorf("failed to render body schemas: %w", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "    " + line
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// findOperation returns the operation generated for handler, or nil when it was left out
+func findOperation(paths []OpenAPIPath, handler annotations.Handler) *OpenAPIOperation {
+	for _, path := range paths {
+		if path.Path == handler.Route.Path {
+			return path.Operations[strings.ToLower(handler.Route.Method)]
+		}
+	}
+	return nil
+}
+
+// attachExamples reads each handler's example files into its request body and 200 response
+func (gg *GatewayGenerator) attachExamples(paths []OpenAPIPath) error {
+	for _, route := range gg.plan.Routes {
+		handler := route.Handler
+		if handler.RequestExample == "" && handler.ResponseExample == "" {
+			continue
+		}
+
+		op := findOperation(paths, handler)
+		if op == nil {
+			continue
+		}
+
+		if handler.RequestExample != "" {
+			example, err := readExample(handler, handler.RequestExample, 14)
+			if err != nil {
+				return fmt.Errorf("handler %s: %s: %w", handler.FunctionName, annotations.AnnotationName(annotations.KeyRequestExample), err)
+			}
+			op.RequestExample = example
+		}
+		if handler.ResponseExample != "" {
+			example, err := readExample(handler, handler.ResponseExample, 16)
+			if err != nil {
+				return fmt.Errorf("handler %s: %s: %w", handler.FunctionName, annotations.AnnotationName(annotations.KeyResponseExample), err)
+			}
+			response := op.Responses["200"]
+			response.Example = example
+			op.Responses["200"] = response
+		}
+	}
+	return nil
+}
+
+// readExample reads a JSON example file, resolved relative to the handler's source file,
+// and renders it as block YAML indented by indent spaces
+func readExample(handler annotations.Handler, file string, indent int) (string, error) {
+	data, err := os.ReadFile(examplePath(handler, file))
+	if err != nil {
+		return "", fmt.Errorf("failed to read example: %w", err)
+	}
+	if !json.Valid(data) {
+		return "", fmt.Errorf("%s is not valid JSON", file)
+	}
+
+	// JSON is YAML, so parsing it keeps the file's key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return "", fmt.Errorf("failed to read example %s: %w", file, err)
+	}
+	blockStyle(&node)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return "", fmt.Errorf("failed to render example %s: %w", file, err)
+	}
+
+	pad := strings.Repeat(" ", indent)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = pad + line
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// examplePath resolves an example file named by an annotation against the handler's source file
+func examplePath(handler annotations.Handler, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(handler.FilePath), file)
+}
+
+// blockStyle drops JSON's flow collections and quoting so the example renders as plain
+// block YAML; the encoder still quotes strings that would otherwise read as other types
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// SchemaExtractor converts the Go types named by @box:request and @box:response into
+// OpenAPI component schemas, named "<package>.<Type>"
+// Handler packages are loaded with go/packages and their types resolved with go/types, so
+// named types from other packages (e.g., models.User) get components of their own.
+// time.Time, time.Duration and json.RawMessage are understood
+type SchemaExtractor struct {
+	fset     *token.FileSet            // Positions of every loaded package
+	packages map[string]*types.Package // Source directory -> handler package
+	files    map[string]*ast.File      // Source file -> syntax, for field docs
+	indexed  map[string]bool           // Source files whose fields are in fields
+	fields   map[token.Pos]*ast.Field  // Field name position -> field
+	schemas  map[string]interface{}    // Component name -> schema
+}
+
+// NewSchemaExtractor creates a schema extractor
+func NewSchemaExtractor() *SchemaExtractor {
+	return &SchemaExtractor{
+		fset:     token.NewFileSet(),
+		packages: make(map[string]*types.Package),
+		files:    make(map[string]*ast.File),
+		indexed:  make(map[string]bool),
+		fields:   make(map[token.Pos]*ast.Field),
+		schemas:  make(map[string]interface{}),
+	}
+}
+
+// Extract adds the schema of a type declared in the handler's package, and of the types it
+// references, returning its $ref
+func (se *SchemaExtractor) Extract(handler annotations.Handler, typeName string) (string, error) {
+	pkg, err := se.loadPackage(filepath.Dir(handler.FilePath), handler.PackageName)
+	if err != nil {
+		return "", err
+	}
+	obj, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return "", fmt.Errorf("type %s is not declared in package %s", typeName, pkg.Name())
+	}
+	return se.component(obj), nil
+}
+
+// Schemas returns the extracted component schemas, keyed by component name
+func (se *SchemaExtractor) Schemas() map[string]interface{} {
+	return se.schemas
+}
+
+// loadPackage type-checks the named package in dir, skipping tests. Its files are loaded
+// as an ad-hoc package, which works with or without a go.mod; imports resolve through the
+// enclosing module, if any. Dependencies are type-checked from source, keeping their
+// comments and not depending on the toolchain's export data format
+func (se *SchemaExtractor) loadPackage(dir, name string) (*types.Package, error) {
+	if pkg, ok := se.packages[dir]; ok {
+		return pkg, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package %s: %w", name, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", entry.Name(), err)
+		}
+		if file.Name.Name == name {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files for package %s in %s", name, dir)
+	}
+
+	loaded, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedImports | packages.NeedDeps,
+		Dir:  dir,
+		Fset: se.fset,
+	}, files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package %s: %w", name, err)
+	}
+	if len(loaded) != 1 {
+		return nil, fmt.Errorf("failed to load package %s: got %d packages", name, len(loaded))
+	}
+	if errs := loaded[0].Errors; len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load package %s: %v", name, errs[0])
+	}
+
+	packages.Visit(loaded, nil, func(pkg *packages.Package) {
+		for _, file := range pkg.Syntax {
+			se.files[se.fset.File(file.Pos()).Name()] = file
+		}
+	})
+	se.packages[dir] = loaded[0].Types
+	return loaded[0].Types, nil
+}
+
+// component adds a named type's schema once and returns its $ref; the name is registered
+// before the schema is built, so recursive types refer back to themselves
+func (se *SchemaExtractor) component(obj *types.TypeName) string {
+	name := obj.Pkg().Name() + "." + obj.Name()
+	if _, ok := se.schemas[name]; !ok {
+		se.schemas[name] = nil
+		se.schemas[name] = se.schema(obj.Type().Underlying())
+	}
+	return componentRefPrefix + name
+}
+
+// basicSchemas maps Go's basic types to JSON Schema types
+var basicSchemas = map[types.BasicKind]map[string]interface{}{
+	types.Bool:    {"type": "boolean"},
+	types.String:  {"type": "string"},
+	types.Int:     {"type": "integer"},
+	types.Int8:    {"type": "integer"},
+	types.Int16:   {"type": "integer"},
+	types.Int32:   {"type": "integer", "format": "int32"},
+	types.Int64:   {"type": "integer", "format": "int64"},
+	types.Uint:    {"type": "integer", "minimum": 0},
+	types.Uint8:   {"type": "integer", "minimum": 0},
+	types.Uint16:  {"type": "integer", "minimum": 0},
+	types.Uint32:  {"type": "integer", "format": "int32", "minimum": 0},
+	types.Uint64:  {"type": "integer", "format": "int64", "minimum": 0},
+	types.Float32: {"type": "number", "format": "float"},
+	types.Float64: {"type": "number", "format": "double"},
+}
+
+// knownSchemas describes library types by their JSON encoding rather than their fields
+var knownSchemas = map[string]map[string]interface{}{
+	"time.Time":                {"type": "string", "format": "date-time"},
+	"time.Duration":            {"type": "integer", "format": "int64"},
+	"encoding/json.RawMessage": {},
+}
+
+// schema converts a type to a JSON Schema object
+func (se *SchemaExtractor) schema(typ types.Type) map[string]interface{} {
+	switch t := types.Unalias(typ).(type) {
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() == nil {
+			// The predeclared error interface
+			return map[string]interface{}{}
+		}
+		if known, ok := knownSchemas[obj.Pkg().Path()+"."+obj.Name()]; ok {
+			return copySchema(known)
+		}
+		// Each instantiation of a generic type has its own fields, so it is inlined
+		if t.TypeArgs().Len() > 0 {
+			return se.schema(t.Underlying())
+		}
+		return map[string]interface{}{"$ref": se.component(obj)}
+	case *types.Basic:
+		if basic, ok := basicSchemas[t.Kind()]; ok {
+			return copySchema(basic)
+		}
+		return map[string]interface{}{}
+	case *types.Pointer:
+		return se.schema(t.Elem())
+	case *types.Slice:
+		// encoding/json writes []byte as a base64 string
+		if elem, ok := t.Elem().Underlying().(*types.Basic); ok && elem.Kind() == types.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": se.schema(t.Elem())}
+	case *types.Array:
+		return map[string]interface{}{"type": "array", "items": se.schema(t.Elem())}
+	case *types.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": se.schema(t.Elem())}
+	case *types.Struct:
+		return se.structSchema(t)
+	default:
+		// Interfaces, type parameters and anything else encoding/json can't describe statically
+		return map[string]interface{}{}
+	}
+}
+
+// copySchema returns a copy of a shared schema that the caller may add a description to
+func copySchema(schema map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		copied[key] = value
+	}
+	return copied
+}
+
+// structSchema converts a struct to an object schema following encoding/json: the json tag
+// names each property, fields without omitempty are required, and embedded structs are flattened
+func (se *SchemaExtractor) structSchema(st *types.Struct) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		name, omitEmpty, skip := jsonTag(st.Tag(i))
+		if skip {
+			continue
+		}
+
+		// An untagged embedded struct contributes its fields
+		if field.Embedded() && name == "" {
+			embedded := types.Unalias(field.Type())
+			if ptr, ok := embedded.(*types.Pointer); ok {
+				embedded = ptr.Elem()
+			}
+			if inner, ok := embedded.Underlying().(*types.Struct); ok {
+				flat := se.structSchema(inner)
+				for key, value := range flat["properties"].(map[string]interface{}) {
+					properties[key] = value
+				}
+				if names, ok := flat["required"].([]string); ok {
+					required = append(required, names...)
+				}
+			}
+			continue
+		}
+
+		if !field.Exported() {
+			continue
+		}
+		property := field.Name()
+		if name != "" {
+			property = name
+		}
+
+		schema := se.schema(field.Type())
+		// Siblings of $ref are ignored in OpenAPI 3.0, so only inline schemas get a description
+		if _, isRef := schema["$ref"]; !isRef {
+			if doc := se.fieldDoc(field); doc != "" {
+				schema["description"] = doc
+			}
+		}
+		properties[property] = schema
+		if !omitEmpty {
+			required = append(required, property)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonTag reads a field's json tag: the property name (empty when untagged), whether it has
+// omitempty, and whether the field is left out ("-")
+func jsonTag(tag string) (name string, omitEmpty, skip bool) {
+	value := reflect.StructTag(tag).Get("json")
+	if value == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(value, ",")
+	for _, option := range strings.Split(options, ",") {
+		if option == "omitempty" || option == "omitzero" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+// fieldDoc returns a field's doc or line comment as a one-line description
+func (se *SchemaExtractor) fieldDoc(field *types.Var) string {
+	file := se.fset.File(field.Pos())
+	if file == nil {
+		return ""
+	}
+	if !se.indexed[file.Name()] {
+		se.indexFields(se.files[file.Name()])
+		se.indexed[file.Name()] = true
+	}
+
+	node, ok := se.fields[field.Pos()]
+	if !ok {
+		return ""
+	}
+	doc := node.Doc.Text()
+	if doc == "" {
+		doc = node.Comment.Text()
+	}
+	return strings.Join(strings.Fields(doc), " ")
+}
+
+// indexFields records the struct fields declared in file by the positions of their names,
+// which go/types reports as the fields' positions
+func (se *SchemaExtractor) indexFields(file *ast.File) {
+	if file == nil {
+		return
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if st, ok := node.(*ast.StructType); ok {
+			for _, field := range st.Fields.List {
+				for _, ident := range field.Names {
+					se.fields[ident.Pos()] = field
+				}
+			}
+		}
+		return true
+	})
+}
+
+// collectErrorResponses returns the error components referenced by any operation, sorted by name
+func (gg *GatewayGenerator) collectErrorResponses(paths []OpenAPIPath) []OpenAPIErrorResponse {
+	seen := make(map[string]OpenAPIErrorResponse)
+	for _, path := range paths {
+		for _, op := range path.Operations {
+			for code, response := range op.Responses {
+				if response.Ref == "" {
+					continue
+				}
+				if component, err := errorResponseComponent(code); err == nil {
+					seen[component.Name] = component
+				}
+			}
+		}
+	}
+
+	components := make([]OpenAPIErrorResponse, 0, len(seen))
+	for _, component := range seen {
+		components = append(components, component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
+
 // buildGCPExtensions creates GCP-specific OpenAPI extensions
-func (gg *GatewayGenerator) buildGCPExtensions(handler annotations.Handler) map[string]interface{} {
+func (gg *GatewayGenerator) buildGCPExtensions(route RoutePlan) map[string]interface{} {
+	handler := route.Handler
 	extensions := make(map[string]interface{})
 
-	// Backend address
-	extensions["backend"] = map[string]interface{}{
-		"address": gg.getBackendURL(handler),
+	// Backend address; proxies keep the request path, which the operation-level
+	// default (CONSTANT_ADDRESS) would drop
+	backend := map[string]interface{}{
+		"address": gg.routeBackendURL(route),
 	}
+	if route.Handler.Proxy != nil {
+		backend["path_translation"] = "APPEND_PATH_TO_ADDRESS"
+	}
+	extensions["backend"] = backend
 
 	// Rate limiting (if configured)
 	if handler.RateLimit != nil {
@@ -279,40 +1113,71 @@ func (gg *GatewayGenerator) buildGCPExtensions(handler annotations.Handler) map[
 
 	// CORS (if configured)
 	if handler.CORS != nil {
-		extensions["cors"] = map[string]interface{}{
-			"allowOrigins": handler.CORS.AllowedOrigins,
-			"allowMethods": []string{handler.Route.Method},
+		cors := map[string]interface{}{
+			"allowOrigins":  handler.CORS.AllowedOrigins,
+			"allowMethods":  []string{handler.Route.Method},
+			"exposeHeaders": handler.CORS.EffectiveExposedHeaders(),
+			"maxAge":        handler.CORS.EffectiveMaxAge(),
+		}
+		if handler.CORS.AllowCredentials {
+			cors["allowCredentials"] = true
 		}
+		extensions["cors"] = cors
 	}
 
 	return extensions
 }
 
+// describeCORSOrigins lists the allowed origins, spelling out what wildcard patterns match
+func describeCORSOrigins(config *annotations.CORSConfig) string {
+	origins := make([]string, 0, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			origins = append(origins, "any origin")
+		} else if _, suffix, ok := annotations.SplitWildcardOrigin(origin); ok {
+			origins = append(origins, fmt.Sprintf("%s (any subdomain of %s)", origin, suffix))
+		} else {
+			origins = append(origins, origin)
+		}
+	}
+	return strings.Join(origins, ", ")
+}
+
+// routeBackendURL returns the address a route is forwarded to: a proxy's upstream for the
+// build's environment, or the deployed function or service
+func (gg *GatewayGenerator) routeBackendURL(route RoutePlan) string {
+	if route.Handler.Proxy != nil {
+		return route.Handler.Proxy.UpstreamFor(gg.environment)
+	}
+	return gg.getBackendURL(route.Backend)
+}
+
 // getBackendURL determines the backend URL based on deployment type
-func (gg *GatewayGenerator) getBackendURL(handler annotations.Handler) string {
-	functionName := toKebabCase(handler.FunctionName)
+func (gg *GatewayGenerator) getBackendURL(backend Backend) string {
+	region := gg.plan.Networking.Region
 
-	switch handler.DeploymentType {
+	switch backend.Type {
 	case annotations.DeploymentFunction:
 		// Cloud Function URL format
 		return fmt.Sprintf("https://%s-%s.cloudfunctions.net/%s",
-			gg.region, gg.projectID, functionName)
+			region, gg.projectID, backend.Name)
 	case annotations.DeploymentContainer:
-		// Cloud Run URL format (service name is package name)
-		serviceName := toKebabCase(handler.PackageName)
+		// Cloud Run URL format
 		return fmt.Sprintf("https://%s-%s.run.app",
-			serviceName, gg.region)
+			toKebabCase(backend.Name), region)
 	default:
 		return ""
 	}
 }
 
-// extractTags gets unique package names as tags
+// extractTags gets unique tags across all operations
 func (gg *GatewayGenerator) extractTags() []string {
 	tagMap := make(map[string]bool)
-	for _, handler := range gg.handlers {
-		if handler.PackageName != "" {
-			tagMap[handler.PackageName] = true
+	for _, route := range gg.plan.Routes {
+		for _, tag := range handlerTags(route.Handler) {
+			if tag != "" {
+				tagMap[tag] = true
+			}
 		}
 	}
 
@@ -324,10 +1189,122 @@ func (gg *GatewayGenerator) extractTags() []string {
 	return tags
 }
 
+// OpenAPITag is an entry of the spec's top-level tags list
+type OpenAPITag struct {
+	Name        string
+	DisplayName string // x-displayName, omitted when empty
+	Description string
+}
+
+// OpenAPITagGroup is an x-tagGroups entry, a heading over tags in ReDoc's navigation
+type OpenAPITagGroup struct {
+	Name string
+	Tags []string
+}
+
+// defaultTagGroup holds the tags left out of the configured groups, which ReDoc would hide
+const defaultTagGroup = "Other"
+
+// documentTags orders and documents the spec's tags (sorted by name) and groups them for
+// ReDoc. Tags in Config.Docs come first, in its order. Without configured groups each tag
+// goes under the package of its handlers (the first by name when several packages share it)
+func (gg *GatewayGenerator) documentTags(names []string) ([]OpenAPITag, []OpenAPITagGroup) {
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		used[name] = true
+	}
+
+	var tags []OpenAPITag
+	listed := make(map[string]bool)
+	for _, doc := range gg.docs.Tags {
+		if !used[doc.Name] {
+			gg.logger.Warn("Documented tag is not used by any handler", zap.String("tag", doc.Name))
+			continue
+		}
+		listed[doc.Name] = true
+		tags = append(tags, OpenAPITag{Name: doc.Name, DisplayName: doc.DisplayName, Description: doc.Description})
+	}
+	for _, name := range names {
+		if !listed[name] {
+			tags = append(tags, OpenAPITag{Name: name})
+		}
+	}
+	for i := range tags {
+		if tags[i].Description == "" {
+			tags[i].Description = tags[i].Name + " endpoints"
+		}
+	}
+
+	var groups []OpenAPITagGroup
+	grouped := make(map[string]bool)
+	if len(gg.docs.TagGroups) > 0 {
+		for _, group := range gg.docs.TagGroups {
+			var members []string
+			for _, tag := range group.Tags {
+				if !used[tag] {
+					gg.logger.Warn("Grouped tag is not used by any handler", zap.String("group", group.Name), zap.String("tag", tag))
+					continue
+				}
+				members = append(members, tag)
+				grouped[tag] = true
+			}
+			if len(members) > 0 {
+				groups = append(groups, OpenAPITagGroup{Name: group.Name, Tags: members})
+			}
+		}
+	} else {
+		// Package of each tag
+		packages := make(map[string]string)
+		for _, route := range gg.plan.Routes {
+			pkg := route.Handler.PackageName
+			for _, tag := range handlerTags(route.Handler) {
+				if existing, ok := packages[tag]; pkg != "" && (!ok || pkg < existing) {
+					packages[tag] = pkg
+				}
+			}
+		}
+
+		index := make(map[string]int)
+		for _, tag := range tags {
+			pkg, ok := packages[tag.Name]
+			if !ok {
+				continue
+			}
+			if _, ok := index[pkg]; !ok {
+				index[pkg] = len(groups)
+				groups = append(groups, OpenAPITagGroup{Name: pkg})
+			}
+			groups[index[pkg]].Tags = append(groups[index[pkg]].Tags, tag.Name)
+			grouped[tag.Name] = true
+		}
+		slices.SortFunc(groups, func(a, b OpenAPITagGroup) int { return strings.Compare(a.Name, b.Name) })
+	}
+
+	var ungrouped []string
+	for _, tag := range tags {
+		if !grouped[tag.Name] {
+			ungrouped = append(ungrouped, tag.Name)
+		}
+	}
+	if len(ungrouped) > 0 {
+		groups = append(groups, OpenAPITagGroup{Name: defaultTagGroup, Tags: ungrouped})
+	}
+
+	return tags, groups
+}
+
+// handlerTags returns the explicit @box:tags of a handler, falling back to its package name
+func handlerTags(handler annotations.Handler) []string {
+	if len(handler.Tags) > 0 {
+		return handler.Tags
+	}
+	return []string{handler.PackageName}
+}
+
 // hasAuthentication checks if any handler requires authentication
 func (gg *GatewayGenerator) hasAuthentication() bool {
-	for _, handler := range gg.handlers {
-		if handler.Auth.Type != annotations.AuthNone {
+	for _, route := range gg.plan.Routes {
+		if route.Handler.Auth.Type != annotations.AuthNone {
 			return true
 		}
 	}
@@ -362,10 +1339,7 @@ func (gg *GatewayGenerator) getRateLimitQuota(handler annotations.Handler) strin
 
 // getTimeoutSeconds returns timeout in seconds
 func (gg *GatewayGenerator) getTimeoutSeconds(handler annotations.Handler) int {
-	if handler.Timeout > 0 {
-		return int(handler.Timeout.Seconds())
-	}
-	return 60 // default
+	return int(handlerTimeout(handler, gg.defaultTimeout).Seconds())
 }
 
 // extractPathParams extracts parameter names from a path
@@ -398,7 +1372,7 @@ func (gg *GatewayGenerator) generateGatewayConfig() error {
 		APIName   string
 	}{
 		ProjectID: gg.projectID,
-		Region:    gg.region,
+		Region:    gg.plan.Networking.Region,
 		APIName:   "wylla-api",
 	}
 
@@ -426,7 +1400,7 @@ func (gg *GatewayGenerator) generateDeployScript() error {
 		Region  string
 	}{
 		APIName: "wylla-api",
-		Region:  gg.region,
+		Region:  gg.plan.Networking.Region,
 	}
 
 	return tmpl.Execute(file, data)
@@ -450,9 +1424,24 @@ servers:
   - url: https://{{.Region}}-{{.ProjectID}}.gateway.dev
     description: Production API Gateway
 
-{{if .NeedsAuth}}
 components:
-  securitySchemes:
+  schemas:
+    Error:
+      type: object
+      required:
+        - error
+      properties:
+        error:
+          type: string
+          description: Human-readable error message
+{{if .Schemas}}{{.Schemas}}{{end}}{{if .ErrorResponses}}  responses:
+{{range .ErrorResponses}}    {{.Name}}:
+      description: {{.Description}}
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Error'
+{{end}}{{end}}{{if .NeedsAuth}}  securitySchemes:
     bearerAuth:
       type: http
       scheme: bearer
@@ -462,9 +1451,17 @@ components:
 
 {{if .Tags}}
 tags:
-{{range .Tags}}  - name: {{.}}
-    description: {{.}} endpoints
+{{range .Tags}}  - name: {{.Name}}
+{{- if .DisplayName}}
+    x-displayName: {{yamlScalar .DisplayName}}
+{{- end}}
+    description: {{yamlScalar .Description}}
 {{end}}
+x-tagGroups:
+{{range .TagGroups}}  - name: {{yamlScalar .Name}}
+    tags:
+{{range .Tags}}      - {{.}}
+{{end}}{{end}}
 {{end}}
 
 paths:
@@ -472,7 +1469,13 @@ paths:
   {{.Path}}:
 {{range $method, $op := .Operations}}    {{$method}}:
       operationId: {{$op.OperationID}}
-      summary: {{$op.Summary}}
+      summary: {{yamlScalar $op.Summary}}
+{{- if $op.Description}}
+      description: {{yamlText $op.Description 8}}
+{{- end}}
+{{- if $op.Deprecated}}
+      deprecated: true
+{{- end}}
       tags:
 {{range $op.Tags}}        - {{.}}
 {{end}}
@@ -487,17 +1490,49 @@ paths:
           schema:
             type: {{index .Schema "type"}}
 {{end}}
+{{end}}{{if or $op.RequestBody $op.RequestExample}}      requestBody:
+        required: true
+        content:
+          application/json:
+{{- if $op.RequestBody}}
+            schema:
+              $ref: '{{$op.RequestBody}}'
+{{- end}}
+{{- if $op.RequestExample}}
+            example:
+{{$op.RequestExample}}
+{{- end}}
 {{end}}
       responses:
 {{range $code, $response := $op.Responses}}        '{{$code}}':
-          description: {{$response.Description}}
-{{end}}
+{{if $response.Ref}}          $ref: '{{$response.Ref}}'
+{{else}}          description: {{yamlScalar $response.Description}}
+{{if $response.Headers}}          headers:
+{{range $response.Headers}}            {{.Name}}:
+              description: '{{.Description}}'
+              schema:
+                type: {{or .Type "string"}}
+{{end}}{{end}}{{if or $response.Schema $response.Example}}          content:
+            application/json:
+{{- if $response.Schema}}
+              schema:
+                $ref: '{{$response.Schema}}'
+{{- end}}
+{{- if $response.Example}}
+              example:
+{{$response.Example}}
+{{- end}}
+{{end}}{{end}}{{end}}
       x-google-backend:
         address: {{index $op.XGoogle "backend" "address"}}
-        deadline: {{if index $op.XGoogle "timeout"}}{{index $op.XGoogle "timeout"}}{{else}}60.0{{end}}
+{{- with index $op.XGoogle "backend" "path_translation"}}
+        path_translation: {{.}}
+{{- end}}
+        deadline: {{if index $op.XGoogle "timeout"}}{{index $op.XGoogle "timeout"}}{{else}}{{$.Deadline}}{{end}}
 {{if index $op.XGoogle "quota"}}      x-google-quota:
         metricCosts:
           "{{$op.OperationID}}-quota": {{index $op.XGoogle "quota" "limit"}}
+{{end}}{{range $key, $value := $op.Extensions}}      {{$key}}: {{yamlScalar $value}}
 {{end}}
 {{end}}
 {{end}}
@@ -4,37 +4,179 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/config"
 )
 
 // Generator orchestrates the build process for cloud deployments
 type Generator struct {
-	handlers            []annotations.Handler
-	outputDir           string
-	moduleName          string // e.g., "github.com/gravelight-studio/box"
-	logger              *zap.Logger
-	funcGenerator       *FunctionGenerator
-	containerGenerator  *ContainerGenerator
-	gatewayGenerator    *GatewayGenerator
-	terraformGenerator  *TerraformGenerator
-	cleanBuildDir       bool
+	handlers           []annotations.Handler
+	plan               *DeploymentPlan
+	outputDir          string
+	moduleName         string // e.g., "github.com/gravelight-studio/box"
+	logger             *zap.Logger
+	funcGenerator      *FunctionGenerator
+	containerGenerator *ContainerGenerator
+	gatewayGenerator   *GatewayGenerator
+	terraformGenerator *TerraformGenerator
+	firebaseGenerator  *FirebaseGenerator   // nil unless Config.Firebase is set
+	schemaGenerator    *JSONSchemaGenerator // nil unless Config.EmitJSONSchema is set
+	lambdaGenerator    *LambdaGenerator     // nil unless Config.AWS is set
+	k8sGenerator       *KubernetesGenerator // nil unless Config.KubernetesOutput is set
+	cleanBuildDir      bool
+	forceRebuild       bool
+	configHash         string            // Invalidates the build manifest when the configuration changes
+	incremental        *incrementalBuild // Set for the duration of Generate
+	skipGateway        bool
+	skipTerraform      bool
+	secretsMode        string
 }
 
 // Config holds generator configuration
 type Config struct {
 	Handlers      []annotations.Handler
-	OutputDir     string // e.g., "./build"
-	ModuleName    string // e.g., "github.com/gravelight-studio/box"
-	ProjectID     string // GCP project ID (e.g., "my-project-123")
-	Region        string // GCP region (e.g., "us-central1")
-	Environment   string // Environment name (e.g., "dev", "staging", "production")
+	OutputDir     string   // e.g., "./build"
+	ModuleName    string   // e.g., "github.com/gravelight-studio/box"
+	ProjectID     string   // GCP project ID (e.g., "my-project-123")
+	Region        string   // GCP region (e.g., "us-central1")
+	Regions       []string // Deploy Cloud Run services to several regions behind a global load balancer
+	Environment   string   // Environment name (e.g., "dev", "staging", "production")
 	Logger        *zap.Logger
 	CleanBuildDir bool // If true, removes existing build directory before generating
+
+	// ForceRebuild regenerates every artifact, ignoring the build manifest that lets
+	// Generate skip handlers whose source and annotations haven't changed
+	ForceRebuild bool
+
+	// DefaultResponses lists error status codes documented on every OpenAPI operation
+	// (default: DefaultErrorResponses). Each references the shared Error schema
+	DefaultResponses []string
+
+	// HealthPath is the container health endpoint used by the Dockerfile HEALTHCHECK
+	// and Cloud Run probes (default: DefaultHealthPath)
+	HealthPath string
+
+	// Gateway selects the gateway backend: GatewayGCP (default) or GatewayEnvoy
+	Gateway string
+
+	// ValidateOpenAPI fails the build when the generated openapi.yaml is not valid OpenAPI 3.0
+	ValidateOpenAPI bool
+
+	// SkipSchemas leaves @box:request and @box:response body schemas out of openapi.yaml,
+	// avoiding type-checking the handler packages and their imports for their types
+	SkipSchemas bool
+
+	// EmitJSONSchema also writes a standalone JSON Schema file per @box:request and
+	// @box:response type under schemas/, for generating client types without the OpenAPI spec
+	EmitJSONSchema bool
+
+	// Docs gives the openapi.yaml tags display names (x-displayName), descriptions, an order
+	// and navigation groups (x-tagGroups, default: one group per package), as box.yaml's docs
+	Docs config.DocsConfig
+
+	// Probes tunes the Cloud Run startup and liveness probes; zero fields use defaults
+	Probes ProbeConfig
+
+	// DefaultTimeout applies to handlers without @box:timeout: the function.yaml timeout,
+	// the gateway deadline and the Terraform function timeout (default: DefaultTimeout)
+	DefaultTimeout time.Duration
+
+	// DefaultRoles lists the project roles granted to every generated service account
+	// (default: DefaultServiceAccountRoles); handlers add their own with @box:iam-role
+	DefaultRoles []string
+
+	// NoDefaultRoles grants service accounts only the roles their handlers request,
+	// ignoring DefaultRoles
+	NoDefaultRoles bool
+
+	// Firebase also writes firebase.json, rewriting each route through Firebase Hosting
+	// to its function or service
+	Firebase bool
+
+	// SkipGateway and SkipTerraform leave out those generators, keeping rebuilds fast while
+	// iterating on handlers (box watch --no-gateway / --no-terraform)
+	SkipGateway   bool
+	SkipTerraform bool
+
+	// AWS enables AWS Lambda output for @box:lambda handlers; without it they are skipped
+	AWS *AWSConfig
+
+	// CloudRunV2 renders Cloud Run services with google_cloud_run_v2_service instead of the
+	// legacy Knative-style google_cloud_run_service
+	CloudRunV2 bool
+
+	// CanaryPercent splits each Cloud Run service's traffic between its latest revision,
+	// which gets this percentage, and the stable revision set in the stable_revisions
+	// Terraform variable. 0 sends all traffic to the latest revision
+	CanaryPercent int
+
+	// FunctionRuntime is the Cloud Functions runtime in the generated Terraform
+	// (default: DefaultFunctionRuntime)
+	FunctionRuntime string
+
+	// VendorFunctions copies each function's handler package, and the packages of the same
+	// module it imports, into the function directory instead of pointing go.mod at the
+	// repository root with a replace directive, so the directory deploys on its own
+	VendorFunctions bool
+
+	// StateBucket stores Terraform state in this GCS bucket, under a prefix per environment,
+	// and writes setup-state.sh to create it. Empty keeps local state
+	StateBucket string
+
+	// MaxConcurrency bounds how many function and service packages are generated at once
+	// (default: runtime.NumCPU()). 1 generates them one at a time
+	MaxConcurrency int
+
+	// KubernetesOutput also writes a Deployment, Service, HorizontalPodAutoscaler, Ingress
+	// and kustomization.yaml per container service under k8s/, for deploying to GKE
+	KubernetesOutput bool
+
+	// SecretsMode selects how functions and services get their Secret Manager secrets
+	// (DATABASE_URL, @box:env and @box:secret): SecretsEnv (default) has Terraform read them
+	// into environment variables, SecretsRuntime has entry points read them at startup
+	SecretsMode string
+
+	// ExcludeDeprecated leaves @box:deprecated handlers out of the generated routing: the
+	// OpenAPI spec and gateway config, envoy.yaml, firebase.json and Kubernetes Ingress rules.
+	// Their functions, services and Terraform are still generated, so they stay deployed
+	ExcludeDeprecated bool
 }
 
+// DefaultTimeout is the request timeout for handlers without @box:timeout when Config.DefaultTimeout is unset
+const DefaultTimeout = 60 * time.Second
+
+// DefaultServiceAccountRoles are granted to generated service accounts when Config.DefaultRoles is unset
+var DefaultServiceAccountRoles = []string{"roles/cloudsql.client", "roles/secretmanager.secretAccessor"}
+
+// DefaultFunctionRuntime is the Cloud Functions runtime when Config.FunctionRuntime is unset
+const DefaultFunctionRuntime = "go122"
+
+// DefaultHealthPath is the container health endpoint when Config.HealthPath is unset
+const DefaultHealthPath = "/health"
+
+// ProbeConfig configures the Cloud Run startup and liveness probes hitting the health path
+type ProbeConfig struct {
+	Period           time.Duration // Interval between probes (default 10s, max 240s)
+	Timeout          time.Duration // Per-probe timeout; 0 derives it from the service's shortest handler timeout, capped at Period
+	FailureThreshold int           // Consecutive liveness failures before the instance is restarted (default 3)
+	StartupGrace     time.Duration // How long a new instance may take to become healthy (default 240s)
+}
+
+// Probe defaults applied to zero ProbeConfig fields
+const (
+	DefaultProbePeriod           = 10 * time.Second
+	DefaultProbeFailureThreshold = 3
+	DefaultProbeStartupGrace     = 240 * time.Second
+)
+
 // NewGenerator creates a new build generator
 func NewGenerator(config Config) *Generator {
 	if config.Logger == nil {
@@ -49,6 +191,10 @@ func NewGenerator(config Config) *Generator {
 		config.ProjectID = "PROJECT_ID" // Placeholder
 	}
 
+	if config.Region == "" && len(config.Regions) > 0 {
+		config.Region = config.Regions[0] // Primary region for single-region resources
+	}
+
 	if config.Region == "" {
 		config.Region = "us-central1" // Default region
 	}
@@ -57,56 +203,188 @@ func NewGenerator(config Config) *Generator {
 		config.Environment = "dev" // Default environment
 	}
 
+	if config.DefaultResponses == nil {
+		config.DefaultResponses = DefaultErrorResponses
+	}
+
+	if config.Gateway == "" {
+		config.Gateway = GatewayGCP
+	}
+
+	if config.HealthPath == "" {
+		config.HealthPath = DefaultHealthPath
+	}
+
+	if config.FunctionRuntime == "" {
+		config.FunctionRuntime = DefaultFunctionRuntime
+	}
+
+	if config.SecretsMode == "" {
+		config.SecretsMode = SecretsEnv
+	}
+
+	if config.DefaultTimeout == 0 {
+		config.DefaultTimeout = DefaultTimeout
+	}
+
+	if config.NoDefaultRoles {
+		config.DefaultRoles = nil
+	} else if config.DefaultRoles == nil {
+		config.DefaultRoles = DefaultServiceAccountRoles
+	}
+
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = runtime.NumCPU()
+	}
+
+	if config.Probes.Period == 0 {
+		config.Probes.Period = DefaultProbePeriod
+	}
+
+	if config.Probes.FailureThreshold == 0 {
+		config.Probes.FailureThreshold = DefaultProbeFailureThreshold
+	}
+
+	if config.Probes.StartupGrace == 0 {
+		config.Probes.StartupGrace = DefaultProbeStartupGrace
+	}
+
+	// Normalize handlers into the plan every renderer works from
+	plan := NewDeploymentPlan(config.Handlers, NetworkingPlan{
+		Region:     config.Region,
+		Regions:    config.Regions,
+		HealthPath: config.HealthPath,
+	})
+
 	g := &Generator{
 		handlers:      config.Handlers,
+		plan:          plan,
 		outputDir:     config.OutputDir,
 		moduleName:    config.ModuleName,
 		logger:        config.Logger,
 		cleanBuildDir: config.CleanBuildDir,
+		forceRebuild:  config.ForceRebuild,
+		configHash:    manifestConfigHash(config),
+		skipGateway:   config.SkipGateway,
+		skipTerraform: config.SkipTerraform,
+		secretsMode:   config.SecretsMode,
+	}
+
+	// Routing renderers work from a plan without the deprecated routes when they're excluded
+	routing := plan
+	if config.ExcludeDeprecated {
+		routing = plan.WithoutDeprecatedRoutes()
 	}
 
 	// Initialize function generator
 	g.funcGenerator = &FunctionGenerator{
-		handlers:   filterFunctionHandlers(config.Handlers),
-		outputDir:  filepath.Join(config.OutputDir, "functions"),
-		moduleName: config.ModuleName,
-		logger:     config.Logger,
+		plan:           plan,
+		outputDir:      filepath.Join(config.OutputDir, "functions"),
+		moduleName:     config.ModuleName,
+		defaultTimeout: config.DefaultTimeout,
+		vendor:         config.VendorFunctions,
+		runtimeSecrets: config.SecretsMode == SecretsRuntime,
+		concurrency:    config.MaxConcurrency,
+		logger:         config.Logger,
 	}
 
 	// Initialize container generator
 	g.containerGenerator = &ContainerGenerator{
-		handlers:   filterContainerHandlers(config.Handlers),
-		outputDir:  filepath.Join(config.OutputDir, "containers"),
-		moduleName: config.ModuleName,
-		logger:     config.Logger,
+		plan:           plan,
+		outputDir:      filepath.Join(config.OutputDir, "containers"),
+		moduleName:     config.ModuleName,
+		runtimeSecrets: config.SecretsMode == SecretsRuntime,
+		concurrency:    config.MaxConcurrency,
+		logger:         config.Logger,
 	}
 
 	// Initialize gateway generator
 	g.gatewayGenerator = &GatewayGenerator{
-		handlers:   config.Handlers, // Gateway needs all handlers
-		outputDir:  filepath.Join(config.OutputDir, "gateway"),
-		moduleName: config.ModuleName,
-		projectID:  config.ProjectID,
-		region:     config.Region,
-		logger:     config.Logger,
-	}
-
-	// Initialize terraform generator
-	g.terraformGenerator = &TerraformGenerator{
-		handlers:    config.Handlers,
-		outputDir:   filepath.Join(config.OutputDir, "terraform"),
+		plan:        routing,
+		outputDir:   filepath.Join(config.OutputDir, "gateway"),
 		moduleName:  config.ModuleName,
 		projectID:   config.ProjectID,
-		region:      config.Region,
 		environment: config.Environment,
 		logger:      config.Logger,
+
+		defaultResponses: config.DefaultResponses,
+		defaultTimeout:   config.DefaultTimeout,
+		backend:          config.Gateway,
+		validateOpenAPI:  config.ValidateOpenAPI,
+		skipSchemas:      config.SkipSchemas,
+		docs:             config.Docs,
+	}
+
+	// Initialize terraform generator
+	g.terraformGenerator = &TerraformGenerator{
+		plan:            plan,
+		outputDir:       filepath.Join(config.OutputDir, "terraform"),
+		moduleName:      config.ModuleName,
+		projectID:       config.ProjectID,
+		environment:     config.Environment,
+		probes:          config.Probes,
+		defaultTimeout:  config.DefaultTimeout,
+		defaultRoles:    config.DefaultRoles,
+		cloudRunV2:      config.CloudRunV2,
+		canaryPercent:   config.CanaryPercent,
+		functionRuntime: config.FunctionRuntime,
+		region:          config.Region,
+		stateBucket:     config.StateBucket,
+		runtimeSecrets:  config.SecretsMode == SecretsRuntime,
+		logger:          config.Logger,
+	}
+
+	if config.AWS != nil {
+		aws := *config.AWS
+		if aws.Region == "" {
+			aws.Region = DefaultAWSRegion
+		}
+		g.lambdaGenerator = &LambdaGenerator{
+			plan:           plan,
+			outputDir:      filepath.Join(config.OutputDir, "lambdas"),
+			terraformDir:   filepath.Join(config.OutputDir, "terraform"),
+			moduleName:     config.ModuleName,
+			environment:    config.Environment,
+			aws:            aws,
+			defaultTimeout: config.DefaultTimeout,
+			logger:         config.Logger,
+		}
+	}
+
+	if config.KubernetesOutput {
+		g.k8sGenerator = &KubernetesGenerator{
+			plan:        routing,
+			outputDir:   filepath.Join(config.OutputDir, "k8s"),
+			projectID:   config.ProjectID,
+			environment: config.Environment,
+			logger:      config.Logger,
+		}
+	}
+
+	if config.EmitJSONSchema {
+		g.schemaGenerator = &JSONSchemaGenerator{
+			handlers:  config.Handlers,
+			outputDir: filepath.Join(config.OutputDir, "schemas"),
+			logger:    config.Logger,
+		}
+	}
+
+	if config.Firebase {
+		g.firebaseGenerator = &FirebaseGenerator{
+			plan:        routing,
+			outputDir:   config.OutputDir,
+			environment: config.Environment,
+			logger:      config.Logger,
+		}
 	}
 
 	return g
 }
 
 // Generate runs the complete build process
-func (g *Generator) Generate() error {
+// Artifacts recorded in the output directory's build manifest are regenerated only when
+// their handlers changed; the returned stats count generated, skipped and removed artifacts
+func (g *Generator) Generate() (ManifestStats, error) {
 	g.logger.Info("Starting build generation",
 		zap.Int("total_handlers", len(g.handlers)),
 		zap.String("output_dir", g.outputDir))
@@ -114,18 +392,61 @@ func (g *Generator) Generate() error {
 	// Clean build directory if requested
 	if g.cleanBuildDir {
 		if err := os.RemoveAll(g.outputDir); err != nil {
-			return fmt.Errorf("failed to clean build directory: %w", err)
+			return ManifestStats{}, fmt.Errorf("failed to clean build directory: %w", err)
 		}
 		g.logger.Info("Cleaned build directory", zap.String("dir", g.outputDir))
 	}
 
 	// Create output directory
 	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return ManifestStats{}, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	incremental, err := newIncrementalBuild(g.outputDir, g.configHash, g.forceRebuild, g.logger)
+	if err != nil {
+		return ManifestStats{}, fmt.Errorf("failed to load build manifest: %w", err)
+	}
+	g.setIncremental(incremental)
+	defer g.setIncremental(nil)
+
+	if err := g.generateArtifacts(); err != nil {
+		return ManifestStats{}, err
+	}
+
+	stats, err := incremental.finish()
+	if err != nil {
+		return stats, err
+	}
+
+	g.logger.Info("Build generation complete",
+		zap.Int("functions_generated", len(g.plan.Functions)),
+		zap.Int("container_handlers", len(g.plan.ContainerHandlers())),
+		zap.Int("lambdas", len(g.plan.Lambdas)),
+		zap.Int("total_api_endpoints", len(g.handlers)),
+		zap.Int("artifacts_generated", stats.Generated),
+		zap.Int("artifacts_skipped", stats.Skipped),
+		zap.Int("artifacts_removed", stats.Removed))
+
+	return stats, nil
+}
+
+// setIncremental points the generator and its per-handler generators at a build's manifest tracking
+func (g *Generator) setIncremental(incremental *incrementalBuild) {
+	g.incremental = incremental
+	g.funcGenerator.incremental = incremental
+	g.containerGenerator.incremental = incremental
+}
+
+// generateArtifacts runs every configured generator
+// Build-wide artifacts (gateway, Terraform, ...) depend on every handler, so any change
+// regenerates them
+func (g *Generator) generateArtifacts() error {
+	if err := validateSecretsMode(g.secretsMode); err != nil {
+		return err
 	}
 
 	// Generate cloud functions
-	functionCount := len(g.funcGenerator.handlers)
+	functionCount := len(g.plan.Functions)
 	if functionCount > 0 {
 		g.logger.Info("Generating cloud functions", zap.Int("count", functionCount))
 		if err := g.funcGenerator.Generate(); err != nil {
@@ -136,7 +457,7 @@ func (g *Generator) Generate() error {
 	}
 
 	// Generate cloud run containers
-	containerCount := len(g.containerGenerator.handlers)
+	containerCount := len(g.plan.ContainerHandlers())
 	if containerCount > 0 {
 		g.logger.Info("Generating cloud run containers", zap.Int("handlers", containerCount))
 		if err := g.containerGenerator.Generate(); err != nil {
@@ -146,9 +467,33 @@ func (g *Generator) Generate() error {
 		g.logger.Info("No cloud run containers to generate")
 	}
 
+	// Generate Kubernetes manifests for the container services if requested
+	if g.k8sGenerator != nil && containerCount > 0 && !g.incremental.upToDate("k8s", g.handlers...) {
+		g.logger.Info("Generating Kubernetes manifests", zap.Int("services", len(g.plan.Services)))
+		if err := g.k8sGenerator.Generate(); err != nil {
+			return fmt.Errorf("failed to generate Kubernetes manifests: %w", err)
+		}
+	}
+
+	// Generate AWS Lambda packages
+	lambdaCount := len(g.plan.Lambdas)
+	if lambdaCount > 0 && g.lambdaGenerator == nil {
+		g.logger.Warn("Skipping lambda handlers: no AWS target configured", zap.Int("count", lambdaCount))
+	} else if lambdaCount > 0 && !g.incremental.upToDate("lambdas", g.handlers...) {
+		g.logger.Info("Generating lambdas", zap.Int("count", lambdaCount))
+		if err := g.lambdaGenerator.Generate(); err != nil {
+			return fmt.Errorf("failed to generate lambdas: %w", err)
+		}
+	}
+
 	// Generate API Gateway configuration
 	totalHandlers := len(g.handlers)
-	if totalHandlers > 0 {
+	if g.skipGateway {
+		g.logger.Info("Skipping API Gateway configuration")
+		g.incremental.keep("gateway")
+	} else if totalHandlers > 0 && g.incremental.upToDate("gateway", g.handlers...) {
+		g.logger.Info("API Gateway configuration is up to date")
+	} else if totalHandlers > 0 {
 		g.logger.Info("Generating API Gateway configuration", zap.Int("handlers", totalHandlers))
 		if err := g.gatewayGenerator.Generate(); err != nil {
 			return fmt.Errorf("failed to generate API Gateway configuration: %w", err)
@@ -157,8 +502,22 @@ func (g *Generator) Generate() error {
 		g.logger.Info("No handlers to generate API Gateway configuration")
 	}
 
+	// Generate standalone JSON Schemas if requested. The types may be declared in any file of
+	// the handlers' packages, so they are regenerated on every build
+	if g.schemaGenerator != nil && hasBodyTypes(g.handlers) {
+		g.incremental.rebuild("schemas", g.handlers...)
+		if err := g.schemaGenerator.Generate(); err != nil {
+			return fmt.Errorf("failed to generate JSON Schemas: %w", err)
+		}
+	}
+
 	// Generate Terraform infrastructure configuration
-	if totalHandlers > 0 {
+	if g.skipTerraform {
+		g.logger.Info("Skipping Terraform infrastructure")
+		g.incremental.keep("terraform")
+	} else if totalHandlers > 0 && g.incremental.upToDate("terraform", g.handlers...) {
+		g.logger.Info("Terraform infrastructure is up to date")
+	} else if totalHandlers > 0 {
 		g.logger.Info("Generating Terraform infrastructure", zap.Int("handlers", totalHandlers))
 		if err := g.terraformGenerator.Generate(); err != nil {
 			return fmt.Errorf("failed to generate Terraform infrastructure: %w", err)
@@ -167,10 +526,12 @@ func (g *Generator) Generate() error {
 		g.logger.Info("No handlers to generate Terraform infrastructure")
 	}
 
-	g.logger.Info("Build generation complete",
-		zap.Int("functions_generated", functionCount),
-		zap.Int("container_handlers", containerCount),
-		zap.Int("total_api_endpoints", totalHandlers))
+	// Generate Firebase Hosting rewrites if requested
+	if g.firebaseGenerator != nil && len(g.firebaseGenerator.plan.Routes) > 0 && !g.incremental.upToDate("firebase.json", g.handlers...) {
+		if err := g.firebaseGenerator.Generate(); err != nil {
+			return fmt.Errorf("failed to generate Firebase Hosting config: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -197,7 +558,7 @@ func (g *Generator) GenerateTerraform() error {
 
 // GetFunctionHandlers returns handlers marked for cloud function deployment
 func (g *Generator) GetFunctionHandlers() []annotations.Handler {
-	return g.funcGenerator.handlers
+	return g.plan.Functions
 }
 
 // GetContainerHandlers returns handlers marked for container deployment
@@ -210,15 +571,112 @@ func (g *Generator) GetAllHandlers() []annotations.Handler {
 	return g.handlers
 }
 
-// filterFunctionHandlers returns only handlers marked for function deployment
-func filterFunctionHandlers(handlers []annotations.Handler) []annotations.Handler {
-	var functions []annotations.Handler
-	for _, h := range handlers {
-		if h.DeploymentType == annotations.DeploymentFunction {
-			functions = append(functions, h)
+// Plan returns the artifacts Generate would write, without writing or rendering anything
+// It fails on the configuration errors Generate reports before writing (an unknown gateway
+// backend or secrets mode, a method with no OpenAPI operation, an invalid canary split)
+func (g *Generator) Plan() (*BuildPlan, error) {
+	if err := validateSecretsMode(g.secretsMode); err != nil {
+		return nil, err
+	}
+
+	plan := &BuildPlan{OutputDir: g.outputDir}
+
+	for _, handler := range g.plan.Functions {
+		name := toKebabCase(handler.FunctionName)
+		plan.Functions = append(plan.Functions, PlannedArtifact{
+			Name:     name,
+			Path:     "functions/" + name,
+			Handlers: []string{qualifiedName(handler)},
+		})
+	}
+
+	for _, group := range g.plan.Services {
+		service := PlannedArtifact{Name: toKebabCase(group.Name), Path: "containers/" + toKebabCase(group.Name)}
+		for _, handler := range group.Handlers {
+			service.Handlers = append(service.Handlers, qualifiedName(handler))
+		}
+		plan.Services = append(plan.Services, service)
+
+		if g.k8sGenerator != nil {
+			plan.Kubernetes = append(plan.Kubernetes, PlannedArtifact{
+				Name:     service.Name,
+				Path:     "k8s/" + service.Name,
+				Handlers: service.Handlers,
+			})
+		}
+	}
+
+	if g.lambdaGenerator != nil {
+		for _, handler := range g.plan.Lambdas {
+			name := toKebabCase(handler.FunctionName)
+			plan.Lambdas = append(plan.Lambdas, PlannedArtifact{
+				Name:     name,
+				Path:     "lambdas/" + name,
+				Handlers: []string{qualifiedName(handler)},
+			})
+		}
+	}
+
+	if !g.skipGateway && len(g.gatewayGenerator.plan.Routes) > 0 {
+		gg := g.gatewayGenerator
+		if gg.backend != GatewayGCP && gg.backend != GatewayEnvoy {
+			return nil, fmt.Errorf("unsupported gateway %q (expected %q or %q)", gg.backend, GatewayGCP, GatewayEnvoy)
+		}
+
+		gateway := &PlannedGateway{Backend: gg.backend, Path: "gateway"}
+		for _, route := range gg.plan.Routes {
+			method := strings.ToLower(route.Handler.Route.Method)
+			if method != "" && !slices.Contains(openAPIMethods, method) {
+				return nil, fmt.Errorf("handler %s: method %s has no OpenAPI operation", route.Handler.FunctionName, route.Handler.Route.Method)
+			}
+			if gg.omitsMethod(method) {
+				continue
+			}
+			gateway.Operations = append(gateway.Operations, PlannedOperation{
+				OperationID: route.Handler.FunctionName,
+				Method:      route.Handler.Route.Method,
+				Path:        route.Handler.Route.Path,
+				Backend:     route.Backend,
+			})
+		}
+		plan.Gateway = gateway
+	}
+
+	var modules []string
+	if !g.skipTerraform && len(g.handlers) > 0 && !g.plan.Empty() {
+		if err := g.terraformGenerator.validateCanary(); err != nil {
+			return nil, err
+		}
+
+		modules = append(modules, "api-gateway", "networking")
+		if len(g.plan.Functions) > 0 {
+			modules = append(modules, "cloud-functions")
+		}
+		if len(g.plan.Services) > 0 {
+			modules = append(modules, "cloud-run")
 		}
+		if len(g.plan.TaskQueues) > 0 {
+			modules = append(modules, "cloud-tasks")
+		}
+	}
+	// The lambda generator writes its own module, even when the GCP Terraform is skipped
+	if len(plan.Lambdas) > 0 {
+		modules = append(modules, "aws-lambda")
 	}
-	return functions
+	if len(modules) > 0 {
+		sort.Strings(modules)
+		plan.Terraform = &PlannedTerraform{Path: "terraform", Modules: modules}
+	}
+
+	if g.firebaseGenerator != nil && len(g.firebaseGenerator.plan.Routes) > 0 {
+		plan.Firebase = "firebase.json"
+	}
+
+	if g.schemaGenerator != nil && hasBodyTypes(g.handlers) {
+		plan.Schemas = "schemas"
+	}
+
+	return plan, nil
 }
 
 // filterContainerHandlers returns only handlers marked for container deployment
@@ -231,3 +689,14 @@ func filterContainerHandlers(handlers []annotations.Handler) []annotations.Handl
 	}
 	return containers
 }
+
+// handlerTimeout returns the handler's @box:timeout, or fallback when none is set
+func handlerTimeout(handler annotations.Handler, fallback time.Duration) time.Duration {
+	if handler.Timeout > 0 {
+		return handler.Timeout
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return DefaultTimeout
+}
@@ -0,0 +1,186 @@
+package build
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// Golden-file tests - compare the complete generated output against checked-in files
+//
+// Regenerate the expected files after an intentional template change with:
+//
+//	go test ./go/build -run TestGolden -update
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+const goldenDir = "testdata/golden"
+
+// goldenSuffix is appended to every golden file so that generated main.go and
+// go.mod files are never picked up by the Go tooling
+const goldenSuffix = ".golden"
+
+// goldenHandlers returns a representative handler set covering functions,
+// grouped containers, auth, rate limiting, CORS, timeouts and resources
+func goldenHandlers() []annotations.Handler {
+	return []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			RateLimit: &annotations.RateLimitConfig{
+				Count:  100,
+				Period: time.Hour,
+				Raw:    "100/hour",
+			},
+			CORS: &annotations.CORSConfig{
+				AllowedOrigins: []string{"https://example.com"},
+				Raw:            "origins=https://example.com",
+			},
+			Timeout: 30 * time.Second,
+			Memory:  "1GB",
+		},
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/accounts/{id}"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthOptional},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthNone},
+			Concurrency:    80,
+		},
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/users"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			Timeout:        5 * time.Minute,
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			PackagePath:    "internal/handlers/chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/chat/{id}/stream"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			Timeout:        time.Hour,
+		},
+	}
+}
+
+func TestGolden_GeneratedArtifacts(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    goldenHandlers(),
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "golden-project",
+		Region:      "us-central1",
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	// The emitted spec must be valid OpenAPI 3.0 before it is compared
+	require.NoError(t, ValidateOpenAPISpec(filepath.Join(tmpDir, "gateway", "openapi.yaml")))
+
+	generated := readTree(t, tmpDir, "")
+	delete(generated, ManifestFile) // Timestamped build state, not an artifact
+
+	if *updateGolden {
+		require.NoError(t, os.RemoveAll(goldenDir))
+		for relPath, content := range generated {
+			goldenPath := filepath.Join(goldenDir, relPath+goldenSuffix)
+			require.NoError(t, os.MkdirAll(filepath.Dir(goldenPath), 0755))
+			require.NoError(t, os.WriteFile(goldenPath, []byte(content), 0644))
+		}
+		t.Logf("Updated %d golden files in %s", len(generated), goldenDir)
+		return
+	}
+
+	expected := readTree(t, goldenDir, goldenSuffix)
+	require.NotEmpty(t, expected, "no golden files found; run with -update to create them")
+
+	// Every generated file must have a golden counterpart with identical content
+	for _, relPath := range sortedKeys(generated) {
+		want, ok := expected[relPath]
+		if !assert.True(t, ok, "unexpected generated file %s (run with -update if intentional)", relPath) {
+			continue
+		}
+		assert.Equal(t, want, generated[relPath], "generated file %s differs from golden file", relPath)
+	}
+
+	// Every golden file must still be generated
+	for _, relPath := range sortedKeys(expected) {
+		_, ok := generated[relPath]
+		assert.True(t, ok, "golden file %s was not generated", relPath)
+	}
+}
+
+// readTree reads all files under root, keyed by slash-separated relative path
+// with the given suffix removed
+func readTree(t *testing.T, root, suffix string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return files
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		files[strings.TrimSuffix(filepath.ToSlash(relPath), suffix)] = string(content)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return files
+}
+
+// sortedKeys returns map keys in sorted order for deterministic reporting
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
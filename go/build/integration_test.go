@@ -1,20 +1,42 @@
 package build
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 
 	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/config"
 )
 
 // Integration tests for the build system - tests at the boundary with file system
 
+// mustGenerate runs a full build, failing the test on error
+func mustGenerate(t *testing.T, gen *Generator) ManifestStats {
+	t.Helper()
+	stats, err := gen.Generate()
+	require.NoError(t, err)
+	return stats
+}
+
 func TestIntegration_GeneratorCreation(t *testing.T) {
 	handlers := []annotations.Handler{
 		{
@@ -176,6 +198,91 @@ func TestIntegration_GenerateFunctionPackage(t *testing.T) {
 	assert.Contains(t, deployStr, "gcloud functions deploy")
 }
 
+func TestIntegration_GenerateVendoredFunction(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.23.0\n\nrequire (\n\tgithub.com/google/uuid v1.6.0\n\tgo.uber.org/zap v1.27.0 // indirect\n)\n\nreplace example.com/shared => ../shared\n",
+		"go.sum": "github.com/google/uuid v1.6.0 h1:abc=\n",
+		"internal/handlers/orders/orders.go": `package orders
+
+import (
+	"net/http"
+
+	"example.com/shop/internal/store"
+)
+
+// @box:function
+// @box:path POST /orders
+func CreateOrder(w http.ResponseWriter, r *http.Request) {
+	store.Save(r.URL.Path)
+}
+`,
+		"internal/handlers/orders/orders_test.go": "package orders\n",
+		"internal/handlers/orders/receipt.tmpl":   "Order {{.ID}}\n",
+		"internal/store/store.go": `package store
+
+import "github.com/google/uuid"
+
+// Save stores an order
+func Save(id string) { _ = uuid.New() }
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	parsed, err := annotations.NewParser().ParseDirectory(filepath.Join(projectDir, "internal", "handlers"))
+	require.NoError(t, err)
+	require.Len(t, parsed.Handlers, 1)
+
+	outputDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:        parsed.Handlers,
+		OutputDir:       outputDir,
+		ModuleName:      "example.com/shop",
+		VendorFunctions: true,
+		Logger:          zap.NewNop(),
+	})
+	require.NoError(t, gen.GenerateFunctions())
+
+	funcDir := filepath.Join(outputDir, "functions", "create-order")
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(funcDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	goMod := read("go.mod")
+	assert.Contains(t, goMod, "module example.com/shop/build/functions/create-order\n\ngo 1.23.0\n")
+	assert.NotContains(t, goMod, "replace")
+	assert.NotContains(t, goMod, "example.com/shop v0.0.0")
+	assert.Contains(t, goMod, "\tgithub.com/google/uuid v1.6.0\n")
+	assert.Contains(t, goMod, "\tgo.uber.org/zap v1.27.0\n", "the handler module's version wins")
+	assert.Contains(t, goMod, "\tgithub.com/GoogleCloudPlatform/functions-framework-go v1.8.0\n")
+	assert.Equal(t, files["go.sum"], read("go.sum"))
+
+	assert.Contains(t, read("main.go"), `"example.com/shop/build/functions/create-order/internal/handlers/orders"`)
+
+	// The handler and the module packages it imports are vendored with rewritten imports
+	orders := read("internal/handlers/orders/orders.go")
+	assert.Contains(t, orders, `"example.com/shop/build/functions/create-order/internal/store"`)
+	assert.Contains(t, orders, "func CreateOrder(w http.ResponseWriter, r *http.Request) {\n\tstore.Save(r.URL.Path)\n}")
+	assert.Contains(t, read("internal/store/store.go"), `import "github.com/google/uuid"`)
+	assert.Equal(t, files["internal/handlers/orders/receipt.tmpl"], read("internal/handlers/orders/receipt.tmpl"))
+	assert.NoFileExists(t, filepath.Join(funcDir, "internal", "handlers", "orders", "orders_test.go"))
+
+	// Without the option, the function points at the repository root
+	require.NoError(t, NewGenerator(Config{
+		Handlers:   parsed.Handlers,
+		OutputDir:  outputDir,
+		ModuleName: "example.com/shop",
+		Logger:     zap.NewNop(),
+	}).GenerateFunctions())
+	assert.Contains(t, read("go.mod"), "replace example.com/shop => ../../..")
+}
+
 func TestIntegration_GenerateMultipleFunctions(t *testing.T) {
 	handlers := []annotations.Handler{
 		{
@@ -236,7 +343,7 @@ func TestIntegration_GenerateMultipleFunctions(t *testing.T) {
 		CleanBuildDir: true,
 	})
 
-	err := gen.Generate()
+	_, err := gen.Generate()
 	require.NoError(t, err)
 
 	// Verify only function handlers were generated
@@ -262,6 +369,173 @@ func TestIntegration_GenerateMultipleFunctions(t *testing.T) {
 	}
 }
 
+// generatedHandlers returns n function handlers, and n/10 container handlers spread over
+// services, for the concurrency tests and benchmarks
+func generatedHandlers(n int) []annotations.Handler {
+	var handlers []annotations.Handler
+	for i := 0; i < n; i++ {
+		handlers = append(handlers, annotations.Handler{
+			FunctionName:   fmt.Sprintf("Handle%03d", i),
+			PackageName:    fmt.Sprintf("pkg%d", i%10),
+			PackagePath:    fmt.Sprintf("internal/handlers/pkg%d", i%10),
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: fmt.Sprintf("/api/v1/items/%03d", i)},
+		})
+	}
+	for i := 0; i < n/10; i++ {
+		handlers = append(handlers, annotations.Handler{
+			FunctionName:   fmt.Sprintf("Serve%03d", i),
+			PackageName:    fmt.Sprintf("service%d", i%3),
+			PackagePath:    fmt.Sprintf("internal/services/service%d", i%3),
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: fmt.Sprintf("/api/v1/services/%03d", i)},
+		})
+	}
+	return handlers
+}
+
+func TestIntegration_ConcurrentGenerationMatchesSequential(t *testing.T) {
+	handlers := generatedHandlers(40)
+
+	outputs := make(map[int]string)
+	for _, concurrency := range []int{1, 8} {
+		outputs[concurrency] = t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:       handlers,
+			OutputDir:      outputs[concurrency],
+			ModuleName:     "github.com/gravelight-studio/box",
+			Logger:         zap.NewNop(),
+			MaxConcurrency: concurrency,
+		})
+		mustGenerate(t, gen)
+	}
+
+	drift, err := CompareOutput(outputs[8], outputs[1])
+	require.NoError(t, err)
+	assert.Empty(t, drift, "concurrent generation should write the same output as sequential generation")
+
+	// MaxConcurrency doesn't change the output, so it must not invalidate the build manifest
+	gen := NewGenerator(Config{
+		Handlers:       handlers,
+		OutputDir:      outputs[1],
+		ModuleName:     "github.com/gravelight-studio/box",
+		Logger:         zap.NewNop(),
+		MaxConcurrency: 4,
+	})
+	stats := mustGenerate(t, gen)
+	assert.Zero(t, stats.Generated)
+}
+
+func TestIntegration_ReproducibleOutput(t *testing.T) {
+	handlers := append(goldenHandlers(), annotations.Handler{
+		FunctionName:    "SendInvite",
+		PackageName:     "accounts",
+		PackagePath:     "internal/handlers/accounts",
+		DeploymentType:  annotations.DeploymentFunction,
+		Route:           annotations.Route{Method: "POST", Path: "/api/v1/invites"},
+		RequiredEnvVars: []string{"SMTP_URL", "JWT_SECRET", "DATABASE_URL"},
+	}, annotations.Handler{
+		FunctionName:    "ExportUsers",
+		PackageName:     "users",
+		PackagePath:     "internal/admin/users",
+		DeploymentType:  annotations.DeploymentContainer,
+		Route:           annotations.Route{Method: "GET", Path: "/api/v1/admin/users"},
+		RequiredEnvVars: []string{"REDIS_URL", "JWT_SECRET"},
+	})
+
+	generate := func(handlers []annotations.Handler) string {
+		outputDir := t.TempDir()
+		mustGenerate(t, NewGenerator(Config{
+			Handlers:    handlers,
+			OutputDir:   outputDir,
+			ModuleName:  "github.com/gravelight-studio/box",
+			ProjectID:   "test-project",
+			Environment: "dev",
+			Logger:      zap.NewNop(),
+		}))
+		return outputDir
+	}
+
+	first := generate(handlers)
+	drift, err := CompareOutput(generate(handlers), first)
+	require.NoError(t, err)
+	assert.Empty(t, drift, "consecutive generations should write identical output")
+
+	// Reordering a service's handlers or a handler's @box:env variables changes nothing
+	reordered := slices.Clone(handlers)
+	reordered[5].RequiredEnvVars = []string{"DATABASE_URL", "JWT_SECRET", "SMTP_URL"}
+	reordered[6].RequiredEnvVars = []string{"JWT_SECRET", "REDIS_URL"}
+	slices.Reverse(reordered[3:]) // Functions keep their relative order
+
+	drift, err = CompareOutput(generate(reordered), first)
+	require.NoError(t, err)
+	assert.Empty(t, drift, "output should not depend on the order handlers are declared in")
+
+	main, err := os.ReadFile(filepath.Join(first, "containers", "users", "main.go"))
+	require.NoError(t, err)
+	assert.Less(t, strings.Index(string(main), `/internal/admin/users"`), strings.Index(string(main), `/internal/handlers/users"`))
+}
+
+func TestIntegration_ConcurrentGenerationReportsErrors(t *testing.T) {
+	handlers := generatedHandlers(20)
+	handlers[7].FunctionName = "Broken"
+
+	// Vendoring needs each handler's source file; only the broken one has none
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module github.com/gravelight-studio/box\n\ngo 1.23\n"), 0644))
+	for i := range handlers {
+		pkgDir := filepath.Join(dir, filepath.FromSlash(handlers[i].PackagePath))
+		require.NoError(t, os.MkdirAll(pkgDir, 0755))
+		handlers[i].FilePath = filepath.Join(pkgDir, "handlers.go")
+		require.NoError(t, os.WriteFile(handlers[i].FilePath, []byte("package "+handlers[i].PackageName+"\n"), 0644))
+	}
+	handlers[7].FilePath = ""
+
+	gen := NewGenerator(Config{
+		Handlers:        handlers,
+		OutputDir:       filepath.Join(dir, "build"),
+		ModuleName:      "github.com/gravelight-studio/box",
+		Logger:          zap.NewNop(),
+		VendorFunctions: true,
+		MaxConcurrency:  4,
+	})
+	err := gen.GenerateFunctions()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to generate function Broken")
+}
+
+// BenchmarkGenerateFunctions compares sequential and concurrent generation; run it with
+// go test -bench GenerateFunctions. TestIntegration_ConcurrentGenerationMatchesSequential
+// checks both write the same output
+func BenchmarkGenerateFunctions(b *testing.B) {
+	b.Run("sequential", func(b *testing.B) { benchmarkGenerateFunctions(b, 1) })
+	b.Run("concurrent", func(b *testing.B) { benchmarkGenerateFunctions(b, runtime.NumCPU()) })
+}
+
+// benchmarkGenerateFunctions generates 100 functions into a fresh directory per iteration
+func benchmarkGenerateFunctions(b *testing.B, concurrency int) {
+	handlers := generatedHandlers(100)
+	root, err := os.MkdirTemp("", "box-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gen := NewGenerator(Config{
+			Handlers:       handlers,
+			OutputDir:      filepath.Join(root, fmt.Sprint(i)),
+			ModuleName:     "github.com/gravelight-studio/box",
+			Logger:         zap.NewNop(),
+			MaxConcurrency: concurrency,
+		})
+		if err := gen.GenerateFunctions(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestIntegration_CleanBuildDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -289,7 +563,7 @@ func TestIntegration_CleanBuildDirectory(t *testing.T) {
 		CleanBuildDir: true,
 	})
 
-	err = gen.Generate()
+	_, err = gen.Generate()
 	require.NoError(t, err)
 
 	// Existing file should be removed
@@ -318,7 +592,7 @@ func TestIntegration_NoFunctionsToGenerate(t *testing.T) {
 		Logger:     zap.NewNop(),
 	})
 
-	err := gen.Generate()
+	_, err := gen.Generate()
 	require.NoError(t, err)
 
 	// Build directory should be created but empty
@@ -340,10 +614,24 @@ func TestIntegration_ToKebabCase(t *testing.T) {
 		expected string
 	}{
 		{"CreateAccount", "create-account"},
-		{"GetAccountByID", "get-account-by-i-d"},
+		{"GetAccountByID", "get-account-by-id"},
 		{"Test", "test"},
 		{"SimpleFunction", "simple-function"},
-		{"HTTPHandler", "h-t-t-p-handler"},
+		{"HTTPHandler", "http-handler"},
+		{"GetByID", "get-by-id"},
+		{"CreateAPIKey", "create-api-key"},
+		{"ParseURL", "parse-url"},
+		{"GetUserByUUID", "get-user-by-uuid"},
+		{"ServeHTTP", "serve-http"},
+		{"HTTPSRedirect", "https-redirect"},
+		{"ListIDs", "list-ids"},
+		{"DeleteURLsByOwner", "delete-urls-by-owner"},
+		{"XMLHTTPRequest", "xmlhttp-request"},
+		{"OAuth2Callback", "o-auth2-callback"},
+		{"V2GetUser", "v2-get-user"},
+		{"ExportCSV", "export-csv"},
+		{"ID", "id"},
+		{"listUsers", "list-users"},
 	}
 
 	for _, tt := range tests {
@@ -354,6 +642,27 @@ func TestIntegration_ToKebabCase(t *testing.T) {
 	}
 }
 
+func TestIntegration_ToSnakeCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"CreateAccount", "create_account"},
+		{"GetAccountByID", "get_account_by_id"},
+		{"HTTPHandler", "http_handler"},
+		{"CreateAPIKey", "create_api_key"},
+		{"ListIDs", "list_ids"},
+		{"chat-service", "chat-service"},
+		{"storage_objectViewer", "storage_object_viewer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, toSnakeCase(tt.input))
+		})
+	}
+}
+
 func TestIntegration_DefaultValues(t *testing.T) {
 	// Handler with no memory or timeout set
 	handler := annotations.Handler{
@@ -543,7 +852,7 @@ func TestIntegration_GenerateMultipleContainerServices(t *testing.T) {
 		CleanBuildDir: true,
 	})
 
-	err := gen.Generate()
+	_, err := gen.Generate()
 	require.NoError(t, err)
 
 	// Verify container services were generated (2 services: users, accounts)
@@ -643,6 +952,83 @@ func TestIntegration_ContainerServiceGrouping(t *testing.T) {
 	assert.Contains(t, mainStr, "/api/v1/service1/c")
 }
 
+func TestIntegration_ContainerCustomHealthPath(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		HealthPath: "/_healthz",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	mainContent, err := os.ReadFile(filepath.Join(tmpDir, "containers", "users", "main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mainContent), `r.Get("/_healthz", router.HealthHandler())`)
+	assert.Contains(t, string(mainContent), `router.RegisterReadinessCheck("database", db.Ping)`)
+	assert.NotContains(t, string(mainContent), `"/health"`)
+
+	dockerfile, err := os.ReadFile(filepath.Join(tmpDir, "containers", "users", "Dockerfile"))
+	require.NoError(t, err)
+	assert.Contains(t, string(dockerfile), "http://localhost:8080/_healthz || exit 1")
+
+	cloudRun, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(cloudRun), `path = "/_healthz"`), "startup and liveness probes use the health path")
+
+	t.Run("handler overrides built-in", func(t *testing.T) {
+		overriding := append(handlers, annotations.Handler{
+			FunctionName:   "Healthz",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/_healthz"},
+		})
+
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:   overriding,
+			OutputDir:  tmpDir,
+			HealthPath: "/_healthz",
+			Logger:     zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateContainers())
+
+		mainContent, err := os.ReadFile(filepath.Join(tmpDir, "containers", "users", "main.go"))
+		require.NoError(t, err)
+		assert.Contains(t, string(mainContent), `r.Method("GET", "/_healthz", deployed("Healthz", http.HandlerFunc(users.Healthz)))`)
+		assert.NotContains(t, string(mainContent), "router.HealthHandler()")
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  t.TempDir(),
+			HealthPath: "healthz",
+			Logger:     zap.NewNop(),
+		})
+
+		require.Error(t, gen.GenerateContainers())
+	})
+}
+
 func TestIntegration_NoContainersToGenerate(t *testing.T) {
 	// All handlers are functions
 	handlers := []annotations.Handler{
@@ -661,7 +1047,7 @@ func TestIntegration_NoContainersToGenerate(t *testing.T) {
 		Logger:     zap.NewNop(),
 	})
 
-	err := gen.Generate()
+	_, err := gen.Generate()
 	require.NoError(t, err)
 
 	// Containers directory might not exist or be empty
@@ -708,7 +1094,7 @@ func TestIntegration_MixedDeploymentTypes(t *testing.T) {
 		Logger:     zap.NewNop(),
 	})
 
-	err := gen.Generate()
+	_, err := gen.Generate()
 	require.NoError(t, err)
 
 	// Should have both functions and containers directories
@@ -956,6 +1342,244 @@ func TestIntegration_GenerateGatewayWithRateLimit(t *testing.T) {
 	assert.Contains(t, openAPIStr, "rate limit")
 }
 
+func TestIntegration_GenerateGatewayRateLimitHeaders(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListOrders",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/orders"},
+			RateLimit:      &annotations.RateLimitConfig{Count: 100, Period: time.Minute, Raw: "100/minute"},
+		},
+		{
+			FunctionName:   "GetOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/orders/{id}"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:  handlers,
+		OutputDir: tmpDir,
+		ProjectID: "test-project",
+		Logger:    zap.NewNop(),
+	})
+	require.NoError(t, gen.GenerateGateway())
+
+	spec, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(context.Background()))
+
+	responses := spec.Paths.Find("/api/v1/orders").Get.Responses
+	success := responses.Value("200").Value
+	assert.Len(t, success.Headers, 3)
+	for _, name := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+		assert.Contains(t, success.Headers, name)
+	}
+	assert.Equal(t, "Requests allowed per window", success.Headers["X-RateLimit-Limit"].Value.Description)
+	assert.True(t, success.Headers["X-RateLimit-Remaining"].Value.Schema.Value.Type.Is("integer"))
+
+	tooMany := responses.Value("429").Value
+	assert.Len(t, tooMany.Headers, 4)
+	assert.Contains(t, tooMany.Headers, "Retry-After")
+	assert.Equal(t, "#/components/schemas/Error", tooMany.Content.Get("application/json").Schema.Ref)
+
+	// Handlers without @box:ratelimit document neither the headers nor a 429
+	responses = spec.Paths.Find("/api/v1/orders/{id}").Get.Responses
+	assert.Empty(t, responses.Value("200").Value.Headers)
+	assert.Nil(t, responses.Value("429"))
+}
+
+func TestIntegration_GenerateGatewayRequiredRoles(t *testing.T) {
+	handler := annotations.Handler{
+		FunctionName:   "DeletePost",
+		PackageName:    "posts",
+		DeploymentType: annotations.DeploymentFunction,
+		Route:          annotations.Route{Method: "DELETE", Path: "/api/v1/posts/{id}"},
+		Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+		Description:    "Deletes a post.",
+		RequiredRoles:  []string{"admin", "moderator"},
+	}
+
+	tmpDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:  []annotations.Handler{handler},
+		OutputDir: tmpDir,
+		ProjectID: "test-project",
+		Logger:    zap.NewNop(),
+	})
+	require.NoError(t, gen.GenerateGateway())
+
+	spec, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+
+	op := spec.Paths.Find("/api/v1/posts/{id}").Delete
+	assert.Equal(t, "Deletes a post.\n\nRequires one of the roles: admin, moderator", op.Description)
+	assert.Equal(t, "admin,moderator", op.Extensions["x-box-roles"])
+	require.NotNil(t, op.Security)
+	assert.Contains(t, (*op.Security)[0], "bearerAuth")
+}
+
+func TestIntegration_GenerateGatewayDerivedMethods(t *testing.T) {
+	route := func(name, method, path string) annotations.Handler {
+		return annotations.Handler{
+			FunctionName:   name,
+			PackageName:    "files",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: method, Path: path},
+		}
+	}
+	handlers := []annotations.Handler{
+		route("GetFile", "GET", "/api/v1/files/{id}"),
+		route("HeadFile", "HEAD", "/api/v1/files/{id}"),
+		route("FileOptions", "OPTIONS", "/api/v1/files/{id}"),
+		route("Ping", "HEAD", "/api/v1/ping"),
+	}
+
+	generate := func(t *testing.T, gateway string, handlers []annotations.Handler) (string, error) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:  handlers,
+			OutputDir: tmpDir,
+			ProjectID: "test-project",
+			Gateway:   gateway,
+			Logger:    zap.NewNop(),
+		})
+		return filepath.Join(tmpDir, "gateway", "openapi.yaml"), gen.GenerateGateway()
+	}
+
+	t.Run("gcp leaves out head and options", func(t *testing.T) {
+		specPath, err := generate(t, GatewayGCP, handlers)
+		require.NoError(t, err)
+		require.NoError(t, ValidateOpenAPISpec(specPath))
+
+		spec, err := openapi3.NewLoader().LoadFromFile(specPath)
+		require.NoError(t, err)
+		item := spec.Paths.Find("/api/v1/files/{id}")
+		require.NotNil(t, item)
+		assert.NotNil(t, item.Get)
+		assert.Nil(t, item.Head)
+		assert.Nil(t, item.Options)
+		assert.Nil(t, spec.Paths.Find("/api/v1/ping"), "a path with only HEAD has no operations")
+	})
+
+	t.Run("envoy keeps them", func(t *testing.T) {
+		specPath, err := generate(t, GatewayEnvoy, handlers)
+		require.NoError(t, err)
+
+		spec, err := openapi3.NewLoader().LoadFromFile(specPath)
+		require.NoError(t, err)
+		item := spec.Paths.Find("/api/v1/files/{id}")
+		require.NotNil(t, item)
+		assert.NotNil(t, item.Head)
+		assert.NotNil(t, item.Options)
+	})
+
+	t.Run("method without an OpenAPI operation", func(t *testing.T) {
+		_, err := generate(t, GatewayGCP, []annotations.Handler{route("Lock", "LOCK", "/api/v1/files/{id}")})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler Lock: method LOCK has no OpenAPI operation")
+	})
+}
+
+func TestIntegration_IncrementalBuild(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSource := func(name, content string) string {
+		path := filepath.Join(srcDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	accountsFile := writeSource("accounts.go", "package accounts\n")
+	chatFile := writeSource("chat.go", "package chat\n")
+
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			FilePath:       accountsFile,
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+		},
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			FilePath:       accountsFile,
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/accounts/{id}"},
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			FilePath:       chatFile,
+			DeploymentType: annotations.DeploymentContainer,
+			ServiceName:    "chat",
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/chat"},
+		},
+	}
+
+	outputDir := t.TempDir()
+	generate := func(handlers []annotations.Handler, mutate func(*Config)) ManifestStats {
+		config := Config{
+			Handlers:   handlers,
+			OutputDir:  outputDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			ProjectID:  "test-project",
+			Logger:     zap.NewNop(),
+		}
+		if mutate != nil {
+			mutate(&config)
+		}
+		return mustGenerate(t, NewGenerator(config))
+	}
+
+	// Two functions, one service, the gateway and Terraform
+	assert.Equal(t, ManifestStats{Generated: 5}, generate(handlers, nil))
+	manifest, err := LoadManifest(filepath.Join(outputDir, ManifestFile))
+	require.NoError(t, err)
+	require.Contains(t, manifest.Artifacts, "functions/create-account")
+	assert.Contains(t, manifest.Artifacts["functions/create-account"].Sources, accountsFile)
+	assert.Contains(t, manifest.Artifacts, "containers/chat")
+
+	t.Run("unchanged handlers", func(t *testing.T) {
+		assert.Equal(t, ManifestStats{Skipped: 5}, generate(handlers, nil))
+	})
+
+	t.Run("changed source", func(t *testing.T) {
+		writeSource("chat.go", "package chat\n\n// Streams messages\n")
+		// The service plus the build-wide gateway and Terraform
+		assert.Equal(t, ManifestStats{Generated: 3, Skipped: 2}, generate(handlers, nil))
+	})
+
+	t.Run("deleted artifact", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(filepath.Join(outputDir, "functions", "get-account")))
+		assert.Equal(t, ManifestStats{Generated: 1, Skipped: 4}, generate(handlers, nil))
+		assert.DirExists(t, filepath.Join(outputDir, "functions", "get-account"))
+	})
+
+	t.Run("removed handler", func(t *testing.T) {
+		assert.Equal(t, ManifestStats{Generated: 2, Skipped: 2, Removed: 1}, generate(handlers[1:], nil))
+		assert.NoDirExists(t, filepath.Join(outputDir, "functions", "create-account"))
+	})
+
+	t.Run("changed config", func(t *testing.T) {
+		stats := generate(handlers, func(c *Config) { c.Region = "europe-west1" })
+		assert.Equal(t, ManifestStats{Generated: 5}, stats)
+	})
+
+	t.Run("skipped generators keep their artifacts", func(t *testing.T) {
+		stats := generate(handlers, func(c *Config) { c.Region = "europe-west1"; c.SkipTerraform = true })
+		assert.Equal(t, ManifestStats{Skipped: 4}, stats)
+		assert.DirExists(t, filepath.Join(outputDir, "terraform"))
+	})
+
+	t.Run("force rebuild", func(t *testing.T) {
+		stats := generate(handlers, func(c *Config) { c.Region = "europe-west1"; c.ForceRebuild = true })
+		assert.Equal(t, ManifestStats{Generated: 5}, stats)
+	})
+}
+
 func TestIntegration_GenerateGatewayMixedBackends(t *testing.T) {
 	handlers := []annotations.Handler{
 		{
@@ -1087,591 +1711,4100 @@ func TestIntegration_GenerateGatewayMultipleMethodsSamePath(t *testing.T) {
 	assert.Contains(t, openAPIStr, "operationId: DeleteAllAccounts")
 }
 
-func TestIntegration_GenerateGatewayNoHandlers(t *testing.T) {
+func TestIntegration_GenerateGatewayValidatesOpenAPI(t *testing.T) {
+	// Exercise every optional part of the spec: params, auth, quotas, CORS, preloads and 503s
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			RateLimit:      &annotations.RateLimitConfig{Count: 100, Period: time.Hour, Raw: "100/hour"},
+			CORS:           &annotations.CORSConfig{AllowedOrigins: []string{"*"}, Raw: "origins=*"},
+		},
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/accounts/{id}"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthOptional},
+			Preloads:       []string{"/static/app.css"},
+		},
+		{
+			FunctionName:   "RunReport",
+			PackageName:    "reports",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/reports/{year}/{month}"},
+			Timeout:        5 * time.Minute,
+			Maintainable:   true,
+		},
+	}
+
 	tmpDir := t.TempDir()
 
 	gen := NewGenerator(Config{
-		Handlers:   []annotations.Handler{},
-		OutputDir:  tmpDir,
-		ModuleName: "github.com/gravelight-studio/box",
-		ProjectID:  "test-project",
-		Region:     "us-central1",
-		Logger:     zap.NewNop(),
+		Handlers:         handlers,
+		OutputDir:        tmpDir,
+		ModuleName:       "github.com/gravelight-studio/box",
+		ProjectID:        "test-project",
+		DefaultResponses: []string{"400", "404", "500"},
+		ValidateOpenAPI:  true,
+		Logger:           zap.NewNop(),
 	})
 
-	err := gen.GenerateGateway()
-	require.NoError(t, err)
-
-	// Gateway directory should not be created or be empty
-	gatewayDir := filepath.Join(tmpDir, "gateway")
-	if _, err := os.Stat(gatewayDir); err == nil {
-		// If it exists, it should be empty
-		entries, err := os.ReadDir(gatewayDir)
-		require.NoError(t, err)
-		assert.Empty(t, entries)
-	}
+	require.NoError(t, gen.GenerateGateway())
+
+	t.Run("invalid spec", func(t *testing.T) {
+		specPath := filepath.Join(t.TempDir(), "openapi.yaml")
+		spec := `openapi: 3.0.0
+info:
+  title: Broken
+  version: 1.0.0
+paths:
+  /accounts/{id}:
+    get:
+      responses:
+        '200':
+          description: OK
+`
+		require.NoError(t, os.WriteFile(specPath, []byte(spec), 0644))
+
+		// The {id} path parameter is never declared
+		err := ValidateOpenAPISpec(specPath)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid OpenAPI spec")
+	})
 }
 
-func TestIntegration_GenerateCompleteWithGateway(t *testing.T) {
-	// Test that Generate() creates functions, containers, and gateway
-	handlers := []annotations.Handler{
-		{
-			FunctionName:   "FunctionHandler",
-			PackageName:    "func",
-			PackagePath:    "internal/handlers/func",
-			DeploymentType: annotations.DeploymentFunction,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/func",
-			},
-			Memory:  "256MB",
-			Timeout: 30 * time.Second,
-		},
-		{
-			FunctionName:   "ContainerHandler",
-			PackageName:    "cont",
-			PackagePath:    "internal/handlers/cont",
-			DeploymentType: annotations.DeploymentContainer,
-			Route: annotations.Route{
-				Method: "GET",
-				Path:   "/api/v1/cont",
-			},
-		},
-	}
-
-	tmpDir := t.TempDir()
+func TestIntegration_GenerateGatewayBodySchemas(t *testing.T) {
+	srcDir := t.TempDir()
+	source := `package users
 
-	gen := NewGenerator(Config{
-		Handlers:      handlers,
-		OutputDir:     tmpDir,
-		ModuleName:    "github.com/gravelight-studio/box",
-		ProjectID:     "test-project",
-		Region:        "us-central1",
-		Logger:        zap.NewNop(),
-		CleanBuildDir: true,
-	})
+import (
+	"encoding/json"
+	"time"
 
-	err := gen.Generate()
-	require.NoError(t, err)
+	"example.com/app/models"
+)
 
-	// Should have all three directories
-	functionsDir := filepath.Join(tmpDir, "functions")
-	containersDir := filepath.Join(tmpDir, "containers")
-	gatewayDir := filepath.Join(tmpDir, "gateway")
+type Base struct {
+	ID        string    ` + "`json:\"id\"`" + `
+	CreatedAt time.Time ` + "`json:\"createdAt\"`" + `
+}
 
-	assert.DirExists(t, functionsDir)
-	assert.DirExists(t, containersDir)
-	assert.DirExists(t, gatewayDir)
+// User is a registered account
+type User struct {
+	Base
+	Email    string            ` + "`json:\"email\"`" + ` // Primary login address
+	Name     *string           ` + "`json:\"name,omitempty\"`" + `
+	Roles    []Role            ` + "`json:\"roles\"`" + `
+	Manager  *User             ` + "`json:\"manager,omitempty\"`" + `
+	Labels   map[string]string ` + "`json:\"labels,omitempty\"`" + `
+	Avatar   []byte            ` + "`json:\"avatar,omitempty\"`" + `
+	Settings json.RawMessage   ` + "`json:\"settings,omitempty\"`" + `
+	Password string            ` + "`json:\"-\"`" + `
+	internal int
+	Address  models.Address    ` + "`json:\"address\"`" + `
+	Tags     []models.Tag      ` + "`json:\"tags,omitempty\"`" + `
+}
 
-	// Verify gateway includes both handlers
-	openAPIFile := filepath.Join(gatewayDir, "openapi.yaml")
-	openAPIContent, err := os.ReadFile(openAPIFile)
-	require.NoError(t, err)
-	openAPIStr := string(openAPIContent)
+type Role string
 
-	assert.Contains(t, openAPIStr, "/api/v1/func:")
-	assert.Contains(t, openAPIStr, "/api/v1/cont:")
-	assert.Contains(t, openAPIStr, "operationId: FunctionHandler")
-	assert.Contains(t, openAPIStr, "operationId: ContainerHandler")
+type CreateUserRequest struct {
+	Email string ` + "`json:\"email\"`" + `
+	Age   int    ` + "`json:\"age,omitempty\"`" + `
+}
+`
+	modelsSource := `package models
+
+// Address is a postal address
+type Address struct {
+	// Street and house number
+	Street  string ` + "`json:\"street\"`" + `
+	Country string ` + "`json:\"country,omitempty\"`" + `
 }
 
-// Terraform Generator Integration Tests
+type Tag struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "go.mod"), []byte("module example.com/app\n\ngo 1.23\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "users.go"), []byte(source), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "models"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "models", "models.go"), []byte(modelsSource), 0644))
 
-func TestIntegration_GenerateTerraformBasic(t *testing.T) {
-	handler := annotations.Handler{
-		FunctionName:   "CreateAccount",
-		PackageName:    "accounts",
-		PackagePath:    "internal/handlers/accounts",
-		DeploymentType: annotations.DeploymentFunction,
-		Route: annotations.Route{
-			Method: "POST",
-			Path:   "/api/v1/accounts",
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			FilePath:       filepath.Join(srcDir, "users.go"),
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/users"},
+			RequestType:    "CreateUserRequest",
+			ResponseType:   "User",
+		},
+		{
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			FilePath:       filepath.Join(srcDir, "users.go"),
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users/{id}"},
+			ResponseType:   "User",
 		},
-		Memory:  "256MB",
-		Timeout: 30 * time.Second,
 	}
 
-	tmpDir := t.TempDir()
+	t.Run("schemas", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:        handlers,
+			OutputDir:       tmpDir,
+			ProjectID:       "test-project",
+			ValidateOpenAPI: true,
+			Logger:          zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateGateway())
 
-	gen := NewGenerator(Config{
-		Handlers:      []annotations.Handler{handler},
-		OutputDir:     tmpDir,
-		ModuleName:    "github.com/gravelight-studio/box",
-		ProjectID:     "test-project",
-		Region:        "us-central1",
-		Environment:   "dev",
-		Logger:        zap.NewNop(),
-		CleanBuildDir: true,
+		content, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		spec := string(content)
+
+		assert.Contains(t, spec, "requestBody:\n        required: true\n        content:\n          application/json:\n            schema:\n              $ref: '#/components/schemas/users.CreateUserRequest'")
+		assert.Contains(t, spec, "description: Successful response\n          content:\n            application/json:\n              schema:\n                $ref: '#/components/schemas/users.User'")
+
+		loaded, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		schemas := loaded.Components.Schemas
+		require.Contains(t, schemas, "users.User")
+		require.Contains(t, schemas, "users.Role")
+		require.Contains(t, schemas, "users.CreateUserRequest")
+		assert.NotContains(t, schemas, "users.Base", "embedded structs are flattened")
+
+		user := schemas["users.User"].Value
+		assert.ElementsMatch(t, []string{"id", "createdAt", "email", "roles", "address"}, user.Required)
+		assert.NotContains(t, user.Properties, "Password")
+		assert.NotContains(t, user.Properties, "internal")
+		assert.Equal(t, "date-time", user.Properties["createdAt"].Value.Format)
+		assert.Equal(t, "Primary login address", user.Properties["email"].Value.Description)
+		assert.Equal(t, "#/components/schemas/users.User", user.Properties["manager"].Ref)
+		assert.Equal(t, "#/components/schemas/users.Role", user.Properties["roles"].Value.Items.Ref)
+		assert.Equal(t, "byte", user.Properties["avatar"].Value.Format)
+		assert.True(t, schemas["users.Role"].Value.Type.Is("string"))
+		assert.Equal(t, []string{"email"}, schemas["users.CreateUserRequest"].Value.Required)
+
+		// Types imported from other packages get components of their own
+		require.Contains(t, schemas, "models.Address")
+		require.Contains(t, schemas, "models.Tag")
+		assert.Equal(t, "#/components/schemas/models.Address", user.Properties["address"].Ref)
+		assert.Equal(t, "#/components/schemas/models.Tag", user.Properties["tags"].Value.Items.Ref)
+		address := schemas["models.Address"].Value
+		assert.Equal(t, []string{"street"}, address.Required)
+		assert.Equal(t, "Street and house number", address.Properties["street"].Value.Description)
 	})
 
-	err := gen.GenerateTerraform()
-	require.NoError(t, err)
+	t.Run("skip schemas", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:    handlers,
+			OutputDir:   tmpDir,
+			ProjectID:   "test-project",
+			SkipSchemas: true,
+			Logger:      zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateGateway())
 
-	// Verify terraform directory was created
-	terraformDir := filepath.Join(tmpDir, "terraform")
-	assert.DirExists(t, terraformDir)
+		content, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(content), "requestBody")
+		assert.NotContains(t, string(content), "users.User")
+	})
 
-	// Verify required files exist
-	mainTF := filepath.Join(terraformDir, "main.tf")
-	variablesTF := filepath.Join(terraformDir, "variables.tf")
-	outputsTF := filepath.Join(terraformDir, "outputs.tf")
-	gitignore := filepath.Join(terraformDir, ".gitignore")
-	readme := filepath.Join(terraformDir, "README.md")
+	t.Run("unknown type", func(t *testing.T) {
+		broken := append([]annotations.Handler(nil), handlers...)
+		broken[1].ResponseType = "Profile"
 
-	assert.FileExists(t, mainTF, "main.tf should exist")
-	assert.FileExists(t, variablesTF, "variables.tf should exist")
-	assert.FileExists(t, outputsTF, "outputs.tf should exist")
-	assert.FileExists(t, gitignore, ".gitignore should exist")
-	assert.FileExists(t, readme, "README.md should exist")
+		gen := NewGenerator(Config{
+			Handlers:  broken,
+			OutputDir: t.TempDir(),
+			Logger:    zap.NewNop(),
+		})
+		err := gen.GenerateGateway()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler GetUser: @box:response: type Profile is not declared in package users")
+	})
+}
 
-	// Verify main.tf contains expected content
-	mainContent, err := os.ReadFile(mainTF)
-	require.NoError(t, err)
-	mainStr := string(mainContent)
+func TestIntegration_EmitJSONSchema(t *testing.T) {
+	srcDir := t.TempDir()
+	usersSource := `package users
 
-	assert.Contains(t, mainStr, "terraform {")
-	assert.Contains(t, mainStr, "required_version = \">= 1.0\"")
-	assert.Contains(t, mainStr, "required_providers {")
-	assert.Contains(t, mainStr, "google = {")
-	assert.Contains(t, mainStr, "module \"cloud_functions\" {")
-	assert.Contains(t, mainStr, "source = \"./modules/cloud-functions\"")
+type User struct {
+	Email   string ` + "`json:\"email\"`" + `
+	Roles   []Role ` + "`json:\"roles\"`" + `
+	Manager *User  ` + "`json:\"manager,omitempty\"`" + `
+}
 
-	// Verify .gitignore contains Terraform files
-	gitignoreContent, err := os.ReadFile(gitignore)
-	require.NoError(t, err)
-	gitignoreStr := string(gitignoreContent)
+type Role string
 
-	assert.Contains(t, gitignoreStr, "*.tfstate")
-	assert.Contains(t, gitignoreStr, ".terraform/")
+type CreateUserRequest struct {
+	Email string ` + "`json:\"email\"`" + `
+	Role  Role   ` + "`json:\"role\"`" + `
 }
 
-func TestIntegration_GenerateTerraformCloudFunctions(t *testing.T) {
+type Session struct {
+	Token string ` + "`json:\"token\"`" + `
+}
+`
+	adminSource := `package admin
+
+type User struct {
+	ID string ` + "`json:\"id\"`" + `
+}
+`
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "users"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "admin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "users", "users.go"), []byte(usersSource), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "admin", "admin.go"), []byte(adminSource), 0644))
+
 	handlers := []annotations.Handler{
 		{
-			FunctionName:   "CreateAccount",
-			PackageName:    "accounts",
-			PackagePath:    "internal/handlers/accounts",
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			FilePath:       filepath.Join(srcDir, "users", "users.go"),
 			DeploymentType: annotations.DeploymentFunction,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/accounts",
-			},
-			Memory:  "256MB",
-			Timeout: 30 * time.Second,
+			Route:          annotations.Route{Method: "POST", Path: "/users"},
+			RequestType:    "CreateUserRequest",
+			ResponseType:   "User",
 		},
 		{
-			FunctionName:   "GetAccount",
-			PackageName:    "accounts",
-			PackagePath:    "internal/handlers/accounts",
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			FilePath:       filepath.Join(srcDir, "users", "users.go"),
 			DeploymentType: annotations.DeploymentFunction,
-			Route: annotations.Route{
-				Method: "GET",
-				Path:   "/api/v1/accounts/{id}",
-			},
-			Memory:  "128MB",
-			Timeout: 15 * time.Second,
+			Route:          annotations.Route{Method: "GET", Path: "/users/{id}"},
+			ResponseType:   "User",
+		},
+		{
+			FunctionName:   "GetAdmin",
+			PackageName:    "admin",
+			FilePath:       filepath.Join(srcDir, "admin", "admin.go"),
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/admins/{id}"},
+			ResponseType:   "User",
 		},
 	}
 
 	tmpDir := t.TempDir()
-
 	gen := NewGenerator(Config{
-		Handlers:    handlers,
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "dev",
-		Logger:      zap.NewNop(),
+		Handlers:       handlers,
+		OutputDir:      tmpDir,
+		ModuleName:     "github.com/gravelight-studio/box",
+		ProjectID:      "test-project",
+		EmitJSONSchema: true,
+		Logger:         zap.NewNop(),
 	})
 
-	err := gen.GenerateTerraform()
+	plan, err := gen.Plan()
 	require.NoError(t, err)
+	assert.Equal(t, "schemas", plan.Schemas)
 
-	// Verify cloud-functions module was created
-	modulePath := filepath.Join(tmpDir, "terraform", "modules", "cloud-functions", "main.tf")
-	assert.FileExists(t, modulePath)
+	mustGenerate(t, gen)
 
-	moduleContent, err := os.ReadFile(modulePath)
+	// One file per referenced type, shared types once; a name used by two packages is qualified
+	entries, err := os.ReadDir(filepath.Join(tmpDir, "schemas"))
 	require.NoError(t, err)
-	moduleStr := string(moduleContent)
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"CreateUserRequest.json", "users.User.json", "admin.User.json"}, files)
 
-	// Should have service account
-	assert.Contains(t, moduleStr, "resource \"google_service_account\" \"accounts\" {")
-	assert.Contains(t, moduleStr, "account_id   = \"wylla-accounts-$${var.environment}\"")
+	readSchema := func(name string) map[string]any {
+		data, err := os.ReadFile(filepath.Join(tmpDir, "schemas", name))
+		require.NoError(t, err)
+		var schema map[string]any
+		require.NoError(t, json.Unmarshal(data, &schema))
+		return schema
+	}
 
-	// Should have IAM bindings
-	assert.Contains(t, moduleStr, "resource \"google_project_iam_member\" \"accounts_cloudsql\" {")
-	assert.Contains(t, moduleStr, "role    = \"roles/cloudsql.client\"")
+	// Each file stands alone: referenced types are inlined under $defs
+	request := readSchema("CreateUserRequest.json")
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", request["$schema"])
+	assert.Equal(t, "CreateUserRequest", request["title"])
+	assert.Equal(t, "object", request["type"])
+	assert.Equal(t, []any{"email", "role"}, request["required"])
+	assert.Equal(t, map[string]any{"$ref": "#/$defs/users.Role"}, request["properties"].(map[string]any)["role"])
+	assert.Equal(t, map[string]any{"users.Role": map[string]any{"type": "string"}}, request["$defs"])
+
+	// References back to the file's own type point at the document root
+	user := readSchema("users.User.json")
+	assert.Equal(t, "User", user["title"])
+	properties := user["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"$ref": "#"}, properties["manager"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/users.Role"}}, properties["roles"])
+
+	admin := readSchema("admin.User.json")
+	assert.Equal(t, []any{"id"}, admin["required"])
+	assert.NotContains(t, admin, "$defs")
+
+	// Session isn't a body type of any handler
+	assert.NoFileExists(t, filepath.Join(tmpDir, "schemas", "Session.json"))
+
+	// Types that are no longer referenced are removed on the next build
+	gen = NewGenerator(Config{
+		Handlers:       handlers[:2],
+		OutputDir:      tmpDir,
+		ModuleName:     "github.com/gravelight-studio/box",
+		ProjectID:      "test-project",
+		EmitJSONSchema: true,
+		Logger:         zap.NewNop(),
+	})
+	mustGenerate(t, gen)
+	assert.FileExists(t, filepath.Join(tmpDir, "schemas", "User.json"))
+	assert.NoFileExists(t, filepath.Join(tmpDir, "schemas", "admin.User.json"))
+}
 
-	// Should have storage bucket for function source
-	assert.Contains(t, moduleStr, "resource \"google_storage_bucket\" \"functions\" {")
+func TestIntegration_GenerateGatewayExamples(t *testing.T) {
+	srcDir := t.TempDir()
+	source := `package users
 
-	// Should have function resources
-	assert.Contains(t, moduleStr, "resource \"google_cloudfunctions_function\" \"create_account\" {")
-	assert.Contains(t, moduleStr, "name                  = \"wylla-$${var.environment}-create-account\"")
-	assert.Contains(t, moduleStr, "runtime              = \"go122\"")
-	assert.Contains(t, moduleStr, "available_memory_mb = 256")
-	assert.Contains(t, moduleStr, "timeout             = 30")
+type CreateUserRequest struct {
+	Email string ` + "`json:\"email\"`" + `
 }
+`
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "users.go"), []byte(source), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "examples"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "examples", "create-user.json"), []byte(`{"email": "ada@example.com", "tags": ["admin"]}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "examples", "user.json"), []byte(`{"id": "u_1", "email": "ada@example.com", "verified": true}`), 0644))
 
-func TestIntegration_GenerateTerraformCloudRun(t *testing.T) {
 	handlers := []annotations.Handler{
 		{
-			FunctionName:   "GetUsers",
-			PackageName:    "users",
-			PackagePath:    "internal/handlers/users",
-			DeploymentType: annotations.DeploymentContainer,
-			Route: annotations.Route{
-				Method: "GET",
-				Path:   "/api/v1/users",
-			},
-		},
-		{
-			FunctionName:   "CreateUser",
-			PackageName:    "users",
-			PackagePath:    "internal/handlers/users",
-			DeploymentType: annotations.DeploymentContainer,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/users",
-			},
+			FunctionName:    "CreateUser",
+			PackageName:     "users",
+			FilePath:        filepath.Join(srcDir, "users.go"),
+			DeploymentType:  annotations.DeploymentFunction,
+			Route:           annotations.Route{Method: "POST", Path: "/api/v1/users"},
+			RequestType:     "CreateUserRequest",
+			RequestExample:  "./examples/create-user.json",
+			ResponseExample: "examples/user.json",
 		},
 	}
 
-	tmpDir := t.TempDir()
+	t.Run("examples", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:        handlers,
+			OutputDir:       tmpDir,
+			ProjectID:       "test-project",
+			ValidateOpenAPI: true,
+			Logger:          zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateGateway())
 
-	gen := NewGenerator(Config{
-		Handlers:    handlers,
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "staging",
-		Logger:      zap.NewNop(),
+		loaded, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		op := loaded.Paths.Find("/api/v1/users").Post
+		require.NotNil(t, op)
+
+		request := op.RequestBody.Value.Content.Get("application/json")
+		require.NotNil(t, request)
+		assert.Equal(t, "#/components/schemas/users.CreateUserRequest", request.Schema.Ref)
+		assert.Equal(t, map[string]interface{}{"email": "ada@example.com", "tags": []interface{}{"admin"}}, request.Example)
+
+		response := op.Responses.Status(200).Value.Content.Get("application/json")
+		require.NotNil(t, response)
+		assert.Nil(t, response.Schema)
+		assert.Equal(t, map[string]interface{}{"id": "u_1", "email": "ada@example.com", "verified": true}, response.Example)
 	})
 
-	err := gen.GenerateTerraform()
-	require.NoError(t, err)
-
-	// Verify cloud-run module was created
-	modulePath := filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf")
-	assert.FileExists(t, modulePath)
+	t.Run("example without schema", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:    handlers,
+			OutputDir:   tmpDir,
+			ProjectID:   "test-project",
+			SkipSchemas: true,
+			Logger:      zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateGateway())
 
-	moduleContent, err := os.ReadFile(modulePath)
-	require.NoError(t, err)
-	moduleStr := string(moduleContent)
+		loaded, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		request := loaded.Paths.Find("/api/v1/users").Post.RequestBody.Value.Content.Get("application/json")
+		require.NotNil(t, request)
+		assert.Nil(t, request.Schema)
+		assert.NotNil(t, request.Example)
+	})
 
-	// Should have service account for users
-	assert.Contains(t, moduleStr, "resource \"google_service_account\" \"users\" {")
-	assert.Contains(t, moduleStr, "account_id   = \"wylla-users-$${var.environment}\"")
+	t.Run("missing file", func(t *testing.T) {
+		broken := append([]annotations.Handler(nil), handlers...)
+		broken[0].RequestExample = "examples/missing.json"
 
-	// Should have Cloud Run service
-	assert.Contains(t, moduleStr, "resource \"google_cloud_run_service\" \"users\" {")
-	assert.Contains(t, moduleStr, "name     = \"wylla-$${var.environment}-users\"")
-	assert.Contains(t, moduleStr, "location = var.region")
+		gen := NewGenerator(Config{Handlers: broken, OutputDir: t.TempDir(), Logger: zap.NewNop()})
+		err := gen.GenerateGateway()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler CreateUser: @box:request-example: failed to read example")
+	})
 
-	// Should have container config
-	assert.Contains(t, moduleStr, "image = \"gcr.io/$${var.project_id}/users:latest\"")
+	t.Run("invalid JSON", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, "examples", "broken.json"), []byte(`{"id": `), 0644))
+		broken := append([]annotations.Handler(nil), handlers...)
+		broken[0].ResponseExample = "examples/broken.json"
 
-	// Should have IAM for public access
-	assert.Contains(t, moduleStr, "resource \"google_cloud_run_service_iam_member\" \"users_invoker\" {")
-	assert.Contains(t, moduleStr, "role     = \"roles/run.invoker\"")
+		gen := NewGenerator(Config{Handlers: broken, OutputDir: t.TempDir(), Logger: zap.NewNop()})
+		err := gen.GenerateGateway()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler CreateUser: @box:response-example: examples/broken.json is not valid JSON")
+	})
 }
 
-func TestIntegration_GenerateTerraformAPIGateway(t *testing.T) {
+func TestIntegration_GenerateGatewayProxy(t *testing.T) {
+	payments := &annotations.ProxyConfig{
+		Upstream:     "https://api.payments.example.com/v2",
+		Environments: map[string]string{"staging": "https://sandbox.payments.example.com/v2"},
+	}
 	handlers := []annotations.Handler{
 		{
-			FunctionName:   "CreateAccount",
-			PackageName:    "accounts",
+			FunctionName:   "PaymentsProxy",
+			PackageName:    "payments",
+			DeploymentType: annotations.DeploymentProxy,
+			Route:          annotations.Route{Method: "GET", Path: "/payments/{id}"},
+			Proxy:          payments,
+		},
+		{
+			FunctionName:   "ListOrders",
+			PackageName:    "orders",
 			DeploymentType: annotations.DeploymentFunction,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/accounts",
-			},
+			Route:          annotations.Route{Method: "GET", Path: "/orders"},
 		},
 	}
 
-	tmpDir := t.TempDir()
+	newGenerator := func(dir, environment, gateway string) *Generator {
+		return NewGenerator(Config{
+			Handlers:        handlers,
+			OutputDir:       dir,
+			ModuleName:      "github.com/gravelight-studio/box",
+			ProjectID:       "test-project",
+			Environment:     environment,
+			Gateway:         gateway,
+			ValidateOpenAPI: gateway == GatewayGCP,
+			Logger:          zap.NewNop(),
+		})
+	}
 
-	gen := NewGenerator(Config{
-		Handlers:    handlers,
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "production",
-		Logger:      zap.NewNop(),
-	})
+	// The gateway routes straight to the upstream for the build's environment, keeping the path
+	for environment, address := range map[string]string{
+		"production": "https://api.payments.example.com/v2",
+		"staging":    "https://sandbox.payments.example.com/v2",
+	} {
+		tmpDir := t.TempDir()
+		require.NoError(t, newGenerator(tmpDir, environment, GatewayGCP).GenerateGateway())
 
-	err := gen.GenerateTerraform()
-	require.NoError(t, err)
+		openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		var spec struct {
+			Paths map[string]map[string]struct {
+				Backend map[string]string `yaml:"x-google-backend"`
+			} `yaml:"paths"`
+		}
+		require.NoError(t, yaml.Unmarshal(openAPIContent, &spec))
 
-	// Verify api-gateway module was created
-	modulePath := filepath.Join(tmpDir, "terraform", "modules", "api-gateway", "main.tf")
-	assert.FileExists(t, modulePath)
+		proxied := spec.Paths["/payments/{id}"]["get"].Backend
+		assert.Equal(t, address, proxied["address"], environment)
+		assert.Equal(t, "APPEND_PATH_TO_ADDRESS", proxied["path_translation"], environment)
+		assert.NotContains(t, spec.Paths["/orders"]["get"].Backend, "path_translation")
+	}
 
-	moduleContent, err := os.ReadFile(modulePath)
+	// Nothing is deployed for the proxy
+	plan, err := newGenerator(t.TempDir(), "production", GatewayGCP).Plan()
 	require.NoError(t, err)
-	moduleStr := string(moduleContent)
+	require.Len(t, plan.Functions, 1)
+	assert.Equal(t, "list-orders", plan.Functions[0].Name)
+	assert.Empty(t, plan.Services)
 
-	// Should have API resource
-	assert.Contains(t, moduleStr, "resource \"google_api_gateway_api\" \"api\" {")
-	assert.Contains(t, moduleStr, "api_id       = \"wylla-api-$${var.environment}\"")
+	// Envoy gets a TLS cluster for the upstream host and prepends its base path
+	tmpDir := t.TempDir()
+	require.NoError(t, newGenerator(tmpDir, "production", GatewayEnvoy).GenerateGateway())
+	envoyContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "envoy.yaml"))
+	require.NoError(t, err)
+	envoyStr := string(envoyContent)
+	assert.Contains(t, envoyStr, "cluster: proxy-api-payments-example-com")
+	assert.Contains(t, envoyStr, "address: api.payments.example.com")
+	assert.Contains(t, envoyStr, `substitution: "/v2\\1"`)
 
-	// Should have API config
-	assert.Contains(t, moduleStr, "resource \"google_api_gateway_api_config\" \"api_config\" {")
-	assert.Contains(t, moduleStr, "api           = google_api_gateway_api.api.api_id")
+	var envoyConfig map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(envoyContent, &envoyConfig))
+}
 
-	// Should reference OpenAPI spec
-	assert.Contains(t, moduleStr, "openapi_documents {")
-	assert.Contains(t, moduleStr, "path     = \"openapi.yaml\"")
-	assert.Contains(t, moduleStr, "contents = filebase64(\"$${path.module}/../../gateway/openapi.yaml\")")
+func TestIntegration_GenerateGatewayEnvoyProxyRequiresHTTPS(t *testing.T) {
+	gen := NewGenerator(Config{
+		Handlers: []annotations.Handler{{
+			FunctionName:   "LegacyProxy",
+			PackageName:    "legacy",
+			DeploymentType: annotations.DeploymentProxy,
+			Route:          annotations.Route{Method: "GET", Path: "/legacy"},
+			Proxy:          &annotations.ProxyConfig{Upstream: "http://legacy.example.com:8080"},
+		}},
+		OutputDir:  t.TempDir(),
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Gateway:    GatewayEnvoy,
+		Logger:     zap.NewNop(),
+	})
 
-	// Should have Gateway resource
-	assert.Contains(t, moduleStr, "resource \"google_api_gateway_gateway\" \"gateway\" {")
-	assert.Contains(t, moduleStr, "gateway_id   = \"wylla-gateway-$${var.environment}\"")
+	require.ErrorContains(t, gen.GenerateGateway(), "only reaches https upstreams on the default port")
 }
 
-func TestIntegration_GenerateTerraformNetworking(t *testing.T) {
-	handler := annotations.Handler{
-		FunctionName:   "TestHandler",
-		PackageName:    "test",
-		DeploymentType: annotations.DeploymentFunction,
-		Route: annotations.Route{
-			Method: "GET",
-			Path:   "/test",
+func TestIntegration_GenerateGatewayEnvoy(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListAccounts",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/accounts"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			RateLimit:      &annotations.RateLimitConfig{Count: 100, Period: time.Minute, Raw: "100/minute"},
+		},
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/accounts/{id}"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthOptional},
+		},
+		{
+			FunctionName:   "RunReport",
+			PackageName:    "reports",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/reports"},
+			Timeout:        5 * time.Minute,
 		},
 	}
 
 	tmpDir := t.TempDir()
 
 	gen := NewGenerator(Config{
-		Handlers:    []annotations.Handler{handler},
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "dev",
-		Logger:      zap.NewNop(),
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Gateway:    GatewayEnvoy,
+		Logger:     zap.NewNop(),
 	})
 
-	err := gen.GenerateTerraform()
+	err := gen.GenerateGateway()
 	require.NoError(t, err)
 
-	// Verify networking module was created
-	modulePath := filepath.Join(tmpDir, "terraform", "modules", "networking", "main.tf")
-	assert.FileExists(t, modulePath)
+	gatewayDir := filepath.Join(tmpDir, "gateway")
+	assert.FileExists(t, filepath.Join(gatewayDir, "envoy.yaml"))
+	assert.FileExists(t, filepath.Join(gatewayDir, "openapi.yaml"))
+	assert.NoFileExists(t, filepath.Join(gatewayDir, "gateway-config.yaml"))
+	assert.NoFileExists(t, filepath.Join(gatewayDir, "deploy.sh"))
 
-	moduleContent, err := os.ReadFile(modulePath)
+	content, err := os.ReadFile(filepath.Join(gatewayDir, "envoy.yaml"))
 	require.NoError(t, err)
-	moduleStr := string(moduleContent)
-
-	// Should have VPC
-	assert.Contains(t, moduleStr, "resource \"google_compute_network\" \"vpc\" {")
-	assert.Contains(t, moduleStr, "name                    = \"wylla-vpc-$${var.environment}\"")
-
-	// Should have subnet
-	assert.Contains(t, moduleStr, "resource \"google_compute_subnetwork\" \"subnet\" {")
-	assert.Contains(t, moduleStr, "ip_cidr_range = \"10.0.0.0/24\"")
-
-	// Should have VPC connector
-	assert.Contains(t, moduleStr, "resource \"google_vpc_access_connector\" \"connector\" {")
-	assert.Contains(t, moduleStr, "name          = \"wylla-connector-$${var.environment}\"")
+	envoyStr := string(content)
+
+	var doc map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(content, &doc))
+
+	// Exact and parameterized path matches
+	assert.Contains(t, envoyStr, `path: "/api/v1/accounts"`)
+	assert.Contains(t, envoyStr, `regex: '/api/v1/accounts/[^/]+'`)
+
+	// Functions share a cluster and are rewritten to their function path
+	assert.Contains(t, envoyStr, "cluster: functions")
+	assert.Contains(t, envoyStr, "address: us-central1-test-project.cloudfunctions.net")
+	assert.Contains(t, envoyStr, `substitution: "/list-accounts"`)
+
+	// Containers route to their Cloud Run service with the handler timeout
+	assert.Contains(t, envoyStr, "cluster: reports\n                  timeout: 300s")
+	assert.Contains(t, envoyStr, "address: reports-us-central1.run.app")
+
+	// Rate limits become local rate limit token buckets
+	assert.Contains(t, envoyStr, "max_tokens: 100")
+	assert.Contains(t, envoyStr, "fill_interval: 60s")
+
+	// Auth maps to jwt_authn requirements, disabled for public routes
+	assert.Contains(t, envoyStr, "requirement_name: required")
+	assert.Contains(t, envoyStr, "requirement_name: optional")
+	assert.Contains(t, envoyStr, "disabled: true")
+	assert.Contains(t, envoyStr, "issuer: REPLACE_WITH_ISSUER")
+
+	t.Run("unsupported gateway", func(t *testing.T) {
+		gen := NewGenerator(Config{
+			Handlers:  handlers,
+			OutputDir: t.TempDir(),
+			Gateway:   "nginx",
+			Logger:    zap.NewNop(),
+		})
 
-	// Should have Cloud SQL instance
-	assert.Contains(t, moduleStr, "resource \"google_sql_database_instance\" \"main\" {")
-	assert.Contains(t, moduleStr, "name             = \"wylla-db-$${var.environment}\"")
-	assert.Contains(t, moduleStr, "database_version = \"POSTGRES_15\"")
+		err := gen.GenerateGateway()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unsupported gateway "nginx"`)
+	})
 }
 
-func TestIntegration_GenerateTerraformEnvironmentVariables(t *testing.T) {
-	handler := annotations.Handler{
-		FunctionName:   "TestHandler",
-		PackageName:    "test",
-		DeploymentType: annotations.DeploymentFunction,
-		Route: annotations.Route{
-			Method: "GET",
-			Path:   "/test",
+func TestIntegration_GenerateGatewayWithPreloads(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "GetApp",
+			PackageName:    "web",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/app",
+			},
+			Preloads: []string{"/static/app.css", "/static/app.js"},
+		},
+		{
+			FunctionName:   "GetStatus",
+			PackageName:    "web",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/status",
+			},
 		},
 	}
 
 	tmpDir := t.TempDir()
 
 	gen := NewGenerator(Config{
-		Handlers:    []annotations.Handler{handler},
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "dev",
-		Logger:      zap.NewNop(),
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
 	})
 
-	err := gen.GenerateTerraform()
+	err := gen.GenerateGateway()
 	require.NoError(t, err)
 
-	// Verify environment-specific tfvars files exist
-	envDir := filepath.Join(tmpDir, "terraform", "environments")
-	assert.DirExists(t, envDir)
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
 
-	devTfvars := filepath.Join(envDir, "dev.tfvars")
-	stagingTfvars := filepath.Join(envDir, "staging.tfvars")
-	productionTfvars := filepath.Join(envDir, "production.tfvars")
+	// The success response documents the Link header
+	assert.Contains(t, openAPIStr, `        '200':
+          description: Successful response
+          headers:
+            Link:
+              description: 'Preload hints (rel=preload) for /static/app.css, /static/app.js'
+              schema:
+                type: string
+`)
+
+	// Handlers without preloads document no headers
+	assert.Equal(t, 1, strings.Count(openAPIStr, "headers:"))
+
+	// The spec is still valid YAML
+	var doc map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(openAPIContent, &doc))
+}
 
-	assert.FileExists(t, devTfvars, "dev.tfvars should exist")
-	assert.FileExists(t, stagingTfvars, "staging.tfvars should exist")
-	assert.FileExists(t, productionTfvars, "production.tfvars should exist")
+func TestIntegration_GenerateGatewayWithCORSExposedHeaders(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListItems",
+			PackageName:    "items",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/items"},
+			CORS: &annotations.CORSConfig{
+				AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+				MaxAge:           600,
+				ExposedHeaders:   []string{"X-Total-Count", "Link"},
+				AllowCredentials: true,
+			},
+		},
+		{
+			FunctionName:   "GetStatus",
+			PackageName:    "items",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/status"},
+		},
+	}
 
-	// Verify dev.tfvars content
-	devContent, err := os.ReadFile(devTfvars)
-	require.NoError(t, err)
-	devStr := string(devContent)
+	tmpDir := t.TempDir()
 
-	assert.Contains(t, devStr, "environment = \"dev\"")
-	assert.Contains(t, devStr, "project_id  = \"YOUR_PROJECT_ID\"") // Template generates placeholder
-	assert.Contains(t, devStr, "region      = \"us-central1\"")
-	assert.Contains(t, devStr, "database_password = \"CHANGE_ME_DEV\"")
+	gen := NewGenerator(Config{
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		ValidateOpenAPI: true,
+		Logger:          zap.NewNop(),
+	})
 
-	// Verify staging.tfvars content
-	stagingContent, err := os.ReadFile(stagingTfvars)
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
 	require.NoError(t, err)
-	stagingStr := string(stagingContent)
+	openAPIStr := string(openAPIContent)
 
-	assert.Contains(t, stagingStr, "environment = \"staging\"")
-	assert.Contains(t, stagingStr, "database_password = \"CHANGE_ME_STAGING\"")
+	assert.Contains(t, openAPIStr, `            Access-Control-Expose-Headers:
+              description: 'Headers readable by cross-origin clients: X-Total-Count, Link'`)
+	assert.Contains(t, openAPIStr, `            Access-Control-Allow-Origin:
+              description: 'Echoes the request Origin when allowed: https://app.example.com, https://*.example.org (any subdomain of example.org)'`)
 
-	// Verify production.tfvars content
-	productionContent, err := os.ReadFile(productionTfvars)
-	require.NoError(t, err)
-	productionStr := string(productionContent)
+	assert.Contains(t, openAPIStr, `            Access-Control-Allow-Credentials:
+              description: 'true: browsers may send cookies and Authorization headers cross-origin'`)
 
-	assert.Contains(t, productionStr, "environment = \"production\"")
-	assert.Contains(t, productionStr, "database_password = \"CHANGE_ME_PRODUCTION\"")
+	// Handlers without CORS document no exposed headers
+	assert.Equal(t, 1, strings.Count(openAPIStr, "Access-Control-Expose-Headers"))
 }
 
-func TestIntegration_GenerateTerraformNoHandlers(t *testing.T) {
+func TestIntegration_GenerateGatewayPaginated(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+			Paginated:      true,
+			Preloads:       []string{"/static/users.css"},
+		},
+		{
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users/{id}"},
+		},
+	}
+
 	tmpDir := t.TempDir()
 
 	gen := NewGenerator(Config{
-		Handlers:    []annotations.Handler{},
-		OutputDir:   tmpDir,
-		ModuleName:  "github.com/gravelight-studio/box",
-		ProjectID:   "test-project",
-		Region:      "us-central1",
-		Environment: "dev",
-		Logger:      zap.NewNop(),
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		ValidateOpenAPI: true,
+		Logger:          zap.NewNop(),
 	})
 
-	err := gen.GenerateTerraform()
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
 	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
 
-	// Terraform directory should not be created or be empty
-	terraformDir := filepath.Join(tmpDir, "terraform")
-	if _, err := os.Stat(terraformDir); err == nil {
-		// If it exists, check that basic files exist but modules are minimal
-		mainTF := filepath.Join(terraformDir, "main.tf")
-		if _, err := os.Stat(mainTF); err == nil {
-			mainContent, _ := os.ReadFile(mainTF)
-			mainStr := string(mainContent)
-			// Should still have terraform block but no handlers
-			assert.Contains(t, mainStr, "terraform {")
-		}
-	}
+	// page and limit are optional integer query parameters
+	assert.Contains(t, openAPIStr, `        - name: page
+          in: query
+          required: false
+          schema:
+            type: integer
+        - name: limit
+          in: query
+          required: false
+          schema:
+            type: integer
+`)
+
+	// Pagination headers are documented, sharing the Link header with preload hints
+	assert.Contains(t, openAPIStr, "X-Total-Count:")
+	assert.Contains(t, openAPIStr, "description: 'Preload hints (rel=preload) for /static/users.css; Pagination links (rel=first, prev, next, last)'")
+	assert.Equal(t, 2, strings.Count(openAPIStr, "in: query"), "only the paginated operation takes query parameters")
 }
 
-func TestIntegration_GenerateTerraformComplete(t *testing.T) {
-	// Test complete Terraform generation with mixed handlers
+func TestIntegration_GenerateGatewayDeprecated(t *testing.T) {
 	handlers := []annotations.Handler{
 		{
-			FunctionName:   "CreateAccount",
-			PackageName:    "accounts",
-			PackagePath:    "internal/handlers/accounts",
-			DeploymentType: annotations.DeploymentFunction,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/accounts",
-			},
-			Memory:  "256MB",
-			Timeout: 30 * time.Second,
-		},
-		{
-			FunctionName:   "GetUsers",
-			PackageName:    "users",
-			PackagePath:    "internal/handlers/users",
-			DeploymentType: annotations.DeploymentContainer,
-			Route: annotations.Route{
-				Method: "GET",
-				Path:   "/api/v1/users",
-			},
+			FunctionName:    "ListUsersV1",
+			PackageName:     "users",
+			DeploymentType:  annotations.DeploymentFunction,
+			Route:           annotations.Route{Method: "GET", Path: "/v1/users"},
+			Description:     "Lists users.",
+			Deprecated:      true,
+			DeprecationNote: "use GET /v2/users",
 		},
 		{
-			FunctionName:   "CreateUser",
+			FunctionName:   "ListUsersV2",
 			PackageName:    "users",
-			PackagePath:    "internal/handlers/users",
-			DeploymentType: annotations.DeploymentContainer,
-			Route: annotations.Route{
-				Method: "POST",
-				Path:   "/api/v1/users",
-			},
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/v2/users"},
 		},
 	}
 
 	tmpDir := t.TempDir()
-
 	gen := NewGenerator(Config{
-		Handlers:      handlers,
-		OutputDir:     tmpDir,
-		ModuleName:    "github.com/gravelight-studio/box",
-		ProjectID:     "test-project",
-		Region:        "us-central1",
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		ValidateOpenAPI: true,
+		Logger:          zap.NewNop(),
+	})
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Description string `yaml:"description"`
+			Deprecated  bool   `yaml:"deprecated"`
+			Backend     struct {
+				Address string `yaml:"address"`
+			} `yaml:"x-google-backend"`
+		} `yaml:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal(openAPIContent, &spec))
+
+	// The deprecated operation is flagged but still routed to its function
+	v1 := spec.Paths["/v1/users"]["get"]
+	assert.True(t, v1.Deprecated)
+	assert.Equal(t, "Lists users.\n\nDeprecated: use GET /v2/users", v1.Description)
+	assert.Contains(t, v1.Backend.Address, "list-users-v1")
+
+	v2 := spec.Paths["/v2/users"]["get"]
+	assert.False(t, v2.Deprecated)
+	assert.Empty(t, v2.Description)
+}
+
+func TestIntegration_ExcludeDeprecated(t *testing.T) {
+	current := []annotations.Handler{
+		{
+			FunctionName:   "ListUsersV2",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/v2/users"},
+		},
+		{
+			FunctionName:   "GetOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/v2/orders/{id}"},
+		},
+	}
+	deprecated := []annotations.Handler{
+		{
+			FunctionName:    "ListUsersV1",
+			PackageName:     "users",
+			DeploymentType:  annotations.DeploymentFunction,
+			Route:           annotations.Route{Method: "GET", Path: "/v1/users"},
+			Deprecated:      true,
+			DeprecationNote: "use GET /v2/users",
+		},
+		{
+			FunctionName:   "GetOrderV1",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/v1/orders/{id}"},
+			Deprecated:     true,
+		},
+	}
+
+	generate := func(handlers []annotations.Handler, gateway string, exclude bool) string {
+		outputDir := t.TempDir()
+		mustGenerate(t, NewGenerator(Config{
+			Handlers:          handlers,
+			OutputDir:         outputDir,
+			ModuleName:        "github.com/gravelight-studio/box",
+			ProjectID:         "test-project",
+			Environment:       "dev",
+			Gateway:           gateway,
+			Firebase:          true,
+			KubernetesOutput:  true,
+			ExcludeDeprecated: exclude,
+			Logger:            zap.NewNop(),
+		}))
+		return outputDir
+	}
+
+	for _, gateway := range []string{GatewayGCP, GatewayEnvoy} {
+		t.Run(gateway, func(t *testing.T) {
+			excluded := generate(append(slices.Clone(current), deprecated...), gateway, true)
+			without := generate(current, gateway, false)
+
+			// Routing matches a build without the deprecated handlers at all
+			for _, path := range []string{"gateway", "firebase.json", filepath.Join("k8s", "orders", "ingress.yaml")} {
+				drift, err := CompareOutput(filepath.Join(excluded, path), filepath.Join(without, path))
+				require.NoError(t, err)
+				assert.Empty(t, drift, "%s should leave out deprecated routes", path)
+			}
+
+			// The deprecated handlers are still deployed
+			assert.DirExists(t, filepath.Join(excluded, "functions", "list-users-v1"))
+			assert.NoDirExists(t, filepath.Join(without, "functions", "list-users-v1"))
+			entrypoint, err := os.ReadFile(filepath.Join(excluded, "containers", "orders", "main.go"))
+			require.NoError(t, err)
+			assert.Contains(t, string(entrypoint), "GetOrderV1")
+			terraform, err := os.ReadFile(filepath.Join(excluded, "terraform", "modules", "cloud-functions", "main.tf"))
+			require.NoError(t, err)
+			assert.Contains(t, string(terraform), "list-users-v1")
+		})
+	}
+
+	// Without the option, deprecated operations stay routed and are only flagged
+	included := generate(append(slices.Clone(current), deprecated...), GatewayGCP, false)
+	openAPI, err := os.ReadFile(filepath.Join(included, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(openAPI), "/v1/users:")
+	assert.Contains(t, string(openAPI), "deprecated: true")
+}
+
+func TestIntegration_DefaultTimeout(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+		{
+			FunctionName:   "ExportUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/users/export"},
+			Timeout:        2 * time.Minute,
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:       handlers,
+		OutputDir:      tmpDir,
+		ModuleName:     "github.com/gravelight-studio/box",
+		ProjectID:      "test-project",
+		DefaultTimeout: 30 * time.Second,
+		Logger:         zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// function.yaml
+	assert.Contains(t, read("functions", "list-users", "function.yaml"), "timeout: 30s")
+	assert.Contains(t, read("functions", "export-users", "function.yaml"), "timeout: 120s")
+
+	// Gateway deadline
+	openAPI := read("gateway", "openapi.yaml")
+	assert.Contains(t, openAPI, "cloudfunctions.net/list-users\n        deadline: 30.0")
+	assert.NotContains(t, openAPI, "deadline: 60.0")
+
+	// Terraform function timeout
+	terraform := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.Contains(t, terraform, "timeout             = 30\n")
+	assert.Contains(t, terraform, "timeout             = 120\n")
+	assert.NotContains(t, terraform, "timeout             = 60\n")
+}
+
+func TestIntegration_DeploymentMetadataEnv(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/accounts"},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// Function entrypoint
+	functionMain := read("functions", "create-account", "main.go")
+	assert.Contains(t, functionMain, `setDefaultEnv("BOX_FUNCTION_NAME", "CreateAccount")`)
+	assert.Contains(t, functionMain, `setDefaultEnv("BOX_ENVIRONMENT", os.Getenv("ENVIRONMENT"))`)
+	assert.Contains(t, read("functions", "create-account", "deploy.sh"), "BOX_REGION=$REGION")
+
+	// Container entrypoint
+	serverMain := read("containers", "users", "main.go")
+	assert.Contains(t, serverMain, `setDefaultEnv("BOX_SERVICE", "users")`)
+	assert.Contains(t, serverMain, `setDefaultEnv("BOX_ENVIRONMENT", os.Getenv("ENVIRONMENT"))`)
+	assert.Contains(t, serverMain, `r.Method("GET", "/users", deployed("ListUsers", http.HandlerFunc(users.ListUsers)))`)
+
+	// Terraform supplies the runtime values
+	functionsTF := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.Contains(t, functionsTF, "BOX_REGION        = var.region")
+	assert.Contains(t, functionsTF, `BOX_FUNCTION_NAME = "CreateAccount"`)
+
+	cloudRunTF := read("terraform", "modules", "cloud-run", "main.tf")
+	assert.Contains(t, cloudRunTF, "name  = \"BOX_REGION\"\n          value = var.region")
+	assert.Contains(t, cloudRunTF, "name  = \"BOX_SERVICE\"\n          value = \"users\"")
+}
+
+func TestIntegration_HandlerConstructors(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "Assets",
+			PackageName:    "assets",
+			PackagePath:    "internal/handlers/assets",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/assets"},
+			ReturnsHandler: true,
+		},
+		{
+			FunctionName:   "Stream",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users/stream"},
+			ReturnsHandler: true,
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	functionMain, err := os.ReadFile(filepath.Join(tmpDir, "functions", "assets", "main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(functionMain), "\thandler http.Handler\n")
+	assert.Contains(t, string(functionMain), "handler = assets.Assets()")
+	assert.Contains(t, string(functionMain), "handler.ServeHTTP(w, r)")
+	assert.NotContains(t, string(functionMain), "assets.Assets(w, r)")
+
+	serverMain, err := os.ReadFile(filepath.Join(tmpDir, "containers", "users", "main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(serverMain), `deployed("Stream", users.Stream())`)
+	assert.Contains(t, string(serverMain), `deployed("ListUsers", http.HandlerFunc(users.ListUsers))`)
+}
+
+func TestIntegration_TaskQueue(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/orders"},
+		},
+		{
+			FunctionName:   "ProcessOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/tasks/orders"},
+			TaskQueue:      "orders",
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// The task target is deployed but not exposed through the gateway
+	assert.DirExists(t, filepath.Join(tmpDir, "functions", "process-order"))
+	openAPI := read("gateway", "openapi.yaml")
+	assert.Contains(t, openAPI, "/orders:")
+	assert.NotContains(t, openAPI, "/tasks/orders")
+
+	// Queue and invoker identity
+	tasks := read("terraform", "modules", "cloud-tasks", "main.tf")
+	assert.Contains(t, tasks, `resource "google_cloud_tasks_queue" "queues"`)
+	assert.Contains(t, tasks, `for_each = toset(["orders"])`)
+	assert.Contains(t, tasks, `resource "google_service_account" "tasks_invoker"`)
+
+	// Only the invoker service account may call the task target
+	functions := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.Contains(t, functions, "member         = \"serviceAccount:${var.tasks_invoker_email}\"")
+	assert.Contains(t, functions, "member         = \"allUsers\"")
+	assert.Contains(t, read("terraform", "modules", "cloud-functions", "variables.tf"), `variable "tasks_invoker_email"`)
+
+	root := read("terraform", "main.tf")
+	assert.Contains(t, root, `module "cloud_tasks"`)
+	assert.Contains(t, root, "tasks_invoker_email = module.cloud_tasks.invoker_email")
+
+	outputs := read("terraform", "outputs.tf")
+	assert.Contains(t, outputs, `output "task_targets"`)
+	assert.Contains(t, outputs, `module.cloud_tasks.queue_ids["orders"]`)
+	assert.Contains(t, outputs, `module.cloud_functions.function_urls["ProcessOrder"]`)
+}
+
+func TestIntegration_Schedule(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListSessions",
+			PackageName:    "sessions",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/sessions"},
+		},
+		{
+			FunctionName:   "PurgeSessions",
+			PackageName:    "sessions",
+			DeploymentType: annotations.DeploymentFunction,
+			Timeout:        5 * time.Second,
+			Schedule:       &annotations.ScheduleConfig{Cron: "0 3 * * *", Timezone: "Europe/Berlin"},
+		},
+		{
+			FunctionName:   "SendWeeklyDigest",
+			PackageName:    "digests",
+			DeploymentType: annotations.DeploymentFunction,
+			Schedule:       &annotations.ScheduleConfig{Cron: "0 9 * * 1", Timezone: annotations.DefaultScheduleTimezone},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// The scheduled function only accepts Cloud Scheduler requests and is not routed
+	entrypoint := read("functions", "purge-sessions", "main.go")
+	assert.Contains(t, entrypoint, `r.Header.Get("X-CloudScheduler") != "true"`)
+	assert.Contains(t, entrypoint, "sessions.PurgeSessions(w, r)")
+	assert.NotContains(t, read("functions", "list-sessions", "main.go"), "X-CloudScheduler")
+	assert.Contains(t, read("functions", "purge-sessions", "deploy.sh"), "--no-allow-unauthenticated")
+	assert.NotContains(t, read("gateway", "openapi.yaml"), "PurgeSessions")
+
+	// Jobs live in their own module, fed the scheduled functions' URLs
+	scheduler := read("terraform", "modules", "cloud-scheduler", "main.tf")
+	assert.Contains(t, scheduler, `resource "google_service_account" "scheduler_invoker"`)
+	assert.Contains(t, scheduler, `resource "google_cloud_scheduler_job" "purge_sessions"`)
+	assert.Contains(t, scheduler, `schedule         = "0 3 * * *"`)
+	assert.Contains(t, scheduler, `time_zone        = "Europe/Berlin"`)
+	assert.Contains(t, scheduler, `uri         = var.function_urls["PurgeSessions"]`)
+	assert.Contains(t, scheduler, `resource "google_cloud_scheduler_job" "send_weekly_digest" {
+  name             = "wylla-${var.environment}-send-weekly-digest"
+  description      = "Runs SendWeeklyDigest on schedule"
+  region           = var.region
+  schedule         = "0 9 * * 1"
+  time_zone        = "UTC"
+  attempt_deadline = "60s"
+
+  http_target {
+    http_method = "POST"
+    uri         = var.function_urls["SendWeeklyDigest"]
+
+    oidc_token {
+      service_account_email = google_service_account.scheduler_invoker.email
+    }
+  }
+}`)
+
+	// Shorter timeouts are raised to Cloud Scheduler's minimum attempt deadline
+	assert.Contains(t, scheduler, `attempt_deadline = "15s"`)
+
+	assert.Contains(t, read("terraform", "modules", "cloud-scheduler", "variables.tf"), `variable "function_urls"`)
+	assert.Contains(t, read("terraform", "modules", "cloud-scheduler", "outputs.tf"), `"SendWeeklyDigest" = google_cloud_scheduler_job.send_weekly_digest.name`)
+
+	// Only the scheduler identity may invoke the scheduled function; routed ones stay public
+	functions := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.NotContains(t, functions, "google_cloud_scheduler_job")
+	assert.Contains(t, functions, "member         = \"serviceAccount:${var.scheduler_invoker_email}\"")
+	assert.Contains(t, functions, "member         = \"allUsers\"")
+	assert.Contains(t, read("terraform", "modules", "cloud-functions", "variables.tf"), `variable "scheduler_invoker_email"`)
+
+	// The job URLs are only handed over once the invoker bindings exist
+	assert.Contains(t, read("terraform", "modules", "cloud-functions", "outputs.tf"), `  depends_on = [
+    google_cloudfunctions_function_iam_member.purge_sessions_invoker,
+    google_cloudfunctions_function_iam_member.send_weekly_digest_invoker
+  ]`)
+
+	rootMain := read("terraform", "main.tf")
+	assert.Contains(t, rootMain, "  scheduler_invoker_email = module.scheduler.invoker_email\n")
+	assert.Contains(t, rootMain, `module "scheduler" {
+  source = "./modules/cloud-scheduler"
+
+  project_id    = var.project_id
+  region        = var.region
+  environment   = var.environment
+  function_urls = module.cloud_functions.scheduled_function_urls
+}`)
+}
+
+func TestIntegration_ScheduleModuleOmitted(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:  goldenHandlers(),
+		OutputDir: tmpDir,
+		Logger:    zap.NewNop(),
+	})
+	require.NoError(t, gen.GenerateTerraform())
+
+	assert.NoDirExists(t, filepath.Join(tmpDir, "terraform", "modules", "cloud-scheduler"))
+	rootMain, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "main.tf"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(rootMain), "scheduler")
+}
+
+func TestIntegration_PubSub(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/orders"},
+		},
+		{
+			FunctionName:   "OnOrderPlaced",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			PubSub:         &annotations.PubSubConfig{TopicID: "orders"},
+		},
+		{
+			FunctionName:   "BillOrder",
+			PackageName:    "billing",
+			DeploymentType: annotations.DeploymentFunction,
+			Timeout:        5 * time.Second,
+			PubSub:         &annotations.PubSubConfig{TopicID: "orders", SubscriptionID: "orders-billing"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// The entry point unwraps the push envelope and hands the decoded data to the subscriber
+	entrypoint := read("functions", "on-order-placed", "main.go")
+	assert.Contains(t, entrypoint, `"encoding/base64"`)
+	assert.Contains(t, entrypoint, "base64.StdEncoding.DecodeString(envelope.Message.Data)")
+	assert.Contains(t, entrypoint, "orders.OnOrderPlaced(r.Context(), payload)")
+	assert.NotContains(t, read("functions", "create-order", "main.go"), "encoding/base64")
+	assert.Contains(t, read("functions", "on-order-placed", "deploy.sh"), "--no-allow-unauthenticated")
+
+	// Subscribers are not HTTP-accessible endpoints
+	openAPI := read("gateway", "openapi.yaml")
+	assert.Contains(t, openAPI, "/orders:")
+	assert.NotContains(t, openAPI, "OnOrderPlaced")
+	assert.NotContains(t, openAPI, "BillOrder")
+
+	// One topic shared by both subscriptions
+	functions := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.Equal(t, 1, strings.Count(functions, `resource "google_pubsub_topic"`))
+	assert.Contains(t, functions, `for_each = toset(["orders"])`)
+	assert.Contains(t, functions, `resource "google_service_account" "pubsub_invoker"`)
+	assert.Contains(t, functions, "gcp-sa-pubsub.iam.gserviceaccount.com")
+
+	assert.Contains(t, functions, `resource "google_pubsub_subscription" "on_order_placed"`)
+	assert.Contains(t, functions, `name                 = "wylla-${var.environment}-on-order-placed"`)
+	assert.Contains(t, functions, `name                 = "wylla-${var.environment}-orders-billing"`)
+	assert.Contains(t, functions, `topic                = google_pubsub_topic.topics["orders"].id`)
+	assert.Contains(t, functions, "push_endpoint = google_cloudfunctions_function.bill_order.https_trigger_url")
+
+	// Ack deadlines follow the timeout, raised to Pub/Sub's 10 second minimum
+	assert.Contains(t, functions, "ack_deadline_seconds = 10")
+
+	// Only the push identity may invoke subscribers; routed functions stay public
+	assert.Contains(t, functions, "member         = \"serviceAccount:${google_service_account.pubsub_invoker.email}\"")
+	assert.Contains(t, functions, "member         = \"allUsers\"")
+}
+
+func TestIntegration_EnvVars(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:    "CreateToken",
+			PackageName:     "auth",
+			DeploymentType:  annotations.DeploymentFunction,
+			Route:           annotations.Route{Method: "POST", Path: "/tokens"},
+			RequiredEnvVars: []string{"DATABASE_URL", "JWT_SECRET"},
+		},
+		{
+			FunctionName:    "ListRooms",
+			PackageName:     "chat",
+			DeploymentType:  annotations.DeploymentContainer,
+			Route:           annotations.Route{Method: "GET", Path: "/rooms"},
+			RequiredEnvVars: []string{"REDIS_URL"},
+		},
+		{
+			FunctionName:    "StreamChat",
+			PackageName:     "chat",
+			DeploymentType:  annotations.DeploymentContainer,
+			Route:           annotations.Route{Method: "GET", Path: "/rooms/{id}/stream"},
+			RequiredEnvVars: []string{"REDIS_URL", "JWT_SECRET"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	read := func(parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(append([]string{tmpDir}, parts...)...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	functionYAML := read("functions", "create-token", "function.yaml")
+	assert.Contains(t, functionYAML, "# Required by @box:env")
+	assert.Contains(t, functionYAML, `  JWT_SECRET: "REQUIRED"`)
+	assert.Contains(t, functionYAML, `  DATABASE_URL: "REQUIRED"`)
+
+	// DATABASE_URL keeps its built-in secret; other variables get one each
+	functions := read("terraform", "modules", "cloud-functions", "main.tf")
+	assert.Contains(t, functions, "      JWT_SECRET   = data.google_secret_manager_secret_version.jwt_secret.secret_data")
+	assert.Contains(t, functions, `data "google_secret_manager_secret_version" "jwt_secret"`)
+	assert.Contains(t, functions, `secret  = "jwt-secret-${var.environment}"`)
+	assert.Equal(t, 1, strings.Count(functions, `data "google_secret_manager_secret_version" "database_url"`))
+	assert.NotContains(t, functions, "redis_url")
+
+	// The chat service gets the union of its handlers' variables
+	cloudRun := read("terraform", "modules", "cloud-run", "main.tf")
+	assert.Equal(t, 1, strings.Count(cloudRun, "REDIS_URL    = data.google_secret_manager_secret_version.redis_url.secret_data"))
+	assert.Contains(t, cloudRun, "JWT_SECRET   = data.google_secret_manager_secret_version.jwt_secret.secret_data")
+	assert.Contains(t, cloudRun, `for_each = local.secret_env["chat"]`)
+	assert.Contains(t, cloudRun, `data "google_secret_manager_secret_version" "redis_url"`)
+
+	missing, err := MissingEnvSecrets(handlers, filepath.Join(tmpDir, "terraform"))
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	// Variables declared after the output was generated have no secret yet
+	handlers[0].RequiredEnvVars = append(handlers[0].RequiredEnvVars, "STRIPE_KEY")
+	missing, err = MissingEnvSecrets(handlers, filepath.Join(tmpDir, "terraform"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"STRIPE_KEY"}, missing)
+}
+
+func TestIntegration_Secrets(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ExportOrders",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/exports"},
+			Secrets:        map[string]string{"DATABASE_URL": "warehouse-db-${env}"},
+		},
+		{
+			FunctionName:    "ListOrders",
+			PackageName:     "orders",
+			DeploymentType:  annotations.DeploymentContainer,
+			Route:           annotations.Route{Method: "GET", Path: "/orders"},
+			RequiredEnvVars: []string{"JWT_SECRET"},
+		},
+		{
+			FunctionName:   "CreateOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/orders"},
+			Secrets:        map[string]string{"DATABASE_URL": "orders-db-${env}", "STRIPE_KEY": "stripe-key"},
+		},
+	}
+
+	generate := func(t *testing.T, mode string) string {
+		tmpDir := t.TempDir()
+		mustGenerate(t, NewGenerator(Config{
+			Handlers:    handlers,
+			OutputDir:   tmpDir,
+			ModuleName:  "github.com/gravelight-studio/box",
+			ProjectID:   "test-project",
+			SecretsMode: mode,
+			Logger:      zap.NewNop(),
+		}))
+		return tmpDir
+	}
+
+	read := func(t *testing.T, parts ...string) string {
+		content, err := os.ReadFile(filepath.Join(parts...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("env", func(t *testing.T) {
+		tmpDir := generate(t, SecretsEnv)
+
+		// @box:secret replaces the function's default DATABASE_URL secret
+		functions := read(t, tmpDir, "terraform", "modules", "cloud-functions", "main.tf")
+		assert.Contains(t, functions, `environment_variables = merge(local.secret_env["ExportOrders"], {`)
+		assert.Contains(t, functions, "DATABASE_URL = data.google_secret_manager_secret_version.warehouse_db.secret_data")
+		assert.Contains(t, functions, `secret  = "warehouse-db-${var.environment}"`)
+		assert.NotContains(t, functions, `"database_url"`)
+
+		// One handler's binding applies to the whole service; each secret is read once
+		cloudRun := read(t, tmpDir, "terraform", "modules", "cloud-run", "main.tf")
+		assert.Contains(t, cloudRun, `    "orders" = {
+      DATABASE_URL = data.google_secret_manager_secret_version.orders_db.secret_data
+      JWT_SECRET   = data.google_secret_manager_secret_version.jwt_secret.secret_data
+      STRIPE_KEY   = data.google_secret_manager_secret_version.stripe_key.secret_data
+    }`)
+		assert.Contains(t, cloudRun, `secret  = "stripe-key"`)
+		assert.Equal(t, 3, strings.Count(cloudRun, `data "google_secret_manager_secret_version"`))
+		assert.Contains(t, cloudRun, `for_each = local.secret_env["orders"]`)
+
+		// Entry points keep reading the environment
+		assert.NotContains(t, read(t, tmpDir, "functions", "export-orders", "main.go"), "secretmanager")
+		assert.NotContains(t, read(t, tmpDir, "containers", "orders", "main.go"), "secretmanager")
+	})
+
+	t.Run("runtime", func(t *testing.T) {
+		tmpDir := generate(t, SecretsRuntime)
+
+		functions := read(t, tmpDir, "terraform", "modules", "cloud-functions", "main.tf")
+		assert.NotContains(t, functions, "google_secret_manager_secret_version")
+		assert.Contains(t, functions, "BOX_PROJECT       = var.project_id")
+		cloudRun := read(t, tmpDir, "terraform", "modules", "cloud-run", "main.tf")
+		assert.NotContains(t, cloudRun, "google_secret_manager_secret_version")
+		assert.Contains(t, cloudRun, `name  = "BOX_PROJECT"`)
+
+		// Nothing is missing from Terraform that leaves secrets to the entry points
+		missing, err := MissingEnvSecrets(handlers, filepath.Join(tmpDir, "terraform"))
+		require.NoError(t, err)
+		assert.Empty(t, missing)
+
+		function := read(t, tmpDir, "functions", "export-orders", "main.go")
+		assert.Contains(t, function, `"DATABASE_URL": "warehouse-db-${env}",`)
+		assert.Contains(t, function, "client.AccessSecretVersion(ctx")
+		assert.Less(t, strings.Index(function, "loadSecrets(context.Background())"), strings.Index(function, `os.Getenv("DATABASE_URL")`))
+		assert.Contains(t, read(t, tmpDir, "functions", "export-orders", "go.mod"), "cloud.google.com/go/secretmanager v1.11.5")
+
+		service := read(t, tmpDir, "containers", "orders", "main.go")
+		assert.Contains(t, service, `var secrets = map[string]string{
+	"DATABASE_URL": "orders-db-${env}",
+	"JWT_SECRET":   "jwt-secret-${env}",
+	"STRIPE_KEY":   "stripe-key",
+}`)
+
+		// The secrets map and imports are laid out as gofmt would
+		formatted, err := format.Source([]byte(function))
+		require.NoError(t, err)
+		assert.Equal(t, string(formatted), function)
+	})
+
+	t.Run("environment-only ID", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		mustGenerate(t, NewGenerator(Config{
+			Handlers: []annotations.Handler{{
+				FunctionName:   "Sync",
+				PackageName:    "sync",
+				DeploymentType: annotations.DeploymentFunction,
+				Route:          annotations.Route{Method: "POST", Path: "/sync"},
+				Secrets:        map[string]string{"TOKEN": "-${env}", "API_KEY": "secret"},
+			}},
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			ProjectID:  "test-project",
+			Logger:     zap.NewNop(),
+		}))
+
+		functions := read(t, tmpDir, "terraform", "modules", "cloud-functions", "main.tf")
+		assert.Contains(t, functions, "TOKEN        = data.google_secret_manager_secret_version.secret.secret_data")
+		assert.Contains(t, functions, `data "google_secret_manager_secret_version" "secret" {
+  secret  = "-${var.environment}"`)
+		assert.Contains(t, functions, "API_KEY      = data.google_secret_manager_secret_version.secret_2.secret_data")
+	})
+
+	t.Run("conflicting bindings", func(t *testing.T) {
+		conflicting := append(slices.Clone(handlers), annotations.Handler{
+			FunctionName:   "RefundOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/orders/{id}/refund"},
+			Secrets:        map[string]string{"DATABASE_URL": "billing-db-${env}"},
+		})
+
+		_, err := NewGenerator(Config{
+			Handlers:   conflicting,
+			OutputDir:  t.TempDir(),
+			ModuleName: "github.com/gravelight-studio/box",
+			Logger:     zap.NewNop(),
+		}).Generate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "service orders: RefundOrder reads DATABASE_URL from secret billing-db-${env} but CreateOrder reads it from orders-db-${env}")
+	})
+
+	t.Run("unknown mode", func(t *testing.T) {
+		_, err := NewGenerator(Config{Handlers: handlers, OutputDir: t.TempDir(), SecretsMode: "vault"}).Generate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unsupported secrets mode "vault"`)
+	})
+}
+
+func TestIntegration_FirebaseRewrites(t *testing.T) {
+	handlers := []annotations.Handler{
+		{FunctionName: "ListUsers", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/api/users"}},
+		{FunctionName: "GetUser", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/api/users/{id}"}},
+		{FunctionName: "GetMe", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/api/users/me"}},
+		{FunctionName: "GetOrder", PackageName: "orders", DeploymentType: annotations.DeploymentContainer, Route: annotations.Route{Method: "GET", Path: "/api/orders/{id}"}},
+		{FunctionName: "UpdateOrder", PackageName: "orders", DeploymentType: annotations.DeploymentContainer, Route: annotations.Route{Method: "PUT", Path: "/api/orders/{id}"}},
+		{FunctionName: "NightlyReport", PackageName: "reports", DeploymentType: annotations.DeploymentFunction, Schedule: &annotations.ScheduleConfig{Cron: "0 3 * * *"}},
+	}
+
+	tmpDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:    handlers,
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "europe-west1",
+		Environment: "prod",
+		Logger:      zap.NewNop(),
+		Firebase:    true,
+	})
+	mustGenerate(t, gen)
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "firebase.json"))
+	require.NoError(t, err)
+
+	var config struct {
+		Hosting struct {
+			Public   string            `json:"public"`
+			Rewrites []FirebaseRewrite `json:"rewrites"`
+		} `json:"hosting"`
+	}
+	require.NoError(t, json.Unmarshal(content, &config))
+	assert.Equal(t, "public", config.Hosting.Public)
+
+	// Every route appears once, static paths ahead of the globs that would shadow them
+	assert.Equal(t, []FirebaseRewrite{
+		{Source: "/api/users", Function: &FirebaseFunctionTarget{FunctionID: "wylla-prod-list-users", Region: "europe-west1"}},
+		{Source: "/api/users/me", Function: &FirebaseFunctionTarget{FunctionID: "wylla-prod-get-me", Region: "europe-west1"}},
+		{Source: "/api/orders/*", Run: &FirebaseRunTarget{ServiceID: "wylla-prod-orders", Region: "europe-west1"}},
+		{Source: "/api/users/*", Function: &FirebaseFunctionTarget{FunctionID: "wylla-prod-get-user", Region: "europe-west1"}},
+	}, config.Hosting.Rewrites)
+
+	// Without the option no firebase.json is written
+	plainDir := t.TempDir()
+	mustGenerate(t, NewGenerator(Config{Handlers: handlers, OutputDir: plainDir, Logger: zap.NewNop()}))
+	assert.NoFileExists(t, filepath.Join(plainDir, "firebase.json"))
+}
+
+func TestIntegration_FirebaseRewritesRejectMethodSplit(t *testing.T) {
+	handlers := []annotations.Handler{
+		{FunctionName: "GetUser", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/api/users/{id}"}},
+		{FunctionName: "DeleteUser", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "DELETE", Path: "/api/users/{id}"}},
+	}
+
+	gen := NewGenerator(Config{
+		Handlers:  handlers,
+		OutputDir: t.TempDir(),
+		Logger:    zap.NewNop(),
+		Firebase:  true,
+	})
+
+	_, err := gen.Generate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/api/users/* (GET GetUser, DELETE DeleteUser)")
+}
+
+func TestIntegration_GenerateGatewayCustomResponses(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ImportUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/users/import"},
+			Responses: map[int]string{
+				202: "Accepted for processing",
+				404: "Not found: no such user",
+			},
+		},
+		{
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users/{id}"},
+			Paginated:      true,
+			Responses:      map[int]string{200: "The user"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		ValidateOpenAPI: true,
+		Logger:          zap.NewNop(),
+	})
+
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
+
+	// Custom responses are added alongside the defaults
+	assert.Contains(t, openAPIStr, "        '202':\n          description: Accepted for processing\n")
+	assert.Contains(t, openAPIStr, "        '201':\n          description: Resource created successfully\n")
+	assert.Contains(t, openAPIStr, "$ref: '#/components/responses/BadRequest'")
+
+	// Descriptions that would break a plain YAML scalar are quoted
+	assert.Contains(t, openAPIStr, "        '404':\n          description: \"Not found: no such user\"\n")
+
+	// Overriding 200 replaces the description but keeps documented headers
+	assert.Contains(t, openAPIStr, "        '200':\n          description: The user\n          headers:\n            X-Total-Count:")
+}
+
+func TestIntegration_GenerateGatewayWithSummaryAndDescription(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/users"},
+			Summary:        "Create a user: admins only",
+			Description:    "Registers a new user.\n\nThe caller becomes the owner.",
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		Logger:          zap.NewNop(),
+		ValidateOpenAPI: true,
+	})
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(openAPIContent), "      description: |-\n        Registers a new user.\n\n        The caller becomes the owner.\n")
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Summary     string `yaml:"summary"`
+			Description string `yaml:"description"`
+		} `yaml:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal(openAPIContent, &spec))
+
+	create := spec.Paths["/api/v1/users"]["post"]
+	assert.Equal(t, "Create a user: admins only", create.Summary)
+	assert.Equal(t, "Registers a new user.\n\nThe caller becomes the owner.", create.Description)
+
+	// Without annotations the summary falls back to the route and there is no description
+	list := spec.Paths["/api/v1/users"]["get"]
+	assert.Equal(t, "GET /api/v1/users", list.Summary)
+	assert.Empty(t, list.Description)
+}
+
+func TestIntegration_GenerateGatewayWithTags(t *testing.T) {
+	// Handlers in different packages share a tag via @box:tags
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+			Tags: []string{"directory", "public"},
+		},
+		{
+			FunctionName:   "SearchAccounts",
+			PackageName:    "admin",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/search",
+			},
+			Tags: []string{"directory"},
+		},
+		{
+			FunctionName:   "GetStatus",
+			PackageName:    "status",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/status",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	err := gen.GenerateGateway()
+	require.NoError(t, err)
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
+
+	// Operation with multiple tags lists all of them
+	assert.Contains(t, openAPIStr, "operationId: ListUsers\n      summary: GET /api/v1/users\n      tags:\n        - directory\n        - public\n")
+
+	// Explicit tags replace the package-derived tag
+	assert.Contains(t, openAPIStr, "operationId: SearchAccounts\n      summary: GET /api/v1/search\n      tags:\n        - directory\n")
+	assert.NotContains(t, openAPIStr, "- name: admin\n    description")
+	assert.NotContains(t, openAPIStr, "- name: users\n    description")
+
+	// Top-level tag list is the union of all operation tags
+	assert.Contains(t, openAPIStr, "  - name: directory")
+	assert.Contains(t, openAPIStr, "  - name: public")
+	assert.Contains(t, openAPIStr, "  - name: status")
+}
+
+func TestIntegration_GenerateGatewayTagDocs(t *testing.T) {
+	handlers := []annotations.Handler{
+		{FunctionName: "ListUsers", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/users"}},
+		{FunctionName: "CreateToken", PackageName: "auth", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "POST", Path: "/tokens"}},
+		{FunctionName: "ListOrders", PackageName: "orders", DeploymentType: annotations.DeploymentContainer, Route: annotations.Route{Method: "GET", Path: "/orders"}},
+		{FunctionName: "GetStatus", PackageName: "status", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/status"}},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:        handlers,
+		OutputDir:       tmpDir,
+		ModuleName:      "github.com/gravelight-studio/box",
+		ProjectID:       "test-project",
+		ValidateOpenAPI: true,
+		Docs: config.DocsConfig{
+			Tags: []config.TagConfig{
+				{Name: "users", DisplayName: "User Accounts", Description: "Sign-up and profiles"},
+				{Name: "auth", DisplayName: "Authentication"},
+				{Name: "billing", DisplayName: "Billing"}, // No handler uses it
+			},
+			TagGroups: []config.TagGroupConfig{
+				{Name: "Accounts", Tags: []string{"users", "auth"}},
+				{Name: "Commerce", Tags: []string{"orders"}},
+			},
+		},
+		Logger: zap.NewNop(),
+	})
+
+	require.NoError(t, gen.GenerateGateway())
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
+
+	// Documented tags come first, in the configured order; the rest follow by name
+	assert.Contains(t, openAPIStr, `tags:
+  - name: users
+    x-displayName: User Accounts
+    description: Sign-up and profiles
+  - name: auth
+    x-displayName: Authentication
+    description: auth endpoints
+  - name: orders
+    description: orders endpoints
+  - name: status
+    description: status endpoints
+`)
+	assert.NotContains(t, openAPIStr, "billing")
+
+	// Tags outside the configured groups are collected last so ReDoc still shows them
+	assert.Contains(t, openAPIStr, `x-tagGroups:
+  - name: Accounts
+    tags:
+      - users
+      - auth
+  - name: Commerce
+    tags:
+      - orders
+  - name: Other
+    tags:
+      - status
+`)
+
+	doc, err := openapi3.NewLoader().LoadFromFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "User Accounts", doc.Tags.Get("users").Extensions["x-displayName"])
+	assert.Len(t, doc.Extensions["x-tagGroups"], 3)
+}
+
+func TestIntegration_GenerateGatewayErrorResponses(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/accounts/{id}",
+			},
+			Auth: annotations.AuthConfig{Type: annotations.AuthRequired},
+		},
+		{
+			FunctionName:   "RunReport",
+			PackageName:    "reports",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/reports",
+			},
+			Maintainable: true,
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:         handlers,
+		OutputDir:        tmpDir,
+		ModuleName:       "github.com/gravelight-studio/box",
+		ProjectID:        "test-project",
+		Logger:           zap.NewNop(),
+		DefaultResponses: []string{"404", "500"},
+	})
+
+	err := gen.GenerateGateway()
+	require.NoError(t, err)
+
+	openAPIContent, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
+
+	// Shared Error schema is emitted once and referenced by each error component
+	assert.Equal(t, 1, strings.Count(openAPIStr, "    Error:\n      type: object"))
+	assert.Contains(t, openAPIStr, "$ref: '#/components/schemas/Error'")
+
+	// Operations reference components instead of inlining descriptions
+	assert.Contains(t, openAPIStr, "'404':\n          $ref: '#/components/responses/NotFound'")
+	assert.Contains(t, openAPIStr, "'500':\n          $ref: '#/components/responses/InternalServerError'")
+	assert.Contains(t, openAPIStr, "'401':\n          $ref: '#/components/responses/Unauthorized'")
+	assert.NotContains(t, openAPIStr, "'400':")
+
+	// Only @box:maintainable operations document the maintenance 503
+	assert.Equal(t, 1, strings.Count(openAPIStr, "'503':\n          $ref: '#/components/responses/ServiceUnavailable'"))
+
+	// The spec must remain valid YAML with the expected structure
+	var spec struct {
+		Components struct {
+			Schemas   map[string]interface{} `yaml:"schemas"`
+			Responses map[string]interface{} `yaml:"responses"`
+		} `yaml:"components"`
+	}
+	require.NoError(t, yaml.Unmarshal(openAPIContent, &spec))
+	assert.Contains(t, spec.Components.Schemas, "Error")
+	assert.Contains(t, spec.Components.Responses, "NotFound")
+	assert.Contains(t, spec.Components.Responses, "Forbidden")
+
+	// Only 4xx/5xx codes can be defaults
+	gen = NewGenerator(Config{
+		Handlers:         handlers,
+		OutputDir:        t.TempDir(),
+		Logger:           zap.NewNop(),
+		DefaultResponses: []string{"200"},
+	})
+	assert.Error(t, gen.GenerateGateway())
+}
+
+func TestIntegration_GenerateGatewayNoHandlers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   []annotations.Handler{},
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Region:     "us-central1",
+		Logger:     zap.NewNop(),
+	})
+
+	err := gen.GenerateGateway()
+	require.NoError(t, err)
+
+	// Gateway directory should not be created or be empty
+	gatewayDir := filepath.Join(tmpDir, "gateway")
+	if _, err := os.Stat(gatewayDir); err == nil {
+		// If it exists, it should be empty
+		entries, err := os.ReadDir(gatewayDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	}
+}
+
+func TestIntegration_GenerateCompleteWithGateway(t *testing.T) {
+	// Test that Generate() creates functions, containers, and gateway
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "FunctionHandler",
+			PackageName:    "func",
+			PackagePath:    "internal/handlers/func",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/func",
+			},
+			Memory:  "256MB",
+			Timeout: 30 * time.Second,
+		},
+		{
+			FunctionName:   "ContainerHandler",
+			PackageName:    "cont",
+			PackagePath:    "internal/handlers/cont",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/cont",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:      handlers,
+		OutputDir:     tmpDir,
+		ModuleName:    "github.com/gravelight-studio/box",
+		ProjectID:     "test-project",
+		Region:        "us-central1",
+		Logger:        zap.NewNop(),
+		CleanBuildDir: true,
+	})
+
+	_, err := gen.Generate()
+	require.NoError(t, err)
+
+	// Should have all three directories
+	functionsDir := filepath.Join(tmpDir, "functions")
+	containersDir := filepath.Join(tmpDir, "containers")
+	gatewayDir := filepath.Join(tmpDir, "gateway")
+
+	assert.DirExists(t, functionsDir)
+	assert.DirExists(t, containersDir)
+	assert.DirExists(t, gatewayDir)
+
+	// Verify gateway includes both handlers
+	openAPIFile := filepath.Join(gatewayDir, "openapi.yaml")
+	openAPIContent, err := os.ReadFile(openAPIFile)
+	require.NoError(t, err)
+	openAPIStr := string(openAPIContent)
+
+	assert.Contains(t, openAPIStr, "/api/v1/func:")
+	assert.Contains(t, openAPIStr, "/api/v1/cont:")
+	assert.Contains(t, openAPIStr, "operationId: FunctionHandler")
+	assert.Contains(t, openAPIStr, "operationId: ContainerHandler")
+}
+
+// Terraform Generator Integration Tests
+
+func TestIntegration_GenerateTerraformBasic(t *testing.T) {
+	handler := annotations.Handler{
+		FunctionName:   "CreateAccount",
+		PackageName:    "accounts",
+		PackagePath:    "internal/handlers/accounts",
+		DeploymentType: annotations.DeploymentFunction,
+		Route: annotations.Route{
+			Method: "POST",
+			Path:   "/api/v1/accounts",
+		},
+		Memory:  "256MB",
+		Timeout: 30 * time.Second,
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:      []annotations.Handler{handler},
+		OutputDir:     tmpDir,
+		ModuleName:    "github.com/gravelight-studio/box",
+		ProjectID:     "test-project",
+		Region:        "us-central1",
+		Environment:   "dev",
+		Logger:        zap.NewNop(),
+		CleanBuildDir: true,
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify terraform directory was created
+	terraformDir := filepath.Join(tmpDir, "terraform")
+	assert.DirExists(t, terraformDir)
+
+	// Verify required files exist
+	mainTF := filepath.Join(terraformDir, "main.tf")
+	variablesTF := filepath.Join(terraformDir, "variables.tf")
+	outputsTF := filepath.Join(terraformDir, "outputs.tf")
+	gitignore := filepath.Join(terraformDir, ".gitignore")
+	readme := filepath.Join(terraformDir, "README.md")
+
+	assert.FileExists(t, mainTF, "main.tf should exist")
+	assert.FileExists(t, variablesTF, "variables.tf should exist")
+	assert.FileExists(t, outputsTF, "outputs.tf should exist")
+	assert.FileExists(t, gitignore, ".gitignore should exist")
+	assert.FileExists(t, readme, "README.md should exist")
+
+	// Verify main.tf contains expected content
+	mainContent, err := os.ReadFile(mainTF)
+	require.NoError(t, err)
+	mainStr := string(mainContent)
+
+	assert.Contains(t, mainStr, "terraform {")
+	assert.Contains(t, mainStr, "required_version = \">= 1.0\"")
+	assert.Contains(t, mainStr, "required_providers {")
+	assert.Contains(t, mainStr, "google = {")
+	assert.Contains(t, mainStr, "module \"cloud_functions\" {")
+	assert.Contains(t, mainStr, "source = \"./modules/cloud-functions\"")
+
+	// Verify .gitignore contains Terraform files
+	gitignoreContent, err := os.ReadFile(gitignore)
+	require.NoError(t, err)
+	gitignoreStr := string(gitignoreContent)
+
+	assert.Contains(t, gitignoreStr, "*.tfstate")
+	assert.Contains(t, gitignoreStr, ".terraform/")
+}
+
+func TestIntegration_GenerateTerraformCloudFunctions(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/accounts",
+			},
+			Memory:  "256MB",
+			Timeout: 30 * time.Second,
+		},
+		{
+			FunctionName:   "GetAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/accounts/{id}",
+			},
+			Memory:  "128MB",
+			Timeout: 15 * time.Second,
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    handlers,
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify cloud-functions module was created
+	modulePath := filepath.Join(tmpDir, "terraform", "modules", "cloud-functions", "main.tf")
+	assert.FileExists(t, modulePath)
+
+	moduleContent, err := os.ReadFile(modulePath)
+	require.NoError(t, err)
+	moduleStr := string(moduleContent)
+
+	// Should have service account
+	assert.Contains(t, moduleStr, "resource \"google_service_account\" \"accounts\" {")
+	assert.Contains(t, moduleStr, "account_id   = \"wylla-accounts-$${var.environment}\"")
+
+	// Should have IAM bindings
+	assert.Contains(t, moduleStr, "resource \"google_project_iam_member\" \"accounts_cloudsql\" {")
+	assert.Contains(t, moduleStr, "role    = \"roles/cloudsql.client\"")
+
+	// Should have storage bucket for function source
+	assert.Contains(t, moduleStr, "resource \"google_storage_bucket\" \"functions\" {")
+
+	// Should have function resources
+	assert.Contains(t, moduleStr, "resource \"google_cloudfunctions_function\" \"create_account\" {")
+	assert.Contains(t, moduleStr, "name                  = \"wylla-$${var.environment}-create-account\"")
+	assert.Contains(t, moduleStr, "runtime              = \"go122\"")
+	assert.Contains(t, moduleStr, "available_memory_mb = 256")
+	assert.Contains(t, moduleStr, "timeout             = 30")
+}
+
+func TestIntegration_GenerateTerraformCloudRun(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "GetUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/users",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    handlers,
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "staging",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify cloud-run module was created
+	modulePath := filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf")
+	assert.FileExists(t, modulePath)
+
+	moduleContent, err := os.ReadFile(modulePath)
+	require.NoError(t, err)
+	moduleStr := string(moduleContent)
+
+	// Should have service account for users
+	assert.Contains(t, moduleStr, "resource \"google_service_account\" \"users\" {")
+	assert.Contains(t, moduleStr, "account_id   = \"wylla-users-$${var.environment}\"")
+
+	// Should have Cloud Run service
+	assert.Contains(t, moduleStr, "resource \"google_cloud_run_service\" \"users\" {")
+	assert.Contains(t, moduleStr, "name     = \"wylla-$${var.environment}-users\"")
+	assert.Contains(t, moduleStr, "location = var.region")
+
+	// Should have container config
+	assert.Contains(t, moduleStr, "image = \"gcr.io/$${var.project_id}/users:latest\"")
+
+	// Should have IAM for public access
+	assert.Contains(t, moduleStr, "resource \"google_cloud_run_service_iam_member\" \"users_invoker\" {")
+	assert.Contains(t, moduleStr, "role     = \"roles/run.invoker\"")
+}
+
+func TestIntegration_GenerateTerraformCloudRunProbes(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+		},
+		{
+			FunctionName:   "GetQuote",
+			PackageName:    "pricing",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/quote"},
+			Timeout:        4 * time.Second,
+		},
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:  handlers,
+			OutputDir: tmpDir,
+			Logger:    zap.NewNop(),
+		})
+		require.NoError(t, gen.GenerateTerraform())
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf"))
+		require.NoError(t, err)
+		mainTf := string(content)
+
+		// Startup probe allows the default 240s grace period: 24 x 10s
+		assert.Contains(t, mainTf, `        startup_probe {
+          period_seconds    = 10
+          timeout_seconds   = 10
+          failure_threshold = 24
+
+          http_get {
+            path = "/health"
+          }
+        }`)
+
+		assert.Contains(t, mainTf, `        liveness_probe {
+          period_seconds    = 10
+          timeout_seconds   = 10
+          failure_threshold = 3
+
+          http_get {
+            path = "/health"
+          }
+        }`)
+
+		// The pricing service's 4s handler timeout bounds its probe timeout
+		pricing := mainTf[strings.Index(mainTf, `resource "google_cloud_run_service" "pricing"`):]
+		assert.Contains(t, pricing, "timeout_seconds   = 4\n")
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:  handlers,
+			OutputDir: tmpDir,
+			Logger:    zap.NewNop(),
+			Probes: ProbeConfig{
+				Period:           30 * time.Second,
+				Timeout:          5 * time.Second,
+				FailureThreshold: 5,
+				StartupGrace:     10 * time.Minute,
+			},
+		})
+		require.NoError(t, gen.GenerateTerraform())
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf"))
+		require.NoError(t, err)
+		mainTf := string(content)
+
+		assert.Equal(t, 4, strings.Count(mainTf, "period_seconds    = 30\n"))
+		assert.Equal(t, 4, strings.Count(mainTf, "timeout_seconds   = 5\n"))
+		assert.Equal(t, 2, strings.Count(mainTf, "failure_threshold = 20\n"))
+		assert.Equal(t, 2, strings.Count(mainTf, "failure_threshold = 5\n"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		gen := NewGenerator(Config{
+			Handlers:  handlers,
+			OutputDir: t.TempDir(),
+			Logger:    zap.NewNop(),
+			Probes:    ProbeConfig{Period: 10 * time.Second, Timeout: 20 * time.Second},
+		})
+
+		err := gen.GenerateTerraform()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "probe timeout")
+	})
+}
+
+func TestIntegration_GenerateTerraformCPUAllocation(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+		},
+		{
+			FunctionName:   "SendDigest",
+			PackageName:    "mailer",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/digests"},
+			CPUAlways:      true,
+		},
+		{
+			FunctionName:   "GetQuote",
+			PackageName:    "pricing",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/quote"},
+			CPUThrottled:   true,
+		},
+	}
+
+	generate := func(t *testing.T, handlers []annotations.Handler, cloudRunV2 bool) (string, error) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			Logger:     zap.NewNop(),
+			CloudRunV2: cloudRunV2,
+		})
+		if err := gen.GenerateTerraform(); err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf"))
+		require.NoError(t, err)
+		return string(content), nil
+	}
+
+	// service returns one service's resource block from a module
+	service := func(mainTf, resource, name string) string {
+		start := strings.Index(mainTf, fmt.Sprintf("resource %q %q", resource, name))
+		require.GreaterOrEqual(t, start, 0)
+		end := strings.Index(mainTf[start:], "\n}\n")
+		return mainTf[start : start+end]
+	}
+
+	t.Run("v1 annotation", func(t *testing.T) {
+		mainTf, err := generate(t, handlers, false)
+		require.NoError(t, err)
+
+		assert.Contains(t, service(mainTf, "google_cloud_run_service", "mailer"), `        "autoscaling.knative.dev/maxScale"  = "10"
+        "run.googleapis.com/client-name"    = "terraform"
+        "run.googleapis.com/cpu-throttling" = "false"`)
+		assert.Contains(t, service(mainTf, "google_cloud_run_service", "pricing"), `"run.googleapis.com/cpu-throttling" = "true"`)
+		assert.NotContains(t, service(mainTf, "google_cloud_run_service", "users"), "cpu-throttling")
+	})
+
+	t.Run("v2 cpu_idle", func(t *testing.T) {
+		mainTf, err := generate(t, handlers, true)
+		require.NoError(t, err)
+
+		assert.Contains(t, service(mainTf, "google_cloud_run_v2_service", "mailer"), `          memory = "512Mi"
+        }
+        cpu_idle = false
+      }`)
+		assert.Contains(t, service(mainTf, "google_cloud_run_v2_service", "pricing"), "cpu_idle = true\n")
+		assert.NotContains(t, service(mainTf, "google_cloud_run_v2_service", "users"), "cpu_idle")
+	})
+
+	t.Run("conflicting handlers in one service", func(t *testing.T) {
+		conflicting := append(slices.Clone(handlers), annotations.Handler{
+			FunctionName:   "PreviewDigest",
+			PackageName:    "mailer",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/digests/preview"},
+			CPUThrottled:   true,
+		})
+
+		_, err := generate(t, conflicting, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "service mailer: SendDigest uses @box:cpu-always but PreviewDigest uses @box:cpu-throttled")
+	})
+}
+
+func TestIntegration_GenerateScaling(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+			MinInstances:   2,
+			MaxInstances:   50,
+		},
+		{
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			PackagePath:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users/{id}"},
+			MinInstances:   3,
+		},
+		{
+			// Keeping more warm than the default cap raises the cap
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			PackagePath:    "chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/chat"},
+			MinInstances:   15,
+		},
+		{
+			FunctionName:   "ListOrders",
+			PackageName:    "orders",
+			PackagePath:    "orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/orders"},
+		},
+		{
+			FunctionName:   "SendEmail",
+			PackageName:    "mailer",
+			PackagePath:    "mailer",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/email"},
+			MinInstances:   1,
+			MaxInstances:   5,
+		},
+	}
+
+	generate := func(t *testing.T, handlers []annotations.Handler, cloudRunV2 bool) (string, error) {
+		tmpDir := t.TempDir()
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "example.com/shop",
+			Logger:     zap.NewNop(),
+			CloudRunV2: cloudRunV2,
+		})
+		_, err := gen.Generate()
+		return tmpDir, err
+	}
+
+	read := func(t *testing.T, path ...string) string {
+		content, err := os.ReadFile(filepath.Join(path...))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// service returns one service's resource block from a module
+	service := func(mainTf, resource, name string) string {
+		start := strings.Index(mainTf, fmt.Sprintf("resource %q %q", resource, name))
+		require.GreaterOrEqual(t, start, 0)
+		end := strings.Index(mainTf[start:], "\n}\n")
+		return mainTf[start : start+end]
+	}
+
+	t.Run("v1 annotations", func(t *testing.T) {
+		dir, err := generate(t, handlers, false)
+		require.NoError(t, err)
+		mainTf := read(t, dir, "terraform", "modules", "cloud-run", "main.tf")
+
+		assert.Contains(t, service(mainTf, "google_cloud_run_service", "users"), `        "autoscaling.knative.dev/maxScale" = "50"
+        "autoscaling.knative.dev/minScale" = "3"
+        "run.googleapis.com/client-name"   = "terraform"`)
+		assert.Contains(t, service(mainTf, "google_cloud_run_service", "chat"), `"autoscaling.knative.dev/maxScale" = "15"`)
+		orders := service(mainTf, "google_cloud_run_service", "orders")
+		assert.Contains(t, orders, `"autoscaling.knative.dev/maxScale" = "10"`)
+		assert.NotContains(t, orders, "minScale")
+	})
+
+	t.Run("v2 scaling block", func(t *testing.T) {
+		dir, err := generate(t, handlers, true)
+		require.NoError(t, err)
+		mainTf := read(t, dir, "terraform", "modules", "cloud-run", "main.tf")
+
+		assert.Contains(t, service(mainTf, "google_cloud_run_v2_service", "users"), `    scaling {
+      min_instance_count = 3
+      max_instance_count = 50
+    }`)
+		assert.Contains(t, service(mainTf, "google_cloud_run_v2_service", "orders"), `    scaling {
+      max_instance_count = 10
+    }`)
+	})
+
+	t.Run("functions and entry points", func(t *testing.T) {
+		dir, err := generate(t, handlers, false)
+		require.NoError(t, err)
+
+		assert.Contains(t, read(t, dir, "functions", "send-email", "function.yaml"), "timeout: 60s\nminInstances: 1\nmaxInstances: 5\n")
+		assert.Contains(t, service(read(t, dir, "terraform", "modules", "cloud-functions", "main.tf"), "google_cloudfunctions_function", "send_email"),
+			"  min_instances       = 1\n  max_instances       = 5\n")
+
+		assert.Contains(t, read(t, dir, "containers", "users", "main.go"), "// Scaling: 3 to 50 instances")
+		assert.NotContains(t, read(t, dir, "containers", "orders", "main.go"), "// Scaling:")
+	})
+
+	t.Run("warm instances above a handler's cap", func(t *testing.T) {
+		conflicting := append(slices.Clone(handlers), annotations.Handler{
+			FunctionName:   "ListRooms",
+			PackageName:    "chat",
+			PackagePath:    "chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/chat/rooms"},
+			MaxInstances:   8,
+		})
+
+		_, err := generate(t, conflicting, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "service chat: StreamChat keeps 15 instances warm but the service allows at most 8")
+	})
+}
+
+func TestIntegration_GenerateTerraformMultiRegion(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+		{
+			FunctionName:   "GetUser",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users/{id}",
+			},
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/chat/{id}/stream",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    handlers,
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Regions:     []string{"us-central1", "europe-west1"},
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	moduleDir := filepath.Join(tmpDir, "terraform", "modules", "cloud-run")
+
+	// Each service is created once per region via for_each
+	mainContent, err := os.ReadFile(filepath.Join(moduleDir, "main.tf"))
+	require.NoError(t, err)
+	mainStr := string(mainContent)
+
+	assert.Contains(t, mainStr, "resource \"google_cloud_run_service\" \"users\" {\n  for_each = toset(var.regions)")
+	assert.Contains(t, mainStr, "resource \"google_cloud_run_service\" \"chat\" {\n  for_each = toset(var.regions)")
+	assert.Contains(t, mainStr, "location = each.value")
+	assert.NotContains(t, mainStr, "location = var.region")
+	assert.Contains(t, mainStr, "for_each = google_cloud_run_service.users")
+
+	// Global load balancer routes to per-region serverless NEGs
+	lbContent, err := os.ReadFile(filepath.Join(moduleDir, "load_balancer.tf"))
+	require.NoError(t, err)
+	lbStr := string(lbContent)
+
+	assert.Contains(t, lbStr, "resource \"google_compute_region_network_endpoint_group\" \"users\"")
+	assert.Contains(t, lbStr, "service = google_cloud_run_service.users[each.value].name")
+	assert.Contains(t, lbStr, "resource \"google_compute_backend_service\" \"chat\"")
+	assert.Contains(t, lbStr, "resource \"google_compute_global_forwarding_rule\" \"lb\"")
+	assert.Contains(t, lbStr, "paths   = [\"/api/v1/users\", \"/api/v1/users/*\"]")
+	assert.Contains(t, lbStr, "paths   = [\"/api/v1/chat/*\"]")
+
+	// Region list flows through variables and tfvars
+	varsContent, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "variables.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(varsContent), "variable \"regions\"")
+	assert.Contains(t, string(varsContent), "variable \"lb_domain\"")
+
+	tfvarsContent, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "environments", "dev.tfvars"))
+	require.NoError(t, err)
+	assert.Contains(t, string(tfvarsContent), "regions   = [\"us-central1\", \"europe-west1\"]")
+
+	rootMain, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "main.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(rootMain), "regions     = var.regions")
+}
+
+func TestIntegration_GenerateTerraformCloudRunV2(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:    "ListUsers",
+			PackageName:     "users",
+			DeploymentType:  annotations.DeploymentContainer,
+			Route:           annotations.Route{Method: "GET", Path: "/api/v1/users"},
+			RequiredEnvVars: []string{"JWT_SECRET"},
+		},
+	}
+
+	t.Run("single region", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			ProjectID:  "test-project",
+			Logger:     zap.NewNop(),
+			CloudRunV2: true,
+		})
+		require.NoError(t, gen.GenerateTerraform())
+
+		moduleDir := filepath.Join(tmpDir, "terraform", "modules", "cloud-run")
+		content, err := os.ReadFile(filepath.Join(moduleDir, "main.tf"))
+		require.NoError(t, err)
+		mainTf := string(content)
+
+		assert.Contains(t, mainTf, `resource "google_cloud_run_v2_service" "users" {`)
+		assert.NotContains(t, mainTf, `"google_cloud_run_service"`)
+		assert.NotContains(t, mainTf, "spec {")
+		assert.NotContains(t, mainTf, "metadata {")
+
+		// Service account, concurrency and scaling move onto the revision template
+		assert.Contains(t, mainTf, `    service_account                  = google_service_account.users.email
+    max_instance_request_concurrency = 80
+
+    scaling {
+      max_instance_count = 10
+    }`)
+		assert.Contains(t, mainTf, `      resources {
+        limits = {
+          cpu    = "1000m"
+          memory = "512Mi"
+        }
+      }`)
+		assert.Contains(t, mainTf, `      startup_probe {
+        period_seconds    = 10
+        timeout_seconds   = 10
+        failure_threshold = 24
+
+        http_get {
+          path = "/health"
+        }
+      }`)
+		assert.Contains(t, mainTf, "liveness_probe {")
+		assert.Contains(t, mainTf, `  traffic {
+    type    = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+    percent = 100
+  }`)
+
+		// The v2 IAM resource names the service with "name" rather than "service"
+		assert.Contains(t, mainTf, `resource "google_cloud_run_v2_service_iam_member" "users_invoker" {
+  name     = google_cloud_run_v2_service.users.name
+  location = google_cloud_run_v2_service.users.location`)
+
+		// @box:env secrets are still read through data sources, so MissingEnvSecrets sees them
+		assert.Contains(t, mainTf, `JWT_SECRET   = data.google_secret_manager_secret_version.jwt_secret.secret_data`)
+		missing, err := MissingEnvSecrets(handlers, filepath.Join(tmpDir, "terraform"))
+		require.NoError(t, err)
+		assert.Empty(t, missing)
+
+		outputs, err := os.ReadFile(filepath.Join(moduleDir, "outputs.tf"))
+		require.NoError(t, err)
+		assert.Contains(t, string(outputs), "value       = google_cloud_run_v2_service.users.uri")
+		assert.NotContains(t, string(outputs), "status[0].url")
+	})
+
+	t.Run("multi region", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			Regions:    []string{"us-central1", "europe-west1"},
+			Logger:     zap.NewNop(),
+			CloudRunV2: true,
+		})
+		require.NoError(t, gen.GenerateTerraform())
+
+		moduleDir := filepath.Join(tmpDir, "terraform", "modules", "cloud-run")
+		mainTf, err := os.ReadFile(filepath.Join(moduleDir, "main.tf"))
+		require.NoError(t, err)
+		assert.Contains(t, string(mainTf), "resource \"google_cloud_run_v2_service\" \"users\" {\n  for_each = toset(var.regions)")
+		assert.Contains(t, string(mainTf), "for_each = google_cloud_run_v2_service.users\n\n  name     = each.value.name")
+
+		outputs, err := os.ReadFile(filepath.Join(moduleDir, "outputs.tf"))
+		require.NoError(t, err)
+		assert.Contains(t, string(outputs), "{ for region, service in google_cloud_run_v2_service.users : region => service.uri }")
+
+		lb, err := os.ReadFile(filepath.Join(moduleDir, "load_balancer.tf"))
+		require.NoError(t, err)
+		assert.Contains(t, string(lb), "service = google_cloud_run_v2_service.users[each.value].name")
+	})
+}
+
+func TestIntegration_GenerateTerraformCanary(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users"},
+		},
+	}
+
+	trafficBlocks := regexp.MustCompile(`(?m)^  (dynamic "traffic"|traffic) \{`)
+
+	generate := func(t *testing.T, config Config) string {
+		t.Helper()
+		config.Handlers = handlers
+		config.OutputDir = t.TempDir()
+		config.ProjectID = "test-project"
+		config.Logger = zap.NewNop()
+		require.NoError(t, NewGenerator(config).GenerateTerraform())
+		return filepath.Join(config.OutputDir, "terraform")
+	}
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("legacy resource", func(t *testing.T) {
+		terraformDir := generate(t, Config{CanaryPercent: 10})
+		mainTf := read(t, filepath.Join(terraformDir, "modules", "cloud-run", "main.tf"))
+
+		assert.Len(t, trafficBlocks.FindAllString(mainTf, -1), 2, "stable and canary traffic blocks")
+		assert.Contains(t, mainTf, `  dynamic "traffic" {
+    for_each = lookup(var.stable_revisions, "users", "") == "" ? [] : [var.stable_revisions["users"]]
+    content {
+      percent       = 100 - var.canary_percent
+      revision_name = traffic.value
+      tag           = "stable"
+    }
+  }`)
+		assert.Contains(t, mainTf, `  traffic {
+    percent         = lookup(var.stable_revisions, "users", "") == "" ? 100 : var.canary_percent
+    latest_revision = true
+    tag             = "canary"
+  }`)
+
+		variablesTf := read(t, filepath.Join(terraformDir, "modules", "cloud-run", "variables.tf"))
+		assert.Contains(t, variablesTf, `variable "canary_percent" {`)
+		assert.Contains(t, variablesTf, "default     = 10")
+		assert.Contains(t, variablesTf, `variable "stable_revisions" {`)
+
+		rootMain := read(t, filepath.Join(terraformDir, "main.tf"))
+		assert.Contains(t, rootMain, "  canary_percent   = var.canary_percent\n  stable_revisions = var.stable_revisions")
+		assert.Contains(t, read(t, filepath.Join(terraformDir, "variables.tf")), `variable "stable_revisions" {`)
+		assert.Contains(t, read(t, filepath.Join(terraformDir, "environments", "dev.tfvars")), `#   users = "wylla-dev-users-00001-abc"`)
+		assert.Contains(t, read(t, filepath.Join(terraformDir, "README.md")), "### Canary Rollouts")
+	})
+
+	t.Run("v2 resource", func(t *testing.T) {
+		terraformDir := generate(t, Config{CanaryPercent: 25, CloudRunV2: true})
+		mainTf := read(t, filepath.Join(terraformDir, "modules", "cloud-run", "main.tf"))
+
+		assert.Len(t, trafficBlocks.FindAllString(mainTf, -1), 2, "stable and canary traffic blocks")
+		assert.Contains(t, mainTf, `      type     = "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION"
+      revision = traffic.value
+      percent  = 100 - var.canary_percent
+      tag      = "stable"`)
+		assert.Contains(t, mainTf, `  traffic {
+    type    = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+    percent = lookup(var.stable_revisions, "users", "") == "" ? 100 : var.canary_percent
+    tag     = "canary"
+  }`)
+		assert.Contains(t, read(t, filepath.Join(terraformDir, "modules", "cloud-run", "variables.tf")), "default     = 25")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		terraformDir := generate(t, Config{})
+		mainTf := read(t, filepath.Join(terraformDir, "modules", "cloud-run", "main.tf"))
+
+		assert.Len(t, trafficBlocks.FindAllString(mainTf, -1), 1)
+		assert.NotContains(t, mainTf, "canary")
+		assert.NotContains(t, read(t, filepath.Join(terraformDir, "variables.tf")), "stable_revisions")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, config := range []Config{
+			{CanaryPercent: 100},
+			{CanaryPercent: -5},
+		} {
+			config.Handlers = handlers
+			config.OutputDir = t.TempDir()
+			config.Logger = zap.NewNop()
+			err := NewGenerator(config).GenerateTerraform()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "must be between 1 and 99")
+		}
+
+		err := NewGenerator(Config{
+			Handlers:      handlers,
+			OutputDir:     t.TempDir(),
+			Regions:       []string{"us-central1", "europe-west1"},
+			CanaryPercent: 10,
+			Logger:        zap.NewNop(),
+		}).GenerateTerraform()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not supported for multi-region services")
+	})
+}
+
+func TestIntegration_GenerateTerraformStateBucket(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+		},
+	}
+
+	generate := func(t *testing.T, stateBucket string) string {
+		t.Helper()
+		outputDir := t.TempDir()
+		require.NoError(t, NewGenerator(Config{
+			Handlers:    handlers,
+			OutputDir:   outputDir,
+			ProjectID:   "test-project",
+			Region:      "europe-west1",
+			Environment: "staging",
+			StateBucket: stateBucket,
+			Logger:      zap.NewNop(),
+		}).GenerateTerraform())
+		return filepath.Join(outputDir, "terraform")
+	}
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("local state", func(t *testing.T) {
+		terraformDir := generate(t, "")
+
+		assert.NotContains(t, read(t, filepath.Join(terraformDir, "main.tf")), "backend")
+		assert.NoFileExists(t, filepath.Join(terraformDir, "setup-state.sh"))
+		assert.NotContains(t, read(t, filepath.Join(terraformDir, "README.md")), "### Remote State")
+	})
+
+	t.Run("GCS backend", func(t *testing.T) {
+		terraformDir := generate(t, "acme-terraform-state")
+
+		assert.Contains(t, read(t, filepath.Join(terraformDir, "main.tf")), `  backend "gcs" {
+    bucket = "acme-terraform-state"
+    prefix = "staging/terraform.state"
+  }
+}`)
+
+		scriptPath := filepath.Join(terraformDir, "setup-state.sh")
+		script := read(t, scriptPath)
+		assert.Contains(t, script, `BUCKET="acme-terraform-state"`)
+		assert.Contains(t, script, `PROJECT_ID="${PROJECT_ID:-test-project}"`)
+		assert.Contains(t, script, `gsutil mb -p "$PROJECT_ID" -l "$LOCATION" -b on "gs://$BUCKET"`)
+		assert.Contains(t, script, `gsutil versioning set on "gs://$BUCKET"`)
+		info, err := os.Stat(scriptPath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+		readme := read(t, filepath.Join(terraformDir, "README.md"))
+		assert.Contains(t, readme, "### Remote State")
+		assert.Contains(t, readme, "`acme-terraform-state` bucket")
+		assert.NotContains(t, readme, "uses **local state**")
+	})
+}
+
+func TestIntegration_GenerateTerraformSingleRegionHasNoLoadBalancer(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		Regions:    []string{"europe-west1"},
+		Logger:     zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "load_balancer.tf"))
+
+	mainContent, err := os.ReadFile(filepath.Join(tmpDir, "terraform", "modules", "cloud-run", "main.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mainContent), "location = var.region")
+	assert.NotContains(t, string(mainContent), "for_each = toset(var.regions)")
+}
+
+func TestIntegration_GenerateTerraformAPIGateway(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/accounts",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    handlers,
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "production",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify api-gateway module was created
+	modulePath := filepath.Join(tmpDir, "terraform", "modules", "api-gateway", "main.tf")
+	assert.FileExists(t, modulePath)
+
+	moduleContent, err := os.ReadFile(modulePath)
+	require.NoError(t, err)
+	moduleStr := string(moduleContent)
+
+	// Should have API resource
+	assert.Contains(t, moduleStr, "resource \"google_api_gateway_api\" \"api\" {")
+	assert.Contains(t, moduleStr, "api_id       = \"wylla-api-$${var.environment}\"")
+
+	// Should have API config
+	assert.Contains(t, moduleStr, "resource \"google_api_gateway_api_config\" \"api_config\" {")
+	assert.Contains(t, moduleStr, "api           = google_api_gateway_api.api.api_id")
+
+	// Should reference OpenAPI spec
+	assert.Contains(t, moduleStr, "openapi_documents {")
+	assert.Contains(t, moduleStr, "path     = \"openapi.yaml\"")
+	assert.Contains(t, moduleStr, "contents = filebase64(\"$${path.module}/../../gateway/openapi.yaml\")")
+
+	// Should have Gateway resource
+	assert.Contains(t, moduleStr, "resource \"google_api_gateway_gateway\" \"gateway\" {")
+	assert.Contains(t, moduleStr, "gateway_id   = \"wylla-gateway-$${var.environment}\"")
+}
+
+func TestIntegration_GenerateTerraformNetworking(t *testing.T) {
+	handler := annotations.Handler{
+		FunctionName:   "TestHandler",
+		PackageName:    "test",
+		DeploymentType: annotations.DeploymentFunction,
+		Route: annotations.Route{
+			Method: "GET",
+			Path:   "/test",
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    []annotations.Handler{handler},
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify networking module was created
+	modulePath := filepath.Join(tmpDir, "terraform", "modules", "networking", "main.tf")
+	assert.FileExists(t, modulePath)
+
+	moduleContent, err := os.ReadFile(modulePath)
+	require.NoError(t, err)
+	moduleStr := string(moduleContent)
+
+	// Should have VPC
+	assert.Contains(t, moduleStr, "resource \"google_compute_network\" \"vpc\" {")
+	assert.Contains(t, moduleStr, "name                    = \"wylla-vpc-$${var.environment}\"")
+
+	// Should have subnet
+	assert.Contains(t, moduleStr, "resource \"google_compute_subnetwork\" \"subnet\" {")
+	assert.Contains(t, moduleStr, "ip_cidr_range = \"10.0.0.0/24\"")
+
+	// Should have VPC connector
+	assert.Contains(t, moduleStr, "resource \"google_vpc_access_connector\" \"connector\" {")
+	assert.Contains(t, moduleStr, "name          = \"wylla-connector-$${var.environment}\"")
+
+	// Should have Cloud SQL instance
+	assert.Contains(t, moduleStr, "resource \"google_sql_database_instance\" \"main\" {")
+	assert.Contains(t, moduleStr, "name             = \"wylla-db-$${var.environment}\"")
+	assert.Contains(t, moduleStr, "database_version = \"POSTGRES_15\"")
+}
+
+func TestIntegration_GenerateTerraformEnvironmentVariables(t *testing.T) {
+	handler := annotations.Handler{
+		FunctionName:   "TestHandler",
+		PackageName:    "test",
+		DeploymentType: annotations.DeploymentFunction,
+		Route: annotations.Route{
+			Method: "GET",
+			Path:   "/test",
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    []annotations.Handler{handler},
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Verify environment-specific tfvars files exist
+	envDir := filepath.Join(tmpDir, "terraform", "environments")
+	assert.DirExists(t, envDir)
+
+	devTfvars := filepath.Join(envDir, "dev.tfvars")
+	stagingTfvars := filepath.Join(envDir, "staging.tfvars")
+	productionTfvars := filepath.Join(envDir, "production.tfvars")
+
+	assert.FileExists(t, devTfvars, "dev.tfvars should exist")
+	assert.FileExists(t, stagingTfvars, "staging.tfvars should exist")
+	assert.FileExists(t, productionTfvars, "production.tfvars should exist")
+
+	// Verify dev.tfvars content
+	devContent, err := os.ReadFile(devTfvars)
+	require.NoError(t, err)
+	devStr := string(devContent)
+
+	assert.Contains(t, devStr, "environment = \"dev\"")
+	assert.Contains(t, devStr, "project_id  = \"YOUR_PROJECT_ID\"") // Template generates placeholder
+	assert.Contains(t, devStr, "region      = \"us-central1\"")
+	assert.Contains(t, devStr, "database_password = \"CHANGE_ME_DEV\"")
+
+	// Verify staging.tfvars content
+	stagingContent, err := os.ReadFile(stagingTfvars)
+	require.NoError(t, err)
+	stagingStr := string(stagingContent)
+
+	assert.Contains(t, stagingStr, "environment = \"staging\"")
+	assert.Contains(t, stagingStr, "database_password = \"CHANGE_ME_STAGING\"")
+
+	// Verify production.tfvars content
+	productionContent, err := os.ReadFile(productionTfvars)
+	require.NoError(t, err)
+	productionStr := string(productionContent)
+
+	assert.Contains(t, productionStr, "environment = \"production\"")
+	assert.Contains(t, productionStr, "database_password = \"CHANGE_ME_PRODUCTION\"")
+}
+
+func TestIntegration_GenerateTerraformSelectEnvScript(t *testing.T) {
+	handler := annotations.Handler{
+		FunctionName:   "TestHandler",
+		PackageName:    "test",
+		DeploymentType: annotations.DeploymentFunction,
+		Route:          annotations.Route{Method: "GET", Path: "/test"},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   []annotations.Handler{handler},
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	require.NoError(t, gen.GenerateTerraform())
+
+	scriptPath := filepath.Join(tmpDir, "terraform", "select-env.sh")
+	info, err := os.Stat(scriptPath)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100, "select-env.sh should be executable")
+
+	content, err := os.ReadFile(scriptPath)
+	require.NoError(t, err)
+	script := string(content)
+
+	// Only the environments that have tfvars files are accepted
+	assert.Contains(t, script, `ENVIRONMENTS=("dev" "staging" "production")`)
+	assert.Contains(t, script, `VAR_FILE="environments/$ENVIRONMENT.tfvars"`)
+
+	// Each environment gets its own workspace and always its own tfvars
+	assert.Contains(t, script, `terraform workspace select "$ENVIRONMENT" 2>/dev/null || terraform workspace new "$ENVIRONMENT"`)
+	assert.Contains(t, script, `terraform "$ACTION" -var-file="$VAR_FILE" "$@"`)
+}
+
+func TestIntegration_GenerateTerraformNoHandlers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:    []annotations.Handler{},
+		OutputDir:   tmpDir,
+		ModuleName:  "github.com/gravelight-studio/box",
+		ProjectID:   "test-project",
+		Region:      "us-central1",
+		Environment: "dev",
+		Logger:      zap.NewNop(),
+	})
+
+	err := gen.GenerateTerraform()
+	require.NoError(t, err)
+
+	// Terraform directory should not be created or be empty
+	terraformDir := filepath.Join(tmpDir, "terraform")
+	if _, err := os.Stat(terraformDir); err == nil {
+		// If it exists, check that basic files exist but modules are minimal
+		mainTF := filepath.Join(terraformDir, "main.tf")
+		if _, err := os.Stat(mainTF); err == nil {
+			mainContent, _ := os.ReadFile(mainTF)
+			mainStr := string(mainContent)
+			// Should still have terraform block but no handlers
+			assert.Contains(t, mainStr, "terraform {")
+		}
+	}
+}
+
+func TestIntegration_GenerateTerraformComplete(t *testing.T) {
+	// Test complete Terraform generation with mixed handlers
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/accounts",
+			},
+			Memory:  "256MB",
+			Timeout: 30 * time.Second,
+		},
+		{
+			FunctionName:   "GetUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/users",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:      handlers,
+		OutputDir:     tmpDir,
+		ModuleName:    "github.com/gravelight-studio/box",
+		ProjectID:     "test-project",
+		Region:        "us-central1",
 		Environment:   "dev",
 		Logger:        zap.NewNop(),
 		CleanBuildDir: true,
 	})
 
-	// Generate everything
-	err := gen.Generate()
+	// Generate everything
+	_, err := gen.Generate()
+	require.NoError(t, err)
+
+	// Should have all directories including terraform
+	functionsDir := filepath.Join(tmpDir, "functions")
+	containersDir := filepath.Join(tmpDir, "containers")
+	gatewayDir := filepath.Join(tmpDir, "gateway")
+	terraformDir := filepath.Join(tmpDir, "terraform")
+
+	assert.DirExists(t, functionsDir)
+	assert.DirExists(t, containersDir)
+	assert.DirExists(t, gatewayDir)
+	assert.DirExists(t, terraformDir)
+
+	// Verify Terraform structure is complete
+	assert.DirExists(t, filepath.Join(terraformDir, "modules"))
+	assert.DirExists(t, filepath.Join(terraformDir, "modules", "cloud-functions"))
+	assert.DirExists(t, filepath.Join(terraformDir, "modules", "cloud-run"))
+	assert.DirExists(t, filepath.Join(terraformDir, "modules", "api-gateway"))
+	assert.DirExists(t, filepath.Join(terraformDir, "modules", "networking"))
+	assert.DirExists(t, filepath.Join(terraformDir, "environments"))
+
+	// Verify main.tf references all modules
+	mainTF := filepath.Join(terraformDir, "main.tf")
+	mainContent, err := os.ReadFile(mainTF)
+	require.NoError(t, err)
+	mainStr := string(mainContent)
+
+	assert.Contains(t, mainStr, "module \"cloud_functions\" {")
+	assert.Contains(t, mainStr, "module \"cloud_run\" {")
+	assert.Contains(t, mainStr, "module \"api_gateway\" {")
+	assert.Contains(t, mainStr, "module \"networking\" {")
+
+	// Verify outputs.tf has useful outputs
+	outputsTF := filepath.Join(terraformDir, "outputs.tf")
+	outputsContent, err := os.ReadFile(outputsTF)
+	require.NoError(t, err)
+	outputsStr := string(outputsContent)
+
+	assert.Contains(t, outputsStr, "output \"function_urls\" {")
+	assert.Contains(t, outputsStr, "output \"service_urls\" {")
+	assert.Contains(t, outputsStr, "output \"api_gateway_url\" {")
+	assert.Contains(t, outputsStr, "output \"database_connection_name\" {")
+}
+
+// Bundle Integration Tests
+
+func TestIntegration_WriteBundle(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			PackagePath:    "internal/handlers/accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route: annotations.Route{
+				Method: "POST",
+				Path:   "/api/v1/accounts",
+			},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			PackagePath:    "internal/handlers/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route: annotations.Route{
+				Method: "GET",
+				Path:   "/api/v1/users",
+			},
+		},
+	}
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "build")
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  outputDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+	mustGenerate(t, gen)
+
+	// Write the bundle inside the output directory to ensure it skips itself
+	bundlePath := filepath.Join(outputDir, "build.zip")
+	require.NoError(t, WriteBundle(outputDir, bundlePath))
+
+	zr, err := zip.OpenReader(bundlePath)
 	require.NoError(t, err)
+	defer zr.Close()
 
-	// Should have all directories including terraform
-	functionsDir := filepath.Join(tmpDir, "functions")
-	containersDir := filepath.Join(tmpDir, "containers")
-	gatewayDir := filepath.Join(tmpDir, "gateway")
-	terraformDir := filepath.Join(tmpDir, "terraform")
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
 
-	assert.DirExists(t, functionsDir)
-	assert.DirExists(t, containersDir)
-	assert.DirExists(t, gatewayDir)
-	assert.DirExists(t, terraformDir)
+	// Verify expected entries across all artifact types
+	expected := []string{
+		"functions/create-account/main.go",
+		"functions/create-account/go.mod",
+		"functions/create-account/function.yaml",
+		"functions/create-account/deploy.sh",
+		"containers/users/main.go",
+		"containers/users/Dockerfile",
+		"containers/users/deploy.sh",
+		"gateway/openapi.yaml",
+		"gateway/deploy.sh",
+		"terraform/main.tf",
+		"terraform/environments/dev.tfvars",
+	}
+	for _, name := range expected {
+		assert.Contains(t, entries, name)
+	}
+	assert.NotContains(t, entries, "build.zip")
 
-	// Verify Terraform structure is complete
-	assert.DirExists(t, filepath.Join(terraformDir, "modules"))
-	assert.DirExists(t, filepath.Join(terraformDir, "modules", "cloud-functions"))
-	assert.DirExists(t, filepath.Join(terraformDir, "modules", "cloud-run"))
-	assert.DirExists(t, filepath.Join(terraformDir, "modules", "api-gateway"))
-	assert.DirExists(t, filepath.Join(terraformDir, "modules", "networking"))
-	assert.DirExists(t, filepath.Join(terraformDir, "environments"))
+	// Deploy scripts must keep their executable bit
+	for name, f := range entries {
+		if filepath.Base(name) == "deploy.sh" {
+			assert.NotZero(t, f.Mode()&0100, "%s should be executable", name)
+		}
+	}
 
-	// Verify main.tf references all modules
-	mainTF := filepath.Join(terraformDir, "main.tf")
-	mainContent, err := os.ReadFile(mainTF)
+	// Content should match the file on disk
+	rc, err := entries["gateway/openapi.yaml"].Open()
 	require.NoError(t, err)
-	mainStr := string(mainContent)
+	defer rc.Close()
+	zipped, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	onDisk, err := os.ReadFile(filepath.Join(outputDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, string(onDisk), string(zipped))
+}
 
-	assert.Contains(t, mainStr, "module \"cloud_functions\" {")
-	assert.Contains(t, mainStr, "module \"cloud_run\" {")
-	assert.Contains(t, mainStr, "module \"api_gateway\" {")
-	assert.Contains(t, mainStr, "module \"networking\" {")
+// OpenAPI Import Integration Tests
+
+func TestIntegration_ImportOpenAPI(t *testing.T) {
+	spec := `openapi: 3.0.0
+info:
+  title: Existing API
+  version: 1.0.0
+security:
+  - bearerAuth: []
+x-google-management:
+  quota:
+    limits:
+      - name: create-user-limit
+        metric: create-user-requests
+        unit: 1/min/{project}
+        values:
+          STANDARD: 60
+paths:
+  /api/v1/users:
+    get:
+      operationId: listUsers
+      tags: [users, public]
+      security: []
+    post:
+      operationId: create-user
+      summary: Create a user
+      description: |
+        Registers a new user.
+
+        The caller becomes the account owner.
+      x-google-quota:
+        metricCosts:
+          create-user-requests: 1
+  /api/v1/users/{id}:
+    get:
+      security:
+        - bearerAuth: []
+        - {}
+`
+
+	handlers, tags, err := ImportOpenAPI([]byte(spec))
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+	assert.Empty(t, tags, "valid tags are kept as they are")
+
+	// Paths sorted, methods in canonical order
+	list, create, get := handlers[0], handlers[1], handlers[2]
+
+	assert.Equal(t, "ListUsers", list.FunctionName)
+	assert.Equal(t, annotations.Route{Method: "GET", Path: "/api/v1/users"}, list.Route)
+	assert.Equal(t, annotations.AuthNone, list.Auth.Type)
+	assert.Equal(t, []string{"users", "public"}, list.Tags)
+	assert.Nil(t, list.RateLimit)
+
+	assert.Equal(t, "CreateUser", create.FunctionName)
+	assert.Equal(t, annotations.AuthRequired, create.Auth.Type)
+	assert.Equal(t, "Create a user", create.Summary)
+	assert.Equal(t, "Registers a new user.\n\nThe caller becomes the account owner.", create.Description)
+	require.NotNil(t, create.RateLimit)
+	assert.Equal(t, 60, create.RateLimit.Count)
+	assert.Equal(t, time.Minute, create.RateLimit.Period)
+
+	// Missing operationId falls back to method and path
+	assert.Equal(t, "GetApiV1UsersId", get.FunctionName)
+	assert.Equal(t, annotations.AuthOptional, get.Auth.Type)
+
+	// Scaffolded stubs must round-trip through the annotation parser
+	tmpDir := t.TempDir()
+	stubFile := filepath.Join(tmpDir, "api.go")
+	f, err := os.Create(stubFile)
+	require.NoError(t, err)
+	require.NoError(t, ScaffoldHandlers(f, "handlers", handlers))
+	require.NoError(t, f.Close())
 
-	// Verify outputs.tf has useful outputs
-	outputsTF := filepath.Join(terraformDir, "outputs.tf")
-	outputsContent, err := os.ReadFile(outputsTF)
+	parsed, err := annotations.NewParser().ParseFile(stubFile)
 	require.NoError(t, err)
-	outputsStr := string(outputsContent)
+	assert.Empty(t, parsed.Errors)
+	require.Len(t, parsed.Handlers, 3)
+
+	for i, h := range parsed.Handlers {
+		assert.Equal(t, handlers[i].FunctionName, h.FunctionName)
+		assert.Equal(t, handlers[i].Route, h.Route)
+		assert.Equal(t, handlers[i].Auth.Type, h.Auth.Type)
+		assert.Equal(t, handlers[i].Tags, h.Tags)
+		assert.Equal(t, handlers[i].Summary, h.Summary)
+		assert.Equal(t, handlers[i].Description, h.Description)
+	}
+	require.NotNil(t, parsed.Handlers[1].RateLimit)
+	assert.Equal(t, "60/minute", parsed.Handlers[1].RateLimit.Raw)
 
-	assert.Contains(t, outputsStr, "output \"function_urls\" {")
-	assert.Contains(t, outputsStr, "output \"service_urls\" {")
-	assert.Contains(t, outputsStr, "output \"api_gateway_url\" {")
-	assert.Contains(t, outputsStr, "output \"database_connection_name\" {")
+	errs := annotations.NewValidator().Validate(parsed.Handlers)
+	assert.Empty(t, errs)
+}
+
+func TestIntegration_ImportOpenAPITags(t *testing.T) {
+	spec := `openapi: 3.0.0
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      tags: [User Management, users]
+    post:
+      operationId: createUser
+      tags: ["User Management", "Admin & Billing", "v2 (beta)", "  "]
+  /users/{id}:
+    get:
+      operationId: getUser
+      tags: [user-management]
+`
+
+	handlers, tags, err := ImportOpenAPI([]byte(spec))
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+
+	list, create, get := handlers[0], handlers[1], handlers[2]
+	assert.Equal(t, []string{"user-management", "users"}, list.Tags)
+	assert.Equal(t, []string{"user-management", "admin-billing", "v2-beta"}, create.Tags)
+	// A valid tag that collides with an earlier slug gets its own name
+	assert.Equal(t, []string{"user-management-2"}, get.Tags)
+
+	assert.Equal(t, []config.TagConfig{
+		{Name: "user-management", DisplayName: "User Management"},
+		{Name: "admin-billing", DisplayName: "Admin & Billing"},
+		{Name: "v2-beta", DisplayName: "v2 (beta)"},
+		{Name: "user-management-2", DisplayName: "user-management"},
+	}, tags)
+
+	// Slugified tags pass @box:tags validation once scaffolded
+	stubFile := filepath.Join(t.TempDir(), "api.go")
+	f, err := os.Create(stubFile)
+	require.NoError(t, err)
+	require.NoError(t, ScaffoldHandlers(f, "handlers", handlers))
+	require.NoError(t, f.Close())
+
+	parsed, err := annotations.NewParser().ParseFile(stubFile)
+	require.NoError(t, err)
+	assert.Empty(t, parsed.Errors)
+	require.Len(t, parsed.Handlers, 3)
+	assert.Equal(t, create.Tags, parsed.Handlers[1].Tags)
+	assert.Empty(t, annotations.NewValidator().Validate(parsed.Handlers))
+}
+
+func TestIntegration_ImportOpenAPIInvalid(t *testing.T) {
+	_, _, err := ImportOpenAPI([]byte("openapi: 3.0.0\npaths: {}\n"))
+	assert.Error(t, err)
+
+	_, _, err = ImportOpenAPI([]byte("paths: ["))
+	assert.Error(t, err)
+}
+
+func TestIntegration_OpenAPIExtensions(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "GetProfile",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/profile"},
+			Auth:           annotations.AuthConfig{Type: annotations.AuthRequired},
+			OpenAPIExtensions: map[string]string{
+				"x-google-audiences": "123.apps.googleusercontent.com",
+				"x-internal-note":    "owner: identity team",
+			},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	gen := NewGenerator(Config{
+		Handlers:   handlers,
+		OutputDir:  tmpDir,
+		ModuleName: "github.com/gravelight-studio/box",
+		ProjectID:  "test-project",
+		Logger:     zap.NewNop(),
+	})
+
+	mustGenerate(t, gen)
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	openAPI := string(content)
+
+	// Extensions are rendered on their own operation, after the generated backend, sorted by key
+	assert.Contains(t, openAPI, "      x-google-audiences: 123.apps.googleusercontent.com\n      x-internal-note: \"owner: identity team\"\n")
+	assert.Equal(t, 1, strings.Count(openAPI, "x-google-audiences"))
+
+	// The spec stays valid YAML
+	var spec map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(content, &spec))
+	paths := spec["paths"].(map[string]interface{})
+	profile := paths["/profile"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal(t, "123.apps.googleusercontent.com", profile["x-google-audiences"])
+	assert.Contains(t, profile, "x-google-backend")
+}
+
+func TestIntegration_ServiceAccountRoles(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "PublishEvent",
+			PackageName:    "events",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/events"},
+			IAMRoles:       []string{"roles/pubsub.publisher"},
+		},
+		{
+			FunctionName:   "ListEvents",
+			PackageName:    "events",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "GET", Path: "/events"},
+			IAMRoles:       []string{"roles/storage.objectViewer", "roles/pubsub.publisher"},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+			IAMRoles:       []string{"roles/datastore.user"},
+		},
+	}
+
+	generate := func(t *testing.T, config Config) (functions, cloudRun string) {
+		tmpDir := t.TempDir()
+		config.Handlers = handlers
+		config.OutputDir = tmpDir
+		config.ModuleName = "github.com/gravelight-studio/box"
+		config.Logger = zap.NewNop()
+		require.NoError(t, NewGenerator(config).GenerateTerraform())
+
+		read := func(parts ...string) string {
+			content, err := os.ReadFile(filepath.Join(append([]string{tmpDir, "terraform", "modules"}, parts...)...))
+			require.NoError(t, err)
+			return string(content)
+		}
+		return read("cloud-functions", "main.tf"), read("cloud-run", "main.tf")
+	}
+
+	t.Run("defaults plus handler roles", func(t *testing.T) {
+		functions, cloudRun := generate(t, Config{})
+
+		// Defaults keep their resource names; roles are merged per package service account
+		assert.Contains(t, functions, `resource "google_project_iam_member" "events_cloudsql"`)
+		assert.Contains(t, functions, `resource "google_project_iam_member" "events_secrets"`)
+		assert.Contains(t, functions, `resource "google_project_iam_member" "events_pubsub_publisher"`)
+		assert.Contains(t, functions, `resource "google_project_iam_member" "events_storage_object_viewer"`)
+		assert.Equal(t, 1, strings.Count(functions, `role    = "roles/pubsub.publisher"`))
+		assert.Contains(t, functions, "    google_project_iam_member.events_secrets,\n    google_project_iam_member.events_pubsub_publisher,")
+
+		assert.Contains(t, cloudRun, `resource "google_project_iam_member" "users_cloudsql"`)
+		assert.Contains(t, cloudRun, `role    = "roles/datastore.user"`)
+		assert.Contains(t, cloudRun, "google_project_iam_member.users_datastore_user\n  ]")
+	})
+
+	t.Run("custom default roles", func(t *testing.T) {
+		functions, _ := generate(t, Config{DefaultRoles: []string{"roles/logging.logWriter"}})
+
+		assert.Contains(t, functions, `resource "google_project_iam_member" "events_logging_log_writer"`)
+		assert.NotContains(t, functions, "roles/cloudsql.client")
+		assert.NotContains(t, functions, "roles/secretmanager.secretAccessor")
+	})
+
+	t.Run("no default roles", func(t *testing.T) {
+		functions, cloudRun := generate(t, Config{
+			DefaultRoles:   []string{"roles/logging.logWriter"},
+			NoDefaultRoles: true,
+		})
+
+		for _, content := range []string{functions, cloudRun} {
+			assert.NotContains(t, content, "roles/cloudsql.client")
+			assert.NotContains(t, content, "roles/secretmanager.secretAccessor")
+			assert.NotContains(t, content, "roles/logging.logWriter")
+		}
+		assert.Contains(t, functions, `role    = "roles/pubsub.publisher"`)
+		assert.Contains(t, cloudRun, `role    = "roles/datastore.user"`)
+	})
+}
+
+func TestIntegration_GenerateKubernetes(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:    "GetUser",
+			PackageName:     "users",
+			PackagePath:     "internal/users",
+			DeploymentType:  annotations.DeploymentContainer,
+			Route:           annotations.Route{Method: "GET", Path: "/api/v1/users/{id}"},
+			Memory:          "1GB",
+			Concurrency:     40,
+			RequiredEnvVars: []string{"JWT_SECRET"},
+		},
+		{
+			FunctionName:   "UpdateUser",
+			PackageName:    "users",
+			PackagePath:    "internal/users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "PUT", Path: "/api/v1/users/{id}"},
+			Memory:         "512MB",
+			Concurrency:    120,
+		},
+		{
+			FunctionName:   "ListOrders",
+			PackageName:    "orders",
+			PackagePath:    "internal/orders",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/users/{userId}/orders.json"},
+		},
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+		},
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:         handlers,
+			OutputDir:        tmpDir,
+			ModuleName:       "github.com/gravelight-studio/box",
+			ProjectID:        "test-project",
+			Region:           "europe-west1",
+			Environment:      "staging",
+			Logger:           zap.NewNop(),
+			KubernetesOutput: true,
+		})
+		mustGenerate(t, gen)
+
+		usersDir := filepath.Join(tmpDir, "k8s", "users")
+		for _, name := range []string{"deployment.yaml", "service.yaml", "hpa.yaml", "ingress.yaml", "kustomization.yaml"} {
+			assert.FileExists(t, filepath.Join(usersDir, name))
+		}
+		assert.NoDirExists(t, filepath.Join(tmpDir, "k8s", "accounts"), "functions have no manifests")
+
+		deployment, err := os.ReadFile(filepath.Join(usersDir, "deployment.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(deployment), "kind: Deployment")
+		assert.Contains(t, string(deployment), "name: wylla-staging-users")
+		assert.Contains(t, string(deployment), "image: gcr.io/test-project/users:latest")
+		assert.Contains(t, string(deployment), `value: "europe-west1"`)
+		// Largest @box:memory and highest @box:concurrency (120 / 80 per CPU, rounded up)
+		assert.Contains(t, string(deployment), "limits:\n              cpu: 1500m\n              memory: 1024Mi")
+		assert.Contains(t, string(deployment), "- name: JWT_SECRET\n              valueFrom:\n                secretKeyRef:\n                  name: wylla-staging-users\n                  key: JWT_SECRET")
+		assert.Contains(t, string(deployment), "path: /health")
+
+		hpa, err := os.ReadFile(filepath.Join(usersDir, "hpa.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(hpa), "kind: HorizontalPodAutoscaler")
+		assert.Contains(t, string(hpa), "targetCPUUtilizationPercentage: 70")
+
+		// Both methods share one path rule
+		ingress, err := os.ReadFile(filepath.Join(usersDir, "ingress.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(ingress), `nginx.ingress.kubernetes.io/use-regex: "true"`)
+		assert.Equal(t, 1, strings.Count(string(ingress), "- path:"))
+		assert.Contains(t, string(ingress), `- path: "/api/v1/users/([^/]+)$"`)
+
+		kustomization, err := os.ReadFile(filepath.Join(usersDir, "kustomization.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(kustomization), "kind: Kustomization")
+		assert.Contains(t, string(kustomization), "resources:\n  - deployment.yaml\n  - service.yaml\n  - hpa.yaml\n  - ingress.yaml\n")
+
+		// Defaults match Cloud Run; literal dots are escaped in the path regex
+		ordersDeployment, err := os.ReadFile(filepath.Join(tmpDir, "k8s", "orders", "deployment.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(ordersDeployment), "cpu: 1000m\n              memory: 512Mi")
+		ordersIngress, err := os.ReadFile(filepath.Join(tmpDir, "k8s", "orders", "ingress.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(ordersIngress), `- path: "/api/v1/users/([^/]+)/orders\\.json$"`)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			Logger:     zap.NewNop(),
+		})
+		mustGenerate(t, gen)
+
+		assert.NoDirExists(t, filepath.Join(tmpDir, "k8s"))
+	})
+}
+
+func TestIntegration_GenerateLambdas(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:    "GetReport",
+			PackageName:     "reports",
+			PackagePath:     "internal/reports",
+			DeploymentType:  annotations.DeploymentLambda,
+			Route:           annotations.Route{Method: "GET", Path: "/api/v1/reports/{id}"},
+			Memory:          "1GB",
+			Timeout:         2 * time.Minute,
+			RequiredEnvVars: []string{"REPORTS_BUCKET"},
+		},
+		{
+			FunctionName:   "ListReports",
+			PackageName:    "reports",
+			PackagePath:    "internal/reports",
+			DeploymentType: annotations.DeploymentLambda,
+			Route:          annotations.Route{Method: "GET", Path: "/api/v1/reports"},
+		},
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/api/v1/accounts"},
+		},
+	}
+
+	t.Run("with AWS target", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			ProjectID:  "test-project",
+			Logger:     zap.NewNop(),
+			AWS:        &AWSConfig{Project: "acme-api", Region: "eu-west-1"},
+		})
+		mustGenerate(t, gen)
+
+		lambdaDir := filepath.Join(tmpDir, "lambdas", "get-report")
+		for _, name := range []string{"main.go", "go.mod", "template.yaml", "buildspec.yml", "deploy.sh"} {
+			assert.FileExists(t, filepath.Join(lambdaDir, name))
+		}
+		info, err := os.Stat(filepath.Join(lambdaDir, "deploy.sh"))
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&0111, "deploy.sh should be executable")
+
+		mainGo, err := os.ReadFile(filepath.Join(lambdaDir, "main.go"))
+		require.NoError(t, err)
+		assert.Contains(t, string(mainGo), `"github.com/gravelight-studio/box/internal/reports"`)
+		assert.Contains(t, string(mainGo), "httpadapter.New(http.HandlerFunc(reports.GetReport))")
+		assert.Contains(t, string(mainGo), "lambda.Start(adapter.ProxyWithContext)")
+
+		goMod, err := os.ReadFile(filepath.Join(lambdaDir, "go.mod"))
+		require.NoError(t, err)
+		assert.Contains(t, string(goMod), "module github.com/gravelight-studio/box/build/lambdas/get-report")
+		assert.Contains(t, string(goMod), "github.com/awslabs/aws-lambda-go-api-proxy")
+
+		sam, err := os.ReadFile(filepath.Join(lambdaDir, "template.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(sam), "Type: AWS::Serverless::Function")
+		assert.Contains(t, string(sam), "MemorySize: 1024")
+		assert.Contains(t, string(sam), "Timeout: 120")
+		assert.Contains(t, string(sam), "REPORTS_BUCKET: REQUIRED")
+		assert.Contains(t, string(sam), "box:project: acme-api")
+		assert.Contains(t, string(sam), "Path: /api/v1/reports/{id}\n            Method: get")
+
+		deploy, err := os.ReadFile(filepath.Join(lambdaDir, "deploy.sh"))
+		require.NoError(t, err)
+		assert.Contains(t, string(deploy), `REGION="${AWS_REGION:-eu-west-1}"`)
+		assert.Contains(t, string(deploy), "sam deploy")
+
+		// Defaults apply to handlers without @box:memory and @box:timeout
+		listSAM, err := os.ReadFile(filepath.Join(tmpDir, "lambdas", "list-reports", "template.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(listSAM), "MemorySize: 256")
+		assert.Contains(t, string(listSAM), "Timeout: 60")
+
+		moduleDir := filepath.Join(tmpDir, "terraform", "modules", "aws-lambda")
+		mainTf, err := os.ReadFile(filepath.Join(moduleDir, "main.tf"))
+		require.NoError(t, err)
+		tf := string(mainTf)
+		assert.Contains(t, tf, `resource "aws_lambda_function" "get_report"`)
+		assert.Contains(t, tf, `resource "aws_iam_role" "get_report"`)
+		assert.Contains(t, tf, `resource "aws_api_gateway_integration" "get_report"`)
+		assert.Contains(t, tf, "uri                     = aws_lambda_function.get_report.invoke_arn")
+		assert.Contains(t, tf, "memory_size      = 1024")
+		assert.Contains(t, tf, `REPORTS_BUCKET = var.secrets["REPORTS_BUCKET"]`)
+		assert.Contains(t, tf, `"box:project" = "acme-api"`)
+
+		// One resource per path segment, shared between routes
+		assert.Equal(t, 1, strings.Count(tf, `resource "aws_api_gateway_resource" "api_v1_reports"`))
+		assert.Contains(t, tf, "parent_id   = aws_api_gateway_resource.api_v1_reports.id\n  path_part   = \"{id}\"")
+		assert.Contains(t, tf, "resource_id   = aws_api_gateway_resource.api_v1_reports_id.id")
+
+		variables, err := os.ReadFile(filepath.Join(moduleDir, "variables.tf"))
+		require.NoError(t, err)
+		assert.Contains(t, string(variables), `default     = "eu-west-1"`)
+		assert.Contains(t, string(variables), `variable "secrets"`)
+
+		// Lambda routes stay out of the GCP gateway and Terraform
+		openapi, err := os.ReadFile(filepath.Join(tmpDir, "gateway", "openapi.yaml"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(openapi), "/api/v1/reports")
+		assert.Contains(t, string(openapi), "/api/v1/accounts")
+		assert.NoDirExists(t, filepath.Join(tmpDir, "functions", "get-report"))
+	})
+
+	t.Run("without AWS target", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		gen := NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  tmpDir,
+			ModuleName: "github.com/gravelight-studio/box",
+			Logger:     zap.NewNop(),
+		})
+		mustGenerate(t, gen)
+
+		assert.NoDirExists(t, filepath.Join(tmpDir, "lambdas"))
+		assert.NoDirExists(t, filepath.Join(tmpDir, "terraform", "modules", "aws-lambda"))
+		assert.DirExists(t, filepath.Join(tmpDir, "functions", "create-account"))
+	})
+}
+
+func TestIntegration_CompareOutput(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/accounts"},
+		},
+	}
+
+	generate := func(dir string) {
+		mustGenerate(t, NewGenerator(Config{
+			Handlers:   handlers,
+			OutputDir:  dir,
+			ModuleName: "github.com/gravelight-studio/box",
+			ProjectID:  "test-project",
+			Logger:     zap.NewNop(),
+		}))
+	}
+
+	committed := t.TempDir()
+	generated := t.TempDir()
+	generate(committed)
+	generate(generated)
+
+	// Identical builds, plus Terraform working state that is never generated
+	require.NoError(t, os.MkdirAll(filepath.Join(committed, "terraform", ".terraform"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(committed, "terraform", ".terraform", "plugin"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(committed, "terraform", "terraform.tfstate"), []byte("{}"), 0644))
+
+	drift, err := CompareOutput(generated, committed)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+
+	// Hand-edited, stale and missing files
+	openAPIPath := filepath.Join(committed, "gateway", "openapi.yaml")
+	openAPI, err := os.ReadFile(openAPIPath)
+	require.NoError(t, err)
+	edited := strings.Replace(string(openAPI), "operationId: CreateAccount", "operationId: CreateAcct", 1)
+	require.NoError(t, os.WriteFile(openAPIPath, []byte(edited), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(committed, "gateway", "old.yaml"), []byte("stale"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(committed, "terraform", "README.md")))
+
+	drift, err = CompareOutput(generated, committed)
+	require.NoError(t, err)
+	require.Len(t, drift, 3)
+
+	assert.Equal(t, OutputDrift{Path: "gateway/old.yaml", Status: DriftRemoved}, drift[0])
+	assert.Equal(t, "gateway/openapi.yaml", drift[1].Path)
+	assert.Equal(t, DriftModified, drift[1].Status)
+	assert.Equal(t, "-      operationId: CreateAcct\n+      operationId: CreateAccount\n", drift[1].Diff)
+	assert.Equal(t, OutputDrift{Path: "terraform/README.md", Status: DriftAdded}, drift[2])
+
+	// Nothing committed yet: every generated file is missing
+	drift, err = CompareOutput(generated, filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.NotEmpty(t, drift)
+	for _, file := range drift {
+		assert.Equal(t, DriftAdded, file.Status, file.Path)
+	}
+}
+
+func TestIntegration_SkipGatewayAndTerraform(t *testing.T) {
+	handlers := []annotations.Handler{
+		{FunctionName: "ListUsers", PackageName: "users", DeploymentType: annotations.DeploymentFunction, Route: annotations.Route{Method: "GET", Path: "/api/users"}},
+	}
+
+	tmpDir := t.TempDir()
+	gen := NewGenerator(Config{
+		Handlers:      handlers,
+		OutputDir:     tmpDir,
+		ModuleName:    "github.com/gravelight-studio/box",
+		ProjectID:     "test-project",
+		Logger:        zap.NewNop(),
+		SkipGateway:   true,
+		SkipTerraform: true,
+	})
+	mustGenerate(t, gen)
+
+	assert.FileExists(t, filepath.Join(tmpDir, "functions", "list-users", "function.yaml"))
+	assert.NoDirExists(t, filepath.Join(tmpDir, "gateway"))
+	assert.NoDirExists(t, filepath.Join(tmpDir, "terraform"))
+}
+
+func TestWatchBuilderDebounce(t *testing.T) {
+	changes := make(chan struct{})
+	builds := make(chan time.Time, 10)
+	watcher := NewWatchBuilder(WatchConfig{
+		Build:    func() error { builds <- time.Now(); return nil },
+		Debounce: 50 * time.Millisecond,
+	})
+	watcher.changes = changes
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Start(ctx, func(err error) { assert.NoError(t, err) }) }()
+
+	// A burst of changes closer together than the debounce window rebuilds once, after the last
+	var lastChange time.Time
+	for i := 0; i < 5; i++ {
+		changes <- struct{}{}
+		lastChange = time.Now()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case built := <-builds:
+		assert.GreaterOrEqual(t, built.Sub(lastChange), 50*time.Millisecond)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a burst of changes")
+	}
+	select {
+	case <-builds:
+		t.Fatal("a burst of changes rebuilt more than once")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// A later change rebuilds again
+	changes <- struct{}{}
+	select {
+	case <-builds:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a second change")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWatchBuilderDetectsFileChanges(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users.go"), []byte("package users\n"), 0644))
+
+	results := make(chan error, 10)
+	starts := 0
+	watcher := NewWatchBuilder(WatchConfig{
+		Dir:      dir,
+		Build:    func() error { return errors.New("build failed") },
+		Debounce: 20 * time.Millisecond,
+		OnStart:  func() { starts++ },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Start(ctx, func(err error) { results <- err })
+
+	// Hidden files (editor swap files) are ignored
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".users.go.swp"), []byte("x"), 0644))
+	select {
+	case <-results:
+		t.Fatal("a hidden file triggered a rebuild")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.go"), []byte("package users\n"), 0644))
+	select {
+	case err := <-results:
+		assert.EqualError(t, err, "build failed")
+		assert.Equal(t, 1, starts)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a new file")
+	}
+
+	// Rewriting a file with content of the same size is still a change
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "users.go"), []byte("package uses\n\n"), 0644))
+	select {
+	case <-results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a same-size edit")
+	}
+
+	// New directories are watched too
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "billing"), 0755))
+	select {
+	case <-results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a new directory")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "billing", "invoices.go"), []byte("package billing\n"), 0644))
+	select {
+	case <-results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rebuild after a file in a new directory")
+	}
 }
@@ -0,0 +1,158 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// jsonSchemaDialect is the $schema of the standalone files
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// componentRefPrefix starts the $refs SchemaExtractor writes for OpenAPI components
+const componentRefPrefix = "#/components/schemas/"
+
+// JSONSchemaGenerator writes a standalone JSON Schema file per @box:request and
+// @box:response type, for tools that generate client types from JSON Schema rather than
+// OpenAPI. The schemas come from the same SchemaExtractor as openapi.yaml's components
+type JSONSchemaGenerator struct {
+	handlers  []annotations.Handler
+	outputDir string
+	logger    *zap.Logger
+}
+
+// Generate replaces the output directory with one <Type>.json per body type, shared types
+// written once. Types named alike in different packages are written as <package>.<Type>.json
+func (jg *JSONSchemaGenerator) Generate() error {
+	extractor := NewSchemaExtractor()
+	var roots []string // Component names of the body types, in handler order
+	seen := make(map[string]bool)
+	for _, handler := range jg.handlers {
+		for _, body := range []struct{ key, typeName string }{
+			{annotations.KeyRequest, handler.RequestType},
+			{annotations.KeyResponse, handler.ResponseType},
+		} {
+			if body.typeName == "" {
+				continue
+			}
+			ref, err := extractor.Extract(handler, body.typeName)
+			if err != nil {
+				return fmt.Errorf("handler %s: %s: %w", handler.FunctionName, annotations.AnnotationName(body.key), err)
+			}
+			if name := strings.TrimPrefix(ref, componentRefPrefix); !seen[name] {
+				seen[name] = true
+				roots = append(roots, name)
+			}
+		}
+	}
+
+	// The directory holds nothing else, so types no longer referenced go with it
+	if err := os.RemoveAll(jg.outputDir); err != nil {
+		return fmt.Errorf("failed to clean schemas directory: %w", err)
+	}
+	if err := os.MkdirAll(jg.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create schemas directory: %w", err)
+	}
+
+	files := schemaFileNames(roots)
+	for _, name := range roots {
+		data, err := json.MarshalIndent(standaloneSchema(extractor.Schemas(), name), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode schema %s: %w", name, err)
+		}
+		path := filepath.Join(jg.outputDir, files[name])
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", files[name], err)
+		}
+	}
+
+	jg.logger.Info("Generated JSON Schemas",
+		zap.String("dir", jg.outputDir),
+		zap.Int("schemas", len(roots)))
+	return nil
+}
+
+// schemaFileNames maps component names ("<package>.<Type>") to file names: <Type>.json,
+// or <package>.<Type>.json for types sharing a name with one in another package
+func schemaFileNames(components []string) map[string]string {
+	byType := make(map[string]int)
+	for _, name := range components {
+		_, typeName, _ := strings.Cut(name, ".")
+		byType[typeName]++
+	}
+
+	files := make(map[string]string, len(components))
+	for _, name := range components {
+		_, typeName, _ := strings.Cut(name, ".")
+		if byType[typeName] > 1 {
+			files[name] = name + ".json"
+		} else {
+			files[name] = typeName + ".json"
+		}
+	}
+	return files
+}
+
+// standaloneSchema returns the schema of component root as a JSON Schema document: the
+// package types it references move under $defs, and references to root itself point at "#"
+func standaloneSchema(components map[string]interface{}, root string) map[string]interface{} {
+	defs := make(map[string]interface{})
+	var rewrite func(value interface{}) interface{}
+	rewrite = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				ref, isRef := item.(string)
+				if key != "$ref" || !isRef || !strings.HasPrefix(ref, componentRefPrefix) {
+					out[key] = rewrite(item)
+					continue
+				}
+				name := strings.TrimPrefix(ref, componentRefPrefix)
+				if name == root {
+					out[key] = "#"
+					continue
+				}
+				out[key] = "#/$defs/" + name
+				if _, ok := defs[name]; !ok {
+					defs[name] = nil // Registered first, so recursive types terminate
+					defs[name] = rewrite(components[name])
+				}
+			}
+			return out
+		case []interface{}:
+			out := make([]interface{}, len(v))
+			for i, item := range v {
+				out[i] = rewrite(item)
+			}
+			return out
+		default:
+			return value
+		}
+	}
+
+	schema := rewrite(components[root]).(map[string]interface{})
+	schema["$schema"] = jsonSchemaDialect
+	_, typeName, _ := strings.Cut(root, ".")
+	schema["title"] = typeName
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	return schema
+}
+
+// hasBodyTypes reports whether any handler names a @box:request or @box:response type
+func hasBodyTypes(handlers []annotations.Handler) bool {
+	for _, handler := range handlers {
+		if handler.RequestType != "" || handler.ResponseType != "" {
+			return true
+		}
+	}
+	return false
+}
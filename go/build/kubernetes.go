@@ -0,0 +1,356 @@
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+// DefaultKubernetesTargetCPU is the average CPU utilization, as a percentage of the
+// requested CPU, that each HorizontalPodAutoscaler scales to
+const DefaultKubernetesTargetCPU = 70
+
+// Sizing for container services without @box:memory or @box:concurrency, matching the
+// Cloud Run services the Terraform generator writes
+const (
+	defaultContainerMemoryMi    = 512
+	defaultContainerConcurrency = 80 // Requests one vCPU serves
+)
+
+// KubernetesGenerator generates Kubernetes manifests for container services, for teams
+// deploying to GKE instead of Cloud Run
+type KubernetesGenerator struct {
+	plan        *DeploymentPlan
+	outputDir   string // e.g., "./build/k8s"
+	projectID   string
+	environment string
+	logger      *zap.Logger
+}
+
+// kubernetesService is one service group as rendered into its manifests
+type kubernetesService struct {
+	Name         string // Kebab-case service name, used for the directory and BOX_SERVICE
+	DeployedName string // Name of every resource (e.g., "wylla-dev-users")
+	Image        string
+	Environment  string
+	Region       string
+	HealthPath   string
+	MemoryMi     int
+	CPUMillis    int
+	TargetCPU    int
+	EnvVars      []string // @box:env variables, read from the service's Secret
+	Paths        []string // NGINX ingress path regexes, one per distinct route path
+}
+
+// Generate creates the manifests and kustomization for every container service
+func (kg *KubernetesGenerator) Generate() error {
+	if len(kg.plan.Services) == 0 {
+		kg.logger.Info("No container services to generate Kubernetes manifests for")
+		return nil
+	}
+
+	if err := os.MkdirAll(kg.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create k8s directory: %w", err)
+	}
+
+	envVars := serviceEnvVars(kg.plan.Services)
+	for _, group := range kg.plan.Services {
+		service, err := kg.kubernetesService(group, envVars[group.Name])
+		if err != nil {
+			return fmt.Errorf("failed to size service %s: %w", group.Name, err)
+		}
+		if err := kg.generateService(service); err != nil {
+			return fmt.Errorf("failed to generate manifests for service %s: %w", group.Name, err)
+		}
+	}
+
+	kg.logger.Info("Generated Kubernetes manifests",
+		zap.Int("services", len(kg.plan.Services)),
+		zap.String("output_dir", kg.outputDir))
+
+	return nil
+}
+
+// kubernetesService resolves a service group's resources and ingress paths
+// The service is sized for its most demanding handler: the largest @box:memory becomes
+// the memory limit and the highest @box:concurrency the CPU limit
+func (kg *KubernetesGenerator) kubernetesService(group ServiceGroup, envVars []string) (kubernetesService, error) {
+	memory := 0
+	concurrency := 0
+	for _, handler := range group.Handlers {
+		if handler.Memory != "" {
+			mi, err := memoryMi(handler.Memory)
+			if err != nil {
+				return kubernetesService{}, fmt.Errorf("handler %s: %w", handler.FunctionName, err)
+			}
+			memory = max(memory, mi)
+		}
+		concurrency = max(concurrency, handler.Concurrency)
+	}
+	if memory == 0 {
+		memory = defaultContainerMemoryMi
+	}
+	if concurrency == 0 {
+		concurrency = defaultContainerConcurrency
+	}
+
+	name := toKebabCase(group.Name)
+	service := kubernetesService{
+		Name:         name,
+		DeployedName: fmt.Sprintf("wylla-%s-%s", kg.environment, name),
+		Image:        fmt.Sprintf("gcr.io/%s/%s:latest", kg.projectID, name),
+		Environment:  kg.environment,
+		Region:       kg.plan.Networking.Region,
+		HealthPath:   kg.plan.Networking.HealthPath,
+		MemoryMi:     memory,
+		CPUMillis:    concurrencyCPUMillis(concurrency),
+		TargetCPU:    DefaultKubernetesTargetCPU,
+		EnvVars:      envVars,
+	}
+
+	seen := make(map[string]bool)
+	for _, route := range kg.plan.Routes {
+		if route.Backend.Name != group.Name || seen[route.Handler.Route.Path] {
+			continue
+		}
+		seen[route.Handler.Route.Path] = true
+		service.Paths = append(service.Paths, ingressPathRegex(route.Handler.Route.Path))
+	}
+
+	return service, nil
+}
+
+// kubernetesManifest is one file of a service's manifests and the template rendering it
+type kubernetesManifest struct {
+	name     string
+	template string
+}
+
+// generateService writes a service's manifests to k8s/<service>/
+func (kg *KubernetesGenerator) generateService(service kubernetesService) error {
+	dir := filepath.Join(kg.outputDir, service.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create service directory: %w", err)
+	}
+
+	kg.logger.Info("Generating Kubernetes manifests",
+		zap.String("service", service.Name),
+		zap.Int("memory_mi", service.MemoryMi),
+		zap.Int("cpu_millis", service.CPUMillis),
+		zap.String("output_dir", dir))
+
+	manifests := []kubernetesManifest{
+		{"deployment.yaml", kubernetesDeploymentTemplate},
+		{"service.yaml", kubernetesServiceTemplate},
+		{"hpa.yaml", kubernetesHPATemplate},
+	}
+	// Services whose handlers are all queue, scheduler or Pub/Sub targets have no routes
+	if len(service.Paths) > 0 {
+		manifests = append(manifests, kubernetesManifest{"ingress.yaml", kubernetesIngressTemplate})
+	}
+
+	resources := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		if err := writeKubernetesManifest(filepath.Join(dir, manifest.name), manifest.template, service); err != nil {
+			return fmt.Errorf("failed to generate %s: %w", manifest.name, err)
+		}
+		resources = append(resources, manifest.name)
+	}
+
+	return writeKubernetesManifest(filepath.Join(dir, "kustomization.yaml"), kustomizationTemplate, resources)
+}
+
+// writeKubernetesManifest renders tmpl to path
+func writeKubernetesManifest(path, tmpl string, data interface{}) error {
+	t := template.Must(template.New(filepath.Base(path)).Parse(tmpl))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return t.Execute(file, data)
+}
+
+// memoryMi converts a @box:memory value ("512MB", "2GB") to mebibytes
+func memoryMi(memory string) (int, error) {
+	unit := 1
+	number := strings.TrimSuffix(memory, "MB")
+	if number == memory {
+		number = strings.TrimSuffix(memory, "GB")
+		unit = 1024
+	}
+
+	size, err := strconv.Atoi(number)
+	if number == memory || err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid memory value: %s (use MB or GB, e.g. 512MB)", memory)
+	}
+	return size * unit, nil
+}
+
+// concurrencyCPUMillis returns the CPU limit for a service handling concurrency requests
+// at once, one vCPU per defaultContainerConcurrency requests rounded up to 100m
+func concurrencyCPUMillis(concurrency int) int {
+	steps := (concurrency*10 + defaultContainerConcurrency - 1) / defaultContainerConcurrency
+	return max(steps, 1) * 100
+}
+
+// ingressPathParam matches a {param} segment of a route path
+var ingressPathParam = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// ingressPathRegex converts a route path to an anchored NGINX ingress regex, with each
+// {param} segment captured ("/api/users/{id}" -> "/api/users/([^/]+)$")
+func ingressPathRegex(path string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range ingressPathParam.FindAllStringIndex(path, -1) {
+		b.WriteString(regexp.QuoteMeta(path[last:match[0]]))
+		b.WriteString("([^/]+)")
+		last = match[1]
+	}
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	b.WriteString("$")
+	return b.String()
+}
+
+// Templates
+
+const kubernetesDeploymentTemplate = `# Generated by Wylla build system
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.DeployedName}}
+  labels:
+    app: {{.DeployedName}}
+    box.service: {{.Name}}
+    box.environment: {{.Environment}}
+spec:
+  selector:
+    matchLabels:
+      app: {{.DeployedName}}
+  template:
+    metadata:
+      labels:
+        app: {{.DeployedName}}
+        box.service: {{.Name}}
+        box.environment: {{.Environment}}
+    spec:
+      containers:
+        - name: {{.Name}}
+          image: {{.Image}}
+          ports:
+            - name: http
+              containerPort: 8080
+          env:
+            - name: PORT
+              value: "8080"
+            - name: ENVIRONMENT
+              value: "{{.Environment}}"
+            - name: BOX_ENVIRONMENT
+              value: "{{.Environment}}"
+            - name: BOX_REGION
+              value: "{{.Region}}"
+            - name: BOX_SERVICE
+              value: "{{.Name}}"
+            - name: DATABASE_URL
+              valueFrom:
+                secretKeyRef:
+                  name: {{.DeployedName}}
+                  key: DATABASE_URL
+{{- range .EnvVars}}
+            - name: {{.}}
+              valueFrom:
+                secretKeyRef:
+                  name: {{$.DeployedName}}
+                  key: {{.}}
+{{- end}}
+          resources:
+            requests:
+              cpu: {{.CPUMillis}}m
+              memory: {{.MemoryMi}}Mi
+            limits:
+              cpu: {{.CPUMillis}}m
+              memory: {{.MemoryMi}}Mi
+          readinessProbe:
+            httpGet:
+              path: {{.HealthPath}}
+              port: http
+            periodSeconds: 10
+          livenessProbe:
+            httpGet:
+              path: {{.HealthPath}}
+              port: http
+            initialDelaySeconds: 10
+            periodSeconds: 10
+            failureThreshold: 3
+`
+
+const kubernetesServiceTemplate = `# Generated by Wylla build system
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.DeployedName}}
+  labels:
+    app: {{.DeployedName}}
+spec:
+  selector:
+    app: {{.DeployedName}}
+  ports:
+    - name: http
+      port: 80
+      targetPort: http
+`
+
+const kubernetesHPATemplate = `# Generated by Wylla build system
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{.DeployedName}}
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: {{.DeployedName}}
+  minReplicas: 1
+  maxReplicas: 10
+  targetCPUUtilizationPercentage: {{.TargetCPU}}
+`
+
+const kubernetesIngressTemplate = `# Generated by Wylla build system
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{.DeployedName}}
+  annotations:
+    nginx.ingress.kubernetes.io/use-regex: "true"
+spec:
+  ingressClassName: nginx
+  rules:
+    - http:
+        paths:
+{{- range .Paths}}
+          - path: {{printf "%q" .}}
+            pathType: ImplementationSpecific
+            backend:
+              service:
+                name: {{$.DeployedName}}
+                port:
+                  name: http
+{{- end}}
+`
+
+const kustomizationTemplate = `# Generated by Wylla build system
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+{{- range .}}
+  - {{.}}
+{{- end}}
+`
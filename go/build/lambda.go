@@ -0,0 +1,632 @@
+package build
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// AWSConfig is the AWS target for @box:lambda handlers
+type AWSConfig struct {
+	Project string // Tagged on every AWS resource as box:project (optional)
+	Region  string // AWS region (default: DefaultAWSRegion)
+}
+
+// DefaultAWSRegion is the AWS region when AWSConfig.Region is unset
+const DefaultAWSRegion = "us-east-1"
+
+// defaultLambdaMemoryMB matches the Cloud Functions default for handlers without @box:memory
+const defaultLambdaMemoryMB = 256
+
+// LambdaGenerator generates AWS Lambda deployment packages and their Terraform module
+type LambdaGenerator struct {
+	plan           *DeploymentPlan
+	outputDir      string // e.g., "./build/lambdas"
+	terraformDir   string // e.g., "./build/terraform"; the aws-lambda module is written below it
+	moduleName     string
+	environment    string
+	aws            AWSConfig
+	defaultTimeout time.Duration // Timeout for handlers without @box:timeout
+	logger         *zap.Logger
+}
+
+// lambdaFunction is one @box:lambda handler as rendered into the package and Terraform templates
+type lambdaFunction struct {
+	annotations.Handler
+	Name           string // Kebab-case function name, used for directories and deployed names
+	Resource       string // Terraform resource name
+	PathResource   string // aws_api_gateway_resource serving the route; empty for the root path
+	MemoryMB       int
+	TimeoutSeconds int
+}
+
+// lambdaPathResource is one aws_api_gateway_resource, a single path segment below its parent
+type lambdaPathResource struct {
+	Name     string // Terraform resource name (e.g., "api_v1_users_id")
+	Parent   string // Parent resource name; empty for the API root
+	Path     string // Full path (e.g., "/api/v1/users/{id}")
+	PathPart string // Last segment (e.g., "{id}")
+}
+
+// Generate creates a deployment package for every lambda handler and the aws-lambda
+// Terraform module routing the REST API to them
+func (lg *LambdaGenerator) Generate() error {
+	if len(lg.plan.Lambdas) == 0 {
+		lg.logger.Info("No lambda handlers to generate")
+		return nil
+	}
+
+	functions, err := lg.lambdaFunctions()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(lg.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create lambdas directory: %w", err)
+	}
+
+	for _, function := range functions {
+		if err := lg.generateLambda(function); err != nil {
+			return fmt.Errorf("failed to generate lambda %s: %w", function.FunctionName, err)
+		}
+	}
+
+	if err := lg.generateTerraformModule(functions); err != nil {
+		return fmt.Errorf("failed to generate aws-lambda module: %w", err)
+	}
+
+	lg.logger.Info("Generated all lambdas",
+		zap.Int("count", len(functions)),
+		zap.String("region", lg.aws.Region),
+		zap.String("output_dir", lg.outputDir))
+
+	return nil
+}
+
+// lambdaFunctions resolves memory, timeout and resource names for every lambda handler
+func (lg *LambdaGenerator) lambdaFunctions() ([]lambdaFunction, error) {
+	functions := make([]lambdaFunction, 0, len(lg.plan.Lambdas))
+	for _, handler := range lg.plan.Lambdas {
+		memory := defaultLambdaMemoryMB
+		if handler.Memory != "" {
+			mb, err := annotations.LambdaMemoryMB(handler.Memory)
+			if err != nil {
+				return nil, fmt.Errorf("handler %s: %w", handler.FunctionName, err)
+			}
+			memory = mb
+		}
+
+		// Render @box:env variables in a stable order, whatever their declaration order
+		handler.RequiredEnvVars = slices.Sorted(slices.Values(handler.RequiredEnvVars))
+
+		functions = append(functions, lambdaFunction{
+			Handler:        handler,
+			Name:           toKebabCase(handler.FunctionName),
+			Resource:       toSnakeCase(handler.FunctionName),
+			PathResource:   lambdaResourceName(handler.Route.Path),
+			MemoryMB:       memory,
+			TimeoutSeconds: int(handlerTimeout(handler, lg.defaultTimeout).Seconds()),
+		})
+	}
+	return functions, nil
+}
+
+// generateLambda writes the entry point, go.mod, SAM template, CodeBuild spec and deploy script
+func (lg *LambdaGenerator) generateLambda(function lambdaFunction) error {
+	dir := filepath.Join(lg.outputDir, function.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create lambda directory: %w", err)
+	}
+
+	lg.logger.Info("Generating lambda",
+		zap.String("function", function.FunctionName),
+		zap.String("path", function.Route.Path),
+		zap.String("output_dir", dir))
+
+	data := struct {
+		lambdaFunction
+		ModuleName  string
+		Environment string
+		Region      string
+		Project     string
+	}{
+		lambdaFunction: function,
+		ModuleName:     lg.moduleName,
+		Environment:    lg.environment,
+		Region:         lg.aws.Region,
+		Project:        lg.aws.Project,
+	}
+
+	files := []struct {
+		name     string
+		template string
+		mode     os.FileMode
+	}{
+		{"main.go", lambdaEntrypointTemplate, 0644},
+		{"go.mod", lambdaGoModTemplate, 0644},
+		{"template.yaml", lambdaSAMTemplate, 0644},
+		{"buildspec.yml", lambdaBuildspecTemplate, 0644},
+		{"deploy.sh", lambdaDeployScriptTemplate, 0755},
+	}
+	for _, file := range files {
+		if err := writeLambdaTemplate(filepath.Join(dir, file.name), file.template, data, file.mode); err != nil {
+			return fmt.Errorf("failed to generate %s: %w", file.name, err)
+		}
+	}
+
+	return nil
+}
+
+// generateTerraformModule writes the standalone aws-lambda Terraform module
+func (lg *LambdaGenerator) generateTerraformModule(functions []lambdaFunction) error {
+	modulePath := filepath.Join(lg.terraformDir, "modules", "aws-lambda")
+	if err := os.MkdirAll(modulePath, 0755); err != nil {
+		return fmt.Errorf("failed to create module directory: %w", err)
+	}
+
+	var paths []string
+	hasEnvVars := false
+	for _, function := range functions {
+		paths = append(paths, function.Route.Path)
+		hasEnvVars = hasEnvVars || len(function.RequiredEnvVars) > 0
+	}
+
+	data := map[string]interface{}{
+		"Functions":  functions,
+		"Resources":  lambdaPathResources(paths),
+		"Project":    lg.aws.Project,
+		"Region":     lg.aws.Region,
+		"HasEnvVars": hasEnvVars,
+	}
+
+	files := map[string]string{
+		"main.tf":      awsLambdaMainTemplate,
+		"variables.tf": awsLambdaVariablesTemplate,
+		"outputs.tf":   awsLambdaOutputsTemplate,
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := writeLambdaTemplate(filepath.Join(modulePath, name), files[name], data, 0644); err != nil {
+			return fmt.Errorf("failed to generate %s: %w", name, err)
+		}
+	}
+
+	lg.logger.Info("Generated aws-lambda module",
+		zap.Int("functions", len(functions)),
+		zap.String("module_dir", modulePath))
+
+	return nil
+}
+
+// writeLambdaTemplate renders tmpl to path with the given file mode
+func writeLambdaTemplate(path, tmpl string, data interface{}, mode os.FileMode) error {
+	t := template.Must(template.New(filepath.Base(path)).Funcs(template.FuncMap{
+		"toLower": strings.ToLower,
+	}).Parse(tmpl))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return t.Execute(file, data)
+}
+
+// lambdaPathResources returns the API Gateway resources needed to serve paths, one per
+// distinct path prefix, parents before children
+func lambdaPathResources(paths []string) []lambdaPathResource {
+	seen := make(map[string]bool)
+	var resources []lambdaPathResource
+	for _, path := range paths {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		parent := ""
+		for i, segment := range segments {
+			if segment == "" {
+				break
+			}
+			prefix := "/" + strings.Join(segments[:i+1], "/")
+			name := lambdaResourceName(prefix)
+			if !seen[prefix] {
+				seen[prefix] = true
+				resources = append(resources, lambdaPathResource{
+					Name:     name,
+					Parent:   parent,
+					Path:     prefix,
+					PathPart: segment,
+				})
+			}
+			parent = name
+		}
+	}
+	return resources
+}
+
+// lambdaResourceNameInvalid matches the characters a path can't contribute to a Terraform name
+var lambdaResourceNameInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// lambdaResourceName names the API Gateway resource for a path ("/api/v1/users/{id}" ->
+// "api_v1_users_id"); the root path has no resource and returns ""
+func lambdaResourceName(path string) string {
+	return strings.Trim(lambdaResourceNameInvalid.ReplaceAllString(strings.ToLower(path), "_"), "_")
+}
+
+// Templates
+
+const lambdaEntrypointTemplate = `// Code generated by Wylla build system. DO NOT EDIT.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
+	"go.uber.org/zap"
+
+	"{{.ModuleName}}/{{.PackagePath}}"
+)
+
+var logger *zap.Logger
+
+func init() {
+	var err error
+
+	// Initialize logger
+	logger, err = zap.NewProduction()
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	// Expose deployment metadata to the handler (router.DeploymentInfoFromContext reads it)
+	setDefaultEnv("BOX_FUNCTION_NAME", "{{.FunctionName}}")
+	setDefaultEnv("BOX_ENVIRONMENT", os.Getenv("ENVIRONMENT"))
+	setDefaultEnv("BOX_REGION", os.Getenv("AWS_REGION"))
+
+	logger.Info("Lambda initialized",
+		zap.String("function", "{{.FunctionName}}"),
+		zap.String("environment", os.Getenv("BOX_ENVIRONMENT")),
+		zap.String("region", os.Getenv("BOX_REGION")))
+}
+
+// setDefaultEnv sets an environment variable unless the deployment already provides it
+func setDefaultEnv(key, value string) {
+	if os.Getenv(key) == "" && value != "" {
+		os.Setenv(key, value)
+	}
+}
+
+func main() {
+	// Translate API Gateway proxy events into net/http requests for the handler
+	adapter := httpadapter.New({{if .ReturnsHandler}}{{.PackageName}}.{{.FunctionName}}(){{else}}http.HandlerFunc({{.PackageName}}.{{.FunctionName}}){{end}})
+	lambda.Start(adapter.ProxyWithContext)
+}
+`
+
+const lambdaGoModTemplate = `module {{.ModuleName}}/build/lambdas/{{.Name}}
+
+go 1.22
+
+require (
+	github.com/aws/aws-lambda-go v1.47.0
+	github.com/awslabs/aws-lambda-go-api-proxy v0.16.2
+	go.uber.org/zap v1.26.0
+	{{.ModuleName}} v0.0.0
+)
+
+replace {{.ModuleName}} => ../../..
+`
+
+const lambdaSAMTemplate = `# AWS SAM template for {{.FunctionName}}
+# Generated by Wylla build system
+
+AWSTemplateFormatVersion: "2010-09-09"
+Transform: AWS::Serverless-2016-10-31
+Description: {{.FunctionName}} ({{.Route.Method}} {{.Route.Path}})
+
+Parameters:
+  Environment:
+    Type: String
+    Default: {{.Environment}}
+    AllowedValues: [dev, staging, production]
+  DatabaseURL:
+    Type: String
+    NoEcho: true
+
+Resources:
+  Function:
+    Type: AWS::Serverless::Function
+    Metadata:
+      BuildMethod: go1.x
+    Properties:
+      FunctionName: !Sub wylla-${Environment}-{{.Name}}
+      CodeUri: .
+      Handler: bootstrap
+      Runtime: provided.al2023
+      Architectures: [arm64]
+      MemorySize: {{.MemoryMB}}
+      Timeout: {{.TimeoutSeconds}}
+      Environment:
+        Variables:
+          DATABASE_URL: !Ref DatabaseURL
+          ENVIRONMENT: !Ref Environment
+          BOX_FUNCTION_NAME: {{.FunctionName}}
+{{- if .RequiredEnvVars}}
+          # Required by @box:env; set real values before deploying
+{{- range .RequiredEnvVars}}
+          {{.}}: REQUIRED
+{{- end}}
+{{- end}}
+{{- if .Project}}
+      Tags:
+        box:project: {{.Project}}
+{{- end}}
+      Events:
+        Api:
+          Type: Api
+          Properties:
+            Path: {{.Route.Path}}
+            Method: {{.Route.Method | toLower}}
+
+Outputs:
+  ApiUrl:
+    Description: URL of {{.Route.Method}} {{.Route.Path}}
+    Value: !Sub https://${ServerlessRestApi}.execute-api.${AWS::Region}.amazonaws.com/Prod{{.Route.Path}}
+`
+
+const lambdaBuildspecTemplate = `# AWS CodeBuild spec for {{.FunctionName}}
+# Generated by Wylla build system
+#
+# Builds bootstrap.zip (read by the aws-lambda Terraform module) and deploys the SAM stack.
+# Set ENVIRONMENT and DATABASE_URL in the CodeBuild project.
+
+version: 0.2
+
+env:
+  variables:
+    GOOS: linux
+    GOARCH: arm64
+    CGO_ENABLED: "0"
+
+phases:
+  install:
+    runtime-versions:
+      golang: 1.22
+  build:
+    commands:
+      - go build -tags lambda.norpc -o bootstrap .
+      - zip bootstrap.zip bootstrap
+  post_build:
+    commands:
+      - ./deploy.sh
+
+artifacts:
+  files:
+    - bootstrap.zip
+`
+
+const lambdaDeployScriptTemplate = `#!/bin/bash
+# Deploy script for {{.Name}}
+# Generated by Wylla build system
+
+set -e
+
+# Configuration
+STACK_NAME="wylla-${ENVIRONMENT:-{{.Environment}}}-{{.Name}}"
+REGION="${AWS_REGION:-{{.Region}}}"
+
+if [ -z "$DATABASE_URL" ]; then
+    echo "Error: DATABASE_URL is not set"
+    exit 1
+fi
+
+echo "Deploying lambda: {{.Name}} to stack: $STACK_NAME ($REGION)"
+
+sam build
+sam deploy \
+    --stack-name "$STACK_NAME" \
+    --region "$REGION" \
+    --resolve-s3 \
+    --capabilities CAPABILITY_IAM \
+    --no-confirm-changeset \
+    --no-fail-on-empty-changeset \
+    --parameter-overrides "Environment=${ENVIRONMENT:-{{.Environment}}} DatabaseURL=$DATABASE_URL"
+
+echo "Lambda deployed successfully!"
+aws cloudformation describe-stacks --stack-name "$STACK_NAME" --region "$REGION" \
+    --query "Stacks[0].Outputs[?OutputKey=='ApiUrl'].OutputValue" --output text
+`
+
+const awsLambdaMainTemplate = `# AWS Lambda Module
+# Generated by Wylla build system
+#
+# A standalone configuration for @box:lambda handlers, applied with AWS credentials:
+#   terraform -chdir=terraform/modules/aws-lambda init
+#   terraform -chdir=terraform/modules/aws-lambda apply -var environment=dev
+# Each function deploys the bootstrap.zip built by its buildspec.yml.
+
+terraform {
+  required_version = ">= 1.0"
+
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+  }
+}
+
+provider "aws" {
+  region = var.aws_region
+{{- if .Project}}
+
+  default_tags {
+    tags = {
+      "box:project" = "{{.Project}}"
+    }
+  }
+{{- end}}
+}
+
+# REST API routing each path to its Lambda function
+resource "aws_api_gateway_rest_api" "api" {
+  name = "wylla-${var.environment}-api"
+}
+{{range .Resources}}
+resource "aws_api_gateway_resource" "{{.Name}}" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+  parent_id   = {{if .Parent}}aws_api_gateway_resource.{{.Parent}}.id{{else}}aws_api_gateway_rest_api.api.root_resource_id{{end}}
+  path_part   = "{{.PathPart}}"
+}
+{{end}}
+{{- range .Functions}}
+# Lambda: {{.FunctionName}} ({{.Route.Method}} {{.Route.Path}})
+resource "aws_iam_role" "{{.Resource}}" {
+  name = "wylla-${var.environment}-{{.Name}}"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Action    = "sts:AssumeRole"
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "{{.Resource}}_logs" {
+  role       = aws_iam_role.{{.Resource}}.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_lambda_function" "{{.Resource}}" {
+  function_name    = "wylla-${var.environment}-{{.Name}}"
+  role             = aws_iam_role.{{.Resource}}.arn
+  filename         = "${path.module}/../../../lambdas/{{.Name}}/bootstrap.zip"
+  source_code_hash = filebase64sha256("${path.module}/../../../lambdas/{{.Name}}/bootstrap.zip")
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  memory_size      = {{.MemoryMB}}
+  timeout          = {{.TimeoutSeconds}}
+
+  environment {
+    variables = {
+      DATABASE_URL      = var.database_url
+      ENVIRONMENT       = var.environment
+      BOX_ENVIRONMENT   = var.environment
+      BOX_FUNCTION_NAME = "{{.FunctionName}}"
+{{- range .RequiredEnvVars}}
+      {{.}} = var.secrets["{{.}}"]
+{{- end}}
+    }
+  }
+}
+
+resource "aws_api_gateway_method" "{{.Resource}}" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  resource_id   = {{if .PathResource}}aws_api_gateway_resource.{{.PathResource}}.id{{else}}aws_api_gateway_rest_api.api.root_resource_id{{end}}
+  http_method   = "{{.Route.Method}}"
+  authorization = "NONE" # @box:auth is checked by the handler, not API Gateway
+}
+
+resource "aws_api_gateway_integration" "{{.Resource}}" {
+  rest_api_id             = aws_api_gateway_rest_api.api.id
+  resource_id             = aws_api_gateway_method.{{.Resource}}.resource_id
+  http_method             = aws_api_gateway_method.{{.Resource}}.http_method
+  integration_http_method = "POST"
+  type                    = "AWS_PROXY"
+  uri                     = aws_lambda_function.{{.Resource}}.invoke_arn
+}
+
+resource "aws_lambda_permission" "{{.Resource}}" {
+  statement_id  = "AllowAPIGatewayInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.{{.Resource}}.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_api_gateway_rest_api.api.execution_arn}/*/{{.Route.Method}}{{.Route.Path}}"
+}
+{{end}}
+# Redeploy the API whenever an integration changes
+resource "aws_api_gateway_deployment" "api" {
+  rest_api_id = aws_api_gateway_rest_api.api.id
+
+  triggers = {
+    redeployment = sha1(jsonencode([
+{{- range .Functions}}
+      aws_api_gateway_integration.{{.Resource}}.id,
+{{- end}}
+    ]))
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "aws_api_gateway_stage" "api" {
+  rest_api_id   = aws_api_gateway_rest_api.api.id
+  deployment_id = aws_api_gateway_deployment.api.id
+  stage_name    = var.environment
+}
+`
+
+const awsLambdaVariablesTemplate = `# AWS Lambda Module Variables
+
+variable "aws_region" {
+  description = "AWS region"
+  type        = string
+  default     = "{{.Region}}"
+}
+
+variable "environment" {
+  description = "Environment name (dev, staging, production)"
+  type        = string
+
+  validation {
+    condition     = contains(["dev", "staging", "production"], var.environment)
+    error_message = "Environment must be dev, staging, or production."
+  }
+}
+
+variable "database_url" {
+  description = "Database connection URL passed to every function"
+  type        = string
+  sensitive   = true
+}
+{{- if .HasEnvVars}}
+
+variable "secrets" {
+  description = "Values of the @box:env variables, keyed by name"
+  type        = map(string)
+  sensitive   = true
+}
+{{- end}}
+`
+
+const awsLambdaOutputsTemplate = `# AWS Lambda Module Outputs
+
+output "api_url" {
+  description = "Invoke URL of the REST API stage"
+  value       = aws_api_gateway_stage.api.invoke_url
+}
+
+output "function_arns" {
+  description = "Lambda function ARNs by handler"
+  value = {
+{{- range .Functions}}
+    "{{.FunctionName}}" = aws_lambda_function.{{.Resource}}.arn
+{{- end}}
+  }
+}
+`
@@ -0,0 +1,260 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// ManifestFile is the build manifest written to the output directory
+const ManifestFile = ".box-manifest.json"
+
+// Manifest records what produced each generated artifact, so the next build can skip
+// artifacts whose handlers haven't changed
+type Manifest struct {
+	ConfigHash string                      `json:"configHash"` // Hash of the Config fields every artifact depends on
+	Artifacts  map[string]ManifestArtifact `json:"artifacts"`  // Keyed by slash-separated path within the output directory (e.g., "functions/create-account")
+}
+
+// ManifestArtifact is the manifest entry of one generated artifact
+type ManifestArtifact struct {
+	Sources     map[string]string `json:"sources"` // Handler source files -> SHA-256
+	Hash        string            `json:"hash"`    // SHA-256 over the sources and the handlers' parsed annotations
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+// ManifestStats counts the artifacts of one build
+type ManifestStats struct {
+	Generated int // Artifacts written because their inputs changed or they were missing
+	Skipped   int // Artifacts left as they were
+	Removed   int // Artifacts of handlers or services that no longer exist, deleted from the output directory
+}
+
+// LoadManifest reads a build manifest; a missing file returns nil without error
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// Save writes the manifest to path
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// manifestConfigHash hashes the Config fields generated artifacts depend on; a change
+// to any of them (e.g., ProjectID, Region or ModuleName) invalidates the manifest
+func manifestConfigHash(config Config) string {
+	config.Handlers = nil
+	config.Logger = nil
+	config.CleanBuildDir = false
+	config.ForceRebuild = false
+	config.SkipGateway = false
+	config.SkipTerraform = false
+	config.ValidateOpenAPI = false
+	config.MaxConcurrency = 0
+
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// incrementalBuild tracks which artifacts a build regenerates against the previous
+// build's manifest. A nil *incrementalBuild regenerates everything
+type incrementalBuild struct {
+	outputDir string
+	previous  *Manifest // nil when there is no usable manifest
+	current   *Manifest
+	hashes    map[string]string // File hashes computed so far, by path
+	stats     ManifestStats
+	logger    *zap.Logger
+}
+
+// newIncrementalBuild loads the manifest in outputDir, discarding it when force is set
+// or it was written for a different configuration
+func newIncrementalBuild(outputDir, configHash string, force bool, logger *zap.Logger) (*incrementalBuild, error) {
+	b := &incrementalBuild{
+		outputDir: outputDir,
+		current:   &Manifest{ConfigHash: configHash, Artifacts: make(map[string]ManifestArtifact)},
+		hashes:    make(map[string]string),
+		logger:    logger,
+	}
+	if force {
+		return b, nil
+	}
+
+	previous, err := LoadManifest(filepath.Join(outputDir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case previous == nil:
+	case previous.ConfigHash != configHash:
+		logger.Info("Build configuration changed; regenerating every artifact")
+	default:
+		b.previous = previous
+	}
+	return b, nil
+}
+
+// upToDate records artifact as built from handlers and reports whether the previous
+// build already generated it from the same inputs, so it can be skipped
+func (b *incrementalBuild) upToDate(artifact string, handlers ...annotations.Handler) bool {
+	if b == nil {
+		return false
+	}
+
+	entry := b.artifact(handlers)
+	if previous, ok := b.previous.lookup(artifact); ok && previous.Hash == entry.Hash && b.exists(artifact) {
+		b.current.Artifacts[artifact] = previous
+		b.stats.Skipped++
+		b.logger.Debug("Artifact up to date", zap.String("artifact", artifact))
+		return true
+	}
+
+	b.current.Artifacts[artifact] = entry
+	b.stats.Generated++
+	return false
+}
+
+// rebuild records artifact as regenerated from handlers without consulting the previous
+// build, for artifacts built from more than the handlers' own sources
+func (b *incrementalBuild) rebuild(artifact string, handlers ...annotations.Handler) {
+	if b == nil {
+		return
+	}
+	b.current.Artifacts[artifact] = b.artifact(handlers)
+	b.stats.Generated++
+}
+
+// keep carries an artifact over from the previous manifest without checking it, for
+// generators skipped in this build (e.g., box watch --no-gateway)
+func (b *incrementalBuild) keep(artifact string) {
+	if b == nil {
+		return
+	}
+	if previous, ok := b.previous.lookup(artifact); ok {
+		b.current.Artifacts[artifact] = previous
+	}
+}
+
+// finish deletes the artifacts the previous build generated that this one didn't and
+// saves the new manifest
+func (b *incrementalBuild) finish() (ManifestStats, error) {
+	if b.previous != nil {
+		var stale []string
+		for artifact := range b.previous.Artifacts {
+			if _, ok := b.current.Artifacts[artifact]; !ok {
+				stale = append(stale, artifact)
+			}
+		}
+		sort.Strings(stale)
+
+		for _, artifact := range stale {
+			// Never follow a tampered manifest outside the output directory
+			if !filepath.IsLocal(filepath.FromSlash(artifact)) {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(b.outputDir, filepath.FromSlash(artifact))); err != nil {
+				return b.stats, fmt.Errorf("failed to remove stale artifact %s: %w", artifact, err)
+			}
+			b.logger.Info("Removed stale artifact", zap.String("artifact", artifact))
+			b.stats.Removed++
+		}
+	}
+
+	if err := b.current.Save(filepath.Join(b.outputDir, ManifestFile)); err != nil {
+		return b.stats, fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	return b.stats, nil
+}
+
+// artifact builds the manifest entry for an artifact generated from handlers
+func (b *incrementalBuild) artifact(handlers []annotations.Handler) ManifestArtifact {
+	entry := ManifestArtifact{
+		Sources:     make(map[string]string),
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	hash := sha256.New()
+	for _, handler := range handlers {
+		sources := []string{handler.FilePath}
+		for _, example := range []string{handler.RequestExample, handler.ResponseExample} {
+			if example != "" {
+				sources = append(sources, examplePath(handler, example))
+			}
+		}
+		for _, source := range sources {
+			if sum := b.fileHash(source); sum != "" {
+				entry.Sources[source] = sum
+			}
+		}
+
+		// The annotations also carry box.yaml defaults and anything a sidecar file set
+		data, _ := json.Marshal(handler)
+		hash.Write(data)
+	}
+
+	// Sources is a map, so encoding/json writes it in sorted order
+	data, _ := json.Marshal(entry.Sources)
+	hash.Write(data)
+	entry.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	return entry
+}
+
+// fileHash returns the SHA-256 of a file, or "" when it can't be read
+func (b *incrementalBuild) fileHash(path string) string {
+	if path == "" {
+		return ""
+	}
+	if sum, ok := b.hashes[path]; ok {
+		return sum
+	}
+
+	sum := ""
+	if data, err := os.ReadFile(path); err == nil {
+		digest := sha256.Sum256(data)
+		sum = hex.EncodeToString(digest[:])
+	}
+	b.hashes[path] = sum
+	return sum
+}
+
+// exists reports whether an artifact is still present in the output directory
+func (b *incrementalBuild) exists(artifact string) bool {
+	_, err := os.Stat(filepath.Join(b.outputDir, filepath.FromSlash(artifact)))
+	return err == nil
+}
+
+// lookup returns an artifact's entry; a nil manifest has none
+func (m *Manifest) lookup(artifact string) (ManifestArtifact, bool) {
+	if m == nil {
+		return ManifestArtifact{}, false
+	}
+	entry, ok := m.Artifacts[artifact]
+	return entry, ok
+}
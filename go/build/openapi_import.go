@@ -0,0 +1,362 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gravelight-studio/box/go/annotations"
+	"github.com/gravelight-studio/box/go/config"
+)
+
+// openAPIDocument is the subset of an OpenAPI 3 document needed to scaffold handlers
+type openAPIDocument struct {
+	Security   []map[string][]string                 `yaml:"security"`
+	Paths      map[string]map[string]openAPIImportOp `yaml:"paths"`
+	Management struct {
+		Quota struct {
+			Limits []openAPIQuotaLimit `yaml:"limits"`
+		} `yaml:"quota"`
+	} `yaml:"x-google-management"`
+}
+
+// openAPIImportOp is a single operation as read from an OpenAPI document
+type openAPIImportOp struct {
+	OperationID string                 `yaml:"operationId"`
+	Summary     string                 `yaml:"summary"`
+	Description string                 `yaml:"description"`
+	Tags        []string               `yaml:"tags"`
+	Security    *[]map[string][]string `yaml:"security"` // nil inherits the document-level security
+	Quota       *openAPIImportQuota    `yaml:"x-google-quota"`
+}
+
+// openAPIImportQuota maps quota metrics to their per-request cost
+type openAPIImportQuota struct {
+	MetricCosts map[string]int `yaml:"metricCosts"`
+}
+
+// openAPIQuotaLimit is a GCP API Gateway quota limit (x-google-management.quota.limits)
+type openAPIQuotaLimit struct {
+	Name   string         `yaml:"name"`
+	Metric string         `yaml:"metric"`
+	Unit   string         `yaml:"unit"`   // e.g., "1/min/{project}"
+	Values map[string]int `yaml:"values"` // e.g., {"STANDARD": 100}
+}
+
+// openAPIMethods lists the operation keys recognised under a path item, in output order
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+// ImportOpenAPI converts an OpenAPI 3 document (YAML or JSON) into handler definitions
+// Paths, methods, summaries, tags, security requirements and GCP quotas are mapped to
+// annotations; request and response schemas are not imported. Tags that @box:tags can't
+// carry (e.g., "User Management") are slugified, and the returned docs tags keep their
+// original names as display names for box.yaml
+func ImportOpenAPI(data []byte) ([]annotations.Handler, []config.TagConfig, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	if len(doc.Paths) == 0 {
+		return nil, nil, fmt.Errorf("OpenAPI document has no paths")
+	}
+
+	// Index quota limits by metric name
+	limits := make(map[string]openAPIQuotaLimit)
+	for _, limit := range doc.Management.Quota.Limits {
+		limits[limit.Metric] = limit
+	}
+
+	// Sort paths for deterministic output
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var handlers []annotations.Handler
+	usedNames := make(map[string]bool)
+	tags := newTagSlugs()
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, method := range openAPIMethods {
+			op, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			// Derive a unique exported Go function name
+			name := goIdentifier(op.OperationID)
+			if name == "" {
+				name = goIdentifier(method + " " + path)
+			}
+			base := name
+			for i := 2; usedNames[name]; i++ {
+				name = fmt.Sprintf("%s%d", base, i)
+			}
+			usedNames[name] = true
+
+			handler := annotations.Handler{
+				FunctionName:   name,
+				PackageName:    "handlers",
+				DeploymentType: annotations.DeploymentFunction,
+				Route: annotations.Route{
+					Method: strings.ToUpper(method),
+					Path:   path,
+				},
+				Summary:     strings.Join(strings.Fields(op.Summary), " "),
+				Description: strings.TrimSpace(op.Description),
+			}
+			for _, tag := range op.Tags {
+				if strings.TrimSpace(tag) != "" {
+					handler.Tags = append(handler.Tags, tags.slug(tag))
+				}
+			}
+
+			// Operation-level security overrides the document default
+			security := doc.Security
+			if op.Security != nil {
+				security = *op.Security
+			}
+			handler.Auth = annotations.AuthConfig{Type: authTypeFromSecurity(security)}
+
+			handler.RateLimit = rateLimitFromQuota(op.Quota, limits)
+
+			handlers = append(handlers, handler)
+		}
+	}
+
+	return handlers, tags.docs, nil
+}
+
+// tagSlugs maps OpenAPI tags to names valid in @box:tags, giving each distinct tag its own
+type tagSlugs struct {
+	slugs map[string]string // original tag -> slug
+	used  map[string]bool
+	docs  []config.TagConfig // renamed tags, in first-use order
+}
+
+func newTagSlugs() *tagSlugs {
+	return &tagSlugs{slugs: make(map[string]string), used: make(map[string]bool)}
+}
+
+// slug returns the name to annotate tag with, recording a display name when it differs
+func (t *tagSlugs) slug(tag string) string {
+	if slug, ok := t.slugs[tag]; ok {
+		return slug
+	}
+
+	slug := tagSlug(tag)
+	if slug != tag || t.used[slug] {
+		base := slug
+		for i := 2; t.used[slug]; i++ {
+			suffix := fmt.Sprintf("-%d", i)
+			slug = strings.TrimRight(base[:min(len(base), maxTagLength-len(suffix))], "-_.") + suffix
+		}
+		t.docs = append(t.docs, config.TagConfig{Name: slug, DisplayName: tag})
+	}
+	t.slugs[tag] = slug
+	t.used[slug] = true
+	return slug
+}
+
+// maxTagLength is the longest tag @box:tags accepts
+const maxTagLength = 64
+
+// tagSlug returns tag unchanged when @box:tags accepts it (letters, digits, '-', '_' and
+// '.', starting with a letter or digit). Otherwise it lowercases the tag and joins its
+// words with '-', e.g., "User Management" -> "user-management"
+func tagSlug(tag string) string {
+	valid := tag != "" && len(tag) <= maxTagLength && isTagAlnum(rune(tag[0]))
+	for _, r := range tag {
+		if !isTagAlnum(r) && r != '-' && r != '_' && r != '.' {
+			valid = false
+		}
+	}
+	if valid {
+		return tag
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(tag) {
+		if !isTagAlnum(r) {
+			dash = true
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+		dash = false
+	}
+
+	// Tags without an ASCII letter or digit have nothing to keep
+	slug := strings.TrimRight(b.String()[:min(b.Len(), maxTagLength)], "-")
+	if slug == "" {
+		return "tag"
+	}
+	return slug
+}
+
+// isTagAlnum reports whether r is an ASCII letter or digit
+func isTagAlnum(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// authTypeFromSecurity maps OpenAPI security requirements to an auth type
+// An empty requirement object ({}) alongside others marks authentication as optional
+func authTypeFromSecurity(security []map[string][]string) annotations.AuthType {
+	if len(security) == 0 {
+		return annotations.AuthNone
+	}
+
+	hasScheme, allowsAnonymous := false, false
+	for _, requirement := range security {
+		if len(requirement) == 0 {
+			allowsAnonymous = true
+		} else {
+			hasScheme = true
+		}
+	}
+
+	switch {
+	case hasScheme && allowsAnonymous:
+		return annotations.AuthOptional
+	case hasScheme:
+		return annotations.AuthRequired
+	default:
+		return annotations.AuthNone
+	}
+}
+
+// rateLimitFromQuota maps a GCP quota metric cost to a per-minute rate limit
+func rateLimitFromQuota(quota *openAPIImportQuota, limits map[string]openAPIQuotaLimit) *annotations.RateLimitConfig {
+	if quota == nil {
+		return nil
+	}
+
+	// Sort metrics so the chosen limit is deterministic
+	metrics := make([]string, 0, len(quota.MetricCosts))
+	for metric := range quota.MetricCosts {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	for _, metric := range metrics {
+		limit, ok := limits[metric]
+		if !ok || !strings.HasPrefix(limit.Unit, "1/min/") {
+			continue
+		}
+
+		cost := quota.MetricCosts[metric]
+		if cost <= 0 {
+			cost = 1
+		}
+
+		count := limit.Values["STANDARD"] / cost
+		if count <= 0 {
+			continue
+		}
+
+		raw := fmt.Sprintf("%d/minute", count)
+		return &annotations.RateLimitConfig{
+			Count:  count,
+			Period: time.Minute,
+			Raw:    raw,
+		}
+	}
+
+	return nil
+}
+
+// goIdentifier converts an operationId or route into an exported Go identifier
+// e.g., "listUsers" -> "ListUsers", "get /users/{id}" -> "GetUsersId"
+func goIdentifier(s string) string {
+	var b strings.Builder
+	upperNext := true
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upperNext = true
+			continue
+		}
+		if upperNext {
+			b.WriteRune(unicode.ToUpper(r))
+			upperNext = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	name := b.String()
+	if name != "" && !unicode.IsLetter(rune(name[0])) {
+		name = "Handle" + name
+	}
+	return name
+}
+
+// ScaffoldHandlers writes a Go source file with annotated handler stubs
+// Each stub responds 501 Not Implemented until the developer fills it in
+func ScaffoldHandlers(w io.Writer, packageName string, handlers []annotations.Handler) error {
+	tmpl := template.Must(template.New("scaffold").Funcs(template.FuncMap{
+		"join":         strings.Join,
+		"commentLines": commentLines,
+	}).Parse(scaffoldTemplate))
+
+	data := struct {
+		PackageName string
+		Handlers    []annotations.Handler
+	}{
+		PackageName: packageName,
+		Handlers:    handlers,
+	}
+
+	return tmpl.Execute(w, data)
+}
+
+// commentLines continues multi-line text over // comment lines
+func commentLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.TrimRight("// "+lines[i], " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+const scaffoldTemplate = `package {{.PackageName}}
+
+import (
+	"net/http"
+)
+
+// Handler stubs scaffolded from an OpenAPI specification by box init --from-openapi
+{{range .Handlers}}
+// {{.FunctionName}} handles {{.Route.Method}} {{.Route.Path}}
+// @box:function
+// @box:path {{.Route.Method}} {{.Route.Path}}
+// @box:auth {{.Auth.Type}}
+{{- if .Summary}}
+// @box:summary {{.Summary}}
+{{- end}}
+{{- if .Description}}
+// @box:description {{commentLines .Description}}
+{{- end}}
+{{- if .RateLimit}}
+// @box:ratelimit {{.RateLimit.Raw}}
+{{- end}}
+{{- if .Tags}}
+// @box:tags {{join .Tags ","}}
+{{- end}}
+func {{.FunctionName}}(w http.ResponseWriter, r *http.Request) {
+	// TODO: implement
+	http.Error(w, "{\"error\":\"Not implemented\"}", http.StatusNotImplemented)
+}
+{{end}}`
@@ -0,0 +1,257 @@
+package build
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// DeploymentPlan is the provider-agnostic description of what a build deploys
+// It is derived once from the parsed handlers; target renderers (the GCP function,
+// container, gateway and Terraform generators, and the AWS Lambda generator) only consume it
+type DeploymentPlan struct {
+	Functions   []annotations.Handler // Handlers deployed as standalone functions, in source order
+	Services    []ServiceGroup        // Container handlers grouped into services, sorted by name, then by route
+	Lambdas     []annotations.Handler // Handlers deployed as AWS Lambda functions, in source order
+	Routes      []RoutePlan           // Operations exposed through the API gateway, in source order
+	TaskQueues  []string              // Distinct @box:task-queue queues, sorted by name
+	TaskTargets []annotations.Handler // Handlers processing a task queue, in source order
+	Scheduled   []annotations.Handler // Handlers triggered by a Cloud Scheduler job, in source order
+	Subscribers []annotations.Handler // Handlers fed by a Pub/Sub push subscription, in source order
+	Topics      []string              // Distinct @box:pubsub topics, sorted by name
+	Networking  NetworkingPlan
+}
+
+// ServiceGroup represents a group of handlers that will be deployed together
+type ServiceGroup struct {
+	Name     string
+	Handlers []annotations.Handler
+}
+
+// DefaultMaxInstances caps a Cloud Run service whose handlers set no @box:max-instances
+const DefaultMaxInstances = 10
+
+// InstanceScaling holds the instance bounds of a deployed service
+type InstanceScaling struct {
+	Min int // Instances kept warm; 0 lets the service scale to zero
+	Max int
+}
+
+// Scaling combines the @box:min-instances and @box:max-instances of the group's handlers:
+// the service keeps the most warm instances any handler asks for and may grow to the
+// highest cap any declares. Without a declared cap it stays at DefaultMaxInstances,
+// raised to the minimum if that is higher
+func (g ServiceGroup) Scaling() (InstanceScaling, error) {
+	var scaling InstanceScaling
+	var minHandler string
+	for _, handler := range g.Handlers {
+		if handler.MinInstances > scaling.Min {
+			scaling.Min, minHandler = handler.MinInstances, handler.FunctionName
+		}
+		scaling.Max = max(scaling.Max, handler.MaxInstances)
+	}
+
+	if scaling.Max == 0 {
+		scaling.Max = max(DefaultMaxInstances, scaling.Min)
+	} else if scaling.Min > scaling.Max {
+		return InstanceScaling{}, fmt.Errorf("service %s: %s keeps %d instances warm but the service allows at most %d",
+			g.Name, minHandler, scaling.Min, scaling.Max)
+	}
+	return scaling, nil
+}
+
+// RoutePlan is one gateway operation and the deployed unit serving it
+type RoutePlan struct {
+	Handler annotations.Handler
+	Backend Backend
+}
+
+// Backend identifies the function or service behind a route
+type Backend struct {
+	Type annotations.DeploymentType
+	Name string // Kebab-case function name (also for proxies), or the service name
+}
+
+// NetworkingPlan holds placement settings shared by every deployed unit
+type NetworkingPlan struct {
+	Region     string   // Primary region, used by single-region resources
+	Regions    []string // Service regions; more than one puts services behind a global load balancer
+	HealthPath string   // Health endpoint served by every service
+}
+
+// NewDeploymentPlan normalizes handlers into a deployment plan
+func NewDeploymentPlan(handlers []annotations.Handler, networking NetworkingPlan) *DeploymentPlan {
+	plan := &DeploymentPlan{Networking: networking}
+
+	services := make(map[string][]annotations.Handler)
+	queues := make(map[string]bool)
+	topics := make(map[string]bool)
+
+	for _, handler := range handlers {
+		backend := Backend{Type: handler.DeploymentType}
+
+		switch handler.DeploymentType {
+		case annotations.DeploymentFunction:
+			plan.Functions = append(plan.Functions, handler)
+			backend.Name = toKebabCase(handler.FunctionName)
+		case annotations.DeploymentContainer:
+			name := serviceName(handler)
+			services[name] = append(services[name], handler)
+			backend.Name = name
+		case annotations.DeploymentLambda:
+			// Lambdas are routed by their own AWS API Gateway, not the GCP gateway
+			plan.Lambdas = append(plan.Lambdas, handler)
+			continue
+		case annotations.DeploymentProxy:
+			// Proxies deploy nothing; the gateway routes straight to the upstream
+			backend.Name = toKebabCase(handler.FunctionName)
+		}
+
+		// Cloud Tasks targets are invoked by their queue, not through the gateway
+		if handler.TaskQueue != "" {
+			plan.TaskTargets = append(plan.TaskTargets, handler)
+			if !queues[handler.TaskQueue] {
+				queues[handler.TaskQueue] = true
+				plan.TaskQueues = append(plan.TaskQueues, handler.TaskQueue)
+			}
+			continue
+		}
+
+		// Scheduled handlers are invoked by their Cloud Scheduler job and have no route
+		if handler.Schedule != nil {
+			plan.Scheduled = append(plan.Scheduled, handler)
+			continue
+		}
+
+		// Pub/Sub subscribers receive push deliveries and have no route
+		if handler.PubSub != nil {
+			plan.Subscribers = append(plan.Subscribers, handler)
+			if !topics[handler.PubSub.TopicID] {
+				topics[handler.PubSub.TopicID] = true
+				plan.Topics = append(plan.Topics, handler.PubSub.TopicID)
+			}
+			continue
+		}
+
+		plan.Routes = append(plan.Routes, RoutePlan{Handler: handler, Backend: backend})
+	}
+
+	for name, grouped := range services {
+		// Order a service's handlers by route, so its entrypoint doesn't depend on source order
+		sort.SliceStable(grouped, func(i, j int) bool {
+			a, b := grouped[i], grouped[j]
+			if a.Route.Path != b.Route.Path {
+				return a.Route.Path < b.Route.Path
+			}
+			if a.Route.Method != b.Route.Method {
+				return a.Route.Method < b.Route.Method
+			}
+			return a.FunctionName < b.FunctionName
+		})
+		plan.Services = append(plan.Services, ServiceGroup{
+			Name:     name,
+			Handlers: grouped,
+		})
+	}
+
+	// Sort for consistent output
+	sort.Slice(plan.Services, func(i, j int) bool {
+		return plan.Services[i].Name < plan.Services[j].Name
+	})
+	sort.Strings(plan.TaskQueues)
+	sort.Strings(plan.Topics)
+
+	return plan
+}
+
+// serviceName returns the service a container handler is deployed in (its package)
+func serviceName(handler annotations.Handler) string {
+	if handler.PackageName == "" {
+		return "default"
+	}
+	return handler.PackageName
+}
+
+// MultiRegion reports whether services are deployed to several regions
+func (p *DeploymentPlan) MultiRegion() bool {
+	return len(p.Services) > 0 && len(p.Networking.Regions) > 1
+}
+
+// ContainerHandlers returns the handlers of every service
+func (p *DeploymentPlan) ContainerHandlers() []annotations.Handler {
+	var handlers []annotations.Handler
+	for _, service := range p.Services {
+		handlers = append(handlers, service.Handlers...)
+	}
+	return handlers
+}
+
+// WithoutDeprecatedRoutes returns a copy of the plan whose Routes leave out @box:deprecated
+// handlers. Their functions and services are still in the plan, so they stay deployed
+func (p *DeploymentPlan) WithoutDeprecatedRoutes() *DeploymentPlan {
+	filtered := *p
+	filtered.Routes = nil
+	for _, route := range p.Routes {
+		if !route.Handler.Deprecated {
+			filtered.Routes = append(filtered.Routes, route)
+		}
+	}
+	return &filtered
+}
+
+// Empty reports whether the plan deploys nothing to GCP
+func (p *DeploymentPlan) Empty() bool {
+	return len(p.Functions) == 0 && len(p.Services) == 0 && len(p.Routes) == 0
+}
+
+// BuildPlan lists the artifacts a Generator writes, computed from the handler model
+// without rendering anything. Paths are slash-separated and relative to the output
+// directory, like those of ListOutputFiles
+type BuildPlan struct {
+	OutputDir  string
+	Functions  []PlannedArtifact // Cloud Functions, one per handler, in source order
+	Services   []PlannedArtifact // Cloud Run services, sorted by name
+	Lambdas    []PlannedArtifact // AWS Lambda functions, in source order; empty without an AWS target
+	Gateway    *PlannedGateway   // nil when the build writes no gateway configuration
+	Terraform  *PlannedTerraform // nil when the build writes no Terraform
+	Kubernetes []PlannedArtifact // Kubernetes manifests, one per service, when requested
+	Firebase   string            // Path of firebase.json, when requested
+	Schemas    string            // Directory of the JSON Schema files, when requested and any handler has a body type
+}
+
+// PlannedArtifact is one deployed unit and the directory it is generated in
+type PlannedArtifact struct {
+	Name     string   // Function or service name, as deployed
+	Path     string   // Directory relative to the output directory
+	Handlers []string // Qualified handler names (package.Function) it serves
+}
+
+// PlannedGateway is the gateway configuration a build writes
+type PlannedGateway struct {
+	Backend    string // GatewayGCP or GatewayEnvoy
+	Path       string
+	Operations []PlannedOperation // In source order
+}
+
+// PlannedOperation is one operation of the generated OpenAPI spec
+type PlannedOperation struct {
+	OperationID string
+	Method      string
+	Path        string
+	Backend     Backend
+}
+
+// PlannedTerraform is the Terraform configuration a build writes
+type PlannedTerraform struct {
+	Path    string
+	Modules []string // Module names under modules/, sorted
+}
+
+// qualifiedName returns a handler's package.Function name
+func qualifiedName(handler annotations.Handler) string {
+	if handler.PackageName == "" {
+		return handler.FunctionName
+	}
+	return handler.PackageName + "." + handler.FunctionName
+}
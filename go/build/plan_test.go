@@ -0,0 +1,292 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+func TestNewDeploymentPlan(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/accounts"},
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/chat/{id}/stream"},
+		},
+		{
+			FunctionName:   "CreateUser",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "POST", Path: "/users"},
+		},
+		{
+			FunctionName:   "ProcessOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/tasks/orders"},
+			TaskQueue:      "orders",
+		},
+		{
+			FunctionName:   "PurgeSessions",
+			PackageName:    "sessions",
+			DeploymentType: annotations.DeploymentFunction,
+			Schedule:       &annotations.ScheduleConfig{Cron: "0 3 * * *", Timezone: "UTC"},
+		},
+		{
+			FunctionName:   "OnOrderPlaced",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			PubSub:         &annotations.PubSubConfig{TopicID: "orders"},
+		},
+		{
+			FunctionName:   "Ping",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/ping"},
+		},
+		{
+			FunctionName:   "ExportReport",
+			PackageName:    "reports",
+			DeploymentType: annotations.DeploymentLambda,
+			Route:          annotations.Route{Method: "POST", Path: "/reports"},
+		},
+	}
+
+	plan := NewDeploymentPlan(handlers, NetworkingPlan{
+		Region:     "us-central1",
+		Regions:    []string{"us-central1", "europe-west1"},
+		HealthPath: "/health",
+	})
+
+	// Functions keep source order, including task targets
+	require.Len(t, plan.Functions, 4)
+	assert.Equal(t, "CreateAccount", plan.Functions[0].FunctionName)
+	assert.Equal(t, "ProcessOrder", plan.Functions[1].FunctionName)
+	assert.Equal(t, "PurgeSessions", plan.Functions[2].FunctionName)
+	assert.Equal(t, "OnOrderPlaced", plan.Functions[3].FunctionName)
+
+	// Services are grouped by package and sorted; handlers without a package share "default"
+	require.Len(t, plan.Services, 3)
+	assert.Equal(t, "chat", plan.Services[0].Name)
+	assert.Equal(t, "default", plan.Services[1].Name)
+	assert.Equal(t, "users", plan.Services[2].Name)
+	require.Len(t, plan.Services[2].Handlers, 2)
+	assert.Equal(t, "ListUsers", plan.Services[2].Handlers[0].FunctionName)
+	assert.Len(t, plan.ContainerHandlers(), 4)
+
+	// Task targets are planned but not routed through the gateway
+	assert.Equal(t, []string{"orders"}, plan.TaskQueues)
+	require.Len(t, plan.TaskTargets, 1)
+	assert.Equal(t, "ProcessOrder", plan.TaskTargets[0].FunctionName)
+
+	// Scheduled and Pub/Sub handlers have no route
+	require.Len(t, plan.Scheduled, 1)
+	assert.Equal(t, "PurgeSessions", plan.Scheduled[0].FunctionName)
+	require.Len(t, plan.Subscribers, 1)
+	assert.Equal(t, "OnOrderPlaced", plan.Subscribers[0].FunctionName)
+	assert.Equal(t, []string{"orders"}, plan.Topics)
+
+	// Lambdas are served by their own AWS API Gateway
+	require.Len(t, plan.Lambdas, 1)
+	assert.Equal(t, "ExportReport", plan.Lambdas[0].FunctionName)
+
+	require.Len(t, plan.Routes, 5)
+	backends := make(map[string]Backend)
+	for _, route := range plan.Routes {
+		backends[route.Handler.FunctionName] = route.Backend
+	}
+	assert.NotContains(t, backends, "ProcessOrder")
+	assert.NotContains(t, backends, "PurgeSessions")
+	assert.NotContains(t, backends, "OnOrderPlaced")
+	assert.NotContains(t, backends, "ExportReport")
+	assert.Equal(t, Backend{Type: annotations.DeploymentFunction, Name: "create-account"}, backends["CreateAccount"])
+	assert.Equal(t, Backend{Type: annotations.DeploymentContainer, Name: "users"}, backends["CreateUser"])
+	assert.Equal(t, Backend{Type: annotations.DeploymentContainer, Name: "default"}, backends["Ping"])
+
+	assert.True(t, plan.MultiRegion())
+	assert.False(t, plan.Empty())
+}
+
+func TestNewDeploymentPlan_MultiRegionNeedsServices(t *testing.T) {
+	plan := NewDeploymentPlan([]annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/accounts"},
+		},
+	}, NetworkingPlan{Regions: []string{"us-central1", "europe-west1"}})
+
+	// Regions only apply to services, so a functions-only plan stays single-region
+	assert.False(t, plan.MultiRegion())
+
+	assert.True(t, NewDeploymentPlan(nil, NetworkingPlan{}).Empty())
+}
+
+func TestGeneratorPlan_MatchesOutput(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "CreateAccount",
+			PackageName:    "accounts",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/accounts"},
+		},
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+		{
+			FunctionName:   "CheckUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "HEAD", Path: "/users"},
+		},
+		{
+			FunctionName:   "StreamChat",
+			PackageName:    "chat",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/chat/{id}/stream"},
+		},
+		{
+			FunctionName:   "ProcessOrder",
+			PackageName:    "orders",
+			DeploymentType: annotations.DeploymentFunction,
+			Route:          annotations.Route{Method: "POST", Path: "/tasks/orders"},
+			TaskQueue:      "orders",
+		},
+		{
+			FunctionName:   "GetReport",
+			PackageName:    "reports",
+			PackagePath:    "internal/reports",
+			DeploymentType: annotations.DeploymentLambda,
+			Route:          annotations.Route{Method: "GET", Path: "/reports/{id}"},
+		},
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "build")
+	gen := NewGenerator(Config{
+		Handlers:         handlers,
+		OutputDir:        outputDir,
+		ModuleName:       "github.com/gravelight-studio/box",
+		ProjectID:        "test-project",
+		Logger:           zap.NewNop(),
+		AWS:              &AWSConfig{Project: "acme-api"},
+		KubernetesOutput: true,
+		Firebase:         true,
+	})
+
+	plan, err := gen.Plan()
+	require.NoError(t, err)
+	_, err = os.Stat(outputDir)
+	assert.True(t, os.IsNotExist(err), "Plan() should not write the output directory")
+
+	artifactPaths := func(artifacts []PlannedArtifact) []string {
+		var paths []string
+		for _, artifact := range artifacts {
+			paths = append(paths, artifact.Path)
+		}
+		return paths
+	}
+	assert.Equal(t, []string{"functions/create-account", "functions/process-order"}, artifactPaths(plan.Functions))
+	assert.Equal(t, []string{"containers/chat", "containers/users"}, artifactPaths(plan.Services))
+	assert.Equal(t, []string{"users.ListUsers", "users.CheckUsers"}, plan.Services[1].Handlers)
+	assert.Equal(t, []string{"lambdas/get-report"}, artifactPaths(plan.Lambdas))
+	assert.Equal(t, []string{"k8s/chat", "k8s/users"}, artifactPaths(plan.Kubernetes))
+	assert.Equal(t, "firebase.json", plan.Firebase)
+	require.NotNil(t, plan.Terraform)
+	assert.Equal(t, []string{"api-gateway", "aws-lambda", "cloud-functions", "cloud-run", "cloud-tasks", "networking"}, plan.Terraform.Modules)
+
+	// The task target has no route and API Gateway answers HEAD itself
+	require.NotNil(t, plan.Gateway)
+	assert.Equal(t, GatewayGCP, plan.Gateway.Backend)
+	assert.Equal(t, []PlannedOperation{
+		{OperationID: "CreateAccount", Method: "POST", Path: "/accounts", Backend: Backend{Type: annotations.DeploymentFunction, Name: "create-account"}},
+		{OperationID: "ListUsers", Method: "GET", Path: "/users", Backend: Backend{Type: annotations.DeploymentContainer, Name: "users"}},
+		{OperationID: "StreamChat", Method: "GET", Path: "/chat/{id}/stream", Backend: Backend{Type: annotations.DeploymentContainer, Name: "chat"}},
+	}, plan.Gateway.Operations)
+
+	mustGenerate(t, gen)
+
+	// Every planned artifact was generated, and nothing else
+	files, err := ListOutputFiles(outputDir)
+	require.NoError(t, err)
+	generated := make(map[string]bool)
+	for path := range files {
+		parts := strings.SplitN(path, "/", 3)
+		switch {
+		case len(parts) == 3 && parts[0] != "gateway" && parts[0] != "terraform":
+			generated[parts[0]+"/"+parts[1]] = true
+		default:
+			generated[parts[0]] = true
+		}
+	}
+	planned := map[string]bool{plan.Gateway.Path: true, plan.Terraform.Path: true, plan.Firebase: true}
+	for _, artifacts := range [][]PlannedArtifact{plan.Functions, plan.Services, plan.Lambdas, plan.Kubernetes} {
+		for _, artifact := range artifacts {
+			planned[artifact.Path] = true
+		}
+	}
+	for path := range generated {
+		if path == "k8s" || path == "lambdas" {
+			continue // Shared files next to the per-service directories
+		}
+		assert.True(t, planned[path], "generated %s is not in the plan", path)
+	}
+	for path := range planned {
+		assert.True(t, generated[path], "planned %s was not generated", path)
+	}
+
+	modules, err := os.ReadDir(filepath.Join(outputDir, "terraform", "modules"))
+	require.NoError(t, err)
+	var moduleNames []string
+	for _, module := range modules {
+		if entries, _ := os.ReadDir(filepath.Join(outputDir, "terraform", "modules", module.Name())); len(entries) > 0 {
+			moduleNames = append(moduleNames, module.Name())
+		}
+	}
+	assert.Equal(t, plan.Terraform.Modules, moduleNames)
+
+	spec, err := os.ReadFile(filepath.Join(outputDir, "gateway", "openapi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, len(plan.Gateway.Operations), strings.Count(string(spec), "operationId:"))
+	for _, operation := range plan.Gateway.Operations {
+		assert.Contains(t, string(spec), "operationId: "+operation.OperationID+"\n")
+	}
+}
+
+func TestGeneratorPlan_Errors(t *testing.T) {
+	handlers := []annotations.Handler{
+		{
+			FunctionName:   "ListUsers",
+			PackageName:    "users",
+			DeploymentType: annotations.DeploymentContainer,
+			Route:          annotations.Route{Method: "GET", Path: "/users"},
+		},
+	}
+
+	_, err := NewGenerator(Config{Handlers: handlers, Gateway: "kong", Logger: zap.NewNop()}).Plan()
+	assert.ErrorContains(t, err, `unsupported gateway "kong"`)
+
+	_, err = NewGenerator(Config{Handlers: handlers, CanaryPercent: 150, Logger: zap.NewNop()}).Plan()
+	assert.ErrorContains(t, err, "invalid canary percentage")
+}
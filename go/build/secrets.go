@@ -0,0 +1,175 @@
+package build
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// Secret modes selectable via Config.SecretsMode
+const (
+	SecretsEnv     = "env"     // Terraform reads secrets and sets them as environment variables
+	SecretsRuntime = "runtime" // Entry points read secrets from Secret Manager at startup
+)
+
+// Secret Manager client module required by functions reading secrets at runtime
+const (
+	secretManagerModule  = "cloud.google.com/go/secretmanager"
+	secretManagerVersion = "v1.11.5"
+)
+
+// validateSecretsMode checks a Config.SecretsMode value
+func validateSecretsMode(mode string) error {
+	if mode != SecretsEnv && mode != SecretsRuntime {
+		return fmt.Errorf("unsupported secrets mode %q (expected %q or %q)", mode, SecretsEnv, SecretsRuntime)
+	}
+	return nil
+}
+
+// defaultSecrets maps the environment variables a handler reads from Secret Manager without
+// @box:secret: DATABASE_URL and each @box:env variable, from "<name in kebab case>-${env}"
+func defaultSecrets(handler annotations.Handler) map[string]string {
+	secrets := map[string]string{"DATABASE_URL": "database-url-" + annotations.SecretEnvironment}
+	for _, name := range handler.RequiredEnvVars {
+		secrets[name] = envSecretID(name) + "-" + annotations.SecretEnvironment
+	}
+	return secrets
+}
+
+// unitSecrets maps the environment variables of one function, or of the handlers sharing a
+// container service, to the secrets they are read from. @box:secret bindings replace the
+// defaults and must agree between the handlers
+func unitSecrets(unit string, handlers []annotations.Handler) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, handler := range handlers {
+		maps.Copy(secrets, defaultSecrets(handler))
+	}
+
+	declaredBy := make(map[string]string)
+	for _, handler := range handlers {
+		for _, name := range slices.Sorted(maps.Keys(handler.Secrets)) {
+			id := handler.Secrets[name]
+			if other, ok := declaredBy[name]; ok && secrets[name] != id {
+				return nil, fmt.Errorf("service %s: %s reads %s from secret %s but %s reads it from %s",
+					unit, handler.FunctionName, name, id, other, secrets[name])
+			}
+			declaredBy[name] = handler.FunctionName
+			secrets[name] = id
+		}
+	}
+	return secrets, nil
+}
+
+// secretEntry is a variable/secret pair of the secrets map in a generated entry point; Key is
+// the quoted variable name and colon, padded to align the values as gofmt does
+type secretEntry struct {
+	Key    string
+	Secret string
+}
+
+// secretEntries returns the secrets map literal of a generated entry point, sorted by variable
+func secretEntries(secrets map[string]string) []secretEntry {
+	names := slices.Sorted(maps.Keys(secrets))
+	width := 0
+	for _, name := range names {
+		width = max(width, len(strconv.Quote(name))+1)
+	}
+
+	entries := make([]secretEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, secretEntry{
+			Key:    fmt.Sprintf("%-*s", width, strconv.Quote(name)+":"),
+			Secret: strconv.Quote(secrets[name]),
+		})
+	}
+	return entries
+}
+
+// terraformSecrets is the Secret Manager data a Terraform module reads for its functions or
+// services when secrets are passed as environment variables
+type terraformSecrets struct {
+	Sources []secretSource             // One data source per secret, sorted by resource name
+	Env     map[string][]secretBinding // Each function or service's variables, sorted by name
+}
+
+// secretSource is a google_secret_manager_secret_version data source
+type secretSource struct {
+	Resource string
+	Secret   string // Secret ID, with ${var.environment} for annotations.SecretEnvironment
+	Vars     string // Variables read from the secret, for the comment
+}
+
+// secretBinding sets an environment variable from a data source; Name is padded to align
+// the assignments as terraform fmt does
+type secretBinding struct {
+	Name     string
+	Resource string
+}
+
+// newTerraformSecrets declares one data source per secret read by units (functions or
+// services, each mapping its variables to secret IDs), however many variables read it
+func newTerraformSecrets(units map[string]map[string]string) *terraformSecrets {
+	vars := make(map[string][]string)
+	for _, secrets := range units {
+		for name, id := range secrets {
+			if !slices.Contains(vars[id], name) {
+				vars[id] = append(vars[id], name)
+			}
+		}
+	}
+
+	ts := &terraformSecrets{Env: make(map[string][]secretBinding)}
+	resources := make(map[string]string)
+	used := make(map[string]bool)
+	for _, id := range slices.Sorted(maps.Keys(vars)) {
+		resource := secretResourceName(id)
+		for i := 2; used[resource]; i++ {
+			resource = fmt.Sprintf("%s_%d", secretResourceName(id), i)
+		}
+		used[resource] = true
+		resources[id] = resource
+
+		slices.Sort(vars[id])
+		ts.Sources = append(ts.Sources, secretSource{
+			Resource: resource,
+			Secret:   strings.ReplaceAll(id, annotations.SecretEnvironment, "${var.environment}"),
+			Vars:     strings.Join(vars[id], ", "),
+		})
+	}
+	slices.SortFunc(ts.Sources, func(a, b secretSource) int { return strings.Compare(a.Resource, b.Resource) })
+
+	for unit, secrets := range units {
+		names := slices.Sorted(maps.Keys(secrets))
+		width := 0
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		for _, name := range names {
+			ts.Env[unit] = append(ts.Env[unit], secretBinding{
+				Name:     fmt.Sprintf("%-*s", width, name),
+				Resource: resources[secrets[name]],
+			})
+		}
+	}
+	return ts
+}
+
+// secretResourceName names the data source of a secret after its ID without the environment
+// suffix ("jwt-secret-${env}" -> "jwt_secret"), so @box:env variables keep the names
+// MissingEnvSecrets looks for. An ID that is only the suffix ("-${env}") is named "secret"
+func secretResourceName(id string) string {
+	name := strings.TrimSuffix(id, "-"+annotations.SecretEnvironment)
+	name = strings.ReplaceAll(name, annotations.SecretEnvironment, "env")
+	name = strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	if name == "" {
+		return "secret"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "secret_" + name
+	}
+	return name
+}
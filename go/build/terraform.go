@@ -2,11 +2,15 @@ package build
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -15,29 +19,62 @@ import (
 
 // TerraformGenerator generates Terraform Infrastructure as Code
 type TerraformGenerator struct {
-	handlers    []annotations.Handler
-	outputDir   string
-	moduleName  string
-	projectID   string
-	region      string
-	environment string // dev, staging, production
-	logger      *zap.Logger
+	plan            *DeploymentPlan
+	outputDir       string
+	moduleName      string
+	projectID       string
+	environment     string // dev, staging, production
+	probes          ProbeConfig
+	defaultTimeout  time.Duration // Function timeout for handlers without @box:timeout
+	defaultRoles    []string      // Project roles granted to every service account
+	cloudRunV2      bool          // Render services as google_cloud_run_v2_service
+	canaryPercent   int           // Traffic share of each service's latest revision; 0 sends it all traffic
+	functionRuntime string        // Cloud Functions runtime (e.g., "go122")
+	region          string        // Location of the state bucket created by setup-state.sh
+	stateBucket     string        // GCS bucket holding remote state; empty keeps local state
+	runtimeSecrets  bool          // Entry points read their secrets; modules only pass BOX_PROJECT
+	logger          *zap.Logger
+}
+
+// serviceAccount is a generated service account (one per package) and its project role grants
+type serviceAccount struct {
+	Name  string
+	Roles []roleBinding
+}
+
+// roleBinding is one google_project_iam_member granting a role to a service account
+type roleBinding struct {
+	Role        string // e.g., "roles/cloudsql.client"
+	Resource    string // Terraform resource name (e.g., "users_cloudsql")
+	Description string // Comment rendered above the resource
+}
+
+// knownRoleBindings keeps the resource names and comments of the default roles stable,
+// so existing state isn't replaced when other roles are added
+var knownRoleBindings = map[string]roleBinding{
+	"roles/cloudsql.client":              {Resource: "cloudsql", Description: "Grant Cloud SQL client role"},
+	"roles/secretmanager.secretAccessor": {Resource: "secrets", Description: "Grant Secret Manager accessor role"},
 }
 
 // Generate creates complete Terraform configuration
 func (tg *TerraformGenerator) Generate() error {
-	if len(tg.handlers) == 0 {
+	if tg.plan.Empty() {
 		tg.logger.Info("No handlers to generate Terraform configuration")
 		return nil
 	}
 
+	if err := tg.validateCanary(); err != nil {
+		return err
+	}
+
 	// Create terraform output directory
 	if err := os.MkdirAll(tg.outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create terraform directory: %w", err)
 	}
 
 	tg.logger.Info("Generating Terraform configuration",
-		zap.Int("handlers", len(tg.handlers)),
+		zap.Int("functions", len(tg.plan.Functions)),
+		zap.Int("services", len(tg.plan.Services)),
 		zap.String("output_dir", tg.outputDir))
 
 	// Generate module directories
@@ -55,6 +92,16 @@ func (tg *TerraformGenerator) Generate() error {
 		return fmt.Errorf("failed to generate cloud-run module: %w", err)
 	}
 
+	// Generate cloud-tasks module
+	if err := tg.generateCloudTasksModule(); err != nil {
+		return fmt.Errorf("failed to generate cloud-tasks module: %w", err)
+	}
+
+	// Generate cloud-scheduler module
+	if err := tg.generateSchedulerModule(); err != nil {
+		return fmt.Errorf("failed to generate cloud-scheduler module: %w", err)
+	}
+
 	// Generate api-gateway module
 	if err := tg.generateAPIGatewayModule(); err != nil {
 		return fmt.Errorf("failed to generate api-gateway module: %w", err)
@@ -83,6 +130,14 @@ func (tg *TerraformGenerator) Generate() error {
 		return fmt.Errorf("failed to generate environment files: %w", err)
 	}
 
+	if err := tg.generateSelectEnvScript(); err != nil {
+		return fmt.Errorf("failed to generate select-env.sh: %w", err)
+	}
+
+	if err := tg.generateStateSetup(); err != nil {
+		return fmt.Errorf("failed to generate setup-state.sh: %w", err)
+	}
+
 	// Generate supporting files
 	if err := tg.generateGitignore(); err != nil {
 		return fmt.Errorf("failed to generate .gitignore: %w", err)
@@ -107,6 +162,9 @@ func (tg *TerraformGenerator) generateModuleStructure() error {
 		"modules/networking",
 		"environments",
 	}
+	if len(tg.plan.Scheduled) > 0 {
+		modules = append(modules, "modules/cloud-scheduler")
+	}
 
 	for _, module := range modules {
 		modulePath := filepath.Join(tg.outputDir, module)
@@ -122,8 +180,7 @@ func (tg *TerraformGenerator) generateModuleStructure() error {
 func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 	modulePath := filepath.Join(tg.outputDir, "modules", "cloud-functions")
 
-	// Filter function handlers
-	functions := filterFunctionHandlers(tg.handlers)
+	functions := tg.plan.Functions
 	if len(functions) == 0 {
 		tg.logger.Info("No cloud functions to generate in Terraform")
 		return nil
@@ -132,6 +189,15 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 	// Get unique service accounts (by package)
 	serviceAccounts := tg.getServiceAccounts(functions)
 
+	units := make(map[string][]annotations.Handler, len(functions))
+	for _, function := range functions {
+		units[function.FunctionName] = []annotations.Handler{function}
+	}
+	secrets, err := tg.moduleSecrets(units)
+	if err != nil {
+		return err
+	}
+
 	// Generate main.tf
 	if err := tg.generateFile(
 		filepath.Join(modulePath, "main.tf"),
@@ -139,6 +205,10 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 		map[string]interface{}{
 			"Functions":       functions,
 			"ServiceAccounts": serviceAccounts,
+			"Roles":           rolesByServiceAccount(serviceAccounts),
+			"Topics":          tg.plan.Topics,
+			"Secrets":         secrets,
+			"Runtime":         tg.functionRuntime,
 		},
 	); err != nil {
 		return err
@@ -148,7 +218,10 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 	if err := tg.generateFile(
 		filepath.Join(modulePath, "variables.tf"),
 		cloudFunctionsVariablesTemplate,
-		nil,
+		map[string]interface{}{
+			"HasTaskTargets": hasTaskTargets(functions),
+			"HasScheduled":   len(tg.plan.Scheduled) > 0,
+		},
 	); err != nil {
 		return err
 	}
@@ -159,6 +232,7 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 		cloudFunctionsOutputsTemplate,
 		map[string]interface{}{
 			"Functions": functions,
+			"Scheduled": tg.plan.Scheduled,
 		},
 	); err != nil {
 		return err
@@ -166,7 +240,8 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 
 	tg.logger.Info("Generated cloud-functions module",
 		zap.Int("functions", len(functions)),
-		zap.Int("service_accounts", len(serviceAccounts)))
+		zap.Int("service_accounts", len(serviceAccounts)),
+		zap.Int("subscribers", len(tg.plan.Subscribers)))
 
 	return nil
 }
@@ -175,23 +250,62 @@ func (tg *TerraformGenerator) generateCloudFunctionsModule() error {
 func (tg *TerraformGenerator) generateCloudRunModule() error {
 	modulePath := filepath.Join(tg.outputDir, "modules", "cloud-run")
 
-	// Filter container handlers and group by service
-	containers := filterContainerHandlers(tg.handlers)
-	if len(containers) == 0 {
+	serviceGroups := tg.plan.Services
+	if len(serviceGroups) == 0 {
 		tg.logger.Info("No cloud run services to generate in Terraform")
 		return nil
 	}
 
-	serviceGroups := tg.groupHandlersByPackage(containers)
-	serviceAccounts := tg.getServiceAccounts(containers)
+	serviceAccounts := tg.getServiceAccounts(tg.plan.ContainerHandlers())
+
+	probes, err := tg.serviceProbes(serviceGroups)
+	if err != nil {
+		return err
+	}
+
+	cpuThrottling, err := serviceCPUThrottling(serviceGroups)
+	if err != nil {
+		return err
+	}
+
+	scaling := make(map[string]InstanceScaling, len(serviceGroups))
+	units := make(map[string][]annotations.Handler, len(serviceGroups))
+	for _, group := range serviceGroups {
+		if scaling[group.Name], err = group.Scaling(); err != nil {
+			return err
+		}
+		units[group.Name] = group.Handlers
+	}
+
+	secrets, err := tg.moduleSecrets(units)
+	if err != nil {
+		return err
+	}
+
+	// The v2 resource has its own schema; outputs and the load balancer only differ in
+	// the resource type and the URL attribute
+	mainTemplate := cloudRunMainTemplate
+	resource, urlAttribute := "google_cloud_run_service", "status[0].url"
+	if tg.cloudRunV2 {
+		mainTemplate = cloudRunV2MainTemplate
+		resource, urlAttribute = "google_cloud_run_v2_service", "uri"
+	}
 
 	// Generate main.tf
 	if err := tg.generateFile(
 		filepath.Join(modulePath, "main.tf"),
-		cloudRunMainTemplate,
+		mainTemplate,
 		map[string]interface{}{
 			"ServiceGroups":   serviceGroups,
 			"ServiceAccounts": serviceAccounts,
+			"Roles":           rolesByServiceAccount(serviceAccounts),
+			"MultiRegion":     tg.plan.MultiRegion(),
+			"HealthPath":      tg.plan.Networking.HealthPath,
+			"Probes":          probes,
+			"CPUThrottling":   cpuThrottling,
+			"Scaling":         scaling,
+			"Secrets":         secrets,
+			"Canary":          tg.canaryPercent > 0,
 		},
 	); err != nil {
 		return err
@@ -201,7 +315,11 @@ func (tg *TerraformGenerator) generateCloudRunModule() error {
 	if err := tg.generateFile(
 		filepath.Join(modulePath, "variables.tf"),
 		cloudRunVariablesTemplate,
-		nil,
+		map[string]interface{}{
+			"MultiRegion":   tg.plan.MultiRegion(),
+			"Canary":        tg.canaryPercent > 0,
+			"CanaryPercent": tg.canaryPercent,
+		},
 	); err != nil {
 		return err
 	}
@@ -212,14 +330,99 @@ func (tg *TerraformGenerator) generateCloudRunModule() error {
 		cloudRunOutputsTemplate,
 		map[string]interface{}{
 			"ServiceGroups": serviceGroups,
+			"MultiRegion":   tg.plan.MultiRegion(),
+			"Resource":      resource,
+			"URLAttribute":  urlAttribute,
 		},
 	); err != nil {
 		return err
 	}
 
+	// Generate the global load balancer fronting all regional services
+	if tg.plan.MultiRegion() {
+		if err := tg.generateFile(
+			filepath.Join(modulePath, "load_balancer.tf"),
+			cloudRunLoadBalancerTemplate,
+			map[string]interface{}{
+				"ServiceGroups": serviceGroups,
+				"PathRules":     loadBalancerPathRules(serviceGroups),
+				"Resource":      resource,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
 	tg.logger.Info("Generated cloud-run module",
+		zap.String("resource", resource),
 		zap.Int("services", len(serviceGroups)),
-		zap.Int("service_accounts", len(serviceAccounts)))
+		zap.Int("service_accounts", len(serviceAccounts)),
+		zap.Strings("regions", tg.plan.Networking.Regions))
+
+	return nil
+}
+
+// generateCloudTasksModule generates the cloud-tasks module for @box:task-queue handlers
+func (tg *TerraformGenerator) generateCloudTasksModule() error {
+	modulePath := filepath.Join(tg.outputDir, "modules", "cloud-tasks")
+
+	queues := tg.plan.TaskQueues
+	if len(queues) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(modulePath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", modulePath, err)
+	}
+
+	data := map[string]interface{}{
+		"Queues": queues,
+	}
+
+	files := map[string]string{
+		"main.tf":      cloudTasksMainTemplate,
+		"variables.tf": cloudTasksVariablesTemplate,
+		"outputs.tf":   cloudTasksOutputsTemplate,
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := tg.generateFile(filepath.Join(modulePath, name), files[name], data); err != nil {
+			return err
+		}
+	}
+
+	tg.logger.Info("Generated cloud-tasks module",
+		zap.Strings("queues", queues))
+
+	return nil
+}
+
+// generateSchedulerModule generates the cloud-scheduler module, with a Cloud Scheduler job
+// for each @box:schedule handler
+func (tg *TerraformGenerator) generateSchedulerModule() error {
+	modulePath := filepath.Join(tg.outputDir, "modules", "cloud-scheduler")
+
+	scheduled := tg.plan.Scheduled
+	if len(scheduled) == 0 {
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"Scheduled": scheduled,
+	}
+
+	files := map[string]string{
+		"main.tf":      cloudSchedulerMainTemplate,
+		"variables.tf": cloudSchedulerVariablesTemplate,
+		"outputs.tf":   cloudSchedulerOutputsTemplate,
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := tg.generateFile(filepath.Join(modulePath, name), files[name], data); err != nil {
+			return err
+		}
+	}
+
+	tg.logger.Info("Generated cloud-scheduler module",
+		zap.Int("jobs", len(scheduled)))
 
 	return nil
 }
@@ -228,7 +431,7 @@ func (tg *TerraformGenerator) generateCloudRunModule() error {
 func (tg *TerraformGenerator) generateAPIGatewayModule() error {
 	modulePath := filepath.Join(tg.outputDir, "modules", "api-gateway")
 
-	if len(tg.handlers) == 0 {
+	if tg.plan.Empty() {
 		return nil
 	}
 
@@ -302,15 +505,19 @@ func (tg *TerraformGenerator) generateNetworkingModule() error {
 
 // generateRootMain generates the root main.tf file
 func (tg *TerraformGenerator) generateRootMain() error {
-	hasFunctions := len(filterFunctionHandlers(tg.handlers)) > 0
-	hasContainers := len(filterContainerHandlers(tg.handlers)) > 0
-
 	return tg.generateFile(
 		filepath.Join(tg.outputDir, "main.tf"),
 		rootMainTemplate,
 		map[string]interface{}{
-			"HasFunctions":  hasFunctions,
-			"HasContainers": hasContainers,
+			"HasFunctions":           len(tg.plan.Functions) > 0,
+			"HasContainers":          len(tg.plan.Services) > 0,
+			"MultiRegion":            tg.plan.MultiRegion(),
+			"Canary":                 tg.canaryPercent > 0 && len(tg.plan.Services) > 0,
+			"HasTaskQueues":          len(tg.plan.TaskQueues) > 0,
+			"HasFunctionTaskTargets": hasTaskTargets(tg.plan.Functions),
+			"HasScheduled":           len(tg.plan.Scheduled) > 0,
+			"StateBucket":            tg.stateBucket,
+			"Environment":            tg.environment,
 		},
 	)
 }
@@ -320,46 +527,87 @@ func (tg *TerraformGenerator) generateVariables() error {
 	return tg.generateFile(
 		filepath.Join(tg.outputDir, "variables.tf"),
 		rootVariablesTemplate,
-		nil,
+		map[string]interface{}{
+			"MultiRegion":   tg.plan.MultiRegion(),
+			"Canary":        tg.canaryPercent > 0 && len(tg.plan.Services) > 0,
+			"CanaryPercent": tg.canaryPercent,
+		},
 	)
 }
 
 // generateOutputs generates the outputs.tf file
 func (tg *TerraformGenerator) generateOutputs() error {
-	hasFunctions := len(filterFunctionHandlers(tg.handlers)) > 0
-	hasContainers := len(filterContainerHandlers(tg.handlers)) > 0
-
 	return tg.generateFile(
 		filepath.Join(tg.outputDir, "outputs.tf"),
 		rootOutputsTemplate,
 		map[string]interface{}{
-			"HasFunctions":  hasFunctions,
-			"HasContainers": hasContainers,
+			"HasFunctions":  len(tg.plan.Functions) > 0,
+			"HasContainers": len(tg.plan.Services) > 0,
+			"MultiRegion":   tg.plan.MultiRegion(),
+			"TaskTargets":   tg.plan.TaskTargets,
 		},
 	)
 }
 
+// terraformEnvironments are the environments the root module accepts, each with its own tfvars file
+var terraformEnvironments = []string{"dev", "staging", "production"}
+
 // generateEnvironmentFiles generates environment-specific tfvars files
 func (tg *TerraformGenerator) generateEnvironmentFiles() error {
-	environments := []string{"dev", "staging", "production"}
-
-	for _, env := range environments {
+	for _, env := range terraformEnvironments {
 		if err := tg.generateFile(
 			filepath.Join(tg.outputDir, "environments", fmt.Sprintf("%s.tfvars", env)),
 			environmentTfvarsTemplate,
 			map[string]interface{}{
 				"Environment": env,
+				"MultiRegion": tg.plan.MultiRegion(),
+				"Regions":     tg.plan.Networking.Regions,
+				"Canary":      tg.canaryPercent > 0 && len(tg.plan.Services) > 0,
+				"Services":    tg.plan.Services,
 			},
 		); err != nil {
 			return err
 		}
 	}
 
-	tg.logger.Info("Generated environment tfvars files", zap.Int("count", len(environments)))
+	tg.logger.Info("Generated environment tfvars files", zap.Int("count", len(terraformEnvironments)))
 
 	return nil
 }
 
+// generateSelectEnvScript generates select-env.sh, which pairs each environment's
+// Terraform workspace with its tfvars file
+func (tg *TerraformGenerator) generateSelectEnvScript() error {
+	scriptPath := filepath.Join(tg.outputDir, "select-env.sh")
+	if err := tg.generateFile(scriptPath, selectEnvScriptTemplate, map[string]interface{}{
+		"Environments": terraformEnvironments,
+	}); err != nil {
+		return err
+	}
+
+	// Make script executable
+	return os.Chmod(scriptPath, 0755)
+}
+
+// generateStateSetup generates setup-state.sh, which creates the remote state bucket
+// before the first terraform init
+func (tg *TerraformGenerator) generateStateSetup() error {
+	if tg.stateBucket == "" {
+		return nil
+	}
+
+	scriptPath := filepath.Join(tg.outputDir, "setup-state.sh")
+	if err := tg.generateFile(scriptPath, stateSetupScriptTemplate, map[string]interface{}{
+		"StateBucket": tg.stateBucket,
+		"ProjectID":   tg.projectID,
+		"Region":      tg.region,
+	}); err != nil {
+		return err
+	}
+
+	return os.Chmod(scriptPath, 0755)
+}
+
 // generateGitignore generates .gitignore for Terraform
 func (tg *TerraformGenerator) generateGitignore() error {
 	return tg.generateFile(
@@ -371,19 +619,35 @@ func (tg *TerraformGenerator) generateGitignore() error {
 
 // generateREADME generates README.md with usage instructions
 func (tg *TerraformGenerator) generateREADME() error {
-	hasFunctions := len(filterFunctionHandlers(tg.handlers)) > 0
-	hasContainers := len(filterContainerHandlers(tg.handlers)) > 0
-
 	return tg.generateFile(
 		filepath.Join(tg.outputDir, "README.md"),
 		terraformREADMETemplate,
 		map[string]interface{}{
-			"HasFunctions":  hasFunctions,
-			"HasContainers": hasContainers,
+			"HasFunctions":  len(tg.plan.Functions) > 0,
+			"HasContainers": len(tg.plan.Services) > 0,
+			"MultiRegion":   tg.plan.MultiRegion(),
+			"Canary":        tg.canaryPercent > 0 && len(tg.plan.Services) > 0,
+			"StateBucket":   tg.stateBucket,
+			"Environment":   tg.environment,
 		},
 	)
 }
 
+// validateCanary checks the canary traffic share
+func (tg *TerraformGenerator) validateCanary() error {
+	if tg.canaryPercent == 0 {
+		return nil
+	}
+	if tg.canaryPercent < 0 || tg.canaryPercent > 99 {
+		return fmt.Errorf("invalid canary percentage %d: must be between 1 and 99", tg.canaryPercent)
+	}
+	// Revision names differ per regional service, so one stable revision can't be shared
+	if tg.plan.MultiRegion() {
+		return fmt.Errorf("canary traffic splitting is not supported for multi-region services")
+	}
+	return nil
+}
+
 // Helper functions
 
 // generateFile creates a file from a template
@@ -394,9 +658,21 @@ func (tg *TerraformGenerator) generateFile(path string, templateStr string, data
 		"replace":     strings.ReplaceAll,
 		"toUpper":     strings.ToUpper,
 		"toLower":     strings.ToLower,
+		"sorted": func(values []string) []string {
+			return slices.Sorted(slices.Values(values))
+		},
 		"stripMB": func(s string) string {
 			return strings.TrimSuffix(s, "MB")
 		},
+		"timeoutSeconds": func(handler annotations.Handler) int {
+			return int(handlerTimeout(handler, tg.defaultTimeout).Seconds())
+		},
+		"attemptDeadline": func(handler annotations.Handler) int {
+			return clampSeconds(handlerTimeout(handler, tg.defaultTimeout), minSchedulerAttemptDeadline, maxSchedulerAttemptDeadline)
+		},
+		"ackDeadline": func(handler annotations.Handler) int {
+			return clampSeconds(handlerTimeout(handler, tg.defaultTimeout), minPubSubAckDeadline, maxPubSubAckDeadline)
+		},
 	}).Parse(templateStr))
 
 	file, err := os.Create(path)
@@ -409,60 +685,313 @@ func (tg *TerraformGenerator) generateFile(path string, templateStr string, data
 }
 
 // getServiceAccounts gets unique service accounts from handlers (by package)
-func (tg *TerraformGenerator) getServiceAccounts(handlers []annotations.Handler) []string {
-	saMap := make(map[string]bool)
+// Each is granted the default roles followed by its handlers' @box:iam-role roles, sorted
+func (tg *TerraformGenerator) getServiceAccounts(handlers []annotations.Handler) []serviceAccount {
+	extraRoles := make(map[string]map[string]bool)
 	for _, h := range handlers {
-		if h.PackageName != "" {
-			saMap[h.PackageName] = true
+		if h.PackageName == "" {
+			continue
+		}
+		if extraRoles[h.PackageName] == nil {
+			extraRoles[h.PackageName] = make(map[string]bool)
+		}
+		for _, role := range h.IAMRoles {
+			extraRoles[h.PackageName][role] = true
 		}
 	}
 
-	sas := make([]string, 0, len(saMap))
-	for sa := range saMap {
+	sas := make([]serviceAccount, 0, len(extraRoles))
+	for name, extra := range extraRoles {
+		granted := make(map[string]bool)
+		sa := serviceAccount{Name: name}
+		for _, role := range tg.defaultRoles {
+			if !granted[role] {
+				granted[role] = true
+				sa.Roles = append(sa.Roles, newRoleBinding(name, role))
+			}
+		}
+
+		var additions []string
+		for role := range extra {
+			if !granted[role] {
+				additions = append(additions, role)
+			}
+		}
+		sort.Strings(additions)
+		for _, role := range additions {
+			sa.Roles = append(sa.Roles, newRoleBinding(name, role))
+		}
+
 		sas = append(sas, sa)
 	}
-	sort.Strings(sas)
+
+	sort.Slice(sas, func(i, j int) bool {
+		return sas[i].Name < sas[j].Name
+	})
 	return sas
 }
 
-// groupHandlersByPackage groups handlers by package name
-func (tg *TerraformGenerator) groupHandlersByPackage(handlers []annotations.Handler) []ServiceGroup {
-	groupMap := make(map[string][]annotations.Handler)
+// newRoleBinding names the IAM member resource granting role to a package's service account
+func newRoleBinding(account, role string) roleBinding {
+	binding, known := knownRoleBindings[role]
+	if !known {
+		// roles/storage.objectViewer -> storage_object_viewer
+		name := role[strings.LastIndex(role, "roles/")+len("roles/"):]
+		binding = roleBinding{
+			Resource:    toSnakeCase(strings.ReplaceAll(name, ".", "_")),
+			Description: fmt.Sprintf("Grant %s", role),
+		}
+	}
+
+	binding.Role = role
+	binding.Resource = toSnakeCase(account) + "_" + binding.Resource
+	return binding
+}
+
+// rolesByServiceAccount indexes role bindings by service account, for depends_on lists
+func rolesByServiceAccount(sas []serviceAccount) map[string][]roleBinding {
+	roles := make(map[string][]roleBinding, len(sas))
+	for _, sa := range sas {
+		roles[sa.Name] = sa.Roles
+	}
+	return roles
+}
 
+// envSecrets returns the @box:env variables declared by handlers, sorted and keyed by
+// their secret, leaving out DATABASE_URL which every module already reads
+func envSecrets(handlers []annotations.Handler) []string {
+	seen := make(map[string]bool)
+	var names []string
 	for _, handler := range handlers {
-		packageName := handler.PackageName
-		if packageName == "" {
-			packageName = "default"
+		for _, name := range handler.RequiredEnvVars {
+			id := envSecretID(name)
+			if name == "DATABASE_URL" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			names = append(names, name)
 		}
-		groupMap[packageName] = append(groupMap[packageName], handler)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	groups := make([]ServiceGroup, 0, len(groupMap))
-	for name, handlers := range groupMap {
-		groups = append(groups, ServiceGroup{
-			Name:     name,
-			Handlers: handlers,
-		})
+// moduleSecrets returns the secret data sources of a module deploying units (functions or
+// services, each with the handlers sharing its environment), or nil when entry points read
+// their own secrets
+func (tg *TerraformGenerator) moduleSecrets(units map[string][]annotations.Handler) (*terraformSecrets, error) {
+	if tg.runtimeSecrets {
+		return nil, nil
 	}
 
-	// Sort for consistent output
-	sort.Slice(groups, func(i, j int) bool {
-		return groups[i].Name < groups[j].Name
-	})
+	secrets := make(map[string]map[string]string, len(units))
+	for unit, handlers := range units {
+		var err error
+		if secrets[unit], err = unitSecrets(unit, handlers); err != nil {
+			return nil, err
+		}
+	}
+	return newTerraformSecrets(secrets), nil
+}
+
+// envSecretDataPattern matches the secret data sources of a generated Terraform module
+var envSecretDataPattern = regexp.MustCompile(`data "google_secret_manager_secret_version" "([A-Za-z0-9_]+)"`)
+
+// MissingEnvSecrets returns the @box:env variables that no module under terraformDir reads
+// from Secret Manager, sorted. It detects Terraform output generated before the variable was
+// declared; a missing terraform directory means every variable is missing. Output generated
+// with SecretsRuntime leaves secrets to the entry points, so nothing is missing from it
+func MissingEnvSecrets(handlers []annotations.Handler, terraformDir string) ([]string, error) {
+	defined := make(map[string]bool)
+	for _, module := range []string{"cloud-functions", "cloud-run"} {
+		content, err := os.ReadFile(filepath.Join(terraformDir, "modules", module, "main.tf"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s module: %w", module, err)
+		}
+		if strings.Contains(string(content), "BOX_PROJECT") {
+			return nil, nil
+		}
+		for _, match := range envSecretDataPattern.FindAllStringSubmatch(string(content), -1) {
+			defined[match[1]] = true
+		}
+	}
 
-	return groups
+	seen := make(map[string]bool)
+	var missing []string
+	for _, handler := range handlers {
+		for _, name := range handler.RequiredEnvVars {
+			if !defined[strings.ToLower(name)] && !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
 }
 
-// toSnakeCase converts "CreateAccount" to "create_account"
-func toSnakeCase(s string) string {
-	var result []rune
-	for i, r := range s {
-		if i > 0 && r >= 'A' && r <= 'Z' {
-			result = append(result, '_')
+// serviceEnvVars returns each service's @box:env variables; handlers share their container's environment
+func serviceEnvVars(groups []ServiceGroup) map[string][]string {
+	vars := make(map[string][]string)
+	for _, group := range groups {
+		if names := envSecrets(group.Handlers); len(names) > 0 {
+			vars[group.Name] = names
+		}
+	}
+	return vars
+}
+
+// envSecretID returns the Secret Manager secret backing an environment variable ("JWT_SECRET" -> "jwt-secret")
+// Each environment reads its own <id>-<environment> secret
+func envSecretID(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// Deadlines Cloud Scheduler and Pub/Sub accept for waiting on a function
+const (
+	minSchedulerAttemptDeadline = 15 * time.Second
+	maxSchedulerAttemptDeadline = 30 * time.Minute
+	minPubSubAckDeadline        = 10 * time.Second
+	maxPubSubAckDeadline        = 10 * time.Minute
+)
+
+// clampSeconds returns a function timeout in whole seconds, clamped to [lo, hi]
+func clampSeconds(timeout, lo, hi time.Duration) int {
+	return int(min(max(timeout, lo), hi).Seconds())
+}
+
+// hasTaskTargets reports whether any handler processes a Cloud Tasks queue
+func hasTaskTargets(handlers []annotations.Handler) bool {
+	for _, handler := range handlers {
+		if handler.TaskQueue != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// probeSettings holds the Terraform probe values for one Cloud Run service, in seconds
+type probeSettings struct {
+	Period                   int
+	Timeout                  int
+	StartupFailureThreshold  int
+	LivenessFailureThreshold int
+}
+
+// serviceProbes derives startup and liveness probe settings for each service group
+// Unless configured, the probe timeout follows the service's shortest handler timeout
+// (capped at the probe period), and the startup probe allows StartupGrace to become healthy
+func (tg *TerraformGenerator) serviceProbes(groups []ServiceGroup) (map[string]probeSettings, error) {
+	cfg := tg.probes
+	if cfg.Period < time.Second || cfg.Period > 240*time.Second {
+		return nil, fmt.Errorf("invalid probe period %s: must be between 1s and 240s", cfg.Period)
+	}
+	if cfg.Timeout < 0 || cfg.Timeout > cfg.Period {
+		return nil, fmt.Errorf("invalid probe timeout %s: must not exceed the probe period %s", cfg.Timeout, cfg.Period)
+	}
+	if cfg.FailureThreshold < 1 {
+		return nil, fmt.Errorf("invalid probe failure threshold %d: must be at least 1", cfg.FailureThreshold)
+	}
+	if cfg.StartupGrace < cfg.Period {
+		return nil, fmt.Errorf("invalid probe startup grace %s: must be at least the probe period %s", cfg.StartupGrace, cfg.Period)
+	}
+
+	period := int(cfg.Period / time.Second)
+
+	probes := make(map[string]probeSettings, len(groups))
+	for _, group := range groups {
+		timeout := cfg.Timeout
+		if timeout == 0 {
+			timeout = cfg.Period
+			for _, handler := range group.Handlers {
+				if handler.Timeout > 0 && handler.Timeout < timeout {
+					timeout = handler.Timeout
+				}
+			}
+		}
+
+		probes[group.Name] = probeSettings{
+			Period:                   period,
+			Timeout:                  max(1, int(timeout/time.Second)),
+			StartupFailureThreshold:  int((cfg.StartupGrace + cfg.Period - 1) / cfg.Period),
+			LivenessFailureThreshold: cfg.FailureThreshold,
+		}
+	}
+
+	return probes, nil
+}
+
+// serviceCPUThrottling returns the Cloud Run cpu-throttling setting ("true" or "false") of
+// each service whose handlers use @box:cpu-always or @box:cpu-throttled
+func serviceCPUThrottling(groups []ServiceGroup) (map[string]string, error) {
+	throttling := make(map[string]string)
+	for _, group := range groups {
+		var always, throttled string
+		for _, handler := range group.Handlers {
+			if handler.CPUAlways && always == "" {
+				always = handler.FunctionName
+			}
+			if handler.CPUThrottled && throttled == "" {
+				throttled = handler.FunctionName
+			}
+		}
+
+		switch {
+		case always != "" && throttled != "":
+			return nil, fmt.Errorf("service %s: %s uses %s but %s uses %s; CPU allocation applies to the whole service",
+				group.Name, always, annotations.AnnotationName(annotations.KeyCPUAlways), throttled, annotations.AnnotationName(annotations.KeyCPUThrottled))
+		case always != "":
+			throttling[group.Name] = "false"
+		case throttled != "":
+			throttling[group.Name] = "true"
 		}
-		result = append(result, r)
 	}
-	return strings.ToLower(string(result))
+	return throttling, nil
+}
+
+// loadBalancerPathRule routes URL paths to a Cloud Run service backend
+type loadBalancerPathRule struct {
+	Service string
+	Paths   []string
+}
+
+// loadBalancerPathRules converts handler routes into URL map path rules
+// URL maps only support a trailing wildcard, so parameterised paths are
+// truncated at the first parameter (e.g., /api/v1/chat/{id}/stream -> /api/v1/chat/*)
+func loadBalancerPathRules(groups []ServiceGroup) []loadBalancerPathRule {
+	var rules []loadBalancerPathRule
+
+	for _, group := range groups {
+		seen := make(map[string]bool)
+		var paths []string
+
+		for _, handler := range group.Handlers {
+			path := handler.Route.Path
+			if idx := strings.Index(path, "{"); idx >= 0 {
+				path = strings.TrimSuffix(path[:idx], "/") + "/*"
+			}
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+
+		sort.Strings(paths)
+		rules = append(rules, loadBalancerPathRule{
+			Service: group.Name,
+			Paths:   paths,
+		})
+	}
+
+	return rules
+}
+
+// toSnakeCase converts "CreateAccount" to "create_account" and "GetByID" to "get_by_id"
+func toSnakeCase(s string) string {
+	return joinWords(s, '_')
 }
 
 // Templates
@@ -471,25 +1000,44 @@ const cloudFunctionsMainTemplate = `# Cloud Functions Module
 # Generated by Wylla build system
 
 {{range .ServiceAccounts}}
-# Service account for {{.}} service
-resource "google_service_account" "{{. | toSnakeCase}}" {
-  account_id   = "wylla-{{.}}-$${var.environment}"
-  display_name = "Wylla {{.}} Service ($${var.environment})"
-  description  = "Service account for {{.}} handlers"
+# Service account for {{.Name}} service
+resource "google_service_account" "{{.Name | toSnakeCase}}" {
+  account_id   = "wylla-{{.Name}}-$${var.environment}"
+  display_name = "Wylla {{.Name}} Service ($${var.environment})"
+  description  = "Service account for {{.Name}} handlers"
 }
+{{- $account := .Name}}
+{{- range .Roles}}
 
-# Grant Cloud SQL client role
-resource "google_project_iam_member" "{{. | toSnakeCase}}_cloudsql" {
+# {{.Description}}
+resource "google_project_iam_member" "{{.Resource}}" {
   project = var.project_id
-  role    = "roles/cloudsql.client"
-  member  = "serviceAccount:$${google_service_account.{{. | toSnakeCase}}.email}"
+  role    = "{{.Role}}"
+  member  = "serviceAccount:$${google_service_account.{{$account | toSnakeCase}}.email}"
+}
+{{- end}}
+{{end}}
+{{- if .Topics}}
+# Pub/Sub topics read by @box:pubsub functions
+resource "google_pubsub_topic" "topics" {
+  for_each = toset([{{range $i, $topic := .Topics}}{{if $i}}, {{end}}"{{$topic}}"{{end}}])
+  name     = "wylla-${var.environment}-${each.key}"
 }
 
-# Grant Secret Manager accessor role
-resource "google_project_iam_member" "{{. | toSnakeCase}}_secrets" {
-  project = var.project_id
-  role    = "roles/secretmanager.secretAccessor"
-  member  = "serviceAccount:$${google_service_account.{{. | toSnakeCase}}.email}"
+# Identity Pub/Sub uses to push messages to subscriber functions (OIDC token)
+resource "google_service_account" "pubsub_invoker" {
+  account_id   = "wylla-pubsub-${var.environment}"
+  display_name = "Wylla Pub/Sub Push Invoker (${var.environment})"
+  description  = "Invokes @box:pubsub functions from push subscriptions"
+}
+
+data "google_project" "current" {}
+
+# The Pub/Sub service agent mints the OIDC tokens attached to push requests
+resource "google_service_account_iam_member" "pubsub_token_creator" {
+  service_account_id = google_service_account.pubsub_invoker.name
+  role               = "roles/iam.serviceAccountTokenCreator"
+  member             = "serviceAccount:service-${data.google_project.current.number}@gcp-sa-pubsub.iam.gserviceaccount.com"
 }
 {{end}}
 
@@ -502,50 +1050,601 @@ resource "google_storage_bucket" "functions" {
   uniform_bucket_level_access = true
 }
 
-{{range .Functions}}
-# Function: {{.FunctionName}}
-resource "google_cloudfunctions_function" "{{.FunctionName | toSnakeCase}}" {
-  name                  = "wylla-$${var.environment}-{{.FunctionName | toKebabCase}}"
-  description           = "{{.FunctionName}} handler"
-  runtime              = "go122"
-  entry_point          = "{{.FunctionName}}"
-  service_account_email = google_service_account.{{.PackageName | toSnakeCase}}.email
+{{range .Functions}}
+# Function: {{.FunctionName}}
+resource "google_cloudfunctions_function" "{{.FunctionName | toSnakeCase}}" {
+  name                  = "wylla-$${var.environment}-{{.FunctionName | toKebabCase}}"
+  description           = "{{.FunctionName}} handler"
+  runtime              = "{{$.Runtime}}"
+  entry_point          = "{{.FunctionName}}"
+  service_account_email = google_service_account.{{.PackageName | toSnakeCase}}.email
+
+  available_memory_mb = {{if .Memory}}{{.Memory | stripMB}}{{else}}256{{end}}
+  timeout             = {{timeoutSeconds .}}
+{{- if .MinInstances}}
+  min_instances       = {{.MinInstances}}
+{{- end}}
+{{- if .MaxInstances}}
+  max_instances       = {{.MaxInstances}}
+{{- end}}
+
+  source_archive_bucket = google_storage_bucket.functions.name
+  source_archive_object = "{{.FunctionName | toKebabCase}}.zip"
+
+  trigger_http = true
+
+  environment_variables = {{if $.Secrets}}merge(local.secret_env["{{.FunctionName}}"], {{end}}{
+    ENVIRONMENT       = var.environment
+    BOX_ENVIRONMENT   = var.environment
+{{- if not $.Secrets}}
+    BOX_PROJECT       = var.project_id
+{{- end}}
+    BOX_REGION        = var.region
+    BOX_FUNCTION_NAME = "{{.FunctionName}}"
+  }{{if $.Secrets}}){{end}}
+
+{{- with index $.Roles .PackageName}}
+
+  depends_on = [
+{{- range $i, $binding := .}}{{if $i}},{{end}}
+    google_project_iam_member.{{$binding.Resource}}
+{{- end}}
+  ]
+{{- end}}
+}
+{{if .TaskQueue}}
+# Only Cloud Tasks may invoke this task target (OIDC token for the invoker service account)
+resource "google_cloudfunctions_function_iam_member" "{{.FunctionName | toSnakeCase}}_invoker" {
+  cloud_function = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.name
+  role           = "roles/cloudfunctions.invoker"
+  member         = "serviceAccount:${var.tasks_invoker_email}"
+}
+{{else if .Schedule}}
+# Only the Cloud Scheduler job may invoke this scheduled function (see the cloud-scheduler module)
+resource "google_cloudfunctions_function_iam_member" "{{.FunctionName | toSnakeCase}}_invoker" {
+  cloud_function = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.name
+  role           = "roles/cloudfunctions.invoker"
+  member         = "serviceAccount:${var.scheduler_invoker_email}"
+}
+{{else if .PubSub}}
+# Only push deliveries may invoke this Pub/Sub subscriber
+resource "google_cloudfunctions_function_iam_member" "{{.FunctionName | toSnakeCase}}_invoker" {
+  cloud_function = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.name
+  role           = "roles/cloudfunctions.invoker"
+  member         = "serviceAccount:${google_service_account.pubsub_invoker.email}"
+}
+
+# Push subscription delivering {{.PubSub.TopicID}} messages
+resource "google_pubsub_subscription" "{{.FunctionName | toSnakeCase}}" {
+  name                 = "wylla-${var.environment}-{{if .PubSub.SubscriptionID}}{{.PubSub.SubscriptionID}}{{else}}{{.FunctionName | toKebabCase}}{{end}}"
+  topic                = google_pubsub_topic.topics["{{.PubSub.TopicID}}"].id
+  ack_deadline_seconds = {{ackDeadline .}}
+
+  push_config {
+    push_endpoint = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+
+    oidc_token {
+      service_account_email = google_service_account.pubsub_invoker.email
+    }
+  }
+
+  depends_on = [
+    google_cloudfunctions_function_iam_member.{{.FunctionName | toSnakeCase}}_invoker,
+    google_service_account_iam_member.pubsub_token_creator
+  ]
+}
+{{else}}
+# Allow unauthenticated access (API Gateway will handle auth)
+resource "google_cloudfunctions_function_iam_member" "{{.FunctionName | toSnakeCase}}_invoker" {
+  cloud_function = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.name
+  role           = "roles/cloudfunctions.invoker"
+  member         = "allUsers"
+}
+{{end}}
+{{- end}}
+{{- with .Secrets}}
+
+locals {
+  # Environment variables each function reads from Secret Manager
+  secret_env = {
+{{- range $unit, $env := .Env}}
+    "{{$unit}}" = {
+{{- range $env}}
+      {{.Name}} = data.google_secret_manager_secret_version.{{.Resource}}.secret_data
+{{- end}}
+    }
+{{- end}}
+  }
+}
+{{- range .Sources}}
+
+# Secret backing {{.Vars}}
+data "google_secret_manager_secret_version" "{{.Resource}}" {
+  secret  = "{{.Secret}}"
+  version = "latest"
+}
+{{- end}}
+{{- end}}
+`
+
+const cloudFunctionsVariablesTemplate = `# Cloud Functions Module Variables
+
+variable "project_id" {
+  description = "GCP project ID"
+  type        = string
+}
+
+variable "region" {
+  description = "GCP region"
+  type        = string
+}
+
+variable "environment" {
+  description = "Environment name (dev, staging, production)"
+  type        = string
+}
+{{- if .HasTaskTargets}}
+
+variable "tasks_invoker_email" {
+  description = "Service account Cloud Tasks uses to invoke task target functions"
+  type        = string
+}
+{{- end}}
+{{- if .HasScheduled}}
+
+variable "scheduler_invoker_email" {
+  description = "Service account Cloud Scheduler uses to invoke scheduled functions"
+  type        = string
+}
+{{- end}}
+`
+
+const cloudFunctionsOutputsTemplate = `# Cloud Functions Module Outputs
+
+{{range .Functions}}
+output "{{.FunctionName | toSnakeCase}}_url" {
+  description = "URL for {{.FunctionName}} function"
+  value       = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+}
+{{end}}
+
+output "function_urls" {
+  description = "Map of all function URLs"
+  value = {
+{{range .Functions}}    "{{.FunctionName}}" = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+{{end}}  }
+}
+{{- if .Scheduled}}
+
+output "scheduled_function_urls" {
+  description = "URLs of the @box:schedule functions, known once the scheduler may invoke them"
+  value = {
+{{- range .Scheduled}}
+    "{{.FunctionName}}" = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+{{- end}}
+  }
+
+  depends_on = [
+{{- range $i, $handler := .Scheduled}}{{if $i}},{{end}}
+    google_cloudfunctions_function_iam_member.{{$handler.FunctionName | toSnakeCase}}_invoker
+{{- end}}
+  ]
+}
+{{- end}}
+`
+
+const cloudRunMainTemplate = `# Cloud Run Module
+# Generated by Wylla build system
+
+{{range .ServiceAccounts}}
+# Service account for {{.Name}} service
+resource "google_service_account" "{{.Name | toSnakeCase}}" {
+  account_id   = "wylla-{{.Name}}-$${var.environment}"
+  display_name = "Wylla {{.Name}} Service ($${var.environment})"
+  description  = "Service account for {{.Name}} service"
+}
+{{- $account := .Name}}
+{{- range .Roles}}
+
+# {{.Description}}
+resource "google_project_iam_member" "{{.Resource}}" {
+  project = var.project_id
+  role    = "{{.Role}}"
+  member  = "serviceAccount:$${google_service_account.{{$account | toSnakeCase}}.email}"
+}
+{{- end}}
+{{end}}
+
+{{range .ServiceGroups}}
+# Cloud Run Service: {{.Name}}
+resource "google_cloud_run_service" "{{.Name | toSnakeCase}}" {
+{{- if $.MultiRegion}}
+  for_each = toset(var.regions)
+{{end}}
+  name     = "wylla-$${var.environment}-{{.Name}}"
+  location = {{if $.MultiRegion}}each.value{{else}}var.region{{end}}
+
+  template {
+    spec {
+      service_account_name = google_service_account.{{.Name | toSnakeCase}}.email
+
+      containers {
+        image = "gcr.io/$${var.project_id}/{{.Name}}:latest"
+
+        ports {
+          container_port = 8080
+        }
+
+        env {
+          name  = "ENVIRONMENT"
+          value = var.environment
+        }
+
+        env {
+          name  = "BOX_ENVIRONMENT"
+          value = var.environment
+        }
+
+        env {
+          name  = "BOX_REGION"
+          value = {{if $.MultiRegion}}each.value{{else}}var.region{{end}}
+        }
+
+        env {
+          name  = "BOX_SERVICE"
+          value = "{{.Name}}"
+        }
+{{- if $.Secrets}}
+
+        dynamic "env" {
+          for_each = local.secret_env["{{.Name}}"]
+
+          content {
+            name  = env.key
+            value = env.value
+          }
+        }
+{{- else}}
+
+        env {
+          name  = "BOX_PROJECT"
+          value = var.project_id
+        }
+{{- end}}
+
+        resources {
+          limits = {
+            cpu    = "1000m"
+            memory = "512Mi"
+          }
+        }
+
+{{- with index $.Probes .Name}}
+
+        startup_probe {
+          period_seconds    = {{.Period}}
+          timeout_seconds   = {{.Timeout}}
+          failure_threshold = {{.StartupFailureThreshold}}
+
+          http_get {
+            path = "{{$.HealthPath}}"
+          }
+        }
+
+        liveness_probe {
+          period_seconds    = {{.Period}}
+          timeout_seconds   = {{.Timeout}}
+          failure_threshold = {{.LivenessFailureThreshold}}
+
+          http_get {
+            path = "{{$.HealthPath}}"
+          }
+        }
+{{- end}}
+      }
+
+      container_concurrency = 80
+    }
+
+    metadata {
+      annotations = {
+{{- $scaling := index $.Scaling .Name}}
+{{- with index $.CPUThrottling .Name}}
+        "autoscaling.knative.dev/maxScale"  = "{{$scaling.Max}}"
+{{- if $scaling.Min}}
+        "autoscaling.knative.dev/minScale"  = "{{$scaling.Min}}"
+{{- end}}
+        "run.googleapis.com/client-name"    = "terraform"
+        "run.googleapis.com/cpu-throttling" = "{{.}}"
+{{- else}}
+        "autoscaling.knative.dev/maxScale" = "{{$scaling.Max}}"
+{{- if $scaling.Min}}
+        "autoscaling.knative.dev/minScale" = "{{$scaling.Min}}"
+{{- end}}
+        "run.googleapis.com/client-name"   = "terraform"
+{{- end}}
+      }
+    }
+  }
+
+{{- if $.Canary}}
+
+  # Canary rollout: the latest revision gets var.canary_percent of the traffic once a
+  # stable revision is set in var.stable_revisions, which keeps the rest
+  dynamic "traffic" {
+    for_each = lookup(var.stable_revisions, "{{.Name}}", "") == "" ? [] : [var.stable_revisions["{{.Name}}"]]
+    content {
+      percent       = 100 - var.canary_percent
+      revision_name = traffic.value
+      tag           = "stable"
+    }
+  }
+
+  traffic {
+    percent         = lookup(var.stable_revisions, "{{.Name}}", "") == "" ? 100 : var.canary_percent
+    latest_revision = true
+    tag             = "canary"
+  }
+{{- else}}
+
+  traffic {
+    percent         = 100
+    latest_revision = true
+  }
+{{- end}}
+
+{{- with index $.Roles .Name}}
+
+  depends_on = [
+{{- range $i, $binding := .}}{{if $i}},{{end}}
+    google_project_iam_member.{{$binding.Resource}}
+{{- end}}
+  ]
+{{- end}}
+}
+
+# Allow unauthenticated access (API Gateway will handle auth)
+resource "google_cloud_run_service_iam_member" "{{.Name | toSnakeCase}}_invoker" {
+{{- if $.MultiRegion}}
+  for_each = google_cloud_run_service.{{.Name | toSnakeCase}}
+
+  service  = each.value.name
+  location = each.value.location
+{{- else}}
+  service  = google_cloud_run_service.{{.Name | toSnakeCase}}.name
+  location = google_cloud_run_service.{{.Name | toSnakeCase}}.location
+{{- end}}
+  role     = "roles/run.invoker"
+  member   = "allUsers"
+}
+{{end}}
+{{- with .Secrets}}
+
+locals {
+  # Environment variables each service reads from Secret Manager
+  secret_env = {
+{{- range $unit, $env := .Env}}
+    "{{$unit}}" = {
+{{- range $env}}
+      {{.Name}} = data.google_secret_manager_secret_version.{{.Resource}}.secret_data
+{{- end}}
+    }
+{{- end}}
+  }
+}
+{{- range .Sources}}
+
+# Secret backing {{.Vars}}
+data "google_secret_manager_secret_version" "{{.Resource}}" {
+  secret  = "{{.Secret}}"
+  version = "latest"
+}
+{{- end}}
+{{- end}}
+`
+
+const cloudRunV2MainTemplate = `# Cloud Run Module (Cloud Run Admin API v2)
+# Generated by Wylla build system
+
+{{range .ServiceAccounts}}
+# Service account for {{.Name}} service
+resource "google_service_account" "{{.Name | toSnakeCase}}" {
+  account_id   = "wylla-{{.Name}}-${var.environment}"
+  display_name = "Wylla {{.Name}} Service (${var.environment})"
+  description  = "Service account for {{.Name}} service"
+}
+{{- $account := .Name}}
+{{- range .Roles}}
+
+# {{.Description}}
+resource "google_project_iam_member" "{{.Resource}}" {
+  project = var.project_id
+  role    = "{{.Role}}"
+  member  = "serviceAccount:${google_service_account.{{$account | toSnakeCase}}.email}"
+}
+{{- end}}
+{{end}}
+
+{{range .ServiceGroups}}
+# Cloud Run Service: {{.Name}}
+resource "google_cloud_run_v2_service" "{{.Name | toSnakeCase}}" {
+{{- if $.MultiRegion}}
+  for_each = toset(var.regions)
+{{end}}
+  name     = "wylla-${var.environment}-{{.Name}}"
+  location = {{if $.MultiRegion}}each.value{{else}}var.region{{end}}
+  ingress  = "INGRESS_TRAFFIC_ALL"
+
+  template {
+    service_account                  = google_service_account.{{.Name | toSnakeCase}}.email
+    max_instance_request_concurrency = 80
+
+    scaling {
+{{- with index $.Scaling .Name}}
+{{- if .Min}}
+      min_instance_count = {{.Min}}
+{{- end}}
+      max_instance_count = {{.Max}}
+{{- end}}
+    }
+
+    containers {
+      image = "gcr.io/${var.project_id}/{{.Name}}:latest"
+
+      ports {
+        container_port = 8080
+      }
+
+      env {
+        name  = "ENVIRONMENT"
+        value = var.environment
+      }
+
+      env {
+        name  = "BOX_ENVIRONMENT"
+        value = var.environment
+      }
+
+      env {
+        name  = "BOX_REGION"
+        value = {{if $.MultiRegion}}each.value{{else}}var.region{{end}}
+      }
+
+      env {
+        name  = "BOX_SERVICE"
+        value = "{{.Name}}"
+      }
+{{- if $.Secrets}}
+
+      dynamic "env" {
+        for_each = local.secret_env["{{.Name}}"]
+
+        content {
+          name  = env.key
+          value = env.value
+        }
+      }
+{{- else}}
+
+      env {
+        name  = "BOX_PROJECT"
+        value = var.project_id
+      }
+{{- end}}
+
+      resources {
+        limits = {
+          cpu    = "1000m"
+          memory = "512Mi"
+        }
+{{- with index $.CPUThrottling .Name}}
+        cpu_idle = {{.}}
+{{- end}}
+      }
+
+{{- with index $.Probes .Name}}
+
+      startup_probe {
+        period_seconds    = {{.Period}}
+        timeout_seconds   = {{.Timeout}}
+        failure_threshold = {{.StartupFailureThreshold}}
+
+        http_get {
+          path = "{{$.HealthPath}}"
+        }
+      }
 
-  available_memory_mb = {{if .Memory}}{{.Memory | stripMB}}{{else}}256{{end}}
-  timeout             = {{if .Timeout}}{{.Timeout.Seconds | printf "%.0f"}}{{else}}60{{end}}
+      liveness_probe {
+        period_seconds    = {{.Period}}
+        timeout_seconds   = {{.Timeout}}
+        failure_threshold = {{.LivenessFailureThreshold}}
 
-  source_archive_bucket = google_storage_bucket.functions.name
-  source_archive_object = "{{.FunctionName | toKebabCase}}.zip"
+        http_get {
+          path = "{{$.HealthPath}}"
+        }
+      }
+{{- end}}
+    }
+  }
 
-  trigger_http = true
+{{- if $.Canary}}
+
+  # Canary rollout: the latest revision gets var.canary_percent of the traffic once a
+  # stable revision is set in var.stable_revisions, which keeps the rest
+  dynamic "traffic" {
+    for_each = lookup(var.stable_revisions, "{{.Name}}", "") == "" ? [] : [var.stable_revisions["{{.Name}}"]]
+    content {
+      type     = "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION"
+      revision = traffic.value
+      percent  = 100 - var.canary_percent
+      tag      = "stable"
+    }
+  }
+
+  traffic {
+    type    = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+    percent = lookup(var.stable_revisions, "{{.Name}}", "") == "" ? 100 : var.canary_percent
+    tag     = "canary"
+  }
+{{- else}}
 
-  environment_variables = {
-    DATABASE_URL = data.google_secret_manager_secret_version.database_url.secret_data
-    ENVIRONMENT  = var.environment
+  traffic {
+    type    = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+    percent = 100
   }
+{{- end}}
+
+{{- with index $.Roles .Name}}
 
   depends_on = [
-    google_project_iam_member.{{.PackageName | toSnakeCase}}_cloudsql,
-    google_project_iam_member.{{.PackageName | toSnakeCase}}_secrets
+{{- range $i, $binding := .}}{{if $i}},{{end}}
+    google_project_iam_member.{{$binding.Resource}}
+{{- end}}
   ]
+{{- end}}
 }
 
 # Allow unauthenticated access (API Gateway will handle auth)
-resource "google_cloudfunctions_function_iam_member" "{{.FunctionName | toSnakeCase}}_invoker" {
-  cloud_function = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.name
-  role           = "roles/cloudfunctions.invoker"
-  member         = "allUsers"
+resource "google_cloud_run_v2_service_iam_member" "{{.Name | toSnakeCase}}_invoker" {
+{{- if $.MultiRegion}}
+  for_each = google_cloud_run_v2_service.{{.Name | toSnakeCase}}
+
+  name     = each.value.name
+  location = each.value.location
+{{- else}}
+  name     = google_cloud_run_v2_service.{{.Name | toSnakeCase}}.name
+  location = google_cloud_run_v2_service.{{.Name | toSnakeCase}}.location
+{{- end}}
+  role     = "roles/run.invoker"
+  member   = "allUsers"
 }
 {{end}}
+{{- with .Secrets}}
+
+locals {
+  # Environment variables each service reads from Secret Manager
+  secret_env = {
+{{- range $unit, $env := .Env}}
+    "{{$unit}}" = {
+{{- range $env}}
+      {{.Name}} = data.google_secret_manager_secret_version.{{.Resource}}.secret_data
+{{- end}}
+    }
+{{- end}}
+  }
+}
+{{- range .Sources}}
 
-# Reference to database URL secret
-data "google_secret_manager_secret_version" "database_url" {
-  secret  = "database-url-$${var.environment}"
+# Secret backing {{.Vars}}
+data "google_secret_manager_secret_version" "{{.Resource}}" {
+  secret  = "{{.Secret}}"
   version = "latest"
 }
+{{- end}}
+{{- end}}
 `
 
-const cloudFunctionsVariablesTemplate = `# Cloud Functions Module Variables
+const cloudRunVariablesTemplate = `# Cloud Run Module Variables
 
 variable "project_id" {
   description = "GCP project ID"
@@ -561,125 +1660,240 @@ variable "environment" {
   description = "Environment name (dev, staging, production)"
   type        = string
 }
+{{- if .MultiRegion}}
+
+variable "regions" {
+  description = "Regions to deploy each Cloud Run service to"
+  type        = list(string)
+}
+
+variable "lb_domain" {
+  description = "Domain served by the global load balancer (managed TLS certificate)"
+  type        = string
+}
+{{- end}}
+{{- if .Canary}}
+
+variable "canary_percent" {
+  description = "Percentage of each service's traffic sent to its latest revision while a stable revision is set"
+  type        = number
+  default     = {{.CanaryPercent}}
+
+  validation {
+    condition     = var.canary_percent >= 0 && var.canary_percent <= 100
+    error_message = "canary_percent must be between 0 and 100."
+  }
+}
+
+variable "stable_revisions" {
+  description = "Revision keeping the remaining traffic, by service; services without one send all traffic to the latest revision"
+  type        = map(string)
+  default     = {}
+}
+{{- end}}
 `
 
-const cloudFunctionsOutputsTemplate = `# Cloud Functions Module Outputs
+const cloudRunOutputsTemplate = `# Cloud Run Module Outputs
+{{if .MultiRegion}}
+{{range .ServiceGroups}}
+output "{{.Name | toSnakeCase}}_urls" {
+  description = "Regional URLs for {{.Name}} service"
+  value       = { for region, service in {{$.Resource}}.{{.Name | toSnakeCase}} : region => service.{{$.URLAttribute}} }
+}
+{{end}}
 
-{{range .Functions}}
-output "{{.FunctionName | toSnakeCase}}_url" {
-  description = "URL for {{.FunctionName}} function"
-  value       = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+output "service_urls" {
+  description = "Map of all service URLs by region"
+  value = {
+{{range .ServiceGroups}}    "{{.Name}}" = { for region, service in {{$.Resource}}.{{.Name | toSnakeCase}} : region => service.{{$.URLAttribute}} }
+{{end}}  }
+}
+
+output "load_balancer_ip" {
+  description = "Global load balancer IP address (point the lb_domain DNS record here)"
+  value       = google_compute_global_address.lb.address
+}
+{{else}}
+{{range .ServiceGroups}}
+output "{{.Name | toSnakeCase}}_url" {
+  description = "URL for {{.Name}} service"
+  value       = {{$.Resource}}.{{.Name | toSnakeCase}}.{{$.URLAttribute}}
 }
 {{end}}
 
-output "function_urls" {
-  description = "Map of all function URLs"
+output "service_urls" {
+  description = "Map of all service URLs"
   value = {
-{{range .Functions}}    "{{.FunctionName}}" = google_cloudfunctions_function.{{.FunctionName | toSnakeCase}}.https_trigger_url
+{{range .ServiceGroups}}    "{{.Name}}" = {{$.Resource}}.{{.Name | toSnakeCase}}.{{$.URLAttribute}}
 {{end}}  }
 }
-`
+{{end}}`
 
-const cloudRunMainTemplate = `# Cloud Run Module
+const cloudRunLoadBalancerTemplate = `# Cloud Run Global Load Balancer
 # Generated by Wylla build system
+#
+# Routes traffic to the nearest healthy region through serverless NEGs.
+# Prerequisites: a DNS A record for var.lb_domain pointing at the
+# load_balancer_ip output; the managed certificate only becomes active
+# once that record resolves (this can take up to an hour).
+{{range .ServiceGroups}}
+# Serverless NEGs for {{.Name}} (one per region)
+resource "google_compute_region_network_endpoint_group" "{{.Name | toSnakeCase}}" {
+  for_each = toset(var.regions)
 
-{{range .ServiceAccounts}}
-# Service account for {{.}} service
-resource "google_service_account" "{{. | toSnakeCase}}" {
-  account_id   = "wylla-{{.}}-$${var.environment}"
-  display_name = "Wylla {{.}} Service ($${var.environment})"
-  description  = "Service account for {{.}} service"
-}
+  name                  = "wylla-${var.environment}-{{.Name | toKebabCase}}-${each.value}"
+  network_endpoint_type = "SERVERLESS"
+  region                = each.value
 
-# Grant Cloud SQL client role
-resource "google_project_iam_member" "{{. | toSnakeCase}}_cloudsql" {
-  project = var.project_id
-  role    = "roles/cloudsql.client"
-  member  = "serviceAccount:$${google_service_account.{{. | toSnakeCase}}.email}"
+  cloud_run {
+    service = {{$.Resource}}.{{.Name | toSnakeCase}}[each.value].name
+  }
 }
 
-# Grant Secret Manager accessor role
-resource "google_project_iam_member" "{{. | toSnakeCase}}_secrets" {
-  project = var.project_id
-  role    = "roles/secretmanager.secretAccessor"
-  member  = "serviceAccount:$${google_service_account.{{. | toSnakeCase}}.email}"
+# Backend service for {{.Name}}
+resource "google_compute_backend_service" "{{.Name | toSnakeCase}}" {
+  name                  = "wylla-${var.environment}-{{.Name | toKebabCase}}"
+  load_balancing_scheme = "EXTERNAL_MANAGED"
+  protocol              = "HTTPS"
+
+  dynamic "backend" {
+    for_each = google_compute_region_network_endpoint_group.{{.Name | toSnakeCase}}
+    content {
+      group = backend.value.id
+    }
+  }
 }
 {{end}}
+# URL map routing request paths to services
+resource "google_compute_url_map" "lb" {
+  name            = "wylla-${var.environment}-lb"
+  default_service = google_compute_backend_service.{{(index .ServiceGroups 0).Name | toSnakeCase}}.id
+
+  host_rule {
+    hosts        = [var.lb_domain]
+    path_matcher = "services"
+  }
 
-{{range .ServiceGroups}}
-# Cloud Run Service: {{.Name}}
-resource "google_cloud_run_service" "{{.Name | toSnakeCase}}" {
-  name     = "wylla-$${var.environment}-{{.Name}}"
-  location = var.region
+  path_matcher {
+    name            = "services"
+    default_service = google_compute_backend_service.{{(index .ServiceGroups 0).Name | toSnakeCase}}.id
+{{range .PathRules}}
+    path_rule {
+      paths   = [{{range $i, $p := .Paths}}{{if $i}}, {{end}}"{{$p}}"{{end}}]
+      service = google_compute_backend_service.{{.Service | toSnakeCase}}.id
+    }
+{{end}}  }
+}
 
-  template {
-    spec {
-      service_account_name = google_service_account.{{.Name | toSnakeCase}}.email
+# Google-managed TLS certificate
+resource "google_compute_managed_ssl_certificate" "lb" {
+  name = "wylla-${var.environment}-lb-cert"
 
-      containers {
-        image = "gcr.io/$${var.project_id}/{{.Name}}:latest"
+  managed {
+    domains = [var.lb_domain]
+  }
+}
 
-        ports {
-          container_port = 8080
-        }
+resource "google_compute_target_https_proxy" "lb" {
+  name             = "wylla-${var.environment}-lb-proxy"
+  url_map          = google_compute_url_map.lb.id
+  ssl_certificates = [google_compute_managed_ssl_certificate.lb.id]
+}
 
-        env {
-          name  = "DATABASE_URL"
-          value = data.google_secret_manager_secret_version.database_url.secret_data
-        }
+resource "google_compute_global_address" "lb" {
+  name = "wylla-${var.environment}-lb-ip"
+}
 
-        env {
-          name  = "ENVIRONMENT"
-          value = var.environment
-        }
+resource "google_compute_global_forwarding_rule" "lb" {
+  name                  = "wylla-${var.environment}-lb"
+  target                = google_compute_target_https_proxy.lb.id
+  ip_address            = google_compute_global_address.lb.id
+  port_range            = "443"
+  load_balancing_scheme = "EXTERNAL_MANAGED"
+}
+`
 
-        resources {
-          limits = {
-            cpu    = "1000m"
-            memory = "512Mi"
-          }
-        }
-      }
+const cloudTasksMainTemplate = `# Cloud Tasks Module
+# Generated by Wylla build system
 
-      container_concurrency = 80
-    }
+# Identity Cloud Tasks attaches as an OIDC token when calling task targets
+# Code that enqueues tasks needs roles/cloudtasks.enqueuer and roles/iam.serviceAccountUser on it
+resource "google_service_account" "tasks_invoker" {
+  account_id   = "wylla-tasks-${var.environment}"
+  display_name = "Wylla Cloud Tasks Invoker (${var.environment})"
+  description  = "Service account Cloud Tasks uses to invoke task target handlers"
+}
 
-    metadata {
-      annotations = {
-        "autoscaling.knative.dev/maxScale" = "10"
-        "run.googleapis.com/client-name"   = "terraform"
-      }
-    }
-  }
+resource "google_cloud_tasks_queue" "queues" {
+  for_each = toset([{{range $i, $queue := .Queues}}{{if $i}}, {{end}}"{{$queue}}"{{end}}])
 
-  traffic {
-    percent         = 100
-    latest_revision = true
-  }
+  name     = "wylla-${var.environment}-${each.key}"
+  location = var.region
+}
+`
 
-  depends_on = [
-    google_project_iam_member.{{.Name | toSnakeCase}}_cloudsql,
-    google_project_iam_member.{{.Name | toSnakeCase}}_secrets
-  ]
+const cloudTasksVariablesTemplate = `# Cloud Tasks Module Variables
+
+variable "project_id" {
+  description = "GCP project ID"
+  type        = string
 }
 
-# Allow unauthenticated access (API Gateway will handle auth)
-resource "google_cloud_run_service_iam_member" "{{.Name | toSnakeCase}}_invoker" {
-  service  = google_cloud_run_service.{{.Name | toSnakeCase}}.name
-  location = google_cloud_run_service.{{.Name | toSnakeCase}}.location
-  role     = "roles/run.invoker"
-  member   = "allUsers"
+variable "region" {
+  description = "GCP region"
+  type        = string
 }
-{{end}}
 
-# Reference to database URL secret
-data "google_secret_manager_secret_version" "database_url" {
-  secret  = "database-url-$${var.environment}"
-  version = "latest"
+variable "environment" {
+  description = "Environment name (dev, staging, production)"
+  type        = string
 }
 `
 
-const cloudRunVariablesTemplate = `# Cloud Run Module Variables
+const cloudTasksOutputsTemplate = `# Cloud Tasks Module Outputs
+
+output "queue_ids" {
+  description = "Map of queue name to Cloud Tasks queue ID"
+  value       = { for name, queue in google_cloud_tasks_queue.queues : name => queue.id }
+}
+
+output "invoker_email" {
+  description = "Service account to use for the OIDC token on enqueued tasks"
+  value       = google_service_account.tasks_invoker.email
+}
+`
+
+const cloudSchedulerMainTemplate = `# Cloud Scheduler Module
+# Generated by Wylla build system
+
+# Identity Cloud Scheduler uses to invoke scheduled functions (OIDC token)
+resource "google_service_account" "scheduler_invoker" {
+  account_id   = "wylla-scheduler-${var.environment}"
+  display_name = "Wylla Cloud Scheduler Invoker (${var.environment})"
+  description  = "Invokes @box:schedule functions from Cloud Scheduler jobs"
+}
+{{range .Scheduled}}
+# Schedule: {{.Schedule.Cron}} ({{.Schedule.Timezone}})
+resource "google_cloud_scheduler_job" "{{.FunctionName | toSnakeCase}}" {
+  name             = "wylla-${var.environment}-{{.FunctionName | toKebabCase}}"
+  description      = "Runs {{.FunctionName}} on schedule"
+  region           = var.region
+  schedule         = "{{.Schedule.Cron}}"
+  time_zone        = "{{.Schedule.Timezone}}"
+  attempt_deadline = "{{attemptDeadline .}}s"
+
+  http_target {
+    http_method = "POST"
+    uri         = var.function_urls["{{.FunctionName}}"]
+
+    oidc_token {
+      service_account_email = google_service_account.scheduler_invoker.email
+    }
+  }
+}
+{{end}}`
+
+const cloudSchedulerVariablesTemplate = `# Cloud Scheduler Module Variables
 
 variable "project_id" {
   description = "GCP project ID"
@@ -695,22 +1909,27 @@ variable "environment" {
   description = "Environment name (dev, staging, production)"
   type        = string
 }
+
+variable "function_urls" {
+  description = "HTTPS trigger URL of each scheduled function, keyed by function name"
+  type        = map(string)
+}
 `
 
-const cloudRunOutputsTemplate = `# Cloud Run Module Outputs
+const cloudSchedulerOutputsTemplate = `# Cloud Scheduler Module Outputs
 
-{{range .ServiceGroups}}
-output "{{.Name | toSnakeCase}}_url" {
-  description = "URL for {{.Name}} service"
-  value       = google_cloud_run_service.{{.Name | toSnakeCase}}.status[0].url
+output "job_names" {
+  description = "Map of function name to Cloud Scheduler job name"
+  value = {
+{{- range .Scheduled}}
+    "{{.FunctionName}}" = google_cloud_scheduler_job.{{.FunctionName | toSnakeCase}}.name
+{{- end}}
+  }
 }
-{{end}}
 
-output "service_urls" {
-  description = "Map of all service URLs"
-  value = {
-{{range .ServiceGroups}}    "{{.Name}}" = google_cloud_run_service.{{.Name | toSnakeCase}}.status[0].url
-{{end}}  }
+output "invoker_email" {
+  description = "Service account scheduled functions must allow to invoke them"
+  value       = google_service_account.scheduler_invoker.email
 }
 `
 
@@ -955,6 +2174,14 @@ terraform {
       version = "~> 5.0"
     }
   }
+{{- if .StateBucket}}
+
+  # Remote state; create the bucket with setup-state.sh before the first terraform init
+  backend "gcs" {
+    bucket = "{{.StateBucket}}"
+    prefix = "{{.Environment}}/terraform.state"
+  }
+{{- end}}
 }
 
 provider "google" {
@@ -970,6 +2197,37 @@ module "cloud_functions" {
   project_id  = var.project_id
   region      = var.region
   environment = var.environment
+{{- if .HasFunctionTaskTargets}}
+
+  tasks_invoker_email = module.cloud_tasks.invoker_email
+{{- end}}
+{{- if .HasScheduled}}
+
+  scheduler_invoker_email = module.scheduler.invoker_email
+{{- end}}
+}
+{{end}}
+{{- if .HasTaskQueues}}
+
+# Cloud Tasks Module
+module "cloud_tasks" {
+  source = "./modules/cloud-tasks"
+
+  project_id  = var.project_id
+  region      = var.region
+  environment = var.environment
+}
+{{end}}
+{{- if .HasScheduled}}
+
+# Cloud Scheduler Module
+module "scheduler" {
+  source = "./modules/cloud-scheduler"
+
+  project_id    = var.project_id
+  region        = var.region
+  environment   = var.environment
+  function_urls = module.cloud_functions.scheduled_function_urls
 }
 {{end}}
 
@@ -981,6 +2239,15 @@ module "cloud_run" {
   project_id  = var.project_id
   region      = var.region
   environment = var.environment
+{{- if .MultiRegion}}
+  regions     = var.regions
+  lb_domain   = var.lb_domain
+{{- end}}
+{{- if .Canary}}
+
+  canary_percent   = var.canary_percent
+  stable_revisions = var.stable_revisions
+{{- end}}
 }
 {{end}}
 
@@ -1032,6 +2299,32 @@ variable "database_password" {
   type        = string
   sensitive   = true
 }
+{{- if .MultiRegion}}
+
+variable "regions" {
+  description = "Regions to deploy Cloud Run services to (behind a global load balancer)"
+  type        = list(string)
+}
+
+variable "lb_domain" {
+  description = "Domain for the global load balancer (requires a DNS A record to load_balancer_ip)"
+  type        = string
+}
+{{- end}}
+{{- if .Canary}}
+
+variable "canary_percent" {
+  description = "Percentage of each Cloud Run service's traffic sent to its latest (canary) revision"
+  type        = number
+  default     = {{.CanaryPercent}}
+}
+
+variable "stable_revisions" {
+  description = "Stable revision of each Cloud Run service, keeping the traffic the canary doesn't get"
+  type        = map(string)
+  default     = {}
+}
+{{- end}}
 `
 
 const rootOutputsTemplate = `# Root Module Outputs
@@ -1048,6 +2341,32 @@ output "service_urls" {
   description = "Cloud Run service URLs"
   value       = module.cloud_run.service_urls
 }
+{{- if .MultiRegion}}
+
+output "load_balancer_ip" {
+  description = "Global load balancer IP address"
+  value       = module.cloud_run.load_balancer_ip
+}
+{{- end}}
+{{end}}
+
+{{- if .TaskTargets}}
+output "task_targets" {
+  description = "Cloud Tasks targets: create HTTP tasks on the queue for the URL with an OIDC token for the service account"
+  value = {
+{{- range .TaskTargets}}
+    "{{.FunctionName}}" = {
+      queue                = module.cloud_tasks.queue_ids["{{.TaskQueue}}"]
+{{- if eq .DeploymentType "function"}}
+      url                  = module.cloud_functions.function_urls["{{.FunctionName}}"]
+{{- else}}
+      url                  = "${module.cloud_run.service_urls["{{if .PackageName}}{{.PackageName}}{{else}}default{{end}}"]{{if $.MultiRegion}}[var.region]{{end}}}{{.Route.Path}}"
+{{- end}}
+      oidc_service_account = module.cloud_tasks.invoker_email
+    }
+{{- end}}
+  }
+}
 {{end}}
 
 output "api_gateway_url" {
@@ -1067,12 +2386,127 @@ const environmentTfvarsTemplate = `# Terraform variables for {{.Environment}} en
 project_id  = "YOUR_PROJECT_ID"
 region      = "us-central1"
 environment = "{{.Environment}}"
+{{- if .MultiRegion}}
+
+# Multi-region Cloud Run deployment behind a global load balancer
+regions   = [{{range $i, $r := .Regions}}{{if $i}}, {{end}}"{{$r}}"{{end}}]
+lb_domain = "api.example.com"
+{{- end}}
+{{- if .Canary}}
+
+# Canary rollout: set each service's current revision here before deploying a new one;
+# the new revision then gets canary_percent of the traffic. Promote it by replacing the
+# stable revision, or remove the entry to send it all traffic
+# stable_revisions = {
+{{- range .Services}}
+#   {{.Name}} = "wylla-{{$.Environment}}-{{.Name}}-00001-abc"
+{{- end}}
+# }
+{{- end}}
 
 # Database password - CHANGE THIS!
 # Better: Store in Secret Manager and reference via data source
 database_password = "CHANGE_ME_{{.Environment | toUpper}}"
 `
 
+const selectEnvScriptTemplate = `#!/bin/bash
+# Run Terraform against one environment
+# Generated by Wylla build system
+#
+# Usage: ./select-env.sh <environment> [plan|apply|destroy|output] [terraform args...]
+#
+# Selects (or creates) the Terraform workspace named after the environment, so each
+# environment keeps its own state, and always passes the matching tfvars file.
+
+set -euo pipefail
+
+ENVIRONMENTS=({{range $i, $env := .Environments}}{{if $i}} {{end}}"{{$env}}"{{end}})
+
+usage() {
+  echo "Usage: $0 <environment> [plan|apply|destroy|output] [terraform args...]" >&2
+  echo "Environments: ${ENVIRONMENTS[*]}" >&2
+  exit 1
+}
+
+ENVIRONMENT="${1:-}"
+ACTION="${2:-plan}"
+[ -n "$ENVIRONMENT" ] || usage
+shift $(( $# > 1 ? 2 : 1 ))
+
+KNOWN=false
+for env in "${ENVIRONMENTS[@]}"; do
+  if [ "$env" = "$ENVIRONMENT" ]; then
+    KNOWN=true
+  fi
+done
+if [ "$KNOWN" != true ]; then
+  echo "Unknown environment: $ENVIRONMENT" >&2
+  usage
+fi
+
+cd "$(dirname "$0")"
+
+VAR_FILE="environments/$ENVIRONMENT.tfvars"
+if [ ! -f "$VAR_FILE" ]; then
+  echo "Missing $VAR_FILE" >&2
+  exit 1
+fi
+
+# Refuse a tfvars file that was edited to point at another environment
+if ! grep -Eq "^environment[[:space:]]*=[[:space:]]*\"$ENVIRONMENT\"" "$VAR_FILE"; then
+  echo "$VAR_FILE does not set environment = \"$ENVIRONMENT\"" >&2
+  exit 1
+fi
+
+if [ ! -d .terraform ]; then
+  terraform init -input=false
+fi
+
+# State is kept per workspace (terraform.tfstate.d/<env>/ locally, <prefix>/<env>.tfstate on GCS)
+terraform workspace select "$ENVIRONMENT" 2>/dev/null || terraform workspace new "$ENVIRONMENT"
+
+case "$ACTION" in
+  plan|apply|destroy)
+    terraform "$ACTION" -var-file="$VAR_FILE" "$@"
+    ;;
+  output)
+    terraform output "$@"
+    ;;
+  *)
+    echo "Unknown action: $ACTION" >&2
+    usage
+    ;;
+esac
+`
+
+const stateSetupScriptTemplate = `#!/bin/bash
+# Create the GCS bucket holding Terraform state
+# Generated by Wylla build system
+#
+# Usage: ./setup-state.sh
+#
+# Run once before the first terraform init. Versioning keeps every earlier state,
+# so a bad apply can be rolled back by restoring a previous object generation.
+
+set -euo pipefail
+
+BUCKET="{{.StateBucket}}"
+PROJECT_ID="${PROJECT_ID:-{{.ProjectID}}}"
+LOCATION="${LOCATION:-{{.Region}}}"
+
+if gsutil ls -b "gs://$BUCKET" >/dev/null 2>&1; then
+  echo "Bucket gs://$BUCKET already exists"
+else
+  echo "Creating gs://$BUCKET in $LOCATION..."
+  gsutil mb -p "$PROJECT_ID" -l "$LOCATION" -b on "gs://$BUCKET"
+fi
+
+gsutil versioning set on "gs://$BUCKET"
+gsutil ubla set on "gs://$BUCKET"
+
+echo "State bucket ready. Run: terraform init"
+`
+
 const terraformGitignoreTemplate = `# Terraform
 *.tfstate
 *.tfstate.backup
@@ -1115,6 +2549,35 @@ This Terraform configuration manages the complete infrastructure for the Wylla b
 3. **gcloud CLI**: Authenticated with ` + "`" + `gcloud auth application-default login` + "`" + `
 4. **Secrets**: Create required secrets in Secret Manager
 
+{{if .MultiRegion -}}
+### Multi-Region Load Balancer
+
+Cloud Run services are deployed to every region in ` + "`" + `regions` + "`" + ` behind a global
+external HTTPS load balancer. Before applying:
+
+1. Set ` + "`" + `lb_domain` + "`" + ` in the environment tfvars to a domain you control
+2. Enable the Compute Engine API: ` + "`" + `gcloud services enable compute.googleapis.com` + "`" + `
+3. After the first apply, create a DNS A record for ` + "`" + `lb_domain` + "`" + ` pointing at ` + "`" + `terraform output load_balancer_ip` + "`" + `
+
+The Google-managed certificate stays in ` + "`" + `PROVISIONING` + "`" + ` until the DNS record resolves,
+which can take up to an hour.
+
+{{end -}}
+{{if .Canary -}}
+### Canary Rollouts
+
+Cloud Run services split traffic between a stable revision and the latest (canary) revision.
+Before deploying a new image, set the service's current revision in ` + "`" + `stable_revisions` + "`" + `:
+
+` + "```bash" + `
+gcloud run services describe <service> --region=<region> --format='value(status.latestReadyRevisionName)'
+` + "```" + `
+
+The new revision then receives ` + "`" + `canary_percent` + "`" + ` of the traffic, and each revision is reachable
+directly through its tag (` + "`" + `https://canary---<service-host>` + "`" + `, ` + "`" + `https://stable---<service-host>` + "`" + `).
+Promote the canary by replacing the stable revision with it, or remove the entry to send it all traffic.
+
+{{end -}}
 ### Create Secrets
 
 Before applying Terraform, create the required secrets:
@@ -1179,6 +2642,26 @@ terraform apply -var-file=environments/staging.tfvars
 terraform apply -var-file=environments/production.tfvars
 ` + "```" + `
 
+### Workspaces
+
+` + "`" + `select-env.sh` + "`" + ` wraps the plan and apply steps above and keeps every environment in its own
+Terraform workspace:
+
+` + "```bash" + `
+./select-env.sh dev                 # terraform plan for dev
+./select-env.sh production apply    # terraform apply for production
+./select-env.sh staging output      # outputs of the staging workspace
+` + "```" + `
+
+It selects (or creates) the workspace named after the environment, passes
+` + "`" + `environments/<env>.tfvars` + "`" + ` and refuses to run if that file sets a different ` + "`" + `environment` + "`" + `.
+
+With ` + "`" + `-var-file` + "`" + ` alone, every environment shares one state file, so planning production after
+dev shows dev's resources being replaced. Workspaces give each environment separate state, but the
+configuration stays shared and the active workspace is easy to forget — use the script rather than
+running ` + "`" + `terraform workspace select` + "`" + ` by hand. For stronger isolation (separate projects, separate
+state buckets and credentials), keep one directory or backend configuration per environment instead.
+
 ### 5. View Outputs
 
 ` + "```bash" + `
@@ -1195,6 +2678,10 @@ terraform output api_gateway_url
 ├── main.tf                    # Root configuration
 ├── variables.tf               # Input variables
 ├── outputs.tf                 # Output values
+├── select-env.sh              # Per-environment workspace helper
+{{- if .StateBucket}}
+├── setup-state.sh             # Creates the remote state bucket
+{{- end}}
 ├── .gitignore                 # Ignore sensitive files
 ├── README.md                  # This file
 ├── modules/
@@ -1212,14 +2699,40 @@ terraform output api_gateway_url
 
 ### State Management
 
+{{if .StateBucket -}}
+This configuration stores state remotely in GCS; see [Remote State](#remote-state).
+
+⚠️ **Important**:
+- State files may contain sensitive data; restrict access to the bucket
+- Never commit local state files to git (already in .gitignore)
+
+### Remote State
+
+State is kept in the ` + "`" + `{{.StateBucket}}` + "`" + ` bucket under ` + "`" + `{{.Environment}}/terraform.state` + "`" + `. Create the
+bucket once, before the first ` + "`" + `terraform init` + "`" + `:
+
+` + "```bash" + `
+./setup-state.sh
+terraform init
+` + "```" + `
+
+The script creates the bucket with uniform bucket-level access and enables object versioning,
+so earlier states can be restored from previous object generations. GCS locks the state during
+each operation, so several people can run Terraform against it.
+
+To move existing local state into the bucket, run ` + "`" + `terraform init -migrate-state` + "`" + ` instead.
+
+{{else -}}
 This configuration uses **local state**. State files are stored locally in ` + "`" + `terraform.tfstate` + "`" + `.
 
 ⚠️ **Important**:
 - Never commit state files to git (already in .gitignore)
 - State files may contain sensitive data
 - Keep backups of state files
-- Consider migrating to remote state (GCS) for team collaboration
+- Consider migrating to remote state (GCS) for team collaboration: rebuild with
+  ` + "`" + `box build --terraform-state-bucket <bucket>` + "`" + `
 
+{{end -}}
 ### Security
 
 1. **Secrets**: Use Secret Manager for all sensitive data
@@ -0,0 +1,221 @@
+package build
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// functionDependencies are required by every generated function entrypoint; the handler
+// module's own requirements take precedence
+var functionDependencies = map[string]string{
+	"github.com/GoogleCloudPlatform/functions-framework-go": "v1.8.0",
+	"github.com/jackc/pgx/v5":                               "v5.5.0",
+	"go.uber.org/zap":                                       "v1.26.0",
+}
+
+// vendoredModule is what a self-contained function's go.mod takes from the handler module
+type vendoredModule struct {
+	GoVersion string
+	Requires  []string // "path version" lines, sorted by path
+}
+
+// vendorFunction copies the handler's package, and every package of the same module it
+// imports, into the function directory. Imports between them are rewritten to
+// functionModule, so the function builds without a replace directive
+func vendorFunction(dir, functionModule string, handler annotations.Handler) (*vendoredModule, error) {
+	if handler.FilePath == "" {
+		return nil, fmt.Errorf("source file of %s is unknown", handler.FunctionName)
+	}
+
+	module, err := annotations.FindModule(filepath.Dir(handler.FilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	queue := []string{handler.PackagePath}
+	seen := map[string]bool{handler.PackagePath: true}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		// The function's own directory holds package main
+		if pkg == "" {
+			return nil, fmt.Errorf("cannot vendor the root package of module %s", module.Path)
+		}
+
+		imports, err := vendorPackage(module, pkg, dir, functionModule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to vendor %s: %w", path.Join(module.Path, pkg), err)
+		}
+		for _, imported := range imports {
+			if !seen[imported] {
+				seen[imported] = true
+				queue = append(queue, imported)
+			}
+		}
+	}
+
+	goVersion, requires, err := readRequires(filepath.Join(module.Dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	// go.sum covers the handler module's requirements, which the function now shares
+	if sum, err := os.ReadFile(filepath.Join(module.Dir, "go.sum")); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	versions := make(map[string]string, len(functionDependencies)+len(requires))
+	for dependency, version := range functionDependencies {
+		versions[dependency] = version
+	}
+	for dependency, version := range requires {
+		versions[dependency] = version
+	}
+
+	vendored := &vendoredModule{GoVersion: goVersion}
+	for dependency, version := range versions {
+		vendored.Requires = append(vendored.Requires, dependency+" "+version)
+	}
+	sort.Strings(vendored.Requires)
+	return vendored, nil
+}
+
+// require adds a dependency at version unless the handler module already requires it
+func (m *vendoredModule) require(dependency, version string) {
+	for _, line := range m.Requires {
+		if strings.HasPrefix(line, dependency+" ") {
+			return
+		}
+	}
+	m.Requires = append(m.Requires, dependency+" "+version)
+	sort.Strings(m.Requires)
+}
+
+// vendorPackage copies the files of one package (pkg is relative to the module root) to
+// the same path under dir, skipping tests. It returns the module's packages the copied
+// files import
+func vendorPackage(module annotations.Module, pkg, dir, functionModule string) ([]string, error) {
+	srcDir := filepath.Join(module.Dir, filepath.FromSlash(pkg))
+	dstDir := filepath.Join(dir, filepath.FromSlash(pkg))
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var imports []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(srcDir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		// Other files (e.g., go:embed assets) are copied as they are
+		if strings.HasSuffix(name, ".go") {
+			var fileImports []string
+			content, fileImports, err = rewriteImports(name, content, module.Path, functionModule)
+			if err != nil {
+				return nil, err
+			}
+			imports = append(imports, fileImports...)
+		}
+
+		if err := os.WriteFile(filepath.Join(dstDir, name), content, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return imports, nil
+}
+
+// rewriteImports moves a source file's imports of modulePath to functionModule, leaving
+// the rest of the file byte for byte. It returns the rewritten packages, relative to the
+// module root
+func rewriteImports(name string, src []byte, modulePath, functionModule string) ([]byte, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		out      []byte
+		imported []string
+		last     int
+	)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if importPath != modulePath && !strings.HasPrefix(importPath, modulePath+"/") {
+			continue
+		}
+
+		pkg := strings.TrimPrefix(strings.TrimPrefix(importPath, modulePath), "/")
+		imported = append(imported, pkg)
+
+		start := fset.Position(spec.Path.Pos()).Offset
+		end := fset.Position(spec.Path.End()).Offset
+		out = append(out, src[last:start]...)
+		out = append(out, strconv.Quote(path.Join(functionModule, pkg))...)
+		last = end
+	}
+	out = append(out, src[last:]...)
+
+	return out, imported, nil
+}
+
+// readRequires reads the go directive and the required module versions of a go.mod file
+func readRequires(goMod string) (string, map[string]string, error) {
+	data, err := os.ReadFile(goMod)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", goMod, err)
+	}
+
+	goVersion := ""
+	requires := make(map[string]string)
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 0:
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock && len(fields) == 2:
+			requires[fields[0]] = fields[1]
+		case fields[0] == "go" && len(fields) == 2:
+			goVersion = fields[1]
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == "require" && len(fields) == 3:
+			requires[fields[1]] = fields[2]
+		}
+	}
+
+	return goVersion, requires, nil
+}
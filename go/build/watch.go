@@ -0,0 +1,155 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long a watch waits after the last change before rebuilding
+const DefaultWatchDebounce = 200 * time.Millisecond
+
+// WatchConfig holds watch configuration
+type WatchConfig struct {
+	Dir      string        // Directory to watch recursively (e.g., "./handlers")
+	Build    func() error  // Runs one build; called after each debounced change
+	Debounce time.Duration // Quiet period before a rebuild (default: DefaultWatchDebounce)
+	OnStart  func()        // Called before each rebuild (optional)
+}
+
+// WatchBuilder reruns a build whenever files under a directory change
+// A burst of changes, such as an editor writing several files, triggers one rebuild
+// once the directory has been quiet for the debounce window
+type WatchBuilder struct {
+	dir      string
+	build    func() error
+	debounce time.Duration
+	onStart  func()
+
+	// changes overrides the file system watcher, letting tests inject change events
+	changes <-chan struct{}
+}
+
+// NewWatchBuilder creates a watch builder
+func NewWatchBuilder(config WatchConfig) *WatchBuilder {
+	if config.Debounce <= 0 {
+		config.Debounce = DefaultWatchDebounce
+	}
+
+	return &WatchBuilder{
+		dir:      config.Dir,
+		build:    config.Build,
+		debounce: config.Debounce,
+		onStart:  config.OnStart,
+	}
+}
+
+// Start watches until ctx is cancelled, calling onRebuild with each build's result
+// It does not build up front; run the initial build before starting the watch
+func (w *WatchBuilder) Start(ctx context.Context, onRebuild func(err error)) error {
+	changes := w.changes
+	if changes == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", w.dir, err)
+		}
+		defer watcher.Close()
+		if err := watchDirs(watcher, w.dir); err != nil {
+			return err
+		}
+
+		// Buffered so a change arriving mid-rebuild isn't lost; the debounce merges the rest
+		notified := make(chan struct{}, 1)
+		go w.forward(watcher, notified)
+		changes = notified
+	}
+
+	var rebuild <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			// Restart the quiet period on every change
+			rebuild = time.After(w.debounce)
+		case <-rebuild:
+			rebuild = nil
+			if w.onStart != nil {
+				w.onStart()
+			}
+			onRebuild(w.build())
+		}
+	}
+}
+
+// forward signals changes for the watcher's events until it is closed, skipping hidden
+// files and directories (editor swap files, .git) and watching directories as they appear
+func (w *WatchBuilder) forward(watcher *fsnotify.Watcher, changes chan<- struct{}) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod || hiddenPath(w.dir, event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// A directory that can't be watched is retried when something in it changes
+					_ = watchDirs(watcher, event.Name)
+				}
+			}
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events were dropped (e.g., the kernel queue overflowed), so rebuild to be safe
+		}
+
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchDirs adds dir and every directory under it to watcher, skipping hidden ones
+func watchDirs(watcher *fsnotify.Watcher, dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	return nil
+}
+
+// hiddenPath reports whether path, under dir, is or is inside a hidden file or directory
+func hiddenPath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+	return false
+}
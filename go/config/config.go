@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the project configuration file box build reads from the working directory
+const FileName = "box.yaml"
+
+// BoxConfig is the project-level configuration in box.yaml
+// Its top-level fields mirror the box build flags and serve as their defaults
+type BoxConfig struct {
+	HandlersDir   string `yaml:"handlersDir,omitempty"`   // --handlers
+	OutputDir     string `yaml:"outputDir,omitempty"`     // --output
+	ProjectID     string `yaml:"projectID,omitempty"`     // --project
+	Region        string `yaml:"region,omitempty"`        // --region
+	Environment   string `yaml:"environment,omitempty"`   // --env
+	ModuleName    string `yaml:"moduleName,omitempty"`    // --module
+	CleanBuildDir bool   `yaml:"cleanBuildDir,omitempty"` // --clean
+	Verbose       bool   `yaml:"verbose,omitempty"`       // --verbose
+
+	// Defaults apply to handlers without the corresponding annotation
+	Defaults Defaults `yaml:"defaults,omitempty"`
+
+	// Middleware lists project-wide middleware by name, in the order it wraps handlers
+	Middleware []MiddlewareConfig `yaml:"middleware,omitempty"`
+
+	// Docs arranges the tags of the generated OpenAPI spec for renderers such as ReDoc
+	Docs DocsConfig `yaml:"docs,omitempty"`
+}
+
+// Defaults are handler settings used when a handler does not annotate them
+type Defaults struct {
+	Memory  string        `yaml:"memory,omitempty"`  // Function memory without @box:memory (e.g., "512MB")
+	Timeout time.Duration `yaml:"timeout,omitempty"` // Request timeout without @box:timeout (e.g., 30s)
+	Auth    string        `yaml:"auth,omitempty"`    // Auth type without @box:auth: required, optional or none
+}
+
+// MiddlewareConfig names a middleware and its options
+type MiddlewareConfig struct {
+	Name    string            `yaml:"name"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// DocsConfig names, describes and groups OpenAPI tags (package names or @box:tags)
+type DocsConfig struct {
+	Tags      []TagConfig      `yaml:"tags,omitempty"`      // Listed first, in this order; other tags follow by name
+	TagGroups []TagGroupConfig `yaml:"tagGroups,omitempty"` // x-tagGroups; without any, tags are grouped by package
+}
+
+// TagConfig documents an OpenAPI tag
+type TagConfig struct {
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"displayName,omitempty"` // x-displayName shown instead of the name
+	Description string `yaml:"description,omitempty"` // Default: "<name> endpoints"
+}
+
+// TagGroupConfig is a navigation group of tags (an x-tagGroups entry)
+type TagGroupConfig struct {
+	Name string   `yaml:"name"`
+	Tags []string `yaml:"tags"`
+}
+
+// LoadConfig reads the box.yaml at path
+// A missing file is not an error: it returns an empty config so every flag keeps its
+// built-in default. Unknown keys are rejected to catch typos
+func LoadConfig(path string) (*BoxConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &BoxConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	cfg := &BoxConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the values the YAML schema can't
+// Memory sizes are checked by the annotation validator along with @box:memory
+func (c *BoxConfig) Validate() error {
+	switch c.Defaults.Auth {
+	case "", "required", "optional", "none":
+	default:
+		return fmt.Errorf("defaults.auth must be 'required', 'optional', or 'none', got: %s", c.Defaults.Auth)
+	}
+
+	if c.Defaults.Timeout < 0 {
+		return fmt.Errorf("defaults.timeout must be positive, got: %s", c.Defaults.Timeout)
+	}
+
+	for i, middleware := range c.Middleware {
+		if middleware.Name == "" {
+			return fmt.Errorf("middleware[%d] has no name", i)
+		}
+	}
+
+	return c.Docs.Validate()
+}
+
+// Validate checks that tags and groups are named and that each tag is documented and
+// grouped at most once
+func (d DocsConfig) Validate() error {
+	documented := make(map[string]bool)
+	for i, tag := range d.Tags {
+		if tag.Name == "" {
+			return fmt.Errorf("docs.tags[%d] has no name", i)
+		}
+		if documented[tag.Name] {
+			return fmt.Errorf("docs.tags lists %s more than once", tag.Name)
+		}
+		documented[tag.Name] = true
+	}
+
+	grouped := make(map[string]string)
+	for i, group := range d.TagGroups {
+		if group.Name == "" {
+			return fmt.Errorf("docs.tagGroups[%d] has no name", i)
+		}
+		if len(group.Tags) == 0 {
+			return fmt.Errorf("docs.tagGroups[%d] (%s) lists no tags", i, group.Name)
+		}
+		for _, tag := range group.Tags {
+			if other, ok := grouped[tag]; ok {
+				return fmt.Errorf("docs.tagGroups puts %s in both %s and %s", tag, other, group.Name)
+			}
+			grouped[tag] = group.Name
+		}
+	}
+
+	return nil
+}
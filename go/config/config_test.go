@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBoxConfigRoundTrip(t *testing.T) {
+	cfg := &BoxConfig{
+		HandlersDir:   "./api",
+		OutputDir:     "./dist",
+		ProjectID:     "my-project",
+		Region:        "europe-west1",
+		Environment:   "staging",
+		ModuleName:    "github.com/acme/orders",
+		CleanBuildDir: true,
+		Verbose:       true,
+		Defaults: Defaults{
+			Memory:  "512MB",
+			Timeout: 45 * time.Second,
+			Auth:    "required",
+		},
+		Middleware: []MiddlewareConfig{
+			{Name: "request-log"},
+			{Name: "audit", Options: map[string]string{"sink": "pubsub", "topic": "audit"}},
+		},
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), "timeout: 45s") {
+		t.Errorf("expected the timeout as a duration string, got:\n%s", data)
+	}
+
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("round trip = %+v, want %+v", loaded, cfg)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *BoxConfig
+		wantErr string
+	}{
+		{
+			name:    "partial config",
+			content: "projectID: my-project\ndefaults:\n  timeout: 2m\n",
+			want:    &BoxConfig{ProjectID: "my-project", Defaults: Defaults{Timeout: 2 * time.Minute}},
+		},
+		{
+			name:    "empty file",
+			content: "",
+			want:    &BoxConfig{},
+		},
+		{
+			name:    "unknown key",
+			content: "projectId: my-project\n",
+			wantErr: "field projectId not found",
+		},
+		{
+			name:    "invalid auth default",
+			content: "defaults:\n  auth: admin\n",
+			wantErr: "defaults.auth must be",
+		},
+		{
+			name:    "negative timeout",
+			content: "defaults:\n  timeout: -5s\n",
+			wantErr: "defaults.timeout must be positive",
+		},
+		{
+			name:    "unnamed middleware",
+			content: "middleware:\n  - options:\n      level: debug\n",
+			wantErr: "middleware[0] has no name",
+		},
+		{
+			name:    "docs",
+			content: "docs:\n  tags:\n    - name: users\n      displayName: User Accounts\n  tagGroups:\n    - name: Accounts\n      tags: [users, auth]\n",
+			want: &BoxConfig{Docs: DocsConfig{
+				Tags:      []TagConfig{{Name: "users", DisplayName: "User Accounts"}},
+				TagGroups: []TagGroupConfig{{Name: "Accounts", Tags: []string{"users", "auth"}}},
+			}},
+		},
+		{
+			name:    "tag documented twice",
+			content: "docs:\n  tags:\n    - name: users\n    - name: users\n",
+			wantErr: "docs.tags lists users more than once",
+		},
+		{
+			name:    "empty tag group",
+			content: "docs:\n  tagGroups:\n    - name: Accounts\n",
+			wantErr: "docs.tagGroups[0] (Accounts) lists no tags",
+		},
+		{
+			name:    "tag in two groups",
+			content: "docs:\n  tagGroups:\n    - name: Accounts\n      tags: [users]\n    - name: Admin\n      tags: [users]\n",
+			wantErr: "docs.tagGroups puts users in both Accounts and Admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_MissingFile(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v, want nil for a missing file", err)
+	}
+	if !reflect.DeepEqual(cfg, &BoxConfig{}) {
+		t.Errorf("LoadConfig() = %+v, want an empty config", cfg)
+	}
+}
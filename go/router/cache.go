@@ -0,0 +1,239 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// CacheStore holds cached responses for CacheMiddleware. Get reports a miss for expired
+// or unknown keys; implementations must be safe for concurrent use.
+//
+// InMemoryCacheStore keeps responses per instance. To share them across instances, back
+// the interface with Redis: Get issues GET key (a nil reply or an error is a miss) and Set
+// issues SET key value PX <ttl in milliseconds>, so Redis expires entries itself
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// scopedCacheStore prefixes keys so handlers sharing a store keep separate entries
+type scopedCacheStore struct {
+	CacheStore
+	scope string
+}
+
+func (s scopedCacheStore) Get(key string) ([]byte, bool) {
+	return s.CacheStore.Get(s.scope + ":" + key)
+}
+
+func (s scopedCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	s.CacheStore.Set(s.scope+":"+key, value, ttl)
+}
+
+// cachedResponse is the stored form of a response
+type cachedResponse struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// CacheMiddleware serves GET responses from store for config.TTL. Responses are keyed by
+// method, path, query and the config's vary headers; hits are marked X-Cache: HIT and
+// everything else X-Cache: MISS. Only GET responses below 400 without Set-Cookie or
+// Cache-Control: no-store or private are stored
+func CacheMiddleware(config *annotations.CacheConfig, store CacheStore) func(http.Handler) http.Handler {
+	maxAge := int(config.TTL.Seconds())
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := cacheKey(r, config.VaryHeaders)
+			if data, ok := store.Get(key); ok {
+				var cached cachedResponse
+				if err := json.Unmarshal(data, &cached); err == nil {
+					// Headers set for this request by earlier middleware (e.g., CORS, rate limits) win
+					for name, values := range cached.Header {
+						if _, set := w.Header()[name]; !set {
+							w.Header()[name] = values
+						}
+					}
+					age := int(time.Since(cached.StoredAt).Seconds())
+					w.Header().Set("Age", fmt.Sprintf("%d", age))
+					w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", max(maxAge-age, 0)))
+					w.Header().Set("X-Cache", "HIT")
+					w.WriteHeader(cached.Status)
+					w.Write(cached.Body)
+					return
+				}
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			cw := &cacheWriter{ResponseWriter: w, maxAge: maxAge, outer: w.Header().Clone()}
+			next.ServeHTTP(cw, r)
+
+			if !cw.cacheable {
+				return
+			}
+			data, err := json.Marshal(cachedResponse{
+				Status:   cw.status,
+				Header:   cw.header,
+				Body:     cw.body.Bytes(),
+				StoredAt: time.Now(),
+			})
+			if err == nil {
+				store.Set(key, data, config.TTL)
+			}
+		})
+	}
+}
+
+// cacheKey hashes the method, path and query, and the vary headers' values sorted by name,
+// so equivalent requests share an entry whatever order their headers arrive in
+func cacheKey(r *http.Request, varyHeaders []string) string {
+	names := slices.Clone(varyHeaders)
+	slices.Sort(names)
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI()))
+	for _, name := range names {
+		fmt.Fprintf(h, "\n%s: %s", name, strings.Join(r.Header.Values(name), ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheWriter passes a response through while keeping a copy of it when it can be cached
+type cacheWriter struct {
+	http.ResponseWriter
+	maxAge int
+
+	// outer holds the headers set before the handler ran, by outer middleware such as CORS
+	// for this request's Origin; they are set again on every request, so they aren't stored
+	outer http.Header
+
+	wroteHeader bool
+	cacheable   bool
+	status      int
+	header      http.Header // Response headers the handler set
+	body        bytes.Buffer
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	header := cw.Header()
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	cw.cacheable = status < http.StatusBadRequest &&
+		header.Get("Set-Cookie") == "" &&
+		!strings.Contains(cacheControl, "no-store") &&
+		!strings.Contains(cacheControl, "private")
+
+	if cw.cacheable {
+		cw.header = handlerHeader(header, cw.outer)
+		header.Set("Cache-Control", fmt.Sprintf("max-age=%d", cw.maxAge))
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.cacheable {
+		cw.body.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// handlerHeader returns the headers of header that differ from those set before the handler ran
+func handlerHeader(header, outer http.Header) http.Header {
+	set := make(http.Header)
+	for name, values := range header {
+		if !slices.Equal(values, outer[name]) {
+			set[name] = slices.Clone(values)
+		}
+	}
+	return set
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// InMemoryCacheStore keeps cached responses in process memory. Entries are local to the
+// instance and dropped once they expire
+type InMemoryCacheStore struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewInMemoryCacheStore creates an empty in-memory cache store
+func NewInMemoryCacheStore() *InMemoryCacheStore {
+	store := &InMemoryCacheStore{entries: make(map[string]cacheEntry)}
+
+	// Start cleanup goroutine
+	go store.cleanup()
+
+	return store
+}
+
+// Get returns the value stored under key unless it has expired
+func (s *InMemoryCacheStore) Get(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key for ttl
+func (s *InMemoryCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+}
+
+// cleanup removes expired entries periodically
+func (s *InMemoryCacheStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,222 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// CircuitState is the state of a handler's circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Requests reach the handler and outcomes are counted
+	CircuitOpen     CircuitState = "open"      // Requests are rejected until the reset timeout passes
+	CircuitHalfOpen CircuitState = "half-open" // One trial request decides whether to close or reopen
+)
+
+// CircuitStats describes a circuit breaker for monitoring
+type CircuitStats struct {
+	State    CircuitState
+	Requests int       // Requests in the sliding window (reset when the circuit changes state)
+	Failures int       // Failed requests in the sliding window
+	OpenedAt time.Time // When the circuit last opened; zero if it never has
+}
+
+// CircuitBreakerStore holds circuit breaker state for CircuitBreakerMiddleware, keyed by
+// handler ("package.function"). Implementations must be safe for concurrent use.
+//
+// InMemoryCircuitBreakerStore keeps state per instance, so each instance trips on the
+// failures it sees itself. Implement the interface over shared storage to trip them together
+type CircuitBreakerStore interface {
+	// Allow reports whether a request may reach the handler. When it may, generation
+	// identifies the circuit state it was let through in; when it may not, retryAfter is
+	// how long until the circuit lets a trial request through
+	Allow(key string, config *annotations.CircuitBreakerConfig) (allowed bool, generation uint64, retryAfter time.Duration)
+
+	// Record counts the outcome of a request Allow let through in generation. Outcomes of
+	// requests let through before the circuit last changed state must be ignored
+	Record(key string, config *annotations.CircuitBreakerConfig, generation uint64, failed bool)
+
+	// Stats returns the circuit's current state
+	Stats(key string) CircuitStats
+}
+
+// circuitBreakers maps the handlers with a circuit breaker to their store, for CircuitBreakerStats
+var circuitBreakers = struct {
+	mu     sync.RWMutex
+	stores map[string]CircuitBreakerStore
+}{stores: make(map[string]CircuitBreakerStore)}
+
+// CircuitBreakerStats returns the circuit breaker state of a handler ("package.function")
+// served by a router. Handlers without a circuit breaker report CircuitClosed
+func CircuitBreakerStats(handlerName string) CircuitStats {
+	circuitBreakers.mu.RLock()
+	store, ok := circuitBreakers.stores[handlerName]
+	circuitBreakers.mu.RUnlock()
+
+	if !ok {
+		return CircuitStats{State: CircuitClosed}
+	}
+	return store.Stats(handlerName)
+}
+
+// CircuitBreakerMiddleware stops calling the handler once config.FailureThreshold of its
+// last requests failed with a 5xx status or a panic. While the circuit is open, requests
+// get 503 with Retry-After; after config.ResetTimeout one trial request is let through,
+// and its outcome closes the circuit or opens it again
+func CircuitBreakerMiddleware(handlerName string, config *annotations.CircuitBreakerConfig, store CircuitBreakerStore, logger *zap.Logger) func(http.Handler) http.Handler {
+	circuitBreakers.mu.Lock()
+	circuitBreakers.stores[handlerName] = store
+	circuitBreakers.mu.Unlock()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, generation, retryAfter := store.Allow(handlerName, config)
+			if !allowed {
+				logger.Debug("Circuit open", zap.String("handler", handlerName), zap.String("path", r.URL.Path))
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", max(int(math.Ceil(retryAfter.Seconds())), 1)))
+				WriteError(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable")
+				return
+			}
+
+			// A panic counts as a failure on its way up to the server's recovery
+			failed := true
+			defer func() { store.Record(handlerName, config, generation, failed) }()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			failed = ww.Status() >= http.StatusInternalServerError
+		})
+	}
+}
+
+// InMemoryCircuitBreakerStore keeps circuit breaker state in process memory
+type InMemoryCircuitBreakerStore struct {
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is one handler's breaker: a ring of the outcomes of its last requests while
+// closed, and the time it opened otherwise
+type circuit struct {
+	state      CircuitState
+	generation uint64 // Incremented on every state change, so stale outcomes can be told apart
+	outcomes   []bool // true for a failure; len is the window size
+	next       int    // Index the next outcome is written to
+	requests   int
+	failures   int
+	openedAt   time.Time
+	trial      bool // A half-open trial request is in flight
+}
+
+// NewInMemoryCircuitBreakerStore creates an empty in-memory circuit breaker store
+func NewInMemoryCircuitBreakerStore() *InMemoryCircuitBreakerStore {
+	return &InMemoryCircuitBreakerStore{circuits: make(map[string]*circuit)}
+}
+
+// circuit returns the breaker for key, creating a closed one; s.mu must be held
+func (s *InMemoryCircuitBreakerStore) circuit(key string, config *annotations.CircuitBreakerConfig) *circuit {
+	c, ok := s.circuits[key]
+	if !ok {
+		c = &circuit{state: CircuitClosed, outcomes: make([]bool, config.EffectiveWindow())}
+		s.circuits[key] = c
+	}
+	return c
+}
+
+// Allow lets requests through a closed circuit, rejects them while it is open, and lets a
+// single trial request through once config.ResetTimeout has passed
+func (s *InMemoryCircuitBreakerStore) Allow(key string, config *annotations.CircuitBreakerConfig) (bool, uint64, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.circuit(key, config)
+	switch c.state {
+	case CircuitOpen:
+		if wait := time.Until(c.openedAt.Add(config.ResetTimeout)); wait > 0 {
+			return false, 0, wait
+		}
+		c.reset(CircuitHalfOpen)
+		c.trial = true
+		return true, c.generation, 0
+	case CircuitHalfOpen:
+		// Callers wait for the trial request in flight
+		if c.trial {
+			return false, 0, 0
+		}
+		c.trial = true
+		return true, c.generation, 0
+	default:
+		return true, c.generation, 0
+	}
+}
+
+// Record adds an outcome to the sliding window of a closed circuit, opening it at the
+// threshold, and closes or reopens a half-open one. Outcomes from an earlier generation
+// are dropped: a slow request let through before the circuit opened neither decides a
+// half-open trial nor counts toward the new window
+func (s *InMemoryCircuitBreakerStore) Record(key string, config *annotations.CircuitBreakerConfig, generation uint64, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.circuit(key, config)
+	if generation != c.generation {
+		return
+	}
+	switch c.state {
+	case CircuitHalfOpen:
+		c.trial = false
+		if failed {
+			c.open()
+		} else {
+			c.reset(CircuitClosed)
+		}
+	case CircuitClosed:
+		if c.requests == len(c.outcomes) && c.outcomes[c.next] {
+			c.failures--
+		}
+		c.outcomes[c.next] = failed
+		c.next = (c.next + 1) % len(c.outcomes)
+		c.requests = min(c.requests+1, len(c.outcomes))
+		if failed {
+			c.failures++
+		}
+		if c.failures >= config.FailureThreshold {
+			c.open()
+		}
+	}
+}
+
+// Stats returns the circuit's current state; unknown keys are closed
+func (s *InMemoryCircuitBreakerStore) Stats(key string) CircuitStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.circuits[key]
+	if !ok {
+		return CircuitStats{State: CircuitClosed}
+	}
+	return CircuitStats{State: c.state, Requests: c.requests, Failures: c.failures, OpenedAt: c.openedAt}
+}
+
+// open trips the circuit now
+func (c *circuit) open() {
+	c.reset(CircuitOpen)
+	c.openedAt = time.Now()
+}
+
+// reset moves the circuit to state with an empty window, starting a new generation
+func (c *circuit) reset(state CircuitState) {
+	c.state = state
+	c.generation++
+	clear(c.outcomes)
+	c.next, c.requests, c.failures = 0, 0, 0
+}
@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"os"
+)
+
+// Environment variables carrying deployment metadata
+// Generated entrypoints and Terraform set these; DeploymentInfoFromEnv reads them
+const (
+	EnvEnvironment  = "BOX_ENVIRONMENT"
+	EnvRegion       = "BOX_REGION"
+	EnvFunctionName = "BOX_FUNCTION_NAME"
+	EnvService      = "BOX_SERVICE"
+)
+
+// DeploymentInfo describes where a handler is running
+type DeploymentInfo struct {
+	Environment  string // Environment name (e.g., "dev", "production")
+	Region       string // GCP region (e.g., "us-central1"); empty when running locally
+	FunctionName string // Handler function name (e.g., "CreateUser")
+	Service      string // Container service name; empty for cloud functions
+}
+
+const deploymentInfoKey contextKey = "box.deployment"
+
+// DeploymentInfoFromEnv reads deployment metadata from the BOX_* environment variables
+// The environment falls back to $ENVIRONMENT, matching the router's own default
+func DeploymentInfoFromEnv() DeploymentInfo {
+	info := DeploymentInfo{
+		Environment:  os.Getenv(EnvEnvironment),
+		Region:       os.Getenv(EnvRegion),
+		FunctionName: os.Getenv(EnvFunctionName),
+		Service:      os.Getenv(EnvService),
+	}
+	if info.Environment == "" {
+		info.Environment = os.Getenv("ENVIRONMENT")
+	}
+	return info
+}
+
+// WithDeploymentInfo returns a copy of ctx carrying info
+func WithDeploymentInfo(ctx context.Context, info DeploymentInfo) context.Context {
+	return context.WithValue(ctx, deploymentInfoKey, info)
+}
+
+// DeploymentInfoFromContext returns the deployment metadata for the current request
+// Cloud functions call handlers directly, so without a value in ctx this falls back to the environment
+func DeploymentInfoFromContext(ctx context.Context) DeploymentInfo {
+	if info, ok := ctx.Value(deploymentInfoKey).(DeploymentInfo); ok {
+		return info
+	}
+	return DeploymentInfoFromEnv()
+}
+
+// DeploymentInfoMiddleware attaches info to every request's context
+func DeploymentInfoMiddleware(info DeploymentInfo) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithDeploymentInfo(r.Context(), info)))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorFormat selects the JSON envelope of the error responses the router's middleware writes
+type ErrorFormat string
+
+const (
+	// ErrorFormatBox writes {"error":"Rate limit exceeded"} (default)
+	ErrorFormatBox ErrorFormat = "box"
+
+	// ErrorFormatGateway writes {"code":429,"message":"Rate limit exceeded"}, the envelope
+	// GCP API Gateway uses when it rejects a request before it reaches the backend
+	ErrorFormatGateway ErrorFormat = "gateway"
+)
+
+const errorFormatKey contextKey = "box.errorFormat"
+
+// WithErrorFormat returns a copy of ctx whose error responses use format
+func WithErrorFormat(ctx context.Context, format ErrorFormat) context.Context {
+	return context.WithValue(ctx, errorFormatKey, format)
+}
+
+// ErrorFormatFromContext returns the error format for the current request, ErrorFormatBox by default
+func ErrorFormatFromContext(ctx context.Context) ErrorFormat {
+	if format, ok := ctx.Value(errorFormatKey).(ErrorFormat); ok {
+		return format
+	}
+	return ErrorFormatBox
+}
+
+// ErrorFormatMiddleware attaches format to every request's context for WriteError
+func ErrorFormatMiddleware(format ErrorFormat) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithErrorFormat(r.Context(), format)))
+		})
+	}
+}
+
+// boxError is the ErrorFormatBox envelope
+type boxError struct {
+	Error string `json:"error"`
+}
+
+// gatewayError is the ErrorFormatGateway envelope
+type gatewayError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// WriteError writes a JSON error response in the request's error format
+// Handlers can use it too, so their errors share the middleware's shape
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	var body any = boxError{Error: message}
+	if ErrorFormatFromContext(r.Context()) == ErrorFormatGateway {
+		body = gatewayError{Code: status, Message: message}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
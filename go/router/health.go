@@ -0,0 +1,65 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// ReadinessCheck reports whether a dependency (e.g., the database) can serve traffic
+type ReadinessCheck func(ctx context.Context) error
+
+// readinessChecks holds the checks run by HealthHandler, keyed by name
+var readinessChecks = struct {
+	sync.RWMutex
+	checks map[string]ReadinessCheck
+}{checks: make(map[string]ReadinessCheck)}
+
+// RegisterReadinessCheck adds a named check to the health endpoint
+// Registering a name twice replaces the earlier check. Typically called from init()
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	readinessChecks.Lock()
+	defer readinessChecks.Unlock()
+	readinessChecks.checks[name] = check
+}
+
+// HealthHandler serves the health endpoint used by container and Cloud Run probes
+// It responds 200 when every registered readiness check passes, and 503 listing the failures otherwise
+func HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures := runReadinessChecks(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(failures) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "unavailable",
+				"checks": failures,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	}
+}
+
+// runReadinessChecks runs all registered checks and returns failure messages by name
+func runReadinessChecks(ctx context.Context) map[string]string {
+	// Copy the checks so slow checks don't hold the lock
+	readinessChecks.RLock()
+	checks := make(map[string]ReadinessCheck, len(readinessChecks.checks))
+	for name, check := range readinessChecks.checks {
+		checks[name] = check
+	}
+	readinessChecks.RUnlock()
+
+	failures := make(map[string]string)
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			failures[name] = err.Error()
+		}
+	}
+	return failures
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Identity is the authenticated caller of a request
+// TokenValidators produce it; AuthMiddleware attaches it to the request context
+type Identity interface {
+	Subject() string        // Stable caller ID (e.g., the JWT "sub" claim)
+	Scopes() []string       // Granted scopes, empty if the token carries none
+	Claims() map[string]any // Raw token claims, for anything the accessors don't cover
+}
+
+// TokenValidator validates a bearer token and returns the caller's identity
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (Identity, error)
+}
+
+// Claims is an Identity backed by decoded token claims, such as a JWT payload
+// Scopes come from a space-separated "scope" claim or a "scp" list
+type Claims map[string]any
+
+// Subject returns the "sub" claim
+func (c Claims) Subject() string {
+	subject, _ := c["sub"].(string)
+	return subject
+}
+
+// Scopes returns the "scope" claim split on spaces, or the "scp" claim
+func (c Claims) Scopes() []string {
+	if scope, ok := c["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	switch scp := c["scp"].(type) {
+	case []string:
+		return scp
+	case []any:
+		var scopes []string
+		for _, s := range scp {
+			if str, ok := s.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+		return scopes
+	case string:
+		return strings.Fields(scp)
+	}
+	return nil
+}
+
+// Claims returns the claims themselves
+func (c Claims) Claims() map[string]any {
+	return c
+}
+
+// HasScope reports whether the identity was granted scope
+func HasScope(identity Identity, scope string) bool {
+	return identity != nil && slices.Contains(identity.Scopes(), scope)
+}
+
+// Roles returns the roles in the identity's claim, which may be a list or a
+// space- or comma-separated string
+func Roles(identity Identity, claim string) []string {
+	if identity == nil {
+		return nil
+	}
+
+	switch roles := identity.Claims()[claim].(type) {
+	case []string:
+		return roles
+	case []any:
+		var result []string
+		for _, role := range roles {
+			if str, ok := role.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	case string:
+		return strings.FieldsFunc(roles, func(r rune) bool { return r == ' ' || r == ',' })
+	}
+	return nil
+}
+
+// hasAnyRole reports whether the identity's roles claim includes one of roles
+func hasAnyRole(identity Identity, claim string, roles []string) bool {
+	for _, role := range Roles(identity, claim) {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+const identityKey contextKey = "box.auth.identity"
+
+// WithIdentity returns a copy of ctx carrying identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// IdentityFromContext returns the identity AuthMiddleware attached to the request
+// It is absent on unauthenticated requests and when no TokenValidator is configured
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(Identity)
+	return identity, ok && identity != nil
+}
@@ -1,17 +1,42 @@
 package router
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/gravelight-studio/box/go/annotations"
 )
@@ -125,6 +150,102 @@ func TestHandler(w http.ResponseWriter, r *http.Request) {}
 	assert.Equal(t, "test response", w.Body.String())
 }
 
+// versionHandler is an http.Handler implementation, as a library would provide
+type versionHandler struct{ version string }
+
+func (h versionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(h.version))
+}
+
+func TestIntegration_HTTPHandlerRegistration(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/v1/version
+// @box:auth required
+func Version() http.Handler { return nil }
+
+// @box:function
+// @box:path GET /api/v1/ping
+func Ping(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.Ping": testHandler("pong"),
+		},
+		HTTPHandlers: map[string]http.Handler{
+			"handlers.Version": versionHandler{version: "1.4.2"},
+		},
+	})
+	require.NoError(t, err)
+
+	// The handler value gets the same middleware as a handler function
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/version", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "/api/v1/version", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.4.2", w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	t.Run("duplicate implementation", func(t *testing.T) {
+		_, err := New(Config{
+			HandlersDir: tmpDir,
+			Logger:      zap.NewNop(),
+			Handlers: map[string]http.HandlerFunc{
+				"handlers.Ping":    testHandler("pong"),
+				"handlers.Version": testHandler("1.4.2"),
+			},
+			HTTPHandlers: map[string]http.Handler{
+				"handlers.Version": versionHandler{version: "1.4.2"},
+			},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler handlers.Version is set in both Handlers and HTTPHandlers")
+	})
+}
+
+func TestHandlerRegistryConcurrentRegister(t *testing.T) {
+	registry := newHandlerRegistry(zap.NewNop())
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// Register and look up from many goroutines at once; go test -race flags unguarded access
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("Handler%02d", i)
+			registry.register("pkg", name, noop)
+			_, err := registry.getHandler("pkg", name)
+			assert.NoError(t, err)
+			registry.Len()
+			registry.List()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, registry.Len())
+	list := registry.List()
+	require.Len(t, list, 50)
+	assert.Equal(t, "pkg.Handler00", list[0])
+	assert.True(t, slices.IsSorted(list))
+}
+
 func TestIntegration_HTTPMethods(t *testing.T) {
 	tmpDir := createTestHandlerDir(t, map[string]string{
 		"handlers.go": `package handlers
@@ -215,6 +336,387 @@ func TestHandler(w http.ResponseWriter, r *http.Request) {}
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestIntegration_CORSMaxAgeAndExposedHeaders(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/items
+// @box:cors origins=https://app.example.com max-age=600 expose=X-Total-Count,Link
+func ListItems(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/status
+// @box:cors origins=*
+func GetStatus(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.ListItems": testHandler("items"),
+			"handlers.GetStatus": testHandler("OK"),
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("exposed headers on actual request", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "X-Total-Count, Link", w.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("max-age on preflight", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/status", nil)
+		req.Header.Set("Origin", "https://example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "Link", w.Header().Get("Access-Control-Expose-Headers"))
+
+		req = httptest.NewRequest("OPTIONS", "/api/status", nil)
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "300", w.Header().Get("Access-Control-Max-Age"))
+	})
+}
+
+func TestIntegration_OptionsDiscovery(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/orders
+// @box:ratelimit 100/hour
+func ListOrders(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /api/orders
+// @box:timeout 30s
+// @box:cors origins=https://app.example.com
+func CreateOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path DELETE /api/orders/{id}
+func DeleteOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/custom
+func GetCustom(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path OPTIONS /api/custom
+func OptionsCustom(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	newRouter := func(hints bool) *Router {
+		router, err := New(Config{
+			HandlersDir: tmpDir,
+			Logger:      zap.NewNop(),
+			Handlers: map[string]http.HandlerFunc{
+				"handlers.ListOrders":    testHandler("orders"),
+				"handlers.CreateOrder":   testHandler("created"),
+				"handlers.DeleteOrder":   testHandler("deleted"),
+				"handlers.GetCustom":     testHandler("custom"),
+				"handlers.OptionsCustom": testHandler("custom options"),
+			},
+			OptionsHints: hints,
+		})
+		require.NoError(t, err)
+		return router
+	}
+	options := func(router *Router, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("OPTIONS", path, nil))
+		return w
+	}
+
+	router := newRouter(false)
+
+	w := options(router, "/api/orders")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS, POST", w.Header().Get("Allow"))
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"), "hints are opt-in")
+	assert.Empty(t, w.Header().Get("X-Timeout"), "hints are opt-in")
+
+	w = options(router, "/api/orders/42")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "DELETE, OPTIONS", w.Header().Get("Allow"))
+
+	// An explicit OPTIONS handler keeps the path
+	w = options(router, "/api/custom")
+	assert.Equal(t, "custom options", w.Body.String())
+
+	// CORS preflights on the path are still answered by the CORS middleware
+	req := httptest.NewRequest("OPTIONS", "/api/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = options(newRouter(true), "/api/orders")
+	assert.Equal(t, "GET, OPTIONS, POST", w.Header().Get("Allow"))
+	assert.Equal(t, "GET=100;w=3600", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "POST=30s", w.Header().Get("X-Timeout"))
+}
+
+func TestIntegration_CORSWildcardSubdomains(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/items
+// @box:cors origins=https://*.example.com,https://partner.io
+func ListItems(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.ListItems": testHandler("items"),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://eu.admin.example.com", true},
+		{"https://partner.io", true},
+		{"https://example.com", false},
+		{"https://notexample.com", false},
+		{"http://app.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/items", nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestIntegration_CORSCredentials(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/session
+// @box:cors origins=https://app.example.com credentials=true
+func GetSession(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/public
+// @box:cors origins=* credentials=true
+func GetPublic(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.GetSession": testHandler("session"),
+			"handlers.GetPublic":  testHandler("public"),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		path    string
+		origin  string
+		allowed bool
+	}{
+		{"listed origin", "/api/session", "https://app.example.com", true},
+		{"unlisted origin", "/api/session", "https://evil.example.com", false},
+		{"any origin is echoed", "/api/public", "https://partner.io", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if tt.allowed {
+				// Browsers reject credentialed responses that allow "*"
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+			}
+		})
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/session", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
+
+func TestIntegration_Pagination(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/users
+// @box:paginated
+func ListUsers(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	users := make([]string, 45)
+	for i := range users {
+		users[i] = fmt.Sprintf("user-%d", i+1)
+	}
+
+	listUsers := func(w http.ResponseWriter, r *http.Request) {
+		page, err := PageFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		end := min(page.Offset()+page.Limit, len(users))
+		start := min(page.Offset(), end)
+		require.NoError(t, WritePage(w, users[start:end], page, len(users)))
+	}
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.ListUsers": listUsers,
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantLink  string
+		wantFirst string
+		wantCount int
+	}{
+		{
+			name:      "defaults to first page",
+			query:     "",
+			wantLink:  `</api/users?limit=20&page=1>; rel="first", </api/users?limit=20&page=2>; rel="next", </api/users?limit=20&page=3>; rel="last"`,
+			wantFirst: "user-1",
+			wantCount: 20,
+		},
+		{
+			name:      "middle page keeps other query params",
+			query:     "?page=2&limit=10&sort=name",
+			wantLink:  `</api/users?limit=10&page=1&sort=name>; rel="first", </api/users?limit=10&page=1&sort=name>; rel="prev", </api/users?limit=10&page=3&sort=name>; rel="next", </api/users?limit=10&page=5&sort=name>; rel="last"`,
+			wantFirst: "user-11",
+			wantCount: 10,
+		},
+		{
+			name:      "last page",
+			query:     "?page=3",
+			wantLink:  `</api/users?limit=20&page=1>; rel="first", </api/users?limit=20&page=2>; rel="prev", </api/users?limit=20&page=3>; rel="last"`,
+			wantFirst: "user-41",
+			wantCount: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/users"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "45", w.Header().Get("X-Total-Count"))
+			assert.Equal(t, tt.wantLink, w.Header().Get("Link"))
+
+			var page []string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+			assert.Len(t, page, tt.wantCount)
+			assert.Equal(t, tt.wantFirst, page[0])
+		})
+	}
+
+	t.Run("invalid page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/users?page=0", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "page must be a positive integer")
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/users?limit=500", nil)
+		page, err := PageFromRequest(req)
+		require.NoError(t, err)
+		assert.Equal(t, MaxPageLimit, page.Limit)
+	})
+}
+
 func TestIntegration_AuthMiddleware(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -297,31 +799,1121 @@ func TestHandler(w http.ResponseWriter, r *http.Request) {}
 	}
 }
 
-func TestIntegration_RateLimitMiddleware(t *testing.T) {
+func TestIntegration_AuthBypass(t *testing.T) {
 	tmpDir := createTestHandlerDir(t, map[string]string{
 		"handlers.go": `package handlers
 
 import "net/http"
 
 // @box:function
-// @box:path GET /api/test
-// @box:ratelimit 3/minute
-func TestHandler(w http.ResponseWriter, r *http.Request) {}
+// @box:path GET /api/protected
+// @box:auth required
+func Protected(w http.ResponseWriter, r *http.Request) {}
 `,
 	})
 
-	router, err := New(Config{
-		HandlersDir: tmpDir,
-		Logger:      zap.NewNop(),
-		Handlers: map[string]http.HandlerFunc{
-			"handlers.TestHandler": testHandler("OK"),
-		},
-	})
-	require.NoError(t, err)
+	subjectHandler := func(w http.ResponseWriter, r *http.Request) {
+		subject, _ := AuthSubjectFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(subject))
+	}
 
-	// Make requests up to the limit
-	for i := 0; i < 3; i++ {
-		req := httptest.NewRequest("GET", "/api/test", nil)
+	tests := []struct {
+		name           string
+		bypass         bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "bypass disabled rejects unauthenticated request",
+			bypass:         false,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bypass enabled injects fake identity",
+			bypass:         true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   BypassSubject,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := New(Config{
+				HandlersDir: tmpDir,
+				Logger:      zap.NewNop(),
+				Handlers: map[string]http.HandlerFunc{
+					"handlers.Protected": subjectHandler,
+				},
+				Environment: "dev",
+				AuthBypass:  tt.bypass,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/api/protected", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, readResponse(w.Body))
+			}
+		})
+	}
+
+	t.Run("bypass refused in production", func(t *testing.T) {
+		for _, env := range []string{"production", "prod", "Production"} {
+			_, err := New(Config{
+				HandlersDir: tmpDir,
+				Logger:      zap.NewNop(),
+				Handlers: map[string]http.HandlerFunc{
+					"handlers.Protected": subjectHandler,
+				},
+				Environment: env,
+				AuthBypass:  true,
+			})
+			require.Error(t, err, env)
+			assert.Contains(t, err.Error(), "auth bypass")
+		}
+	})
+
+	t.Run("bypass refused when ENVIRONMENT is production", func(t *testing.T) {
+		t.Setenv("ENVIRONMENT", "production")
+
+		_, err := New(Config{
+			HandlersDir: tmpDir,
+			Logger:      zap.NewNop(),
+			Handlers: map[string]http.HandlerFunc{
+				"handlers.Protected": subjectHandler,
+			},
+			AuthBypass: true,
+		})
+		require.Error(t, err)
+	})
+}
+
+// stubValidator accepts tokens of the form "user:<subject>" and grants the "read" scope
+type stubValidator struct{}
+
+func (stubValidator) ValidateToken(ctx context.Context, token string) (Identity, error) {
+	subject, ok := strings.CutPrefix(token, "user:")
+	if !ok {
+		return nil, errors.New("unknown token")
+	}
+	return Claims{"sub": subject, "scope": "read"}, nil
+}
+
+func TestIntegration_TokenValidatorIdentity(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/me
+// @box:auth required
+// @box:ratelimit 2/minute
+func Me(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/feed
+// @box:auth optional
+func Feed(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	identityHandler := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := IdentityFromContext(r.Context())
+		if !ok {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		fmt.Fprintf(w, "%s %v", identity.Subject(), HasScope(identity, "read"))
+	}
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.Me":   identityHandler,
+			"handlers.Feed": identityHandler,
+		},
+		TokenValidator: stubValidator{},
+	})
+	require.NoError(t, err)
+
+	serve := func(path, token, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/api/me", "user:alice", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice true", readResponse(w.Body))
+
+	assert.Equal(t, http.StatusUnauthorized, serve("/api/me", "forged", "").Code)
+
+	// Optional auth serves anonymous callers but still rejects bad tokens
+	assert.Equal(t, "anonymous", readResponse(serve("/api/feed", "", "").Body))
+	assert.Equal(t, "alice true", readResponse(serve("/api/feed", "user:alice", "").Body))
+	assert.Equal(t, http.StatusUnauthorized, serve("/api/feed", "forged", "").Code)
+
+	// Rate limits follow the subject, not the address (alice used one request above)
+	assert.Equal(t, http.StatusOK, serve("/api/me", "user:alice", "198.51.100.7:5000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api/me", "user:alice", "203.0.113.9:5000").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/me", "user:bob", "").Code)
+}
+
+// claimsValidator maps each known token to its claims
+type claimsValidator map[string]Claims
+
+func (v claimsValidator) ValidateToken(ctx context.Context, token string) (Identity, error) {
+	claims, ok := v[token]
+	if !ok {
+		return nil, errors.New("unknown token")
+	}
+	return claims, nil
+}
+
+func TestIntegration_RequiredRoles(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path DELETE /api/posts/{id}
+// @box:auth required
+// @box:roles admin,moderator
+func DeletePost(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/reports
+// @box:auth required roles-claim=groups
+// @box:roles finance
+func Reports(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	okHandler := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	handlers := map[string]http.HandlerFunc{
+		"handlers.DeletePost": okHandler,
+		"handlers.Reports":    okHandler,
+	}
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers:    handlers,
+		TokenValidator: claimsValidator{
+			"moderator": {"sub": "mo", "roles": []any{"user", "moderator"}},
+			"user":      {"sub": "ursula", "roles": []any{"user"}},
+			"no-claim":  {"sub": "nobody"},
+			"finance":   {"sub": "fin", "groups": "staff finance"},
+		},
+	})
+	require.NoError(t, err)
+
+	serve := func(router *Router, method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(router, "DELETE", "/api/posts/1", "moderator")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", readResponse(w.Body))
+
+	w = serve(router, "DELETE", "/api/posts/1", "user")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"Insufficient role"}`, readResponse(w.Body))
+
+	assert.Equal(t, http.StatusForbidden, serve(router, "DELETE", "/api/posts/1", "no-claim").Code, "missing roles claim")
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "DELETE", "/api/posts/1", "forged").Code)
+
+	// roles-claim reads another claim, here a space-separated string
+	assert.Equal(t, http.StatusOK, serve(router, "GET", "/api/reports", "finance").Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, "GET", "/api/reports", "moderator").Code)
+
+	// Without a validator there are no roles to check, so the request is refused
+	unverified, err := New(Config{HandlersDir: tmpDir, Logger: zap.NewNop(), Handlers: handlers})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve(unverified, "DELETE", "/api/posts/1", "moderator").Code)
+}
+
+func TestClaimsIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims Claims
+		want   []string
+	}{
+		{"scope string", Claims{"scope": "read write"}, []string{"read", "write"}},
+		{"scp list", Claims{"scp": []any{"read", "admin"}}, []string{"read", "admin"}},
+		{"scp string", Claims{"scp": "read"}, []string{"read"}},
+		{"no scopes", Claims{"sub": "alice"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.claims.Scopes())
+		})
+	}
+
+	claims := Claims{"sub": "alice", "email": "alice@example.com"}
+	assert.Equal(t, "alice", claims.Subject())
+	assert.Equal(t, "alice@example.com", claims.Claims()["email"])
+	assert.False(t, HasScope(claims, "read"))
+	assert.False(t, HasScope(nil, "read"))
+
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(t, ok)
+	identity, ok := IdentityFromContext(WithIdentity(context.Background(), claims))
+	require.True(t, ok)
+	assert.Equal(t, "alice", identity.Subject())
+}
+
+// jwtIssuer serves a JWKS and signs test tokens with RSA and EC keys
+type jwtIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newJWTIssuer(t *testing.T) *jwtIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issuer := &jwtIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// sign returns a token for claims; alg is RS256 or ES256
+func (i *jwtIssuer) sign(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestIntegration_JWTValidation(t *testing.T) {
+	issuer := newJWTIssuer(t)
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/orders
+// @box:auth required issuer=` + issuer.server.URL + ` audience=orders-api
+func ListOrders(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.ListOrders": func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := ClaimsFromContext(r.Context())
+				w.Write([]byte(claims.Subject()))
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().Unix()
+	valid := func() map[string]any {
+		return map[string]any{"sub": "alice", "iss": issuer.server.URL, "aud": "orders-api", "iat": now, "exp": now + 300}
+	}
+	with := func(key string, value any) map[string]any {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	tampered := issuer.sign(t, "RS256", valid())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"RS256", issuer.sign(t, "RS256", valid()), http.StatusOK},
+		{"ES256", issuer.sign(t, "ES256", valid()), http.StatusOK},
+		{"audience list", issuer.sign(t, "RS256", with("aud", []string{"billing", "orders-api"})), http.StatusOK},
+		{"expired", issuer.sign(t, "RS256", with("exp", now-3600)), http.StatusUnauthorized},
+		{"no exp", issuer.sign(t, "RS256", with("exp", nil)), http.StatusUnauthorized},
+		{"issued in the future", issuer.sign(t, "ES256", with("iat", now+3600)), http.StatusUnauthorized},
+		{"wrong issuer", issuer.sign(t, "RS256", with("iss", "https://evil.example.com")), http.StatusUnauthorized},
+		{"wrong audience", issuer.sign(t, "RS256", with("aud", "billing")), http.StatusUnauthorized},
+		{"missing aud", issuer.sign(t, "RS256", with("aud", nil)), http.StatusUnauthorized},
+		{"tampered signature", tampered, http.StatusUnauthorized},
+		{"stripped signature", strings.Join(strings.Split(issuer.sign(t, "RS256", valid()), ".")[:2], ".") + ".", http.StatusUnauthorized},
+		{"not a JWT", "opaque-token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "alice", readResponse(w.Body))
+			}
+		})
+	}
+}
+
+func TestIntegration_JWKSUnavailable(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	token := newJWTIssuer(t).sign(t, "RS256", map[string]any{"sub": "alice", "exp": time.Now().Unix() + 300})
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			auth := "required issuer=" + down.URL
+			if strict {
+				auth += " strict"
+			}
+			tmpDir := createTestHandlerDir(t, map[string]string{
+				"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/orders
+// @box:auth ` + auth + `
+func ListOrders(w http.ResponseWriter, r *http.Request) {}
+`,
+			})
+
+			router, err := New(Config{
+				HandlersDir: tmpDir,
+				Logger:      zap.NewNop(),
+				Handlers:    map[string]http.HandlerFunc{"handlers.ListOrders": testHandler("OK")},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/api/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Permissive mode accepts tokens it cannot verify; strict mode rejects them
+			if strict {
+				assert.Equal(t, http.StatusUnauthorized, w.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+		})
+	}
+}
+
+func TestJWTValidatorKeyRotation(t *testing.T) {
+	issuer := newJWTIssuer(t)
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		issuer.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	clock := time.Now()
+	validator := NewJWTValidator(server.URL+"/.well-known/jwks.json", "", "", zap.NewNop())
+	validator.now = func() time.Time { return clock }
+
+	token := issuer.sign(t, "ES256", map[string]any{"sub": "alice", "exp": clock.Unix() + 3600})
+	_, err := validator.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+	_, err = validator.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches, "keys are cached")
+
+	clock = clock.Add(JWKSRefreshInterval)
+	_, err = validator.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches, "keys are refetched after the refresh interval")
+
+	// A failed refresh keeps the cached keys
+	server.Config.Handler = http.NotFoundHandler()
+	clock = clock.Add(JWKSRefreshInterval)
+	_, err = validator.ValidateToken(context.Background(), token)
+	require.NoError(t, err)
+}
+
+func TestIntegration_JWTValidatorShared(t *testing.T) {
+	issuer := newJWTIssuer(t)
+	var mu sync.Mutex
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		issuer.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	jwks := server.URL + "/.well-known/jwks.json"
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/orders
+// @box:auth required jwks=` + jwks + ` audience=orders-api
+func ListOrders(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/orders/{id}
+// @box:auth required jwks=` + jwks + ` audience=orders-api
+func GetOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/invoices
+// @box:auth required jwks=` + jwks + ` audience=billing-api
+func ListInvoices(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.ListOrders":   testHandler("orders"),
+			"handlers.GetOrder":     testHandler("order"),
+			"handlers.ListInvoices": testHandler("invoices"),
+		},
+	})
+	require.NoError(t, err)
+
+	// One validator, and one fetch, per JWKS endpoint, issuer and audience
+	assert.Len(t, router.jwtValidators, 2)
+	assert.Equal(t, 2, fetches)
+
+	token := issuer.sign(t, "RS256", map[string]any{"sub": "alice", "aud": "orders-api", "exp": time.Now().Unix() + 300})
+	for _, path := range []string{"/api/orders", "/api/orders/1"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+	assert.Equal(t, 2, fetches, "cached keys are shared")
+}
+
+func TestJWTValidatorFetchOutsideLock(t *testing.T) {
+	issuer := newJWTIssuer(t)
+	var mu sync.Mutex
+	var fetches int
+	release := make(chan struct{})
+	blocking := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		first := fetches == 1
+		mu.Unlock()
+		if !first {
+			blocking <- struct{}{}
+			<-release
+		}
+		issuer.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	clock := time.Now()
+	validator := NewJWTValidator(server.URL+"/.well-known/jwks.json", "", "", zap.NewNop())
+	validator.now = func() time.Time { return clock }
+	require.NoError(t, validator.Refresh(context.Background()))
+	clock = clock.Add(jwksMinRefetch)
+
+	token := issuer.sign(t, "ES256", map[string]any{"sub": "alice", "exp": clock.Unix() + 300})
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"rotated"}`))
+	rotated := header + token[strings.Index(token, "."):]
+
+	// Tokens with an unknown key refetch once; the others wait for that fetch
+	results := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := validator.ValidateToken(context.Background(), rotated)
+			results <- err
+		}()
+	}
+	<-blocking
+
+	// The fetch doesn't hold the lock, so tokens signed with cached keys still validate
+	validated := make(chan error, 1)
+	go func() {
+		_, err := validator.ValidateToken(context.Background(), token)
+		validated <- err
+	}()
+	select {
+	case err := <-validated:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation with a cached key waited for the JWKS fetch")
+	}
+
+	close(release)
+	for range 2 {
+		err := <-results
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown signing key "rotated"`)
+	}
+	assert.Equal(t, 2, fetches, "concurrent refetches are coalesced")
+}
+
+func TestIntegration_PreloadMiddleware(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /app
+// @box:auth none
+// @box:preload /static/app.css
+// @box:preload /static/app.js,/fonts/inter.woff2
+func App(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.App": testHandler("app"),
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/app", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{
+		"</static/app.css>; rel=preload; as=style",
+		"</static/app.js>; rel=preload; as=script",
+		"</fonts/inter.woff2>; rel=preload; as=font; crossorigin",
+	}, w.Header().Values("Link"))
+}
+
+func TestIntegration_DeploymentInfo(t *testing.T) {
+	t.Setenv(EnvEnvironment, "")
+	t.Setenv(EnvRegion, "europe-west1")
+	t.Setenv(EnvFunctionName, "")
+	t.Setenv(EnvService, "")
+
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /whoami
+func WhoAmI(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var info DeploymentInfo
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Environment: "staging",
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.WhoAmI": func(w http.ResponseWriter, r *http.Request) {
+				info = DeploymentInfoFromContext(r.Context())
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, DeploymentInfo{
+		Environment:  "staging",
+		Region:       "europe-west1",
+		FunctionName: "WhoAmI",
+	}, info)
+
+	t.Run("falls back to environment outside the router", func(t *testing.T) {
+		t.Setenv(EnvEnvironment, "production")
+		t.Setenv(EnvFunctionName, "CreateAccount")
+
+		info := DeploymentInfoFromContext(context.Background())
+		assert.Equal(t, "production", info.Environment)
+		assert.Equal(t, "europe-west1", info.Region)
+		assert.Equal(t, "CreateAccount", info.FunctionName)
+	})
+}
+
+func TestIntegration_MaintenanceMode(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path POST /api/reports
+// @box:maintainable
+func RunReport(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/users
+func GetUsers(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.RunReport": testHandler("report"),
+			"handlers.GetUsers":  testHandler("users"),
+		},
+		Maintenance:           map[string]bool{"handlers.RunReport": true},
+		MaintenanceRetryAfter: 300,
+	})
+	require.NoError(t, err)
+
+	// Toggled endpoint returns 503 with Retry-After
+	req := httptest.NewRequest("POST", "/api/reports", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+	assert.Contains(t, readResponse(w.Body), "maintenance")
+
+	// Other endpoints are unaffected
+	req = httptest.NewRequest("GET", "/api/users", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Switching maintenance off takes effect on the next request
+	require.NoError(t, router.SetMaintenance("handlers.RunReport", false))
+	assert.False(t, router.InMaintenance("handlers.RunReport"))
+
+	req = httptest.NewRequest("POST", "/api/reports", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "report", readResponse(w.Body))
+
+	// Only maintainable handlers can be toggled
+	err = router.SetMaintenance("handlers.GetUsers", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "@box:maintainable")
+}
+
+func TestIntegration_HealthEndpoint(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/users
+// @box:auth none
+func GetUsers(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var dependencyErr error
+	RegisterReadinessCheck("test-dependency", func(ctx context.Context) error {
+		return dependencyErr
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.GetUsers": testHandler("users"),
+		},
+		HealthPath: "/_healthz",
+	})
+	require.NoError(t, err)
+
+	// All checks pass
+	req := httptest.NewRequest("GET", "/_healthz", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, readResponse(w.Body))
+
+	// A failing check makes the service unready
+	dependencyErr = errors.New("connection refused")
+
+	req = httptest.NewRequest("GET", "/_healthz", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","checks":{"test-dependency":"connection refused"}}`, readResponse(w.Body))
+}
+
+func TestIntegration_HandlerOverridesBuiltinHealth(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /health
+func GetHealth(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.GetHealth": testHandler("custom"),
+		},
+		HealthPath: "/health",
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "custom", readResponse(w.Body))
+}
+
+func TestIntegration_AutoPromote(t *testing.T) {
+	handlerDir := createTestHandlerDir(t, map[string]string{
+		"export.go": `package export
+
+import "net/http"
+
+// @box:function
+// @box:path POST /exports
+// @box:timeout 10m
+func RunExport(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	handlers := map[string]http.HandlerFunc{"export.RunExport": testHandler("ok")}
+
+	// Over the Cloud Functions limit: fails validation by default
+	_, err := New(Config{HandlersDir: handlerDir, Logger: zap.NewNop(), Handlers: handlers})
+	require.ErrorContains(t, err, "validation failed")
+
+	router, err := New(Config{HandlersDir: handlerDir, Logger: zap.NewNop(), Handlers: handlers, AutoPromote: true})
+	require.NoError(t, err)
+	require.Len(t, router.GetHandlers(), 1)
+	assert.Equal(t, annotations.DeploymentContainer, router.GetHandlers()[0].DeploymentType)
+}
+
+func TestIntegration_EventTriggeredHandlersNotRouted(t *testing.T) {
+	handlerDir := createTestHandlerDir(t, map[string]string{
+		"jobs.go": `package jobs
+
+import (
+	"context"
+	"net/http"
+)
+
+// @box:function
+// @box:path GET /jobs
+func ListJobs(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:schedule 0 3 * * *
+func PurgeJobs(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:pubsub topic=jobs
+// @box:cors origins=*
+func OnJobEvent(ctx context.Context, payload []byte) error { return nil }
+`,
+	})
+
+	// Only routed handlers need an implementation
+	router, err := New(Config{
+		HandlersDir: handlerDir,
+		Logger:      zap.NewNop(),
+		Handlers:    map[string]http.HandlerFunc{"jobs.ListJobs": testHandler("jobs")},
+	})
+	require.NoError(t, err)
+	assert.Len(t, router.GetHandlers(), 3)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/jobs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestIntegration_GroupMiddleware(t *testing.T) {
+	handlerDir := createTestHandlerDir(t, map[string]string{
+		"admin.go": `package admin
+
+import "net/http"
+
+// @box:function
+// @box:path GET /admin/users
+// @box:group admin
+func ListUsers(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path DELETE /admin/users/{id}
+// @box:group admin
+// @box:auth required
+func DeleteUser(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /status
+func Status(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	handlers := map[string]http.HandlerFunc{
+		"admin.ListUsers":  testHandler("users"),
+		"admin.DeleteUser": testHandler("deleted"),
+		"admin.Status":     testHandler("ok"),
+	}
+
+	var groupCalls int
+	adminOnly := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groupCalls++
+			if r.Header.Get("X-Admin") != "true" {
+				http.Error(w, "admin only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router, err := New(Config{
+		HandlersDir: handlerDir,
+		Logger:      zap.NewNop(),
+		Handlers:    handlers,
+		Groups:      map[string][]func(http.Handler) http.Handler{"admin": {adminOnly}},
+	})
+	require.NoError(t, err)
+
+	serve := func(method, path string, header http.Header) int {
+		req := httptest.NewRequest(method, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Every group member runs the group middleware
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/admin/users", nil))
+	assert.Equal(t, http.StatusOK, serve("GET", "/admin/users", http.Header{"X-Admin": {"true"}}))
+	assert.Equal(t, http.StatusOK, serve("DELETE", "/admin/users/1", http.Header{
+		"X-Admin":       {"true"},
+		"Authorization": {"Bearer valid-token"},
+	}))
+	assert.Equal(t, 3, groupCalls)
+
+	// Handler auth rejects first, so the group middleware never sees the request
+	assert.Equal(t, http.StatusUnauthorized, serve("DELETE", "/admin/users/1", http.Header{"X-Admin": {"true"}}))
+	assert.Equal(t, 3, groupCalls)
+
+	// Handlers outside the group are unaffected
+	assert.Equal(t, http.StatusOK, serve("GET", "/status", nil))
+	assert.Equal(t, 3, groupCalls)
+
+	// A group without middleware is a configuration error
+	_, err = New(Config{HandlersDir: handlerDir, Logger: zap.NewNop(), Handlers: handlers})
+	require.ErrorContains(t, err, `group "admin", which has no entry in Config.Groups`)
+}
+
+func TestIntegration_CustomMiddleware(t *testing.T) {
+	handlerDir := createTestHandlerDir(t, map[string]string{
+		"accounts.go": `package accounts
+
+import "net/http"
+
+// @box:function
+// @box:path GET /accounts/{id}
+// @box:auth required
+// @box:ratelimit 2/minute
+// @box:cors origins=https://app.example.com
+// @box:middleware testResolveTenant,testRequirePlan
+func GetAccount(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /status
+func Status(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var calls []string
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	RegisterMiddleware("testResolveTenant", record("tenant"))
+	RegisterMiddleware("testRequirePlan", record("plan"))
+
+	handlers := map[string]http.HandlerFunc{
+		"accounts.GetAccount": func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "handler")
+			w.WriteHeader(http.StatusOK)
+		},
+		"accounts.Status": testHandler("ok"),
+	}
+	router, err := New(Config{HandlersDir: handlerDir, Logger: zap.NewNop(), Handlers: handlers})
+	require.NoError(t, err)
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/accounts/1", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// CORS -> auth -> rate limit -> custom middleware in declaration order -> handler
+	w := serve("Bearer valid-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.NotEmpty(t, w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, []string{"tenant", "plan", "handler"}, calls)
+
+	// Auth rejects before custom middleware runs, and the CORS headers are already set
+	calls = nil
+	w = serve("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, calls)
+
+	// So does the rate limiter
+	assert.Equal(t, http.StatusOK, serve("Bearer valid-token").Code)
+	calls = nil
+	assert.Equal(t, http.StatusTooManyRequests, serve("Bearer valid-token").Code)
+	assert.Empty(t, calls)
+
+	// Handlers without @box:middleware are unaffected
+	calls = nil
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, calls)
+}
+
+func TestIntegration_CustomMiddlewareNotRegistered(t *testing.T) {
+	handlerDir := createTestHandlerDir(t, map[string]string{
+		"billing.go": `package billing
+
+import "net/http"
+
+// @box:function
+// @box:path GET /invoices
+// @box:middleware testUnregisteredB,testRegistered
+func ListInvoices(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /refunds
+// @box:middleware testUnregisteredA,testUnregisteredB
+func ListRefunds(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+	RegisterMiddleware("testRegistered", func(next http.Handler) http.Handler { return next })
+
+	_, err := New(Config{
+		HandlersDir: handlerDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"billing.ListInvoices": testHandler("invoices"),
+			"billing.ListRefunds":  testHandler("refunds"),
+		},
+	})
+	require.EqualError(t, err, "middleware not registered: testUnregisteredA, testUnregisteredB (register them with router.RegisterMiddleware)")
+}
+
+func TestIntegration_RateLimitMiddleware(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/test
+// @box:ratelimit 3/minute
+func TestHandler(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.TestHandler": testHandler("OK"),
+		},
+	})
+	require.NoError(t, err)
+
+	// Make requests up to the limit
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/test", nil)
 		w := httptest.NewRecorder()
 
 		router.ServeHTTP(w, req)
@@ -340,6 +1932,600 @@ func TestHandler(w http.ResponseWriter, r *http.Request) {}
 	assert.NotEmpty(t, w.Header().Get("Retry-After"))
 }
 
+func TestIntegration_CircuitBreaker(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"inventory.go": `package inventory
+
+import "net/http"
+
+// @box:container
+// @box:path GET /stock/{sku}
+// @box:circuit-breaker threshold=3 timeout=50ms
+func GetStock(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var (
+		mu      sync.Mutex
+		failing = true
+		calls   int
+		seen    CircuitState // Circuit state observed by the last call
+	)
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"inventory.GetStock": func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				seen = CircuitBreakerStats("inventory.GetStock").State
+				if failing {
+					http.Error(w, "database unavailable", http.StatusInternalServerError)
+					return
+				}
+				w.Write([]byte("42"))
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/stock/abc", nil))
+		return w
+	}
+	setFailing := func(on bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		failing = on
+	}
+
+	// (1) The circuit opens after threshold failures and stops calling the handler
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusInternalServerError, get().Code, "request %d reaches the handler", i+1)
+	}
+	assert.Equal(t, CircuitOpen, CircuitBreakerStats("inventory.GetStock").State)
+
+	w := get()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, 3, calls)
+
+	// (2) After the reset timeout a trial request goes through half-open
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusInternalServerError, get().Code)
+	assert.Equal(t, CircuitHalfOpen, seen)
+	assert.Equal(t, 4, calls)
+
+	// (4) Its failure opens the circuit again, restarting the reset timeout
+	assert.Equal(t, CircuitOpen, CircuitBreakerStats("inventory.GetStock").State)
+	assert.Equal(t, http.StatusServiceUnavailable, get().Code)
+	assert.Equal(t, 4, calls)
+
+	// (3) A successful trial request closes it
+	setFailing(false)
+	time.Sleep(60 * time.Millisecond)
+	w = get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "42", w.Body.String())
+	assert.Equal(t, CircuitHalfOpen, seen)
+
+	stats := CircuitBreakerStats("inventory.GetStock")
+	assert.Equal(t, CircuitClosed, stats.State)
+	assert.Zero(t, stats.Failures)
+	assert.False(t, stats.OpenedAt.IsZero())
+	assert.Equal(t, http.StatusOK, get().Code)
+	assert.Equal(t, 6, calls)
+
+	// Handlers without a circuit breaker are reported closed
+	assert.Equal(t, CircuitStats{State: CircuitClosed}, CircuitBreakerStats("inventory.Unknown"))
+}
+
+func TestIntegration_CircuitBreakerStore(t *testing.T) {
+	store := NewInMemoryCircuitBreakerStore()
+	config := &annotations.CircuitBreakerConfig{FailureThreshold: 2, ResetTimeout: time.Minute, Window: 3}
+
+	// Failures only count while they are among the last Window requests
+	for _, failed := range []bool{true, false, false, true, false, false, true} {
+		allowed, generation, _ := store.Allow("orders.List", config)
+		require.True(t, allowed)
+		store.Record("orders.List", config, generation, failed)
+	}
+	assert.Equal(t, CircuitStats{State: CircuitClosed, Requests: 3, Failures: 1}, store.Stats("orders.List"))
+
+	_, generation, _ := store.Allow("orders.List", config)
+	store.Record("orders.List", config, generation, true)
+	assert.Equal(t, CircuitOpen, store.Stats("orders.List").State)
+
+	allowed, _, retryAfter := store.Allow("orders.List", config)
+	assert.False(t, allowed)
+	assert.InDelta(t, time.Minute.Seconds(), retryAfter.Seconds(), 1)
+
+	// Circuits are kept per key
+	allowed, _, _ = store.Allow("orders.Get", config)
+	assert.True(t, allowed)
+}
+
+func TestIntegration_CircuitBreakerHalfOpenSingleTrial(t *testing.T) {
+	store := NewInMemoryCircuitBreakerStore()
+	config := &annotations.CircuitBreakerConfig{FailureThreshold: 1, ResetTimeout: time.Millisecond}
+	_, generation, _ := store.Allow("reports.Run", config)
+	store.Record("reports.Run", config, generation, true)
+	time.Sleep(5 * time.Millisecond)
+
+	// Only one of many concurrent callers gets the trial request
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _, _ := store.Allow("reports.Run", config); allowed {
+				mu.Lock()
+				admitted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, admitted)
+	assert.Equal(t, CircuitHalfOpen, store.Stats("reports.Run").State)
+}
+
+func TestIntegration_CircuitBreakerStaleOutcome(t *testing.T) {
+	store := NewInMemoryCircuitBreakerStore()
+	config := &annotations.CircuitBreakerConfig{FailureThreshold: 1, ResetTimeout: time.Millisecond}
+
+	// A slow request is let through while the circuit is closed...
+	_, slow, _ := store.Allow("reports.Run", config)
+
+	// ...and is still running when another request trips the circuit and the reset
+	// timeout lets a trial request through
+	_, generation, _ := store.Allow("reports.Run", config)
+	store.Record("reports.Run", config, generation, true)
+	time.Sleep(5 * time.Millisecond)
+	allowed, trial, _ := store.Allow("reports.Run", config)
+	require.True(t, allowed)
+
+	// The slow request finishing neither closes the circuit nor frees the trial slot
+	store.Record("reports.Run", config, slow, false)
+	assert.Equal(t, CircuitHalfOpen, store.Stats("reports.Run").State)
+	allowed, _, _ = store.Allow("reports.Run", config)
+	assert.False(t, allowed, "the trial request is still in flight")
+
+	// Nor does a slow failure reopen it
+	store.Record("reports.Run", config, slow, true)
+	assert.Equal(t, CircuitHalfOpen, store.Stats("reports.Run").State)
+
+	// The trial request decides
+	store.Record("reports.Run", config, trial, false)
+	assert.Equal(t, CircuitClosed, store.Stats("reports.Run").State)
+
+	// Outcomes from before the circuit closed don't count toward the new window
+	store.Record("reports.Run", config, slow, true)
+	store.Record("reports.Run", config, trial, true)
+	stats := store.Stats("reports.Run")
+	assert.Equal(t, CircuitClosed, stats.State)
+	assert.Zero(t, stats.Requests)
+}
+
+func TestIntegration_Retry(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"orders.go": `package orders
+
+import "net/http"
+
+// @box:function
+// @box:path GET /orders/{id}
+// @box:retry attempts=3 delay=1ms
+func GetOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /orders
+// @box:retry attempts=3 delay=1ms
+func CreateOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /orders/{id}/cancel
+// @box:retry attempts=3 delay=1ms
+// @box:idempotent
+func CancelOrder(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var (
+		calls    int
+		statuses []int // Status of each call, the last one repeated once they run out
+		panics   bool  // Calls panic instead of writing a failed status
+		retries  []int // RetryCountFromContext of each call
+		bodies   []string
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[min(calls, len(statuses)-1)]
+		calls++
+		retries = append(retries, RetryCountFromContext(r.Context()))
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if panics && status >= 500 {
+			panic("connection reset")
+		}
+		w.Header().Set("X-Attempt", strconv.Itoa(calls))
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "attempt %d", calls)
+	}
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"orders.GetOrder":    handler,
+			"orders.CreateOrder": handler,
+			"orders.CancelOrder": handler,
+		},
+	})
+	require.NoError(t, err)
+
+	serve := func(method, path, body string, results ...int) *httptest.ResponseRecorder {
+		calls, statuses, panics, retries, bodies = 0, results, false, nil, nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("success on first attempt", func(t *testing.T) {
+		w := serve("GET", "/orders/1", "", http.StatusOK)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "attempt 1", w.Body.String())
+		assert.Equal(t, []int{0}, retries)
+	})
+
+	t.Run("retry then success", func(t *testing.T) {
+		w := serve("GET", "/orders/1", "", http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "attempt 3", w.Body.String(), "failed attempts don't reach the client")
+		assert.Equal(t, "3", w.Header().Get("X-Attempt"))
+		assert.Equal(t, []int{0, 1, 2}, retries)
+	})
+
+	t.Run("all attempts exhausted", func(t *testing.T) {
+		w := serve("GET", "/orders/1", "", http.StatusInternalServerError)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "attempt 3", w.Body.String())
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("panics are retried", func(t *testing.T) {
+		calls, statuses, panics, retries, bodies = 0, []int{http.StatusInternalServerError, http.StatusOK}, true, nil, nil
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/orders/1", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, calls)
+	})
+
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(fmt.Sprintf("%d is not retried", status), func(t *testing.T) {
+			w := serve("GET", "/orders/1", "", status)
+			assert.Equal(t, status, w.Code)
+			assert.Equal(t, 1, calls)
+		})
+	}
+
+	t.Run("non-idempotent method is not retried", func(t *testing.T) {
+		w := serve("POST", "/orders", `{"sku":"abc"}`, http.StatusInternalServerError)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("idempotent handler is retried with its body", func(t *testing.T) {
+		w := serve("POST", "/orders/1/cancel", `{"reason":"duplicate"}`, http.StatusInternalServerError, http.StatusOK)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{`{"reason":"duplicate"}`, `{"reason":"duplicate"}`}, bodies)
+	})
+}
+
+func TestIntegration_RetryStopsWhenRequestEnds(t *testing.T) {
+	config := &annotations.RetryConfig{Attempts: 5, BackoffType: annotations.RetryBackoffLinear, InitialDelay: time.Hour, MaxDelay: time.Hour}
+	calls := 0
+	handler := RetryMiddleware(config, false, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		WriteError(w, r, http.StatusServiceUnavailable, "Upstream unavailable")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	// The pending retry is dropped and the last response sent
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestIntegration_ErrorFormat(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/private
+// @box:auth required
+func Private(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/limited
+// @box:ratelimit 1/minute
+func Limited(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/custom
+func Custom(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	handlers := map[string]http.HandlerFunc{
+		"handlers.Private": testHandler("OK"),
+		"handlers.Limited": testHandler("OK"),
+		"handlers.Custom": func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, http.StatusBadRequest, "Missing name")
+		},
+	}
+
+	tests := []struct {
+		name        string
+		format      ErrorFormat
+		wantAuth    string
+		wantLimited string
+		wantHandler string
+	}{
+		{
+			name:        "box by default",
+			format:      "",
+			wantAuth:    `{"error":"Authorization required"}`,
+			wantLimited: `{"error":"Rate limit exceeded"}`,
+			wantHandler: `{"error":"Missing name"}`,
+		},
+		{
+			name:        "gateway",
+			format:      ErrorFormatGateway,
+			wantAuth:    `{"code":401,"message":"Authorization required"}`,
+			wantLimited: `{"code":429,"message":"Rate limit exceeded"}`,
+			wantHandler: `{"code":400,"message":"Missing name"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := New(Config{
+				HandlersDir: tmpDir,
+				Logger:      zap.NewNop(),
+				Handlers:    handlers,
+				ErrorFormat: tt.format,
+			})
+			require.NoError(t, err)
+
+			serve := func(path string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+				return w
+			}
+
+			w := serve("/api/private")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantAuth, readResponse(w.Body))
+
+			serve("/api/limited")
+			w = serve("/api/limited")
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.JSONEq(t, tt.wantLimited, readResponse(w.Body))
+
+			w = serve("/api/custom")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, tt.wantHandler, readResponse(w.Body))
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := New(Config{
+			HandlersDir: tmpDir,
+			Logger:      zap.NewNop(),
+			Handlers:    handlers,
+			ErrorFormat: "problem+json",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown error format")
+	})
+}
+
+func TestIntegration_RedisRateLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("s3cret")
+
+	_, err := NewRedisRateLimiter("redis://"+server.Addr(), 3, time.Minute)
+	require.ErrorContains(t, err, "NOAUTH", "the server requires a password")
+
+	limiter, err := NewRedisRateLimiter("redis://:s3cret@"+server.Addr()+"/2", 3, time.Minute)
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	for i := 0; i < 3; i++ {
+		allowed, remaining, reset, err := limiter.Allow("10.0.0.1")
+		require.NoError(t, err)
+		assert.True(t, allowed, "request %d should be allowed", i+1)
+		assert.Equal(t, 2-i, remaining)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), reset, 2*time.Second)
+	}
+
+	allowed, remaining, _, err := limiter.Allow("10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, remaining)
+
+	// Other keys have their own window
+	allowed, _, _, err = limiter.Allow("10.0.0.2")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// The script keeps one sorted set per key in the selected database, expiring with the window
+	db := server.DB(2)
+	assert.Equal(t, []string{"box:ratelimit:10.0.0.1", "box:ratelimit:10.0.0.2"}, db.Keys())
+	members, err := db.ZMembers("box:ratelimit:10.0.0.1")
+	require.NoError(t, err)
+	assert.Len(t, members, 3, "rejected requests are not recorded")
+	assert.Equal(t, time.Minute, db.TTL("box:ratelimit:10.0.0.1"))
+	assert.Empty(t, server.Keys(), "nothing is written to database 0")
+
+	// A server that lost its scripts (restart, SCRIPT FLUSH) gets the script again
+	require.NoError(t, limiter.client.ScriptFlush(context.Background()).Err())
+
+	allowed, _, _, err = limiter.Allow("10.0.0.3")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestIntegration_RedisRateLimiterSlidingWindow(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	limiter, err := NewRedisRateLimiter("redis://"+server.Addr(), 2, 200*time.Millisecond)
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, _, err := limiter.Allow("10.0.0.1")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, remaining, reset, err := limiter.Allow("10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, remaining)
+
+	// The window slides once the oldest request ages out
+	time.Sleep(time.Until(reset) + 10*time.Millisecond)
+	allowed, _, _, err = limiter.Allow("10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestIntegration_RedisRateLimiterURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://localhost:6379", "unsupported redis URL scheme"},
+		{"redis://", "has no host"},
+		{"redis://localhost/cache", "invalid database number"},
+		{"redis://127.0.0.1:1", "failed to connect to redis"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRedisRateLimiter(tt.url, 10, time.Minute)
+		assert.ErrorContains(t, err, tt.want, tt.url)
+	}
+
+	_, err := NewRedisRateLimiter("redis://localhost", 0, time.Minute)
+	assert.ErrorContains(t, err, "must be positive")
+}
+
+func TestIntegration_RateLimiterFactory(t *testing.T) {
+	server := miniredis.RunT(t)
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"handlers.go": `package handlers
+
+import "net/http"
+
+// @box:function
+// @box:path GET /api/a
+// @box:ratelimit 2/minute
+func HandlerA(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /api/b
+// @box:ratelimit 2/minute
+func HandlerB(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var limiters []*RedisRateLimiter
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"handlers.HandlerA": testHandler("A"),
+			"handlers.HandlerB": testHandler("B"),
+		},
+		RateLimiterFactory: func(config *annotations.RateLimitConfig) RateLimiter {
+			limiter, err := NewRedisRateLimiter("redis://"+server.Addr(), config.Count, config.Period)
+			require.NoError(t, err)
+			limiters = append(limiters, limiter)
+			return limiter
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, limiters, 2)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/api/a").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api/a").Code)
+
+	// Handlers keep separate budgets in the shared Redis
+	assert.Equal(t, http.StatusOK, serve("/api/b").Code)
+	assert.Equal(t, []string{
+		"box:ratelimit:handlers.HandlerA:192.0.2.1:1234",
+		"box:ratelimit:handlers.HandlerB:192.0.2.1:1234",
+	}, server.Keys())
+
+	// An unreachable Redis fails open without rate limit headers
+	server.Close()
+	for _, limiter := range limiters {
+		limiter.Close()
+	}
+	w := serve("/api/a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+}
+
+// TestIntegration_RedisRateLimiterServer runs the sliding-window script against a real
+// Redis when BOX_TEST_REDIS_URL is set (e.g. redis://localhost:6379/15)
+func TestIntegration_RedisRateLimiterServer(t *testing.T) {
+	redisURL := os.Getenv("BOX_TEST_REDIS_URL")
+	if redisURL == "" {
+		t.Skip("set BOX_TEST_REDIS_URL to run against a Redis server")
+	}
+
+	limiter, err := NewRedisRateLimiter(redisURL, 2, 200*time.Millisecond)
+	require.NoError(t, err)
+	defer limiter.Close()
+
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	for i := 0; i < 2; i++ {
+		allowed, _, _, err := limiter.Allow(key)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, remaining, reset, err := limiter.Allow(key)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, remaining)
+
+	// The window slides once the oldest request ages out
+	time.Sleep(time.Until(reset) + 10*time.Millisecond)
+	allowed, _, _, err = limiter.Allow(key)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
 func TestIntegration_TimeoutMiddleware(t *testing.T) {
 	tmpDir := createTestHandlerDir(t, map[string]string{
 		"handlers.go": `package handlers
@@ -377,6 +2563,703 @@ func TestHandler(w http.ResponseWriter, r *http.Request) {}
 	assert.Contains(t, []int{http.StatusOK, http.StatusGatewayTimeout}, w.Code)
 }
 
+func TestIntegration_ClientDisconnectCancelsContext(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"reports.go": `package reports
+
+import "net/http"
+
+// @box:function
+// @box:path GET /reports
+func SlowReport(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			// Stands in for a slow query run with r.Context()
+			"reports.SlowReport": func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-r.Context().Done():
+					cancelled <- r.Context().Err()
+				case <-time.After(5 * time.Second):
+					cancelled <- nil
+				}
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/reports", nil)
+	require.NoError(t, err)
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = http.DefaultClient.Do(req)
+	require.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case err := <-cancelled:
+		assert.ErrorIs(t, err, context.Canceled, "handler context should be cancelled when the client goes away")
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after the client disconnected")
+	}
+}
+
+// closeNotifyRecorder is a ResponseWriter that reports disconnects only through CloseNotify
+type closeNotifyRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (r closeNotifyRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+func TestIntegration_DisconnectMiddlewareCloseNotifier(t *testing.T) {
+	cancelled := make(chan error, 1)
+	handler := DisconnectMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		cancelled <- r.Context().Err()
+	}))
+
+	w := closeNotifyRecorder{ResponseRecorder: httptest.NewRecorder(), closed: make(chan bool, 1)}
+	w.closed <- true
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/reports", nil))
+
+	assert.ErrorIs(t, <-cancelled, context.Canceled)
+}
+
+// takeSpans flushes the router's batched spans and removes them from exporter
+func takeSpans(t *testing.T, router *Router, exporter *tracetest.InMemoryExporter) tracetest.SpanStubs {
+	t.Helper()
+	require.NoError(t, router.tracerProvider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	exporter.Reset()
+	return spans
+}
+
+func TestIntegration_Tracing(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"users.go": `package users
+
+import "net/http"
+
+// @box:function
+// @box:path GET /users/{id}
+func GetUser(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /users
+func CreateUser(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /ping
+// @box:tracing false
+func Ping(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+	t.Setenv("OTEL_SERVICE_NAME", "users-service")
+
+	var handlerTraceID string
+	exporter := tracetest.NewInMemoryExporter()
+	router, err := New(Config{
+		HandlersDir:    tmpDir,
+		Logger:         zap.NewNop(),
+		TracingEnabled: true,
+		SpanExporter:   exporter,
+		Handlers: map[string]http.HandlerFunc{
+			"users.GetUser": func(w http.ResponseWriter, r *http.Request) {
+				handlerTraceID = TraceIDFromContext(r.Context())
+				w.Write([]byte("user"))
+			},
+			"users.CreateUser": func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			},
+			"users.Ping": func(w http.ResponseWriter, r *http.Request) {
+				handlerTraceID = TraceIDFromContext(r.Context())
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// An incoming traceparent continues the caller's trace
+	req := httptest.NewRequest("GET", "http://api.example.com/users/42?fields=name", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=opaque")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := takeSpans(t, router, exporter)
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	assert.NotEqual(t, span.Parent.SpanID(), span.SpanContext.SpanID())
+	assert.Equal(t, "vendor=opaque", span.SpanContext.TraceState().String())
+	assert.Equal(t, "GET /users/{id}", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("http.method", "GET"),
+		attribute.String("http.route", "/users/{id}"),
+		attribute.Int("http.status_code", http.StatusOK),
+		attribute.String("http.url", "http://api.example.com/users/42?fields=name"),
+	}, span.Attributes)
+	assert.Equal(t, codes.Unset, span.Status.Code)
+	assert.False(t, span.EndTime.Before(span.StartTime))
+	assert.Contains(t, span.Resource.Attributes(), attribute.String("service.name", "users-service"))
+	assert.Equal(t, span.SpanContext.TraceID().String(), handlerTraceID, "handlers see the trace ID")
+
+	// Without one (or with a malformed one) the request starts a new trace
+	req = httptest.NewRequest("GET", "/users/7", nil)
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans = takeSpans(t, router, exporter)
+	require.Len(t, spans, 1)
+	assert.True(t, spans[0].SpanContext.TraceID().IsValid())
+	assert.False(t, spans[0].Parent.IsValid())
+
+	// Server errors mark the span failed
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+	spans = takeSpans(t, router, exporter)
+	require.Len(t, spans, 1)
+	assert.Contains(t, spans[0].Attributes, attribute.Int("http.status_code", http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+
+	// @box:tracing false opts a handler out
+	handlerTraceID = "unset"
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ping", nil))
+	assert.Empty(t, takeSpans(t, router, exporter))
+	assert.Empty(t, handlerTraceID)
+
+	// Shutdown shuts the exporter down with the router
+	require.NoError(t, router.Shutdown(context.Background()))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/7", nil))
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func TestIntegration_TracingDisabledByDefault(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"users.go": `package users
+
+import "net/http"
+
+// @box:function
+// @box:path GET /users
+func ListUsers(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	var traceID string
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"users.ListUsers": func(w http.ResponseWriter, r *http.Request) {
+				traceID = TraceIDFromContext(r.Context())
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	assert.Empty(t, traceID)
+	assert.NoError(t, router.Shutdown(context.Background()))
+}
+
+func TestIntegration_TracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	var outgoing http.Header
+	handler := TracingMiddleware(exporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing = http.Header{}
+		SetTraceHeaders(r.Context(), outgoing)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=opaque")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Spans are exported as requests finish
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET", spans[0].Name, "outside the router there is no route pattern")
+
+	// Same trace, this request's span as the parent, tracestate carried over
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext.SpanID().String()+"-01", outgoing.Get("traceparent"))
+	assert.Equal(t, "vendor=opaque", outgoing.Get("tracestate"))
+
+	// An unsampled caller's flags are carried over, and its requests aren't recorded
+	exporter.Reset()
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-00$", outgoing.Get("traceparent"))
+	assert.NotContains(t, outgoing.Get("traceparent"), "00f067aa0ba902b7")
+	assert.Empty(t, exporter.GetSpans())
+
+	// Untraced contexts add nothing
+	header := http.Header{}
+	SetTraceHeaders(context.Background(), header)
+	assert.Empty(t, header)
+}
+
+func TestIntegration_TracingOTLPExport(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"users.go": `package users
+
+import "net/http"
+
+// @box:function
+// @box:path GET /users/{id}
+func GetUser(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+	t.Setenv("OTEL_SERVICE_NAME", "users-service")
+
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		var export coltracepb.ExportTraceServiceRequest
+		assert.NoError(t, proto.Unmarshal(body, &export))
+		requests <- &export
+	}))
+	defer collector.Close()
+
+	router, err := New(Config{
+		HandlersDir:    tmpDir,
+		Logger:         zap.NewNop(),
+		TracingEnabled: true,
+		OTLPEndpoint:   collector.URL,
+		Handlers:       map[string]http.HandlerFunc{"users.GetUser": testHandler("user")},
+	})
+	require.NoError(t, err)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+
+	// Shutdown flushes the batched span
+	require.NoError(t, router.Shutdown(context.Background()))
+
+	var export *coltracepb.ExportTraceServiceRequest
+	select {
+	case export = <-requests:
+	default:
+		t.Fatal("collector received no spans")
+	}
+
+	require.Len(t, export.ResourceSpans, 1)
+	resourceSpans := export.ResourceSpans[0]
+	resource := make(map[string]string)
+	for _, kv := range resourceSpans.Resource.Attributes {
+		resource[kv.Key] = kv.Value.GetStringValue()
+	}
+	assert.Equal(t, "users-service", resource["service.name"])
+	require.Len(t, resourceSpans.ScopeSpans, 1)
+	assert.Equal(t, "github.com/gravelight-studio/box/go/router", resourceSpans.ScopeSpans[0].Scope.Name)
+	require.Len(t, resourceSpans.ScopeSpans[0].Spans, 1)
+	assert.Equal(t, "GET /users/{id}", resourceSpans.ScopeSpans[0].Spans[0].Name)
+}
+
+func TestIntegration_IPFilter(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"admin.go": `package admin
+
+import "net/http"
+
+// @box:function
+// @box:path GET /admin/stats
+// @box:allow-ip 10.0.0.0/8,198.51.100.7
+func Stats(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path GET /catalog
+// @box:deny-ip 203.0.113.0/24
+func Catalog(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"admin.Stats":   testHandler("stats"),
+			"admin.Catalog": testHandler("catalog"),
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		path         string
+		remoteAddr   string
+		forwardedFor string
+		expectedCode int
+	}{
+		{"allowed private address", "/admin/stats", "10.1.2.3:4000", "", http.StatusOK},
+		{"allowed single address", "/admin/stats", "198.51.100.7:4000", "", http.StatusOK},
+		{"address outside allow list", "/admin/stats", "198.51.100.8:4000", "", http.StatusForbidden},
+		{"forwarded client outside allow list", "/admin/stats", "10.1.2.3:4000", "198.51.100.8, 10.0.0.5", http.StatusForbidden},
+		{"forwarded client in allow list", "/admin/stats", "169.254.1.1:4000", "192.168.0.9, 198.51.100.7", http.StatusOK},
+		{"forwarded header ignored from public address", "/admin/stats", "198.51.100.8:4000", "198.51.100.7", http.StatusForbidden},
+		{"address outside deny list", "/catalog", "198.51.100.8:4000", "", http.StatusOK},
+		{"denied address", "/catalog", "203.0.113.9:4000", "", http.StatusForbidden},
+		{"denied forwarded client", "/catalog", "10.0.0.1:4000", "203.0.113.9", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), "Forbidden")
+			}
+		})
+	}
+}
+
+func TestIntegration_Cache(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"catalog.go": `package catalog
+
+import "net/http"
+
+// @box:function
+// @box:path GET /products/{id}
+// @box:cache 5m vary=Accept-Language
+func GetProduct(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /products
+// @box:cache 5m
+func CreateProduct(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	calls := make(map[string]int)
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"catalog.GetProduct": func(w http.ResponseWriter, r *http.Request) {
+				calls["GetProduct"]++
+				id := strings.TrimPrefix(r.URL.Path, "/products/")
+				if id == "missing" {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "text/plain")
+				fmt.Fprintf(w, "product %s (%s) #%d", id, r.Header.Get("Accept-Language"), calls["GetProduct"])
+			},
+			"catalog.CreateProduct": func(w http.ResponseWriter, r *http.Request) {
+				calls["CreateProduct"]++
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	get := func(path, language string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Language", language)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/products/1", "en")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "max-age=300", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "product 1 (en) #1", w.Body.String())
+
+	// The repeated request is served from the cache, headers included
+	w = get("/products/1", "en")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "max-age=300", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, "product 1 (en) #1", w.Body.String())
+	assert.Equal(t, 1, calls["GetProduct"])
+
+	// Vary headers and the path select separate entries
+	assert.Equal(t, "product 1 (de) #2", get("/products/1", "de").Body.String())
+	assert.Equal(t, "product 2 (en) #3", get("/products/2", "en").Body.String())
+
+	// Error responses are never cached
+	for i := 0; i < 2; i++ {
+		w = get("/products/missing", "en")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Empty(t, w.Header().Get("Cache-Control"))
+	}
+	assert.Equal(t, 5, calls["GetProduct"])
+
+	// Nor are non-GET requests
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/products", nil))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("X-Cache"))
+	}
+	assert.Equal(t, 2, calls["CreateProduct"])
+}
+
+func TestIntegration_CacheWithCORS(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"catalog.go": `package catalog
+
+import "net/http"
+
+// @box:function
+// @box:path GET /products
+// @box:cors origins=https://app.example.com
+// @box:cache 5m
+func ListProducts(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	calls := 0
+	router, err := New(Config{
+		HandlersDir: tmpDir,
+		Logger:      zap.NewNop(),
+		Handlers: map[string]http.HandlerFunc{
+			"catalog.ListProducts": func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`[]`))
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	get := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/products", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("https://app.example.com")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// A hit for a disallowed origin must not replay the CORS headers of the stored response
+	w = get("https://evil.example.com")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 1, calls)
+
+	// The allowed origin still gets its own CORS headers on a hit
+	w = get("https://app.example.com")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+}
+
+func TestIntegration_CacheStore(t *testing.T) {
+	store := NewInMemoryCacheStore()
+	store.Set("fresh", []byte("value"), time.Minute)
+	store.Set("stale", []byte("value"), -time.Second)
+
+	value, ok := store.Get("fresh")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), value)
+
+	_, ok = store.Get("stale")
+	assert.False(t, ok)
+	_, ok = store.Get("unknown")
+	assert.False(t, ok)
+}
+
+func TestIntegration_Metrics(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"orders.go": `package orders
+
+import "net/http"
+
+// @box:function
+// @box:path GET /orders/{id}
+func GetOrder(w http.ResponseWriter, r *http.Request) {}
+
+// @box:function
+// @box:path POST /orders
+// @box:metrics-name create_order
+func CreateOrder(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	router, err := New(Config{
+		HandlersDir:    tmpDir,
+		Logger:         zap.NewNop(),
+		MetricsEnabled: true,
+		Handlers: map[string]http.HandlerFunc{
+			"orders.GetOrder": func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("order"))
+			},
+			"orders.CreateOrder": func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orders/"+id, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", nil))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE http_requests_total counter\n")
+	assert.Contains(t, body, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, body, "# TYPE http_requests_in_flight gauge\nhttp_requests_in_flight 0\n")
+
+	// Requests are labeled by route pattern, not URL, and @box:metrics-name overrides it
+	assert.Contains(t, body, `http_requests_total{method="GET",path="/orders/{id}",status="200"} 3`+"\n")
+	assert.Contains(t, body, `http_requests_total{method="POST",path="create_order",status="201"} 1`+"\n")
+	assert.NotContains(t, body, `path="/orders/1"`)
+	assert.Contains(t, body, `http_request_duration_seconds_bucket{method="GET",path="/orders/{id}",le="+Inf"} 3`+"\n")
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",path="/orders/{id}"} 3`+"\n")
+
+	// The metrics endpoint itself isn't instrumented
+	assert.NotContains(t, body, `path="/metrics"`)
+}
+
+func TestIntegration_MetricsCustomPath(t *testing.T) {
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"ping.go": `package ping
+
+import "net/http"
+
+// @box:function
+// @box:path GET /ping
+func Ping(w http.ResponseWriter, r *http.Request) {}
+`,
+	})
+
+	jobs := MustRegisterCustomCounter("box_test_jobs_processed_total", "Jobs processed by the test.", []string{"queue"})
+	jobs.WithLabelValues("emails").Inc()
+	jobs.WithLabelValues("emails").Add(2)
+	jobs.WithLabelValues(`say "hi"`).Inc()
+
+	router, err := New(Config{
+		HandlersDir:    tmpDir,
+		Logger:         zap.NewNop(),
+		MetricsEnabled: true,
+		MetricsPath:    "/internal/metrics",
+		Handlers: map[string]http.HandlerFunc{
+			"ping.Ping": func(w http.ResponseWriter, r *http.Request) {},
+		},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/internal/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "# HELP box_test_jobs_processed_total Jobs processed by the test.\n"+
+		"# TYPE box_test_jobs_processed_total counter\n"+
+		`box_test_jobs_processed_total{queue="emails"} 3`+"\n"+
+		`box_test_jobs_processed_total{queue="say \"hi\""} 1`+"\n")
+
+	// Any collector can be registered with the router's registry, and Go runtime metrics come built in
+	promauto.With(MetricsRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name: "box_test_job_seconds",
+		Help: "Job latency in the test.",
+	}).Observe(0.2)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/internal/metrics", nil))
+	assert.Contains(t, w.Body.String(), "box_test_job_seconds_count 1\n")
+	assert.Contains(t, w.Body.String(), "# TYPE go_goroutines gauge\n")
+
+	assert.Panics(t, func() { MustRegisterCustomCounter("box_test_jobs_processed_total", "Duplicate.", nil) })
+	assert.Panics(t, func() { MustRegisterCustomCounter("box-test-invalid", "Invalid name.", nil) })
+	assert.Panics(t, func() { jobs.WithLabelValues("emails", "extra") })
+}
+
+func TestIntegration_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Host", r.Host)
+		w.Header().Set("X-Forwarded-Host-Seen", r.Header.Get("X-Forwarded-Host"))
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "sandbox %s", r.URL.RequestURI())
+	}))
+	defer sandbox.Close()
+
+	tmpDir := createTestHandlerDir(t, map[string]string{
+		"payments.go": fmt.Sprintf(`package payments
+
+import "net/http"
+
+// @box:proxy %s/v2 staging=%s
+// @box:path GET /payments/{id}
+// @box:cors origins=https://app.example.com
+func PaymentsProxy(w http.ResponseWriter, r *http.Request) {}
+`, upstream.URL, sandbox.URL),
+	})
+
+	// No implementation is needed for a proxy route
+	router, err := New(Config{HandlersDir: tmpDir, Logger: zap.NewNop(), Environment: "production"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "http://api.example.com/payments/42?expand=refunds", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Path and query are appended to the upstream URL, and annotation middleware still applies
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "GET /v2/payments/42?expand=refunds", w.Body.String())
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), w.Header().Get("X-Upstream-Host"))
+	assert.Equal(t, "api.example.com", w.Header().Get("X-Forwarded-Host-Seen"))
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Environments can point at a different upstream
+	staging, err := New(Config{HandlersDir: tmpDir, Logger: zap.NewNop(), Environment: "staging"})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	staging.ServeHTTP(w, httptest.NewRequest("GET", "/payments/42", nil))
+	assert.Equal(t, "sandbox /payments/42", w.Body.String())
+
+	// An unreachable upstream is a 502
+	upstream.Close()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/payments/42", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.JSONEq(t, `{"error":"Upstream unavailable"}`, w.Body.String())
+}
+
 func TestIntegration_PathParameters(t *testing.T) {
 	tmpDir := createTestHandlerDir(t, map[string]string{
 		"handlers.go": `package handlers
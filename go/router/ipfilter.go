@@ -0,0 +1,62 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilterMiddleware rejects requests by client address with 403 Forbidden. Addresses in
+// deny are always rejected; when allow is non-empty, only addresses in it get through,
+// and otherwise everything not denied does
+func IPFilterMiddleware(allow, deny []net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if ip == nil || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				WriteError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address of the client that sent r. A request arriving from a
+// private address came through a proxy (a load balancer, API Gateway or Cloud Run's
+// front end), so the leftmost public address in X-Forwarded-For is used instead. Proxies
+// append to the header rather than replace it, so put one in front that strips
+// client-supplied X-Forwarded-For when access control must not be spoofable
+func ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+
+	if remote == nil || isInternalIP(remote) {
+		for _, field := range strings.Split(r.Header.Get("X-Forwarded-For"), ",") {
+			if ip := net.ParseIP(strings.TrimSpace(field)); ip != nil && !isInternalIP(ip) {
+				return ip
+			}
+		}
+	}
+
+	return remote
+}
+
+// isInternalIP reports whether ip is a private, loopback or link-local address
+func isInternalIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// containsIP reports whether any of networks contains ip
+func containsIP(networks []net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,397 @@
+package router
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// JWKSRefreshInterval is how long fetched signing keys are trusted before refetching
+	JWKSRefreshInterval = 5 * time.Minute
+
+	// jwksMinRefetch throttles refetches triggered by tokens with an unknown key ID
+	jwksMinRefetch = 30 * time.Second
+
+	// jwtLeeway tolerates clock skew between the issuer and this instance
+	jwtLeeway = time.Minute
+)
+
+// ErrJWKSUnavailable is returned when no signing keys have ever been fetched
+var ErrJWKSUnavailable = errors.New("JWKS unavailable")
+
+// JWTValidator validates RS256 and ES256 JWTs against the keys published at a JWKS
+// endpoint, checking exp, iat, iss and aud. It implements TokenValidator, returning Claims
+type JWTValidator struct {
+	jwksURL  string
+	issuer   string
+	audience string
+	client   *http.Client
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey // by key ID
+	fetchedAt time.Time
+	lastTry   time.Time
+	fetching  chan struct{} // Closed when the running fetch ends; nil when none is running
+	fetchErr  error         // Result of the last fetch
+	now       func() time.Time
+}
+
+// NewJWTValidator creates a validator for tokens signed by the keys at jwksURL
+// Empty issuer or audience skip that check; keys are fetched on first use
+func NewJWTValidator(jwksURL, issuer, audience string, logger *zap.Logger) *JWTValidator {
+	return &JWTValidator{
+		jwksURL:  jwksURL,
+		issuer:   issuer,
+		audience: audience,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Refresh fetches the signing keys, replacing the cached set on success. A fetch already
+// running is waited for rather than repeated
+func (v *JWTValidator) Refresh(ctx context.Context) error {
+	v.mu.Lock()
+	if done := v.fetching; done != nil {
+		v.mu.Unlock()
+		return v.wait(ctx, done)
+	}
+	done := v.beginFetchLocked()
+	v.mu.Unlock()
+	return v.fetch(ctx, done)
+}
+
+// beginFetchLocked marks a fetch as running and returns the channel closed when it ends
+func (v *JWTValidator) beginFetchLocked() chan struct{} {
+	v.lastTry = v.now()
+	v.fetching = make(chan struct{})
+	return v.fetching
+}
+
+// fetch downloads the signing keys without holding v.mu, so validations with cached keys
+// go on meanwhile, then stores them on success and releases the callers waiting on done
+func (v *JWTValidator) fetch(ctx context.Context, done chan struct{}) error {
+	keys, err := v.download(ctx)
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys = keys
+		v.fetchedAt = v.lastTry
+	}
+	v.fetchErr = err
+	v.fetching = nil
+	v.mu.Unlock()
+
+	close(done)
+	return err
+}
+
+// wait blocks until the fetch behind done ends and returns its result
+func (v *JWTValidator) wait(ctx context.Context, done chan struct{}) error {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.fetchErr
+}
+
+// download fetches and parses the key set at the JWKS endpoint
+func (v *JWTValidator) download(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", v.jwksURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: status %d", v.jwksURL, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			// One unusable key (e.g., an unsupported type) shouldn't block the rest
+			v.logger.Debug("Skipping JWKS key", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS at %s has no usable RS256 or ES256 keys", v.jwksURL)
+	}
+	return keys, nil
+}
+
+// key returns the verification key for kid, refetching when the cache is stale or the
+// key is unknown. A failed refetch keeps serving the previously fetched keys. While another
+// request is refetching, a cached key is used right away; an unknown one waits for the fetch
+func (v *JWTValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	_, known := v.keys[kid]
+	stale := now.Sub(v.fetchedAt) >= JWKSRefreshInterval
+	switch {
+	case v.fetching != nil && !known:
+		done := v.fetching
+		v.mu.Unlock()
+		// The fetching request logs a failure, which shows below as a missing key
+		v.wait(ctx, done)
+		v.mu.Lock()
+	case v.fetching == nil && (stale || !known) && now.Sub(v.lastTry) >= jwksMinRefetch:
+		done := v.beginFetchLocked()
+		v.mu.Unlock()
+		if err := v.fetch(ctx, done); err != nil {
+			v.logger.Warn("JWKS refresh failed", zap.String("url", v.jwksURL), zap.Error(err))
+		}
+		v.mu.Lock()
+	}
+	defer v.mu.Unlock()
+
+	if v.keys == nil {
+		return nil, ErrJWKSUnavailable
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// ValidateToken verifies the token's signature and claims and returns its Claims
+func (v *JWTValidator) ValidateToken(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkClaims verifies the time-based and issuer/audience claims
+func (v *JWTValidator) checkClaims(claims Claims) error {
+	now := v.now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("token has no exp claim")
+	}
+	if now.After(exp.Add(jwtLeeway)) {
+		return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && iat.After(now.Add(jwtLeeway)) {
+		return fmt.Errorf("token issued in the future (%s)", iat.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && nbf.After(now.Add(jwtLeeway)) {
+		return fmt.Errorf("token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("token issuer %q does not match %q", iss, v.issuer)
+		}
+	}
+
+	if v.audience != "" {
+		var audiences []string
+		switch aud := claims["aud"].(type) {
+		case string:
+			audiences = []string{aud}
+		case []any:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+		found := false
+		for _, a := range audiences {
+			found = found || a == v.audience
+		}
+		if !found {
+			return fmt.Errorf("token audience does not include %q", v.audience)
+		}
+	}
+
+	return nil
+}
+
+// ClaimsFromContext returns the claims of the request's Identity
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	if claims, ok := identity.(Claims); ok {
+		return claims, true
+	}
+	return Claims(identity.Claims()), true
+}
+
+// jwk is a JSON Web Key; only RSA and P-256 EC signing keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("key use %q is not sig", k.Use)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature checks a JWS signature over digest, requiring the key type to match alg
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token signed with a non-RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ES256 token signed with a non-EC key")
+		}
+		// JWS encodes ECDSA signatures as fixed-width r || s
+		if len(signature) != 64 {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter %q", s)
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// numericDate reads a JWT NumericDate (seconds since the epoch)
+func numericDate(v any) (time.Time, bool) {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+// DefaultMaintenanceRetryAfter is the Retry-After sent while an endpoint is in maintenance
+const DefaultMaintenanceRetryAfter = 120 // seconds
+
+// maintenanceState tracks which @box:maintainable handlers are switched to 503
+// Keys use the same "package.function" format as Config.Handlers
+type maintenanceState struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+}
+
+// newMaintenanceState copies the initial toggles so later changes to the caller's map have no effect
+func newMaintenanceState(initial map[string]bool) *maintenanceState {
+	enabled := make(map[string]bool, len(initial))
+	for key, on := range initial {
+		enabled[key] = on
+	}
+	return &maintenanceState{enabled: enabled}
+}
+
+// isEnabled reports whether the handler is currently in maintenance
+func (m *maintenanceState) isEnabled(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled[key]
+}
+
+// set switches maintenance on or off for a handler
+func (m *maintenanceState) set(key string, on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled[key] = on
+}
+
+// SetMaintenance switches a @box:maintainable handler ("package.function") in or out of maintenance
+// Takes effect on the next request; safe to call while serving (e.g., from a config watcher)
+func (r *Router) SetMaintenance(handlerKey string, enabled bool) error {
+	if !r.isMaintainable(handlerKey) {
+		return fmt.Errorf("handler %s is not marked %s", handlerKey, annotations.AnnotationName(annotations.KeyMaintainable))
+	}
+
+	r.maintenance.set(handlerKey, enabled)
+	return nil
+}
+
+// InMaintenance reports whether a handler ("package.function") is currently in maintenance
+func (r *Router) InMaintenance(handlerKey string) bool {
+	return r.maintenance.isEnabled(handlerKey)
+}
+
+// isMaintainable reports whether a parsed handler with this key carries @box:maintainable
+func (r *Router) isMaintainable(handlerKey string) bool {
+	for _, handler := range r.handlers {
+		if handlerKey == handler.PackageName+"."+handler.FunctionName {
+			return handler.Maintainable
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultMetricsPath is where the router serves metrics when Config.MetricsPath is empty
+const DefaultMetricsPath = "/metrics"
+
+// MetricsRegistry holds the metrics the router serves at Config.MetricsPath: its request
+// metrics, the Go runtime and process collectors, and any application metrics. Register
+// histograms, gauges and collectors with it directly, or through promauto.With
+var MetricsRegistry = prometheus.NewRegistry()
+
+// Request metrics recorded by MetricsMiddleware
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total HTTP requests processed, by method, route and status code.",
+	}, []string{"method", "path", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		requestsTotal,
+		requestDuration,
+		requestsInFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MustRegisterCustomCounter registers an application counter in MetricsRegistry, served
+// alongside the router's request metrics. It panics if the name or a label is invalid or
+// the name is taken, so call it once, typically from a package-level var or init()
+func MustRegisterCustomCounter(name, help string, labels []string) *prometheus.CounterVec {
+	// client_golang accepts any UTF-8 name, which scrapers using the classic format can't read
+	if !model.LegacyValidation.IsValidMetricName(name) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !model.LegacyValidation.IsValidLabelName(label) {
+			panic(fmt.Sprintf("invalid label name %q for metric %s", label, name))
+		}
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	MetricsRegistry.MustRegister(counter)
+	return counter
+}
+
+// MetricsHandler serves MetricsRegistry in the Prometheus exposition format
+func MetricsHandler() http.HandlerFunc {
+	return promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{}).ServeHTTP
+}
+
+// MetricsMiddleware records http_requests_total, http_request_duration_seconds and
+// http_requests_in_flight. The path label is operation when set, and otherwise the matched
+// route pattern (e.g., "/users/{id}") so label cardinality stays bounded
+func MetricsMiddleware(operation string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestsInFlight.Inc()
+			defer requestsInFlight.Dec()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			path := operation
+			if path == "" {
+				if rctx := chi.RouteContext(r.Context()); rctx != nil {
+					path = rctx.RoutePattern()
+				}
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			requestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(status)).Inc()
+			requestDuration.WithLabelValues(r.Method, path).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -2,8 +2,11 @@ package router
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,18 +18,55 @@ import (
 
 // CORSMiddleware creates CORS middleware from annotation config
 func CORSMiddleware(config *annotations.CORSConfig) func(http.Handler) http.Handler {
-	return cors.Handler(cors.Options{
+	options := cors.Options{
 		AllowedOrigins:   config.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	})
+		ExposedHeaders:   config.EffectiveExposedHeaders(),
+		AllowCredentials: config.AllowCredentials,
+		MaxAge:           config.EffectiveMaxAge(),
+	}
+
+	// Match subdomain patterns (https://*.example.com) ourselves; the func replaces AllowedOrigins.
+	// With credentials, matching through the func also makes an "*" allowlist echo the Origin,
+	// since browsers reject credentialed responses that allow "*"
+	if config.HasWildcardSubdomains() || config.AllowCredentials {
+		options.AllowedOrigins = nil
+		options.AllowOriginFunc = func(r *http.Request, origin string) bool {
+			return config.AllowsOrigin(origin)
+		}
+	}
+
+	return cors.Handler(options)
 }
 
 // AuthMiddleware creates authentication middleware
-func AuthMiddleware(config annotations.AuthConfig, logger *zap.Logger) func(http.Handler) http.Handler {
+// A handler with a JWKS endpoint validates JWTs against it instead of using validator.
+// With requiredRoles, the token's roles claim must include at least one of them; requests
+// without a verified identity are then rejected rather than passed through
+func AuthMiddleware(config annotations.AuthConfig, requiredRoles []string, validator TokenValidator, logger *zap.Logger) func(http.Handler) http.Handler {
+	if config.JWKSEndpoint != "" {
+		validator = loadJWTValidator(config, logger)
+	}
+	return authMiddleware(config, requiredRoles, validator, logger)
+}
+
+// loadJWTValidator creates a validator for the JWKS endpoint, issuer and audience of config
+// and fetches its keys, so the first requests don't wait for them
+func loadJWTValidator(config annotations.AuthConfig, logger *zap.Logger) *JWTValidator {
+	validator := NewJWTValidator(config.JWKSEndpoint, config.Issuer, config.Audience, logger)
+	if err := validator.Refresh(context.Background()); err != nil {
+		if config.StrictJWKS {
+			logger.Error("Failed to fetch JWKS; rejecting tokens until it loads", zap.String("url", config.JWKSEndpoint), zap.Error(err))
+		} else {
+			logger.Warn("Failed to fetch JWKS; accepting all bearer tokens until it loads", zap.String("url", config.JWKSEndpoint), zap.Error(err))
+		}
+	}
+	return validator
+}
+
+// authMiddleware checks bearer tokens with validator, which the caller resolves for config
+func authMiddleware(config annotations.AuthConfig, requiredRoles []string, validator TokenValidator, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get Authorization header
@@ -36,45 +76,117 @@ func AuthMiddleware(config annotations.AuthConfig, logger *zap.Logger) func(http
 				// Auth required: reject if no valid token
 				if authHeader == "" {
 					logger.Warn("Missing authorization header", zap.String("path", r.URL.Path))
-					http.Error(w, `{"error":"Authorization required"}`, http.StatusUnauthorized)
+					WriteError(w, r, http.StatusUnauthorized, "Authorization required")
 					return
 				}
 
-				// TODO: Validate Bearer token
-				// For now, just check it starts with "Bearer "
 				if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
 					logger.Warn("Invalid authorization format", zap.String("path", r.URL.Path))
-					http.Error(w, `{"error":"Invalid authorization format"}`, http.StatusUnauthorized)
+					WriteError(w, r, http.StatusUnauthorized, "Invalid authorization format")
 					return
 				}
-
-				// TODO: Validate token with auth provider
-				// For now, accept any Bearer token
-				logger.Debug("Auth token present (validation stubbed)", zap.String("path", r.URL.Path))
 			} else if config.Type == annotations.AuthOptional {
 				// Auth optional: check if present, but don't reject if missing
-				if authHeader != "" {
-					logger.Debug("Optional auth token present", zap.String("path", r.URL.Path))
-					// TODO: Validate token if present
+				if authHeader == "" {
+					next.ServeHTTP(w, r)
+					return
 				}
+				logger.Debug("Optional auth token present", zap.String("path", r.URL.Path))
 			}
 
-			next.ServeHTTP(w, r)
+			// Without a validator any Bearer token is accepted and no identity is attached
+			if validator == nil {
+				if len(requiredRoles) > 0 {
+					logger.Error("Roles required but no token validator is configured", zap.String("path", r.URL.Path))
+					WriteError(w, r, http.StatusForbidden, "Insufficient role")
+					return
+				}
+				logger.Debug("Auth token present (no token validator configured)", zap.String("path", r.URL.Path))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A token that was sent must be valid, even where auth is optional
+			token, ok := strings.CutPrefix(authHeader, "Bearer ")
+			if !ok {
+				logger.Warn("Invalid authorization format", zap.String("path", r.URL.Path))
+				WriteError(w, r, http.StatusUnauthorized, "Invalid authorization format")
+				return
+			}
+			identity, err := validator.ValidateToken(r.Context(), token)
+			if errors.Is(err, ErrJWKSUnavailable) && !config.StrictJWKS && len(requiredRoles) == 0 {
+				logger.Warn("JWKS unavailable, accepting token unverified", zap.String("path", r.URL.Path))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil || identity == nil {
+				logger.Warn("Token validation failed", zap.String("path", r.URL.Path), zap.Error(err))
+				WriteError(w, r, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+
+			if len(requiredRoles) > 0 && !hasAnyRole(identity, config.EffectiveRolesClaimKey(), requiredRoles) {
+				logger.Warn("Caller lacks a required role",
+					zap.String("path", r.URL.Path),
+					zap.String("subject", identity.Subject()),
+					zap.Strings("required_roles", requiredRoles))
+				WriteError(w, r, http.StatusForbidden, "Insufficient role")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
 		})
 	}
 }
 
-// RateLimitMiddleware creates rate limiting middleware
-func RateLimitMiddleware(config *annotations.RateLimitConfig, logger *zap.Logger) func(http.Handler) http.Handler {
-	// Create in-memory rate limiter
-	limiter := NewInMemoryRateLimiter(config.Count, config.Period)
+// BypassSubject is the fake identity injected when auth bypass is enabled
+const BypassSubject = "dev-bypass-user"
+
+// contextKey is the type for values stored in the request context by middleware
+type contextKey string
+
+// AuthSubjectFromContext returns the subject of the request's Identity
+func AuthSubjectFromContext(ctx context.Context) (string, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return identity.Subject(), true
+}
+
+// AuthBypassMiddleware skips token checks and injects a fake authenticated identity
+// Only used for local development; the router refuses to enable it in production
+func AuthBypassMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Auth bypassed", zap.String("path", r.URL.Path), zap.String("subject", BypassSubject))
+			ctx := WithIdentity(r.Context(), Claims{"sub": BypassSubject})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
+// RateLimitMiddleware creates rate limiting middleware backed by the given limiter.
+// Limiter errors fail open: the request is served and the error logged, so a backend
+// outage degrades rate limiting rather than the endpoint
+func RateLimitMiddleware(config *annotations.RateLimitConfig, limiter RateLimiter, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Use IP address as key (in production, use user ID from auth)
+			// Key authenticated callers by subject so they keep one budget across addresses
 			key := r.RemoteAddr
+			if identity, ok := IdentityFromContext(r.Context()); ok && identity.Subject() != "" {
+				key = "sub:" + identity.Subject()
+			}
 
-			allowed, remaining, resetTime := limiter.Allow(key)
+			allowed, remaining, resetTime, err := limiter.Allow(key)
+			if err != nil {
+				logger.Error("Rate limiter unavailable, allowing request",
+					zap.String("key", key),
+					zap.String("path", r.URL.Path),
+					zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
 
 			// Set rate limit headers
 			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", config.Count))
@@ -87,7 +199,7 @@ func RateLimitMiddleware(config *annotations.RateLimitConfig, logger *zap.Logger
 					zap.String("path", r.URL.Path))
 
 				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(time.Until(resetTime).Seconds())))
-				http.Error(w, `{"error":"Rate limit exceeded"}`, http.StatusTooManyRequests)
+				WriteError(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
 			}
 
@@ -96,6 +208,36 @@ func RateLimitMiddleware(config *annotations.RateLimitConfig, logger *zap.Logger
 	}
 }
 
+// DisconnectMiddleware cancels the request context once the client goes away, so database
+// queries and outbound calls made with r.Context() stop instead of finishing for nobody.
+// net/http servers already do this; the middleware covers response writers that only
+// report disconnects through http.CloseNotifier
+func DisconnectMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			notifier, ok := w.(http.CloseNotifier)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			closed := notifier.CloseNotify()
+			go func() {
+				select {
+				case <-closed:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // TimeoutMiddleware creates timeout middleware
 func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -116,15 +258,119 @@ func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 				// Request completed successfully
 				return
 			case <-ctx.Done():
+				// A disconnected client can't receive the timeout response
+				if r.Context().Err() != nil {
+					return
+				}
+
 				// Request timed out
-				http.Error(w, `{"error":"Request timeout"}`, http.StatusGatewayTimeout)
+				WriteError(w, r, http.StatusGatewayTimeout, "Request timeout")
+				return
+			}
+		})
+	}
+}
+
+// MaintenanceMiddleware responds 503 with Retry-After while inMaintenance reports true
+// The toggle is checked on every request so maintenance can be flipped without a restart
+func MaintenanceMiddleware(inMaintenance func() bool, retryAfter int, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if inMaintenance() {
+				logger.Debug("Endpoint in maintenance", zap.String("path", r.URL.Path))
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+				WriteError(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable for maintenance")
 				return
 			}
+
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// InMemoryRateLimiter implements a simple in-memory rate limiter
+// PreloadMiddleware adds a Link rel=preload header for each resource to GET and HEAD responses
+func PreloadMiddleware(preloads []string) func(http.Handler) http.Handler {
+	links := make([]string, 0, len(preloads))
+	for _, resource := range preloads {
+		links = append(links, PreloadLink(resource))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				for _, link := range links {
+					w.Header().Add("Link", link)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preloadDestinations maps file extensions to the Link "as" attribute
+var preloadDestinations = map[string]string{
+	".css":   "style",
+	".js":    "script",
+	".mjs":   "script",
+	".woff":  "font",
+	".woff2": "font",
+	".ttf":   "font",
+	".otf":   "font",
+	".png":   "image",
+	".jpg":   "image",
+	".jpeg":  "image",
+	".gif":   "image",
+	".webp":  "image",
+	".avif":  "image",
+	".svg":   "image",
+	".json":  "fetch",
+}
+
+// PreloadLink formats the Link header value for a preload resource
+// e.g., "/static/app.css" -> "</static/app.css>; rel=preload; as=style"
+func PreloadLink(resource string) string {
+	link := fmt.Sprintf("<%s>; rel=preload", resource)
+
+	// Strip any query or fragment before looking at the extension
+	name := resource
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+
+	as, ok := preloadDestinations[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return link
+	}
+
+	link += "; as=" + as
+
+	// Fonts and fetches are always requested in CORS mode
+	if as == "font" || as == "fetch" {
+		link += "; crossorigin"
+	}
+
+	return link
+}
+
+// RateLimiter decides whether a request identified by key may proceed, returning the
+// remaining budget and when the window resets
+type RateLimiter interface {
+	Allow(key string) (allowed bool, remaining int, resetTime time.Time, err error)
+}
+
+// scopedRateLimiter prefixes keys so handlers sharing a backend keep separate budgets
+type scopedRateLimiter struct {
+	RateLimiter
+	scope string
+}
+
+func (l scopedRateLimiter) Allow(key string) (bool, int, time.Time, error) {
+	return l.RateLimiter.Allow(l.scope + ":" + key)
+}
+
+// InMemoryRateLimiter implements a simple in-memory rate limiter. Its counts are local to
+// the process; use RedisRateLimiter to share them across instances
 type InMemoryRateLimiter struct {
 	mu      sync.RWMutex
 	buckets map[string]*bucket
@@ -152,7 +398,7 @@ func NewInMemoryRateLimiter(limit int, window time.Duration) *InMemoryRateLimite
 }
 
 // Allow checks if a request is allowed for the given key
-func (l *InMemoryRateLimiter) Allow(key string) (allowed bool, remaining int, resetTime time.Time) {
+func (l *InMemoryRateLimiter) Allow(key string) (allowed bool, remaining int, resetTime time.Time, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -172,10 +418,10 @@ func (l *InMemoryRateLimiter) Allow(key string) (allowed bool, remaining int, re
 	// Check if under limit
 	if b.count < l.limit {
 		b.count++
-		return true, l.limit - b.count, b.resetTime
+		return true, l.limit - b.count, b.resetTime, nil
 	}
 
-	return false, 0, b.resetTime
+	return false, 0, b.resetTime, nil
 }
 
 // cleanup removes expired buckets periodically
@@ -0,0 +1,99 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page size defaults for @box:paginated endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Page identifies the requested slice of a paginated collection
+type Page struct {
+	Number int      // 1-based page number
+	Limit  int      // Items per page
+	URL    *url.URL // Request URL the Link header targets are built from
+}
+
+// Offset returns the zero-based index of the first item on the page
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Limit
+}
+
+// PageFromRequest reads the page and limit query parameters
+// Missing values default to page 1 and DefaultPageLimit; limit is capped at MaxPageLimit
+func PageFromRequest(r *http.Request) (Page, error) {
+	page := Page{Number: 1, Limit: DefaultPageLimit, URL: r.URL}
+	query := r.URL.Query()
+
+	if value := query.Get("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return Page{}, fmt.Errorf("page must be a positive integer, got: %s", value)
+		}
+		page.Number = number
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return Page{}, fmt.Errorf("limit must be a positive integer, got: %s", value)
+		}
+		page.Limit = min(limit, MaxPageLimit)
+	}
+
+	return page, nil
+}
+
+// WritePage writes items as a JSON array with X-Total-Count and RFC 5988 Link headers
+// e.g., Link: </users?limit=20&page=1>; rel="first", </users?limit=20&page=3>; rel="next", ...
+func WritePage(w http.ResponseWriter, items interface{}, page Page, total int) error {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Add("Link", PageLinks(page, total))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	return json.NewEncoder(w).Encode(items)
+}
+
+// PageLinks formats the first, prev, next and last links for a page of total items
+// prev and next are omitted on the first and last pages
+func PageLinks(page Page, total int) string {
+	lastPage := 1
+	if page.Limit > 0 && total > 0 {
+		lastPage = (total + page.Limit - 1) / page.Limit
+	}
+
+	links := []string{pageLink(page, 1, "first")}
+	if page.Number > 1 {
+		links = append(links, pageLink(page, min(page.Number-1, lastPage), "prev"))
+	}
+	if page.Number < lastPage {
+		links = append(links, pageLink(page, page.Number+1, "next"))
+	}
+	links = append(links, pageLink(page, lastPage, "last"))
+
+	return strings.Join(links, ", ")
+}
+
+// pageLink builds a single Link entry, preserving the request's other query parameters
+func pageLink(page Page, number int, rel string) string {
+	target := url.URL{}
+	if page.URL != nil {
+		target = *page.URL
+	}
+
+	query := target.Query()
+	query.Set("page", strconv.Itoa(number))
+	query.Set("limit", strconv.Itoa(page.Limit))
+	target.RawQuery = query.Encode()
+
+	return fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel)
+}
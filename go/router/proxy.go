@@ -0,0 +1,35 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+// newProxyHandler forwards requests to upstream for @box:proxy routes
+// The request path and query are appended to the upstream URL (https://api.example.com/v2
+// serves GET /users?page=2 from https://api.example.com/v2/users?page=2), and the
+// X-Forwarded-* headers describe the original request
+func newProxyHandler(upstream string, logger *zap.Logger) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || target.Host == "" {
+		return nil, fmt.Errorf("invalid proxy upstream %q", upstream)
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Warn("Proxy upstream request failed",
+				zap.String("upstream", upstream),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			WriteError(w, r, http.StatusBadGateway, "Upstream unavailable")
+		},
+	}, nil
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisKeyPrefix namespaces rate limit keys in a shared Redis
+	redisKeyPrefix = "box:ratelimit:"
+
+	// redisTimeout bounds dialing and each round trip so a slow Redis can't stall requests
+	redisTimeout = 2 * time.Second
+
+	// redisMaxIdle is the number of idle connections kept per limiter
+	redisMaxIdle = 8
+)
+
+// slidingWindowScript trims entries older than the window, admits the request when the
+// set holds fewer than limit entries, and reports the remaining budget and the time the
+// oldest entry leaves the window. Scores are Unix milliseconds
+//
+// KEYS[1] = sorted set; ARGV = now, window, limit, member
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+
+local reset = now + window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window
+end
+
+return {allowed, limit - count, reset}
+`
+
+// RedisRateLimiter implements a sliding-window rate limiter on a Redis sorted set, so
+// every instance sharing the Redis enforces one limit
+type RedisRateLimiter struct {
+	limit  int
+	window time.Duration
+
+	client *redis.Client
+	script *redis.Script
+
+	// Members must be unique across instances; the instance ID and counter keep them so
+	instanceID string
+	seq        atomic.Uint64
+}
+
+// NewRedisRateLimiter connects to the Redis at redisURL (redis://[user:password@]host[:port][/db],
+// or rediss:// for TLS) and allows limit requests per key in any window-long interval
+func NewRedisRateLimiter(redisURL string, limit int, window time.Duration) (*RedisRateLimiter, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("rate limit must be positive, got %d", limit)
+	}
+	if window < time.Millisecond {
+		return nil, fmt.Errorf("rate limit window must be at least 1ms, got %s", window)
+	}
+
+	options, err := redisOptions(redisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate limiter ID: %w", err)
+	}
+
+	l := &RedisRateLimiter{
+		limit:      limit,
+		window:     window,
+		client:     redis.NewClient(options),
+		script:     redis.NewScript(slidingWindowScript),
+		instanceID: hex.EncodeToString(id),
+	}
+
+	// Fail at startup rather than on the first request
+	if err := l.client.Ping(context.Background()).Err(); err != nil {
+		l.client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", options.Addr, err)
+	}
+
+	return l, nil
+}
+
+// Allow records a request for key if it is within the limit
+func (l *RedisRateLimiter) Allow(key string) (allowed bool, remaining int, resetTime time.Time, err error) {
+	now := time.Now().UnixMilli()
+	member := fmt.Sprintf("%d-%s-%d", now, l.instanceID, l.seq.Add(1))
+
+	// Run tries EVALSHA and loads the script with EVAL when the server doesn't have it
+	values, err := l.script.Run(context.Background(), l.client, []string{redisKeyPrefix + key},
+		now, l.window.Milliseconds(), l.limit, member).Int64Slice()
+	if err != nil {
+		return false, 0, time.Time{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	if len(values) != 3 {
+		return false, 0, time.Time{}, fmt.Errorf("unexpected rate limit script reply: %v", values)
+	}
+
+	return values[0] == 1, int(values[1]), time.UnixMilli(values[2]), nil
+}
+
+// Close closes the limiter's connections
+func (l *RedisRateLimiter) Close() error {
+	return l.client.Close()
+}
+
+// redisOptions parses a Redis URL into client options with the limiter's timeouts
+func redisOptions(redisURL string) (*redis.Options, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported redis URL scheme %q (expected redis or rediss)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("redis URL %q has no host", redisURL)
+	}
+
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	options.DialTimeout = redisTimeout
+	options.ReadTimeout = redisTimeout
+	options.WriteTimeout = redisTimeout
+	options.MaxIdleConns = redisMaxIdle
+	return options, nil
+}
@@ -3,41 +3,119 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 
 	"go.uber.org/zap"
 )
 
 // handlerRegistry maps package.function names to HTTP handlers
+// Handler functions are stored through the http.Handler interface, like any other handler value.
+// It is safe for concurrent use, so handlers may register from init functions or parallel tests
 type handlerRegistry struct {
-	handlers map[string]http.HandlerFunc
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
 	logger   *zap.Logger
 }
 
 // newHandlerRegistry creates a new handler registry
 func newHandlerRegistry(logger *zap.Logger) *handlerRegistry {
 	return &handlerRegistry{
-		handlers: make(map[string]http.HandlerFunc),
+		handlers: make(map[string]http.Handler),
 		logger:   logger,
 	}
 }
 
 // register adds a handler to the registry
-func (r *handlerRegistry) register(packageName, functionName string, handler http.HandlerFunc) {
+func (r *handlerRegistry) register(packageName, functionName string, handler http.Handler) {
 	key := fmt.Sprintf("%s.%s", packageName, functionName)
+	r.mu.Lock()
 	r.handlers[key] = handler
+	r.mu.Unlock()
 	if r.logger != nil {
 		r.logger.Debug("Handler registered", zap.String("handler", key))
 	}
 }
 
 // getHandler retrieves a handler by package and function name
-func (r *handlerRegistry) getHandler(packageName, functionName string) (http.HandlerFunc, error) {
+func (r *handlerRegistry) getHandler(packageName, functionName string) (http.Handler, error) {
 	key := fmt.Sprintf("%s.%s", packageName, functionName)
 
+	r.mu.RLock()
 	handler, exists := r.handlers[key]
+	r.mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("handler not found: %s", key)
 	}
 
 	return handler, nil
 }
+
+// Len returns the number of registered handlers
+func (r *handlerRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.handlers)
+}
+
+// List returns the registered package.function names, sorted
+func (r *handlerRegistry) List() []string {
+	r.mu.RLock()
+	keys := make([]string, 0, len(r.handlers))
+	for key := range r.handlers {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// MiddlewareRegistry maps the names used in @box:middleware to middleware
+// It is safe for concurrent use, so middleware may register from init functions
+type MiddlewareRegistry struct {
+	mu         sync.RWMutex
+	middleware map[string]func(http.Handler) http.Handler
+}
+
+// NewMiddlewareRegistry creates an empty middleware registry
+func NewMiddlewareRegistry() *MiddlewareRegistry {
+	return &MiddlewareRegistry{middleware: make(map[string]func(http.Handler) http.Handler)}
+}
+
+// Register adds middleware under name, replacing any earlier registration
+func (r *MiddlewareRegistry) Register(name string, mw func(http.Handler) http.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware[name] = mw
+}
+
+// Lookup returns the middleware registered under name
+func (r *MiddlewareRegistry) Lookup(name string) (func(http.Handler) http.Handler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	mw, ok := r.middleware[name]
+	return mw, ok
+}
+
+// List returns the registered middleware names, sorted
+func (r *MiddlewareRegistry) List() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.middleware))
+	for name := range r.middleware {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// middlewareRegistry holds the middleware registered with RegisterMiddleware
+var middlewareRegistry = NewMiddlewareRegistry()
+
+// RegisterMiddleware makes mw available to handlers annotated @box:middleware name
+// Register before calling New; typically called from init()
+func RegisterMiddleware(name string, mw func(http.Handler) http.Handler) {
+	middlewareRegistry.Register(name, mw)
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gravelight-studio/box/go/annotations"
+)
+
+const retryCountKey contextKey = "box.retry.count"
+
+// RetryCountFromContext returns how many times the request was retried before the current
+// attempt: 0 on the first attempt, and for handlers without @box:retry
+func RetryCountFromContext(ctx context.Context) int {
+	count, _ := ctx.Value(retryCountKey).(int)
+	return count
+}
+
+// RetryMiddleware re-invokes the handler, up to config.Attempts invocations in all, while
+// it responds with a 5xx status or panics, waiting config.Delay between attempts. Each
+// attempt writes to a buffer, so only the final response reaches the client; handlers that
+// stream or flush are held back until they return. The request body is replayed on every
+// attempt. Requests whose method isn't idempotent are served once unless idempotent is set.
+// A panic on the last attempt is re-raised
+func RetryMiddleware(config *annotations.RetryConfig, idempotent bool, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Attempts <= 1 || !(idempotent || annotations.IdempotentMethod(r.Method)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				var err error
+				if body, err = io.ReadAll(r.Body); err != nil {
+					WriteError(w, r, http.StatusBadRequest, "Failed to read request body")
+					return
+				}
+			}
+
+			for attempt := 1; ; attempt++ {
+				req := r.WithContext(context.WithValue(r.Context(), retryCountKey, attempt-1))
+				if body != nil {
+					req.Body = io.NopCloser(bytes.NewReader(body))
+				}
+
+				rec := httptest.NewRecorder()
+				recovered := serveRecovering(next, rec, req)
+				failed := recovered != nil || rec.Code >= http.StatusInternalServerError
+
+				if failed && attempt < config.Attempts {
+					delay := retryDelay(config, attempt)
+					logger.Warn("Handler failed, retrying",
+						zap.String("path", r.URL.Path),
+						zap.Int("attempt", attempt),
+						zap.Int("status", rec.Code),
+						zap.Bool("panicked", recovered != nil),
+						zap.Duration("delay", delay))
+
+					timer := time.NewTimer(delay)
+					select {
+					case <-timer.C:
+						continue
+					case <-r.Context().Done():
+						// Nobody is waiting for another attempt; send this one's response
+						timer.Stop()
+					}
+				}
+
+				if recovered != nil {
+					panic(recovered)
+				}
+				for name, values := range rec.Header() {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(rec.Code)
+				w.Write(rec.Body.Bytes())
+				return
+			}
+		})
+	}
+}
+
+// serveRecovering calls next, returning the value it panicked with, if any. An aborted
+// handler (http.ErrAbortHandler) is not retried, so that panic propagates
+func serveRecovering(next http.Handler, w http.ResponseWriter, r *http.Request) (recovered any) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			recovered = v
+		}
+	}()
+	next.ServeHTTP(w, r)
+	return nil
+}
+
+// retryDelay returns the wait before retry n, drawing a random share of it for jitter
+func retryDelay(config *annotations.RetryConfig, n int) time.Duration {
+	delay := config.Delay(n)
+	if config.BackoffType == annotations.RetryBackoffJitter && delay > 0 {
+		return rand.N(delay + 1)
+	}
+	return delay
+}
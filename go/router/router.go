@@ -1,11 +1,15 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 
 	"github.com/gravelight-studio/box/go/annotations"
@@ -14,19 +18,122 @@ import (
 // Router wraps Chi router with annotation-driven routing
 type Router struct {
 	chi.Router
-	handlers []annotations.Handler
-	logger   *zap.Logger
+	handlers    []annotations.Handler
+	logger      *zap.Logger
+	authBypass  bool
+	environment string         // Selects each @box:proxy route's upstream
+	deployment  DeploymentInfo // Attached to each request with the handler's function name
+
+	maintenance           *maintenanceState
+	maintenanceRetryAfter int // seconds
+
+	groups     map[string][]func(http.Handler) http.Handler
+	middleware *MiddlewareRegistry
+
+	tokenValidator     TokenValidator
+	jwtValidators      map[jwtValidatorKey]*JWTValidator // Shared by handlers with the same JWKS settings
+	rateLimiterFactory func(config *annotations.RateLimitConfig) RateLimiter
+	cacheStore         CacheStore
+	circuitStore       CircuitBreakerStore
+	optionsHints       bool
+	errorFormat        ErrorFormat
+	tracerProvider     *sdktrace.TracerProvider // Nil when tracing is disabled
+	metricsEnabled     bool
 }
 
 // Config holds router configuration
 type Config struct {
-	HandlersDir string                        // Directory to scan for handlers (e.g., "./internal/handlers")
+	HandlersDir string // Directory to scan for handlers (e.g., "./internal/handlers")
 	Logger      *zap.Logger
-	Handlers    map[string]http.HandlerFunc   // Map of handler implementations (key format: "package.function")
+	Handlers    map[string]http.HandlerFunc // Map of handler implementations (key format: "package.function")
+	Environment string                      // Environment name (e.g., "dev", "production"); defaults to $ENVIRONMENT
+	AuthBypass  bool                        // Skip token checks and inject a fake identity (never allowed in production)
+	HealthPath  string                      // Serve HealthHandler at this path (e.g., "/health"); empty disables it
+
+	// HTTPHandlers holds implementations that are handler values rather than functions, keyed
+	// like Handlers: the result of a func() http.Handler handler, or a library's handler
+	HTTPHandlers map[string]http.Handler
+
+	// TokenValidator checks bearer tokens on @box:auth routes and supplies the Identity
+	// handlers read with IdentityFromContext. Nil accepts any Bearer token
+	TokenValidator TokenValidator
+
+	// Maintenance holds the initial maintenance toggles for @box:maintainable handlers,
+	// keyed by "package.function". Change them at runtime with Router.SetMaintenance
+	Maintenance           map[string]bool
+	MaintenanceRetryAfter int // Retry-After seconds sent with maintenance 503s (default: DefaultMaintenanceRetryAfter)
+
+	// Groups holds middleware shared by the handlers of each @box:group, keyed by group name.
+	// It runs after the handler's auth and rate limiting, so rejected requests never reach it
+	Groups map[string][]func(http.Handler) http.Handler
+
+	// RateLimiterFactory builds the limiter for each @box:ratelimit handler. Nil (or a nil
+	// result) uses an InMemoryRateLimiter; return a RedisRateLimiter to share limits across
+	// instances. Keys are scoped per handler, so one backend can serve every handler
+	RateLimiterFactory func(config *annotations.RateLimitConfig) RateLimiter
+
+	// CacheStore holds the responses of @box:cache handlers. Nil keeps them in an
+	// InMemoryCacheStore shared by the router's handlers; implement CacheStore over Redis
+	// to share them across instances. Keys are scoped per handler, as with rate limits
+	CacheStore CacheStore
+
+	// CircuitBreakerStore holds the circuit state of @box:circuit-breaker handlers, shared by
+	// every request to them. Nil keeps it in an InMemoryCircuitBreakerStore; read it with
+	// CircuitBreakerStats
+	CircuitBreakerStore CircuitBreakerStore
+
+	// AutoPromote treats functions whose @box:timeout exceeds the Cloud Functions limit as
+	// containers instead of failing validation, matching box build --auto-promote
+	AutoPromote bool
+
+	// OptionsHints adds X-RateLimit-Limit and X-Timeout to OPTIONS discovery responses,
+	// describing each method's @box:ratelimit and @box:timeout. Allow is always sent
+	OptionsHints bool
+
+	// ErrorFormat selects the JSON envelope of auth, rate limit, timeout and maintenance
+	// errors. ErrorFormatGateway matches the errors API Gateway returns in front of the
+	// deployed functions (default: ErrorFormatBox)
+	ErrorFormat ErrorFormat
+
+	// TracingEnabled records a span for every request (except @box:tracing false handlers)
+	// and continues W3C traceparent traces from callers. Spans go to SpanExporter, or to
+	// the OTLP/HTTP collector at OTLPEndpoint (default: $OTEL_EXPORTER_OTLP_ENDPOINT, then
+	// DefaultOTLPEndpoint). Call Router.Shutdown on exit to flush them
+	TracingEnabled bool
+	OTLPEndpoint   string
+	SpanExporter   sdktrace.SpanExporter
+
+	// MetricsEnabled records Prometheus request metrics for every handler and serves them,
+	// with any MustRegisterCustomCounter metrics, at MetricsPath (default: DefaultMetricsPath)
+	MetricsEnabled bool
+	MetricsPath    string
 }
 
 // New creates a new annotation-driven router
 func New(config Config) (*Router, error) {
+	// Resolve environment for safety checks
+	if config.Environment == "" {
+		config.Environment = os.Getenv("ENVIRONMENT")
+	}
+
+	// Auth bypass must never be enabled in production
+	if config.AuthBypass {
+		if isProductionEnvironment(config.Environment) {
+			return nil, fmt.Errorf("auth bypass cannot be enabled in environment %q", config.Environment)
+		}
+		config.Logger.Warn("AUTH BYPASS ENABLED - all auth-protected routes accept unauthenticated requests. Never use outside local development",
+			zap.String("environment", config.Environment),
+			zap.String("subject", BypassSubject))
+	}
+
+	switch config.ErrorFormat {
+	case "":
+		config.ErrorFormat = ErrorFormatBox
+	case ErrorFormatBox, ErrorFormatGateway:
+	default:
+		return nil, fmt.Errorf("unknown error format %q (expected %q or %q)", config.ErrorFormat, ErrorFormatBox, ErrorFormatGateway)
+	}
+
 	// Parse handlers from directory
 	parser := annotations.NewParser()
 	result, err := parser.ParseDirectory(config.HandlersDir)
@@ -46,37 +153,104 @@ func New(config Config) (*Router, error) {
 		}
 	}
 
+	if config.AutoPromote {
+		for _, handler := range annotations.AutoPromote(result.Handlers) {
+			config.Logger.Info("Promoted long-running function to container",
+				zap.String("handler", handler.FunctionName),
+				zap.Duration("timeout", handler.Timeout))
+		}
+	}
+
 	// Validate handlers
 	validator := annotations.NewValidator()
+	validator.SetRegisteredMiddleware(middlewareRegistry.List())
 	validationErrors := validator.Validate(result.Handlers)
 	pathErrors := validator.ValidateUniquePaths(result.Handlers)
 	validationErrors = append(validationErrors, pathErrors...)
+	validationErrors = append(validationErrors, validator.ValidateEnvVarConsistency(result.Handlers)...)
 
-	if len(validationErrors) > 0 {
+	// Only error-severity findings block startup; log the rest
+	var fatalErrors []annotations.AnnotationError
+	for _, err := range validationErrors {
+		if err.IsError() {
+			fatalErrors = append(fatalErrors, err)
+			continue
+		}
+		config.Logger.Info("Validation notice",
+			zap.String("severity", string(err.Severity)),
+			zap.String("handler", err.Handler),
+			zap.String("annotation", err.Annotation),
+			zap.String("reason", err.Reason))
+	}
+
+	if len(fatalErrors) > 0 {
 		config.Logger.Error("Handler validation failed",
-			zap.Int("count", len(validationErrors)))
-		for _, err := range validationErrors {
+			zap.Int("count", len(fatalErrors)))
+		for _, err := range fatalErrors {
 			config.Logger.Error("Validation error",
 				zap.String("handler", err.Handler),
 				zap.String("annotation", err.Annotation),
 				zap.String("reason", err.Reason))
 		}
-		return nil, fmt.Errorf("handler validation failed with %d errors", len(validationErrors))
+		return nil, fmt.Errorf("handler validation failed with %d errors", len(fatalErrors))
 	}
 
 	config.Logger.Info("Handlers parsed and validated",
 		zap.Int("count", len(result.Handlers)))
 
 	// Create router
+	if config.MaintenanceRetryAfter <= 0 {
+		config.MaintenanceRetryAfter = DefaultMaintenanceRetryAfter
+	}
+
 	r := &Router{
-		Router:   chi.NewRouter(),
-		handlers: result.Handlers,
-		logger:   config.Logger,
+		Router:                chi.NewRouter(),
+		handlers:              result.Handlers,
+		logger:                config.Logger,
+		authBypass:            config.AuthBypass,
+		environment:           config.Environment,
+		tokenValidator:        config.TokenValidator,
+		deployment:            deploymentInfo(config.Environment),
+		maintenance:           newMaintenanceState(config.Maintenance),
+		maintenanceRetryAfter: config.MaintenanceRetryAfter,
+		groups:                config.Groups,
+		middleware:            middlewareRegistry,
+		rateLimiterFactory:    config.RateLimiterFactory,
+		cacheStore:            config.CacheStore,
+		circuitStore:          config.CircuitBreakerStore,
+		optionsHints:          config.OptionsHints,
+		errorFormat:           config.ErrorFormat,
+		metricsEnabled:        config.MetricsEnabled,
+	}
+
+	// A group without configured middleware would silently drop its checks
+	for _, handler := range r.handlers {
+		if _, ok := config.Groups[handler.Group]; handler.Group != "" && !ok {
+			return nil, fmt.Errorf("handler %s is in group %q, which has no entry in Config.Groups", handler.FunctionName, handler.Group)
+		}
+	}
+
+	// Toggles for unmarked handlers would silently do nothing
+	for key := range config.Maintenance {
+		if !r.isMaintainable(key) {
+			config.Logger.Warn("Maintenance toggle ignored: handler is not marked "+annotations.AnnotationName(annotations.KeyMaintainable),
+				zap.String("handler", key))
+		}
 	}
 
 	// Create internal registry and register all provided handlers
 	registry := newHandlerRegistry(config.Logger)
+	implementations := make(map[string]http.Handler, len(config.Handlers)+len(config.HTTPHandlers))
 	for key, handler := range config.Handlers {
+		implementations[key] = handler
+	}
+	for key, handler := range config.HTTPHandlers {
+		if _, ok := config.Handlers[key]; ok {
+			return nil, fmt.Errorf("handler %s is set in both Handlers and HTTPHandlers", key)
+		}
+		implementations[key] = handler
+	}
+	for key, handler := range implementations {
 		// Parse package.function format
 		parts := strings.SplitN(key, ".", 2)
 		if len(parts) != 2 {
@@ -86,38 +260,89 @@ func New(config Config) (*Router, error) {
 		registry.register(packageName, functionName, handler)
 	}
 
+	if config.TracingEnabled {
+		exporter := config.SpanExporter
+		if exporter == nil {
+			if exporter, err = newOTLPExporterFromConfig(config); err != nil {
+				return nil, err
+			}
+		}
+		serviceName := tracingServiceName(r.deployment)
+		config.Logger.Info("Tracing enabled", zap.String("service", serviceName))
+		r.tracerProvider = newTracerProvider(exporter, serviceName, config.Logger)
+	}
+
 	// Wire up all handlers with routes and middleware
 	if err := r.registerHandlers(registry); err != nil {
+		// Stop the span processor started above, which also shuts down its exporter
+		r.Shutdown(context.Background())
 		return nil, err
 	}
 
+	// Serve registered readiness checks, mirroring the generated containers
+	if config.HealthPath != "" {
+		r.registerBuiltin(config.HealthPath, HealthHandler())
+	}
+
+	if config.MetricsEnabled {
+		if config.MetricsPath == "" {
+			config.MetricsPath = DefaultMetricsPath
+		}
+		r.registerBuiltin(config.MetricsPath, MetricsHandler())
+	}
+
 	return r, nil
 }
 
 // registerHandlers registers all parsed handlers with the router (internal method)
 func (r *Router) registerHandlers(registry *handlerRegistry) error {
+	if missing := r.missingMiddleware(); len(missing) > 0 {
+		return fmt.Errorf("middleware not registered: %s (register them with router.RegisterMiddleware)", strings.Join(missing, ", "))
+	}
+
 	for _, handler := range r.handlers {
+		// Scheduled and Pub/Sub handlers are triggered by events, not served by the router
+		if handler.EventTriggered() {
+			r.logger.Info("Skipping event-triggered handler",
+				zap.String("function", handler.FunctionName))
+			continue
+		}
+
 		r.logger.Info("Registering handler",
 			zap.String("function", handler.FunctionName),
 			zap.String("method", handler.Route.Method),
 			zap.String("path", handler.Route.Path),
 			zap.String("deployment", string(handler.DeploymentType)))
 
-		// Get the actual handler function from registry
-		handlerFunc, err := registry.getHandler(handler.PackageName, handler.FunctionName)
-		if err != nil {
-			r.logger.Error("Handler not found in registry",
-				zap.String("package", handler.PackageName),
+		// Get the actual handler function from registry; proxies forward to their upstream instead
+		var implementation http.Handler
+		if handler.Proxy != nil {
+			upstream := handler.Proxy.UpstreamFor(r.environment)
+			proxy, err := newProxyHandler(upstream, r.logger)
+			if err != nil {
+				return fmt.Errorf("handler %s.%s: %w", handler.PackageName, handler.FunctionName, err)
+			}
+			r.logger.Info("Proxying to upstream",
 				zap.String("function", handler.FunctionName),
-				zap.Error(err))
-			return fmt.Errorf("handler %s.%s not found: %w", handler.PackageName, handler.FunctionName, err)
+				zap.String("upstream", upstream))
+			implementation = proxy
+		} else {
+			var err error
+			implementation, err = registry.getHandler(handler.PackageName, handler.FunctionName)
+			if err != nil {
+				r.logger.Error("Handler not found in registry",
+					zap.String("package", handler.PackageName),
+					zap.String("function", handler.FunctionName),
+					zap.Error(err))
+				return fmt.Errorf("handler %s.%s not found: %w", handler.PackageName, handler.FunctionName, err)
+			}
 		}
 
 		// Build middleware chain for this handler
-		middlewares := buildMiddlewareChain(handler, r.logger)
+		middlewares := r.buildMiddlewareChain(handler)
 
 		// Apply middleware and register route
-		finalHandler := applyMiddleware(handlerFunc, middlewares)
+		finalHandler := applyMiddleware(implementation, middlewares)
 
 		// Register based on HTTP method
 		switch handler.Route.Method {
@@ -140,34 +365,199 @@ func (r *Router) registerHandlers(registry *handlerRegistry) error {
 		}
 	}
 
+	r.registerOptions()
+
 	r.logger.Info("All handlers registered successfully",
 		zap.Int("count", len(r.handlers)))
 
 	return nil
 }
 
+// registerOptions answers OPTIONS on every routed path without an explicit OPTIONS handler
+// chi only routes a handler's declared method, so OPTIONS would otherwise get a 405. The
+// response lists the path's methods in Allow; on paths with @box:cors handlers the first
+// one's CORSMiddleware answers preflights before the discovery response is written
+func (r *Router) registerOptions() {
+	byPath := make(map[string][]annotations.Handler)
+	var paths []string
+	explicit := make(map[string]bool)
+	for _, h := range r.handlers {
+		if h.EventTriggered() {
+			continue
+		}
+		if h.Route.Method == "OPTIONS" {
+			explicit[h.Route.Path] = true
+		}
+		if _, seen := byPath[h.Route.Path]; !seen {
+			paths = append(paths, h.Route.Path)
+		}
+		byPath[h.Route.Path] = append(byPath[h.Route.Path], h)
+	}
+
+	for _, path := range paths {
+		if explicit[path] {
+			continue
+		}
+		handlers := byPath[path]
+
+		var handler http.Handler = r.discoveryHandler(handlers)
+		for _, h := range handlers {
+			if h.CORS != nil {
+				handler = CORSMiddleware(h.CORS)(handler)
+				break
+			}
+		}
+		r.Options(path, handler.ServeHTTP)
+	}
+}
+
+// discoveryHandler answers OPTIONS for one path with its Allow header and, when enabled,
+// per-method hints such as "X-RateLimit-Limit: GET=100;w=3600" and "X-Timeout: POST=30s"
+func (r *Router) discoveryHandler(handlers []annotations.Handler) http.HandlerFunc {
+	methods := []string{"OPTIONS"}
+	var rateLimits, timeouts []string
+	for _, h := range handlers {
+		methods = append(methods, h.Route.Method)
+		if h.RateLimit != nil {
+			rateLimits = append(rateLimits, fmt.Sprintf("%s=%d;w=%d", h.Route.Method, h.RateLimit.Count, int(h.RateLimit.Period.Seconds())))
+		}
+		if h.Timeout > 0 {
+			timeouts = append(timeouts, fmt.Sprintf("%s=%s", h.Route.Method, h.Timeout))
+		}
+	}
+	sort.Strings(methods)
+	allow := strings.Join(methods, ", ")
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", allow)
+		if r.optionsHints {
+			if len(rateLimits) > 0 {
+				w.Header().Set("X-RateLimit-Limit", strings.Join(rateLimits, ", "))
+			}
+			if len(timeouts) > 0 {
+				w.Header().Set("X-Timeout", strings.Join(timeouts, ", "))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// registerBuiltin serves a framework endpoint unless a parsed handler already owns the route
+// User handlers always take precedence over built-ins on the same GET path
+func (r *Router) registerBuiltin(path string, handler http.HandlerFunc) {
+	for _, h := range r.handlers {
+		if h.Route.Method == "GET" && h.Route.Path == path {
+			r.logger.Info("Handler overrides built-in endpoint",
+				zap.String("path", path),
+				zap.String("function", h.FunctionName))
+			return
+		}
+	}
+
+	r.Get(path, handler)
+}
+
+// Shutdown flushes spans waiting to be exported when tracing is enabled, then shuts down
+// the span exporter
+func (r *Router) Shutdown(ctx context.Context) error {
+	if r.tracerProvider == nil {
+		return nil
+	}
+	return r.tracerProvider.Shutdown(ctx)
+}
+
 // GetHandlers returns the list of parsed handlers
 func (r *Router) GetHandlers() []annotations.Handler {
 	return r.handlers
 }
 
 // buildMiddlewareChain creates middleware chain based on annotations
-func buildMiddlewareChain(handler annotations.Handler, logger *zap.Logger) []func(http.Handler) http.Handler {
+func (r *Router) buildMiddlewareChain(handler annotations.Handler) []func(http.Handler) http.Handler {
 	var middlewares []func(http.Handler) http.Handler
+	logger := r.logger
+
+	// Trace first so the span covers every other middleware
+	if r.tracerProvider != nil && !handler.TracingDisabled {
+		middlewares = append(middlewares, tracingMiddleware(r.tracerProvider.Tracer(tracerName)))
+	}
+
+	// Measure next, so latency and status include requests rejected by auth or rate limits
+	if r.metricsEnabled {
+		middlewares = append(middlewares, MetricsMiddleware(handler.MetricsName))
+	}
+
+	// Expose deployment metadata to every handler, as the generated entrypoints do
+	info := r.deployment
+	info.FunctionName = handler.FunctionName
+	middlewares = append(middlewares, DeploymentInfoMiddleware(info))
+	middlewares = append(middlewares, ErrorFormatMiddleware(r.errorFormat))
+	middlewares = append(middlewares, DisconnectMiddleware())
 
 	// Add CORS middleware if specified
 	if handler.CORS != nil {
 		middlewares = append(middlewares, CORSMiddleware(handler.CORS))
 	}
 
-	// Add auth middleware if specified
+	// Reject blocked addresses before anything reveals the endpoint's state
+	if len(handler.AllowIPs) > 0 || len(handler.DenyIPs) > 0 {
+		middlewares = append(middlewares, IPFilterMiddleware(handler.AllowIPs, handler.DenyIPs))
+	}
+
+	// Short-circuit maintainable endpoints before auth and rate limiting
+	if handler.Maintainable {
+		key := handler.PackageName + "." + handler.FunctionName
+		inMaintenance := func() bool { return r.maintenance.isEnabled(key) }
+		middlewares = append(middlewares, MaintenanceMiddleware(inMaintenance, r.maintenanceRetryAfter, logger))
+	}
+
+	// Add auth middleware if specified (bypassed in local development when enabled)
 	if handler.Auth.Type != annotations.AuthNone {
-		middlewares = append(middlewares, AuthMiddleware(handler.Auth, logger))
+		if r.authBypass {
+			middlewares = append(middlewares, AuthBypassMiddleware(logger))
+		} else {
+			validator := r.tokenValidator
+			if handler.Auth.JWKSEndpoint != "" {
+				validator = r.jwtValidator(handler.Auth)
+			}
+			middlewares = append(middlewares, authMiddleware(handler.Auth, handler.RequiredRoles, validator, logger))
+		}
 	}
 
 	// Add rate limiting middleware if specified
 	if handler.RateLimit != nil {
-		middlewares = append(middlewares, RateLimitMiddleware(handler.RateLimit, logger))
+		limiter := r.rateLimiter(handler)
+		middlewares = append(middlewares, RateLimitMiddleware(handler.RateLimit, limiter, logger))
+	}
+
+	// Add group middleware once the caller is authenticated and within limits
+	if handler.Group != "" {
+		middlewares = append(middlewares, r.groups[handler.Group]...)
+	}
+
+	// Add @box:middleware in declaration order; registerHandlers has checked every name
+	for _, name := range handler.CustomMiddleware {
+		if mw, ok := r.middleware.Lookup(name); ok {
+			middlewares = append(middlewares, mw)
+		}
+	}
+
+	// Add response caching once every check has passed, so hits skip only the handler
+	if handler.Cache != nil {
+		if r.cacheStore == nil {
+			r.cacheStore = NewInMemoryCacheStore()
+		}
+		store := scopedCacheStore{CacheStore: r.cacheStore, scope: handler.PackageName + "." + handler.FunctionName}
+		middlewares = append(middlewares, CacheMiddleware(handler.Cache, store))
+	}
+
+	// Add the circuit breaker inside the cache, so hits are served while it is open, and
+	// outside the timeout, so timed-out requests count as failures
+	if handler.CircuitBreaker != nil {
+		if r.circuitStore == nil {
+			r.circuitStore = NewInMemoryCircuitBreakerStore()
+		}
+		name := handler.PackageName + "." + handler.FunctionName
+		middlewares = append(middlewares, CircuitBreakerMiddleware(name, handler.CircuitBreaker, r.circuitStore, logger))
 	}
 
 	// Add timeout middleware if specified
@@ -175,13 +565,128 @@ func buildMiddlewareChain(handler annotations.Handler, logger *zap.Logger) []fun
 		middlewares = append(middlewares, TimeoutMiddleware(handler.Timeout))
 	}
 
+	// Add preload hints last so rejected requests don't advertise resources
+	if len(handler.Preloads) > 0 {
+		middlewares = append(middlewares, PreloadMiddleware(handler.Preloads))
+	}
+
+	// Add retries innermost, so only the handler is re-invoked: the circuit breaker sees the
+	// final outcome, and the timeout bounds every attempt together
+	if handler.Retry != nil {
+		middlewares = append(middlewares, RetryMiddleware(handler.Retry, handler.Idempotent, logger))
+	}
+
 	return middlewares
 }
 
+// missingMiddleware returns the @box:middleware names with no registered middleware, sorted
+func (r *Router) missingMiddleware() []string {
+	seen := make(map[string]bool)
+	var missing []string
+	for _, handler := range r.handlers {
+		if handler.EventTriggered() {
+			continue
+		}
+		for _, name := range handler.CustomMiddleware {
+			if _, ok := r.middleware.Lookup(name); !ok && !seen[name] {
+				seen[name] = true
+				missing = append(missing, name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// newOTLPExporterFromConfig creates the exporter for Config.OTLPEndpoint, falling back to the
+// standard OpenTelemetry environment variable
+func newOTLPExporterFromConfig(config Config) (sdktrace.SpanExporter, error) {
+	endpoint := config.OTLPEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+
+	exporter, err := newOTLPExporter(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter for %s: %w", endpoint, err)
+	}
+	config.Logger.Info("Exporting spans over OTLP/HTTP", zap.String("endpoint", endpoint))
+	return exporter, nil
+}
+
+// tracingServiceName names the service in span resources: $OTEL_SERVICE_NAME, then the
+// deployed service, then "box"
+func tracingServiceName(info DeploymentInfo) string {
+	if serviceName := os.Getenv("OTEL_SERVICE_NAME"); serviceName != "" {
+		return serviceName
+	}
+	if info.Service != "" {
+		return info.Service
+	}
+	return "box"
+}
+
+// jwtValidatorKey identifies the handlers that can share a JWTValidator
+type jwtValidatorKey struct {
+	jwksURL  string
+	issuer   string
+	audience string
+}
+
+// jwtValidator returns the validator for the handler's JWKS endpoint, issuer and audience,
+// created and fetched once for all the handlers that share them
+func (r *Router) jwtValidator(config annotations.AuthConfig) *JWTValidator {
+	key := jwtValidatorKey{jwksURL: config.JWKSEndpoint, issuer: config.Issuer, audience: config.Audience}
+	if validator, ok := r.jwtValidators[key]; ok {
+		return validator
+	}
+
+	if r.jwtValidators == nil {
+		r.jwtValidators = make(map[jwtValidatorKey]*JWTValidator)
+	}
+	validator := loadJWTValidator(config, r.logger)
+	r.jwtValidators[key] = validator
+	return validator
+}
+
+// rateLimiter builds the handler's limiter from the configured factory, scoped to the handler
+func (r *Router) rateLimiter(handler annotations.Handler) RateLimiter {
+	var limiter RateLimiter
+	if r.rateLimiterFactory != nil {
+		limiter = r.rateLimiterFactory(handler.RateLimit)
+	}
+	if limiter == nil {
+		limiter = NewInMemoryRateLimiter(handler.RateLimit.Count, handler.RateLimit.Period)
+	}
+	return scopedRateLimiter{RateLimiter: limiter, scope: handler.PackageName + "." + handler.FunctionName}
+}
+
+// deploymentInfo reads deployment metadata from the environment, defaulting to the router's environment
+func deploymentInfo(environment string) DeploymentInfo {
+	info := DeploymentInfoFromEnv()
+	if info.Environment == "" {
+		info.Environment = environment
+	}
+	return info
+}
+
+// isProductionEnvironment reports whether the environment name denotes production
+func isProductionEnvironment(env string) bool {
+	switch strings.ToLower(strings.TrimSpace(env)) {
+	case "production", "prod":
+		return true
+	default:
+		return false
+	}
+}
+
 // applyMiddleware applies middleware chain to handler
-func applyMiddleware(handler http.HandlerFunc, middlewares []func(http.Handler) http.Handler) http.HandlerFunc {
+func applyMiddleware(handler http.Handler, middlewares []func(http.Handler) http.Handler) http.HandlerFunc {
 	// Apply middleware in reverse order (last middleware wraps first)
-	h := http.Handler(handler)
+	h := handler
 	for i := len(middlewares) - 1; i >= 0; i-- {
 		h = middlewares[i](h)
 	}
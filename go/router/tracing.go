@@ -0,0 +1,135 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultOTLPEndpoint is the OTLP/HTTP collector address used when none is configured
+	DefaultOTLPEndpoint = "http://localhost:4318"
+
+	// tracerName is the instrumentation scope of the router's spans
+	tracerName = "github.com/gravelight-studio/box/go/router"
+)
+
+// traceContext reads and writes the W3C traceparent and tracestate headers
+var traceContext = propagation.TraceContext{}
+
+// TraceIDFromContext returns the trace ID of the request, or "" when it isn't traced
+func TraceIDFromContext(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// SetTraceHeaders adds traceparent and tracestate headers for the request's span to header,
+// continuing the trace in outgoing calls. It does nothing when the request isn't traced
+func SetTraceHeaders(ctx context.Context, header http.Header) {
+	traceContext.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// TracingMiddleware records a server span for each request and hands it to exporter as the
+// request finishes. The router batches spans instead; this is for use outside of it
+func TracingMiddleware(exporter sdktrace.SpanExporter) func(http.Handler) http.Handler {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return tracingMiddleware(provider.Tracer(tracerName))
+}
+
+// tracingMiddleware records a server span for each request with tracer
+// An incoming W3C traceparent continues the caller's trace (keeping its tracestate);
+// otherwise the request starts a new one
+func tracingMiddleware(tracer trace.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			// chi fills in the matched pattern while routing
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			span.SetName(strings.TrimSpace(r.Method + " " + route))
+			span.SetAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.Int("http.status_code", status),
+				attribute.String("http.url", requestURL(r)),
+			)
+			// Following the HTTP server conventions, only 5xx responses are span errors
+			if status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// requestURL reconstructs the absolute URL the client requested
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// newTracerProvider batches spans to exporter in the background, with serviceName as the
+// service.name resource attribute. Shutting it down flushes them and shuts down exporter
+func newTracerProvider(exporter sdktrace.SpanExporter, serviceName string, logger *zap.Logger) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(loggingExporter{SpanExporter: exporter, logger: logger}),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// newOTLPExporter exports spans to the collector at endpoint (e.g., "http://localhost:4318")
+// over OTLP/HTTP, posting to its /v1/traces path
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	// Creating the exporter doesn't connect, so the context only bounds option handling
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(url))
+}
+
+// loggingExporter logs failed exports, which the batching span processor otherwise drops
+type loggingExporter struct {
+	sdktrace.SpanExporter
+	logger *zap.Logger
+}
+
+func (e loggingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		e.logger.Warn("Failed to export spans", zap.Int("spans", len(spans)), zap.Error(err))
+	}
+	return err
+}